@@ -0,0 +1,133 @@
+// Command workersql-gen generates typed Go functions from annotated SQL
+// files, in the style of sqlc:
+//
+//	-- name: GetUser :one
+//	SELECT id, email FROM users WHERE id = ?;
+//
+//	-- name: ListUsers :many
+//	SELECT id, email FROM users ORDER BY id LIMIT ?;
+//
+//	-- name: DeleteUser :exec
+//	DELETE FROM users WHERE id = ?;
+//
+// Commands are :one, :many, :exec, :execresult and :execrows. The result
+// columns and parameter types come from the database the DSN connects to:
+//
+//	workersql-gen -dsn "workersql://api.workersql.com/mydb?apiKey=key" -package db -out db/queries.go queries/
+//
+// Arguments are .sql files or directories holding them. The DSN defaults
+// to the WORKERSQL_DSN environment variable.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/internal/codegen"
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+)
+
+func main() {
+	dsn := flag.String("dsn", os.Getenv("WORKERSQL_DSN"), "WorkerSQL DSN of the database to describe queries with")
+	pkg := flag.String("package", "db", "package name of the generated code")
+	out := flag.String("out", "", "output file (default: stdout)")
+	timeout := flag.Duration("timeout", time.Minute, "time allowed for describing the queries")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: workersql-gen [flags] file.sql|dir ...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if err := run(*dsn, *pkg, *out, *timeout, flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, "workersql-gen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(dsn, pkg, out string, timeout time.Duration, args []string) error {
+	if dsn == "" {
+		return fmt.Errorf("no DSN: set -dsn or WORKERSQL_DSN")
+	}
+	files, err := sqlFiles(args)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no .sql files given")
+	}
+
+	var queries []codegen.Query
+	seen := make(map[string]codegen.Query)
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		parsed, err := codegen.Parse(file, src)
+		if err != nil {
+			return err
+		}
+		for _, q := range parsed {
+			if prev, ok := seen[q.Name]; ok {
+				return fmt.Errorf("%s:%d: query %s already defined at %s:%d", q.File, q.Line, q.Name, prev.File, prev.Line)
+			}
+			seen[q.Name] = q
+		}
+		queries = append(queries, parsed...)
+	}
+
+	client, err := workersql.NewClient(dsn)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	schema, err := codegen.LoadSchema(ctx, client)
+	if err != nil {
+		return err
+	}
+	for i := range queries {
+		if err := codegen.Describe(ctx, client, schema, &queries[i]); err != nil {
+			return err
+		}
+	}
+
+	src, err := codegen.Generate(pkg, queries)
+	if err != nil {
+		return err
+	}
+	if out == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	return os.WriteFile(out, src, 0o644)
+}
+
+// sqlFiles expands directories among args to the .sql files they hold
+func sqlFiles(args []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(arg, "*.sql"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+	return files, nil
+}
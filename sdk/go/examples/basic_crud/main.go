@@ -26,7 +26,7 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	fmt.Printf("Created user, rows affected: %d\n", result.RowCount)
+	fmt.Printf("Created user %d, rows affected: %d\n", result.LastInsertID, result.AffectedRows)
 
 	// READ - Query users
 	fmt.Println("\nReading users...")
@@ -55,7 +55,7 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	fmt.Printf("Updated %d rows\n", updateResult.RowCount)
+	fmt.Printf("Updated %d rows\n", updateResult.AffectedRows)
 
 	// DELETE - Delete user
 	fmt.Println("\nDeleting user...")
@@ -65,7 +65,7 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	fmt.Printf("Deleted %d rows\n", deleteResult.RowCount)
+	fmt.Printf("Deleted %d rows\n", deleteResult.AffectedRows)
 
 	fmt.Println("\nCRUD operations completed successfully!")
 }
@@ -18,26 +18,15 @@ func main() {
 	ctx := context.Background()
 
 	// Execute multiple queries in a batch
-	queries := []map[string]interface{}{
-		{
-			"sql":    "SELECT * FROM users WHERE id = ?",
-			"params": []interface{}{1},
-		},
-		{
-			"sql":    "SELECT * FROM orders WHERE user_id = ?",
-			"params": []interface{}{1},
-		},
-		{
-			"sql":    "SELECT * FROM products WHERE category = ?",
-			"params": []interface{}{"electronics"},
-		},
-		{
-			"sql": "SELECT COUNT(*) as total FROM users",
-		},
+	statements := []workersql.BatchStatement{
+		{SQL: "SELECT * FROM users WHERE id = ?", Params: []interface{}{1}},
+		{SQL: "SELECT * FROM orders WHERE user_id = ?", Params: []interface{}{1}},
+		{SQL: "SELECT * FROM products WHERE category = ?", Params: []interface{}{"electronics"}},
+		{SQL: "SELECT COUNT(*) as total FROM users"},
 	}
 
 	fmt.Println("Executing batch query...")
-	batchResult, err := client.BatchQuery(ctx, queries)
+	batchResult, err := client.BatchQuery(ctx, statements, workersql.BatchOptions{})
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -59,4 +48,14 @@ func main() {
 			fmt.Printf("  Data: %d rows returned\n", len(result.Data))
 		}
 	}
+
+	// Apply related writes atomically: either every statement succeeds or
+	// none of them take effect
+	_, err = client.BatchQuery(ctx, []workersql.BatchStatement{
+		{SQL: "UPDATE accounts SET balance = balance - ? WHERE id = ?", Params: []interface{}{100, 1}},
+		{SQL: "UPDATE accounts SET balance = balance + ? WHERE id = ?", Params: []interface{}{100, 2}},
+	}, workersql.BatchOptions{Atomic: true})
+	if err != nil {
+		log.Fatal(err)
+	}
 }
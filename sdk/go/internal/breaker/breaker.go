@@ -0,0 +1,153 @@
+// Package breaker provides per-key circuit breakers with sliding window
+// failure tracking, mirroring the gateway's CircuitBreakerService
+package breaker
+
+import (
+	"sync"
+	"time"
+)
+
+// State is the state of one circuit
+type State string
+
+// Circuit states
+const (
+	Closed   State = "closed"
+	Open     State = "open"
+	HalfOpen State = "half_open"
+)
+
+// Options configures circuit breakers
+type Options struct {
+	// FailureThreshold is the number of failures within Window that opens
+	// a circuit (default: 5)
+	FailureThreshold int
+	// Window is the sliding window failures are counted in (default: 30s)
+	Window time.Duration
+	// Cooldown is how long a circuit stays open before letting a trial
+	// call through (default: 15s)
+	Cooldown time.Duration
+}
+
+type circuit struct {
+	state    State
+	failures []time.Time
+	openedAt time.Time
+	// trial is set while the single half-open trial call is in flight
+	trial bool
+}
+
+// Set holds a circuit breaker per key
+type Set struct {
+	mu       sync.Mutex
+	options  Options
+	circuits map[string]*circuit
+	now      func() time.Time
+}
+
+// NewSet creates a set of circuit breakers
+func NewSet(opts Options) *Set {
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = 5
+	}
+	if opts.Window <= 0 {
+		opts.Window = 30 * time.Second
+	}
+	if opts.Cooldown <= 0 {
+		opts.Cooldown = 15 * time.Second
+	}
+	return &Set{options: opts, circuits: make(map[string]*circuit), now: time.Now}
+}
+
+func (s *Set) circuit(key string) *circuit {
+	c, ok := s.circuits[key]
+	if !ok {
+		c = &circuit{state: Closed}
+		s.circuits[key] = c
+	}
+	return c
+}
+
+// Allow reports whether a call for key may proceed. After the cooldown an
+// open circuit turns half-open and allows one trial call; its outcome,
+// reported with Success or Failure, closes or reopens the circuit.
+func (s *Set) Allow(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.circuit(key)
+	switch c.state {
+	case Open:
+		if s.now().Sub(c.openedAt) < s.options.Cooldown {
+			return false
+		}
+		c.state = HalfOpen
+		c.failures = nil
+		c.trial = true
+		return true
+	case HalfOpen:
+		if c.trial {
+			return false
+		}
+		c.trial = true
+		return true
+	}
+	return true
+}
+
+// Success records a successful call for key
+func (s *Set) Success(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.circuit(key)
+	if c.state == HalfOpen {
+		c.state = Closed
+		c.failures = nil
+	}
+	c.trial = false
+}
+
+// Failure records a failed call for key
+func (s *Set) Failure(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.circuit(key)
+	now := s.now()
+	c.trial = false
+
+	if c.state == HalfOpen {
+		// Any failure in half-open reopens the circuit
+		c.state = Open
+		c.openedAt = now
+		return
+	}
+
+	kept := c.failures[:0]
+	for _, t := range c.failures {
+		if now.Sub(t) <= s.options.Window {
+			kept = append(kept, t)
+		}
+	}
+	c.failures = append(kept, now)
+	if len(c.failures) >= s.options.FailureThreshold {
+		c.state = Open
+		c.openedAt = now
+	}
+}
+
+// State returns the state of key's circuit
+func (s *Set) State(key string) State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.circuit(key)
+	if c.state == Open && s.now().Sub(c.openedAt) >= s.options.Cooldown {
+		return HalfOpen
+	}
+	return c.state
+}
+
+// SetClock replaces the time source, for tests
+func (s *Set) SetClock(now func() time.Time) {
+	s.mu.Lock()
+	s.now = now
+	s.mu.Unlock()
+}
@@ -0,0 +1,362 @@
+package codegen
+
+import (
+	"context"
+	"fmt"
+	"go/token"
+	"regexp"
+	"strings"
+
+	"github.com/healthfees-org/workersql/sdk/go/internal/params"
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+)
+
+// Column is a table column as described by information_schema
+type Column struct {
+	Type     string
+	Nullable bool
+}
+
+// Schema holds the columns of each table, by lower-cased table and column
+// name
+type Schema map[string]map[string]Column
+
+// schemaQuery lists the columns of the database the client connects to
+const schemaQuery = "SELECT TABLE_NAME, COLUMN_NAME, COLUMN_TYPE, IS_NULLABLE FROM information_schema.COLUMNS " +
+	"WHERE TABLE_SCHEMA = DATABASE() ORDER BY TABLE_NAME, ORDINAL_POSITION"
+
+// LoadSchema reads the columns of every table from information_schema
+func LoadSchema(ctx context.Context, client *workersql.Client) (Schema, error) {
+	resp, err := client.Query(ctx, schemaQuery)
+	if err := check(resp, err); err != nil {
+		return nil, fmt.Errorf("failed to load schema: %w", err)
+	}
+	var rows []struct {
+		Table    string `db:"TABLE_NAME"`
+		Column   string `db:"COLUMN_NAME"`
+		Type     string `db:"COLUMN_TYPE"`
+		Nullable string `db:"IS_NULLABLE"`
+	}
+	if err := resp.ScanAll(&rows); err != nil {
+		return nil, fmt.Errorf("failed to load schema: %w", err)
+	}
+	schema := make(Schema)
+	for _, row := range rows {
+		table := strings.ToLower(row.Table)
+		if schema[table] == nil {
+			schema[table] = make(map[string]Column)
+		}
+		schema[table][strings.ToLower(row.Column)] = Column{Type: row.Type, Nullable: row.Nullable == "YES"}
+	}
+	return schema, nil
+}
+
+// Describe sets the parameters and result columns of q. Parameters are
+// typed from schema; the result columns of :one and :many queries are
+// described by the gateway, running q with LIMIT 0.
+func Describe(ctx context.Context, client *workersql.Client, schema Schema, q *Query) error {
+	q.Params = inferParams(q.SQL, schema)
+	if q.Cmd != CmdOne && q.Cmd != CmdMany {
+		return nil
+	}
+
+	args := make([]interface{}, len(q.Params))
+	for i, p := range q.Params {
+		args[i] = zeroValue(p.Type)
+	}
+	probe := "SELECT * FROM (" + q.SQL + ") AS workersql_gen LIMIT 0"
+	resp, err := client.Query(ctx, probe, args...)
+	if err := check(resp, err); err != nil {
+		return fmt.Errorf("%s:%d: describing %s: %w", q.File, q.Line, q.Name, err)
+	}
+	if len(resp.Columns) == 0 {
+		return fmt.Errorf("%s:%d: describing %s: the gateway returned no column metadata", q.File, q.Line, q.Name)
+	}
+	names := make(map[string]int)
+	q.Columns = nil
+	for _, c := range resp.Columns {
+		q.Columns = append(q.Columns, Field{
+			Name:   uniqueName(names, exportedName(c.Name)),
+			Column: c.Name,
+			Type:   goType(c.DatabaseType, c.Nullable),
+		})
+	}
+	return nil
+}
+
+var (
+	tableRe = regexp.MustCompile("(?i)\\b(?:from|into|update|join)\\s+(`[^`]+`|[\\w.]+)(?:\\s+(?:as\\s+)?(\\w+))?")
+	// comparedRe matches a column compared with the placeholder that
+	// follows, capturing whether it is an IN list
+	comparedRe  = regexp.MustCompile("(?i)(`[^`]+`|[\\w.]+)\\s*(?:=|<=>|<>|!=|<=|>=|<|>|\\bnot\\s+like|\\blike|(\\bnot\\s+in|\\bin)\\s*\\()\\s*$")
+	limitRe     = regexp.MustCompile(`(?i)\b(limit|offset)\s*$`)
+	limitPairRe = regexp.MustCompile(`(?i)\blimit\s*\?\s*,\s*$`)
+	insertRe    = regexp.MustCompile("(?is)^\\s*(?:insert|replace)\\s+(?:ignore\\s+)?into\\s+(`[^`]+`|[\\w.]+)\\s*\\(([^)]*)\\)\\s*values\\s*\\(")
+	setRe       = regexp.MustCompile(`(?i)\bset\b`)
+	whereRe     = regexp.MustCompile(`(?i)\b(where|on|having)\b`)
+)
+
+// inferParams names and types the placeholders of sql from the columns
+// they're compared with, assigned to or inserted into. Others are
+// interface{} parameters named argN.
+func inferParams(sql string, schema Schema) []Field {
+	offsets := params.Placeholders(sql)
+	tables := statementTables(sql)
+
+	// The placeholders of the first VALUES list map to the insert columns
+	var insertColumns []string
+	var insertTable string
+	valuesEnd := -1
+	if m := insertRe.FindStringSubmatchIndex(sql); m != nil {
+		insertTable = tableName(sql[m[2]:m[3]])
+		for _, c := range strings.Split(sql[m[4]:m[5]], ",") {
+			insertColumns = append(insertColumns, unquote(strings.TrimSpace(c)))
+		}
+		valuesEnd = m[1] + strings.IndexByte(sql[m[1]:], ')')
+	}
+
+	names := make(map[string]int)
+	fields := make([]Field, len(offsets))
+	inserted := 0
+	for i, offset := range offsets {
+		prefix := sql[:offset]
+		var field Field
+		switch {
+		case insertColumns != nil && offset < valuesEnd && inserted < len(insertColumns):
+			column := insertColumns[inserted]
+			inserted++
+			field = columnField(schema, []tableRef{{name: insertTable}}, column, true)
+		case limitRe.MatchString(prefix):
+			field = Field{Name: strings.ToLower(limitRe.FindStringSubmatch(prefix)[1]), Type: "int64"}
+			// LIMIT ?, ? takes the offset first
+			if field.Name == "limit" && i+1 < len(offsets) && limitPairRe.MatchString(sql[:offsets[i+1]]) {
+				field.Name = "offset"
+			}
+		case limitPairRe.MatchString(prefix):
+			field = Field{Name: "limit", Type: "int64"}
+		default:
+			m := comparedRe.FindStringSubmatch(prefix)
+			if m == nil {
+				field = Field{Name: fmt.Sprintf("arg%d", i+1), Type: "interface{}"}
+				break
+			}
+			field = columnField(schema, tables, m[1], assigned(prefix))
+			if m[2] != "" && field.Type != "interface{}" {
+				field.Type = "[]" + field.Type
+			}
+		}
+		field.Name = uniqueName(names, field.Name)
+		fields[i] = field
+	}
+	return fields
+}
+
+// assigned reports whether a placeholder after prefix is in a SET clause,
+// where a nullable column may be set to NULL
+func assigned(prefix string) bool {
+	set := setRe.FindAllStringIndex(prefix, -1)
+	if set == nil {
+		return false
+	}
+	where := whereRe.FindAllStringIndex(prefix, -1)
+	return where == nil || set[len(set)-1][0] > where[len(where)-1][0]
+}
+
+// tableRef is a table of a statement and its alias, if any
+type tableRef struct {
+	name  string
+	alias string
+}
+
+// columnField types a parameter bound to column, looked up in the first of
+// tables having it, or in the table or alias it is qualified with
+func columnField(schema Schema, tables []tableRef, column string, nullable bool) Field {
+	column = unquote(column)
+	qualifier := ""
+	if i := strings.LastIndexByte(column, '.'); i >= 0 {
+		qualifier, column = unquote(column[:i]), unquote(column[i+1:])
+	}
+	field := Field{Name: paramName(column), Column: column, Type: "interface{}"}
+	for _, t := range tables {
+		if qualifier != "" && !strings.EqualFold(qualifier, t.alias) && !strings.EqualFold(qualifier, t.name) {
+			continue
+		}
+		if c, ok := schema[strings.ToLower(t.name)][strings.ToLower(column)]; ok {
+			field.Type = goType(c.Type, nullable && c.Nullable)
+			break
+		}
+	}
+	return field
+}
+
+// statementTables returns the tables sql reads or writes, in order
+func statementTables(sql string) []tableRef {
+	var tables []tableRef
+	for _, m := range tableRe.FindAllStringSubmatch(sql, -1) {
+		t := tableRef{name: tableName(m[1])}
+		if alias := m[2]; alias != "" && !isKeyword(alias) {
+			t.alias = alias
+		}
+		tables = append(tables, t)
+	}
+	return tables
+}
+
+// tableName strips the quotes and database of a table reference such as
+// `mydb`.`users`
+func tableName(ref string) string {
+	if i := strings.LastIndexByte(ref, '.'); i >= 0 {
+		ref = ref[i+1:]
+	}
+	return unquote(ref)
+}
+
+// isKeyword reports whether word, following a table name, starts the next
+// clause instead of being an alias
+func isKeyword(word string) bool {
+	switch strings.ToUpper(word) {
+	case "WHERE", "SET", "JOIN", "INNER", "LEFT", "RIGHT", "CROSS", "ON", "USING", "GROUP", "ORDER",
+		"LIMIT", "HAVING", "VALUES", "VALUE", "SELECT", "UNION", "FOR", "WINDOW", "NATURAL", "STRAIGHT_JOIN":
+		return true
+	}
+	return false
+}
+
+// goType maps a column type such as "bigint(20) unsigned" to a Go type,
+// wrapped in workersql.Null when nullable
+func goType(databaseType string, nullable bool) string {
+	t := strings.ToUpper(strings.TrimSpace(databaseType))
+	base := t
+	if i := strings.IndexAny(base, "( "); i >= 0 {
+		base = base[:i]
+	}
+	unsigned := strings.Contains(t, "UNSIGNED")
+
+	var typ string
+	switch base {
+	case "TINYINT":
+		typ = "int64"
+		if strings.HasPrefix(t, "TINYINT(1)") {
+			typ = "bool"
+		}
+	case "SMALLINT", "MEDIUMINT", "INT", "INTEGER", "YEAR":
+		typ = "int64"
+	case "BIGINT":
+		typ = "int64"
+		if unsigned {
+			typ = "uint64"
+		}
+	case "FLOAT", "DOUBLE", "REAL":
+		typ = "float64"
+	case "BOOL", "BOOLEAN":
+		typ = "bool"
+	case "DATETIME", "TIMESTAMP", "DATE":
+		typ = "time.Time"
+	case "BLOB", "TINYBLOB", "MEDIUMBLOB", "LONGBLOB", "BINARY", "VARBINARY":
+		typ = "[]byte"
+	case "JSON":
+		typ = "json.RawMessage"
+	case "DECIMAL", "NUMERIC", "CHAR", "VARCHAR", "TEXT", "TINYTEXT", "MEDIUMTEXT", "LONGTEXT", "ENUM", "SET", "TIME":
+		// DECIMAL is kept as text so no precision is lost
+		typ = "string"
+	default:
+		return "interface{}"
+	}
+	if nullable {
+		return "workersql.Null[" + typ + "]"
+	}
+	return typ
+}
+
+// zeroValue is a placeholder argument of type typ for describing a query;
+// LIMIT and OFFSET need a number where NULL would do elsewhere
+func zeroValue(typ string) interface{} {
+	switch typ {
+	case "int64", "uint64", "float64":
+		return 0
+	}
+	return nil
+}
+
+func unquote(name string) string {
+	return strings.ReplaceAll(strings.Trim(name, "`"), "``", "`")
+}
+
+// initialisms are upper-cased whole in Go names
+var initialisms = map[string]bool{
+	"ID": true, "URL": true, "URI": true, "API": true, "JSON": true, "HTTP": true, "SQL": true,
+	"UUID": true, "IP": true, "UID": true, "HTML": true, "XML": true, "TTL": true,
+}
+
+// exportedName converts a column name such as "user_id" to "UserID"
+func exportedName(column string) string {
+	var b strings.Builder
+	for _, word := range words(column) {
+		b.WriteString(title(word))
+	}
+	name := b.String()
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		name = "Column" + name
+	}
+	return name
+}
+
+// paramName converts a column name such as "user_id" to "userID"
+func paramName(column string) string {
+	parts := words(column)
+	if len(parts) == 0 || parts[0][0] >= '0' && parts[0][0] <= '9' {
+		return "arg" + exportedName(column)
+	}
+	var b strings.Builder
+	b.WriteString(strings.ToLower(parts[0]))
+	for _, word := range parts[1:] {
+		b.WriteString(title(word))
+	}
+	name := b.String()
+	// Keywords and the locals of generated functions can't be parameters
+	switch name {
+	case "ctx", "q", "row", "resp", "err", "items", "i":
+		name += "Param"
+	default:
+		if token.IsKeyword(name) {
+			name += "Param"
+		}
+	}
+	return name
+}
+
+// words splits a column name at the characters not allowed in Go names
+func words(column string) []string {
+	return strings.FieldsFunc(column, func(r rune) bool {
+		return !(r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z')
+	})
+}
+
+func title(word string) string {
+	if upper := strings.ToUpper(word); initialisms[upper] {
+		return upper
+	}
+	return strings.ToUpper(word[:1]) + word[1:]
+}
+
+// uniqueName numbers repeated names: id, id2, id3
+func uniqueName(seen map[string]int, name string) string {
+	seen[name]++
+	if n := seen[name]; n > 1 {
+		return fmt.Sprintf("%s%d", name, n)
+	}
+	return name
+}
+
+func check(resp *workersql.QueryResponse, err error) error {
+	if err != nil {
+		return err
+	}
+	if !resp.Success {
+		if resp.Error != nil {
+			return fmt.Errorf("%s: %s", resp.Error.Code, resp.Error.Message)
+		}
+		return fmt.Errorf("query failed")
+	}
+	return nil
+}
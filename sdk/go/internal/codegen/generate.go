@@ -0,0 +1,203 @@
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Generate renders the Go source of package pkg running queries, which
+// must have been described
+func Generate(pkg string, queries []Query) ([]byte, error) {
+	var imports []string
+	uses := func(prefix string) bool {
+		for _, q := range queries {
+			for _, f := range append(append([]Field(nil), q.Params...), q.Columns...) {
+				if strings.Contains(f.Type, prefix) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	if uses("json.") {
+		imports = append(imports, "encoding/json")
+	}
+	if uses("time.") {
+		imports = append(imports, "time")
+	}
+
+	var buf bytes.Buffer
+	err := fileTemplate.Execute(&buf, map[string]interface{}{
+		"Package": pkg,
+		"Imports": imports,
+		"Queries": queries,
+	})
+	if err != nil {
+		return nil, err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("generated invalid Go: %w\n%s", err, buf.Bytes())
+	}
+	return src, nil
+}
+
+var fileTemplate = template.Must(template.New("file").Funcs(template.FuncMap{
+	"constName": func(name string) string { return strings.ToLower(name[:1]) + name[1:] },
+	"quote": func(sql string) string {
+		if strings.Contains(sql, "`") {
+			return strconv.Quote(sql)
+		}
+		return "`" + sql + "`"
+	},
+	"single": func(q Query) bool { return len(q.Columns) == 1 },
+	"returns": func(q Query) string {
+		switch q.Cmd {
+		case CmdOne:
+			return rowType(q)
+		case CmdMany:
+			return "[]" + rowType(q)
+		case CmdExecResult:
+			return "*workersql.ExecResponse"
+		case CmdExecRows:
+			return "int64"
+		}
+		return ""
+	},
+	"rowType": rowType,
+	"params": func(q Query) string {
+		var b strings.Builder
+		for _, p := range q.Params {
+			fmt.Fprintf(&b, ", %s %s", p.Name, p.Type)
+		}
+		return b.String()
+	},
+	"args": func(q Query) string {
+		var b strings.Builder
+		for _, p := range q.Params {
+			b.WriteString(", " + p.Name)
+		}
+		return b.String()
+	},
+}).Parse(`// Code generated by workersql-gen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"context"
+	"fmt"
+{{range .Imports}}	"{{.}}"
+{{end}}
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+)
+
+// Queries runs the generated queries
+type Queries struct {
+	db workersql.Querier
+}
+
+// New returns Queries running on db: a client, transaction or session
+func New(db workersql.Querier) *Queries {
+	return &Queries{db: db}
+}
+
+// WithTx returns Queries running in tx
+func (q *Queries) WithTx(tx *workersql.TransactionClient) *Queries {
+	return &Queries{db: tx}
+}
+
+func responseError(e *workersql.ErrorResponse) error {
+	if e == nil {
+		return fmt.Errorf("statement failed")
+	}
+	return fmt.Errorf("%s: %s", e.Code, e.Message)
+}
+{{range .Queries}}{{$const := constName .Name}}
+const {{$const}} = {{quote .SQL}}
+{{if and (or (eq .Cmd ":one") (eq .Cmd ":many")) (not (single .))}}
+// {{rowType .}} is a row of {{.Name}}
+type {{rowType .}} struct {
+{{range .Columns}}	{{.Name}} {{.Type}} ` + "`" + `db:"{{.Column}}"` + "`" + `
+{{end}}}
+{{end}}
+{{range .Doc}}// {{.}}
+{{else}}// {{.Name}} runs {{.File}}:{{.Line}}
+{{end}}{{if eq .Cmd ":one"}}func (q *Queries) {{.Name}}(ctx context.Context{{params .}}) ({{returns .}}, error) {
+	var row {{returns .}}
+	resp, err := q.db.Query(ctx, {{$const}}{{args .}})
+	if err != nil {
+		return row, err
+	}
+	if !resp.Success {
+		return row, responseError(resp.Error)
+	}
+	if len(resp.Data) == 0 {
+		return row, workersql.ErrNoRows
+	}
+{{if single .}}	err = workersql.ScanValue(resp.Data[0]["{{(index .Columns 0).Column}}"], &row)
+{{else}}	err = workersql.ScanStruct(resp.Data[0], &row)
+{{end}}	return row, err
+}
+{{else if eq .Cmd ":many"}}func (q *Queries) {{.Name}}(ctx context.Context{{params .}}) ({{returns .}}, error) {
+	resp, err := q.db.Query(ctx, {{$const}}{{args .}})
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Success {
+		return nil, responseError(resp.Error)
+	}
+{{if single .}}	items := make({{returns .}}, len(resp.Data))
+	for i, row := range resp.Data {
+		if err := workersql.ScanValue(row["{{(index .Columns 0).Column}}"], &items[i]); err != nil {
+			return nil, fmt.Errorf("row %d: %w", i, err)
+		}
+	}
+	return items, nil
+{{else}}	var items {{returns .}}
+	err = resp.ScanAll(&items)
+	return items, err
+{{end}}}
+{{else if eq .Cmd ":exec"}}func (q *Queries) {{.Name}}(ctx context.Context{{params .}}) error {
+	resp, err := q.db.Exec(ctx, {{$const}}{{args .}})
+	if err != nil {
+		return err
+	}
+	if !resp.Success {
+		return responseError(resp.Error)
+	}
+	return nil
+}
+{{else if eq .Cmd ":execresult"}}func (q *Queries) {{.Name}}(ctx context.Context{{params .}}) ({{returns .}}, error) {
+	resp, err := q.db.Exec(ctx, {{$const}}{{args .}})
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Success {
+		return nil, responseError(resp.Error)
+	}
+	return resp, nil
+}
+{{else}}func (q *Queries) {{.Name}}(ctx context.Context{{params .}}) ({{returns .}}, error) {
+	resp, err := q.db.Exec(ctx, {{$const}}{{args .}})
+	if err != nil {
+		return 0, err
+	}
+	if !resp.Success {
+		return 0, responseError(resp.Error)
+	}
+	return resp.AffectedRows, nil
+}
+{{end}}{{end}}`))
+
+// rowType is the element type of :one and :many results: the column's
+// type for single-column results, otherwise a struct named after the query
+func rowType(q Query) string {
+	if len(q.Columns) == 1 {
+		return q.Columns[0].Type
+	}
+	return q.Name + "Row"
+}
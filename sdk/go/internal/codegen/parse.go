@@ -0,0 +1,144 @@
+// Package codegen generates typed Go functions for annotated SQL queries,
+// for cmd/workersql-gen. Queries are annotated as in sqlc:
+//
+//	-- name: GetUser :one
+//	SELECT id, email FROM users WHERE id = ?;
+//
+// Result columns are described by the gateway and parameter types are
+// inferred from the columns the placeholders are compared with or assigned
+// to, as found in information_schema.
+package codegen
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Query commands, deciding what a generated function returns
+const (
+	// CmdOne returns the first row, or workersql.ErrNoRows
+	CmdOne = ":one"
+	// CmdMany returns every row
+	CmdMany = ":many"
+	// CmdExec returns only an error
+	CmdExec = ":exec"
+	// CmdExecResult returns the *workersql.ExecResponse
+	CmdExecResult = ":execresult"
+	// CmdExecRows returns the number of affected rows
+	CmdExecRows = ":execrows"
+)
+
+var nameRe = regexp.MustCompile(`^--\s*name:\s*(\S+)\s+(:\w+)\s*$`)
+
+// Query is an annotated statement of a SQL file
+type Query struct {
+	Name string
+	Cmd  string
+	SQL  string
+	// Doc holds the comment lines following the annotation
+	Doc []string
+	// File and Line locate the annotation, for errors
+	File string
+	Line int
+
+	// Params and Columns are set by Describe
+	Params  []Field
+	Columns []Field
+}
+
+// Field is a parameter or result column of a query
+type Field struct {
+	// Name is the Go identifier
+	Name string
+	// Column is the database column, empty for parameters not matched to
+	// one
+	Column string
+	// Type is the Go type
+	Type string
+}
+
+// Parse reads the annotated queries of a SQL file. Text before the first
+// annotation may only be comments.
+func Parse(file string, src []byte) ([]Query, error) {
+	var queries []Query
+	var body []string
+	seen := make(map[string]int)
+
+	finish := func() error {
+		if len(queries) == 0 {
+			return nil
+		}
+		q := &queries[len(queries)-1]
+		q.SQL = strings.TrimSuffix(strings.TrimSpace(strings.Join(body, "\n")), ";")
+		q.SQL = strings.TrimSpace(q.SQL)
+		if q.SQL == "" {
+			return fmt.Errorf("%s:%d: query %s has no statement", file, q.Line, q.Name)
+		}
+		body = nil
+		return nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(src))
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		trimmed := strings.TrimSpace(text)
+		if m := nameRe.FindStringSubmatch(trimmed); m != nil {
+			if err := finish(); err != nil {
+				return nil, err
+			}
+			name, cmd := m[1], m[2]
+			switch cmd {
+			case CmdOne, CmdMany, CmdExec, CmdExecResult, CmdExecRows:
+			default:
+				return nil, fmt.Errorf("%s:%d: unknown command %s", file, line, cmd)
+			}
+			if !isExported(name) {
+				return nil, fmt.Errorf("%s:%d: query name %s must be an exported Go identifier", file, line, name)
+			}
+			if prev, ok := seen[name]; ok {
+				return nil, fmt.Errorf("%s:%d: query %s already defined on line %d", file, line, name, prev)
+			}
+			seen[name] = line
+			queries = append(queries, Query{Name: name, Cmd: cmd, File: file, Line: line})
+			continue
+		}
+		if len(queries) == 0 {
+			if trimmed != "" && !strings.HasPrefix(trimmed, "--") {
+				return nil, fmt.Errorf("%s:%d: statement before the first -- name: annotation", file, line)
+			}
+			continue
+		}
+		// Comments right after the annotation document the function
+		if len(body) == 0 && strings.HasPrefix(trimmed, "--") {
+			q := &queries[len(queries)-1]
+			q.Doc = append(q.Doc, strings.TrimSpace(strings.TrimPrefix(trimmed, "--")))
+			continue
+		}
+		if len(body) == 0 && trimmed == "" {
+			continue
+		}
+		body = append(body, text)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := finish(); err != nil {
+		return nil, err
+	}
+	return queries, nil
+}
+
+func isExported(name string) bool {
+	if name == "" || name[0] < 'A' || name[0] > 'Z' {
+		return false
+	}
+	for _, r := range name {
+		if !(r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
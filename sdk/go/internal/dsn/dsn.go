@@ -1,6 +1,6 @@
 // Package dsn provides DSN parsing for WorkerSQL connection strings.
 // Parses connection strings in the format:
-// workersql://[username[:password]@]host[:port][/database][?param1=value1&param2=value2]
+// workersql://[username[:password]@]host[:port][,host[:port]...][/database][?param1=value1&param2=value2]
 package dsn
 
 import (
@@ -17,16 +17,28 @@ type ParsedDSN struct {
 	Password string
 	Host     string
 	Port     int
+	// Hosts lists every host of a DSN with comma-separated hosts, the
+	// first being Host and Port; nil for a single host
+	Hosts    []HostPort
 	Database string
 	Params   map[string]string
 }
 
+// HostPort is one host of a multi-host DSN
+type HostPort struct {
+	Host string
+	Port int
+}
+
 // Parse parses a WorkerSQL DSN string
 func Parse(dsn string) (*ParsedDSN, error) {
 	if dsn == "" {
 		return nil, fmt.Errorf("DSN must be a non-empty string")
 	}
 
+	// Only the first of several hosts goes through url.Parse
+	dsn, extra := splitHosts(dsn)
+
 	// Parse the URL
 	u, err := url.Parse(dsn)
 	if err != nil {
@@ -44,11 +56,23 @@ func Parse(dsn string) (*ParsedDSN, error) {
 		return nil, fmt.Errorf("host is required in DSN")
 	}
 
-	var port int
-	if u.Port() != "" {
-		port, err = strconv.Atoi(u.Port())
-		if err != nil || port < 1 || port > 65535 {
-			return nil, fmt.Errorf("invalid port: %s", u.Port())
+	port, err := parsePort(u.Port())
+	if err != nil {
+		return nil, err
+	}
+	var hosts []HostPort
+	if len(extra) > 0 {
+		hosts = []HostPort{{Host: host, Port: port}}
+		for _, h := range extra {
+			hu, err := url.Parse("//" + h)
+			if err != nil || hu.Hostname() == "" {
+				return nil, fmt.Errorf("invalid host: %q", h)
+			}
+			p, err := parsePort(hu.Port())
+			if err != nil {
+				return nil, err
+			}
+			hosts = append(hosts, HostPort{Host: hu.Hostname(), Port: p})
 		}
 	}
 
@@ -82,11 +106,44 @@ func Parse(dsn string) (*ParsedDSN, error) {
 		Password: password,
 		Host:     host,
 		Port:     port,
+		Hosts:    hosts,
 		Database: database,
 		Params:   params,
 	}, nil
 }
 
+// splitHosts removes all but the first host from a DSN with
+// comma-separated hosts, returning the others
+func splitHosts(dsn string) (string, []string) {
+	scheme := strings.Index(dsn, "://")
+	if scheme < 0 {
+		return dsn, nil
+	}
+	start := scheme + len("://")
+	end := len(dsn)
+	if i := strings.IndexAny(dsn[start:], "/?#"); i >= 0 {
+		end = start + i
+	}
+	authority := dsn[start:end]
+	hostStart := start + strings.LastIndex(authority, "@") + 1
+	hosts := strings.Split(dsn[hostStart:end], ",")
+	if len(hosts) < 2 {
+		return dsn, nil
+	}
+	return dsn[:hostStart] + hosts[0] + dsn[end:], hosts[1:]
+}
+
+func parsePort(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	port, err := strconv.Atoi(s)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid port: %s", s)
+	}
+	return port, nil
+}
+
 // Stringify converts a ParsedDSN back to a DSN string
 func Stringify(parsed *ParsedDSN) string {
 	var sb strings.Builder
@@ -103,11 +160,15 @@ func Stringify(parsed *ParsedDSN) string {
 		sb.WriteString("@")
 	}
 
-	sb.WriteString(parsed.Host)
-
-	if parsed.Port > 0 {
-		sb.WriteString(":")
-		sb.WriteString(strconv.Itoa(parsed.Port))
+	if len(parsed.Hosts) > 1 {
+		for i, h := range parsed.Hosts {
+			if i > 0 {
+				sb.WriteString(",")
+			}
+			sb.WriteString(hostPort(h.Host, h.Port))
+		}
+	} else {
+		sb.WriteString(hostPort(parsed.Host, parsed.Port))
 	}
 
 	if parsed.Database != "" {
@@ -152,3 +213,25 @@ func GetAPIEndpoint(parsed *ParsedDSN) string {
 
 	return fmt.Sprintf("%s://%s%s/v1", protocol, parsed.Host, port)
 }
+
+// GetAPIEndpoints returns the API endpoint of every host of a multi-host
+// DSN, or nil for a single host or an explicit apiEndpoint parameter
+func GetAPIEndpoints(parsed *ParsedDSN) []string {
+	if _, ok := parsed.Params["apiEndpoint"]; ok || len(parsed.Hosts) < 2 {
+		return nil
+	}
+	endpoints := make([]string, len(parsed.Hosts))
+	for i, h := range parsed.Hosts {
+		host := *parsed
+		host.Host, host.Port = h.Host, h.Port
+		endpoints[i] = GetAPIEndpoint(&host)
+	}
+	return endpoints
+}
+
+func hostPort(host string, port int) string {
+	if port > 0 {
+		return host + ":" + strconv.Itoa(port)
+	}
+	return host
+}
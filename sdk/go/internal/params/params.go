@@ -0,0 +1,184 @@
+// Package params provides placeholder rewriting for WorkerSQL query parameters.
+// It expands slice arguments bound to a single `?` placeholder into a
+// comma-separated placeholder list so `WHERE id IN (?)` works with []int,
+// []string and similar values.
+package params
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// EmptyList is substituted for a placeholder bound to an empty slice. It is a
+// subquery yielding no rows, so `x IN (?)` is false and `x NOT IN (?)` is true
+// for every x, which is what callers expect from an empty list.
+const EmptyList = "SELECT 1 WHERE 1=0"
+
+// List is an explicit list value that always expands into one placeholder per
+// element, regardless of the element types.
+type List []interface{}
+
+// Expand rewrites sql so that every placeholder bound to a list value becomes
+// one placeholder per element, and returns the flattened parameter slice.
+// Statements without list values are returned unchanged.
+func Expand(sql string, params []interface{}) (string, []interface{}, error) {
+	if !hasList(params) {
+		return sql, params, nil
+	}
+
+	var sb strings.Builder
+	sb.Grow(len(sql) + 2*len(params))
+	flat := make([]interface{}, 0, len(params))
+
+	index := 0
+	err := scan(sql, func(chunk string, placeholder bool) error {
+		if !placeholder {
+			sb.WriteString(chunk)
+			return nil
+		}
+		if index >= len(params) {
+			return fmt.Errorf("not enough params: placeholder %d has no value", index+1)
+		}
+		values, ok := listValues(params[index])
+		index++
+		if !ok {
+			sb.WriteByte('?')
+			flat = append(flat, params[index-1])
+			return nil
+		}
+		if len(values) == 0 {
+			sb.WriteString(EmptyList)
+			return nil
+		}
+		for i, v := range values {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteByte('?')
+			flat = append(flat, v)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	if index != len(params) {
+		return "", nil, fmt.Errorf("too many params: %d placeholders for %d values", index, len(params))
+	}
+
+	return sb.String(), flat, nil
+}
+
+func hasList(params []interface{}) bool {
+	for _, p := range params {
+		if _, ok := listValues(p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// listValues reports whether v should be expanded and returns its elements.
+// Byte slices and JSON payloads are scalar values and are never expanded, nor
+// is anything implementing driver.Valuer.
+func listValues(v interface{}) ([]interface{}, bool) {
+	switch t := v.(type) {
+	case nil, []byte, json.RawMessage, driver.Valuer:
+		return nil, false
+	case List:
+		return t, true
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+	if rv.Type().Elem().Kind() == reflect.Uint8 {
+		return nil, false
+	}
+
+	values := make([]interface{}, rv.Len())
+	for i := range values {
+		values[i] = rv.Index(i).Interface()
+	}
+	return values, true
+}
+
+// Placeholders returns the offsets of the `?` placeholders of sql, skipping
+// quoted literals, identifiers and comments.
+func Placeholders(sql string) []int {
+	var offsets []int
+	offset := 0
+	_ = scan(sql, func(chunk string, placeholder bool) error {
+		if placeholder {
+			offsets = append(offsets, offset)
+		}
+		offset += len(chunk)
+		return nil
+	})
+	return offsets
+}
+
+// scan splits sql into literal chunks and placeholders, calling fn for each.
+func scan(sql string, fn func(chunk string, placeholder bool) error) error {
+	start := 0
+	for i := 0; i < len(sql); i++ {
+		switch c := sql[i]; c {
+		case '\'', '"', '`':
+			i = skipQuoted(sql, i, c)
+		case '-':
+			if i+1 < len(sql) && sql[i+1] == '-' {
+				i = skipLine(sql, i)
+			}
+		case '#':
+			i = skipLine(sql, i)
+		case '/':
+			if i+1 < len(sql) && sql[i+1] == '*' {
+				if end := strings.Index(sql[i+2:], "*/"); end >= 0 {
+					i += end + 3
+				} else {
+					i = len(sql) - 1
+				}
+			}
+		case '?':
+			if err := fn(sql[start:i], false); err != nil {
+				return err
+			}
+			if err := fn("?", true); err != nil {
+				return err
+			}
+			start = i + 1
+		}
+	}
+	return fn(sql[start:], false)
+}
+
+// skipQuoted returns the index of the closing quote for the literal starting
+// at i, honouring doubled quotes and backslash escapes.
+func skipQuoted(sql string, i int, quote byte) int {
+	for j := i + 1; j < len(sql); j++ {
+		switch sql[j] {
+		case '\\':
+			if quote != '`' {
+				j++
+			}
+		case quote:
+			if j+1 < len(sql) && sql[j+1] == quote {
+				j++
+				continue
+			}
+			return j
+		}
+	}
+	return len(sql) - 1
+}
+
+func skipLine(sql string, i int) int {
+	if end := strings.IndexByte(sql[i:], '\n'); end >= 0 {
+		return i + end
+	}
+	return len(sql) - 1
+}
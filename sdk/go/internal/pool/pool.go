@@ -3,42 +3,93 @@ package pool
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
-// Connection represents a pooled HTTP client connection
+// ErrPoolClosed is returned by Acquire once the pool has been closed
+var ErrPoolClosed = errors.New("connection pool is closed")
+
+// ErrAcquireTimeout is returned by Acquire when no connection became
+// available within Options.AcquireTimeout
+var ErrAcquireTimeout = errors.New("timed out waiting for a pooled connection")
+
+// Connection represents a pooled HTTP client connection. Its fields belong
+// to the caller holding it between Acquire and Release.
 type Connection struct {
-	ID         string
-	Client     *http.Client
-	InUse      bool
-	CreatedAt  time.Time
-	LastUsed   time.Time
-	UseCount   int64
+	ID        string
+	Client    *http.Client
+	InUse     bool
+	CreatedAt time.Time
+	LastUsed  time.Time
+	UseCount  int64
+
+	pool *Pool
 }
 
 // Options configures the connection pool
 type Options struct {
-	APIEndpoint        string
-	APIKey             string
-	MinConnections     int
-	MaxConnections     int
-	IdleTimeout        time.Duration
-	ConnectionTimeout  time.Duration
+	APIEndpoint         string
+	APIKey              string
+	MinConnections      int
+	MaxConnections      int
+	IdleTimeout         time.Duration
+	ConnectionTimeout   time.Duration
 	HealthCheckInterval time.Duration
+	// AcquireTimeout bounds how long Acquire waits for a connection when the
+	// pool is exhausted. Zero waits until the context ends.
+	AcquireTimeout time.Duration
+	// MaxLifetime retires connections this long after they were created, so
+	// new sockets pick up DNS and load balancer changes. Zero keeps them
+	// indefinitely.
+	MaxLifetime time.Duration
+	// MaxUseCount retires connections after this many acquisitions. Zero
+	// means no limit.
+	MaxUseCount int64
+	// PingAfterIdle enables health pings: a connection idle for longer is
+	// checked with a GET /health request before Acquire returns it, and idle
+	// connections are checked by the health loop. Connections whose ping
+	// fails at the transport level are replaced. Zero disables pings.
+	PingAfterIdle time.Duration
+	// PingTimeout bounds each ping (default: 5s)
+	PingTimeout time.Duration
+	// Transport, if set, is shared by every connection instead of each
+	// getting its own
+	Transport http.RoundTripper
 }
 
-// Pool manages a pool of reusable HTTP connections
+// Pool manages a pool of reusable HTTP connections.
+//
+// Idle connections live in a buffered channel sized to MaxConnections, so
+// Acquire and Release are a channel receive and send without a shared
+// lock. Callers that find the pool exhausted block on the channel; the
+// runtime queues channel receivers in arrival order, so a released
+// connection goes to the longest waiting Acquire.
 type Pool struct {
 	options     Options
-	connections map[string]*Connection
-	mu          sync.RWMutex
+	idle        chan *Connection
 	stopCh      chan struct{}
 	wg          sync.WaitGroup
 	connCounter uint64
+	closed      int32
+
+	// total counts live connections, idle or in use; waiting counts blocked
+	// Acquire calls
+	total   int64
+	waiting int64
+
+	waitCount       int64
+	waitDuration    int64
+	maxWaitDuration int64
+	acquireTimeouts int64
+	recycled        int64
+	pings           int64
+	pingFailures    int64
 }
 
 // NewPool creates a new connection pool
@@ -49,6 +100,9 @@ func NewPool(opts Options) *Pool {
 	if opts.MaxConnections == 0 {
 		opts.MaxConnections = 10
 	}
+	if opts.MinConnections > opts.MaxConnections {
+		opts.MinConnections = opts.MaxConnections
+	}
 	if opts.IdleTimeout == 0 {
 		opts.IdleTimeout = 5 * time.Minute
 	}
@@ -58,17 +112,18 @@ func NewPool(opts Options) *Pool {
 	if opts.HealthCheckInterval == 0 {
 		opts.HealthCheckInterval = 1 * time.Minute
 	}
+	if opts.PingTimeout == 0 {
+		opts.PingTimeout = 5 * time.Second
+	}
 
 	p := &Pool{
-		options:     opts,
-		connections: make(map[string]*Connection),
-		stopCh:      make(chan struct{}),
+		options: opts,
+		idle:    make(chan *Connection, opts.MaxConnections),
+		stopCh:  make(chan struct{}),
 	}
 
 	// Create minimum connections
-	for i := 0; i < opts.MinConnections; i++ {
-		p.createConnection()
-	}
+	p.refill()
 
 	// Start health check goroutine
 	if opts.HealthCheckInterval > 0 {
@@ -79,117 +134,307 @@ func NewPool(opts Options) *Pool {
 	return p
 }
 
-// Acquire gets a connection from the pool
+// Acquire gets a connection from the pool. When every connection is in use
+// and the pool is at MaxConnections, Acquire waits in a FIFO queue until a
+// connection is released, the context ends, or AcquireTimeout elapses.
 func (p *Pool) Acquire(ctx context.Context) (*Connection, error) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-
-	// Try to find an idle connection
-	for _, conn := range p.connections {
-		if !conn.InUse {
-			conn.InUse = true
-			conn.LastUsed = time.Now()
-			conn.UseCount++
-			return conn, nil
+	if p.isClosed() {
+		return nil, ErrPoolClosed
+	}
+
+	// Fast path: an idle connection, or room for a new one. The idle
+	// channel is only non-empty when nobody is waiting, since a release
+	// hands its connection straight to a blocked receiver.
+	if conn := p.tryTake(); conn != nil {
+		return p.checkout(ctx, conn), nil
+	}
+
+	atomic.AddInt64(&p.waiting, 1)
+	defer atomic.AddInt64(&p.waiting, -1)
+
+	// A connection retired between the fast path and registering as a
+	// waiter leaves room that refill didn't see
+	if conn := p.tryTake(); conn != nil {
+		return p.checkout(ctx, conn), nil
+	}
+
+	start := time.Now()
+	var timeout <-chan time.Time
+	if p.options.AcquireTimeout > 0 {
+		timer := time.NewTimer(p.options.AcquireTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var err error
+	select {
+	case conn := <-p.idle:
+		p.recordWait(time.Since(start), false)
+		return p.checkout(ctx, conn), nil
+	case <-p.stopCh:
+		p.recordWait(time.Since(start), false)
+		return nil, ErrPoolClosed
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-timeout:
+		err = ErrAcquireTimeout
+	}
+
+	p.recordWait(time.Since(start), err == ErrAcquireTimeout)
+	return nil, fmt.Errorf("connection pool exhausted (max: %d): %w", p.options.MaxConnections, err)
+}
+
+// tryTake returns an idle connection or a new one if the pool has room,
+// without blocking
+func (p *Pool) tryTake() *Connection {
+	select {
+	case conn := <-p.idle:
+		return conn
+	default:
+	}
+	if p.reserve() {
+		return p.createConnection()
+	}
+	return nil
+}
+
+// reserve claims room for a new connection under MaxConnections
+func (p *Pool) reserve() bool {
+	for {
+		n := atomic.LoadInt64(&p.total)
+		if n >= int64(p.options.MaxConnections) {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&p.total, n, n+1) {
+			return true
+		}
+	}
+}
+
+// checkout prepares a connection taken from the pool for the caller,
+// replacing it if it expired or fails its ping
+func (p *Pool) checkout(ctx context.Context, conn *Connection) *Connection {
+	now := time.Now()
+	if p.expired(conn, now) {
+		conn = p.replace(conn)
+		atomic.AddInt64(&p.recycled, 1)
+	} else if p.stale(conn, now) {
+		err := p.ping(ctx, conn)
+		atomic.AddInt64(&p.pings, 1)
+		if err != nil {
+			atomic.AddInt64(&p.pingFailures, 1)
+			conn = p.replace(conn)
+		}
+	}
+
+	conn.InUse = true
+	conn.LastUsed = now
+	conn.UseCount++
+	return conn
+}
+
+// stale reports whether conn has been idle long enough to need a ping.
+// Connections that were never used have no socket to check.
+func (p *Pool) stale(conn *Connection, now time.Time) bool {
+	return p.pingEnabled() && conn.UseCount > 0 && now.Sub(conn.LastUsed) > p.options.PingAfterIdle
+}
+
+func (p *Pool) pingEnabled() bool {
+	return p.options.PingAfterIdle > 0 && p.options.APIEndpoint != ""
+}
+
+// ping checks that conn can reach the API. Only transport failures count:
+// any HTTP response, even an error status, proves the connection works.
+func (p *Pool) ping(ctx context.Context, conn *Connection) error {
+	ctx, cancel := context.WithTimeout(ctx, p.options.PingTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", p.options.APIEndpoint+"/health", nil)
+	if err != nil {
+		return err
+	}
+	if p.options.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.options.APIKey)
+	}
+	resp, err := conn.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	// Drain the body so the socket is reused
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+// expired reports whether conn has reached MaxLifetime or MaxUseCount
+func (p *Pool) expired(conn *Connection, now time.Time) bool {
+	if p.options.MaxLifetime > 0 && now.Sub(conn.CreatedAt) >= p.options.MaxLifetime {
+		return true
+	}
+	return p.options.MaxUseCount > 0 && conn.UseCount >= p.options.MaxUseCount
+}
+
+// replace closes conn and returns a new connection in its slot
+func (p *Pool) replace(conn *Connection) *Connection {
+	conn.Client.CloseIdleConnections()
+	conn.pool = nil
+	return p.createConnection()
+}
+
+// discard closes conn and frees its slot, then creates replacements if the
+// pool fell below MinConnections or callers are waiting
+func (p *Pool) discard(conn *Connection) {
+	conn.Client.CloseIdleConnections()
+	conn.pool = nil
+	atomic.AddInt64(&p.total, -1)
+	p.refill()
+}
+
+// refill creates idle connections up to MinConnections, or one for a
+// waiting caller if the pool has room
+func (p *Pool) refill() {
+	for atomic.LoadInt64(&p.total) < int64(p.options.MinConnections) && !p.isClosed() {
+		if !p.reserve() {
+			return
 		}
+		p.put(p.createConnection())
+	}
+	if atomic.LoadInt64(&p.waiting) > 0 && len(p.idle) == 0 && !p.isClosed() && p.reserve() {
+		p.put(p.createConnection())
 	}
+}
 
-	// Create a new connection if we haven't hit the max
-	if len(p.connections) < p.options.MaxConnections {
-		conn := p.createConnection()
-		conn.InUse = true
-		conn.LastUsed = time.Now()
-		conn.UseCount++
-		return conn, nil
+// put makes conn idle, handing it to a waiting Acquire if there is one.
+// The channel holds MaxConnections, so the send never blocks.
+func (p *Pool) put(conn *Connection) {
+	p.idle <- conn
+	// Close may have drained the channel just before the send
+	if p.isClosed() {
+		p.drainIdle()
 	}
+}
 
-	return nil, fmt.Errorf("connection pool exhausted (max: %d)", p.options.MaxConnections)
+func (p *Pool) recordWait(d time.Duration, timedOut bool) {
+	atomic.AddInt64(&p.waitCount, 1)
+	atomic.AddInt64(&p.waitDuration, int64(d))
+	for {
+		max := atomic.LoadInt64(&p.maxWaitDuration)
+		if int64(d) <= max || atomic.CompareAndSwapInt64(&p.maxWaitDuration, max, int64(d)) {
+			break
+		}
+	}
+	if timedOut {
+		atomic.AddInt64(&p.acquireTimeouts, 1)
+	}
 }
 
-// Release returns a connection to the pool
+// Release returns a connection to the pool, handing it straight to the
+// longest waiting Acquire if there is one
 func (p *Pool) Release(conn *Connection) {
-	if conn == nil {
+	if conn == nil || conn.pool != p || !conn.InUse {
 		return
 	}
 
-	p.mu.Lock()
-	defer p.mu.Unlock()
-
-	if existing, ok := p.connections[conn.ID]; ok {
-		existing.InUse = false
-		existing.LastUsed = time.Now()
+	conn.InUse = false
+	conn.LastUsed = time.Now()
+	if p.isClosed() {
+		p.discard(conn)
+		return
+	}
+	// An expired connection is replaced rather than reused, for the next
+	// waiter or to keep MinConnections
+	if p.expired(conn, conn.LastUsed) {
+		atomic.AddInt64(&p.recycled, 1)
+		p.discard(conn)
+		return
 	}
+	p.put(conn)
 }
 
 // GetStats returns pool statistics
 func (p *Pool) GetStats() map[string]interface{} {
-	p.mu.RLock()
-	defer p.mu.RUnlock()
-
-	total := len(p.connections)
-	active := 0
-	idle := 0
-
-	for _, conn := range p.connections {
-		if conn.InUse {
-			active++
-		} else {
-			idle++
-		}
+	total := int(atomic.LoadInt64(&p.total))
+	idle := len(p.idle)
+	active := total - idle
+	if active < 0 {
+		active = 0
 	}
 
 	return map[string]interface{}{
-		"total":          total,
-		"active":         active,
-		"idle":           idle,
-		"minConnections": p.options.MinConnections,
-		"maxConnections": p.options.MaxConnections,
+		"total":           total,
+		"active":          active,
+		"idle":            idle,
+		"minConnections":  p.options.MinConnections,
+		"maxConnections":  p.options.MaxConnections,
+		"waiting":         int(atomic.LoadInt64(&p.waiting)),
+		"waitCount":       atomic.LoadInt64(&p.waitCount),
+		"waitDuration":    time.Duration(atomic.LoadInt64(&p.waitDuration)),
+		"maxWaitDuration": time.Duration(atomic.LoadInt64(&p.maxWaitDuration)),
+		"acquireTimeouts": atomic.LoadInt64(&p.acquireTimeouts),
+		"recycled":        atomic.LoadInt64(&p.recycled),
+		"pings":           atomic.LoadInt64(&p.pings),
+		"pingFailures":    atomic.LoadInt64(&p.pingFailures),
 	}
 }
 
-// Close closes all connections and stops the pool
+func (p *Pool) isClosed() bool {
+	return atomic.LoadInt32(&p.closed) == 1
+}
+
+// Close closes all connections and stops the pool. Waiting Acquire calls
+// fail with ErrPoolClosed, and connections still in use are closed when
+// released.
 func (p *Pool) Close() error {
+	if !atomic.CompareAndSwapInt32(&p.closed, 0, 1) {
+		return nil
+	}
 	close(p.stopCh)
 	p.wg.Wait()
 
-	p.mu.Lock()
-	defer p.mu.Unlock()
+	p.drainIdle()
+	return nil
+}
 
-	// Close all idle connections
-	for id, conn := range p.connections {
-		if !conn.InUse {
+// drainIdle closes every idle connection
+func (p *Pool) drainIdle() {
+	for {
+		select {
+		case conn := <-p.idle:
 			conn.Client.CloseIdleConnections()
-			delete(p.connections, id)
+			conn.pool = nil
+			atomic.AddInt64(&p.total, -1)
+		default:
+			return
 		}
 	}
-
-	return nil
 }
 
+// createConnection builds a connection for a slot already counted in total
 func (p *Pool) createConnection() *Connection {
 	count := atomic.AddUint64(&p.connCounter, 1)
 	id := fmt.Sprintf("conn_%d_%d", time.Now().UnixNano(), count)
 
-	client := &http.Client{
-		Timeout: p.options.ConnectionTimeout,
-		Transport: &http.Transport{
+	transport := p.options.Transport
+	if transport == nil {
+		transport = &http.Transport{
 			MaxIdleConns:        100,
 			MaxIdleConnsPerHost: 10,
 			IdleConnTimeout:     90 * time.Second,
-		},
+		}
+	}
+	client := &http.Client{
+		Timeout:   p.options.ConnectionTimeout,
+		Transport: transport,
 	}
 
-	conn := &Connection{
+	return &Connection{
 		ID:        id,
 		Client:    client,
 		InUse:     false,
 		CreatedAt: time.Now(),
 		LastUsed:  time.Now(),
 		UseCount:  0,
+		pool:      p,
 	}
-
-	p.connections[id] = conn
-	return conn
 }
 
 func (p *Pool) healthCheckLoop() {
@@ -208,33 +453,70 @@ func (p *Pool) healthCheckLoop() {
 	}
 }
 
-func (p *Pool) performHealthCheck() {
-	p.mu.Lock()
-	defer p.mu.Unlock()
+// takeIdle removes the connections currently idle from the channel, so the
+// health check can inspect them without racing Acquire
+func (p *Pool) takeIdle() []*Connection {
+	conns := make([]*Connection, 0, len(p.idle))
+	for n := len(p.idle); n > 0; n-- {
+		select {
+		case conn := <-p.idle:
+			conns = append(conns, conn)
+		default:
+			return conns
+		}
+	}
+	return conns
+}
 
+func (p *Pool) performHealthCheck() {
 	now := time.Now()
-	toRemove := []string{}
-
-	// Check for idle connections that have exceeded idle timeout
-	for id, conn := range p.connections {
-		if !conn.InUse && now.Sub(conn.LastUsed) > p.options.IdleTimeout {
-			// Keep minimum connections
-			if len(p.connections)-len(toRemove) > p.options.MinConnections {
-				toRemove = append(toRemove, id)
-			}
+	var keep, stale []*Connection
+
+	for _, conn := range p.takeIdle() {
+		switch {
+		case p.expired(conn, now):
+			// Recycle idle connections past their lifetime or use count;
+			// in-use ones are recycled when released
+			atomic.AddInt64(&p.recycled, 1)
+			p.discard(conn)
+		case now.Sub(conn.LastUsed) > p.options.IdleTimeout &&
+			atomic.LoadInt64(&p.total) > int64(p.options.MinConnections):
+			// Remove idle connections, keeping the minimum
+			p.discard(conn)
+		case p.stale(conn, now):
+			stale = append(stale, conn)
+		default:
+			keep = append(keep, conn)
 		}
 	}
+	for _, conn := range keep {
+		p.put(conn)
+	}
 
-	// Remove idle connections
-	for _, id := range toRemove {
-		if conn, ok := p.connections[id]; ok {
-			conn.Client.CloseIdleConnections()
-			delete(p.connections, id)
+	// Ping connections idle for longer than PingAfterIdle. They are out of
+	// the channel meanwhile so Acquire skips them, and healthy ones go back
+	// with their idle time intact for IdleTimeout eviction.
+	if len(stale) > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			select {
+			case <-p.stopCh:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		for _, conn := range stale {
+			err := p.ping(ctx, conn)
+			atomic.AddInt64(&p.pings, 1)
+			if err != nil {
+				atomic.AddInt64(&p.pingFailures, 1)
+				p.discard(conn)
+				continue
+			}
+			p.put(conn)
 		}
+		cancel()
 	}
 
-	// Ensure minimum connections
-	for len(p.connections) < p.options.MinConnections {
-		p.createConnection()
-	}
+	p.refill()
 }
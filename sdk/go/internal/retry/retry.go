@@ -17,6 +17,9 @@ type Options struct {
 	MaxDelay          time.Duration
 	BackoffMultiplier float64
 	RetryableErrors   []string
+	// OnRetry, if set, is called with the failed attempt number, from 1,
+	// and its error before each retry
+	OnRetry func(attempt int, err error)
 }
 
 var defaultRetryableErrors = []string{
@@ -127,6 +130,10 @@ func (s *Strategy) Execute(ctx context.Context, fn func() error) error {
 			return fmt.Errorf("failed after %d attempts: %w", s.options.MaxAttempts, lastErr)
 		}
 
+		if s.options.OnRetry != nil {
+			s.options.OnRetry(attempt+1, err)
+		}
+
 		// Calculate and apply delay
 		delay := s.CalculateDelay(attempt)
 		delayWithJitter := s.AddJitter(delay)
@@ -0,0 +1,374 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrConnectionClosed is returned by requests still waiting for a response
+// when their connection is closed
+var ErrConnectionClosed = errors.New("connection closed")
+
+// Conn is a WebSocket connection to the gateway. It carries the frames of
+// one transaction at a time, or of several when shared through
+// NewTransaction, matching responses to requests by frame ID.
+type Conn struct {
+	url    string
+	apiKey string
+	dial   DialFunc
+
+	mu         sync.RWMutex
+	ws         *websocket.Conn
+	connected  bool
+	connecting bool
+	version    int
+	handlers   map[string]*messageHandler
+	// transactions holds the transactions open on the connection, by ID
+	transactions map[string]*TransactionClient
+	writeMu      sync.Mutex
+	// closeCh is closed, once, when the current connection is closed. Each
+	// Connect makes a new one so the Conn can be reconnected after Close.
+	closeCh   chan struct{}
+	closeOnce *sync.Once
+}
+
+// DialFunc opens the network connection a WebSocket runs over
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+type messageHandler struct {
+	responseCh chan interface{}
+	errorCh    chan error
+	timeout    *time.Timer
+}
+
+// NewConn creates an unconnected connection to apiEndpoint
+func NewConn(apiEndpoint, apiKey string) *Conn {
+	// Convert HTTP(S) URL to WS(S)
+	wsURL := apiEndpoint
+	if len(wsURL) > 7 && wsURL[:7] == "http://" {
+		wsURL = "ws://" + wsURL[7:]
+	} else if len(wsURL) > 8 && wsURL[:8] == "https://" {
+		wsURL = "wss://" + wsURL[8:]
+	}
+	wsURL += "/ws"
+
+	return &Conn{
+		url:          wsURL,
+		apiKey:       apiKey,
+		handlers:     make(map[string]*messageHandler),
+		transactions: make(map[string]*TransactionClient),
+		closeCh:      make(chan struct{}),
+		closeOnce:    &sync.Once{},
+	}
+}
+
+// SetDialer makes Connect open its network connection with dial instead of
+// the default dialer
+func (c *Conn) SetDialer(dial DialFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dial = dial
+}
+
+// NewTransaction returns a transaction client sharing c with the other
+// transactions created from it. Its frames are sent one at a time, in
+// call order, interleaved with the frames of the others.
+func (c *Conn) NewTransaction() *TransactionClient {
+	return &TransactionClient{conn: c}
+}
+
+// Connect establishes the WebSocket connection
+func (c *Conn) Connect(ctx context.Context) error {
+	c.mu.Lock()
+	if c.connected {
+		c.mu.Unlock()
+		return nil
+	}
+	if c.connecting {
+		c.mu.Unlock()
+		return fmt.Errorf("connection already in progress")
+	}
+	c.connecting = true
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		c.connecting = false
+		c.mu.Unlock()
+	}()
+
+	header := make(map[string][]string)
+	if c.apiKey != "" {
+		header["Authorization"] = []string{"Bearer " + c.apiKey}
+	}
+
+	dialer := *websocket.DefaultDialer
+	dialer.Subprotocols = subprotocols()
+	c.mu.RLock()
+	if c.dial != nil {
+		dialer.NetDialContext = c.dial
+	}
+	c.mu.RUnlock()
+	ws, _, err := dialer.DialContext(ctx, c.url, header)
+	if err != nil {
+		return fmt.Errorf("failed to connect to WebSocket: %w", err)
+	}
+
+	version, err := negotiatedVersion(ws.Subprotocol())
+	if err != nil {
+		_ = ws.Close()
+		return fmt.Errorf("failed to negotiate protocol: %w", err)
+	}
+
+	c.mu.Lock()
+	c.ws = ws
+	c.connected = true
+	c.version = version
+	c.closeCh = make(chan struct{})
+	c.closeOnce = &sync.Once{}
+	closeCh := c.closeCh
+	c.mu.Unlock()
+
+	// Start message handler goroutine
+	go c.handleMessages(closeCh)
+
+	return nil
+}
+
+// ProtocolVersion returns the protocol version negotiated for the connection
+func (c *Conn) ProtocolVersion() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.version
+}
+
+// IsConnected reports whether the WebSocket connection is open
+func (c *Conn) IsConnected() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.connected
+}
+
+// OpenTransactions returns the number of transactions open on the
+// connection
+func (c *Conn) OpenTransactions() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.transactions)
+}
+
+// Close closes the WebSocket connection, ending the transactions open on it
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	if !c.connected || c.ws == nil {
+		c.mu.Unlock()
+		return nil
+	}
+
+	closeCh := c.closeCh
+	c.closeOnce.Do(func() { close(closeCh) })
+	err := c.ws.Close()
+	c.connected = false
+	c.ws = nil
+	open := c.takeTransactions()
+	c.failHandlers(ErrConnectionClosed)
+	c.mu.Unlock()
+
+	for _, tx := range open {
+		tx.reset()
+	}
+	return err
+}
+
+// done returns the channel closed when the current connection is closed
+func (c *Conn) done() <-chan struct{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.closeCh
+}
+
+// register records tx as open under txID
+func (c *Conn) register(txID string, tx *TransactionClient) {
+	c.mu.Lock()
+	c.transactions[txID] = tx
+	c.mu.Unlock()
+}
+
+// unregister forgets the transaction txID
+func (c *Conn) unregister(txID string) {
+	c.mu.Lock()
+	delete(c.transactions, txID)
+	c.mu.Unlock()
+}
+
+// takeTransactions empties the set of open transactions. c.mu must be
+// held.
+func (c *Conn) takeTransactions() []*TransactionClient {
+	open := make([]*TransactionClient, 0, len(c.transactions))
+	for id, tx := range c.transactions {
+		open = append(open, tx)
+		delete(c.transactions, id)
+	}
+	return open
+}
+
+func (c *Conn) sendMessage(ctx context.Context, msg Message, timeout time.Duration) (interface{}, error) {
+	c.mu.RLock()
+	if !c.connected || c.ws == nil {
+		c.mu.RUnlock()
+		return nil, fmt.Errorf("not connected")
+	}
+	version := c.version
+	c.mu.RUnlock()
+
+	if err := msg.Validate(version); err != nil {
+		return nil, err
+	}
+
+	// Create handler for this message
+	handler := &messageHandler{
+		responseCh: make(chan interface{}, 1),
+		errorCh:    make(chan error, 1),
+		timeout:    time.NewTimer(timeout),
+	}
+
+	c.mu.Lock()
+	c.handlers[msg.ID] = handler
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.handlers, msg.ID)
+		c.mu.Unlock()
+		handler.timeout.Stop()
+	}()
+
+	// Send message
+	c.mu.RLock()
+	ws := c.ws
+	c.mu.RUnlock()
+	if ws == nil {
+		return nil, fmt.Errorf("not connected")
+	}
+
+	c.writeMu.Lock()
+	err := ws.WriteJSON(msg)
+	c.writeMu.Unlock()
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to send message: %w", err)
+	}
+
+	// Wait for response
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-handler.timeout.C:
+		return nil, fmt.Errorf("message timeout")
+	case err := <-handler.errorCh:
+		return nil, err
+	case resp := <-handler.responseCh:
+		return resp, nil
+	}
+}
+
+func (c *Conn) handleMessages(closeCh <-chan struct{}) {
+	for {
+		select {
+		case <-closeCh:
+			return
+		default:
+		}
+
+		c.mu.RLock()
+		ws := c.ws
+		c.mu.RUnlock()
+
+		if ws == nil {
+			return
+		}
+
+		var msg Message
+		err := readFrame(ws, &msg)
+		if err != nil {
+			// Connection closed or error
+			c.markDisconnected(ws, err)
+			return
+		}
+
+		// A request takes one response, so its handler is removed on the
+		// first and duplicates are skipped
+		c.mu.Lock()
+		handler, ok := c.handlers[msg.ID]
+		delete(c.handlers, msg.ID)
+		version := c.version
+		c.mu.Unlock()
+
+		if !ok {
+			// Unsolicited or unknown frames are skipped so newer servers
+			// can add frame types without breaking this client
+			continue
+		}
+
+		if err := validateInbound(&msg, version); err != nil {
+			handler.fail(err)
+		} else if msg.Error != nil {
+			handler.fail(newServerError(msg.Error))
+		} else {
+			handler.respond(msg.Data)
+		}
+	}
+}
+
+// respond delivers data to the request waiting on h, if it still is
+func (h *messageHandler) respond(data interface{}) {
+	select {
+	case h.responseCh <- data:
+	default:
+	}
+}
+
+// fail delivers err to the request waiting on h, if it still is
+func (h *messageHandler) fail(err error) {
+	select {
+	case h.errorCh <- err:
+	default:
+	}
+}
+
+// failHandlers fails every request waiting for a response with err. c.mu
+// must be held.
+func (c *Conn) failHandlers(err error) {
+	for id, handler := range c.handlers {
+		handler.fail(err)
+		delete(c.handlers, id)
+	}
+}
+
+// markDisconnected records that ws is no longer usable, ends the
+// transactions open on it and fails any requests still waiting for a
+// response on it.
+func (c *Conn) markDisconnected(ws *websocket.Conn, cause error) {
+	c.mu.Lock()
+	if c.ws != ws {
+		c.mu.Unlock()
+		return
+	}
+
+	_ = ws.Close()
+	c.connected = false
+	c.ws = nil
+	open := c.takeTransactions()
+	c.failHandlers(fmt.Errorf("connection lost: %w", cause))
+	c.mu.Unlock()
+
+	for _, tx := range open {
+		tx.reset()
+	}
+}
@@ -0,0 +1,131 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrTransactionExpired is returned for a transaction that the client rolled
+// back because it stayed open longer than the configured maximum duration
+var ErrTransactionExpired = errors.New("transaction exceeded maximum duration and was rolled back")
+
+// HeartbeatOptions configures transaction keepalives
+type HeartbeatOptions struct {
+	// Interval between ping frames while a transaction is open and no other
+	// frame has been sent. Zero disables heartbeats.
+	Interval time.Duration
+	// MaxDuration after which an open transaction is rolled back by the
+	// client. Zero means no limit.
+	MaxDuration time.Duration
+}
+
+// SetHeartbeat configures keepalives for transactions started afterwards
+func (c *TransactionClient) SetHeartbeat(opts HeartbeatOptions) {
+	c.mu.Lock()
+	c.heartbeat = opts
+	c.mu.Unlock()
+}
+
+// startHeartbeat runs keepalives for txID until stop is closed. Caller holds c.mu.
+func (c *TransactionClient) startHeartbeat(txID string) {
+	opts := c.heartbeat
+	if opts.Interval <= 0 && opts.MaxDuration <= 0 {
+		return
+	}
+
+	stop := make(chan struct{})
+	c.heartbeatStop = stop
+	go c.heartbeatLoop(txID, opts, stop)
+}
+
+// stopHeartbeat ends the keepalive loop, if any. Caller holds c.mu.
+func (c *TransactionClient) stopHeartbeat() {
+	if c.heartbeatStop != nil {
+		close(c.heartbeatStop)
+		c.heartbeatStop = nil
+	}
+}
+
+func (c *TransactionClient) heartbeatLoop(txID string, opts HeartbeatOptions, stop chan struct{}) {
+	var tick <-chan time.Time
+	if opts.Interval > 0 {
+		ticker := time.NewTicker(opts.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	var deadline <-chan time.Time
+	if opts.MaxDuration > 0 {
+		timer := time.NewTimer(opts.MaxDuration)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	closed := c.conn.done()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-closed:
+			return
+		case <-tick:
+			c.mu.RLock()
+			idle := time.Since(c.lastActivity)
+			c.mu.RUnlock()
+			if idle < opts.Interval {
+				continue
+			}
+			c.ping(txID, opts.Interval)
+		case <-deadline:
+			c.expire(txID)
+			return
+		}
+	}
+}
+
+// ping sends a keepalive frame. Failures are ignored: a broken connection is
+// detected by the reader and surfaces on the next statement.
+func (c *TransactionClient) ping(txID string, timeout time.Duration) {
+	c.mu.RLock()
+	active := c.transactionID == txID && c.state.allowed(FramePing)
+	c.mu.RUnlock()
+	if !active {
+		return
+	}
+
+	msg := Message{
+		Type:          FramePing,
+		ID:            generateID(),
+		TransactionID: txID,
+	}
+	_, _ = c.sendMessage(context.Background(), msg, timeout)
+}
+
+// expire force-rolls back txID after it exceeded the maximum duration
+func (c *TransactionClient) expire(txID string) {
+	c.mu.Lock()
+	if c.transactionID != txID || c.state != stateActive {
+		c.mu.Unlock()
+		return
+	}
+	c.state = stateFinishing
+	c.heartbeatStop = nil
+	c.mu.Unlock()
+
+	msg := Message{
+		Type:          FrameRollback,
+		ID:            generateID(),
+		TransactionID: txID,
+	}
+	_, _ = c.sendMessage(context.Background(), msg, 30*time.Second)
+
+	c.mu.Lock()
+	if c.transactionID == txID {
+		c.transactionID = ""
+		c.state = stateIdle
+		c.expired = true
+	}
+	c.mu.Unlock()
+	c.conn.unregister(txID)
+}
@@ -0,0 +1,306 @@
+package websocket
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Manager keeps transaction WebSocket sessions warm between transactions.
+// Sessions released by a finished transaction are parked and reused by the
+// next Acquire; a parked session that stays unused for IdleTimeout is closed,
+// and the following Acquire transparently dials a new one. With
+// TransactionsPerConnection above one, sessions share connections instead.
+type Manager struct {
+	apiEndpoint string
+	apiKey      string
+	options     ManagerOptions
+
+	mu     sync.Mutex
+	idle   []*idleSession
+	shared []*sharedConn
+	closed bool
+}
+
+// sharedConn is a connection multiplexing the transactions of several
+// sessions
+type sharedConn struct {
+	conn *Conn
+	// sessions counts the sessions acquired on conn and not yet released
+	sessions int
+	// timer closes conn once it has been without sessions for IdleTimeout;
+	// idleSince tells its firing apart from that of a timer stopped too late
+	timer     *time.Timer
+	idleSince uint64
+}
+
+type idleSession struct {
+	client *TransactionClient
+	timer  *time.Timer
+}
+
+// ManagerOptions configures a session manager
+type ManagerOptions struct {
+	// IdleTimeout is how long a released session is parked for reuse. Zero
+	// or negative disables parking, so sessions are closed on release.
+	IdleTimeout time.Duration
+	// Heartbeat configures keepalives for transactions on managed sessions
+	Heartbeat HeartbeatOptions
+	// TransactionsPerConnection, above one, multiplexes up to this many
+	// concurrent transactions over each connection, dialing another one
+	// when every connection is full. The server must route frames by
+	// transaction ID.
+	TransactionsPerConnection int
+	// Dial, if set, opens the network connections of new sessions
+	Dial DialFunc
+}
+
+// NewManager creates a session manager
+func NewManager(apiEndpoint, apiKey string, opts ManagerOptions) *Manager {
+	return &Manager{
+		apiEndpoint: apiEndpoint,
+		apiKey:      apiKey,
+		options:     opts,
+	}
+}
+
+// Acquire returns a connected session, reusing a parked one when available
+func (m *Manager) Acquire(ctx context.Context) (*TransactionClient, error) {
+	if m.options.TransactionsPerConnection > 1 {
+		return m.acquireShared(ctx)
+	}
+	for {
+		m.mu.Lock()
+		n := len(m.idle)
+		if n == 0 {
+			m.mu.Unlock()
+			break
+		}
+		// Reuse the most recently parked session so older ones can expire
+		entry := m.idle[n-1]
+		m.idle = m.idle[:n-1]
+		m.mu.Unlock()
+
+		if !entry.timer.Stop() {
+			// The idle timer already fired and is closing this session
+			continue
+		}
+		if entry.client.IsConnected() {
+			return entry.client, nil
+		}
+		_ = entry.client.Close()
+	}
+
+	client := NewTransactionClient(m.apiEndpoint, m.apiKey)
+	client.SetHeartbeat(m.options.Heartbeat)
+	client.SetDialer(m.options.Dial)
+	if err := client.Connect(ctx); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// Release hands a session back after its transaction has finished. Healthy
+// sessions are parked for reuse; broken ones are closed.
+func (m *Manager) Release(client *TransactionClient) {
+	if client == nil {
+		return
+	}
+	if !client.owned {
+		m.releaseShared(client)
+		return
+	}
+
+	m.mu.Lock()
+	if m.closed || m.options.IdleTimeout <= 0 || !client.IsConnected() {
+		m.mu.Unlock()
+		_ = client.Close()
+		return
+	}
+
+	entry := &idleSession{client: client}
+	entry.timer = time.AfterFunc(m.options.IdleTimeout, func() { m.expire(entry) })
+	m.idle = append(m.idle, entry)
+	m.mu.Unlock()
+}
+
+// Discard closes a session that must not be reused. A session sharing
+// its connection is released instead: transaction IDs keep late frames of
+// its transaction away from the others.
+func (m *Manager) Discard(client *TransactionClient) {
+	if client == nil {
+		return
+	}
+	if !client.owned {
+		m.releaseShared(client)
+		return
+	}
+	_ = client.Close()
+}
+
+// IdleCount returns the number of parked sessions, or of connections
+// without sessions when they are shared
+func (m *Manager) IdleCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := len(m.idle)
+	for _, shared := range m.shared {
+		if shared.sessions == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// ConnectionCount returns the number of shared connections
+func (m *Manager) ConnectionCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.shared)
+}
+
+// acquireShared returns a session on the connection with the most
+// sessions that still has room, or on a new connection
+func (m *Manager) acquireShared(ctx context.Context) (*TransactionClient, error) {
+	m.mu.Lock()
+	var best *sharedConn
+	for _, shared := range m.shared {
+		if !shared.conn.IsConnected() || shared.sessions >= m.options.TransactionsPerConnection {
+			continue
+		}
+		if best == nil || shared.sessions > best.sessions {
+			best = shared
+		}
+	}
+	if best != nil {
+		best.sessions++
+		if best.timer != nil {
+			best.timer.Stop()
+			best.timer = nil
+		}
+		m.mu.Unlock()
+		return m.newSharedSession(best.conn), nil
+	}
+	m.mu.Unlock()
+
+	conn := NewConn(m.apiEndpoint, m.apiKey)
+	conn.SetDialer(m.options.Dial)
+	if err := conn.Connect(ctx); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	m.shared = append(m.shared, &sharedConn{conn: conn, sessions: 1})
+	m.mu.Unlock()
+	return m.newSharedSession(conn), nil
+}
+
+func (m *Manager) newSharedSession(conn *Conn) *TransactionClient {
+	client := conn.NewTransaction()
+	client.SetHeartbeat(m.options.Heartbeat)
+	return client
+}
+
+// releaseShared detaches client from its connection, closing the
+// connection once it is broken, or unused for IdleTimeout
+func (m *Manager) releaseShared(client *TransactionClient) {
+	_ = client.Close()
+
+	m.mu.Lock()
+	var shared *sharedConn
+	for _, s := range m.shared {
+		if s.conn == client.conn {
+			shared = s
+			break
+		}
+	}
+	if shared == nil {
+		m.mu.Unlock()
+		return
+	}
+	shared.sessions--
+	if shared.sessions > 0 {
+		m.mu.Unlock()
+		return
+	}
+	if m.closed || m.options.IdleTimeout <= 0 || !shared.conn.IsConnected() {
+		m.removeShared(shared)
+		m.mu.Unlock()
+		_ = shared.conn.Close()
+		return
+	}
+	shared.idleSince++
+	idleSince := shared.idleSince
+	shared.timer = time.AfterFunc(m.options.IdleTimeout, func() { m.expireShared(shared, idleSince) })
+	m.mu.Unlock()
+}
+
+// expireShared closes shared if it is still without sessions since the
+// release numbered idleSince
+func (m *Manager) expireShared(shared *sharedConn, idleSince uint64) {
+	m.mu.Lock()
+	if shared.idleSince != idleSince || shared.sessions > 0 {
+		m.mu.Unlock()
+		return
+	}
+	m.removeShared(shared)
+	m.mu.Unlock()
+	_ = shared.conn.Close()
+}
+
+// removeShared forgets shared. m.mu must be held.
+func (m *Manager) removeShared(shared *sharedConn) {
+	for i, s := range m.shared {
+		if s == shared {
+			m.shared = append(m.shared[:i], m.shared[i+1:]...)
+			return
+		}
+	}
+}
+
+// Close closes all parked sessions. Sessions released afterwards are closed
+// immediately.
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	idle := m.idle
+	m.idle = nil
+	var unused []*Conn
+	for i := 0; i < len(m.shared); i++ {
+		if shared := m.shared[i]; shared.sessions == 0 {
+			if shared.timer != nil {
+				shared.timer.Stop()
+			}
+			unused = append(unused, shared.conn)
+			m.removeShared(shared)
+			i--
+		}
+	}
+	m.closed = true
+	m.mu.Unlock()
+
+	var firstErr error
+	for _, entry := range idle {
+		entry.timer.Stop()
+		if err := entry.client.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	for _, conn := range unused {
+		if err := conn.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (m *Manager) expire(entry *idleSession) {
+	m.mu.Lock()
+	for i, e := range m.idle {
+		if e == entry {
+			m.idle = append(m.idle[:i], m.idle[i+1:]...)
+			break
+		}
+	}
+	m.mu.Unlock()
+
+	_ = entry.client.Close()
+}
@@ -0,0 +1,269 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ProtocolVersion is the newest transaction protocol version this client speaks
+const ProtocolVersion = 1
+
+// subprotocolPrefix prefixes the WebSocket subprotocol names used to
+// negotiate the protocol version during the handshake, e.g. "workersql.v1"
+const subprotocolPrefix = "workersql.v"
+
+// supportedVersions lists the protocol versions offered in the handshake,
+// most preferred first
+var supportedVersions = []int{1}
+
+// FrameType identifies the kind of a protocol frame
+type FrameType string
+
+// Frame types sent by the client
+const (
+	FrameBegin    FrameType = "begin"
+	FrameQuery    FrameType = "query"
+	FrameCommit   FrameType = "commit"
+	FrameRollback FrameType = "rollback"
+	// FramePing keeps an open transaction alive on the server
+	FramePing FrameType = "ping"
+	// FramePipeline carries several statements executed in order, answered
+	// by a single response frame holding their results
+	FramePipeline FrameType = "pipeline"
+)
+
+// Frame types sent by the server
+const (
+	FrameResponse FrameType = "response"
+	FrameError    FrameType = "error"
+	FramePong     FrameType = "pong"
+)
+
+// Message represents a WebSocket protocol frame
+type Message struct {
+	Type          FrameType              `json:"type"`
+	ID            string                 `json:"id"`
+	SQL           string                 `json:"sql,omitempty"`
+	Params        []interface{}          `json:"params,omitempty"`
+	TransactionID string                 `json:"transactionId,omitempty"`
+	Mode          string                 `json:"mode,omitempty"`
+	Statements    []Statement            `json:"statements,omitempty"`
+	Data          interface{}            `json:"data,omitempty"`
+	Error         map[string]interface{} `json:"error,omitempty"`
+}
+
+// Statement is one statement of a pipeline frame
+type Statement struct {
+	SQL    string        `json:"sql"`
+	Params []interface{} `json:"params,omitempty"`
+	Mode   string        `json:"mode,omitempty"`
+}
+
+// ProtocolError reports a frame that violates the negotiated protocol
+type ProtocolError struct {
+	Version int
+	Reason  string
+}
+
+func (e *ProtocolError) Error() string {
+	return fmt.Sprintf("websocket protocol v%d error: %s", e.Version, e.Reason)
+}
+
+// ServerError is an error reported by the server in a frame
+type ServerError struct {
+	Code    string
+	Message string
+	Details map[string]interface{}
+}
+
+func (e *ServerError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("server error: %s", e.Message)
+	}
+	return fmt.Sprintf("server error: %s: %s", e.Code, e.Message)
+}
+
+// ErrDeadlock and ErrConflict match, with errors.Is, server errors saying
+// the transaction was aborted by a deadlock or a serialization conflict and
+// may succeed if run again
+var (
+	ErrDeadlock = errors.New("transaction aborted by deadlock")
+	ErrConflict = errors.New("transaction aborted by serialization conflict")
+)
+
+// ErrLockNotAvailable matches, with errors.Is, server errors saying a
+// locking read couldn't lock its rows: they were locked with NOWAIT set, or
+// the lock wait timed out
+var ErrLockNotAvailable = errors.New("row lock not available")
+
+// deadlockCodes and conflictCodes are the server error codes of ErrDeadlock
+// and ErrConflict
+var (
+	deadlockCodes = map[string]bool{
+		"DEADLOCK":         true,
+		"ER_LOCK_DEADLOCK": true,
+	}
+	conflictCodes = map[string]bool{
+		"CONFLICT":              true,
+		"SERIALIZATION_FAILURE": true,
+		"WRITE_CONFLICT":        true,
+	}
+	lockNotAvailableCodes = map[string]bool{
+		"LOCK_NOT_AVAILABLE":   true,
+		"ER_LOCK_NOWAIT":       true,
+		"ER_LOCK_WAIT_TIMEOUT": true,
+	}
+)
+
+// Is reports whether e is of the class of ErrDeadlock, ErrConflict or
+// ErrLockNotAvailable
+func (e *ServerError) Is(target error) bool {
+	switch target {
+	case ErrDeadlock:
+		return deadlockCodes[e.Code]
+	case ErrConflict:
+		return conflictCodes[e.Code]
+	case ErrLockNotAvailable:
+		return lockNotAvailableCodes[e.Code]
+	}
+	return false
+}
+
+func newServerError(payload map[string]interface{}) *ServerError {
+	e := &ServerError{Details: payload}
+	e.Code, _ = payload["code"].(string)
+	e.Message, _ = payload["message"].(string)
+	if e.Message == "" {
+		e.Message = fmt.Sprintf("%v", payload)
+	}
+	return e
+}
+
+// Validate checks an outgoing frame against the protocol schema
+func (m *Message) Validate(version int) error {
+	if m.ID == "" {
+		return &ProtocolError{Version: version, Reason: fmt.Sprintf("%s frame without id", m.Type)}
+	}
+
+	switch m.Type {
+	case FrameBegin:
+		return nil
+	case FrameQuery:
+		if m.SQL == "" {
+			return &ProtocolError{Version: version, Reason: "query frame without sql"}
+		}
+		if m.TransactionID == "" {
+			return &ProtocolError{Version: version, Reason: "query frame without transactionId"}
+		}
+	case FramePipeline:
+		if m.TransactionID == "" {
+			return &ProtocolError{Version: version, Reason: "pipeline frame without transactionId"}
+		}
+		if len(m.Statements) == 0 {
+			return &ProtocolError{Version: version, Reason: "pipeline frame without statements"}
+		}
+		for i, stmt := range m.Statements {
+			if stmt.SQL == "" {
+				return &ProtocolError{Version: version, Reason: fmt.Sprintf("pipeline statement %d without sql", i)}
+			}
+		}
+	case FrameCommit, FrameRollback, FramePing:
+		if m.TransactionID == "" {
+			return &ProtocolError{Version: version, Reason: fmt.Sprintf("%s frame without transactionId", m.Type)}
+		}
+	default:
+		return &ProtocolError{Version: version, Reason: fmt.Sprintf("client cannot send %q frames", m.Type)}
+	}
+	return nil
+}
+
+// validateInbound checks a frame received from the server. Unknown frame
+// types are reported so they can be skipped rather than misinterpreted.
+func validateInbound(m *Message, version int) error {
+	switch m.Type {
+	case FrameResponse, FramePong:
+		if m.ID == "" {
+			return &ProtocolError{Version: version, Reason: fmt.Sprintf("%s frame without id", m.Type)}
+		}
+	case FrameError:
+		if m.Error == nil {
+			return &ProtocolError{Version: version, Reason: "error frame without error"}
+		}
+	case "":
+		// Protocol v1 servers may omit the type on replies
+		if m.ID == "" {
+			return &ProtocolError{Version: version, Reason: "untyped frame without id"}
+		}
+	default:
+		return &ProtocolError{Version: version, Reason: fmt.Sprintf("unknown frame type %q", m.Type)}
+	}
+	return nil
+}
+
+// subprotocols returns the subprotocol names offered during the handshake
+func subprotocols() []string {
+	names := make([]string, len(supportedVersions))
+	for i, v := range supportedVersions {
+		names[i] = subprotocolPrefix + strconv.Itoa(v)
+	}
+	return names
+}
+
+// negotiatedVersion maps the subprotocol selected by the server to a
+// protocol version. Servers that select no subprotocol predate negotiation
+// and speak version 1.
+func negotiatedVersion(selected string) (int, error) {
+	if selected == "" {
+		return 1, nil
+	}
+	if !strings.HasPrefix(selected, subprotocolPrefix) {
+		return 0, fmt.Errorf("server selected unsupported subprotocol %q", selected)
+	}
+	v, err := strconv.Atoi(strings.TrimPrefix(selected, subprotocolPrefix))
+	if err != nil {
+		return 0, fmt.Errorf("server selected unsupported subprotocol %q", selected)
+	}
+	for _, supported := range supportedVersions {
+		if v == supported {
+			return v, nil
+		}
+	}
+	return 0, fmt.Errorf("server selected protocol v%d, client supports up to v%d", v, ProtocolVersion)
+}
+
+// txState is the lifecycle state of the transaction on a session
+type txState int
+
+const (
+	stateIdle txState = iota
+	stateBeginning
+	stateActive
+	stateFinishing
+)
+
+func (s txState) String() string {
+	switch s {
+	case stateIdle:
+		return "idle"
+	case stateBeginning:
+		return "beginning"
+	case stateActive:
+		return "active"
+	case stateFinishing:
+		return "finishing"
+	}
+	return "unknown"
+}
+
+// allowed reports whether a frame of type t may be sent in state s
+func (s txState) allowed(t FrameType) bool {
+	switch t {
+	case FrameBegin:
+		return s == stateIdle
+	case FrameQuery, FramePipeline, FrameCommit, FrameRollback, FramePing:
+		return s == stateActive
+	}
+	return false
+}
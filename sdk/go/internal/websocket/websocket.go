@@ -2,6 +2,7 @@
 package websocket
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -12,147 +13,136 @@ import (
 	"github.com/gorilla/websocket"
 )
 
-// Message represents a WebSocket message
-type Message struct {
-	Type          string                 `json:"type"`
-	ID            string                 `json:"id"`
-	SQL           string                 `json:"sql,omitempty"`
-	Params        []interface{}          `json:"params,omitempty"`
-	TransactionID string                 `json:"transactionId,omitempty"`
-	Data          interface{}            `json:"data,omitempty"`
-	Error         map[string]interface{} `json:"error,omitempty"`
+// Column describes a result column
+type Column struct {
+	Name         string `json:"name"`
+	DatabaseType string `json:"type"`
+	Nullable     bool   `json:"nullable"`
+	Precision    int    `json:"precision,omitempty"`
 }
 
 // QueryResponse represents a query response
 type QueryResponse struct {
 	Success       bool                     `json:"success"`
 	Data          []map[string]interface{} `json:"data,omitempty"`
+	Columns       []Column                 `json:"columns,omitempty"`
 	RowCount      int                      `json:"rowCount,omitempty"`
+	AffectedRows  int64                    `json:"affectedRows,omitempty"`
+	LastInsertID  int64                    `json:"lastInsertId,omitempty"`
 	ExecutionTime float64                  `json:"executionTime,omitempty"`
 	Cached        bool                     `json:"cached,omitempty"`
 	Error         map[string]interface{}   `json:"error,omitempty"`
 }
 
-// TransactionClient manages WebSocket connections for transactions
+// TransactionClient runs transactions over a WebSocket connection, one at
+// a time. It owns its connection, or shares one with other transactions
+// when created by Conn.NewTransaction.
 type TransactionClient struct {
-	url           string
-	apiKey        string
-	conn          *websocket.Conn
-	connected     bool
-	connecting    bool
+	conn *Conn
+	// owned is set when the client dialed conn itself and closes it
+	owned bool
+
 	transactionID string
-	handlers      map[string]*messageHandler
+	state         txState
+	expired       bool
+	heartbeat     HeartbeatOptions
+	heartbeatStop chan struct{}
+	lastActivity  time.Time
 	mu            sync.RWMutex
-	closeCh       chan struct{}
-}
-
-type messageHandler struct {
-	responseCh chan interface{}
-	errorCh    chan error
-	timeout    *time.Timer
+	// order sends the frames of the transaction one at a time, each after
+	// the previous one was answered
+	order sync.Mutex
 }
 
-// NewTransactionClient creates a new WebSocket transaction client
+// NewTransactionClient creates a new WebSocket transaction client with a
+// connection of its own
 func NewTransactionClient(apiEndpoint, apiKey string) *TransactionClient {
-	// Convert HTTP(S) URL to WS(S)
-	wsURL := apiEndpoint
-	if len(wsURL) > 7 && wsURL[:7] == "http://" {
-		wsURL = "ws://" + wsURL[7:]
-	} else if len(wsURL) > 8 && wsURL[:8] == "https://" {
-		wsURL = "wss://" + wsURL[8:]
-	}
-	wsURL += "/ws"
+	return &TransactionClient{conn: NewConn(apiEndpoint, apiKey), owned: true}
+}
 
-	return &TransactionClient{
-		url:      wsURL,
-		apiKey:   apiKey,
-		handlers: make(map[string]*messageHandler),
-		closeCh:  make(chan struct{}),
-	}
+// SetDialer makes the client's connection dial with dial, see Conn.SetDialer
+func (c *TransactionClient) SetDialer(dial DialFunc) {
+	c.conn.SetDialer(dial)
 }
 
-// Connect establishes a WebSocket connection
+// Connect establishes the WebSocket connection
 func (c *TransactionClient) Connect(ctx context.Context) error {
-	c.mu.Lock()
-	if c.connected {
-		c.mu.Unlock()
-		return nil
-	}
-	if c.connecting {
-		c.mu.Unlock()
-		return fmt.Errorf("connection already in progress")
-	}
-	c.connecting = true
-	c.mu.Unlock()
-
-	defer func() {
-		c.mu.Lock()
-		c.connecting = false
-		c.mu.Unlock()
-	}()
+	return c.conn.Connect(ctx)
+}
 
-	header := make(map[string][]string)
-	if c.apiKey != "" {
-		header["Authorization"] = []string{"Bearer " + c.apiKey}
-	}
+// ProtocolVersion returns the protocol version negotiated for the connection
+func (c *TransactionClient) ProtocolVersion() int {
+	return c.conn.ProtocolVersion()
+}
 
-	dialer := websocket.DefaultDialer
-	conn, _, err := dialer.DialContext(ctx, c.url, header)
-	if err != nil {
-		return fmt.Errorf("failed to connect to WebSocket: %w", err)
+// Begin starts a transaction
+func (c *TransactionClient) Begin(ctx context.Context) error {
+	if err := c.transition(FrameBegin, stateBeginning); err != nil {
+		return err
 	}
-
 	c.mu.Lock()
-	c.conn = conn
-	c.connected = true
+	c.expired = false
 	c.mu.Unlock()
 
-	// Start message handler goroutine
-	go c.handleMessages()
-
-	return nil
-}
-
-// Begin starts a transaction
-func (c *TransactionClient) Begin(ctx context.Context) error {
 	msg := Message{
-		Type: "begin",
+		Type: FrameBegin,
 		ID:   generateID(),
 	}
 
 	response, err := c.sendMessage(ctx, msg, 30*time.Second)
 	if err != nil {
+		c.setState(stateIdle)
 		return err
 	}
 
 	if respMap, ok := response.(map[string]interface{}); ok {
-		if txID, ok := respMap["transactionId"].(string); ok {
+		if txID, ok := respMap["transactionId"].(string); ok && txID != "" {
 			c.mu.Lock()
 			c.transactionID = txID
+			c.state = stateActive
+			c.startHeartbeat(txID)
 			c.mu.Unlock()
+			c.conn.register(txID, c)
 			return nil
 		}
 	}
 
-	return fmt.Errorf("invalid response from BEGIN")
+	c.setState(stateIdle)
+	return &ProtocolError{Version: c.ProtocolVersion(), Reason: "begin response without transactionId"}
 }
 
 // Query executes a query within the transaction
 func (c *TransactionClient) Query(ctx context.Context, sql string, params []interface{}) (*QueryResponse, error) {
+	return c.query(ctx, "", sql, params)
+}
+
+// Exec executes a write statement within the transaction, asking the server
+// to report affected rows and the last insert ID
+func (c *TransactionClient) Exec(ctx context.Context, sql string, params []interface{}) (*QueryResponse, error) {
+	return c.query(ctx, "exec", sql, params)
+}
+
+func (c *TransactionClient) query(ctx context.Context, mode, sql string, params []interface{}) (*QueryResponse, error) {
 	c.mu.RLock()
 	txID := c.transactionID
+	state := c.state
+	expired := c.expired
 	c.mu.RUnlock()
 
-	if txID == "" {
+	if expired {
+		return nil, ErrTransactionExpired
+	}
+	if txID == "" || !state.allowed(FrameQuery) {
 		return nil, fmt.Errorf("no active transaction")
 	}
 
 	msg := Message{
-		Type:          "query",
+		Type:          FrameQuery,
 		ID:            generateID(),
 		SQL:           sql,
 		Params:        params,
 		TransactionID: txID,
+		Mode:          mode,
 	}
 
 	response, err := c.sendMessage(ctx, msg, 30*time.Second)
@@ -160,169 +150,194 @@ func (c *TransactionClient) Query(ctx context.Context, sql string, params []inte
 		return nil, err
 	}
 
-	// Parse response as QueryResponse
+	// Parse response as QueryResponse, keeping numbers exact
 	var qr QueryResponse
-	respBytes, _ := json.Marshal(response)
-	if err := json.Unmarshal(respBytes, &qr); err != nil {
+	if err := decodeData(response, &qr); err != nil {
 		return nil, fmt.Errorf("failed to parse query response: %w", err)
 	}
 
 	return &qr, nil
 }
 
-// Commit commits the transaction
-func (c *TransactionClient) Commit(ctx context.Context) error {
+// Pipeline sends statements in a single frame and returns their results in
+// order. The server stops at the first failing statement, so the results
+// end with that statement's failed response.
+func (c *TransactionClient) Pipeline(ctx context.Context, statements []Statement) ([]*QueryResponse, error) {
 	c.mu.RLock()
 	txID := c.transactionID
+	state := c.state
+	expired := c.expired
 	c.mu.RUnlock()
 
-	if txID == "" {
-		return nil // Nothing to commit
+	if expired {
+		return nil, ErrTransactionExpired
+	}
+	if txID == "" || !state.allowed(FramePipeline) {
+		return nil, fmt.Errorf("no active transaction")
 	}
 
 	msg := Message{
-		Type:          "commit",
+		Type:          FramePipeline,
 		ID:            generateID(),
 		TransactionID: txID,
+		Statements:    statements,
 	}
 
-	_, err := c.sendMessage(ctx, msg, 30*time.Second)
-	
-	c.mu.Lock()
-	c.transactionID = ""
-	c.mu.Unlock()
+	response, err := c.sendMessage(ctx, msg, 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
 
-	return err
+	var payload struct {
+		Results []*QueryResponse `json:"results"`
+	}
+	if err := decodeData(response, &payload); err != nil {
+		return nil, fmt.Errorf("failed to parse pipeline response: %w", err)
+	}
+
+	n := len(payload.Results)
+	if n > len(statements) || n == 0 || (n < len(statements) && payload.Results[n-1].Success) {
+		return nil, &ProtocolError{
+			Version: c.ProtocolVersion(),
+			Reason:  fmt.Sprintf("pipeline of %d statements answered with %d results", len(statements), n),
+		}
+	}
+	return payload.Results, nil
+}
+
+// Commit commits the transaction
+func (c *TransactionClient) Commit(ctx context.Context) error {
+	return c.finish(ctx, FrameCommit)
 }
 
 // Rollback rolls back the transaction
 func (c *TransactionClient) Rollback(ctx context.Context) error {
+	return c.finish(ctx, FrameRollback)
+}
+
+// Close closes the WebSocket connection the client owns. A client sharing
+// its connection only forgets its transaction, leaving the connection to
+// the others.
+func (c *TransactionClient) Close() error {
+	if c.owned {
+		err := c.conn.Close()
+		c.reset()
+		return err
+	}
 	c.mu.RLock()
 	txID := c.transactionID
 	c.mu.RUnlock()
+	if txID != "" {
+		c.conn.unregister(txID)
+	}
+	c.reset()
+	return nil
+}
 
+// reset forgets the transaction after its connection was lost or closed
+func (c *TransactionClient) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.transactionID = ""
+	c.state = stateIdle
+	c.stopHeartbeat()
+}
+
+// finish ends the active transaction with a commit or rollback frame
+func (c *TransactionClient) finish(ctx context.Context, frame FrameType) error {
+	c.mu.Lock()
+	txID := c.transactionID
 	if txID == "" {
-		return nil // Nothing to rollback
+		expired := c.expired
+		c.mu.Unlock()
+		if expired && frame == FrameCommit {
+			return ErrTransactionExpired
+		}
+		return nil // Nothing to finish
 	}
+	if !c.state.allowed(frame) {
+		state := c.state
+		c.mu.Unlock()
+		return fmt.Errorf("cannot %s: transaction is %s", frame, state)
+	}
+	c.state = stateFinishing
+	c.stopHeartbeat()
+	c.mu.Unlock()
 
 	msg := Message{
-		Type:          "rollback",
+		Type:          frame,
 		ID:            generateID(),
 		TransactionID: txID,
 	}
 
 	_, err := c.sendMessage(ctx, msg, 30*time.Second)
-	
+
 	c.mu.Lock()
 	c.transactionID = ""
+	c.state = stateIdle
 	c.mu.Unlock()
+	c.conn.unregister(txID)
 
 	return err
 }
 
-// Close closes the WebSocket connection
-func (c *TransactionClient) Close() error {
+// transition moves the session to next if a frame of type t may be sent now
+func (c *TransactionClient) transition(t FrameType, next txState) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if !c.connected || c.conn == nil {
-		return nil
+	if !c.state.allowed(t) {
+		return fmt.Errorf("cannot %s: transaction is %s", t, c.state)
 	}
+	c.state = next
+	return nil
+}
 
-	close(c.closeCh)
-	err := c.conn.Close()
-	c.connected = false
-	c.conn = nil
-	c.transactionID = ""
-
-	return err
+func (c *TransactionClient) setState(state txState) {
+	c.mu.Lock()
+	c.state = state
+	c.mu.Unlock()
 }
 
+// sendMessage sends a frame of the transaction once its previous frame was
+// answered, so the server sees them in order
 func (c *TransactionClient) sendMessage(ctx context.Context, msg Message, timeout time.Duration) (interface{}, error) {
-	c.mu.RLock()
-	if !c.connected || c.conn == nil {
-		c.mu.RUnlock()
-		return nil, fmt.Errorf("not connected")
-	}
-	c.mu.RUnlock()
-
-	// Create handler for this message
-	handler := &messageHandler{
-		responseCh: make(chan interface{}, 1),
-		errorCh:    make(chan error, 1),
-		timeout:    time.NewTimer(timeout),
-	}
+	c.order.Lock()
+	defer c.order.Unlock()
 
 	c.mu.Lock()
-	c.handlers[msg.ID] = handler
+	c.lastActivity = time.Now()
 	c.mu.Unlock()
+	return c.conn.sendMessage(ctx, msg, timeout)
+}
 
-	defer func() {
-		c.mu.Lock()
-		delete(c.handlers, msg.ID)
-		c.mu.Unlock()
-		handler.timeout.Stop()
-	}()
+// IsConnected reports whether the WebSocket connection is open
+func (c *TransactionClient) IsConnected() bool {
+	return c.conn.IsConnected()
+}
 
-	// Send message
-	c.mu.RLock()
-	err := c.conn.WriteJSON(msg)
-	c.mu.RUnlock()
-	
+// decodeData re-decodes the data of a response frame into v, keeping numbers
+// as json.Number
+func decodeData(data interface{}, v interface{}) error {
+	encoded, err := json.Marshal(data)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send message: %w", err)
-	}
-
-	// Wait for response
-	select {
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	case <-handler.timeout.C:
-		return nil, fmt.Errorf("message timeout")
-	case err := <-handler.errorCh:
-		return nil, err
-	case resp := <-handler.responseCh:
-		return resp, nil
+		return err
 	}
+	dec := json.NewDecoder(bytes.NewReader(encoded))
+	dec.UseNumber()
+	return dec.Decode(v)
 }
 
-func (c *TransactionClient) handleMessages() {
-	for {
-		select {
-		case <-c.closeCh:
-			return
-		default:
-		}
-
-		c.mu.RLock()
-		conn := c.conn
-		c.mu.RUnlock()
-
-		if conn == nil {
-			return
-		}
-
-		var msg Message
-		err := conn.ReadJSON(&msg)
-		if err != nil {
-			// Connection closed or error
-			return
-		}
-
-		c.mu.RLock()
-		handler, ok := c.handlers[msg.ID]
-		c.mu.RUnlock()
-
-		if !ok {
-			continue
-		}
-
-		if msg.Error != nil {
-			handler.errorCh <- fmt.Errorf("server error: %v", msg.Error)
-		} else {
-			handler.responseCh <- msg.Data
-		}
+// readFrame reads the next frame from conn. Numbers are decoded as
+// json.Number so DECIMAL and BIGINT values survive without float rounding.
+func readFrame(conn *websocket.Conn, msg *Message) error {
+	_, r, err := conn.NextReader()
+	if err != nil {
+		return err
 	}
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	return dec.Decode(msg)
 }
 
 var idCounter = uint64(0)
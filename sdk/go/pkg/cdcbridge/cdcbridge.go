@@ -0,0 +1,162 @@
+// Package cdcbridge publishes WorkerSQL change events to a message broker
+// such as Kafka or NATS, so downstream systems consume changes without
+// polling the database themselves.
+//
+// The bridge reads the shards' change logs with Client.WatchChanges and
+// hands each batch to a Producer wrapping the broker's client:
+//
+//	bridge, err := cdcbridge.New(client, cdcbridge.Config{
+//		Producer: cdcbridge.ProducerFunc(func(ctx context.Context, msgs []cdcbridge.Message) error {
+//			kmsgs := make([]kafka.Message, len(msgs))
+//			for i, m := range msgs {
+//				kmsgs[i] = kafka.Message{Topic: m.Topic, Key: []byte(m.Key), Value: m.Value}
+//			}
+//			return writer.WriteMessages(ctx, kmsgs...)
+//		}),
+//		Feed: workersql.ChangeFeedOptions{After: loadOffsets(), OnCommit: saveOffsets},
+//	})
+//	err = bridge.Run(ctx)
+//
+// Delivery is at least once: offsets only move past a batch once Publish
+// has returned nil for it, and a failed batch is published again, so
+// consumers should deduplicate by the message's shard and change ID.
+// Messages with the same Key are published in change order; a Producer
+// must preserve it, e.g. by partitioning on the key.
+package cdcbridge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+)
+
+// DefaultTopic is the topic or subject messages are published to
+const DefaultTopic = "workersql.changes"
+
+// Message is a change event to publish
+type Message struct {
+	// Topic is the Kafka topic or NATS subject
+	Topic string
+	// Key orders messages: those with the same key must be delivered in
+	// order, such as by publishing them to the same Kafka partition
+	Key string
+	// Value is the change event encoded as JSON
+	Value []byte
+	// Headers carry the shard, change ID, type and table of the event
+	Headers map[string]string
+	// Event is the change event Value was encoded from
+	Event workersql.ChangeEvent
+}
+
+// Producer publishes messages to a broker. Publish returns once every
+// message has been acknowledged, or with an error if any may not have
+// been; the whole batch is then published again.
+type Producer interface {
+	Publish(ctx context.Context, msgs []Message) error
+}
+
+// ProducerFunc adapts a function to a Producer
+type ProducerFunc func(ctx context.Context, msgs []Message) error
+
+// Publish calls f
+func (f ProducerFunc) Publish(ctx context.Context, msgs []Message) error {
+	return f(ctx, msgs)
+}
+
+// Config configures a Bridge
+type Config struct {
+	// Producer publishes the messages
+	Producer Producer
+	// Topic returns the topic or subject of an event (default: DefaultTopic
+	// for every event)
+	Topic func(workersql.ChangeEvent) string
+	// Key returns the ordering key of an event (default: its tenant and
+	// table, so each table's changes stay in order)
+	Key func(workersql.ChangeEvent) string
+	// Feed selects the shards and tables to bridge, where to resume from,
+	// and receives the offsets to persist through OnCommit
+	Feed workersql.ChangeFeedOptions
+}
+
+// Stats counts the work of a Bridge
+type Stats struct {
+	// Published is the number of messages published, retries included
+	Published int64
+	// Failures is the number of batches the producer failed to publish
+	Failures int64
+}
+
+// Bridge publishes change events to a broker
+type Bridge struct {
+	client    *workersql.Client
+	config    Config
+	published int64
+	failures  int64
+}
+
+// New returns a bridge publishing the changes read with client
+func New(client *workersql.Client, config Config) (*Bridge, error) {
+	if client == nil {
+		return nil, fmt.Errorf("cdcbridge: client is required")
+	}
+	if config.Producer == nil {
+		return nil, fmt.Errorf("cdcbridge: Producer is required")
+	}
+	if config.Topic == nil {
+		config.Topic = func(workersql.ChangeEvent) string { return DefaultTopic }
+	}
+	if config.Key == nil {
+		config.Key = TableKey
+	}
+	return &Bridge{client: client, config: config}, nil
+}
+
+// TableKey is the default ordering key: the event's tenant and table
+func TableKey(event workersql.ChangeEvent) string {
+	if event.TenantID == "" {
+		return event.Table
+	}
+	return event.TenantID + "/" + event.Table
+}
+
+// Run publishes change events until ctx is done, then returns ctx.Err()
+func (b *Bridge) Run(ctx context.Context) error {
+	return b.client.WatchChanges(ctx, b.config.Feed, b.publish)
+}
+
+// Stats returns the bridge's counters
+func (b *Bridge) Stats() Stats {
+	return Stats{Published: atomic.LoadInt64(&b.published), Failures: atomic.LoadInt64(&b.failures)}
+}
+
+func (b *Bridge) publish(ctx context.Context, events []workersql.ChangeEvent) error {
+	msgs := make([]Message, len(events))
+	for i, event := range events {
+		value, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("cdcbridge: change %d: %w", event.ID, err)
+		}
+		msgs[i] = Message{
+			Topic: b.config.Topic(event),
+			Key:   b.config.Key(event),
+			Value: value,
+			Headers: map[string]string{
+				"workersql-shard":     event.Shard,
+				"workersql-change-id": strconv.FormatInt(event.ID, 10),
+				"workersql-type":      event.Type,
+				"workersql-table":     event.Table,
+			},
+			Event: event,
+		}
+	}
+	if err := b.config.Producer.Publish(ctx, msgs); err != nil {
+		atomic.AddInt64(&b.failures, 1)
+		return fmt.Errorf("cdcbridge: publish: %w", err)
+	}
+	atomic.AddInt64(&b.published, int64(len(msgs)))
+	return nil
+}
@@ -0,0 +1,351 @@
+// Package faultinject makes a WorkerSQL client's connections fail the way
+// an edge gateway's do in production: slow responses, connections reset
+// mid-request, 5xx answers, truncated JSON bodies and WebSocket
+// transactions cut off. Each fault strikes with a configured probability,
+// so applications can check their retry, timeout and fallback handling
+// against failures that are otherwise hard to reproduce:
+//
+//	chaos := faultinject.New(faultinject.Config{DropRate: 0.1, ServerErrorRate: 0.05})
+//	client, _ := workersql.NewClient(chaos.Apply(config))
+package faultinject
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+)
+
+// DefaultServerErrorStatus is the status of injected server errors
+const DefaultServerErrorStatus = http.StatusServiceUnavailable
+
+// DefaultWSDisconnectWindow bounds the life of a WebSocket connection
+// doomed to be cut when Config.WSDisconnectAfter is zero
+const DefaultWSDisconnectWindow = time.Second
+
+// Config sets the probability of each fault, from 0 (never) to 1 (always)
+type Config struct {
+	// Seed seeds the random draws, so a failing run can be replayed. Zero
+	// seeds from the clock.
+	Seed int64
+
+	// Latency delays requests and dials, with probability LatencyRate,
+	// before any other fault strikes. The delay ends early with the
+	// request's context.
+	Latency     time.Duration
+	LatencyRate float64
+
+	// A request suffers at most one of the following faults, so their
+	// rates add up to at most 1.
+
+	// DropRate is the probability of a request reaching the gateway and
+	// its connection being reset before the response arrives, as a
+	// "connection reset by peer" error
+	DropRate float64
+	// ServerErrorRate is the probability of a request being answered with
+	// ServerErrorStatus (default: 503) and ServerErrorBody without
+	// reaching the gateway
+	ServerErrorRate   float64
+	ServerErrorStatus int
+	// ServerErrorBody is the body of injected server errors, as plain
+	// text. Empty gives a short description of the fault; a JSON error
+	// like {"code":"CONNECTION_ERROR","message":"..."} is reported the way
+	// the gateway's own errors are.
+	ServerErrorBody string
+	// MalformedJSONRate is the probability of the gateway's response body
+	// being cut in half, as by a proxy giving up mid-response
+	MalformedJSONRate float64
+
+	// WSDisconnectRate is the probability of a WebSocket connection being
+	// reset WSDisconnectAfter after it was dialed, or at a random point
+	// within its first second when that is zero
+	WSDisconnectRate  float64
+	WSDisconnectAfter time.Duration
+
+	// Match, if set, picks the requests faults may strike, e.g. only
+	// those to /query; the others pass through untouched
+	Match func(req *http.Request) bool
+}
+
+// Stats counts the faults an Injector injected
+type Stats struct {
+	Requests     int64 `json:"requests"`
+	Delayed      int64 `json:"delayed"`
+	Dropped      int64 `json:"dropped"`
+	ServerErrors int64 `json:"serverErrors"`
+	Malformed    int64 `json:"malformed"`
+	Dials        int64 `json:"dials"`
+	Disconnects  int64 `json:"disconnects"`
+}
+
+// Injector injects the faults of a Config into the transports and dialers
+// it wraps. It is safe for concurrent use.
+type Injector struct {
+	config   Config
+	disabled int32
+
+	mu   sync.Mutex
+	rand *rand.Rand
+
+	requests     int64
+	delayed      int64
+	dropped      int64
+	serverErrors int64
+	malformed    int64
+	dials        int64
+	disconnects  int64
+}
+
+// New returns an enabled Injector for config
+func New(config Config) *Injector {
+	if config.ServerErrorStatus == 0 {
+		config.ServerErrorStatus = DefaultServerErrorStatus
+	}
+	seed := config.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &Injector{config: config, rand: rand.New(rand.NewSource(seed))}
+}
+
+// SetEnabled turns fault injection on or off, e.g. to check that an
+// application recovers once the gateway is healthy again
+func (i *Injector) SetEnabled(enabled bool) {
+	var disabled int32
+	if !enabled {
+		disabled = 1
+	}
+	atomic.StoreInt32(&i.disabled, disabled)
+}
+
+// Stats returns the faults injected so far
+func (i *Injector) Stats() Stats {
+	return Stats{
+		Requests:     atomic.LoadInt64(&i.requests),
+		Delayed:      atomic.LoadInt64(&i.delayed),
+		Dropped:      atomic.LoadInt64(&i.dropped),
+		ServerErrors: atomic.LoadInt64(&i.serverErrors),
+		Malformed:    atomic.LoadInt64(&i.malformed),
+		Dials:        atomic.LoadInt64(&i.dials),
+		Disconnects:  atomic.LoadInt64(&i.disconnects),
+	}
+}
+
+// Apply returns config with its HTTP transport and WebSocket dialer
+// wrapped by the injector. A Limiter in config is kept behind the
+// injector, as its Transport.
+func (i *Injector) Apply(config workersql.Config) workersql.Config {
+	base := config.Transport
+	if config.Limiter != nil {
+		base = config.Limiter
+		config.Limiter = nil
+	}
+	config.Transport = i.Transport(base)
+	config.Dialer = i.Dial(config.Dialer)
+	return config
+}
+
+// Transport wraps base, http.DefaultTransport when nil, injecting the
+// request faults
+func (i *Injector) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{injector: i, base: base}
+}
+
+// Dial wraps base, a net.Dialer when nil, injecting latency and WebSocket
+// disconnects into the connections it opens
+func (i *Injector) Dial(base func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if base == nil {
+		base = (&net.Dialer{}).DialContext
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if !i.enabled() {
+			return base(ctx, network, addr)
+		}
+		atomic.AddInt64(&i.dials, 1)
+		if err := i.delay(ctx); err != nil {
+			return nil, err
+		}
+		conn, err := base(ctx, network, addr)
+		if err != nil || !i.roll(i.config.WSDisconnectRate) {
+			return conn, err
+		}
+		after := i.config.WSDisconnectAfter
+		if after <= 0 {
+			i.mu.Lock()
+			after = time.Duration(i.rand.Int63n(int64(DefaultWSDisconnectWindow)))
+			i.mu.Unlock()
+		}
+		time.AfterFunc(after, func() {
+			atomic.AddInt64(&i.disconnects, 1)
+			reset(conn)
+		})
+		return conn, nil
+	}
+}
+
+func (i *Injector) enabled() bool {
+	return atomic.LoadInt32(&i.disabled) == 0
+}
+
+// roll reports whether a fault with probability rate strikes
+func (i *Injector) roll(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.rand.Float64() < rate
+}
+
+// delay sleeps for the configured latency when it strikes
+func (i *Injector) delay(ctx context.Context) error {
+	if i.config.Latency <= 0 || !i.roll(i.config.LatencyRate) {
+		return nil
+	}
+	atomic.AddInt64(&i.delayed, 1)
+	timer := time.NewTimer(i.config.Latency)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// fault draws the fault striking a request, if any
+func (i *Injector) fault() fault {
+	i.mu.Lock()
+	r := i.rand.Float64()
+	i.mu.Unlock()
+	for _, f := range []struct {
+		rate  float64
+		fault fault
+	}{
+		{i.config.DropRate, faultDrop},
+		{i.config.ServerErrorRate, faultServerError},
+		{i.config.MalformedJSONRate, faultMalformed},
+	} {
+		if f.rate <= 0 {
+			continue
+		}
+		if r < f.rate {
+			return f.fault
+		}
+		r -= f.rate
+	}
+	return faultNone
+}
+
+type fault int
+
+const (
+	faultNone fault = iota
+	faultDrop
+	faultServerError
+	faultMalformed
+)
+
+type transport struct {
+	injector *Injector
+	base     http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	i := t.injector
+	if !i.enabled() || (i.config.Match != nil && !i.config.Match(req)) {
+		return t.base.RoundTrip(req)
+	}
+	atomic.AddInt64(&i.requests, 1)
+	if err := i.delay(req.Context()); err != nil {
+		return nil, err
+	}
+
+	switch i.fault() {
+	case faultServerError:
+		atomic.AddInt64(&i.serverErrors, 1)
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return i.serverError(req), nil
+	case faultDrop:
+		resp, err := t.base.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		atomic.AddInt64(&i.dropped, 1)
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+	case faultMalformed:
+		resp, err := t.base.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		atomic.AddInt64(&i.malformed, 1)
+		body = body[:len(body)/2]
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		resp.ContentLength = int64(len(body))
+		resp.Header = resp.Header.Clone()
+		resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+		return resp, nil
+	}
+	return t.base.RoundTrip(req)
+}
+
+// CloseIdleConnections closes the idle connections of the wrapped
+// transport, if it can
+func (t *transport) CloseIdleConnections() {
+	if closer, ok := t.base.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+func (i *Injector) serverError(req *http.Request) *http.Response {
+	status := i.config.ServerErrorStatus
+	body := i.config.ServerErrorBody
+	if body == "" {
+		body = fmt.Sprintf("faultinject: injected %d %s", status, http.StatusText(status))
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "text/plain; charset=utf-8")
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader([]byte(body))),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// reset closes conn abruptly, with a TCP reset where possible
+func reset(conn net.Conn) {
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		_ = tcp.SetLinger(0)
+	}
+	_ = conn.Close()
+}
@@ -0,0 +1,310 @@
+// Package golangmigrate is a golang-migrate database driver running
+// migrations through a WorkerSQL client, so existing migration pipelines
+// can target workersql:// URLs. Importing it registers the workersql
+// scheme:
+//
+//	import (
+//		"github.com/golang-migrate/migrate/v4"
+//		_ "github.com/golang-migrate/migrate/v4/source/file"
+//		_ "github.com/healthfees-org/workersql/sdk/go/pkg/migrate/golangmigrate"
+//	)
+//
+//	m, err := migrate.New("file://migrations", "workersql://api.workersql.com/mydb?apiKey=key")
+//
+// Runs are excluded with a MySQL advisory lock named like the one of
+// golang-migrate's mysql driver, and the version is kept in the same
+// schema_migrations table as that driver and the migrate package.
+package golangmigrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	nurl "net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4/database"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/migrate"
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+)
+
+// DefaultLockTimeout is how long Lock waits for another run by default
+const DefaultLockTimeout = 15 * time.Second
+
+func init() {
+	database.Register("workersql", &Driver{})
+}
+
+// Config configures a Driver
+type Config struct {
+	// MigrationsTable holds the applied version (default:
+	// schema_migrations)
+	MigrationsTable string
+	// DatabaseName is part of the advisory lock name, so runs against
+	// different databases don't exclude each other
+	DatabaseName string
+	// LockTimeout is how long Lock waits while another run holds the lock
+	// (default: 15s)
+	LockTimeout time.Duration
+}
+
+// Driver is a golang-migrate database.Driver for WorkerSQL
+type Driver struct {
+	client *workersql.Client
+	config Config
+	// owned is set when the driver created the client, which Close then
+	// closes
+	owned bool
+
+	mu   sync.Mutex
+	lock *workersql.Lock
+}
+
+// WithInstance returns a driver running migrations through client, for
+// migrate.NewWithDatabaseInstance. The version table is created if needed.
+func WithInstance(client *workersql.Client, config *Config) (database.Driver, error) {
+	if config == nil {
+		config = &Config{}
+	}
+	d := &Driver{client: client, config: *config}
+	if d.config.MigrationsTable == "" {
+		d.config.MigrationsTable = migrate.DefaultTable
+	}
+	if d.config.LockTimeout <= 0 {
+		d.config.LockTimeout = DefaultLockTimeout
+	}
+	if err := d.ensureVersionTable(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Open connects to a workersql:// URL, a WorkerSQL DSN. The
+// x-migrations-table parameter sets Config.MigrationsTable and
+// x-lock-timeout Config.LockTimeout in milliseconds; they are not passed
+// on to the client.
+func (d *Driver) Open(url string) (database.Driver, error) {
+	u, err := nurl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+	query := u.Query()
+	config := &Config{
+		MigrationsTable: query.Get("x-migrations-table"),
+		DatabaseName:    strings.TrimPrefix(u.Path, "/"),
+	}
+	if timeout := query.Get("x-lock-timeout"); timeout != "" {
+		ms, err := strconv.Atoi(timeout)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse x-lock-timeout: %w", err)
+		}
+		config.LockTimeout = time.Duration(ms) * time.Millisecond
+	}
+	for name := range query {
+		if strings.HasPrefix(name, "x-") {
+			query.Del(name)
+		}
+	}
+	u.RawQuery = query.Encode()
+
+	client, err := workersql.NewClient(u.String())
+	if err != nil {
+		return nil, err
+	}
+	driver, err := WithInstance(client, config)
+	if err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	driver.(*Driver).owned = true
+	return driver, nil
+}
+
+// Close releases the lock if held, and closes the client when Open
+// created it
+func (d *Driver) Close() error {
+	d.mu.Lock()
+	lock := d.lock
+	d.lock = nil
+	d.mu.Unlock()
+
+	var err error
+	if lock != nil {
+		err = lock.Release(context.Background())
+	}
+	if d.owned {
+		err = errors.Join(err, d.client.Close())
+	}
+	return err
+}
+
+// Lock takes the advisory lock excluding other runs, returning
+// database.ErrLocked if it is still held after Config.LockTimeout
+func (d *Driver) Lock() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.lock != nil {
+		return database.ErrLocked
+	}
+	name, err := database.GenerateAdvisoryLockId(d.config.DatabaseName, d.config.MigrationsTable)
+	if err != nil {
+		return err
+	}
+	lock, err := d.client.AcquireLock(context.Background(), name, d.config.LockTimeout)
+	if errors.Is(err, workersql.ErrLockTimeout) {
+		return database.ErrLocked
+	}
+	if err != nil {
+		return &database.Error{OrigErr: err, Err: "try lock failed"}
+	}
+	d.lock = lock
+	return nil
+}
+
+// Unlock releases the advisory lock
+func (d *Driver) Unlock() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.lock == nil {
+		return database.ErrNotLocked
+	}
+	lock := d.lock
+	d.lock = nil
+	if err := lock.Release(context.Background()); err != nil {
+		return &database.Error{OrigErr: err, Err: "release lock failed"}
+	}
+	return nil
+}
+
+// Run executes the statements of migration one by one, as split by
+// migrate.SplitStatements
+func (d *Driver) Run(migration io.Reader) error {
+	body, err := io.ReadAll(migration)
+	if err != nil {
+		return err
+	}
+	for _, statement := range migrate.SplitStatements(string(body)) {
+		resp, err := d.client.Exec(context.Background(), statement)
+		if err := checkExec(resp, err); err != nil {
+			return database.Error{OrigErr: err, Err: "migration failed", Query: []byte(statement)}
+		}
+	}
+	return nil
+}
+
+// SetVersion replaces the version row in a transaction
+func (d *Driver) SetVersion(version int, dirty bool) error {
+	table := quoteIdent(d.config.MigrationsTable)
+	err := d.client.Transaction(context.Background(), func(ctx context.Context, tx *workersql.TransactionClient) error {
+		resp, err := tx.Exec(ctx, "DELETE FROM "+table)
+		if err := checkExec(resp, err); err != nil {
+			return err
+		}
+		// Also re-write the schema version for nil dirty versions to
+		// prevent empty schema version for failed down migration on the
+		// first migration, as the mysql driver does
+		if version >= 0 || (version == database.NilVersion && dirty) {
+			resp, err := tx.Exec(ctx, "INSERT INTO "+table+" (version, dirty) VALUES (?, ?)", version, dirty)
+			return checkExec(resp, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return &database.Error{OrigErr: err, Err: "setting version failed"}
+	}
+	return nil
+}
+
+// Version returns the applied version, database.NilVersion when none is
+func (d *Driver) Version() (version int, dirty bool, err error) {
+	query := "SELECT version, dirty FROM " + quoteIdent(d.config.MigrationsTable) + " LIMIT 1"
+	resp, err := d.client.Query(context.Background(), query)
+	if err := check(resp, err); err != nil {
+		return 0, false, &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	if len(resp.Data) == 0 {
+		return database.NilVersion, false, nil
+	}
+	var row struct {
+		Version int  `db:"version"`
+		Dirty   bool `db:"dirty"`
+	}
+	if err := workersql.ScanStruct(resp.Data[0], &row); err != nil {
+		return 0, false, &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	return row.Version, row.Dirty, nil
+}
+
+// Drop drops every table of the database, with foreign key checks off on
+// the transaction's session
+func (d *Driver) Drop() error {
+	return d.client.Transaction(context.Background(), func(ctx context.Context, tx *workersql.TransactionClient) error {
+		if err := tx.Set(ctx, "foreign_key_checks", 0); err != nil {
+			return err
+		}
+		resp, err := tx.Query(ctx, "SHOW TABLES")
+		if err := check(resp, err); err != nil {
+			return &database.Error{OrigErr: err, Query: []byte("SHOW TABLES")}
+		}
+		for _, row := range resp.Data {
+			for _, name := range row {
+				table, ok := name.(string)
+				if !ok {
+					continue
+				}
+				query := "DROP TABLE IF EXISTS " + quoteIdent(table)
+				resp, err := tx.Exec(ctx, query)
+				if err := checkExec(resp, err); err != nil {
+					return &database.Error{OrigErr: err, Query: []byte(query)}
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (d *Driver) ensureVersionTable() error {
+	query := "CREATE TABLE IF NOT EXISTS " + quoteIdent(d.config.MigrationsTable) +
+		" (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)"
+	resp, err := d.client.Exec(context.Background(), query)
+	if err := checkExec(resp, err); err != nil {
+		return &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	return nil
+}
+
+func quoteIdent(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+func check(resp *workersql.QueryResponse, err error) error {
+	if err != nil {
+		return err
+	}
+	if !resp.Success {
+		return responseError(resp.Error)
+	}
+	return nil
+}
+
+func checkExec(resp *workersql.ExecResponse, err error) error {
+	if err != nil {
+		return err
+	}
+	if !resp.Success {
+		return responseError(resp.Error)
+	}
+	return nil
+}
+
+func responseError(e *workersql.ErrorResponse) error {
+	if e == nil {
+		return errors.New("statement failed")
+	}
+	return fmt.Errorf("%s: %s", e.Code, e.Message)
+}
@@ -0,0 +1,379 @@
+// Package migrate evolves WorkerSQL schemas with versioned SQL migrations.
+// Migrations are loaded from files named <version>_<name>.up.sql and
+// <version>_<name>.down.sql, the layout of golang-migrate, and the applied
+// version is kept in a schema_migrations table it can read too. Runs are
+// serialized across processes by a row lock held in a gateway transaction.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+)
+
+// DefaultTable is the table holding the applied version when Options.Table
+// is unset
+const DefaultTable = "schema_migrations"
+
+// ErrDirty matches, with errors.Is, the *DirtyError of runs refused
+// because a migration failed halfway
+var ErrDirty = errors.New("database is dirty")
+
+// DirtyError is returned when a previous run failed during the migration
+// of Version, leaving the schema in an unknown state. Fix the schema by
+// hand, then record the version it is at with Migrator.Force.
+type DirtyError struct {
+	Version int64
+}
+
+func (e *DirtyError) Error() string {
+	return fmt.Sprintf("migration %d failed halfway: fix the schema and call Force", e.Version)
+}
+
+// Is makes the error match ErrDirty
+func (e *DirtyError) Is(target error) bool {
+	return target == ErrDirty
+}
+
+// Migration is one versioned schema change
+type Migration struct {
+	Version int64
+	Name    string
+	// Up and Down hold the statements applying and reverting the change,
+	// separated by semicolons. Down is empty when there is no down file.
+	Up   string
+	Down string
+}
+
+// MigrationStatus is a migration and whether it is applied
+type MigrationStatus struct {
+	Migration
+	Applied bool
+	// Dirty is set on the migration a failed run stopped in
+	Dirty bool
+}
+
+// Options configures a Migrator
+type Options struct {
+	// Table holds the applied version (default: schema_migrations). Runs
+	// are serialized by locking a row of the table named Table + "_lock".
+	Table string
+}
+
+// Migrator applies and reverts migrations
+type Migrator struct {
+	client     *workersql.Client
+	migrations []Migration
+	table      string
+}
+
+var (
+	fileName  = regexp.MustCompile(`^([0-9]+)_(.*)\.(up|down)\.sql$`)
+	tableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// New returns a Migrator for the migrations in the top directory of fsys
+func New(client *workersql.Client, fsys fs.FS, opts Options) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return NewWithMigrations(client, migrations, opts)
+}
+
+// NewWithMigrations returns a Migrator for migrations built in code
+func NewWithMigrations(client *workersql.Client, migrations []Migration, opts Options) (*Migrator, error) {
+	table := opts.Table
+	if table == "" {
+		table = DefaultTable
+	}
+	if !tableName.MatchString(table) {
+		return nil, fmt.Errorf("migrate: invalid table name %q", table)
+	}
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	for i, m := range sorted {
+		if m.Version <= 0 {
+			return nil, fmt.Errorf("migrate: migration %q has version %d, want a positive version", m.Name, m.Version)
+		}
+		if i > 0 && sorted[i-1].Version == m.Version {
+			return nil, fmt.Errorf("migrate: duplicate migration version %d", m.Version)
+		}
+	}
+	return &Migrator{client: client, migrations: sorted, table: table}, nil
+}
+
+// Load reads the migrations in the top directory of fsys. Use fs.Sub to
+// load another directory. Every version needs an up file; down files are
+// optional.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("migrate: reading migrations: %w", err)
+	}
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migrate: %s: invalid version: %w", entry.Name(), err)
+		}
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("migrate: reading %s: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migrate: version %d is named both %q and %q", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if strings.TrimSpace(m.Up) == "" {
+			return nil, fmt.Errorf("migrate: migration %d_%s has no up statements", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Up applies the migrations after the current version in order. It does
+// nothing when they are all applied.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.locked(ctx, func(version int64) error {
+		for _, migration := range m.migrations {
+			if migration.Version <= version {
+				continue
+			}
+			if err := m.run(ctx, migration.Version, migration.Up, migration.Version); err != nil {
+				return fmt.Errorf("migrate: applying %d_%s: %w", migration.Version, migration.Name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// Down reverts the latest applied migration. It does nothing when none is
+// applied.
+func (m *Migrator) Down(ctx context.Context) error {
+	return m.locked(ctx, func(version int64) error {
+		if version == 0 {
+			return nil
+		}
+		i := m.find(version)
+		if i < 0 {
+			return fmt.Errorf("migrate: applied version %d has no migration", version)
+		}
+		migration := m.migrations[i]
+		if strings.TrimSpace(migration.Down) == "" {
+			return fmt.Errorf("migrate: migration %d_%s has no down statements", migration.Version, migration.Name)
+		}
+		var previous int64
+		if i > 0 {
+			previous = m.migrations[i-1].Version
+		}
+		if err := m.run(ctx, migration.Version, migration.Down, previous); err != nil {
+			return fmt.Errorf("migrate: reverting %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		return nil
+	})
+}
+
+// Status returns every migration and whether it is applied
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	version, dirty, err := m.Version(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status := make([]MigrationStatus, len(m.migrations))
+	for i, migration := range m.migrations {
+		status[i] = MigrationStatus{
+			Migration: migration,
+			Applied:   migration.Version <= version && !(dirty && migration.Version == version),
+			Dirty:     dirty && migration.Version == version,
+		}
+	}
+	return status, nil
+}
+
+// Version returns the applied version, zero when none is, and whether a
+// run failed while migrating to or from it
+func (m *Migrator) Version(ctx context.Context) (version int64, dirty bool, err error) {
+	if err := m.ensureTables(ctx); err != nil {
+		return 0, false, err
+	}
+	return m.version(ctx)
+}
+
+func (m *Migrator) version(ctx context.Context) (int64, bool, error) {
+	resp, err := m.client.Query(ctx, "SELECT version, dirty FROM "+m.table+" LIMIT 1")
+	if err := check(resp, err); err != nil {
+		return 0, false, fmt.Errorf("migrate: reading version: %w", err)
+	}
+	if len(resp.Data) == 0 {
+		return 0, false, nil
+	}
+	var row struct {
+		Version int64 `db:"version"`
+		Dirty   bool  `db:"dirty"`
+	}
+	if err := workersql.ScanStruct(resp.Data[0], &row); err != nil {
+		return 0, false, fmt.Errorf("migrate: reading version: %w", err)
+	}
+	return row.Version, row.Dirty, nil
+}
+
+// Force records version as applied and clean without running anything, to
+// recover from a dirty state once the schema has been fixed by hand. Zero
+// records that no migration is applied.
+func (m *Migrator) Force(ctx context.Context, version int64) error {
+	if version < 0 {
+		return fmt.Errorf("migrate: invalid version %d", version)
+	}
+	return m.withLock(ctx, func() error {
+		return m.setVersion(ctx, version, false)
+	})
+}
+
+// locked runs fn under the migration lock with the applied version,
+// refusing to when the database is dirty
+func (m *Migrator) locked(ctx context.Context, fn func(version int64) error) error {
+	return m.withLock(ctx, func() error {
+		version, dirty, err := m.version(ctx)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return &DirtyError{Version: version}
+		}
+		return fn(version)
+	})
+}
+
+// withLock runs fn while holding the lock row in a transaction, which
+// other migrators wait for until their context ends
+func (m *Migrator) withLock(ctx context.Context, fn func() error) error {
+	if err := m.ensureTables(ctx); err != nil {
+		return err
+	}
+	tx, err := m.client.BeginTx(ctx)
+	if err != nil {
+		return fmt.Errorf("migrate: taking lock: %w", err)
+	}
+	// The lock transaction writes nothing; ending it releases the lock
+	defer func() { _ = tx.Rollback(context.WithoutCancel(ctx)) }()
+	resp, err := tx.QueryForUpdate(ctx, "SELECT id FROM "+m.table+"_lock WHERE id = 1")
+	if err := check(resp, err); err != nil {
+		return fmt.Errorf("migrate: taking lock: %w", err)
+	}
+	return fn()
+}
+
+// ensureTables creates the version and lock tables if needed
+func (m *Migrator) ensureTables(ctx context.Context) error {
+	for _, sql := range []string{
+		"CREATE TABLE IF NOT EXISTS " + m.table + " (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)",
+		"CREATE TABLE IF NOT EXISTS " + m.table + "_lock (id INT NOT NULL PRIMARY KEY)",
+		"INSERT IGNORE INTO " + m.table + "_lock (id) VALUES (1)",
+	} {
+		resp, err := m.client.Exec(ctx, sql)
+		if err := checkExec(resp, err); err != nil {
+			return fmt.Errorf("migrate: creating tables: %w", err)
+		}
+	}
+	return nil
+}
+
+// run marks version dirty, runs the statements of body and records target
+// as the clean version
+func (m *Migrator) run(ctx context.Context, version int64, body string, target int64) error {
+	if err := m.setVersion(ctx, version, true); err != nil {
+		return err
+	}
+	for _, statement := range SplitStatements(body) {
+		resp, err := m.client.Exec(ctx, statement)
+		if err := checkExec(resp, err); err != nil {
+			return err
+		}
+	}
+	return m.setVersion(ctx, target, false)
+}
+
+// setVersion replaces the version row in a transaction of its own
+func (m *Migrator) setVersion(ctx context.Context, version int64, dirty bool) error {
+	err := m.client.Transaction(ctx, func(ctx context.Context, tx *workersql.TransactionClient) error {
+		resp, err := tx.Exec(ctx, "DELETE FROM "+m.table)
+		if err := checkExec(resp, err); err != nil {
+			return err
+		}
+		if version == 0 {
+			return nil
+		}
+		resp, err = tx.Exec(ctx, "INSERT INTO "+m.table+" (version, dirty) VALUES (?, ?)", version, dirty)
+		return checkExec(resp, err)
+	})
+	if err != nil {
+		return fmt.Errorf("recording version %d: %w", version, err)
+	}
+	return nil
+}
+
+func (m *Migrator) find(version int64) int {
+	for i, migration := range m.migrations {
+		if migration.Version == version {
+			return i
+		}
+	}
+	return -1
+}
+
+func check(resp *workersql.QueryResponse, err error) error {
+	if err != nil {
+		return err
+	}
+	if !resp.Success {
+		return responseError(resp.Error)
+	}
+	return nil
+}
+
+func checkExec(resp *workersql.ExecResponse, err error) error {
+	if err != nil {
+		return err
+	}
+	if !resp.Success {
+		return responseError(resp.Error)
+	}
+	return nil
+}
+
+func responseError(e *workersql.ErrorResponse) error {
+	if e == nil {
+		return errors.New("statement failed")
+	}
+	return fmt.Errorf("%s: %s", e.Code, e.Message)
+}
@@ -0,0 +1,67 @@
+package migrate
+
+import "strings"
+
+// SplitStatements splits a migration body into its statements at
+// semicolons outside quotes and comments, dropping empty ones. The
+// gateway runs one statement per request.
+func SplitStatements(body string) []string {
+	var statements []string
+	start := 0
+	add := func(end int) {
+		if s := strings.TrimSpace(body[start:end]); s != "" && !onlyComments(s) {
+			statements = append(statements, s)
+		}
+	}
+	for i := 0; i < len(body); i++ {
+		switch c := body[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			// Skip to the closing quote; backslashes escape within strings
+			for i++; i < len(body) && body[i] != c; i++ {
+				if body[i] == '\\' && c != '`' {
+					i++
+				}
+			}
+		case c == '#' || (c == '-' && strings.HasPrefix(body[i:], "-- ")):
+			for i < len(body) && body[i] != '\n' {
+				i++
+			}
+		case c == '/' && strings.HasPrefix(body[i:], "/*"):
+			end := strings.Index(body[i+2:], "*/")
+			if end < 0 {
+				i = len(body)
+			} else {
+				i += end + 3
+			}
+		case c == ';':
+			add(i)
+			start = i + 1
+		}
+	}
+	add(len(body))
+	return statements
+}
+
+// onlyComments reports whether s, trimmed, holds nothing but comments
+func onlyComments(s string) bool {
+	for s != "" {
+		switch {
+		case strings.HasPrefix(s, "#"), strings.HasPrefix(s, "--"):
+			i := strings.IndexByte(s, '\n')
+			if i < 0 {
+				return true
+			}
+			s = s[i+1:]
+		case strings.HasPrefix(s, "/*"):
+			i := strings.Index(s, "*/")
+			if i < 0 {
+				return true
+			}
+			s = s[i+2:]
+		default:
+			return false
+		}
+		s = strings.TrimSpace(s)
+	}
+	return true
+}
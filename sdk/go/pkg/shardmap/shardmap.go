@@ -0,0 +1,249 @@
+// Package shardmap routes WorkerSQL queries to shards on the client side.
+// It loads the platform's shard configuration YAML (tables, their shard key
+// columns and the routing policy), computes the shard owning each statement
+// from its parameters the way the gateway does, and sends the statement
+// straight to that shard's endpoint. The map is reloaded when its files or
+// the control plane's routing version change.
+package shardmap
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+)
+
+// DefaultReloadInterval is how often the map is checked for changes when
+// Options.ReloadInterval is unset
+const DefaultReloadInterval = 30 * time.Second
+
+// Options configures a Router
+type Options struct {
+	// Tenant is the tenant statements are routed for, unless the context
+	// carries another one (see WithTenant)
+	Tenant string
+	// ReloadInterval is how often the map files and Version are checked for
+	// changes (default: 30s). A negative value disables hot reload.
+	ReloadInterval time.Duration
+	// Version, if set, returns the control plane's current routing policy
+	// version; the map is reloaded whenever it changes
+	Version func(ctx context.Context) (int, error)
+	// OnReload, if set, is called after every reload attempt triggered by a
+	// change, with the error if the new map was rejected. The previous map
+	// stays in use until a reload succeeds.
+	OnReload func(config *workersql.ShardingConfig, err error)
+}
+
+// Router routes statements to the shard owning their rows. The client must
+// have the endpoint of every shard in Config.Shards.
+type Router struct {
+	client *workersql.Client
+	dir    string
+	opts   Options
+
+	mu      sync.RWMutex
+	config  *workersql.ShardingConfig
+	version int
+	// seen identifies the map files and routing version last loaded or
+	// rejected, so a rejected map isn't retried until it changes again
+	seen string
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+type tenantKey struct{}
+
+// WithTenant routes statements made with ctx for tenant instead of
+// Options.Tenant
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// Load reads the shard map in dir, laid out as workersql.LoadShardingConfig
+// expects, and starts watching it for changes. Close stops watching.
+func Load(client *workersql.Client, dir string, opts Options) (*Router, error) {
+	if opts.ReloadInterval == 0 {
+		opts.ReloadInterval = DefaultReloadInterval
+	}
+	r := &Router{client: client, dir: dir, opts: opts, stop: make(chan struct{})}
+	if err := r.Reload(context.Background()); err != nil {
+		return nil, err
+	}
+	if opts.ReloadInterval > 0 {
+		r.wg.Add(1)
+		go r.watch()
+	}
+	return r, nil
+}
+
+// Config returns the shard map in use
+func (r *Router) Config() *workersql.ShardingConfig {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.config
+}
+
+// Version returns the control plane routing version the map was last
+// loaded at, 0 without Options.Version
+func (r *Router) Version() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.version
+}
+
+// Reload reads the shard map again, keeping the current one if the new one
+// is invalid
+func (r *Router) Reload(ctx context.Context) error {
+	version, err := r.controlPlaneVersion(ctx)
+	if err != nil {
+		return err
+	}
+	fingerprint, err := r.files()
+	if err != nil {
+		return fmt.Errorf("shardmap: %w", err)
+	}
+	config, err := workersql.LoadShardingConfig(r.dir)
+	if err != nil {
+		return fmt.Errorf("shardmap: %w", err)
+	}
+
+	r.mu.Lock()
+	r.config = config
+	r.version = version
+	r.seen = stamp(fingerprint, version)
+	r.mu.Unlock()
+	return nil
+}
+
+// Shard returns the shard owning the rows sql reads or writes with params,
+// for tenant
+func (r *Router) Shard(tenant string, sql string, params ...interface{}) string {
+	config := r.Config()
+	table, key, _ := config.RoutingKey(sql, params...)
+	return config.ShardFor(tenant, table, key)
+}
+
+// Query runs a query on the shard owning its rows
+func (r *Router) Query(ctx context.Context, sql string, params ...interface{}) (*workersql.QueryResponse, error) {
+	shard := r.Shard(r.tenant(ctx), sql, params...)
+	return r.client.QueryShard(ctx, shard, sql, params...)
+}
+
+// Exec executes a statement on the shard owning its rows
+func (r *Router) Exec(ctx context.Context, sql string, params ...interface{}) (*workersql.ExecResponse, error) {
+	shard := r.Shard(r.tenant(ctx), sql, params...)
+	return r.client.ExecShard(ctx, shard, sql, params...)
+}
+
+// Close stops watching the shard map for changes
+func (r *Router) Close() {
+	r.stopOnce.Do(func() { close(r.stop) })
+	r.wg.Wait()
+}
+
+func (r *Router) tenant(ctx context.Context) string {
+	if tenant, ok := ctx.Value(tenantKey{}).(string); ok {
+		return tenant
+	}
+	return r.opts.Tenant
+}
+
+func (r *Router) controlPlaneVersion(ctx context.Context) (int, error) {
+	if r.opts.Version == nil {
+		return 0, nil
+	}
+	version, err := r.opts.Version(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("shardmap: routing version: %w", err)
+	}
+	return version, nil
+}
+
+// watch reloads the map whenever its files or the routing version change
+func (r *Router) watch() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(r.opts.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+		seen, changed := r.changed()
+		if !changed {
+			continue
+		}
+		err := r.Reload(context.Background())
+		if err != nil {
+			r.mu.Lock()
+			r.seen = seen
+			r.mu.Unlock()
+		}
+		if r.opts.OnReload != nil {
+			r.opts.OnReload(r.Config(), err)
+		}
+	}
+}
+
+// changed reports whether the map files or routing version differ from
+// those last seen
+func (r *Router) changed() (string, bool) {
+	fingerprint, err := r.files()
+	if err != nil {
+		return "", false
+	}
+	version, err := r.controlPlaneVersion(context.Background())
+	if err != nil {
+		return "", false
+	}
+	current := stamp(fingerprint, version)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return current, current != r.seen
+}
+
+func stamp(fingerprint string, version int) string {
+	return fmt.Sprintf("%s@%d", fingerprint, version)
+}
+
+// files fingerprints the names, sizes and modification times of the map's
+// YAML files
+func (r *Router) files() (string, error) {
+	var fingerprint string
+	for _, dir := range []string{r.dir, filepath.Join(r.dir, "table-policies")} {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if dir != r.dir && os.IsNotExist(err) {
+				continue
+			}
+			return "", err
+		}
+		for _, entry := range entries {
+			ext := filepath.Ext(entry.Name())
+			if entry.IsDir() || (ext != ".yaml" && ext != ".yml") {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				if os.IsNotExist(err) {
+					continue
+				}
+				return "", err
+			}
+			fingerprint += fileStamp(dir, info)
+		}
+	}
+	return fingerprint, nil
+}
+
+func fileStamp(dir string, info fs.FileInfo) string {
+	return fmt.Sprintf("%s/%s:%d:%d;", dir, info.Name(), info.Size(), info.ModTime().UnixNano())
+}
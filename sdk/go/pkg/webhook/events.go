@@ -0,0 +1,118 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Event types sent by the gateway
+const (
+	TypeBackupCompleted = "backup.completed"
+	TypeSchemaChanged   = "schema.changed"
+	TypeQuotaWarning    = "quota.warning"
+)
+
+// ErrUnknownEventType is returned by Event.Decode for an event type this
+// package doesn't know, such as one added to the gateway later
+var ErrUnknownEventType = errors.New("webhook: unknown event type")
+
+// Event is a platform event delivered by the gateway
+type Event struct {
+	// ID identifies the event; redeliveries carry the same ID
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"createdAt"`
+	TenantID  string    `json:"tenantId,omitempty"`
+	// Data is the payload of the event, decoded by Decode
+	Data json.RawMessage `json:"data"`
+}
+
+// BackupCompleted is the payload of a backup.completed event
+type BackupCompleted struct {
+	BackupID string `json:"backupId"`
+	// Status is "success" or "failed"
+	Status    string   `json:"status"`
+	Shards    []string `json:"shards,omitempty"`
+	Tables    []string `json:"tables,omitempty"`
+	SizeBytes int64    `json:"sizeBytes"`
+	// Location is where the backup was written, such as an R2 key
+	Location    string    `json:"location,omitempty"`
+	StartedAt   time.Time `json:"startedAt"`
+	CompletedAt time.Time `json:"completedAt"`
+	// Error describes why a failed backup failed
+	Error string `json:"error,omitempty"`
+}
+
+// Succeeded reports whether the backup completed successfully
+func (b *BackupCompleted) Succeeded() bool {
+	return b.Status == "success"
+}
+
+// SchemaChanged is the payload of a schema.changed event
+type SchemaChanged struct {
+	Table string `json:"table"`
+	// Operation is the DDL statement kind, such as "CREATE TABLE" or
+	// "ALTER TABLE"
+	Operation string `json:"operation"`
+	SQL       string `json:"sql"`
+	// Version is the schema version after the change
+	Version int64  `json:"version"`
+	Shard   string `json:"shard,omitempty"`
+}
+
+// QuotaWarning is the payload of a quota.warning event
+type QuotaWarning struct {
+	// Resource is the quota nearing its limit, such as "storage_bytes" or
+	// "requests_per_day"
+	Resource string  `json:"resource"`
+	Used     float64 `json:"used"`
+	Limit    float64 `json:"limit"`
+	// Threshold is the fraction of Limit whose crossing raised the
+	// warning, such as 0.8
+	Threshold float64 `json:"threshold"`
+}
+
+// Fraction returns the share of the quota used
+func (q *QuotaWarning) Fraction() float64 {
+	if q.Limit == 0 {
+		return 0
+	}
+	return q.Used / q.Limit
+}
+
+// Parse decodes the body of a delivery. Verify it first.
+func Parse(payload []byte) (*Event, error) {
+	var event Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("webhook: %w", err)
+	}
+	if event.ID == "" || event.Type == "" {
+		return nil, fmt.Errorf("webhook: event without an id or type")
+	}
+	return &event, nil
+}
+
+// Decode returns the payload of the event as the struct of its type: a
+// *BackupCompleted, *SchemaChanged or *QuotaWarning. Other types return
+// ErrUnknownEventType.
+func (e *Event) Decode() (interface{}, error) {
+	var data interface{}
+	switch e.Type {
+	case TypeBackupCompleted:
+		data = &BackupCompleted{}
+	case TypeSchemaChanged:
+		data = &SchemaChanged{}
+	case TypeQuotaWarning:
+		data = &QuotaWarning{}
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnknownEventType, e.Type)
+	}
+	if len(e.Data) > 0 {
+		if err := json.Unmarshal(e.Data, data); err != nil {
+			return nil, fmt.Errorf("webhook: %s event %s: %w", e.Type, e.ID, err)
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,104 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// DefaultMaxBodyBytes bounds the size of a delivery Handler reads
+const DefaultMaxBodyBytes = 1 << 20
+
+// Handler is an http.Handler receiving deliveries: it verifies them,
+// decodes their event and calls the callback of its type. It answers 401
+// to a delivery failing verification, 400 to one it can't decode, and 500
+// when a callback fails, so the gateway delivers the event again. Events
+// without a callback are acknowledged and dropped.
+type Handler struct {
+	// Verifier checks the signatures of deliveries
+	Verifier *Verifier
+	// OnBackupCompleted, OnSchemaChanged and OnQuotaWarning receive the
+	// events of their type
+	OnBackupCompleted func(ctx context.Context, event *Event, backup *BackupCompleted) error
+	OnSchemaChanged   func(ctx context.Context, event *Event, change *SchemaChanged) error
+	OnQuotaWarning    func(ctx context.Context, event *Event, warning *QuotaWarning) error
+	// OnEvent receives the events without a callback of their own,
+	// including types unknown to this package
+	OnEvent func(ctx context.Context, event *Event) error
+	// OnError is called with deliveries rejected or failed, for logging
+	OnError func(r *http.Request, err error)
+	// MaxBodyBytes bounds the size of a delivery (default: 1 MiB)
+	MaxBodyBytes int64
+}
+
+// ServeHTTP handles a delivery
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	limit := h.MaxBodyBytes
+	if limit <= 0 {
+		limit = DefaultMaxBodyBytes
+	}
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	if err != nil {
+		h.fail(w, r, http.StatusRequestEntityTooLarge, err)
+		return
+	}
+	if h.Verifier == nil {
+		h.fail(w, r, http.StatusInternalServerError, errors.New("webhook: Handler has no Verifier"))
+		return
+	}
+	if err := h.Verifier.Verify(payload, r.Header.Get(SignatureHeader)); err != nil {
+		h.fail(w, r, http.StatusUnauthorized, err)
+		return
+	}
+	event, err := Parse(payload)
+	if err != nil {
+		h.fail(w, r, http.StatusBadRequest, err)
+		return
+	}
+	data, err := event.Decode()
+	if err != nil && !errors.Is(err, ErrUnknownEventType) {
+		h.fail(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.dispatch(r.Context(), event, data); err != nil {
+		h.fail(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// dispatch calls the callback of the event's type with its decoded data
+func (h *Handler) dispatch(ctx context.Context, event *Event, data interface{}) error {
+	switch data := data.(type) {
+	case *BackupCompleted:
+		if h.OnBackupCompleted != nil {
+			return h.OnBackupCompleted(ctx, event, data)
+		}
+	case *SchemaChanged:
+		if h.OnSchemaChanged != nil {
+			return h.OnSchemaChanged(ctx, event, data)
+		}
+	case *QuotaWarning:
+		if h.OnQuotaWarning != nil {
+			return h.OnQuotaWarning(ctx, event, data)
+		}
+	}
+	if h.OnEvent != nil {
+		return h.OnEvent(ctx, event)
+	}
+	return nil
+}
+
+func (h *Handler) fail(w http.ResponseWriter, r *http.Request, status int, err error) {
+	if h.OnError != nil {
+		h.OnError(r, err)
+	}
+	http.Error(w, http.StatusText(status), status)
+}
@@ -0,0 +1,144 @@
+// Package webhook receives WorkerSQL platform events: it verifies the
+// gateway's signature on a delivery, decodes the event into a typed
+// struct, and adapts it all to an http.Handler:
+//
+//	verifier, err := webhook.NewVerifier(webhook.Config{Secrets: []string{os.Getenv("WORKERSQL_WEBHOOK_SECRET")}})
+//	http.Handle("/hooks/workersql", &webhook.Handler{
+//		Verifier: verifier,
+//		OnBackupCompleted: func(ctx context.Context, event *webhook.Event, backup *webhook.BackupCompleted) error {
+//			return recordBackup(ctx, backup)
+//		},
+//	})
+//
+// A delivery is signed with HMAC-SHA256 in the X-WorkerSQL-Signature
+// header, "t=<unix seconds>,v1=<hex signature>", the signature covering
+// the timestamp, a dot and the body. Several v1 values may be sent while a
+// secret is rotated. Deliveries are retried until answered with a 2xx, so
+// an event may arrive more than once; deduplicate by Event.ID.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureHeader carries the signature of a delivery
+const SignatureHeader = "X-WorkerSQL-Signature"
+
+// DefaultTolerance is how far a delivery's timestamp may be from the
+// receiver's clock
+const DefaultTolerance = 5 * time.Minute
+
+var (
+	// ErrMissingSignature is returned for a delivery without a signature
+	ErrMissingSignature = errors.New("webhook: missing signature")
+	// ErrInvalidSignature is returned for a delivery whose signature
+	// matches none of the secrets
+	ErrInvalidSignature = errors.New("webhook: invalid signature")
+	// ErrTimestampOutOfRange is returned for a delivery signed too long
+	// ago, or in the future, to be accepted, as a replay would be
+	ErrTimestampOutOfRange = errors.New("webhook: timestamp outside the tolerance")
+)
+
+// Config configures a Verifier
+type Config struct {
+	// Secrets are the signing secrets accepted. List the new secret
+	// alongside the old one while rotating.
+	Secrets []string
+	// Tolerance is how far a delivery's timestamp may be from now
+	// (default: 5m)
+	Tolerance time.Duration
+	// Now returns the current time (default: time.Now)
+	Now func() time.Time
+}
+
+// Verifier checks the signatures of deliveries
+type Verifier struct {
+	secrets   [][]byte
+	tolerance time.Duration
+	now       func() time.Time
+}
+
+// NewVerifier returns a verifier accepting deliveries signed with any of
+// config.Secrets
+func NewVerifier(config Config) (*Verifier, error) {
+	v := &Verifier{tolerance: config.Tolerance, now: config.Now}
+	for _, secret := range config.Secrets {
+		if secret != "" {
+			v.secrets = append(v.secrets, []byte(secret))
+		}
+	}
+	if len(v.secrets) == 0 {
+		return nil, fmt.Errorf("webhook: at least one secret is required")
+	}
+	if v.tolerance <= 0 {
+		v.tolerance = DefaultTolerance
+	}
+	if v.now == nil {
+		v.now = time.Now
+	}
+	return v, nil
+}
+
+// Verify checks that signature, the value of the SignatureHeader, signs
+// payload with one of the secrets, within the tolerance
+func (v *Verifier) Verify(payload []byte, signature string) error {
+	if signature == "" {
+		return ErrMissingSignature
+	}
+	var timestamp string
+	var signatures [][]byte
+	for _, part := range strings.Split(signature, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			if sig, err := hex.DecodeString(value); err == nil {
+				signatures = append(signatures, sig)
+			}
+		}
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrMissingSignature
+	}
+
+	age := v.now().Sub(time.Unix(seconds, 0))
+	if age > v.tolerance || age < -v.tolerance {
+		return ErrTimestampOutOfRange
+	}
+	for _, secret := range v.secrets {
+		expected := mac(secret, timestamp, payload)
+		for _, sig := range signatures {
+			if hmac.Equal(sig, expected) {
+				return nil
+			}
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// Sign returns the SignatureHeader value for payload signed with secret at
+// t, as the gateway sends it. It is useful to test receivers.
+func Sign(secret string, payload []byte, t time.Time) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac([]byte(secret), timestamp, payload))
+}
+
+func mac(secret []byte, timestamp string, payload []byte) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(timestamp))
+	h.Write([]byte("."))
+	h.Write(payload)
+	return h.Sum(nil)
+}
@@ -0,0 +1,182 @@
+package workersql
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Adaptive cache defaults
+const (
+	DefaultAdaptiveMinTTL = time.Second
+	DefaultAdaptiveMaxTTL = 10 * time.Minute
+)
+
+const (
+	// adaptiveMinSamples is how many reads and writes a fingerprint needs
+	// before its ratio picks the TTL
+	adaptiveMinSamples = 10
+	// adaptiveMaxSamples halves a fingerprint's counts once they add up to
+	// it, so the ratio follows recent traffic
+	adaptiveMaxSamples = 1000
+)
+
+// AdaptiveCacheConfig makes the result cache choose the TTL of each query
+// shape instead of using one static TTL
+type AdaptiveCacheConfig struct {
+	// MinTTL and MaxTTL bound the chosen TTLs (defaults: 1s and 10m)
+	MinTTL time.Duration
+	MaxTTL time.Duration
+}
+
+// adaptiveTTL picks result TTLs per query fingerprint. A Cache-Control
+// max-age from the server is used when present. Otherwise the TTL follows
+// the share of reads among the reads of the fingerprint and the writes
+// made through the client to the tables it reads: read-only shapes get
+// MaxTTL, write-only ones MinTTL, and shares in between a TTL between the
+// two on a log scale. Fingerprints with too few samples keep the static
+// TTL. The methods of a nil adaptiveTTL do nothing.
+type adaptiveTTL struct {
+	min, max    time.Duration
+	maxPatterns int
+
+	mu      sync.Mutex
+	shapes  map[string]*shapeCounts
+	byTable map[string][]*shapeCounts
+}
+
+type shapeCounts struct {
+	reads, writes float64
+}
+
+func newAdaptiveTTL(config *AdaptiveCacheConfig, maxPatterns int) *adaptiveTTL {
+	if config == nil {
+		return nil
+	}
+	a := &adaptiveTTL{
+		min:         config.MinTTL,
+		max:         config.MaxTTL,
+		maxPatterns: maxPatterns,
+		shapes:      make(map[string]*shapeCounts),
+		byTable:     make(map[string][]*shapeCounts),
+	}
+	if a.min <= 0 {
+		a.min = DefaultAdaptiveMinTTL
+	}
+	if a.max <= 0 {
+		a.max = DefaultAdaptiveMaxTTL
+	}
+	if a.max < a.min {
+		a.max = a.min
+	}
+	return a
+}
+
+// read counts a cacheable read of sql
+func (a *adaptiveTTL) read(sql string) {
+	if a == nil {
+		return
+	}
+	fp := Fingerprint(sql)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	counts, ok := a.shapes[fp]
+	if !ok {
+		if len(a.shapes) >= a.maxPatterns {
+			return
+		}
+		counts = &shapeCounts{}
+		a.shapes[fp] = counts
+		for _, table := range statementTables(sql) {
+			a.byTable[table] = append(a.byTable[table], counts)
+		}
+	}
+	counts.reads++
+	counts.decay()
+}
+
+// write counts a write to tables against every fingerprint reading them
+func (a *adaptiveTTL) write(tables []string) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, table := range tables {
+		for _, counts := range a.byTable[table] {
+			counts.writes++
+			counts.decay()
+		}
+	}
+}
+
+func (s *shapeCounts) decay() {
+	if s.reads+s.writes >= adaptiveMaxSamples {
+		s.reads /= 2
+		s.writes /= 2
+	}
+}
+
+// ttl returns the TTL for the result of sql, falling back to static, and
+// whether it may be cached at all
+func (a *adaptiveTTL) ttl(sql string, response *QueryResponse, static time.Duration) (time.Duration, bool) {
+	if a == nil {
+		return static, true
+	}
+	if response.noStore {
+		return 0, false
+	}
+	if response.maxAge > 0 {
+		return a.clamp(response.maxAge), true
+	}
+
+	a.mu.Lock()
+	counts, ok := a.shapes[Fingerprint(sql)]
+	var reads, writes float64
+	if ok {
+		reads, writes = counts.reads, counts.writes
+	}
+	a.mu.Unlock()
+	if reads+writes < adaptiveMinSamples {
+		return static, true
+	}
+	share := reads / (reads + writes)
+	scaled := float64(a.min) * math.Pow(float64(a.max)/float64(a.min), share)
+	return a.clamp(time.Duration(scaled)), true
+}
+
+func (a *adaptiveTTL) clamp(ttl time.Duration) time.Duration {
+	if ttl < a.min {
+		return a.min
+	}
+	if ttl > a.max {
+		return a.max
+	}
+	return ttl
+}
+
+// cacheControl reads the server's caching hint from a Cache-Control header:
+// its max-age, and whether the response must not be stored
+func cacheControl(header http.Header) (maxAge time.Duration, noStore bool) {
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-store", "no-cache":
+			noStore = true
+		case "max-age":
+			seconds, err := strconv.Atoi(strings.Trim(value, `"`))
+			if err != nil {
+				continue
+			}
+			if seconds <= 0 {
+				noStore = true
+			} else {
+				maxAge = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return maxAge, noStore
+}
@@ -0,0 +1,185 @@
+package workersql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Adaptive timeout defaults
+const (
+	DefaultTimeoutPercentile      = 0.99
+	DefaultTimeoutFactor          = 3.0
+	DefaultMinAdaptiveTimeout     = 100 * time.Millisecond
+	DefaultMaxTimeoutFingerprints = 1000
+)
+
+const (
+	// timeoutSamples is how many recent latencies of a fingerprint its
+	// timeout is computed from
+	timeoutSamples = 100
+	// timeoutWarmup is how many samples a fingerprint needs before it gets
+	// a timeout of its own
+	timeoutWarmup = 20
+	// timeoutRecompute is how many samples are added between
+	// recomputations of a fingerprint's timeout
+	timeoutRecompute = 10
+)
+
+// AdaptiveTimeoutConfig gives each query fingerprint a timeout learned
+// from its latencies, a percentile times a factor, instead of one timeout
+// for every query. Set Config.Timeout to the longest any query may take:
+// it stays the cap, and applies to fingerprints not seen often enough yet.
+type AdaptiveTimeoutConfig struct {
+	// Percentile of a fingerprint's recent latencies the timeout is based
+	// on (default: 0.99)
+	Percentile float64
+	// Factor multiplies the percentile (default: 3)
+	Factor float64
+	// MinTimeout and MaxTimeout bound the timeouts (defaults: 100ms and
+	// Config.Timeout). MaxTimeout can't exceed Config.Timeout.
+	MinTimeout time.Duration
+	MaxTimeout time.Duration
+	// MaxFingerprints bounds the fingerprints learned; others use
+	// MaxTimeout (default: 1000)
+	MaxFingerprints int
+}
+
+// adaptiveTimeouts learns a timeout per fingerprint and bounds attempts
+// with it. The methods of a nil adaptiveTimeouts apply no timeout.
+type adaptiveTimeouts struct {
+	config AdaptiveTimeoutConfig
+
+	mu     sync.Mutex
+	shapes map[string]*latencySamples
+}
+
+type latencySamples struct {
+	samples []time.Duration
+	next    int
+	added   int
+	timeout time.Duration
+}
+
+func newAdaptiveTimeouts(config *AdaptiveTimeoutConfig, timeout time.Duration) *adaptiveTimeouts {
+	if config == nil {
+		return nil
+	}
+	a := &adaptiveTimeouts{config: *config, shapes: make(map[string]*latencySamples)}
+	if a.config.Percentile <= 0 || a.config.Percentile >= 1 {
+		a.config.Percentile = DefaultTimeoutPercentile
+	}
+	if a.config.Factor <= 0 {
+		a.config.Factor = DefaultTimeoutFactor
+	}
+	if a.config.MinTimeout <= 0 {
+		a.config.MinTimeout = DefaultMinAdaptiveTimeout
+	}
+	if a.config.MaxTimeout <= 0 || a.config.MaxTimeout > timeout {
+		a.config.MaxTimeout = timeout
+	}
+	if a.config.MinTimeout > a.config.MaxTimeout {
+		a.config.MinTimeout = a.config.MaxTimeout
+	}
+	if a.config.MaxFingerprints <= 0 {
+		a.config.MaxFingerprints = DefaultMaxTimeoutFingerprints
+	}
+	return a
+}
+
+// timeout returns the timeout learned for fingerprint, or MaxTimeout and
+// false while there isn't one
+func (a *adaptiveTimeouts) timeout(fingerprint string) (time.Duration, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if s, ok := a.shapes[fingerprint]; ok && s.timeout > 0 {
+		return s.timeout, true
+	}
+	return a.config.MaxTimeout, false
+}
+
+// observe records a latency of fingerprint
+func (a *adaptiveTimeouts) observe(fingerprint string, latency time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s, ok := a.shapes[fingerprint]
+	if !ok {
+		if len(a.shapes) >= a.config.MaxFingerprints {
+			return
+		}
+		s = &latencySamples{}
+		a.shapes[fingerprint] = s
+	}
+	if len(s.samples) < timeoutSamples {
+		s.samples = append(s.samples, latency)
+	} else {
+		s.samples[s.next] = latency
+		s.next = (s.next + 1) % timeoutSamples
+	}
+	s.added++
+	if s.added < timeoutWarmup || (s.added > timeoutWarmup && s.added%timeoutRecompute != 0) {
+		return
+	}
+	sorted := append([]time.Duration(nil), s.samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	timeout := time.Duration(float64(sorted[int(a.config.Percentile*float64(len(sorted)-1))]) * a.config.Factor)
+	if timeout < a.config.MinTimeout {
+		timeout = a.config.MinTimeout
+	}
+	if timeout > a.config.MaxTimeout {
+		timeout = a.config.MaxTimeout
+	}
+	s.timeout = timeout
+}
+
+// attempt runs one attempt of request through send, bounded by the
+// timeout of its fingerprint, and learns from how long it took. Requests
+// with a timeout of their own (QueryOptions.Timeout) are left alone.
+func (a *adaptiveTimeouts) attempt(ctx context.Context, request map[string]interface{}, send func(context.Context) error) error {
+	if a == nil {
+		return send(ctx)
+	}
+	if _, override := request["timeoutMs"]; override {
+		return send(ctx)
+	}
+	sql, _ := request["sql"].(string)
+	fingerprint := Fingerprint(sql)
+	timeout, learned := a.timeout(fingerprint)
+	if !learned {
+		// Config.Timeout bounds the attempt already
+		start := time.Now()
+		err := send(ctx)
+		if err == nil {
+			a.observe(fingerprint, time.Since(start))
+		}
+		return err
+	}
+
+	attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	err := send(attemptCtx)
+	switch {
+	case err == nil:
+		a.observe(fingerprint, time.Since(start))
+	case errors.Is(attemptCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil:
+		// The latency is at least the timeout; recording that raises the
+		// timeout when the fingerprint got slower for good
+		a.observe(fingerprint, timeout)
+		return fmt.Errorf("%w: no response within %v, the adaptive timeout of the query", context.DeadlineExceeded, timeout)
+	}
+	return err
+}
+
+// AdaptiveTimeout returns the timeout Config.AdaptiveTimeouts learned for
+// queries shaped like sql, and whether one was learned yet. Without
+// adaptive timeouts it returns Config.Timeout and false.
+func (c *Client) AdaptiveTimeout(sql string) (timeout time.Duration, learned bool) {
+	if c.timeouts == nil {
+		return c.config.Timeout, false
+	}
+	return c.timeouts.timeout(Fingerprint(sql))
+}
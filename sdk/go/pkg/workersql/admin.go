@@ -0,0 +1,248 @@
+package workersql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DefaultAdminPollInterval is how often Wait checks an admin operation
+const DefaultAdminPollInterval = 2 * time.Second
+
+// ErrForbidden is returned by admin calls made without admin permission
+var ErrForbidden = errors.New("admin permission required")
+
+// ErrOperationFailed is returned by Wait for an operation that failed on
+// the gateway
+var ErrOperationFailed = errors.New("admin operation failed")
+
+// OperationStatus is the state of a long-running admin operation
+type OperationStatus string
+
+const (
+	OperationPending   OperationStatus = "pending"
+	OperationRunning   OperationStatus = "running"
+	OperationSucceeded OperationStatus = "succeeded"
+	OperationFailed    OperationStatus = "failed"
+)
+
+// Operation is a backup or restore running on the gateway
+type Operation struct {
+	ID     string          `json:"id"`
+	Type   string          `json:"type"`
+	Status OperationStatus `json:"status"`
+	// Progress is the fraction of the work done, from 0 to 1
+	Progress float64 `json:"progress"`
+	Message  string  `json:"message,omitempty"`
+	// BackupID is the backup written by a backup, or read by a restore
+	BackupID  string    `json:"backupId,omitempty"`
+	Database  string    `json:"database,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Done reports whether the operation has finished, successfully or not
+func (o *Operation) Done() bool {
+	return o.Status == OperationSucceeded || o.Status == OperationFailed
+}
+
+// Backup is a completed or in-progress backup of a database
+type Backup struct {
+	ID          string    `json:"id"`
+	Database    string    `json:"database"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"createdAt"`
+	CompletedAt time.Time `json:"completedAt"`
+	SizeBytes   int64     `json:"sizeBytes"`
+	Tables      []string  `json:"tables,omitempty"`
+}
+
+// RestoreOptions controls Restore
+type RestoreOptions struct {
+	// PointInTime restores the database as it was at that time, replaying
+	// the change log over the backup. Zero restores the backup as taken.
+	PointInTime time.Time
+	// Database restores into another database instead of the one backed up
+	Database string
+}
+
+// WaitOptions controls Wait
+type WaitOptions struct {
+	// PollInterval is how often the operation is checked (default:
+	// DefaultAdminPollInterval)
+	PollInterval time.Duration
+	// OnProgress is called with the operation each time it is checked
+	OnProgress func(op *Operation)
+}
+
+// AdminClient runs the gateway's administrative operations. Its calls are
+// authenticated with Config.AdminToken, or APIKey without one, and fail
+// with ErrForbidden when it lacks admin permission.
+type AdminClient struct {
+	client *Client
+}
+
+// Admin returns the client's admin operations
+func (c *Client) Admin() *AdminClient {
+	return &AdminClient{client: c}
+}
+
+// adminResponse is the gateway's reply to an admin request. Its error is a
+// message or an ErrorResponse.
+type adminResponse struct {
+	Success   bool            `json:"success"`
+	Operation *Operation      `json:"operation,omitempty"`
+	Backups   []Backup        `json:"backups,omitempty"`
+	Shards    []ShardInfo     `json:"shards,omitempty"`
+	Shard     *ShardInfo      `json:"shard,omitempty"`
+	Tenants   []Tenant        `json:"tenants,omitempty"`
+	Tenant    *Tenant         `json:"tenant,omitempty"`
+	Key       *TenantKey      `json:"key,omitempty"`
+	Error     json.RawMessage `json:"error,omitempty"`
+}
+
+func (r *adminResponse) failure() error {
+	if r.Success {
+		return nil
+	}
+	var message string
+	if err := json.Unmarshal(r.Error, &message); err == nil && message != "" {
+		return errors.New(message)
+	}
+	var errResp ErrorResponse
+	if err := json.Unmarshal(r.Error, &errResp); err == nil && errResp.Code != "" {
+		return fmt.Errorf("%s: %s", errResp.Code, errResp.Message)
+	}
+	return errors.New("request failed")
+}
+
+// TriggerBackup starts a backup of database and returns the operation
+// taking it, for Wait
+func (a *AdminClient) TriggerBackup(ctx context.Context, database string) (*Operation, error) {
+	if database == "" {
+		return nil, fmt.Errorf("trigger backup: a database is required")
+	}
+	body := map[string]interface{}{"database": database}
+	response, err := a.do(ctx, "POST", "/admin/backups", body, false)
+	if err != nil {
+		return nil, fmt.Errorf("trigger backup of %s: %w", database, err)
+	}
+	return adminOperation(response, "trigger backup of "+database)
+}
+
+// ListBackups returns the backups of the databases the API key
+// administers, newest first
+func (a *AdminClient) ListBackups(ctx context.Context) ([]Backup, error) {
+	response, err := a.do(ctx, "GET", "/admin/backups", nil, true)
+	if err != nil {
+		return nil, fmt.Errorf("list backups: %w", err)
+	}
+	return response.Backups, nil
+}
+
+// Restore starts restoring backupID and returns the operation running it,
+// for Wait. The database is unavailable to queries until it is done.
+func (a *AdminClient) Restore(ctx context.Context, backupID string, opts RestoreOptions) (*Operation, error) {
+	if backupID == "" {
+		return nil, fmt.Errorf("restore: a backup ID is required")
+	}
+	body := map[string]interface{}{}
+	if !opts.PointInTime.IsZero() {
+		if opts.PointInTime.After(time.Now()) {
+			return nil, fmt.Errorf("restore %s: point in time %v is in the future", backupID, opts.PointInTime)
+		}
+		body["pointInTime"] = formatAsOf(opts.PointInTime)
+	}
+	if opts.Database != "" {
+		body["database"] = opts.Database
+	}
+	response, err := a.do(ctx, "POST", "/admin/backups/"+url.PathEscape(backupID)+"/restore", body, false)
+	if err != nil {
+		return nil, fmt.Errorf("restore %s: %w", backupID, err)
+	}
+	return adminOperation(response, "restore "+backupID)
+}
+
+// Operation returns the current state of the operation id
+func (a *AdminClient) Operation(ctx context.Context, id string) (*Operation, error) {
+	response, err := a.do(ctx, "GET", "/admin/operations/"+url.PathEscape(id), nil, true)
+	if err != nil {
+		return nil, fmt.Errorf("get operation %s: %w", id, err)
+	}
+	return adminOperation(response, "get operation "+id)
+}
+
+// Wait polls the operation id until it is done or ctx is, and returns its
+// final state. It returns ErrOperationFailed, with the operation, for an
+// operation that failed. A failed check is retried at the next poll; ctx
+// bounds how long Wait keeps trying.
+func (a *AdminClient) Wait(ctx context.Context, id string, opts WaitOptions) (*Operation, error) {
+	interval := opts.PollInterval
+	if interval <= 0 {
+		interval = DefaultAdminPollInterval
+	}
+	for {
+		op, err := a.Operation(ctx, id)
+		if errors.Is(err, ErrForbidden) || errors.Is(err, ErrClientClosed) {
+			return nil, err
+		}
+		if err == nil {
+			if opts.OnProgress != nil {
+				opts.OnProgress(op)
+			}
+			if op.Status == OperationFailed {
+				return op, fmt.Errorf("%s %s: %w: %s", op.Type, op.ID, ErrOperationFailed, op.Error)
+			}
+			if op.Done() {
+				return op, nil
+			}
+		}
+		sleepContext(ctx, interval)
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("wait for operation %s: %w", id, ctx.Err())
+		}
+	}
+}
+
+// do sends an admin request. Reads are retried like queries; starting an
+// operation is not, so a retry cannot start it twice.
+func (a *AdminClient) do(ctx context.Context, method, path string, body interface{}, retry bool) (*adminResponse, error) {
+	if token := a.client.config.AdminToken; token != "" {
+		ctx = withRequestHeaders(ctx, http.Header{"Authorization": {"Bearer " + token}})
+	}
+	var response adminResponse
+	send := func() error {
+		response = adminResponse{}
+		return a.client.doRequest(ctx, method, path, body, &response)
+	}
+	var err error
+	if retry {
+		err = a.client.retryStrategy.Execute(ctx, send)
+	} else {
+		err = send()
+	}
+	var status *statusError
+	if errors.As(err, &status) && (status.status == http.StatusForbidden || status.status == http.StatusUnauthorized) {
+		return nil, ErrForbidden
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := response.failure(); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// adminOperation returns the operation of response
+func adminOperation(response *adminResponse, action string) (*Operation, error) {
+	if response.Operation == nil || response.Operation.ID == "" {
+		return nil, fmt.Errorf("%s: no operation returned", action)
+	}
+	return response.Operation, nil
+}
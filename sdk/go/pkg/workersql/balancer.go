@@ -0,0 +1,345 @@
+package workersql
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Load balancer defaults
+const (
+	DefaultEjectAfter       = 1
+	DefaultEjectionCooldown = 30 * time.Second
+)
+
+// latencyDecay is the weight of each new sample in an endpoint's latency
+// EWMA
+const latencyDecay = 0.3
+
+// LoadBalancerConfig tunes how requests are spread over Config.Endpoints
+type LoadBalancerConfig struct {
+	// Strategy picks the endpoint of each request (default: RoundRobin())
+	Strategy BalancerStrategy
+	// Weights are the relative weights of endpoints, by URL, for
+	// strategies that use them (default: 1)
+	Weights map[string]int
+	// EjectAfter is how many consecutive failed requests or health checks
+	// eject an endpoint (default: 1). Failures are transport errors and
+	// 5xx responses.
+	EjectAfter int
+	// Cooldown is how long an ejected endpoint gets no requests before it
+	// is reintroduced (default: 30s)
+	Cooldown time.Duration
+	// HealthCheckInterval, if set, checks every endpoint's /health this
+	// often in the background, ejecting failing endpoints and keeping
+	// ejected ones out until a check passes after their cooldown
+	HealthCheckInterval time.Duration
+}
+
+// EndpointStatus is the observed state of one of Config.Endpoints
+type EndpointStatus struct {
+	URL    string
+	Weight int
+	// Latency is the moving average of the endpoint's request latency,
+	// zero until a request has completed
+	Latency time.Duration
+	// Healthy is false while the endpoint is ejected
+	Healthy bool
+	// Failures counts the endpoint's consecutive failures
+	Failures int
+}
+
+// BalancerStrategy picks the endpoint of the next request. Pick gets the
+// healthy endpoints, or every endpoint if none is healthy, and returns the
+// index of its choice. It is called concurrently.
+type BalancerStrategy interface {
+	Pick(endpoints []EndpointStatus) int
+}
+
+// BalancerFunc adapts a function to a BalancerStrategy
+type BalancerFunc func(endpoints []EndpointStatus) int
+
+// Pick calls f
+func (f BalancerFunc) Pick(endpoints []EndpointStatus) int { return f(endpoints) }
+
+// RoundRobin cycles through the endpoints in turn
+func RoundRobin() BalancerStrategy {
+	var next uint64
+	return BalancerFunc(func(endpoints []EndpointStatus) int {
+		return int((atomic.AddUint64(&next, 1) - 1) % uint64(len(endpoints)))
+	})
+}
+
+// Weighted picks endpoints at random in proportion to their weights
+func Weighted() BalancerStrategy {
+	var mu sync.Mutex
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	return BalancerFunc(func(endpoints []EndpointStatus) int {
+		total := 0
+		for _, e := range endpoints {
+			total += e.Weight
+		}
+		mu.Lock()
+		n := random.Intn(total)
+		mu.Unlock()
+		for i, e := range endpoints {
+			if n < e.Weight {
+				return i
+			}
+			n -= e.Weight
+		}
+		return len(endpoints) - 1
+	})
+}
+
+// LowestLatency picks the endpoint with the lowest moving average latency.
+// Endpoints without a measurement yet are tried first.
+func LowestLatency() BalancerStrategy {
+	return BalancerFunc(func(endpoints []EndpointStatus) int {
+		best := 0
+		for i, e := range endpoints {
+			if e.Latency < endpoints[best].Latency {
+				best = i
+			}
+		}
+		return best
+	})
+}
+
+// balancer spreads requests over several endpoints, ejecting failing ones.
+// The methods of a nil balancer do nothing.
+type balancer struct {
+	config LoadBalancerConfig
+
+	mu        sync.Mutex
+	endpoints []*endpointState
+	byURL     map[string]*endpointState
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+type endpointState struct {
+	url      string
+	weight   int
+	latency  time.Duration
+	failures int
+	ejected  time.Time
+}
+
+func newBalancer(endpoints []string, config *LoadBalancerConfig) *balancer {
+	if len(endpoints) < 2 {
+		return nil
+	}
+	b := &balancer{byURL: make(map[string]*endpointState), stop: make(chan struct{})}
+	if config != nil {
+		b.config = *config
+	}
+	if b.config.Strategy == nil {
+		b.config.Strategy = RoundRobin()
+	}
+	if b.config.EjectAfter <= 0 {
+		b.config.EjectAfter = DefaultEjectAfter
+	}
+	if b.config.Cooldown <= 0 {
+		b.config.Cooldown = DefaultEjectionCooldown
+	}
+	for _, url := range endpoints {
+		weight := b.config.Weights[url]
+		if weight <= 0 {
+			weight = 1
+		}
+		state := &endpointState{url: url, weight: weight}
+		b.endpoints = append(b.endpoints, state)
+		b.byURL[url] = state
+	}
+	return b
+}
+
+// pick returns the endpoint for the next request
+func (b *balancer) pick() string {
+	return b.pickExcept(nil)
+}
+
+// pickExcept returns the endpoint for the next request among those not yet
+// tried, or "" if every endpoint was
+func (b *balancer) pickExcept(tried *triedEndpoints) string {
+	b.mu.Lock()
+	now := time.Now()
+	var candidates, untried []*endpointState
+	for _, e := range b.endpoints {
+		if tried != nil && tried.has(e.url) {
+			continue
+		}
+		untried = append(untried, e)
+		if e.healthy(now, b.config) {
+			candidates = append(candidates, e)
+		}
+	}
+	if len(candidates) == 0 {
+		// Failing open beats failing every request
+		candidates = untried
+	}
+	if len(candidates) == 0 {
+		b.mu.Unlock()
+		return ""
+	}
+	statuses := make([]EndpointStatus, len(candidates))
+	for i, e := range candidates {
+		statuses[i] = e.status(now, b.config)
+	}
+	b.mu.Unlock()
+
+	i := b.config.Strategy.Pick(statuses)
+	if i < 0 || i >= len(statuses) {
+		i = 0
+	}
+	return statuses[i].URL
+}
+
+// observe records the outcome of a request to url, ignoring endpoints the
+// balancer doesn't manage
+func (b *balancer) observe(url string, latency time.Duration, failed bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e, ok := b.byURL[url]
+	if !ok {
+		return
+	}
+	if failed {
+		e.failures++
+		if e.failures >= b.config.EjectAfter {
+			e.ejected = time.Now()
+		}
+		return
+	}
+	e.failures = 0
+	e.ejected = time.Time{}
+	if e.latency == 0 {
+		e.latency = latency
+	} else {
+		e.latency = time.Duration(latencyDecay*float64(latency) + (1-latencyDecay)*float64(e.latency))
+	}
+}
+
+// healthy reports whether e may get requests: it isn't ejected, or its
+// cooldown is over and no health check is keeping it out. b.mu must be
+// held.
+func (e *endpointState) healthy(now time.Time, config LoadBalancerConfig) bool {
+	if e.ejected.IsZero() {
+		return true
+	}
+	return config.HealthCheckInterval <= 0 && now.Sub(e.ejected) >= config.Cooldown
+}
+
+func (e *endpointState) status(now time.Time, config LoadBalancerConfig) EndpointStatus {
+	return EndpointStatus{
+		URL:      e.url,
+		Weight:   e.weight,
+		Latency:  e.latency,
+		Healthy:  e.healthy(now, config),
+		Failures: e.failures,
+	}
+}
+
+func (b *balancer) statuses() []EndpointStatus {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	statuses := make([]EndpointStatus, len(b.endpoints))
+	for i, e := range b.endpoints {
+		statuses[i] = e.status(now, b.config)
+	}
+	return statuses
+}
+
+// startHealthChecks checks every endpoint each HealthCheckInterval with
+// check until close. check records its outcome with observe.
+func (b *balancer) startHealthChecks(check func(ctx context.Context, url string) error) {
+	if b == nil || b.config.HealthCheckInterval <= 0 {
+		return
+	}
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		ticker := time.NewTicker(b.config.HealthCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-b.stop:
+				return
+			case <-ticker.C:
+			}
+			for _, e := range b.endpoints {
+				b.checkEndpoint(e, check)
+			}
+		}
+	}()
+}
+
+// checkEndpoint runs a health check on e. Ejected endpoints are only
+// checked once their cooldown is over, a passing check reintroducing them.
+func (b *balancer) checkEndpoint(e *endpointState, check func(ctx context.Context, url string) error) {
+	b.mu.Lock()
+	waiting := !e.ejected.IsZero() && time.Since(e.ejected) < b.config.Cooldown
+	b.mu.Unlock()
+	if waiting {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), b.config.HealthCheckInterval)
+	defer cancel()
+	_ = check(ctx, e.url)
+}
+
+func (b *balancer) close() {
+	if b == nil {
+		return
+	}
+	b.stopOnce.Do(func() { close(b.stop) })
+	b.wg.Wait()
+}
+
+// Endpoints returns the state of each of Config.Endpoints, or nil without
+// several endpoints
+func (c *Client) Endpoints() []EndpointStatus {
+	return c.balancer.statuses()
+}
+
+// isDialError reports whether err is a failure to connect, so the request
+// never reached the endpoint
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// unavailableStatus reports whether status says the gateway didn't process
+// the request because it or its backend was unavailable
+func unavailableStatus(status int) bool {
+	switch status {
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return true
+	}
+	return false
+}
+
+// failover returns the endpoint to send a failed request to next, or "" if
+// the request is pinned to its endpoint or every endpoint was tried
+func (c *Client) failover(pinned bool, tried *triedEndpoints) string {
+	if pinned || c.balancer == nil {
+		return ""
+	}
+	return c.balancer.pickExcept(tried)
+}
@@ -0,0 +1,217 @@
+package workersql
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DefaultBlobThreshold is the size above which []byte params are stored
+// externally when Config.ExternalBlobs is set
+const DefaultBlobThreshold = 1 << 20
+
+// blobRefPrefix starts the column value of every stored BlobRef
+const blobRefPrefix = `{"$workersql_blob":`
+
+// ErrBlobCorrupt is returned when downloaded blob content doesn't match the
+// size or SHA-256 digest recorded in its reference
+var ErrBlobCorrupt = errors.New("external blob is corrupt")
+
+// BlobConfig enables storing large binary params in R2 instead of the row
+type BlobConfig struct {
+	// Threshold is the size in bytes above which []byte params are
+	// uploaded (default: 1 MiB)
+	Threshold int
+	// HTTPClient transfers content to and from the presigned URLs
+	// (default: a client without a timeout, bounded by the context)
+	HTTPClient *http.Client
+}
+
+// BlobRef is a reference to content stored in R2. It is what a row stores
+// in place of the content; as a query param it is written as that stored
+// form.
+type BlobRef struct {
+	Key         string `json:"key"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+	ContentType string `json:"contentType,omitempty"`
+}
+
+// Value implements driver.Valuer, encoding the reference as stored in rows
+func (r BlobRef) Value() (driver.Value, error) {
+	encoded, err := json.Marshal(map[string]BlobRef{"$workersql_blob": r})
+	if err != nil {
+		return nil, err
+	}
+	return string(encoded), nil
+}
+
+// ParseBlobRef decodes a column value holding a blob reference. ok is false
+// if v isn't one.
+func ParseBlobRef(v interface{}) (ref BlobRef, ok bool) {
+	s, isString := v.(string)
+	if !isString || !strings.HasPrefix(s, blobRefPrefix) {
+		return BlobRef{}, false
+	}
+	var wrapper struct {
+		Ref *BlobRef `json:"$workersql_blob"`
+	}
+	if err := json.Unmarshal([]byte(s), &wrapper); err != nil || wrapper.Ref == nil || wrapper.Ref.Key == "" {
+		return BlobRef{}, false
+	}
+	return *wrapper.Ref, true
+}
+
+// presignResponse is the gateway's reply to a presigned URL request
+type presignResponse struct {
+	Success bool           `json:"success"`
+	Key     string         `json:"key"`
+	URL     string         `json:"url"`
+	Error   *ErrorResponse `json:"error,omitempty"`
+}
+
+func (c *Client) presign(ctx context.Context, path string, request map[string]interface{}) (*presignResponse, error) {
+	var response presignResponse
+	err := c.retryStrategy.Execute(ctx, func() error {
+		return c.doRequest(ctx, "POST", path, request, &response)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !response.Success || response.URL == "" {
+		if response.Error != nil {
+			return nil, fmt.Errorf("%s: %s", response.Error.Code, response.Error.Message)
+		}
+		return nil, fmt.Errorf("no presigned URL returned")
+	}
+	return &response, nil
+}
+
+// blobHTTPClient returns the client for presigned transfers
+func (c *Client) blobHTTPClient() *http.Client {
+	if c.config.ExternalBlobs != nil && c.config.ExternalBlobs.HTTPClient != nil {
+		return c.config.ExternalBlobs.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// UploadBlob stores data in R2 through a presigned URL from the gateway and
+// returns a reference to store in a row
+func (c *Client) UploadBlob(ctx context.Context, data []byte, contentType string) (*BlobRef, error) {
+	sum := sha256.Sum256(data)
+	ref := &BlobRef{Size: int64(len(data)), SHA256: hex.EncodeToString(sum[:]), ContentType: contentType}
+
+	presigned, err := c.presign(ctx, "/blobs/upload-url", map[string]interface{}{
+		"size":        ref.Size,
+		"sha256":      ref.SHA256,
+		"contentType": contentType,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("upload blob: %w", err)
+	}
+	ref.Key = presigned.Key
+
+	req, err := http.NewRequestWithContext(ctx, "PUT", presigned.URL, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("upload blob: %w", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := c.blobHTTPClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("upload blob: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("upload blob: HTTP %d", resp.StatusCode)
+	}
+	return ref, nil
+}
+
+// ResolveBlob downloads the content ref points to, verifying its size and
+// digest
+func (c *Client) ResolveBlob(ctx context.Context, ref BlobRef) ([]byte, error) {
+	presigned, err := c.presign(ctx, "/blobs/download-url", map[string]interface{}{"key": ref.Key})
+	if err != nil {
+		return nil, fmt.Errorf("resolve blob %q: %w", ref.Key, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", presigned.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("resolve blob %q: %w", ref.Key, err)
+	}
+	resp, err := c.blobHTTPClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("resolve blob %q: %w", ref.Key, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("resolve blob %q: HTTP %d", ref.Key, resp.StatusCode)
+	}
+	// Read one byte past the recorded size to detect longer content
+	data, err := io.ReadAll(io.LimitReader(resp.Body, ref.Size+1))
+	if err != nil {
+		return nil, fmt.Errorf("resolve blob %q: %w", ref.Key, err)
+	}
+
+	sum := sha256.Sum256(data)
+	if int64(len(data)) != ref.Size || hex.EncodeToString(sum[:]) != ref.SHA256 {
+		return nil, fmt.Errorf("resolve blob %q: %w", ref.Key, ErrBlobCorrupt)
+	}
+	return data, nil
+}
+
+// externalizeParams uploads []byte params above the threshold and replaces
+// them with their references. params is not modified.
+func (c *Client) externalizeParams(ctx context.Context, params []interface{}) ([]interface{}, error) {
+	threshold := c.config.ExternalBlobs.Threshold
+	if threshold <= 0 {
+		threshold = DefaultBlobThreshold
+	}
+
+	resolved := params
+	for i, p := range params {
+		data, ok := p.([]byte)
+		if !ok || len(data) <= threshold {
+			continue
+		}
+		ref, err := c.UploadBlob(ctx, data, "")
+		if err != nil {
+			return nil, fmt.Errorf("param %d: %w", i+1, err)
+		}
+		stored, _ := ref.Value()
+		if &resolved[0] == &params[0] {
+			resolved = append([]interface{}(nil), params...)
+		}
+		resolved[i] = stored
+	}
+	return resolved, nil
+}
+
+// resolveRows replaces blob references in rows with their content
+func (c *Client) resolveRows(ctx context.Context, rows []map[string]interface{}) error {
+	for _, row := range rows {
+		for column, v := range row {
+			ref, ok := ParseBlobRef(v)
+			if !ok {
+				continue
+			}
+			data, err := c.ResolveBlob(ctx, ref)
+			if err != nil {
+				return fmt.Errorf("column %s: %w", column, err)
+			}
+			row[column] = data
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package workersql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrBudgetExceeded matches, with errors.Is, the *BudgetExceededError of
+// calls refused because their context's query budget is spent
+var ErrBudgetExceeded = errors.New("query budget exceeded")
+
+// QueryBudget caps the queries made with a context, such as those of one
+// page render. Every statement counts, including cache hits and the
+// statements of batches, pipelines and transactions.
+type QueryBudget struct {
+	// MaxQueries is how many statements may be issued. Zero means no
+	// limit.
+	MaxQueries int
+	// MaxDBTime is how much time may be spent waiting for statements,
+	// summed over calls. Calls already started finish; later ones are
+	// over budget. Zero means no limit.
+	MaxDBTime time.Duration
+	// OnExceeded, if set, is called once when the budget is first exceeded
+	// and calls proceed, to log a warning instead of failing them
+	OnExceeded func(BudgetUsage)
+}
+
+// BudgetUsage is what has been spent of a QueryBudget
+type BudgetUsage struct {
+	Queries int
+	DBTime  time.Duration
+}
+
+// BudgetExceededError is returned for calls over their context's
+// QueryBudget
+type BudgetExceededError struct {
+	Budget QueryBudget
+	Usage  BudgetUsage
+}
+
+func (e *BudgetExceededError) Error() string {
+	return fmt.Sprintf("query budget exceeded: %d queries, %s of DB time", e.Usage.Queries, e.Usage.DBTime)
+}
+
+// Is makes the error match ErrBudgetExceeded
+func (e *BudgetExceededError) Is(target error) bool {
+	return target == ErrBudgetExceeded
+}
+
+type queryBudgetKey struct{}
+
+// queryBudget tracks the spending of a QueryBudget. The methods of a nil
+// budget allow everything.
+type queryBudget struct {
+	config QueryBudget
+
+	mu       sync.Mutex
+	usage    BudgetUsage
+	exceeded bool
+}
+
+// WithQueryBudget returns a context whose calls share budget. Calls beyond
+// it fail with a *BudgetExceededError, or proceed after OnExceeded is
+// called.
+func WithQueryBudget(ctx context.Context, budget QueryBudget) context.Context {
+	return context.WithValue(ctx, queryBudgetKey{}, &queryBudget{config: budget})
+}
+
+// BudgetUsageFrom returns what the calls made with ctx have spent of its
+// QueryBudget, and whether ctx has one
+func BudgetUsageFrom(ctx context.Context) (BudgetUsage, bool) {
+	b := budgetFrom(ctx)
+	if b == nil {
+		return BudgetUsage{}, false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.usage, true
+}
+
+func budgetFrom(ctx context.Context) *queryBudget {
+	b, _ := ctx.Value(queryBudgetKey{}).(*queryBudget)
+	return b
+}
+
+// admit charges n statements to the budget, refusing them if they would
+// exceed it
+func (b *queryBudget) admit(n int) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	over := (b.config.MaxQueries > 0 && b.usage.Queries+n > b.config.MaxQueries) ||
+		(b.config.MaxDBTime > 0 && b.usage.DBTime >= b.config.MaxDBTime)
+	if over && b.config.OnExceeded == nil {
+		err := &BudgetExceededError{Budget: b.config, Usage: b.usage}
+		b.mu.Unlock()
+		return err
+	}
+	b.usage.Queries += n
+	warn := over && !b.exceeded
+	if over {
+		b.exceeded = true
+	}
+	usage := b.usage
+	b.mu.Unlock()
+
+	if warn {
+		b.config.OnExceeded(usage)
+	}
+	return nil
+}
+
+// spend charges the time since start to the budget
+func (b *queryBudget) spend(start time.Time) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.usage.DBTime += time.Since(start)
+	b.mu.Unlock()
+}
@@ -0,0 +1,307 @@
+package workersql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Bulk insert defaults
+const (
+	DefaultBulkChunkSize       = 500
+	DefaultBulkMaxPayloadBytes = 1 << 20
+	DefaultBulkParallelism     = 4
+)
+
+// ConflictAction selects how BulkInsert handles duplicate keys
+type ConflictAction int
+
+const (
+	// ConflictError fails the chunk containing a duplicate key
+	ConflictError ConflictAction = iota
+	// ConflictIgnore skips duplicate rows (INSERT IGNORE)
+	ConflictIgnore
+	// ConflictUpdate overwrites the existing row (ON DUPLICATE KEY UPDATE)
+	ConflictUpdate
+)
+
+// BulkOptions configures BulkInsert
+type BulkOptions struct {
+	// ChunkSize is the maximum number of rows per INSERT statement (default: 500)
+	ChunkSize int
+	// MaxPayloadBytes caps the estimated request size of a chunk (default: 1 MiB)
+	MaxPayloadBytes int
+	// Parallelism is the number of chunks executed concurrently (default: 4)
+	Parallelism int
+	// OnConflict selects the duplicate key behaviour (default: ConflictError)
+	OnConflict ConflictAction
+	// UpdateColumns are the columns overwritten with ConflictUpdate
+	// (default: every inserted column)
+	UpdateColumns []string
+}
+
+// BulkResult summarizes a BulkInsert call
+type BulkResult struct {
+	// Rows is the number of rows submitted
+	Rows int
+	// Chunks is the number of INSERT statements the rows were split into
+	Chunks int
+	// AffectedRows is the sum of affected rows over successful chunks
+	AffectedRows int64
+	// Errors lists the chunks that failed, ordered by chunk index
+	Errors []ChunkError
+}
+
+// ChunkError reports a failed BulkInsert chunk
+type ChunkError struct {
+	// Chunk is the index of the failed chunk
+	Chunk int
+	// FirstRow is the index of the chunk's first row in the input
+	FirstRow int
+	// Rows is the number of rows in the chunk
+	Rows int
+	Err  error
+}
+
+func (e ChunkError) Error() string {
+	return fmt.Sprintf("chunk %d (rows %d-%d): %v", e.Chunk, e.FirstRow, e.FirstRow+e.Rows-1, e.Err)
+}
+
+func (e ChunkError) Unwrap() error {
+	return e.Err
+}
+
+// BulkInsertError is returned by BulkInsert when one or more chunks failed
+type BulkInsertError struct {
+	Chunks int
+	Errors []ChunkError
+}
+
+func (e *BulkInsertError) Error() string {
+	return fmt.Sprintf("bulk insert: %d of %d chunks failed: %v", len(e.Errors), e.Chunks, e.Errors[0])
+}
+
+// Unwrap returns the per-chunk errors
+func (e *BulkInsertError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i := range e.Errors {
+		errs[i] = e.Errors[i]
+	}
+	return errs
+}
+
+// bulkChunk is a contiguous range of input rows sent as one statement
+type bulkChunk struct {
+	index int
+	start int
+	end   int
+}
+
+// BulkInsert inserts rows into table using multi-row INSERT statements. Rows
+// are split into chunks bounded by ChunkSize and MaxPayloadBytes, and chunks
+// run concurrently up to Parallelism. The column list is the union of all
+// row keys; a row missing a column inserts the column's DEFAULT.
+//
+// The returned result is always non-nil. If any chunk fails, the error is a
+// *BulkInsertError and result.Errors lists the failed chunks; rows in other
+// chunks were still inserted.
+func (c *Client) BulkInsert(ctx context.Context, table string, rows []map[string]interface{}, opts BulkOptions) (*BulkResult, error) {
+	result := &BulkResult{Rows: len(rows)}
+	if table == "" {
+		return result, fmt.Errorf("bulk insert: table name is required")
+	}
+	if len(rows) == 0 {
+		return result, nil
+	}
+
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = DefaultBulkChunkSize
+	}
+	if opts.MaxPayloadBytes <= 0 {
+		opts.MaxPayloadBytes = DefaultBulkMaxPayloadBytes
+	}
+	if opts.Parallelism <= 0 {
+		opts.Parallelism = DefaultBulkParallelism
+	}
+
+	columns := bulkColumns(rows)
+	if len(columns) == 0 {
+		return result, fmt.Errorf("bulk insert: rows have no columns")
+	}
+
+	chunks, err := splitBulkRows(rows, columns, opts)
+	if err != nil {
+		return result, fmt.Errorf("bulk insert: %w", err)
+	}
+	result.Chunks = len(chunks)
+
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, opts.Parallelism)
+	)
+	fail := func(chunk bulkChunk, err error) {
+		mu.Lock()
+		result.Errors = append(result.Errors, ChunkError{
+			Chunk:    chunk.index,
+			FirstRow: chunk.start,
+			Rows:     chunk.end - chunk.start,
+			Err:      err,
+		})
+		mu.Unlock()
+	}
+
+	for _, chunk := range chunks {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			fail(chunk, ctx.Err())
+			continue
+		}
+
+		wg.Add(1)
+		go func(chunk bulkChunk) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			sql, params := buildBulkInsert(table, columns, rows[chunk.start:chunk.end], opts)
+			resp, err := c.Exec(ctx, sql, params...)
+			if err == nil {
+				err = resp.failure()
+			}
+			if err != nil {
+				fail(chunk, err)
+				return
+			}
+
+			mu.Lock()
+			result.AffectedRows += resp.AffectedRows
+			mu.Unlock()
+		}(chunk)
+	}
+	wg.Wait()
+
+	if len(result.Errors) == 0 {
+		return result, nil
+	}
+	sort.Slice(result.Errors, func(i, j int) bool { return result.Errors[i].Chunk < result.Errors[j].Chunk })
+	return result, &BulkInsertError{Chunks: result.Chunks, Errors: result.Errors}
+}
+
+// bulkColumns returns the sorted union of the rows' keys
+func bulkColumns(rows []map[string]interface{}) []string {
+	seen := make(map[string]bool)
+	var columns []string
+	for _, row := range rows {
+		for name := range row {
+			if !seen[name] {
+				seen[name] = true
+				columns = append(columns, name)
+			}
+		}
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// splitBulkRows groups rows into chunks of at most opts.ChunkSize rows whose
+// estimated JSON payload stays under opts.MaxPayloadBytes
+func splitBulkRows(rows []map[string]interface{}, columns []string, opts BulkOptions) ([]bulkChunk, error) {
+	// Statement text grows by one "(?, ...)" tuple per row; the fixed part
+	// is small enough to fold into the per-row estimate
+	tupleSize := 4 * len(columns)
+
+	var chunks []bulkChunk
+	start, size := 0, 0
+	for i, row := range rows {
+		values := make([]interface{}, 0, len(columns))
+		for _, col := range columns {
+			if v, ok := row[col]; ok {
+				values = append(values, v)
+			}
+		}
+		encoded, err := json.Marshal(values)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", i, err)
+		}
+		rowSize := len(encoded) + tupleSize
+
+		if i > start && (i-start >= opts.ChunkSize || size+rowSize > opts.MaxPayloadBytes) {
+			chunks = append(chunks, bulkChunk{index: len(chunks), start: start, end: i})
+			start, size = i, 0
+		}
+		size += rowSize
+	}
+	chunks = append(chunks, bulkChunk{index: len(chunks), start: start, end: len(rows)})
+	return chunks, nil
+}
+
+// buildBulkInsert renders a multi-row INSERT for rows
+func buildBulkInsert(table string, columns []string, rows []map[string]interface{}, opts BulkOptions) (string, []interface{}) {
+	var sb strings.Builder
+	if opts.OnConflict == ConflictIgnore {
+		sb.WriteString("INSERT IGNORE INTO ")
+	} else {
+		sb.WriteString("INSERT INTO ")
+	}
+	sb.WriteString(quoteIdentifier(table))
+	sb.WriteString(" (")
+	for i, col := range columns {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(quoteIdentifier(col))
+	}
+	sb.WriteString(") VALUES ")
+
+	params := make([]interface{}, 0, len(rows)*len(columns))
+	for r, row := range rows {
+		if r > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteByte('(')
+		for i, col := range columns {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			v, ok := row[col]
+			if !ok {
+				sb.WriteString("DEFAULT")
+				continue
+			}
+			sb.WriteByte('?')
+			params = append(params, v)
+		}
+		sb.WriteByte(')')
+	}
+
+	if opts.OnConflict == ConflictUpdate {
+		update := opts.UpdateColumns
+		if len(update) == 0 {
+			update = columns
+		}
+		sb.WriteString(" ON DUPLICATE KEY UPDATE ")
+		for i, col := range update {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			q := quoteIdentifier(col)
+			sb.WriteString(q + " = VALUES(" + q + ")")
+		}
+	}
+
+	return sb.String(), params
+}
+
+// quoteIdentifier quotes a table or column name with backticks. A dotted
+// name such as "db.table" is quoted per part.
+func quoteIdentifier(name string) string {
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		parts[i] = "`" + strings.ReplaceAll(p, "`", "``") + "`"
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,126 @@
+package workersql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// CacheBypass returns a hint that skips the gateway's result cache, so the
+// query reads current data and its result isn't stored
+func CacheBypass() CacheHint {
+	return CacheHint{Bypass: true}
+}
+
+// CacheTTL returns a hint that caches the query's result for ttl instead
+// of the gateway default
+func CacheTTL(ttl time.Duration) CacheHint {
+	return CacheHint{TTL: ttl}
+}
+
+func (h CacheHint) isZero() bool {
+	return h.TTL <= 0 && !h.Bypass
+}
+
+// apply adds the hint to a /query request body
+func (h CacheHint) apply(request map[string]interface{}) {
+	if h.isZero() {
+		return
+	}
+	cache := map[string]interface{}{}
+	if h.TTL > 0 {
+		cache["ttlMs"] = h.TTL.Milliseconds()
+	}
+	if h.Bypass {
+		cache["bypass"] = true
+	}
+	request["cache"] = cache
+}
+
+// setHeader mirrors the hint as a Cache-Control header
+func (h CacheHint) setHeader(header http.Header) {
+	switch {
+	case h.Bypass:
+		header.Set("Cache-Control", "no-cache")
+	case h.TTL > 0:
+		header.Set("Cache-Control", "max-age="+strconv.FormatInt(int64(h.TTL/time.Second), 10))
+	}
+}
+
+type cacheHintKey struct{}
+
+// WithCacheHint returns a context that applies hint to every query run
+// with it, including those issued by helpers such as QueryRow, GetByPK or
+// Paginate. A cache hint passed to QueryWithOptions takes precedence.
+func WithCacheHint(ctx context.Context, hint CacheHint) context.Context {
+	return context.WithValue(ctx, cacheHintKey{}, hint)
+}
+
+// applyContextCacheHint adds the cache hint attached to ctx to a request
+// that doesn't carry one yet
+func applyContextCacheHint(ctx context.Context, request map[string]interface{}) context.Context {
+	hint, ok := ctx.Value(cacheHintKey{}).(CacheHint)
+	if !ok || hint.isZero() {
+		return ctx
+	}
+	if _, set := request["cache"]; set {
+		return ctx
+	}
+	hint.apply(request)
+	header := http.Header{}
+	hint.setHeader(header)
+	return withRequestHeaders(ctx, header)
+}
+
+// InvalidationSpec selects cached results to drop. At least one table or
+// key is required.
+type InvalidationSpec struct {
+	// Tables drops every cached result that reads one of these tables
+	Tables []string
+	// Keys drops cache entries by their gateway cache key
+	Keys []string
+}
+
+// InvalidateCache drops cached query results, so reads see writes made
+// outside this client, or by it, before the entries expire. It returns the
+// number of entries the gateway dropped.
+func (c *Client) InvalidateCache(ctx context.Context, spec InvalidationSpec) (int, error) {
+	if len(spec.Tables) == 0 && len(spec.Keys) == 0 {
+		return 0, errors.New("invalidate cache: no tables or keys given")
+	}
+
+	request := map[string]interface{}{}
+	if len(spec.Tables) > 0 {
+		tables := make([]string, len(spec.Tables))
+		for i, table := range spec.Tables {
+			tables[i] = normalizeTableName(table)
+		}
+		request["tables"] = tables
+		c.results.invalidate(tables)
+	}
+	if len(spec.Keys) > 0 {
+		request["keys"] = spec.Keys
+	}
+
+	var response struct {
+		Success     bool           `json:"success"`
+		Invalidated int            `json:"invalidated"`
+		Error       *ErrorResponse `json:"error,omitempty"`
+	}
+	err := c.retryStrategy.Execute(ctx, func() error {
+		return c.doRequest(ctx, "POST", "/cache/invalidate", request, &response)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("invalidate cache: %w", err)
+	}
+	if !response.Success {
+		if response.Error != nil {
+			return 0, fmt.Errorf("invalidate cache: %s: %s", response.Error.Code, response.Error.Message)
+		}
+		return 0, fmt.Errorf("invalidate cache: request failed")
+	}
+	return response.Invalidated, nil
+}
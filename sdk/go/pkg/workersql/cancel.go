@@ -0,0 +1,102 @@
+package workersql
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// QueryIDHeader carries the ID a query runs under on the gateway, by which
+// CancelQuery stops it
+const QueryIDHeader = "X-WorkerSQL-Query-ID"
+
+// DefaultCancelTimeout bounds the cancellation the client sends for a
+// query abandoned by its context
+const DefaultCancelTimeout = 5 * time.Second
+
+// ErrQueryNotRunning is returned by CancelQuery for a query the gateway
+// isn't running, because it finished or never started
+var ErrQueryNotRunning = errors.New("query is not running")
+
+type queryIDKey struct{}
+
+// WithQueryID makes the query sent with ctx run under id, so it can be
+// stopped with CancelQuery, e.g. from another goroutine or process, before
+// it returns. Use a new ID for every query.
+func WithQueryID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, queryIDKey{}, id)
+}
+
+// NewQueryID returns a random query ID for WithQueryID
+func NewQueryID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// The ID only needs to be unique among running queries
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// withQueryID attaches the query ID of a call, the caller's or a new one,
+// to the requests sent with ctx, so every retry of the call shares it
+func withQueryID(ctx context.Context) (context.Context, string) {
+	id, _ := ctx.Value(queryIDKey{}).(string)
+	if id == "" {
+		id = NewQueryID()
+	}
+	h := http.Header{}
+	h.Set(QueryIDHeader, id)
+	return withRequestHeaders(ctx, h), id
+}
+
+// CancelQuery asks the gateway to stop the query running under queryID,
+// as reported by QueryResponse.QueryID or set with WithQueryID. A write
+// stopped part way is rolled back by the Durable Object. It returns
+// ErrQueryNotRunning if the query isn't running.
+func (c *Client) CancelQuery(ctx context.Context, queryID string) error {
+	return c.cancelQuery(ctx, queryID, nil)
+}
+
+// cancelQuery sends a cancellation, with the routing hints of the query so
+// it reaches the Durable Object running it
+func (c *Client) cancelQuery(ctx context.Context, queryID string, hints interface{}) error {
+	body := map[string]interface{}{"queryId": queryID}
+	if hints != nil {
+		body["hints"] = hints
+	}
+	err := c.doRequest(ctx, "POST", "/query/cancel", body, nil)
+	var status *statusError
+	if errors.As(err, &status) && status.status == http.StatusNotFound {
+		return fmt.Errorf("cancel query %s: %w", queryID, ErrQueryNotRunning)
+	}
+	if err != nil {
+		return fmt.Errorf("cancel query %s: %w", queryID, err)
+	}
+	return nil
+}
+
+// cancelAbandoned stops, in the background, the query sent for request
+// under queryID if ctx ended before it returned, so the Durable Object
+// doesn't run it on for nobody
+func (c *Client) cancelAbandoned(ctx context.Context, queryID string, request map[string]interface{}) {
+	if c.config.DisableQueryCancel || ctx.Err() == nil {
+		return
+	}
+	cancelCtx := context.Background()
+	if endpoint, ok := ctx.Value(endpointKey{}).(string); ok {
+		cancelCtx = withEndpoint(cancelCtx, endpoint)
+	}
+	hints := request["hints"]
+	go func() {
+		cancelCtx, cancel := context.WithTimeout(cancelCtx, DefaultCancelTimeout)
+		defer cancel()
+		if err := c.cancelQuery(cancelCtx, queryID, hints); err == nil {
+			atomic.AddInt64(&c.stats.cancelledQueries, 1)
+		}
+	}()
+}
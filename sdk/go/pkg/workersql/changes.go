@@ -0,0 +1,299 @@
+package workersql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultChangePollInterval is how often WatchChanges polls a shard
+	// whose change log has been read to the end
+	DefaultChangePollInterval = time.Second
+	// DefaultChangeBatchSize is the number of changes read per poll
+	DefaultChangeBatchSize = 500
+)
+
+// ChangeEvent is a write recorded in a shard's change log
+type ChangeEvent struct {
+	// Shard is the shard of Config.Shards the change was made on, empty
+	// without Config.Shards
+	Shard string `json:"shard,omitempty"`
+	// ID is the position of the change in the shard's log, increasing
+	ID   int64     `json:"id"`
+	Time time.Time `json:"time"`
+	// Type is "mutation" for writes to rows and "ddl" for schema changes
+	Type     string        `json:"type"`
+	TenantID string        `json:"tenantId,omitempty"`
+	Table    string        `json:"table,omitempty"`
+	SQL      string        `json:"sql"`
+	Params   []interface{} `json:"params,omitempty"`
+}
+
+// ChangeOffsets maps shards to the ID of the last change handled on each,
+// the shard "" standing for the gateway without Config.Shards. It is JSON
+// serializable so it can be persisted between runs.
+type ChangeOffsets map[string]int64
+
+// ChangeFeedOptions controls WatchChanges
+type ChangeFeedOptions struct {
+	// Shards to read (default: every shard of Config.Shards, or the
+	// gateway without them)
+	Shards []string
+	// Tables limits the changes handled to these tables (default: all).
+	// DDL changes are handled whatever their table.
+	Tables []string
+	// After resumes the feed after the changes handled by a previous run.
+	// Shards missing from it are read from the start of their log.
+	After ChangeOffsets
+	// PollInterval is how often a shard read to the end is polled again,
+	// and how long a failed batch waits before it is retried (default: 1s)
+	PollInterval time.Duration
+	// BatchSize is the number of changes read per poll (default: 500)
+	BatchSize int
+	// OnError is called with errors reading a shard or handling its
+	// changes, before they are retried
+	OnError func(shard string, err error)
+	// OnCommit is called with the offsets of every shard after a batch has
+	// been handled, to persist them
+	OnCommit func(ChangeOffsets)
+}
+
+// ReadChanges returns up to limit changes from the change log of shard
+// (one of Config.Shards, or "" for the gateway) after the change with ID
+// after. Results bypass the result cache.
+func (c *Client) ReadChanges(ctx context.Context, shard string, after int64, limit int) ([]ChangeEvent, error) {
+	if limit <= 0 {
+		limit = DefaultChangeBatchSize
+	}
+	request := map[string]interface{}{
+		"sql":    "SELECT id, ts, type, payload FROM _events WHERE id > ? ORDER BY id LIMIT ?",
+		"params": []interface{}{after, limit},
+	}
+	var response *QueryResponse
+	read := func(ctx context.Context) (err error) {
+		response, err = c.execute(ctx, "Query", request)
+		if err == nil {
+			err = response.failure()
+		}
+		return err
+	}
+	var err error
+	if shard == "" {
+		err = read(ctx)
+	} else {
+		err = c.onShard(ctx, shard, read)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read changes: %w", err)
+	}
+
+	events := make([]ChangeEvent, 0, len(response.Data))
+	for _, row := range response.Data {
+		event, err := parseChangeEvent(row)
+		if err != nil {
+			return nil, fmt.Errorf("read changes: %w", err)
+		}
+		event.Shard = shard
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// WatchChanges reads the change logs of the shards and calls handler with
+// each batch of changes, in log order, until ctx is done. Shards are read
+// concurrently, so handler must be safe for concurrent use, but the
+// batches of one shard are handled one at a time. A batch whose handler
+// fails is handled again after PollInterval, and offsets only move past a
+// batch once it has been handled: delivery is at least once, and a handler
+// should be idempotent. DDL changes read from the logs are reported to the
+// OnSchemaChange listeners before handler runs, so caches drop what schema
+// changes made by other clients made stale. WatchChanges returns ctx.Err().
+func (c *Client) WatchChanges(ctx context.Context, opts ChangeFeedOptions, handler func(ctx context.Context, events []ChangeEvent) error) error {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultChangePollInterval
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultChangeBatchSize
+	}
+	shards := opts.Shards
+	if len(shards) == 0 {
+		for shard := range c.config.Shards {
+			shards = append(shards, shard)
+		}
+		sort.Strings(shards)
+	}
+	if len(shards) == 0 {
+		shards = []string{""}
+	}
+
+	feed := &changeFeed{offsets: ChangeOffsets{}, opts: opts}
+	for _, shard := range shards {
+		feed.offsets[shard] = opts.After[shard]
+	}
+	var wg sync.WaitGroup
+	for _, shard := range shards {
+		wg.Add(1)
+		go func(shard string) {
+			defer wg.Done()
+			feed.watch(ctx, c, shard, handler)
+		}(shard)
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// changeFeed holds the offsets of a WatchChanges call
+type changeFeed struct {
+	mu      sync.Mutex
+	offsets ChangeOffsets
+	opts    ChangeFeedOptions
+}
+
+func (f *changeFeed) watch(ctx context.Context, c *Client, shard string, handler func(ctx context.Context, events []ChangeEvent) error) {
+	f.mu.Lock()
+	after := f.offsets[shard]
+	f.mu.Unlock()
+
+	for ctx.Err() == nil {
+		events, err := c.ReadChanges(ctx, shard, after, f.opts.BatchSize)
+		if err == nil && len(events) > 0 {
+			c.observeDDL(events)
+			if wanted := f.filter(events); len(wanted) > 0 {
+				err = handler(ctx, wanted)
+			}
+		}
+		if err != nil {
+			if ctx.Err() == nil && f.opts.OnError != nil {
+				f.opts.OnError(shard, err)
+			}
+			sleepContext(ctx, f.opts.PollInterval)
+			continue
+		}
+
+		if len(events) > 0 {
+			after = events[len(events)-1].ID
+			f.commit(shard, after)
+		}
+		if len(events) < f.opts.BatchSize {
+			sleepContext(ctx, f.opts.PollInterval)
+		}
+	}
+}
+
+// observeDDL notifies the schema listeners of the DDL changes of events
+func (c *Client) observeDDL(events []ChangeEvent) {
+	for _, event := range events {
+		if event.Type != "ddl" {
+			continue
+		}
+		change := SchemaChange{SQL: event.SQL}
+		if event.Table != "" {
+			change.Tables = []string{normalizeTableName(event.Table)}
+		} else {
+			change.Tables, _ = ddlTables(event.SQL)
+		}
+		c.schema.notify(change)
+	}
+}
+
+// filter returns the events of the tables watched
+func (f *changeFeed) filter(events []ChangeEvent) []ChangeEvent {
+	if len(f.opts.Tables) == 0 {
+		return events
+	}
+	var wanted []ChangeEvent
+	for _, event := range events {
+		if event.Type == "ddl" || containsTable(f.opts.Tables, event.Table) {
+			wanted = append(wanted, event)
+		}
+	}
+	return wanted
+}
+
+func (f *changeFeed) commit(shard string, id int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.offsets[shard] = id
+	if f.opts.OnCommit == nil {
+		return
+	}
+	offsets := make(ChangeOffsets, len(f.offsets))
+	for s, o := range f.offsets {
+		offsets[s] = o
+	}
+	f.opts.OnCommit(offsets)
+}
+
+// changeInt reads an integer column of a change log, decoded as a float or,
+// with Config.UseNumber, a json.Number
+func changeInt(v interface{}) (int64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return int64(v), true
+	case json.Number:
+		n, err := v.Int64()
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// sleepContext waits for d or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+func containsTable(tables []string, table string) bool {
+	table = normalizeTableName(table)
+	for _, t := range tables {
+		if normalizeTableName(t) == table {
+			return true
+		}
+	}
+	return false
+}
+
+// parseChangeEvent reads a row of a change log: id, ts in Unix
+// milliseconds, type, and a JSON payload describing the statement
+func parseChangeEvent(row map[string]interface{}) (ChangeEvent, error) {
+	id, ok := changeInt(row["id"])
+	if !ok {
+		return ChangeEvent{}, errors.New("change without an id")
+	}
+	event := ChangeEvent{ID: id}
+	event.Type, _ = row["type"].(string)
+	if ts, ok := changeInt(row["ts"]); ok {
+		event.Time = time.UnixMilli(ts).UTC()
+	}
+
+	var payload struct {
+		TenantID string        `json:"tenantId"`
+		Table    string        `json:"table"`
+		SQL      string        `json:"sql"`
+		Params   []interface{} `json:"params"`
+	}
+	switch p := row["payload"].(type) {
+	case string:
+		if err := json.Unmarshal([]byte(p), &payload); err != nil {
+			return ChangeEvent{}, fmt.Errorf("change %d: %w", event.ID, err)
+		}
+	case map[string]interface{}:
+		data, _ := json.Marshal(p)
+		_ = json.Unmarshal(data, &payload)
+	}
+	event.TenantID = payload.TenantID
+	event.Table = strings.Trim(payload.Table, "`\"")
+	event.SQL = payload.SQL
+	event.Params = payload.Params
+	return event, nil
+}
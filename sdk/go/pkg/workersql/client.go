@@ -5,12 +5,18 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/http/httptrace"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/healthfees-org/workersql/sdk/go/internal/breaker"
 	"github.com/healthfees-org/workersql/sdk/go/internal/dsn"
 	"github.com/healthfees-org/workersql/sdk/go/internal/pool"
 	"github.com/healthfees-org/workersql/sdk/go/internal/retry"
@@ -19,18 +25,181 @@ import (
 
 // Config configures the WorkerSQL client
 type Config struct {
-	Host          string
-	Port          int
-	Username      string
-	Password      string
-	Database      string
-	APIEndpoint   string
-	APIKey        string
+	Host        string
+	Port        int
+	Username    string
+	Password    string
+	Database    string
+	APIEndpoint string
+	APIKey      string
+
+	// AdminToken authenticates the calls of Client.Admin instead of APIKey,
+	// so the key used for queries needn't carry admin permission
+	AdminToken string
+
+	// Endpoints lists API endpoints to spread requests over, failing over
+	// between them. APIEndpoint defaults to the first one and still serves
+	// transactions.
+	Endpoints []string
+	// LoadBalancer tunes endpoint selection, ejection and health checks
+	// for Endpoints (default: round-robin)
+	LoadBalancer *LoadBalancerConfig
+
 	SSL           bool
 	Timeout       time.Duration
 	RetryAttempts int
 	RetryDelay    time.Duration
 	Pooling       *PoolConfig
+
+	// DisableQueryCancel stops the client from asking the gateway to stop
+	// a query whose context is done before it returns; the query then runs
+	// to completion on the Durable Object, its result discarded
+	DisableQueryCancel bool
+	// Deadlines tunes how the time left to each request is sent to the
+	// gateway (default: sent, less a 25ms margin)
+	Deadlines *DeadlineConfig
+
+	// UseNumber returns numeric values without a more specific column type,
+	// including DECIMAL columns, as json.Number instead of float64 so no
+	// precision is lost. See ScanNumber for converting them.
+	UseNumber bool
+
+	// ParseTime decodes DATETIME, TIMESTAMP and DATE columns into
+	// time.Time instead of returning the raw strings
+	ParseTime bool
+	// Location is the time zone used for parsed time values (default: UTC)
+	Location *time.Location
+
+	// MaxConcurrentTransactions caps the transactions this client keeps
+	// open at once. BeginTx calls beyond the cap wait for a slot until their
+	// context ends. Zero means no client-side limit.
+	MaxConcurrentTransactions int
+
+	// TransactionHeartbeatInterval is how often an open transaction that
+	// has been idle is pinged so the server doesn't expire it (default:
+	// 10s). A negative value disables heartbeats.
+	TransactionHeartbeatInterval time.Duration
+	// MaxTransactionDuration is how long a transaction may stay open before
+	// the client rolls it back; later statements and Commit then return
+	// ErrTransactionExpired. Zero means no limit.
+	MaxTransactionDuration time.Duration
+
+	// TransactionIdleTimeout is how long a transaction WebSocket session is
+	// kept open after its transaction finishes so the next BeginTx can reuse
+	// it (default: 30s). A negative value closes sessions immediately.
+	TransactionIdleTimeout time.Duration
+	// TransactionsPerConnection, above one, multiplexes up to this many
+	// transactions over each WebSocket connection, keeping frames of one
+	// transaction in order. Zero or one gives every transaction its own
+	// connection.
+	TransactionsPerConnection int
+
+	// LockHeartbeatInterval is how often advisory locks taken with
+	// AcquireLock are checked, keeping their sessions active (default:
+	// 10s). A negative value disables heartbeats.
+	LockHeartbeatInterval time.Duration
+
+	// TransactionTransport selects how transactions reach the gateway
+	// (default: TransactionTransportAuto, WebSocket with a fallback to
+	// HTTP when WebSocket dials fail)
+	TransactionTransport TransactionTransport
+
+	// ProfilingLabels runs each call under pprof labels carrying the
+	// operation, query fingerprint and table, so CPU profiles attribute time
+	// to specific queries. runtime/trace regions are always emitted.
+	ProfilingLabels bool
+
+	// ClientTrace, if set, is called for every HTTP request the client sends
+	// (including each retry attempt) and the returned hooks are attached to
+	// it, to capture DNS, connect, TLS and time-to-first-byte timings. ctx
+	// is the caller's context; method and path identify the API call, e.g.
+	// "POST" and "/query". Returning nil skips tracing for the request.
+	ClientTrace func(ctx context.Context, method, path string) *httptrace.ClientTrace
+
+	// ExternalBlobs, if set, uploads large []byte params of Query and Exec
+	// to R2 and stores a BlobRef in the row instead; query results have
+	// references replaced by their content. Nil keeps blobs inline.
+	ExternalBlobs *BlobConfig
+
+	// ResultCache, if set, caches SELECT results in process. Nil disables
+	// the client-side cache.
+	ResultCache *ResultCacheConfig
+	// NegativeCache, if set, caches empty results of the configured query
+	// shapes for a short TTL, with or without ResultCache
+	NegativeCache *NegativeCacheConfig
+
+	// CoalesceQueries shares one request between identical read queries
+	// (same SQL, params and hints) issued concurrently, so a burst of the
+	// same dashboard query hits the gateway once
+	CoalesceQueries bool
+	// CoalesceWrites, if set, collapses identical idempotent writes issued
+	// within a short window into one request
+	CoalesceWrites *WriteCoalescingConfig
+	// BatchExecs, if set, combines plain Exec calls issued within a short
+	// window into one /batch request
+	BatchExecs *WriteBatchingConfig
+	// DeadLetter, if set, retries writes that failed after every retry in
+	// the background and then hands them to a handler, so fire-and-forget
+	// writers don't silently lose data
+	DeadLetter *DeadLetterConfig
+
+	// Shards maps shard IDs to the API endpoints serving them directly,
+	// for QueryShard and QueryShards
+	Shards map[string]string
+	// ShardBreaker tunes the circuit breakers guarding each shard (default:
+	// open after 5 failures in 30s, retry after 15s)
+	ShardBreaker *ShardBreakerConfig
+
+	// Sharding is the platform's sharding configuration, see
+	// LoadShardingConfig. When set, statements comparing their table's
+	// shard key column with a value carry it as the routing hint, so the
+	// gateway routes them to the owning shard directly.
+	Sharding *ShardingConfig
+
+	// HotKeys, if set, tracks request rates per routing key (the shardKey
+	// hint) and reports keys above a threshold, to catch hot tenants
+	// before their shard saturates
+	HotKeys *HotKeyConfig
+
+	// Hedging, if set, sends read queries that are slow to answer again to
+	// another of Endpoints, taking the first successful response
+	Hedging *HedgingConfig
+
+	// AdaptiveTimeouts, if set, bounds each attempt of a Query or Exec by a
+	// timeout learned from the latencies of its fingerprint, within
+	// Config.Timeout
+	AdaptiveTimeouts *AdaptiveTimeoutConfig
+
+	// ResultSampling, if set, checks a fraction of query results against
+	// data-quality rules and reports the violations
+	ResultSampling *ResultSamplingConfig
+
+	// SlowQueries, if set, reports Query and Exec calls slower than a
+	// threshold, optionally with their EXPLAIN plan
+	SlowQueries *SlowQueryConfig
+
+	// Probes tunes ReadinessHandler (default: see ProbeConfig)
+	Probes *ProbeConfig
+
+	// Transport, if set, sends the client's HTTP requests, so clients can
+	// share sockets (see ClientManager). Closing the client leaves its idle
+	// connections open. Nil gives the client a transport of its own.
+	Transport http.RoundTripper
+	// Limiter, if set, sends the client's HTTP requests under caps shared
+	// with the other clients using it, instead of Transport
+	Limiter *Limiter
+	// Dialer, if set, opens the network connections of WebSocket
+	// transactions; HTTP requests dial through the transport
+	Dialer func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	// OfflineFallback, if set, runs Query and Exec calls against an
+	// embedded database while the gateway is unreachable, marking their
+	// responses Offline
+	OfflineFallback *OfflineConfig
+
+	// Standby, if set, health-checks a standby gateway and promotes it for
+	// Query and Exec calls while the primary keeps failing
+	Standby *StandbyConfig
 }
 
 // PoolConfig configures connection pooling
@@ -40,6 +209,22 @@ type PoolConfig struct {
 	MaxConnections      int
 	IdleTimeout         time.Duration
 	HealthCheckInterval time.Duration
+	// AcquireTimeout bounds how long a request waits for a connection when
+	// all MaxConnections are in use. Zero waits until the request's context
+	// ends.
+	AcquireTimeout time.Duration
+	// MaxLifetime recycles connections after this long, so traffic follows
+	// DNS and load balancer changes. Zero keeps connections indefinitely.
+	MaxLifetime time.Duration
+	// MaxUseCount recycles connections after this many requests. Zero means
+	// no limit.
+	MaxUseCount int64
+	// PingAfterIdle checks connections idle for longer with a /health
+	// request before use and from the health check loop, replacing broken
+	// ones. Zero disables pings.
+	PingAfterIdle time.Duration
+	// PingTimeout bounds each ping (default: 5s)
+	PingTimeout time.Duration
 }
 
 // ErrorResponse represents an error response from the API
@@ -54,10 +239,31 @@ type ErrorResponse struct {
 type QueryResponse struct {
 	Success       bool                     `json:"success"`
 	Data          []map[string]interface{} `json:"data,omitempty"`
+	Columns       []ColumnMeta             `json:"columns,omitempty"`
 	RowCount      int                      `json:"rowCount,omitempty"`
+	AffectedRows  int64                    `json:"affectedRows,omitempty"`
+	LastInsertID  int64                    `json:"lastInsertId,omitempty"`
 	ExecutionTime float64                  `json:"executionTime,omitempty"`
 	Cached        bool                     `json:"cached,omitempty"`
 	Error         *ErrorResponse           `json:"error,omitempty"`
+	// Region is the region or colo that served the query, when the gateway
+	// or the edge in front of it reports one
+	Region string `json:"region,omitempty"`
+	// Shard is the shard that ran the query, when the gateway reports it
+	Shard string `json:"shard,omitempty"`
+	// QueryID is the ID the query ran under, for CancelQuery and for
+	// finding it in the gateway's logs
+	QueryID string `json:"queryId,omitempty"`
+	// Stale is set on a result served from the client-side result cache
+	// past its TTL while it is refreshed in the background
+	Stale bool `json:"-"`
+	// Offline is set on a result of Config.OfflineFallback's embedded
+	// database, served while the gateway was unreachable
+	Offline bool `json:"-"`
+
+	// maxAge and noStore are the server's Cache-Control hint for the result
+	maxAge  time.Duration
+	noStore bool
 }
 
 // BatchQueryResponse represents a batch query response
@@ -69,8 +275,8 @@ type BatchQueryResponse struct {
 
 // HealthCheckResponse represents a health check response
 type HealthCheckResponse struct {
-	Status    string `json:"status"`
-	Database  struct {
+	Status   string `json:"status"`
+	Database struct {
 		Connected    bool    `json:"connected"`
 		ResponseTime float64 `json:"responseTime,omitempty"`
 	} `json:"database"`
@@ -87,6 +293,37 @@ type Client struct {
 	pool          *pool.Pool
 	httpClient    *http.Client
 	retryStrategy *retry.Strategy
+	sessions      *websocket.Manager
+	txQueue       *txQueue
+	decoder       *rowDecoder
+	schema        *schemaListeners
+	queries       *queryListeners
+	constraints   *ConstraintRegistry
+	stats         *clientStats
+	results       *resultCache
+	breakers      *breaker.Set
+	flights       *flightGroup
+	writes        *writeCoalescer
+	batcher       *writeBatcher
+	deadLetters   *deadLetterQueue
+	hotKeys       *hotKeyTracker
+	balancer      *balancer
+	hedger        *hedger
+	slowQueries   *slowQueryReporter
+	debug         *debugRecorder
+	timeouts      *adaptiveTimeouts
+	sampler       *resultSampler
+	probes        *probes
+	offline       *offlineFallback
+	standby       *standby
+	life          *lifecycle
+	// local is the wrangler dev instance NewLocalClient launched
+	local *localProcess
+	// wsBlocked is set once a WebSocket dial failed under
+	// TransactionTransportAuto, sending later transactions over HTTP
+	wsBlocked int32
+	closeOnce sync.Once
+	closeErr  error
 }
 
 // NewClient creates a new WorkerSQL client from a DSN string or config
@@ -115,7 +352,33 @@ func NewClient(configOrDSN interface{}) (*Client, error) {
 	}
 
 	client := &Client{
-		config: config,
+		config:      config,
+		txQueue:     newTxQueue(config.MaxConcurrentTransactions),
+		decoder:     newRowDecoder(config),
+		schema:      newSchemaListeners(),
+		queries:     newQueryListeners(),
+		constraints: &ConstraintRegistry{},
+		stats:       newClientStats(),
+		results:     newResultCache(config.ResultCache, config.NegativeCache),
+		breakers:    newShardBreakers(config),
+		flights:     newFlightGroup(config.CoalesceQueries),
+		writes:      newWriteCoalescer(config.CoalesceWrites),
+		hotKeys:     newHotKeyTracker(config.HotKeys),
+		balancer:    newBalancer(config.Endpoints, config.LoadBalancer),
+		hedger:      newHedger(config.Hedging, config.Endpoints),
+		timeouts:    newAdaptiveTimeouts(config.AdaptiveTimeouts, config.Timeout),
+		probes:      newProbes(config.Probes),
+		debug:       newDebugRecorder(config),
+		life:        newLifecycle(),
+	}
+	client.batcher = newWriteBatcher(client, config.BatchExecs)
+	client.deadLetters = newDeadLetterQueue(client, config.DeadLetter)
+	client.slowQueries = newSlowQueryReporter(client, config.SlowQueries)
+	client.sampler = newResultSampler(client, config.ResultSampling)
+	client.offline = newOfflineFallback(config.OfflineFallback, client.decoder)
+	client.standby = newStandby(client, config.Standby)
+	if client.results != nil {
+		client.schema.add(func(change SchemaChange) { client.results.invalidate(change.Tables) })
 	}
 
 	// Initialize retry strategy
@@ -124,8 +387,28 @@ func NewClient(configOrDSN interface{}) (*Client, error) {
 		InitialDelay:      config.RetryDelay,
 		MaxDelay:          30 * time.Second,
 		BackoffMultiplier: 2.0,
+		OnRetry: func(int, error) {
+			atomic.AddInt64(&client.stats.retries, 1)
+		},
 	})
 
+	client.sessions = websocket.NewManager(config.APIEndpoint, config.APIKey, websocket.ManagerOptions{
+		IdleTimeout:               config.TransactionIdleTimeout,
+		TransactionsPerConnection: config.TransactionsPerConnection,
+		Heartbeat: websocket.HeartbeatOptions{
+			Interval:    config.TransactionHeartbeatInterval,
+			MaxDuration: config.MaxTransactionDuration,
+		},
+		Dial: config.Dialer,
+	})
+
+	var transport http.RoundTripper
+	if config.Limiter != nil {
+		transport = sharedTransport{config.Limiter}
+	} else if config.Transport != nil {
+		transport = sharedTransport{config.Transport}
+	}
+
 	// Initialize connection pool if enabled
 	if config.Pooling != nil && config.Pooling.Enabled {
 		client.pool = pool.NewPool(pool.Options{
@@ -136,19 +419,40 @@ func NewClient(configOrDSN interface{}) (*Client, error) {
 			IdleTimeout:         config.Pooling.IdleTimeout,
 			ConnectionTimeout:   config.Timeout,
 			HealthCheckInterval: config.Pooling.HealthCheckInterval,
+			AcquireTimeout:      config.Pooling.AcquireTimeout,
+			MaxLifetime:         config.Pooling.MaxLifetime,
+			MaxUseCount:         config.Pooling.MaxUseCount,
+			PingAfterIdle:       config.Pooling.PingAfterIdle,
+			PingTimeout:         config.Pooling.PingTimeout,
+			Transport:           transport,
 		})
 	} else {
 		// Create default HTTP client
 		client.httpClient = &http.Client{
-			Timeout: config.Timeout,
+			Timeout:   config.Timeout,
+			Transport: transport,
 		}
 	}
 
+	client.balancer.startHealthChecks(func(ctx context.Context, endpoint string) error {
+		err := client.doRequest(withEndpoint(ctx, endpoint), "GET", "/health", nil, nil)
+		if err == nil {
+			client.probes.healthy()
+		}
+		return err
+	})
+	client.standby.start()
+
 	return client, nil
 }
 
 // Query executes a SQL query
 func (c *Client) Query(ctx context.Context, sql string, params ...interface{}) (*QueryResponse, error) {
+	sql, params, err := expandParams(sql, params)
+	if err != nil {
+		return nil, err
+	}
+
 	request := map[string]interface{}{
 		"sql": sql,
 	}
@@ -156,15 +460,102 @@ func (c *Client) Query(ctx context.Context, sql string, params ...interface{}) (
 		request["params"] = params
 	}
 
-	var response QueryResponse
-	err := c.retryStrategy.Execute(ctx, func() error {
-		return c.doRequest(ctx, "POST", "/query", request, &response)
+	return c.query(ctx, request)
+}
+
+func (c *Client) query(ctx context.Context, request map[string]interface{}) (*QueryResponse, error) {
+	op := "Query"
+	if request["mode"] == "exec" {
+		op = "Exec"
+	}
+	ctx = applyContextCacheHint(ctx, request)
+	sql, _ := request["sql"].(string)
+	c.queries.notify(op, sql)
+	budget := budgetFrom(ctx)
+	if err := budget.admit(1); err != nil {
+		return nil, err
+	}
+	defer budget.spend(time.Now())
+	ctx, err := withIdempotencyKey(ctx, "", op == "Exec" || !isReadStatement(sql))
+	if err != nil {
+		return nil, err
+	}
+	applyContextShardKey(ctx, request)
+	c.applyRoutingKey(request)
+	c.trackHotKey(request)
+	return c.cachedQuery(ctx, request, func(ctx context.Context) (*QueryResponse, error) {
+		return c.coalesced(ctx, request, func(ctx context.Context) (*QueryResponse, error) {
+			return c.coalescedWrite(ctx, request, func(ctx context.Context) (*QueryResponse, error) {
+				return c.execute(ctx, op, request)
+			})
+		})
 	})
+}
 
+// execute sends a /query request
+func (c *Client) execute(ctx context.Context, op string, request map[string]interface{}) (*QueryResponse, error) {
+	sql, _ := request["sql"].(string)
+	ctx, err := c.standby.route(ctx, op, request)
 	if err != nil {
 		return nil, err
 	}
+	if c.config.ExternalBlobs != nil {
+		if params, ok := request["params"].([]interface{}); ok {
+			params, err := c.externalizeParams(ctx, params)
+			if err != nil {
+				return nil, fmt.Errorf("invalid params: %w", err)
+			}
+			request["params"] = params
+		}
+	}
 
+	var response QueryResponse
+	var queryID string
+	start := time.Now()
+	callCtx := ctx
+	ctx, timings := startTimings(ctx, "/query")
+	instrument(ctx, c.config.ProfilingLabels, op, sql, func(ctx context.Context) {
+		if c.batcher.accepts(ctx, request) {
+			err = c.batcher.submit(ctx, request, &response)
+			return
+		}
+		ctx, queryID = withQueryID(ctx)
+		err = c.retryStrategy.Execute(ctx, func() error {
+			return c.timeouts.attempt(ctx, request, func(ctx context.Context) error {
+				return c.sendQuery(ctx, request, &response)
+			})
+		})
+	})
+	err = timings.wrap(err)
+	if err != nil && queryID != "" {
+		c.cancelAbandoned(callCtx, queryID, request)
+	}
+	if response.QueryID == "" {
+		response.QueryID = queryID
+	}
+	c.stats.recordResponse(start, &response, err)
+	c.slowQueries.observe(op, request, start, err)
+	c.debug.record(op, sql, start, &response, err)
+
+	if err != nil {
+		if offline, ok := c.offline.fallback(callCtx, op, request, err); ok {
+			return offline, nil
+		}
+		return nil, c.deadLetters.handle(callCtx, request, err)
+	}
+	c.offline.online()
+
+	if response.Success {
+		c.schema.observe(sql)
+		c.results.observe(sql)
+	}
+	c.decoder.decodeRows(response.Columns, response.Data)
+	c.sampler.observe(sql, response.Data)
+	if c.config.ExternalBlobs != nil {
+		if err := c.resolveRows(ctx, response.Data); err != nil {
+			return nil, err
+		}
+	}
 	return &response, nil
 }
 
@@ -190,30 +581,129 @@ func (c *Client) QueryRow(ctx context.Context, sql string, params ...interface{}
 }
 
 // Exec executes a SQL statement (INSERT, UPDATE, DELETE)
-func (c *Client) Exec(ctx context.Context, sql string, params ...interface{}) (*QueryResponse, error) {
-	return c.Query(ctx, sql, params...)
+func (c *Client) Exec(ctx context.Context, sql string, params ...interface{}) (*ExecResponse, error) {
+	sql, params, err := expandParams(sql, params)
+	if err != nil {
+		return nil, err
+	}
+
+	request := map[string]interface{}{
+		"sql":  sql,
+		"mode": "exec",
+	}
+	if len(params) > 0 {
+		request["params"] = params
+	}
+
+	response, err := c.query(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	return newExecResponse(response), nil
 }
 
-// BatchQuery executes multiple queries
-func (c *Client) BatchQuery(ctx context.Context, queries []map[string]interface{}) (*BatchQueryResponse, error) {
+// BatchStatement is one statement of a batch
+type BatchStatement struct {
+	SQL    string        `json:"sql"`
+	Params []interface{} `json:"params,omitempty"`
+}
+
+// BatchOptions controls how the gateway executes a batch
+type BatchOptions struct {
+	// Atomic runs the batch in a single transaction; if any statement fails,
+	// none of the batch's changes are applied
+	Atomic bool
+	// StopOnError skips the statements after the first failing one
+	StopOnError bool
+	// IdempotencyKey is sent as the Idempotency-Key header so the gateway
+	// applies the batch once however often it is retried. Batches with a
+	// write get a generated key shared by their retries otherwise.
+	IdempotencyKey string
+}
+
+// BatchQuery executes multiple statements in one request. Results are
+// returned in statement order.
+func (c *Client) BatchQuery(ctx context.Context, statements []BatchStatement, opts BatchOptions) (*BatchQueryResponse, error) {
+	expanded := make([]BatchStatement, len(statements))
+	writes := false
+	for i, stmt := range statements {
+		sql, args, err := expandParams(stmt.SQL, stmt.Params)
+		if err != nil {
+			return nil, fmt.Errorf("statement %d: %w", i, err)
+		}
+		expanded[i] = BatchStatement{SQL: sql, Params: args}
+		writes = writes || !isReadStatement(sql)
+	}
+	ctx, err := withIdempotencyKey(ctx, opts.IdempotencyKey, writes)
+	if err != nil {
+		return nil, err
+	}
+
 	request := map[string]interface{}{
-		"queries": queries,
+		"queries": expanded,
+	}
+	if opts.Atomic {
+		request["transaction"] = true
+	}
+	if opts.StopOnError {
+		request["stopOnError"] = true
 	}
 
+	for _, statement := range expanded {
+		c.queries.notify("BatchQuery", statement.SQL)
+	}
+	budget := budgetFrom(ctx)
+	if err := budget.admit(len(expanded)); err != nil {
+		return nil, err
+	}
+	defer budget.spend(time.Now())
+
 	var response BatchQueryResponse
-	err := c.retryStrategy.Execute(ctx, func() error {
-		return c.doRequest(ctx, "POST", "/batch", request, &response)
+	start := time.Now()
+	ctx, timings := startTimings(ctx, "/batch")
+	instrument(ctx, c.config.ProfilingLabels, "BatchQuery", "", func(ctx context.Context) {
+		err = c.retryStrategy.Execute(ctx, func() error {
+			return c.doRequest(ctx, "POST", "/batch", request, &response)
+		})
 	})
+	err = timings.wrap(err)
 
 	if err != nil {
+		c.stats.record(len(statements), time.Since(start), len(statements), 0)
 		return nil, err
 	}
 
+	failed, cached := 0, 0
+	for i := range response.Results {
+		if !response.Results[i].Success {
+			failed++
+		} else if response.Results[i].Cached {
+			cached++
+		}
+	}
+	c.stats.record(len(statements), time.Since(start), failed, cached)
+
+	for i := range response.Results {
+		if response.Results[i].Success && i < len(expanded) {
+			c.schema.observe(expanded[i].SQL)
+			c.results.observe(expanded[i].SQL)
+		}
+		c.decoder.decodeRows(response.Results[i].Columns, response.Results[i].Data)
+	}
+
 	return &response, nil
 }
 
 // Transaction executes a function within a transaction
-func (c *Client) Transaction(ctx context.Context, fn func(ctx context.Context, tx *TransactionClient) error) error {
+func (c *Client) Transaction(ctx context.Context, fn func(ctx context.Context, tx *TransactionClient) error) (err error) {
+	instrument(ctx, c.config.ProfilingLabels, "Transaction", "", func(ctx context.Context) {
+		err = c.transaction(ctx, fn)
+	})
+	return err
+}
+
+func (c *Client) transaction(ctx context.Context, fn func(ctx context.Context, tx *TransactionClient) error) error {
 	tx, err := c.BeginTx(ctx)
 	if err != nil {
 		return err
@@ -236,24 +726,59 @@ func (c *Client) Transaction(ctx context.Context, fn func(ctx context.Context, t
 	return tx.Commit(ctx)
 }
 
-// BeginTx starts a new transaction
+// BeginTx starts a new transaction. When the client's
+// MaxConcurrentTransactions or the server's transaction limit is reached,
+// BeginTx waits until a transaction can be started or ctx ends.
 func (c *Client) BeginTx(ctx context.Context) (*TransactionClient, error) {
-	wsClient := websocket.NewTransactionClient(c.config.APIEndpoint, c.config.APIKey)
-	
-	if err := wsClient.Connect(ctx); err != nil {
+	return c.beginTx(ctx, c.acquireTxConn)
+}
+
+// beginTx starts a transaction on the connection returned by acquire
+func (c *Client) beginTx(ctx context.Context, acquire func(ctx context.Context) (txConn, func(error), error)) (*TransactionClient, error) {
+	if err := c.life.enter(true); err != nil {
+		return nil, err
+	}
+	finish := func() {
+		c.txQueue.release()
+		c.life.leave(true)
+	}
+
+	if err := c.txQueue.acquire(ctx); err != nil {
+		c.life.leave(true)
+		return nil, fmt.Errorf("failed to begin transaction: waiting for slot: %w", err)
+	}
+
+	conn, releaseConn, err := acquire(ctx)
+	if err != nil {
+		finish()
 		return nil, fmt.Errorf("failed to connect for transaction: %w", err)
 	}
 
-	if err := wsClient.Begin(ctx); err != nil {
-		_ = wsClient.Close()
+	if err := c.txQueue.begin(ctx, conn); err != nil {
+		releaseConn(err)
+		finish()
 		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
 
 	return &TransactionClient{
-		wsClient: wsClient,
+		conn:        conn,
+		releaseConn: releaseConn,
+		decoder:     c.decoder,
+		schema:      c.schema,
+		queries:     c.queries,
+		results:     c.results,
+		stats:       c.stats,
+		labels:      c.config.ProfilingLabels,
+		onFinish:    finish,
 	}, nil
 }
 
+// TransactionQueueDepth returns the number of BeginTx calls currently
+// waiting for a client or server transaction slot
+func (c *Client) TransactionQueueDepth() int {
+	return c.txQueue.depth()
+}
+
 // Health checks the health of the database
 func (c *Client) Health(ctx context.Context) (*HealthCheckResponse, error) {
 	var response HealthCheckResponse
@@ -261,6 +786,7 @@ func (c *Client) Health(ctx context.Context) (*HealthCheckResponse, error) {
 	if err != nil {
 		return nil, err
 	}
+	c.probes.healthy()
 	return &response, nil
 }
 
@@ -274,23 +800,49 @@ func (c *Client) GetPoolStats() map[string]interface{} {
 	}
 }
 
-// Close closes the client and all connections
+// Close closes the client and all connections immediately, abandoning
+// requests in flight; see Shutdown for a graceful close. Queries after
+// Close fail with ErrClientClosed.
 func (c *Client) Close() error {
-	if c.pool != nil {
-		return c.pool.Close()
-	}
-	if c.httpClient != nil {
-		c.httpClient.CloseIdleConnections()
-	}
-	return nil
+	c.life.close()
+	c.closeOnce.Do(func() {
+		c.balancer.close()
+		c.standby.close()
+		c.deadLetters.close()
+		c.slowQueries.close()
+		_ = c.sessions.Close()
+		if c.pool != nil {
+			c.closeErr = c.pool.Close()
+		}
+		if c.httpClient != nil {
+			c.httpClient.CloseIdleConnections()
+		}
+		c.local.stop()
+	})
+	return c.closeErr
 }
 
 func (c *Client) doRequest(ctx context.Context, method, path string, body interface{}, response interface{}) error {
+	if !admitted(ctx) {
+		if err := c.life.enter(false); err != nil {
+			return err
+		}
+		defer c.life.leave(false)
+	}
+
 	var httpClient *http.Client
 
+	// Phase timings for timeout diagnostics, when the caller collects them
+	timings := timingsFrom(ctx)
+	timings.beginAttempt()
+	defer timings.endAttempt()
+
 	// Get HTTP client from pool or use default
 	if c.pool != nil {
+		acquireStart := time.Now()
 		conn, err := c.pool.Acquire(ctx)
+		waited := time.Since(acquireStart)
+		timings.record(func(t *RequestTimings) { t.PoolWait += waited })
 		if err != nil {
 			return fmt.Errorf("failed to acquire connection: %w", err)
 		}
@@ -301,38 +853,35 @@ func (c *Client) doRequest(ctx context.Context, method, path string, body interf
 	}
 
 	// Prepare request body
-	var bodyReader io.Reader
+	var bodyBytes []byte
 	if body != nil {
-		bodyBytes, err := json.Marshal(body)
-		if err != nil {
+		var err error
+		if bodyBytes, err = json.Marshal(body); err != nil {
 			return fmt.Errorf("failed to marshal request: %w", err)
 		}
-		bodyReader = bytes.NewReader(bodyBytes)
 	}
 
-	// Create request
-	url := c.config.APIEndpoint + path
-	req, err := http.NewRequestWithContext(ctx, method, url, bodyReader)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+	if c.config.ClientTrace != nil {
+		if trace := c.config.ClientTrace(ctx, method, path); trace != nil {
+			ctx = httptrace.WithClientTrace(ctx, trace)
+		}
 	}
-
-	// Set headers
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("User-Agent", "WorkerSQL-GoSDK/1.0.0")
-	if c.config.APIKey != "" {
-		req.Header.Set("Authorization", "Bearer "+c.config.APIKey)
+	if timings != nil {
+		ctx = httptrace.WithClientTrace(ctx, timings.trace())
 	}
 
 	// Execute request
-	resp, err := httpClient.Do(req)
+	resp, err := c.send(ctx, httpClient, method, path, bodyBytes)
 	if err != nil {
-		return fmt.Errorf("request failed: %w", err)
+		return err
 	}
 	defer resp.Body.Close()
 
 	// Read response body
+	readStart := time.Now()
 	respBody, err := io.ReadAll(resp.Body)
+	read := time.Since(readStart)
+	timings.record(func(t *RequestTimings) { t.Transfer += read })
 	if err != nil {
 		return fmt.Errorf("failed to read response: %w", err)
 	}
@@ -340,66 +889,246 @@ func (c *Client) doRequest(ctx context.Context, method, path string, body interf
 	// Check status code
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		var errResp ErrorResponse
-		if err := json.Unmarshal(respBody, &errResp); err == nil {
-			return fmt.Errorf("%s: %s", errResp.Code, errResp.Message)
+		if err := json.Unmarshal(respBody, &errResp); err == nil && (errResp.Code != "" || errResp.Message != "") {
+			return &statusError{status: resp.StatusCode, msg: fmt.Sprintf("%s: %s", errResp.Code, errResp.Message), code: errResp.Code, message: errResp.Message}
 		}
-		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(respBody))
+		return &statusError{status: resp.StatusCode, msg: fmt.Sprintf("HTTP %d: %s", resp.StatusCode, string(respBody))}
 	}
 
-	// Parse response
+	// Parse response. Numbers are kept as json.Number until row decoding
+	// so precision is never lost before column types are known.
 	if response != nil {
-		if err := json.Unmarshal(respBody, response); err != nil {
+		decodeStart := time.Now()
+		dec := json.NewDecoder(bytes.NewReader(respBody))
+		dec.UseNumber()
+		err := dec.Decode(response)
+		decoded := time.Since(decodeStart)
+		timings.record(func(t *RequestTimings) { t.Decode += decoded })
+		if err != nil {
 			return fmt.Errorf("failed to parse response: %w", err)
 		}
+		if qr, ok := response.(*QueryResponse); ok {
+			if qr.Region == "" {
+				qr.Region = servedRegion(resp.Header)
+			}
+			if qr.Shard == "" {
+				qr.Shard = resp.Header.Get(shardHeader)
+			}
+			qr.maxAge, qr.noStore = cacheControl(resp.Header)
+		}
 	}
 
 	return nil
 }
 
+// send sends a request to the endpoint of ctx. With several
+// Config.Endpoints, a request that couldn't connect or was answered as
+// unavailable, so wasn't processed, fails over to the next endpoint.
+func (c *Client) send(ctx context.Context, httpClient *http.Client, method, path string, body []byte) (*http.Response, error) {
+	_, pinned := ctx.Value(endpointKey{}).(string)
+	tried := triedEndpointsFrom(ctx)
+	var endpoint string
+	if !pinned && c.balancer != nil {
+		// Hedged requests start on an endpoint the other hasn't used
+		endpoint = c.balancer.pickExcept(tried)
+	}
+	if endpoint == "" {
+		endpoint = c.endpoint(ctx)
+	}
+	for {
+		tried.add(endpoint)
+		var bodyReader io.Reader
+		if body != nil {
+			bodyReader = bytes.NewReader(body)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, endpoint+path, bodyReader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+
+		// Set headers
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "WorkerSQL-GoSDK/1.0.0")
+		if c.config.APIKey != "" {
+			req.Header.Set("Authorization", "Bearer "+c.config.APIKey)
+		}
+		for name, values := range requestHeadersFrom(ctx) {
+			req.Header[name] = values
+		}
+		c.setDeadline(ctx, req.Header)
+
+		sent := time.Now()
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			// Callers giving up say nothing about the endpoint
+			if !errors.Is(err, context.Canceled) {
+				c.balancer.observe(endpoint, 0, true)
+			}
+			c.standby.observe(endpoint, err)
+			if next := c.failover(pinned, tried); next != "" && isDialError(err) {
+				endpoint = next
+				continue
+			}
+			return nil, fmt.Errorf("request failed: %w", err)
+		}
+		c.balancer.observe(endpoint, time.Since(sent), resp.StatusCode >= http.StatusInternalServerError)
+		c.standby.observeResponse(endpoint, resp)
+		if unavailableStatus(resp.StatusCode) {
+			if next := c.failover(pinned, tried); next != "" {
+				resp.Body.Close()
+				endpoint = next
+				continue
+			}
+		}
+		return resp, nil
+	}
+}
+
+// Querier runs queries and statements. It is implemented by Client,
+// TransactionClient and Session, so helpers can take any of them.
+type Querier interface {
+	Query(ctx context.Context, sql string, params ...interface{}) (*QueryResponse, error)
+	Exec(ctx context.Context, sql string, params ...interface{}) (*ExecResponse, error)
+}
+
+var (
+	_ Querier = (*Client)(nil)
+	_ Querier = (*TransactionClient)(nil)
+	_ Querier = (*Session)(nil)
+)
+
 // TransactionClient represents a transaction
 type TransactionClient struct {
-	wsClient *websocket.TransactionClient
+	conn        txConn
+	releaseConn func(error)
+	decoder     *rowDecoder
+	schema      *schemaListeners
+	queries     *queryListeners
+	results     *resultCache
+	stats       *clientStats
+	labels      bool
+	onFinish    func()
+	finishOnce  sync.Once
+	done        int32
+	// session is the Session the transaction runs on, if any
+	session *Session
+	// varsSet is set once Set changed a session variable, so the
+	// connection isn't reused by other transactions
+	varsSet int32
+}
+
+// isDone reports whether the transaction was committed or rolled back, after
+// which its session may already serve another transaction
+func (tx *TransactionClient) isDone() bool {
+	return atomic.LoadInt32(&tx.done) == 1
 }
 
 // Query executes a query within the transaction
 func (tx *TransactionClient) Query(ctx context.Context, sql string, params ...interface{}) (*QueryResponse, error) {
-	wsResp, err := tx.wsClient.Query(ctx, sql, params)
+	if tx.isDone() {
+		return nil, ErrTxDone
+	}
+
+	sql, params, err := expandParams(sql, params)
 	if err != nil {
 		return nil, err
 	}
 
-	return &QueryResponse{
-		Success:       wsResp.Success,
-		Data:          wsResp.Data,
-		RowCount:      wsResp.RowCount,
-		ExecutionTime: wsResp.ExecutionTime,
-		Cached:        wsResp.Cached,
-	}, nil
+	var wsResp *websocket.QueryResponse
+	start := time.Now()
+	tx.queries.notify("TxQuery", sql)
+	budget := budgetFrom(ctx)
+	if err := budget.admit(1); err != nil {
+		return nil, err
+	}
+	defer budget.spend(time.Now())
+	instrument(ctx, tx.labels, "TxQuery", sql, func(ctx context.Context) {
+		wsResp, err = tx.conn.Query(ctx, sql, params)
+	})
+	if err != nil {
+		tx.stats.recordResponse(start, nil, err)
+		return nil, err
+	}
+	tx.schema.observe(sql)
+	tx.results.observe(sql)
+
+	resp := tx.decoder.queryResponseFromWS(wsResp)
+	tx.stats.recordResponse(start, resp, nil)
+	return resp, nil
 }
 
 // Exec executes a statement within the transaction
-func (tx *TransactionClient) Exec(ctx context.Context, sql string, params ...interface{}) (*QueryResponse, error) {
-	return tx.Query(ctx, sql, params...)
+func (tx *TransactionClient) Exec(ctx context.Context, sql string, params ...interface{}) (*ExecResponse, error) {
+	if tx.isDone() {
+		return nil, ErrTxDone
+	}
+
+	sql, params, err := expandParams(sql, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var wsResp *websocket.QueryResponse
+	start := time.Now()
+	tx.queries.notify("TxExec", sql)
+	budget := budgetFrom(ctx)
+	if err := budget.admit(1); err != nil {
+		return nil, err
+	}
+	defer budget.spend(time.Now())
+	instrument(ctx, tx.labels, "TxExec", sql, func(ctx context.Context) {
+		wsResp, err = tx.conn.Exec(ctx, sql, params)
+	})
+	if err != nil {
+		tx.stats.recordResponse(start, nil, err)
+		return nil, err
+	}
+	tx.schema.observe(sql)
+	tx.results.observe(sql)
+
+	resp := tx.decoder.queryResponseFromWS(wsResp)
+	tx.stats.recordResponse(start, resp, nil)
+	return newExecResponse(resp), nil
 }
 
 // Commit commits the transaction
 func (tx *TransactionClient) Commit(ctx context.Context) error {
-	err := tx.wsClient.Commit(ctx)
-	if closeErr := tx.wsClient.Close(); closeErr != nil && err == nil {
-		err = closeErr
+	if tx.isDone() {
+		return ErrTxDone
 	}
+
+	err := tx.conn.Commit(ctx)
+	tx.release(err)
 	return err
 }
 
 // Rollback rolls back the transaction
 func (tx *TransactionClient) Rollback(ctx context.Context) error {
-	err := tx.wsClient.Rollback(ctx)
-	if closeErr := tx.wsClient.Close(); closeErr != nil && err == nil {
-		err = closeErr
+	if tx.isDone() {
+		return ErrTxDone
 	}
+
+	err := tx.conn.Rollback(ctx)
+	tx.release(err)
 	return err
 }
 
+// release returns the session for reuse, or closes it if the transaction
+// ended with an error and the session state is uncertain, or changed
+// session variables
+func (tx *TransactionClient) release(err error) {
+	tx.finishOnce.Do(func() {
+		atomic.StoreInt32(&tx.done, 1)
+		if err == nil && atomic.LoadInt32(&tx.varsSet) == 1 {
+			err = errSessionVarsSet
+		}
+		tx.releaseConn(err)
+		if tx.onFinish != nil {
+			tx.onFinish()
+		}
+	})
+}
+
 func configFromDSN(parsed *dsn.ParsedDSN) Config {
 	config := Config{
 		Host:        parsed.Host,
@@ -429,6 +1158,62 @@ func configFromDSN(parsed *dsn.ParsedDSN) Config {
 			config.RetryAttempts = attempts
 		}
 	}
+	if useNumber, ok := parsed.Params["useNumber"]; ok && useNumber == "true" {
+		config.UseNumber = true
+	}
+	if labels, ok := parsed.Params["profilingLabels"]; ok && labels == "true" {
+		config.ProfilingLabels = true
+	}
+	if coalesce, ok := parsed.Params["coalesceQueries"]; ok && coalesce == "true" {
+		config.CoalesceQueries = true
+	}
+	if parseTime, ok := parsed.Params["parseTime"]; ok && parseTime == "true" {
+		config.ParseTime = true
+	}
+	if loc, ok := parsed.Params["loc"]; ok {
+		if l, err := time.LoadLocation(loc); err == nil {
+			config.Location = l
+		}
+	}
+	if heartbeat, ok := parsed.Params["transactionHeartbeat"]; ok {
+		if t, err := time.ParseDuration(heartbeat + "ms"); err == nil {
+			config.TransactionHeartbeatInterval = t
+		}
+	}
+	if maxDuration, ok := parsed.Params["maxTransactionDuration"]; ok {
+		if t, err := time.ParseDuration(maxDuration + "ms"); err == nil && t > 0 {
+			config.MaxTransactionDuration = t
+		}
+	}
+	if maxTx, ok := parsed.Params["maxConcurrentTransactions"]; ok {
+		if n, err := strconv.Atoi(maxTx); err == nil && n > 0 {
+			config.MaxConcurrentTransactions = n
+		}
+	}
+	if idleTimeout, ok := parsed.Params["transactionIdleTimeout"]; ok {
+		if t, err := time.ParseDuration(idleTimeout + "ms"); err == nil {
+			config.TransactionIdleTimeout = t
+		}
+	}
+	if perConn, ok := parsed.Params["transactionsPerConnection"]; ok {
+		if n, err := strconv.Atoi(perConn); err == nil && n > 0 {
+			config.TransactionsPerConnection = n
+		}
+	}
+	if transport, ok := parsed.Params["transactionTransport"]; ok {
+		config.TransactionTransport = TransactionTransport(transport)
+	}
+
+	// Multi-host DSNs balance over every host
+	config.Endpoints = dsn.GetAPIEndpoints(parsed)
+	if strategy, ok := parsed.Params["loadBalancer"]; ok && len(config.Endpoints) > 0 {
+		switch strategy {
+		case "roundRobin":
+			config.LoadBalancer = &LoadBalancerConfig{Strategy: RoundRobin()}
+		case "lowestLatency":
+			config.LoadBalancer = &LoadBalancerConfig{Strategy: LowestLatency()}
+		}
+	}
 
 	// Connection pooling params
 	if pooling, ok := parsed.Params["pooling"]; ok && pooling == "true" {
@@ -449,12 +1234,30 @@ func configFromDSN(parsed *dsn.ParsedDSN) Config {
 				config.Pooling.MaxConnections = max
 			}
 		}
+		if lifetime, ok := parsed.Params["maxLifetime"]; ok {
+			if t, err := time.ParseDuration(lifetime + "ms"); err == nil && t > 0 {
+				config.Pooling.MaxLifetime = t
+			}
+		}
+		if maxUses, ok := parsed.Params["maxUseCount"]; ok {
+			if n, err := strconv.ParseInt(maxUses, 10, 64); err == nil && n > 0 {
+				config.Pooling.MaxUseCount = n
+			}
+		}
+		if pingAfter, ok := parsed.Params["pingAfterIdle"]; ok {
+			if t, err := time.ParseDuration(pingAfter + "ms"); err == nil && t > 0 {
+				config.Pooling.PingAfterIdle = t
+			}
+		}
 	}
 
 	return config
 }
 
 func validateConfig(config *Config) error {
+	if config.APIEndpoint == "" && len(config.Endpoints) > 0 {
+		config.APIEndpoint = config.Endpoints[0]
+	}
 	if config.APIEndpoint == "" && config.Host == "" {
 		return fmt.Errorf("either APIEndpoint or Host must be specified")
 	}
@@ -484,5 +1287,17 @@ func validateConfig(config *Config) error {
 		config.RetryDelay = 1 * time.Second
 	}
 
+	if config.TransactionIdleTimeout == 0 {
+		config.TransactionIdleTimeout = 30 * time.Second
+	}
+
+	if err := config.TransactionTransport.validate(); err != nil {
+		return err
+	}
+
+	if config.TransactionHeartbeatInterval == 0 {
+		config.TransactionHeartbeatInterval = 10 * time.Second
+	}
+
 	return nil
 }
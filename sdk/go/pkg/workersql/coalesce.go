@@ -0,0 +1,73 @@
+package workersql
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// flightGroup coalesces identical concurrent read queries into one request
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+type flight struct {
+	done     chan struct{}
+	response *QueryResponse
+	err      error
+}
+
+func newFlightGroup(enabled bool) *flightGroup {
+	if !enabled {
+		return nil
+	}
+	return &flightGroup{flights: make(map[string]*flight)}
+}
+
+// coalesced runs fetch for request, or waits for the identical request
+// already in flight and shares its response. The shared request is detached
+// from the cancellation of the caller that started it, so callers leaving
+// early don't fail the others; each caller still returns when its own ctx
+// ends.
+func (c *Client) coalesced(ctx context.Context, request map[string]interface{}, fetch func(context.Context) (*QueryResponse, error)) (*QueryResponse, error) {
+	g := c.flights
+	if g == nil {
+		return fetch(ctx)
+	}
+	key := readKey(ctx, request)
+	if key == "" {
+		return fetch(ctx)
+	}
+
+	g.mu.Lock()
+	f, inFlight := g.flights[key]
+	if !inFlight {
+		f = &flight{done: make(chan struct{})}
+		g.flights[key] = f
+	}
+	g.mu.Unlock()
+
+	if inFlight {
+		atomic.AddInt64(&c.stats.coalesced, 1)
+	} else {
+		go func() {
+			f.response, f.err = fetch(context.WithoutCancel(ctx))
+			g.mu.Lock()
+			delete(g.flights, key)
+			g.mu.Unlock()
+			close(f.done)
+		}()
+	}
+
+	select {
+	case <-f.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	// Every caller gets its own rows to modify
+	return cloneResponse(f.response), nil
+}
@@ -0,0 +1,254 @@
+package workersql
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ColumnMeta describes a result column as reported by the gateway
+type ColumnMeta struct {
+	Name         string `json:"name"`
+	DatabaseType string `json:"type"`
+	Nullable     bool   `json:"nullable"`
+	Precision    int    `json:"precision,omitempty"`
+}
+
+// timeLayouts are the textual DATETIME/TIMESTAMP/DATE formats accepted from
+// the gateway, most specific first
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// rowDecoder converts JSON-decoded row values into Go types
+type rowDecoder struct {
+	// useNumber keeps untyped numbers and DECIMAL values as json.Number
+	useNumber bool
+	// parseTime decodes DATETIME, TIMESTAMP and DATE columns into time.Time
+	parseTime bool
+	// loc is the zone DATETIME values without an offset are interpreted in
+	loc *time.Location
+}
+
+func newRowDecoder(config Config) *rowDecoder {
+	loc := config.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	return &rowDecoder{useNumber: config.UseNumber, parseTime: config.ParseTime, loc: loc}
+}
+
+// decodeRows converts JSON-decoded row values into Go types according to
+// the response's column metadata. Rows arrive with numbers as json.Number;
+// values that don't match their declared type keep their JSON value, with
+// numbers converted to float64 unless useNumber is set.
+func (d *rowDecoder) decodeRows(columns []ColumnMeta, rows []map[string]interface{}) {
+	types := make(map[string]string, len(columns))
+	for _, col := range columns {
+		types[col.Name] = col.DatabaseType
+	}
+
+	for _, row := range rows {
+		for name, v := range row {
+			if v == nil {
+				continue
+			}
+			if databaseType, ok := types[name]; ok {
+				v = d.decodeValue(databaseType, v)
+			}
+			row[name] = d.normalize(v)
+		}
+	}
+}
+
+// normalize converts json.Number values, including those nested in JSON
+// objects and arrays, to float64 unless useNumber is set
+func (d *rowDecoder) normalize(v interface{}) interface{} {
+	if d.useNumber {
+		return v
+	}
+
+	switch t := v.(type) {
+	case json.Number:
+		if f, err := t.Float64(); err == nil {
+			return f
+		}
+		return t.String()
+	case map[string]interface{}:
+		for k, e := range t {
+			t[k] = d.normalize(e)
+		}
+	case []interface{}:
+		for i, e := range t {
+			t[i] = d.normalize(e)
+		}
+	}
+	return v
+}
+
+func (d *rowDecoder) decodeValue(databaseType string, v interface{}) interface{} {
+	switch baseType(databaseType) {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "INTEGER", "BIGINT", "YEAR":
+		if n, ok := toInt64(v); ok {
+			return n
+		}
+		if isUnsigned(databaseType) {
+			if n, ok := toUint64(v); ok {
+				return n
+			}
+		}
+	case "DECIMAL", "NUMERIC":
+		if d.useNumber {
+			if n, ok := toNumber(v); ok {
+				return n
+			}
+			return v
+		}
+		if f, ok := toFloat64(v); ok {
+			return f
+		}
+	case "FLOAT", "DOUBLE", "REAL":
+		if f, ok := toFloat64(v); ok {
+			return f
+		}
+	case "BOOL", "BOOLEAN":
+		if b, ok := toBool(v); ok {
+			return b
+		}
+	case "DATETIME", "TIMESTAMP", "DATE":
+		if !d.parseTime {
+			return v
+		}
+		if t, ok := toTime(v, d.loc); ok {
+			return t
+		}
+	case "BLOB", "TINYBLOB", "MEDIUMBLOB", "LONGBLOB", "BINARY", "VARBINARY":
+		if s, ok := v.(string); ok {
+			if b, err := base64.StdEncoding.DecodeString(s); err == nil {
+				return b
+			}
+		}
+	}
+	return v
+}
+
+// baseType normalizes a type name such as "bigint(20) unsigned" to "BIGINT"
+func baseType(databaseType string) string {
+	t := strings.ToUpper(strings.TrimSpace(databaseType))
+	if i := strings.IndexAny(t, "( "); i >= 0 {
+		t = t[:i]
+	}
+	return t
+}
+
+func isUnsigned(databaseType string) bool {
+	return strings.Contains(strings.ToUpper(databaseType), "UNSIGNED")
+}
+
+func toInt64(v interface{}) (int64, bool) {
+	switch t := v.(type) {
+	case json.Number:
+		n, err := t.Int64()
+		return n, err == nil
+	case float64:
+		return int64(t), t == float64(int64(t))
+	case string:
+		n, err := strconv.ParseInt(t, 10, 64)
+		return n, err == nil
+	case bool:
+		if t {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func toUint64(v interface{}) (uint64, bool) {
+	var s string
+	switch t := v.(type) {
+	case json.Number:
+		s = t.String()
+	case string:
+		s = t
+	default:
+		return 0, false
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	return n, err == nil
+}
+
+// toNumber returns v as an exact json.Number. DECIMAL values may arrive as
+// JSON numbers or as strings.
+func toNumber(v interface{}) (json.Number, bool) {
+	switch t := v.(type) {
+	case json.Number:
+		return t, true
+	case string:
+		if _, ok := new(big.Float).SetString(t); ok {
+			return json.Number(t), true
+		}
+	}
+	return "", false
+}
+
+func toFloat64(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case json.Number:
+		f, err := t.Float64()
+		return f, err == nil
+	case float64:
+		return t, true
+	case string:
+		f, err := strconv.ParseFloat(t, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func toBool(v interface{}) (bool, bool) {
+	switch t := v.(type) {
+	case bool:
+		return t, true
+	case json.Number:
+		f, err := t.Float64()
+		return f != 0, err == nil
+	case float64:
+		return t != 0, true
+	case string:
+		b, err := strconv.ParseBool(t)
+		return b, err == nil
+	}
+	return false, false
+}
+
+// toTime parses a textual time value. Values carrying an offset are
+// converted to loc; values without one are interpreted in loc.
+func toTime(v interface{}, loc *time.Location) (time.Time, bool) {
+	s, ok := v.(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	if s == "0000-00-00" || s == "0000-00-00 00:00:00" {
+		// MySQL zero dates map to the zero time, as in go-sql-driver/mysql
+		return time.Time{}, true
+	}
+	for _, layout := range timeLayouts {
+		if layout == time.RFC3339Nano {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t.In(loc), true
+			}
+			continue
+		}
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,276 @@
+package workersql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrConstraintViolation is matched by every *ConstraintError
+var ErrConstraintViolation = errors.New("logical constraint violation")
+
+// UniqueConstraint declares that the values of Columns are unique across
+// every row of Table, on whichever shard the rows live
+type UniqueConstraint struct {
+	Table   string
+	Columns []string
+}
+
+// ConstraintError reports a row that would violate a registered constraint
+type ConstraintError struct {
+	// Kind is "unique" or "foreign key"
+	Kind    string
+	Table   string
+	Columns []string
+	Values  []interface{}
+	// RefTable is the referenced table of a foreign key
+	RefTable string
+}
+
+func (e *ConstraintError) Error() string {
+	if e.Kind == "foreign key" {
+		return fmt.Sprintf("%s: %s%v = %v has no matching row in %s", ErrConstraintViolation, e.Table, e.Columns, e.Values, e.RefTable)
+	}
+	return fmt.Sprintf("%s: %s%v = %v already exists", ErrConstraintViolation, e.Table, e.Columns, e.Values)
+}
+
+// Is reports whether target is ErrConstraintViolation
+func (e *ConstraintError) Is(target error) bool {
+	return target == ErrConstraintViolation
+}
+
+// ConstraintRegistry holds logical constraints the storage layer can't
+// enforce, such as uniqueness across shards and foreign keys between tables
+// on different shards. The client enforces them best-effort: CheckInsert and
+// InsertChecked look for conflicting rows before writing, and
+// ValidateConstraints finds violations after the fact. A concurrent writer
+// can still slip in between a check and the insert, so periodic validation
+// remains necessary.
+type ConstraintRegistry struct {
+	mu     sync.RWMutex
+	unique []UniqueConstraint
+	keys   []ForeignKey
+}
+
+// AddUnique registers a uniqueness constraint on columns of table
+func (r *ConstraintRegistry) AddUnique(table string, columns ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.unique = append(r.unique, UniqueConstraint{Table: table, Columns: columns})
+}
+
+// AddForeignKey registers a logical foreign key. fk.RefColumns must name
+// the referenced columns.
+func (r *ConstraintRegistry) AddForeignKey(fk ForeignKey) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys = append(r.keys, fk)
+}
+
+// Unique returns the uniqueness constraints registered for table, or every
+// one if table is empty
+func (r *ConstraintRegistry) Unique(table string) []UniqueConstraint {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var out []UniqueConstraint
+	for _, u := range r.unique {
+		if table == "" || u.Table == table {
+			out = append(out, u)
+		}
+	}
+	return out
+}
+
+// ForeignKeys returns the foreign keys registered on table, or every one if
+// table is empty
+func (r *ConstraintRegistry) ForeignKeys(table string) []ForeignKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var out []ForeignKey
+	for _, fk := range r.keys {
+		if table == "" || fk.Table == table {
+			out = append(out, fk)
+		}
+	}
+	return out
+}
+
+// Constraints returns the client's logical constraint registry
+func (c *Client) Constraints() *ConstraintRegistry {
+	return c.constraints
+}
+
+// CheckInsert checks row against the constraints registered for table: no
+// existing row may share the values of a unique constraint, and every
+// foreign key must reference an existing row. Constraints involving a
+// missing or NULL value are skipped. A violation is returned as a
+// *ConstraintError.
+func (c *Client) CheckInsert(ctx context.Context, table string, row map[string]interface{}) error {
+	for _, u := range c.constraints.Unique(table) {
+		values, ok := constraintValues(row, u.Columns)
+		if !ok {
+			continue
+		}
+		exists, err := c.rowExists(ctx, table, u.Columns, values)
+		if err != nil {
+			return fmt.Errorf("checking unique %s%v: %w", table, u.Columns, err)
+		}
+		if exists {
+			return &ConstraintError{Kind: "unique", Table: table, Columns: u.Columns, Values: values}
+		}
+	}
+
+	for _, fk := range c.constraints.ForeignKeys(table) {
+		values, ok := constraintValues(row, fk.Columns)
+		if !ok {
+			continue
+		}
+		exists, err := c.rowExists(ctx, fk.RefTable, fk.RefColumns, values)
+		if err != nil {
+			return fmt.Errorf("checking foreign key %s%v: %w", table, fk.Columns, err)
+		}
+		if !exists {
+			return &ConstraintError{Kind: "foreign key", Table: table, Columns: fk.Columns, Values: values, RefTable: fk.RefTable}
+		}
+	}
+	return nil
+}
+
+// InsertChecked runs CheckInsert and inserts row into table if it passes
+func (c *Client) InsertChecked(ctx context.Context, table string, row map[string]interface{}) (*ExecResponse, error) {
+	if err := c.CheckInsert(ctx, table, row); err != nil {
+		return nil, err
+	}
+
+	columns := bulkColumns([]map[string]interface{}{row})
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("insert: row has no columns")
+	}
+	sql, params := buildBulkInsert(table, columns, []map[string]interface{}{row}, BulkOptions{})
+	resp, err := c.Exec(ctx, sql, params...)
+	if err != nil {
+		return nil, err
+	}
+	return resp, resp.failure()
+}
+
+// constraintValues returns the row's values for columns, reporting false if
+// any is missing or NULL
+func constraintValues(row map[string]interface{}, columns []string) ([]interface{}, bool) {
+	values, ok := rowKey(row, columns)
+	if !ok {
+		return nil, false
+	}
+	for _, v := range values {
+		if v == nil {
+			return nil, false
+		}
+	}
+	return values, true
+}
+
+func (c *Client) rowExists(ctx context.Context, table string, columns []string, values []interface{}) (bool, error) {
+	conditions := make([]string, len(columns))
+	for i, col := range columns {
+		conditions[i] = quoteIdentifier(col) + " = ?"
+	}
+	sql := "SELECT 1 AS found FROM " + quoteIdentifier(table) + " WHERE " + strings.Join(conditions, " AND ") + " LIMIT 1"
+
+	resp, err := c.Query(ctx, sql, values...)
+	if err != nil {
+		return false, err
+	}
+	if err := resp.failure(); err != nil {
+		return false, err
+	}
+	return len(resp.Data) > 0, nil
+}
+
+// DuplicateKey is a set of values shared by several rows despite a unique
+// constraint
+type DuplicateKey struct {
+	Constraint UniqueConstraint
+	Values     []interface{}
+	Count      int64
+}
+
+// ConstraintReport is the outcome of ValidateConstraints
+type ConstraintReport struct {
+	Duplicates []DuplicateKey
+	// Integrity holds the orphaned rows of registered foreign keys
+	Integrity *IntegrityReport
+}
+
+// Valid reports whether no violations were found
+func (r *ConstraintReport) Valid() bool {
+	return len(r.Duplicates) == 0 && (r.Integrity == nil || len(r.Integrity.Violations) == 0)
+}
+
+// ValidateConstraints scans for rows that violate the registered
+// constraints: duplicate values of unique constraints, and foreign key
+// values without a parent row (checked with CheckIntegrity). Up to
+// opts.MaxViolations duplicates are reported per constraint.
+func (c *Client) ValidateConstraints(ctx context.Context, opts IntegrityOptions) (*ConstraintReport, error) {
+	if opts.MaxViolations <= 0 {
+		opts.MaxViolations = DefaultIntegrityMaxViolations
+	}
+	report := &ConstraintReport{}
+
+	for _, u := range c.constraints.Unique("") {
+		cols := quoteIdentifiers(u.Columns)
+		sql := fmt.Sprintf("SELECT %s, COUNT(*) AS duplicate_count FROM %s GROUP BY %s HAVING COUNT(*) > 1 ORDER BY %s LIMIT %d",
+			cols, quoteIdentifier(u.Table), cols, cols, opts.MaxViolations)
+		resp, err := c.Query(ctx, sql)
+		if err == nil {
+			err = resp.failure()
+		}
+		if err != nil {
+			return report, fmt.Errorf("validating unique %s%v: %w", u.Table, u.Columns, err)
+		}
+		for _, row := range resp.Data {
+			values, _ := rowKey(row, u.Columns)
+			var count int64
+			_ = ScanValue(row["duplicate_count"], &count)
+			report.Duplicates = append(report.Duplicates, DuplicateKey{Constraint: u, Values: values, Count: count})
+		}
+	}
+
+	if keys := c.constraints.ForeignKeys(""); len(keys) > 0 {
+		opts.Graph = NewFKGraph(nil, nil)
+		opts.Keys = keys
+		integrity, err := c.CheckIntegrity(ctx, opts)
+		report.Integrity = integrity
+		if err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// StartConstraintValidator runs ValidateConstraints every interval until ctx
+// ends or the returned stop function is called, passing each outcome to fn
+func (c *Client) StartConstraintValidator(ctx context.Context, interval time.Duration, opts IntegrityOptions, fn func(*ConstraintReport, error)) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				fn(c.ValidateConstraints(ctx, opts))
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
@@ -0,0 +1,351 @@
+package workersql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Dead-letter defaults
+const (
+	DefaultDeadLetterRetryInterval = 5 * time.Second
+	DefaultDeadLetterQueueSize     = 1000
+)
+
+// ErrWriteDeferred matches, with errors.Is, errors of failed writes that
+// were handed to Config.DeadLetter, so callers leaving failed writes to it
+// can ignore them
+var ErrWriteDeferred = errors.New("write deferred to dead-letter handling")
+
+// DeadLetterConfig keeps writes that failed after every retry instead of
+// only returning their error. Writes that may succeed later (transport
+// errors, timeouts, 429 and 5xx responses) are retried in the background
+// by priority, then handed to Handler; statements the server rejected are
+// returned as usual.
+type DeadLetterConfig struct {
+	// Handler receives writes that failed for good. It is called from the
+	// goroutine of the failed call or of the retry queue, and shouldn't
+	// block.
+	Handler func(DeadLetter)
+	// RetryAttempts is how many more times a failed write is sent from a
+	// background queue before it reaches Handler. Zero hands it over
+	// straight away.
+	RetryAttempts int
+	// RetryInterval is the delay between background attempts of a write
+	// (default: 5s)
+	RetryInterval time.Duration
+	// QueueSize caps the writes waiting for a background attempt; when it
+	// is full the write with the lowest priority goes to Handler (default:
+	// 1000)
+	QueueSize int
+}
+
+// DeadLetter is a write that failed for good, with what is needed to
+// replay it: sending SQL and Params again under IdempotencyKey, through
+// WithIdempotencyKey, applies it at most once
+type DeadLetter struct {
+	SQL            string
+	Params         []interface{}
+	IdempotencyKey string
+	// Priority is the one given with WithWritePriority
+	Priority int
+	// Retries counts the background attempts made after the call failed
+	Retries int
+	// Err is the error of the last attempt
+	Err error
+	// FailedAt is when the call itself failed
+	FailedAt time.Time
+}
+
+type writePriorityKey struct{}
+
+// WithWritePriority sets the priority of writes sent with ctx in the
+// dead-letter retry queue: writes with a higher priority are retried first
+// and evicted last (default: 0)
+func WithWritePriority(ctx context.Context, priority int) context.Context {
+	return context.WithValue(ctx, writePriorityKey{}, priority)
+}
+
+// deadLetterQueue retries failed writes in the background and hands those
+// that keep failing to the handler. The methods of a nil queue return
+// errors unchanged.
+type deadLetterQueue struct {
+	client   *Client
+	config   DeadLetterConfig
+	wake     chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+
+	mu      sync.Mutex
+	pending []*failedWrite
+	closed  bool
+	// attempting counts writes taken from pending for an attempt
+	attempting int
+}
+
+type failedWrite struct {
+	ctx     context.Context
+	request map[string]interface{}
+	letter  DeadLetter
+	due     time.Time
+}
+
+func newDeadLetterQueue(client *Client, config *DeadLetterConfig) *deadLetterQueue {
+	if config == nil || config.Handler == nil {
+		return nil
+	}
+	q := &deadLetterQueue{
+		client: client,
+		config: *config,
+		wake:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+	}
+	if q.config.RetryInterval <= 0 {
+		q.config.RetryInterval = DefaultDeadLetterRetryInterval
+	}
+	if q.config.QueueSize <= 0 {
+		q.config.QueueSize = DefaultDeadLetterQueueSize
+	}
+	if q.config.RetryAttempts > 0 {
+		q.wg.Add(1)
+		go q.run()
+	}
+	return q
+}
+
+// deadLetterable reports whether a write failing with err may succeed if
+// sent again later
+func deadLetterable(err error) bool {
+	if errors.Is(err, ErrClientClosed) {
+		return false
+	}
+	var status *statusError
+	if errors.As(err, &status) {
+		return status.status >= 500 || status.status == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// handle takes over the write request that failed with err when it may
+// succeed later, returning the error for its caller. A write whose caller
+// cancelled it or let its deadline pass is left alone: the query is being
+// cancelled on the gateway, so it must not run again later.
+func (q *deadLetterQueue) handle(ctx context.Context, request map[string]interface{}, err error) error {
+	if q == nil || ctx.Err() != nil || !deadLetterable(err) {
+		return err
+	}
+	sql, _ := request["sql"].(string)
+	if request["mode"] != "exec" && isReadStatement(sql) {
+		return err
+	}
+
+	params, _ := request["params"].([]interface{})
+	priority, _ := ctx.Value(writePriorityKey{}).(int)
+	write := &failedWrite{
+		// The write outlives the call, keeping its headers and endpoint
+		ctx:     context.WithoutCancel(ctx),
+		request: make(map[string]interface{}, len(request)),
+		letter: DeadLetter{
+			SQL:            sql,
+			Params:         params,
+			IdempotencyKey: requestHeadersFrom(ctx).Get(IdempotencyKeyHeader),
+			Priority:       priority,
+			Err:            err,
+			FailedAt:       time.Now(),
+		},
+	}
+	for k, v := range request {
+		write.request[k] = v
+	}
+
+	if evicted := q.enqueue(write); evicted != nil {
+		q.deliver(evicted)
+	}
+	return fmt.Errorf("%w: %w", ErrWriteDeferred, err)
+}
+
+// enqueue queues write for a background attempt, returning the write to
+// dead-letter instead: write itself without retries or once closed, or
+// the lowest priority write when the queue is full
+func (q *deadLetterQueue) enqueue(write *failedWrite) *failedWrite {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.config.RetryAttempts <= 0 || q.closed {
+		return write
+	}
+	write.due = time.Now().Add(q.config.RetryInterval)
+
+	var evicted *failedWrite
+	if len(q.pending) >= q.config.QueueSize {
+		lowest := 0
+		for i, w := range q.pending {
+			if w.letter.Priority < q.pending[lowest].letter.Priority {
+				lowest = i
+			}
+		}
+		if q.pending[lowest].letter.Priority >= write.letter.Priority {
+			return write
+		}
+		evicted = q.pending[lowest]
+		q.pending = append(q.pending[:lowest], q.pending[lowest+1:]...)
+	}
+	q.pending = append(q.pending, write)
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return evicted
+}
+
+// next removes and returns the due write with the highest priority, the
+// oldest first among equals, or returns how long until one is due
+func (q *deadLetterQueue) next(now time.Time) (*failedWrite, time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	best := -1
+	var wait time.Duration = -1
+	for i, w := range q.pending {
+		if w.due.After(now) {
+			if until := w.due.Sub(now); wait < 0 || until < wait {
+				wait = until
+			}
+			continue
+		}
+		if best < 0 || w.letter.Priority > q.pending[best].letter.Priority {
+			best = i
+		}
+	}
+	if best < 0 {
+		return nil, wait
+	}
+	write := q.pending[best]
+	q.pending = append(q.pending[:best], q.pending[best+1:]...)
+	q.attempting++
+	return write, 0
+}
+
+// drain makes every queued write due now, so Shutdown gets a last attempt
+// at them before close hands them to the handler
+func (q *deadLetterQueue) drain() {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	now := time.Now()
+	for _, w := range q.pending {
+		w.due = now
+	}
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// queued returns how many writes are waiting for or in an attempt
+func (q *deadLetterQueue) queued() int {
+	if q == nil {
+		return 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending) + q.attempting
+}
+
+func (q *deadLetterQueue) run() {
+	defer q.wg.Done()
+	for {
+		write, wait := q.next(time.Now())
+		if write != nil {
+			q.attempt(write)
+			q.mu.Lock()
+			q.attempting--
+			q.mu.Unlock()
+			continue
+		}
+
+		var due <-chan time.Time
+		var timer *time.Timer
+		if wait >= 0 {
+			timer = time.NewTimer(wait)
+			due = timer.C
+		}
+		select {
+		case <-q.stop:
+		case <-q.wake:
+		case <-due:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		select {
+		case <-q.stop:
+			return
+		default:
+		}
+	}
+}
+
+// attempt sends write again, requeueing it while it keeps failing in a
+// way that may clear up and it has attempts left
+func (q *deadLetterQueue) attempt(write *failedWrite) {
+	// Shutdown waits for the queue, so its attempts are let through
+	ctx := withAdmitted(write.ctx)
+	if timeout := q.client.config.Timeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var response QueryResponse
+	err := q.client.sendQuery(ctx, write.request, &response)
+	write.letter.Retries++
+	if err == nil {
+		if response.Success {
+			return
+		}
+		err = fmt.Errorf("write failed")
+		if response.Error != nil {
+			err = fmt.Errorf("%s: %s", response.Error.Code, response.Error.Message)
+		}
+	}
+	write.letter.Err = err
+
+	if response.Error != nil || !deadLetterable(err) || write.letter.Retries >= q.config.RetryAttempts {
+		q.deliver(write)
+		return
+	}
+	if evicted := q.enqueue(write); evicted != nil {
+		q.deliver(evicted)
+	}
+}
+
+func (q *deadLetterQueue) deliver(write *failedWrite) {
+	atomic.AddInt64(&q.client.stats.deadLetters, 1)
+	q.config.Handler(write.letter)
+}
+
+// close stops background attempts and hands the writes still queued to the
+// handler
+func (q *deadLetterQueue) close() {
+	if q == nil {
+		return
+	}
+	q.stopOnce.Do(func() { close(q.stop) })
+	q.wg.Wait()
+
+	q.mu.Lock()
+	q.closed = true
+	pending := q.pending
+	q.pending = nil
+	q.mu.Unlock()
+	for _, write := range pending {
+		q.deliver(write)
+	}
+}
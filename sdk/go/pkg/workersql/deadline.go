@@ -0,0 +1,89 @@
+package workersql
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DeadlineHeader carries the time, in milliseconds, the gateway has left to
+// answer a request before the client gives up on it
+const DeadlineHeader = "X-Request-Deadline-Ms"
+
+// DefaultDeadlineMargin is taken off the time a request has left, for the
+// response to travel back
+const DefaultDeadlineMargin = 25 * time.Millisecond
+
+// DeadlineConfig tunes deadline propagation. Each request tells the gateway
+// how long it has left, the earlier of its context's deadline and
+// Config.Timeout, so the gateway and Durable Object can abort work they
+// can't finish in time. The budget is relative to when the gateway receives
+// the request, so clocks needn't agree: a skewed clock can't make it expire
+// early or late, only the time the request spends in flight.
+type DeadlineConfig struct {
+	// Disabled stops the client from sending deadlines
+	Disabled bool
+	// Margin is taken off the remaining time to leave room for the
+	// response to come back (default: 25ms)
+	Margin time.Duration
+	// MinBudget is the smallest budget sent; a request with less time left
+	// still gets it, as the gateway would otherwise reject it outright
+	// (default: 1ms)
+	MinBudget time.Duration
+}
+
+type serverBudgetKey struct{}
+
+// WithServerBudget overrides the time the gateway is given for requests
+// sent with ctx: budget instead of the time the context has left, though
+// never more. A negative budget sends no deadline, letting the statement
+// run to completion on the gateway even if the client stops waiting.
+func WithServerBudget(ctx context.Context, budget time.Duration) context.Context {
+	return context.WithValue(ctx, serverBudgetKey{}, budget)
+}
+
+// setDeadline sets the DeadlineHeader of a request about to be sent with
+// ctx, when it has a deadline
+func (c *Client) setDeadline(ctx context.Context, header http.Header) {
+	config := c.config.Deadlines
+	if config == nil {
+		config = &DeadlineConfig{}
+	}
+	if config.Disabled {
+		return
+	}
+
+	budget, bounded := time.Duration(0), false
+	if deadline, ok := ctx.Deadline(); ok {
+		budget, bounded = time.Until(deadline), true
+	}
+	if timeout := c.config.Timeout; timeout > 0 && (!bounded || timeout < budget) {
+		budget, bounded = timeout, true
+	}
+	if override, ok := ctx.Value(serverBudgetKey{}).(time.Duration); ok {
+		if override < 0 {
+			return
+		}
+		if !bounded || override < budget {
+			budget, bounded = override, true
+		}
+	}
+	if !bounded {
+		return
+	}
+
+	margin := config.Margin
+	if margin <= 0 {
+		margin = DefaultDeadlineMargin
+	}
+	minBudget := config.MinBudget
+	if minBudget <= 0 {
+		minBudget = time.Millisecond
+	}
+	budget -= margin
+	if budget < minBudget {
+		budget = minBudget
+	}
+	header.Set(DeadlineHeader, strconv.FormatInt(budget.Milliseconds(), 10))
+}
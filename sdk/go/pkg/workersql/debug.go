@@ -0,0 +1,413 @@
+package workersql
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Debug handler defaults
+const (
+	// DefaultDebugRecentQueries is how many recent calls DebugHandler lists
+	DefaultDebugRecentQueries = 100
+	// DefaultDebugSlowQueries is how many slow calls DebugHandler lists
+	DefaultDebugSlowQueries = 50
+)
+
+// maxDebugSQL bounds the statement text kept for each recorded call
+const maxDebugSQL = 2000
+
+// redacted replaces secrets in the config shown by DebugHandler
+const redacted = "[REDACTED]"
+
+// DebugQuery is a Query or Exec call listed by DebugHandler. Its
+// parameters aren't kept, as they may hold personal data.
+type DebugQuery struct {
+	Time       time.Time `json:"time"`
+	Op         string    `json:"op"`
+	SQL        string    `json:"sql"`
+	DurationMs float64   `json:"durationMs"`
+	QueryID    string    `json:"queryId,omitempty"`
+	Shard      string    `json:"shard,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// DebugSnapshot is the state served by DebugHandler
+type DebugSnapshot struct {
+	Time          time.Time        `json:"time"`
+	Stats         Stats            `json:"stats"`
+	ResultCache   ResultCacheStats `json:"resultCache"`
+	Standby       *StandbyStatus   `json:"standby,omitempty"`
+	RecentQueries []DebugQuery     `json:"recentQueries"`
+	SlowQueries   []DebugQuery     `json:"slowQueries"`
+	// Config is the client's config with its secrets redacted
+	Config map[string]interface{} `json:"config"`
+}
+
+// debugRecorder keeps the last calls, and the last slow ones, in ring
+// buffers
+type debugRecorder struct {
+	threshold time.Duration
+
+	mu     sync.Mutex
+	recent debugRing
+	slow   debugRing
+}
+
+type debugRing struct {
+	entries []DebugQuery
+	next    int
+	full    bool
+}
+
+func newDebugRecorder(config Config) *debugRecorder {
+	threshold := DefaultSlowQueryThreshold
+	if config.SlowQueries != nil && config.SlowQueries.Threshold > 0 {
+		threshold = config.SlowQueries.Threshold
+	}
+	return &debugRecorder{
+		threshold: threshold,
+		recent:    debugRing{entries: make([]DebugQuery, DefaultDebugRecentQueries)},
+		slow:      debugRing{entries: make([]DebugQuery, DefaultDebugSlowQueries)},
+	}
+}
+
+// record adds the call of sql that started at start
+func (r *debugRecorder) record(op, sql string, start time.Time, response *QueryResponse, err error) {
+	if r == nil {
+		return
+	}
+	elapsed := time.Since(start)
+	if len(sql) > maxDebugSQL {
+		sql = sql[:maxDebugSQL] + "…"
+	}
+	entry := DebugQuery{
+		Time:       start,
+		Op:         op,
+		SQL:        sql,
+		DurationMs: float64(elapsed) / float64(time.Millisecond),
+		QueryID:    response.QueryID,
+		Shard:      response.Shard,
+	}
+	if err == nil {
+		err = response.failure()
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.recent.add(entry)
+	if elapsed >= r.threshold {
+		r.slow.add(entry)
+	}
+}
+
+// queries returns the recent and slow calls, newest first
+func (r *debugRecorder) queries() (recent, slow []DebugQuery) {
+	if r == nil {
+		return nil, nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.recent.list(), r.slow.list()
+}
+
+func (b *debugRing) add(entry DebugQuery) {
+	b.entries[b.next] = entry
+	b.next = (b.next + 1) % len(b.entries)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+func (b *debugRing) list() []DebugQuery {
+	n := b.next
+	if b.full {
+		n = len(b.entries)
+	}
+	out := make([]DebugQuery, 0, n)
+	for i := 1; i <= n; i++ {
+		out = append(out, b.entries[(b.next-i+len(b.entries))%len(b.entries)])
+	}
+	return out
+}
+
+// DebugSnapshot returns the state served by DebugHandler
+func (c *Client) DebugSnapshot() DebugSnapshot {
+	recent, slow := c.debug.queries()
+	snapshot := DebugSnapshot{
+		Time:          time.Now(),
+		Stats:         c.Stats(),
+		ResultCache:   c.ResultCacheStats(),
+		RecentQueries: recent,
+		SlowQueries:   slow,
+		Config:        redactConfig(c.config),
+	}
+	if c.standby != nil {
+		status := c.Standby()
+		snapshot.Standby = &status
+	}
+	return snapshot
+}
+
+// DebugHandler returns an http.Handler serving the client's live state:
+// stats, connection pool, result cache, recent and slow calls, and config
+// with its secrets redacted. The last segment of the path picks what is
+// served as JSON, "stats", "queries", "slow", "cache", "config", or
+// "json" for all of it; any other path serves an HTML page. Mount it
+// behind the application's own authentication:
+//
+//	mux.Handle("/debug/workersql/", http.StripPrefix("/debug/workersql", client.DebugHandler()))
+func (c *Client) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		snapshot := c.DebugSnapshot()
+		switch path.Base(r.URL.Path) {
+		case "stats":
+			writeDebugJSON(w, snapshot.Stats)
+		case "queries":
+			writeDebugJSON(w, snapshot.RecentQueries)
+		case "slow":
+			writeDebugJSON(w, snapshot.SlowQueries)
+		case "cache":
+			writeDebugJSON(w, snapshot.ResultCache)
+		case "config":
+			writeDebugJSON(w, snapshot.Config)
+		case "json":
+			writeDebugJSON(w, snapshot)
+		default:
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			if err := debugPage.Execute(w, debugView(r.URL.Path, snapshot)); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+		}
+	})
+}
+
+func writeDebugJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(v)
+}
+
+// redactConfig returns the fields of config set to other than their zero
+// value, with passwords, API keys, secrets and tokens replaced and the
+// credentials of URLs removed. Functions and interfaces are shown by type
+// only.
+func redactConfig(config Config) map[string]interface{} {
+	fields, _ := redactValue(reflect.ValueOf(config), "").(map[string]interface{})
+	return fields
+}
+
+func redactValue(v reflect.Value, name string) interface{} {
+	if isSecretField(name) {
+		if v.IsZero() {
+			return nil
+		}
+		return redacted
+	}
+	if d, ok := v.Interface().(time.Duration); ok {
+		return d.String()
+	}
+	switch v.Kind() {
+	case reflect.Func, reflect.Chan, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		if v.Kind() == reflect.Interface {
+			return reflect.TypeOf(v.Interface()).String()
+		}
+		return v.Type().String()
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		if loc, ok := v.Interface().(*time.Location); ok {
+			return loc.String()
+		}
+		return redactValue(v.Elem(), name)
+	case reflect.Struct:
+		fields := make(map[string]interface{})
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() || v.Field(i).IsZero() {
+				continue
+			}
+			if value := redactValue(v.Field(i), field.Name); value != nil {
+				fields[field.Name] = value
+			}
+		}
+		return fields
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return v.Type().String()
+		}
+		entries := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			entries[iter.Key().String()] = redactValue(iter.Value(), iter.Key().String())
+		}
+		return entries
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return fmt.Sprintf("%d bytes", v.Len())
+		}
+		items := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			items = append(items, redactValue(v.Index(i), name))
+		}
+		return items
+	case reflect.String:
+		return redactURL(v.String())
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return v.Interface()
+	}
+	return v.Type().String()
+}
+
+// isSecretField reports whether a field of this name holds a credential
+func isSecretField(name string) bool {
+	name = strings.ToLower(name)
+	for _, secret := range []string{"password", "apikey", "secret", "token", "credential"} {
+		if strings.Contains(name, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactURL replaces the password, and query parameters holding
+// credentials, of s if it is a URL
+func redactURL(s string) string {
+	if !strings.Contains(s, "://") {
+		return s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return s
+	}
+	if u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+		}
+	}
+	query := u.Query()
+	for key := range query {
+		if isSecretField(key) {
+			query.Set(key, redacted)
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+type debugPageView struct {
+	Base     string
+	Snapshot DebugSnapshot
+	Counters []debugCounter
+	Config   string
+}
+
+type debugCounter struct {
+	Name  string
+	Value interface{}
+}
+
+func debugView(urlPath string, snapshot DebugSnapshot) debugPageView {
+	base := "./"
+	if !strings.HasSuffix(urlPath, "/") {
+		base = path.Base(urlPath) + "/"
+	}
+	view := debugPageView{Base: base, Snapshot: snapshot}
+
+	stats := reflect.ValueOf(snapshot.Stats)
+	for i := 0; i < stats.NumField(); i++ {
+		if stats.Field(i).Kind() == reflect.Int64 {
+			view.Counters = append(view.Counters, debugCounter{stats.Type().Field(i).Name, stats.Field(i).Int()})
+		}
+	}
+	keys := make([]string, 0, len(snapshot.Stats.Pool))
+	for key := range snapshot.Stats.Pool {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		view.Counters = append(view.Counters, debugCounter{"Pool." + key, snapshot.Stats.Pool[key]})
+	}
+	config, _ := json.MarshalIndent(snapshot.Config, "", "  ")
+	view.Config = string(config)
+	return view
+}
+
+var debugPage = template.Must(template.New("debug").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>WorkerSQL client</title>
+<style>
+body { font-family: sans-serif; font-size: 14px; margin: 1.5em; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+td, th { border: 1px solid #ccc; padding: 2px 8px; text-align: left; vertical-align: top; }
+td.sql { font-family: monospace; max-width: 60em; overflow-wrap: anywhere; }
+.error { color: #b00; }
+</style>
+</head>
+<body>
+<h1>WorkerSQL client</h1>
+<p>{{.Snapshot.Time.Format "2006-01-02 15:04:05 MST"}} &middot; JSON:
+<a href="{{.Base}}stats">stats</a>, <a href="{{.Base}}queries">queries</a>, <a href="{{.Base}}slow">slow</a>,
+<a href="{{.Base}}cache">cache</a>, <a href="{{.Base}}config">config</a>, <a href="{{.Base}}json">all</a></p>
+
+<h2>Stats</h2>
+<table>
+{{range .Counters}}<tr><th>{{.Name}}</th><td>{{.Value}}</td></tr>
+{{end}}</table>
+
+<h2>Result cache</h2>
+<table>
+<tr><th>Hits</th><td>{{.Snapshot.ResultCache.Hits}}</td></tr>
+<tr><th>Stale hits</th><td>{{.Snapshot.ResultCache.StaleHits}}</td></tr>
+<tr><th>Negative hits</th><td>{{.Snapshot.ResultCache.NegativeHits}}</td></tr>
+<tr><th>Misses</th><td>{{.Snapshot.ResultCache.Misses}}</td></tr>
+<tr><th>Evictions</th><td>{{.Snapshot.ResultCache.Evictions}}</td></tr>
+<tr><th>Entries</th><td>{{.Snapshot.ResultCache.Entries}}</td></tr>
+</table>
+{{with .Snapshot.Standby}}
+<h2>Standby</h2>
+<table>
+<tr><th>Endpoint</th><td>{{.Endpoint}}</td></tr>
+<tr><th>Promoted</th><td>{{.Promoted}}</td></tr>
+<tr><th>Last error</th><td>{{.LastError}}</td></tr>
+</table>
+{{end}}
+<h2>Slow queries</h2>
+{{template "queries" .Snapshot.SlowQueries}}
+<h2>Recent queries</h2>
+{{template "queries" .Snapshot.RecentQueries}}
+<h2>Config</h2>
+<pre>{{.Config}}</pre>
+</body>
+</html>
+{{define "queries"}}{{if .}}<table>
+<tr><th>Time</th><th>Op</th><th>ms</th><th>Shard</th><th>SQL</th><th>Error</th></tr>
+{{range .}}<tr><td>{{.Time.Format "15:04:05.000"}}</td><td>{{.Op}}</td><td>{{printf "%.1f" .DurationMs}}</td><td>{{.Shard}}</td><td class="sql">{{.SQL}}</td><td class="error">{{.Error}}</td></tr>
+{{end}}</table>{{else}}<p>None</p>{{end}}{{end}}
+`))
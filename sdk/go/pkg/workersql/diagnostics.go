@@ -0,0 +1,206 @@
+package workersql
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RequestTimings breaks down where the time of an HTTP call went, across
+// all of its retry attempts
+type RequestTimings struct {
+	// PoolWait is the time spent waiting for a pooled connection
+	PoolWait time.Duration
+	DNS      time.Duration
+	Dial     time.Duration
+	TLS      time.Duration
+	// Server is the time from writing a request to its first response byte
+	Server time.Duration
+	// Transfer is the time spent reading response bodies
+	Transfer time.Duration
+	Decode   time.Duration
+	// Backoff is the time spent sleeping between retry attempts
+	Backoff time.Duration
+}
+
+// TimeoutError reports a call that failed because its context deadline
+// passed or the client timeout elapsed, with a breakdown telling server
+// latency apart from client-side queuing. It unwraps to the original error,
+// so errors.Is(err, context.DeadlineExceeded) keeps working.
+type TimeoutError struct {
+	// Op is the API path of the call, e.g. "/query"
+	Op       string
+	Elapsed  time.Duration
+	Attempts int
+	Timings  RequestTimings
+	Err      error
+}
+
+func (e *TimeoutError) Error() string {
+	t := e.Timings
+	phases := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"pool", t.PoolWait}, {"dns", t.DNS}, {"dial", t.Dial}, {"tls", t.TLS},
+		{"server", t.Server}, {"transfer", t.Transfer}, {"decode", t.Decode}, {"backoff", t.Backoff},
+	}
+	parts := make([]string, 0, len(phases))
+	for _, p := range phases {
+		if p.d > 0 {
+			parts = append(parts, fmt.Sprintf("%s %v", p.name, p.d.Round(time.Microsecond)))
+		}
+	}
+	breakdown := "no time recorded"
+	if len(parts) > 0 {
+		breakdown = strings.Join(parts, ", ")
+	}
+	return fmt.Sprintf("%s timed out after %v (%d attempts; %s): %v",
+		e.Op, e.Elapsed.Round(time.Microsecond), e.Attempts, breakdown, e.Err)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// isTimeout reports whether err comes from a passed deadline or an HTTP
+// client timeout
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// callTimings collects RequestTimings for one call. httptrace hooks run on
+// transport goroutines, so every update takes the lock.
+type callTimings struct {
+	mu       sync.Mutex
+	op       string
+	start    time.Time
+	attempts int
+	lastEnd  time.Time
+	timings  RequestTimings
+
+	// Start times of phases in progress, zero when none is
+	dnsStart, dialStart, tlsStart, serverStart time.Time
+}
+
+type callTimingsKey struct{}
+
+// startTimings attaches a collector for the call op to ctx
+func startTimings(ctx context.Context, op string) (context.Context, *callTimings) {
+	ct := &callTimings{op: op, start: time.Now()}
+	return context.WithValue(ctx, callTimingsKey{}, ct), ct
+}
+
+// timingsFrom returns the collector attached to ctx, or nil. The methods
+// of a nil collector do nothing.
+func timingsFrom(ctx context.Context) *callTimings {
+	ct, _ := ctx.Value(callTimingsKey{}).(*callTimings)
+	return ct
+}
+
+// beginAttempt counts an attempt, charging the gap since the previous one
+// to backoff
+func (ct *callTimings) beginAttempt() {
+	if ct == nil {
+		return
+	}
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	ct.attempts++
+	if !ct.lastEnd.IsZero() {
+		ct.timings.Backoff += time.Since(ct.lastEnd)
+	}
+}
+
+// endAttempt closes the phases an aborted attempt left open
+func (ct *callTimings) endAttempt() {
+	if ct == nil {
+		return
+	}
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	now := time.Now()
+	closePhase(&ct.timings.DNS, &ct.dnsStart, now)
+	closePhase(&ct.timings.Dial, &ct.dialStart, now)
+	closePhase(&ct.timings.TLS, &ct.tlsStart, now)
+	closePhase(&ct.timings.Server, &ct.serverStart, now)
+	ct.lastEnd = now
+}
+
+func closePhase(total *time.Duration, start *time.Time, now time.Time) {
+	if !start.IsZero() {
+		*total += now.Sub(*start)
+		*start = time.Time{}
+	}
+}
+
+// record applies fn to the timings under the lock
+func (ct *callTimings) record(fn func(*RequestTimings)) {
+	if ct == nil {
+		return
+	}
+	ct.mu.Lock()
+	fn(&ct.timings)
+	ct.mu.Unlock()
+}
+
+// mark starts or ends a phase at the current time
+func (ct *callTimings) mark(start *time.Time, total *time.Duration, begin bool) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	if begin {
+		*start = time.Now()
+		return
+	}
+	closePhase(total, start, time.Now())
+}
+
+// trace returns httptrace hooks recording connection and server phases
+func (ct *callTimings) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { ct.mark(&ct.dnsStart, &ct.timings.DNS, true) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { ct.mark(&ct.dnsStart, &ct.timings.DNS, false) },
+		ConnectStart: func(string, string) {
+			ct.mark(&ct.dialStart, &ct.timings.Dial, true)
+		},
+		ConnectDone: func(string, string, error) {
+			ct.mark(&ct.dialStart, &ct.timings.Dial, false)
+		},
+		TLSHandshakeStart: func() { ct.mark(&ct.tlsStart, &ct.timings.TLS, true) },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			ct.mark(&ct.tlsStart, &ct.timings.TLS, false)
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			ct.mark(&ct.serverStart, &ct.timings.Server, true)
+		},
+		GotFirstResponseByte: func() {
+			ct.mark(&ct.serverStart, &ct.timings.Server, false)
+		},
+	}
+}
+
+// wrap returns err as a *TimeoutError if it is a timeout
+func (ct *callTimings) wrap(err error) error {
+	if err == nil || !isTimeout(err) {
+		return err
+	}
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	return &TimeoutError{
+		Op:       ct.op,
+		Elapsed:  time.Since(ct.start),
+		Attempts: ct.attempts,
+		Timings:  ct.timings,
+		Err:      err,
+	}
+}
@@ -0,0 +1,181 @@
+package workersql
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// ErrInvalidEnum is returned when a value is not part of a registered enum,
+// whether it is bound as a parameter or scanned from a row
+var ErrInvalidEnum = errors.New("invalid enum value")
+
+// enumMapping is the registered mapping between a Go type and the values of
+// a MySQL ENUM or SET column
+type enumMapping struct {
+	typ    reflect.Type
+	toDB   map[interface{}]string
+	fromDB map[string]reflect.Value
+}
+
+var enums = struct {
+	sync.RWMutex
+	m map[reflect.Type]*enumMapping
+}{m: make(map[reflect.Type]*enumMapping)}
+
+// RegisterEnum registers the database values of the Go enum type T, used for
+// MySQL ENUM and SET columns. Once registered, T values bound as parameters
+// are sent as their database value, and ENUM columns scan into T; values
+// missing from the mapping fail with ErrInvalidEnum before reaching the
+// database or the application. Registering T again replaces its mapping.
+// RegisterEnum panics if two constants map to the same database value.
+//
+//	type Status int
+//
+//	const (
+//		StatusActive Status = iota
+//		StatusSuspended
+//	)
+//
+//	func init() {
+//		workersql.RegisterEnum(map[Status]string{
+//			StatusActive:    "active",
+//			StatusSuspended: "suspended",
+//		})
+//	}
+func RegisterEnum[T comparable](values map[T]string) {
+	m := &enumMapping{
+		typ:    reflect.TypeOf((*T)(nil)).Elem(),
+		toDB:   make(map[interface{}]string, len(values)),
+		fromDB: make(map[string]reflect.Value, len(values)),
+	}
+	for v, s := range values {
+		if _, dup := m.fromDB[s]; dup {
+			panic(fmt.Sprintf("workersql: RegisterEnum: duplicate database value %q for %s", s, m.typ))
+		}
+		m.toDB[v] = s
+		m.fromDB[s] = reflect.ValueOf(v)
+	}
+
+	enums.Lock()
+	enums.m[m.typ] = m
+	enums.Unlock()
+}
+
+// lookupEnum returns the mapping registered for t, or nil
+func lookupEnum(t reflect.Type) *enumMapping {
+	if t == nil {
+		return nil
+	}
+	enums.RLock()
+	defer enums.RUnlock()
+	return enums.m[t]
+}
+
+func (m *enumMapping) encode(v interface{}) (string, error) {
+	s, ok := m.toDB[v]
+	if !ok {
+		return "", fmt.Errorf("%w: %v is not a registered %s", ErrInvalidEnum, v, m.typ)
+	}
+	return s, nil
+}
+
+func (m *enumMapping) decode(s string) (reflect.Value, error) {
+	v, ok := m.fromDB[s]
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("%w: %q is not a registered %s", ErrInvalidEnum, s, m.typ)
+	}
+	return v, nil
+}
+
+// encodeEnums replaces registered enum values in params with their database
+// values
+func encodeEnums(params []interface{}) ([]interface{}, error) {
+	out := params
+	for i, p := range params {
+		m := lookupEnum(reflect.TypeOf(p))
+		if m == nil {
+			continue
+		}
+		s, err := m.encode(p)
+		if err != nil {
+			return nil, fmt.Errorf("param %d: %w", i+1, err)
+		}
+		if &out[0] == &params[0] {
+			out = append([]interface{}(nil), params...)
+		}
+		out[i] = s
+	}
+	return out, nil
+}
+
+// Set holds the members of a MySQL SET column whose values are a registered
+// enum type T. It is sent as a parameter as the comma-separated database
+// values, and scans from them.
+type Set[T comparable] []T
+
+// Value implements driver.Valuer
+func (s Set[T]) Value() (driver.Value, error) {
+	m, err := setMapping[T]()
+	if err != nil {
+		return nil, err
+	}
+	parts := make([]string, len(s))
+	for i, v := range s {
+		if parts[i], err = m.encode(v); err != nil {
+			return nil, err
+		}
+	}
+	return strings.Join(parts, ","), nil
+}
+
+// Scan implements sql.Scanner
+func (s *Set[T]) Scan(value interface{}) error {
+	if value == nil {
+		*s = nil
+		return nil
+	}
+	text, ok := stringValue(value)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into %T", value, s)
+	}
+	m, err := setMapping[T]()
+	if err != nil {
+		return err
+	}
+
+	set := Set[T]{}
+	if text != "" {
+		for _, part := range strings.Split(text, ",") {
+			v, err := m.decode(part)
+			if err != nil {
+				return err
+			}
+			set = append(set, v.Interface().(T))
+		}
+	}
+	*s = set
+	return nil
+}
+
+// Contains reports whether v is a member of the set
+func (s Set[T]) Contains(v T) bool {
+	for _, member := range s {
+		if member == v {
+			return true
+		}
+	}
+	return false
+}
+
+func setMapping[T comparable]() (*enumMapping, error) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	m := lookupEnum(t)
+	if m == nil {
+		return nil, fmt.Errorf("no enum registered for %s; call workersql.RegisterEnum first", t)
+	}
+	return m, nil
+}
@@ -0,0 +1,51 @@
+package workersql
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/healthfees-org/workersql/sdk/go/internal/websocket"
+)
+
+// ErrTransactionExpired is returned by statements and Commit on a transaction
+// that was rolled back because it exceeded Config.MaxTransactionDuration
+var ErrTransactionExpired = websocket.ErrTransactionExpired
+
+// ErrDeadlock matches, with errors.Is, errors of transactions the server
+// aborted to break a deadlock
+var ErrDeadlock = websocket.ErrDeadlock
+
+// ErrConflict matches, with errors.Is, errors of transactions the server
+// aborted on a serialization conflict with a concurrent transaction
+var ErrConflict = websocket.ErrConflict
+
+// ErrLockNotAvailable matches, with errors.Is, errors of locking reads whose
+// rows were locked by another transaction, with LockNoWait or once the
+// server's lock wait timed out
+var ErrLockNotAvailable = websocket.ErrLockNotAvailable
+
+// ErrTxDone is returned by any operation on a transaction that has already
+// been committed or rolled back
+var ErrTxDone = errors.New("transaction has already been committed or rolled back")
+
+// ErrClientClosed is returned for queries and transactions started after
+// Shutdown or Close
+var ErrClientClosed = errors.New("client is closed")
+
+// ErrNoRows is returned by GetByPK when no row has the requested key. It is
+// sql.ErrNoRows, so existing checks against that keep working.
+var ErrNoRows = sql.ErrNoRows
+
+// statusError is returned for non-2xx gateway responses, keeping the
+// status so transport failures can be told apart from rejected requests
+type statusError struct {
+	status int
+	msg    string
+	// code and message are those of the error body, if it has them
+	code    string
+	message string
+}
+
+func (e *statusError) Error() string {
+	return e.msg
+}
@@ -0,0 +1,101 @@
+package workersql
+
+import (
+	"fmt"
+
+	"github.com/healthfees-org/workersql/sdk/go/internal/websocket"
+)
+
+// ExecResponse represents the result of a write statement (INSERT, UPDATE,
+// DELETE). It implements database/sql.Result.
+type ExecResponse struct {
+	Success       bool
+	AffectedRows  int64
+	LastInsertID  int64
+	ExecutionTime float64
+	Error         *ErrorResponse
+	// Offline is set when Config.OfflineFallback ran the statement
+	Offline bool
+	// QueryID is the ID the statement ran under
+	QueryID string
+}
+
+// LastInsertId returns the auto-increment key generated by an INSERT
+func (r *ExecResponse) LastInsertId() (int64, error) {
+	return r.LastInsertID, nil
+}
+
+// RowsAffected returns the number of rows changed by the statement
+func (r *ExecResponse) RowsAffected() (int64, error) {
+	return r.AffectedRows, nil
+}
+
+// failure returns the error reported by an unsuccessful response, or nil
+func (r *ExecResponse) failure() error {
+	return responseFailure(r.Success, r.Error, "statement failed")
+}
+
+// failure returns the error reported by an unsuccessful response, or nil
+func (r *QueryResponse) failure() error {
+	return responseFailure(r.Success, r.Error, "query failed")
+}
+
+func responseFailure(success bool, e *ErrorResponse, fallback string) error {
+	if success {
+		return nil
+	}
+	if e != nil {
+		return fmt.Errorf("%s: %s", e.Code, e.Message)
+	}
+	return fmt.Errorf("%s", fallback)
+}
+
+func newExecResponse(resp *QueryResponse) *ExecResponse {
+	affected := resp.AffectedRows
+	if affected == 0 && resp.RowCount > 0 {
+		// Gateways predating exec metadata report affected rows as rowCount
+		affected = int64(resp.RowCount)
+	}
+
+	return &ExecResponse{
+		Success:       resp.Success,
+		AffectedRows:  affected,
+		LastInsertID:  resp.LastInsertID,
+		ExecutionTime: resp.ExecutionTime,
+		Error:         resp.Error,
+		Offline:       resp.Offline,
+		QueryID:       resp.QueryID,
+	}
+}
+
+func (d *rowDecoder) queryResponseFromWS(wsResp *websocket.QueryResponse) *QueryResponse {
+	var columns []ColumnMeta
+	for _, col := range wsResp.Columns {
+		columns = append(columns, ColumnMeta{
+			Name:         col.Name,
+			DatabaseType: col.DatabaseType,
+			Nullable:     col.Nullable,
+			Precision:    col.Precision,
+		})
+	}
+	d.decodeRows(columns, wsResp.Data)
+
+	var respErr *ErrorResponse
+	if wsResp.Error != nil {
+		respErr = &ErrorResponse{Details: wsResp.Error}
+		respErr.Code, _ = wsResp.Error["code"].(string)
+		respErr.Message, _ = wsResp.Error["message"].(string)
+	}
+
+	return &QueryResponse{
+		Success:       wsResp.Success,
+		Data:          wsResp.Data,
+		Columns:       columns,
+		RowCount:      wsResp.RowCount,
+		AffectedRows:  wsResp.AffectedRows,
+		LastInsertID:  wsResp.LastInsertID,
+		ExecutionTime: wsResp.ExecutionTime,
+		Cached:        wsResp.Cached,
+		Error:         respErr,
+	}
+}
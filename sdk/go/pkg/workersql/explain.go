@@ -0,0 +1,333 @@
+package workersql
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// QueryPlan is the plan the database chose for a statement, as a tree of
+// steps
+type QueryPlan struct {
+	SQL string `json:"sql"`
+	// Nodes are the top-level steps of the plan, in execution order
+	Nodes []*PlanNode `json:"nodes"`
+	// Shard is the shard that planned the statement, when the gateway
+	// reports it, and ShardKey the routing key the statement was sent with
+	Shard    string `json:"shard,omitempty"`
+	ShardKey string `json:"shardKey,omitempty"`
+	// Actual holds the measurements of ExplainAnalyze, nil for Explain
+	Actual *PlanActuals `json:"actual,omitempty"`
+}
+
+// PlanNode is a step of a QueryPlan, parsed from the database's
+// description of it, such as "SEARCH users USING INDEX idx_email (email=?)"
+type PlanNode struct {
+	ID     int `json:"id"`
+	Parent int `json:"parent"`
+	// Type is the kind of step: "SCAN" and "SEARCH" read Table, the latter
+	// through an index, others include "USE TEMP B-TREE", "SCALAR
+	// SUBQUERY", "CO-ROUTINE" and "COMPOUND QUERY"
+	Type  string `json:"type"`
+	Table string `json:"table,omitempty"`
+	Alias string `json:"alias,omitempty"`
+	// Index is the index used, "PRIMARY KEY" or "INTEGER PRIMARY KEY" for
+	// lookups by key, or "AUTOMATIC" for an index built for the statement
+	Index string `json:"index,omitempty"`
+	// Covering is set when the index holds every column the step needs
+	Covering bool `json:"covering,omitempty"`
+	// Constraint is the condition the index is searched with, as in
+	// "email=?"
+	Constraint string `json:"constraint,omitempty"`
+	// EstimatedRows is the database's estimate of the rows the step reads,
+	// zero when it gives none
+	EstimatedRows int64 `json:"estimatedRows,omitempty"`
+	// Detail is the database's description of the step
+	Detail   string      `json:"detail"`
+	Children []*PlanNode `json:"children,omitempty"`
+}
+
+// PlanActuals are the measurements of a statement run by ExplainAnalyze
+type PlanActuals struct {
+	// Duration is the round trip of the statement, ServerTime the
+	// execution time the gateway reported
+	Duration   time.Duration `json:"duration"`
+	ServerTime time.Duration `json:"serverTime"`
+	// Rows counts the rows returned, AffectedRows those written
+	Rows         int   `json:"rows"`
+	AffectedRows int64 `json:"affectedRows"`
+}
+
+// FullScan reports whether the step reads every row of its table
+func (n *PlanNode) FullScan() bool {
+	return n.Type == "SCAN" && n.Table != "" && n.Index == ""
+}
+
+// Walk calls fn with every node of the plan, parents before their
+// children
+func (p *QueryPlan) Walk(fn func(node *PlanNode)) {
+	var walk func(nodes []*PlanNode)
+	walk = func(nodes []*PlanNode) {
+		for _, n := range nodes {
+			fn(n)
+			walk(n.Children)
+		}
+	}
+	walk(p.Nodes)
+}
+
+// FullScans returns the steps reading every row of their table, the usual
+// suspects of a slow query
+func (p *QueryPlan) FullScans() []*PlanNode {
+	var scans []*PlanNode
+	p.Walk(func(n *PlanNode) {
+		if n.FullScan() {
+			scans = append(scans, n)
+		}
+	})
+	return scans
+}
+
+// Indexes returns the indexes the plan uses, sorted
+func (p *QueryPlan) Indexes() []string {
+	seen := map[string]bool{}
+	p.Walk(func(n *PlanNode) {
+		if n.Index != "" {
+			seen[n.Index] = true
+		}
+	})
+	indexes := make([]string, 0, len(seen))
+	for index := range seen {
+		indexes = append(indexes, index)
+	}
+	sort.Strings(indexes)
+	return indexes
+}
+
+// String renders the plan as a tree, the way the sqlite3 shell does
+func (p *QueryPlan) String() string {
+	var sb strings.Builder
+	sb.WriteString("QUERY PLAN\n")
+	var render func(nodes []*PlanNode, prefix string)
+	render = func(nodes []*PlanNode, prefix string) {
+		for i, n := range nodes {
+			branch, indent := "|--", "|  "
+			if i == len(nodes)-1 {
+				branch, indent = "`--", "   "
+			}
+			sb.WriteString(prefix + branch + n.Detail + "\n")
+			render(n.Children, prefix+indent)
+		}
+	}
+	render(p.Nodes, "")
+	return sb.String()
+}
+
+// Explain returns the plan of a statement, from an EXPLAIN QUERY PLAN sent
+// the way the statement would be, with its routing hints, so the plan is
+// that of the shard the statement goes to. The statement isn't run.
+func (c *Client) Explain(ctx context.Context, sql string, params ...interface{}) (*QueryPlan, error) {
+	sql, params, err := expandParams(sql, params)
+	if err != nil {
+		return nil, err
+	}
+
+	request := map[string]interface{}{"sql": sql}
+	if len(params) > 0 {
+		request["params"] = params
+	}
+	applyContextShardKey(ctx, request)
+	c.applyRoutingKey(request)
+	request["sql"] = "EXPLAIN QUERY PLAN " + sql
+
+	var response QueryResponse
+	err = c.retryStrategy.Execute(ctx, func() error {
+		return c.sendQuery(ctx, request, &response)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("explain: %w", err)
+	}
+	if err := response.failure(); err != nil {
+		return nil, fmt.Errorf("explain: %w", err)
+	}
+
+	plan := &QueryPlan{SQL: sql, Nodes: planTree(response.Data), Shard: response.Shard}
+	if hints, ok := request["hints"].(map[string]interface{}); ok {
+		plan.ShardKey = fmt.Sprint(hints["shardKey"])
+	}
+	return plan, nil
+}
+
+// ExplainAnalyze returns the plan of a statement like Explain, then runs
+// the statement and records its actual runtime and row counts in
+// QueryPlan.Actual. Writes are applied; analyze them in a transaction
+// that is rolled back, or on a copy of the data. The result cache and
+// query coalescing are bypassed, so the statement really runs.
+func (c *Client) ExplainAnalyze(ctx context.Context, sql string, params ...interface{}) (*QueryPlan, error) {
+	plan, err := c.Explain(ctx, sql, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	sql, params, err = expandParams(sql, params)
+	if err != nil {
+		return nil, err
+	}
+	request := map[string]interface{}{"sql": sql}
+	if len(params) > 0 {
+		request["params"] = params
+	}
+	applyContextShardKey(ctx, request)
+	c.applyRoutingKey(request)
+	ctx, err = withIdempotencyKey(ctx, "", !isReadStatement(sql))
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	response, err := c.execute(ctx, "Query", request)
+	duration := time.Since(start)
+	if err != nil {
+		return nil, fmt.Errorf("explain analyze: %w", err)
+	}
+	if err := response.failure(); err != nil {
+		return nil, fmt.Errorf("explain analyze: %w", err)
+	}
+	plan.Actual = &PlanActuals{
+		Duration:     duration,
+		ServerTime:   time.Duration(response.ExecutionTime * float64(time.Millisecond)),
+		Rows:         len(response.Data),
+		AffectedRows: response.AffectedRows,
+	}
+	if plan.Shard == "" {
+		plan.Shard = response.Shard
+	}
+	return plan, nil
+}
+
+// estimatedRowsPattern matches the row estimate some SQLite versions end
+// plan details with
+var estimatedRowsPattern = regexp.MustCompile(`\s*\(~(\d+) rows?\)$`)
+
+// planTree builds the plan tree from the rows of an EXPLAIN QUERY PLAN:
+// id, parent and detail columns, and optionally a row estimate
+func planTree(rows []map[string]interface{}) []*PlanNode {
+	var roots []*PlanNode
+	byID := make(map[int]*PlanNode, len(rows))
+	for i, row := range rows {
+		node := parsePlanDetail(fmt.Sprint(row["detail"]))
+		node.ID = planInt(row["id"], i)
+		node.Parent = planInt(row["parent"], 0)
+		for _, col := range []string{"estimatedRows", "rows"} {
+			if n := planInt(row[col], 0); n > 0 && node.EstimatedRows == 0 {
+				node.EstimatedRows = int64(n)
+			}
+		}
+		if parent, ok := byID[node.Parent]; ok && node.Parent != node.ID {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+		byID[node.ID] = node
+	}
+	return roots
+}
+
+// planInt reads an integer column of a plan row, def if it has none
+func planInt(v interface{}, def int) int {
+	switch v := v.(type) {
+	case nil:
+		return def
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	n, err := strconv.Atoi(fmt.Sprint(v))
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+// parsePlanDetail parses the description of a plan step
+func parsePlanDetail(detail string) *PlanNode {
+	node := &PlanNode{Detail: detail}
+	rest := detail
+	if m := estimatedRowsPattern.FindStringSubmatch(rest); m != nil {
+		node.EstimatedRows, _ = strconv.ParseInt(m[1], 10, 64)
+		rest = rest[:len(rest)-len(m[0])]
+	}
+
+	words := strings.Fields(rest)
+	if len(words) == 0 {
+		return node
+	}
+	switch words[0] {
+	case "SCAN", "SEARCH":
+		node.Type = words[0]
+		words = words[1:]
+		if len(words) > 0 && words[0] == "TABLE" {
+			words = words[1:]
+		}
+		if len(words) >= 2 && words[0] == "CONSTANT" && words[1] == "ROW" {
+			node.Type += " CONSTANT ROW"
+			return node
+		}
+		if len(words) > 0 {
+			node.Table = words[0]
+			words = words[1:]
+		}
+		if len(words) >= 2 && words[0] == "AS" {
+			node.Alias = words[1]
+			words = words[2:]
+		}
+		parsePlanIndex(node, words)
+	case "CO-ROUTINE", "MATERIALIZE":
+		node.Type = words[0]
+		if len(words) > 1 {
+			node.Table = words[1]
+		}
+	default:
+		// Numbered steps, as in "SCALAR SUBQUERY 2", share their type
+		if _, err := strconv.Atoi(words[len(words)-1]); err == nil && len(words) > 1 {
+			words = words[:len(words)-1]
+		}
+		node.Type = strings.Join(words, " ")
+	}
+	return node
+}
+
+// parsePlanIndex parses the USING clause of a SCAN or SEARCH step, as in
+// "USING COVERING INDEX idx_email (email=?)"
+func parsePlanIndex(node *PlanNode, words []string) {
+	if len(words) == 0 || words[0] != "USING" {
+		return
+	}
+	clause := strings.Join(words[1:], " ")
+	if i := strings.IndexByte(clause, '('); i >= 0 {
+		node.Constraint = strings.TrimSuffix(clause[i+1:], ")")
+		clause = strings.TrimSpace(clause[:i])
+	}
+	if strings.HasPrefix(clause, "AUTOMATIC ") {
+		node.Index = "AUTOMATIC"
+		node.Covering = strings.Contains(clause, "COVERING")
+		return
+	}
+	switch clause {
+	case "INTEGER PRIMARY KEY", "PRIMARY KEY":
+		node.Index = clause
+		return
+	}
+	if strings.HasPrefix(clause, "COVERING INDEX ") {
+		node.Covering = true
+		clause = strings.TrimPrefix(clause, "COVERING ")
+	}
+	node.Index = strings.TrimPrefix(clause, "INDEX ")
+}
@@ -0,0 +1,266 @@
+package workersql
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// DefaultExportPageSize is the number of rows fetched per export query
+const DefaultExportPageSize = 1000
+
+// ExportFormat selects the output format of Export
+type ExportFormat int
+
+const (
+	// ExportCSV writes comma-separated values with a header record
+	ExportCSV ExportFormat = iota
+	// ExportJSONL writes one JSON object per line
+	ExportJSONL
+)
+
+// ExportSpec describes what Export reads and where it writes
+type ExportSpec struct {
+	// Table to export. Exactly one of Table and Query must be set.
+	Table string
+	// Query is a SELECT statement to export, without ORDER BY or LIMIT
+	Query string
+	// Params are bound to the placeholders in Query
+	Params []interface{}
+	// Columns limits a Table export to these columns (default: all)
+	Columns []string
+	// KeyColumns are the columns of a unique, sortable key used for keyset
+	// pagination, such as a composite primary key (default: "id"). They must
+	// be part of the exported columns.
+	KeyColumns []string
+	// Format of the output (default: ExportCSV)
+	Format ExportFormat
+	// Writer receives the exported rows
+	Writer io.Writer
+	// PageSize is the number of rows fetched per query (default: 1000)
+	PageSize int
+	// NullValue is written for NULL in CSV output (default: `\N`, which
+	// ImportCSV reads back with ImportOptions.NullValue)
+	NullValue string
+	// Checkpoint resumes an interrupted export after the last exported key.
+	// The CSV header is not repeated when resuming.
+	Checkpoint *ExportCheckpoint
+	// OnCheckpoint is called after each page has been written to Writer
+	OnCheckpoint func(ExportCheckpoint)
+}
+
+// ExportCheckpoint records how far an export has got. It is JSON
+// serializable so it can be persisted between runs.
+type ExportCheckpoint struct {
+	// LastKey holds the key column values of the last exported row
+	LastKey []interface{} `json:"lastKey"`
+	// Rows is the number of rows exported so far, across resumed runs
+	Rows int64 `json:"rows"`
+	// Columns is the CSV column order, kept so resumed runs match the header
+	Columns []string `json:"columns,omitempty"`
+}
+
+// Export streams a table or query result to spec.Writer, paging through it
+// in key order with keyset pagination so every page is a cheap indexed
+// range scan. After each page the checkpoint is reported through
+// OnCheckpoint; passing the last one back as ExportSpec.Checkpoint resumes
+// the export without rewriting exported rows.
+func (c *Client) Export(ctx context.Context, spec ExportSpec) (*ExportCheckpoint, error) {
+	return export(ctx, spec, c.Query)
+}
+
+// queryFunc runs a query, as Client.Query does
+type queryFunc func(ctx context.Context, sql string, params ...interface{}) (*QueryResponse, error)
+
+// export runs an export, fetching its pages with query
+func export(ctx context.Context, spec ExportSpec, query queryFunc) (*ExportCheckpoint, error) {
+	checkpoint := ExportCheckpoint{}
+	if spec.Checkpoint != nil {
+		checkpoint = *spec.Checkpoint
+	}
+	return exportFrom(ctx, spec, query, checkpoint, spec.Checkpoint == nil)
+}
+
+// exportFrom runs an export from checkpoint, writing the CSV header first
+// when header is set
+func exportFrom(ctx context.Context, spec ExportSpec, query queryFunc, checkpoint ExportCheckpoint, header bool) (*ExportCheckpoint, error) {
+	if (spec.Table == "") == (spec.Query == "") {
+		return nil, fmt.Errorf("export: exactly one of Table and Query must be set")
+	}
+	if spec.Writer == nil {
+		return nil, fmt.Errorf("export: Writer is required")
+	}
+	if len(spec.KeyColumns) == 0 {
+		spec.KeyColumns = []string{"id"}
+	}
+	if spec.PageSize <= 0 {
+		spec.PageSize = DefaultExportPageSize
+	}
+	if spec.NullValue == "" {
+		spec.NullValue = `\N`
+	}
+
+	out := newExportWriter(spec, checkpoint.Columns, header)
+	for {
+		sql, params := exportPageQuery(spec, checkpoint.LastKey)
+		resp, err := query(ctx, sql, params...)
+		if err != nil {
+			return &checkpoint, fmt.Errorf("export: %w", err)
+		}
+		if err := resp.failure(); err != nil {
+			return &checkpoint, fmt.Errorf("export: %w", err)
+		}
+		if len(resp.Data) == 0 {
+			break
+		}
+
+		for _, row := range resp.Data {
+			key, ok := rowKey(row, spec.KeyColumns)
+			if !ok {
+				return &checkpoint, fmt.Errorf("export: key columns %v missing from results", spec.KeyColumns)
+			}
+			if err := out.write(resp.Columns, row); err != nil {
+				return &checkpoint, fmt.Errorf("export: %w", err)
+			}
+			checkpoint.LastKey = key
+			checkpoint.Rows++
+		}
+		if err := out.flush(); err != nil {
+			return &checkpoint, fmt.Errorf("export: %w", err)
+		}
+		checkpoint.Columns = out.columns
+		if spec.OnCheckpoint != nil {
+			spec.OnCheckpoint(checkpoint)
+		}
+
+		if len(resp.Data) < spec.PageSize {
+			break
+		}
+	}
+
+	return &checkpoint, nil
+}
+
+// exportPageQuery builds the query for the page after lastKey
+func exportPageQuery(spec ExportSpec, lastKey []interface{}) (string, []interface{}) {
+	var sb strings.Builder
+	var params []interface{}
+	if spec.Table != "" {
+		sb.WriteString("SELECT ")
+		if len(spec.Columns) == 0 {
+			sb.WriteString("*")
+		} else {
+			for i, col := range spec.Columns {
+				if i > 0 {
+					sb.WriteString(", ")
+				}
+				sb.WriteString(quoteIdentifier(col))
+			}
+		}
+		sb.WriteString(" FROM ")
+		sb.WriteString(quoteIdentifier(spec.Table))
+	} else {
+		sb.WriteString("SELECT * FROM (")
+		sb.WriteString(strings.TrimRight(strings.TrimSpace(spec.Query), ";"))
+		sb.WriteString(") AS export_source")
+		params = append(params, spec.Params...)
+	}
+
+	if lastKey != nil {
+		cond, keyParams := keysetAfter(spec.KeyColumns, lastKey, false)
+		sb.WriteString(" WHERE " + cond)
+		params = append(params, keyParams...)
+	}
+	fmt.Fprintf(&sb, " ORDER BY %s LIMIT %d", keysetOrder(spec.KeyColumns, false), spec.PageSize)
+	return sb.String(), params
+}
+
+// exportWriter encodes rows in the requested format
+type exportWriter struct {
+	format      ExportFormat
+	nullValue   string
+	csv         *csv.Writer
+	json        *json.Encoder
+	columns     []string
+	writeHeader bool
+	record      []string
+}
+
+func newExportWriter(spec ExportSpec, columns []string, writeHeader bool) *exportWriter {
+	w := &exportWriter{
+		format:      spec.Format,
+		nullValue:   spec.NullValue,
+		columns:     columns,
+		writeHeader: writeHeader,
+	}
+	if spec.Format == ExportJSONL {
+		w.json = json.NewEncoder(spec.Writer)
+	} else {
+		w.csv = csv.NewWriter(spec.Writer)
+	}
+	return w
+}
+
+func (w *exportWriter) write(meta []ColumnMeta, row map[string]interface{}) error {
+	if w.format == ExportJSONL {
+		return w.json.Encode(row)
+	}
+
+	if w.columns == nil {
+		w.columns = exportColumns(meta, row)
+	}
+	if w.writeHeader {
+		if err := w.csv.Write(w.columns); err != nil {
+			return err
+		}
+		w.writeHeader = false
+	}
+
+	w.record = w.record[:0]
+	for _, col := range w.columns {
+		v := row[col]
+		if v == nil {
+			w.record = append(w.record, w.nullValue)
+			continue
+		}
+		s, ok := stringValue(v)
+		if !ok {
+			encoded, err := json.Marshal(v)
+			if err != nil {
+				return fmt.Errorf("column %q: %w", col, err)
+			}
+			s = string(encoded)
+		}
+		w.record = append(w.record, s)
+	}
+	return w.csv.Write(w.record)
+}
+
+func (w *exportWriter) flush() error {
+	if w.csv == nil {
+		return nil
+	}
+	w.csv.Flush()
+	return w.csv.Error()
+}
+
+// exportColumns returns the CSV column order: the response's column order
+// when known, otherwise the row's keys sorted
+func exportColumns(meta []ColumnMeta, row map[string]interface{}) []string {
+	columns := make([]string, 0, len(row))
+	if len(meta) > 0 {
+		for _, col := range meta {
+			columns = append(columns, col.Name)
+		}
+		return columns
+	}
+	for name := range row {
+		columns = append(columns, name)
+	}
+	sort.Strings(columns)
+	return columns
+}
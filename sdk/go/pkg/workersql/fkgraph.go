@@ -0,0 +1,275 @@
+package workersql
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Foreign key referential actions, as reported by introspection
+const (
+	FKCascade    = "CASCADE"
+	FKSetNull    = "SET NULL"
+	FKSetDefault = "SET DEFAULT"
+	FKRestrict   = "RESTRICT"
+	FKNoAction   = "NO ACTION"
+)
+
+// ForeignKey is a foreign key constraint from Table to RefTable
+type ForeignKey struct {
+	// Table holds the referencing (child) rows
+	Table   string
+	Columns []string
+	// RefTable holds the referenced (parent) rows
+	RefTable string
+	// RefColumns is empty when the key references RefTable's primary key
+	RefColumns []string
+	// OnDelete is the referential action run when a parent row is deleted
+	OnDelete string
+}
+
+// FKCycleError is returned when tables cannot be ordered because their
+// foreign keys form a cycle
+type FKCycleError struct {
+	// Tables are the tables on or behind the cycle, sorted
+	Tables []string
+}
+
+func (e *FKCycleError) Error() string {
+	return fmt.Sprintf("foreign keys form a cycle among tables %s", strings.Join(e.Tables, ", "))
+}
+
+// FKGraph is the foreign key dependency graph of a database. Edges point
+// from a referencing table to the table it references.
+type FKGraph struct {
+	tables []string
+	// out holds the foreign keys defined on each table
+	out map[string][]ForeignKey
+	// in holds the foreign keys referencing each table
+	in map[string][]ForeignKey
+}
+
+// DeleteImpact describes what the database does to other tables when a row
+// of a table is deleted
+type DeleteImpact struct {
+	// Cascades lists the tables whose rows are deleted along with it,
+	// directly or through further cascades, nearest first
+	Cascades []string
+	// Nullified are the foreign keys set to NULL or their default
+	Nullified []ForeignKey
+	// Restricted are the foreign keys that reject the delete while
+	// referencing rows exist
+	Restricted []ForeignKey
+}
+
+// NewFKGraph builds a graph from tables and the foreign keys between them.
+// Tables referenced by a key but missing from tables are added.
+func NewFKGraph(tables []string, keys []ForeignKey) *FKGraph {
+	g := &FKGraph{
+		out: make(map[string][]ForeignKey),
+		in:  make(map[string][]ForeignKey),
+	}
+	seen := make(map[string]bool)
+	add := func(table string) {
+		if !seen[table] {
+			seen[table] = true
+			g.tables = append(g.tables, table)
+		}
+	}
+	for _, t := range tables {
+		add(t)
+	}
+	for _, fk := range keys {
+		add(fk.Table)
+		add(fk.RefTable)
+		g.out[fk.Table] = append(g.out[fk.Table], fk)
+		g.in[fk.RefTable] = append(g.in[fk.RefTable], fk)
+	}
+	sort.Strings(g.tables)
+	return g
+}
+
+// fkGraphQuery lists every table with its foreign keys, one row per key
+// column; tables without foreign keys appear once with NULL key columns
+const fkGraphQuery = "SELECT m.name AS table_name, f.id AS fk_id, f.seq AS fk_seq, " +
+	"f.`table` AS ref_table, f.`from` AS from_column, f.`to` AS to_column, f.on_delete AS on_delete " +
+	"FROM sqlite_master AS m LEFT JOIN pragma_foreign_key_list(m.name) AS f " +
+	"WHERE m.type = 'table' AND m.name NOT LIKE 'sqlite\\_%' ESCAPE '\\' AND substr(m.name, 1, 1) <> '_' " +
+	"ORDER BY m.name, f.id, f.seq"
+
+// fkRow is a row of fkGraphQuery
+type fkRow struct {
+	Table    string       `db:"table_name"`
+	ID       Null[int64]  `db:"fk_id"`
+	Seq      Null[int64]  `db:"fk_seq"`
+	RefTable Null[string] `db:"ref_table"`
+	From     Null[string] `db:"from_column"`
+	To       Null[string] `db:"to_column"`
+	OnDelete Null[string] `db:"on_delete"`
+}
+
+// FKGraph introspects the database's tables and foreign keys. Internal
+// tables, whose names start with an underscore, are left out.
+func (c *Client) FKGraph(ctx context.Context) (*FKGraph, error) {
+	resp, err := c.Query(ctx, fkGraphQuery)
+	if err != nil {
+		return nil, fmt.Errorf("introspecting foreign keys: %w", err)
+	}
+	if err := resp.failure(); err != nil {
+		return nil, fmt.Errorf("introspecting foreign keys: %w", err)
+	}
+
+	var rows []fkRow
+	if err := resp.ScanAll(&rows); err != nil {
+		return nil, fmt.Errorf("introspecting foreign keys: %w", err)
+	}
+
+	var (
+		tables []string
+		keys   []ForeignKey
+	)
+	for i, row := range rows {
+		if i == 0 || rows[i-1].Table != row.Table {
+			tables = append(tables, row.Table)
+		}
+		if !row.ID.Valid {
+			continue
+		}
+		// Rows of a multi-column key share an id and follow each other
+		if i == 0 || rows[i-1].Table != row.Table || rows[i-1].ID != row.ID {
+			keys = append(keys, ForeignKey{
+				Table:    row.Table,
+				RefTable: row.RefTable.V,
+				OnDelete: strings.ToUpper(row.OnDelete.V),
+			})
+		}
+		fk := &keys[len(keys)-1]
+		fk.Columns = append(fk.Columns, row.From.V)
+		if row.To.Valid {
+			fk.RefColumns = append(fk.RefColumns, row.To.V)
+		}
+	}
+	return NewFKGraph(tables, keys), nil
+}
+
+// Tables returns every table in the graph, sorted by name
+func (g *FKGraph) Tables() []string {
+	return append([]string(nil), g.tables...)
+}
+
+// ForeignKeys returns the foreign keys defined on table
+func (g *FKGraph) ForeignKeys(table string) []ForeignKey {
+	return append([]ForeignKey(nil), g.out[table]...)
+}
+
+// Referencing returns the foreign keys that reference table
+func (g *FKGraph) Referencing(table string) []ForeignKey {
+	return append([]ForeignKey(nil), g.in[table]...)
+}
+
+// TopologicalOrder returns the tables ordered so every table comes after the
+// tables it references: the order to create tables or load data in. Self
+// references are ignored; other cycles fail with *FKCycleError.
+func (g *FKGraph) TopologicalOrder() ([]string, error) {
+	pending := make(map[string]int, len(g.tables))
+	for _, t := range g.tables {
+		pending[t] = len(g.parents(t))
+	}
+
+	var ready, order []string
+	for _, t := range g.tables {
+		if pending[t] == 0 {
+			ready = append(ready, t)
+		}
+	}
+	for len(ready) > 0 {
+		sort.Strings(ready)
+		t := ready[0]
+		ready = ready[1:]
+		order = append(order, t)
+		for _, child := range g.children(t) {
+			pending[child]--
+			if pending[child] == 0 {
+				ready = append(ready, child)
+			}
+		}
+	}
+
+	if len(order) < len(g.tables) {
+		var cycle []string
+		for _, t := range g.tables {
+			if pending[t] > 0 {
+				cycle = append(cycle, t)
+			}
+		}
+		return nil, &FKCycleError{Tables: cycle}
+	}
+	return order, nil
+}
+
+// DeleteOrder returns the tables ordered so every table comes before the
+// tables it references: the order to delete data or drop tables in
+func (g *FKGraph) DeleteOrder() ([]string, error) {
+	order, err := g.TopologicalOrder()
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(order)-1; i < j; i, j = i+1, j-1 {
+		order[i], order[j] = order[j], order[i]
+	}
+	return order, nil
+}
+
+// DeleteImpact reports the effect of deleting rows of table on the tables
+// that reference it, following ON DELETE CASCADE transitively
+func (g *FKGraph) DeleteImpact(table string) DeleteImpact {
+	var impact DeleteImpact
+	visited := map[string]bool{table: true}
+	queue := []string{table}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, fk := range g.in[current] {
+			switch fk.OnDelete {
+			case FKCascade:
+				if !visited[fk.Table] {
+					visited[fk.Table] = true
+					impact.Cascades = append(impact.Cascades, fk.Table)
+					queue = append(queue, fk.Table)
+				}
+			case FKSetNull, FKSetDefault:
+				impact.Nullified = append(impact.Nullified, fk)
+			default:
+				impact.Restricted = append(impact.Restricted, fk)
+			}
+		}
+	}
+	return impact
+}
+
+// parents returns the distinct tables t references, excluding t itself
+func (g *FKGraph) parents(t string) []string {
+	var parents []string
+	seen := map[string]bool{t: true}
+	for _, fk := range g.out[t] {
+		if !seen[fk.RefTable] {
+			seen[fk.RefTable] = true
+			parents = append(parents, fk.RefTable)
+		}
+	}
+	return parents
+}
+
+// children returns the distinct tables referencing t, excluding t itself
+func (g *FKGraph) children(t string) []string {
+	var children []string
+	seen := map[string]bool{t: true}
+	for _, fk := range g.in[t] {
+		if !seen[fk.Table] {
+			seen[fk.Table] = true
+			children = append(children, fk.Table)
+		}
+	}
+	return children
+}
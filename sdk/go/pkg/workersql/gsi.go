@@ -0,0 +1,216 @@
+package workersql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// SecondaryIndexOptions configures Client.SecondaryIndex
+type SecondaryIndexOptions struct {
+	// Table is the sharded table the index covers
+	Table string
+	// Column is the secondary key column indexed, e.g. "email"
+	Column string
+	// Name is the lookup table (default: "gsi_<Table>_<Column>")
+	Name string
+	// Unique maps each secondary key to one shard key. Put then replaces
+	// the entry of a key instead of adding another.
+	Unique bool
+}
+
+// SecondaryIndex maintains a lookup table mapping the secondary key of a
+// sharded table to the shard key of its rows, so rows can be found by the
+// secondary key without querying every shard. Writes go through the index
+// first and reads look the shard key up before the routed query.
+//
+// The lookup table and the indexed rows live on different shards, so they
+// aren't updated atomically. Entries are written before the rows and
+// removed after them: a reader may find an entry whose row is gone, never a
+// row without its entry.
+type SecondaryIndex struct {
+	client *Client
+	table  string
+	unique bool
+}
+
+// SecondaryIndex returns the secondary index described by opts
+func (c *Client) SecondaryIndex(opts SecondaryIndexOptions) *SecondaryIndex {
+	name := opts.Name
+	if name == "" {
+		name = "gsi_" + opts.Table + "_" + opts.Column
+	}
+	return &SecondaryIndex{client: c, table: quoteIdentifier(name), unique: opts.Unique}
+}
+
+// EnsureSchema creates the lookup table if it doesn't exist
+func (ix *SecondaryIndex) EnsureSchema(ctx context.Context) error {
+	key := "PRIMARY KEY (`secondary_key`, `shard_key`)"
+	if ix.unique {
+		key = "PRIMARY KEY (`secondary_key`)"
+	}
+	err := ix.exec(ctx, "CREATE TABLE IF NOT EXISTS "+ix.table+" ("+
+		"`secondary_key` VARCHAR(255) NOT NULL, "+
+		"`shard_key` VARCHAR(255) NOT NULL, "+key+")")
+	if err != nil {
+		return fmt.Errorf("creating index table: %w", err)
+	}
+	return nil
+}
+
+// Put records that rows with secondaryKey live under shardKey
+func (ix *SecondaryIndex) Put(ctx context.Context, secondaryKey, shardKey interface{}) error {
+	sql := "INSERT IGNORE INTO " + ix.table + " (`secondary_key`, `shard_key`) VALUES (?, ?)"
+	if ix.unique {
+		sql = "INSERT INTO " + ix.table + " (`secondary_key`, `shard_key`) VALUES (?, ?)" +
+			" ON DUPLICATE KEY UPDATE `shard_key` = VALUES(`shard_key`)"
+	}
+	if err := ix.exec(ctx, sql, indexKey(secondaryKey), indexKey(shardKey)); err != nil {
+		return fmt.Errorf("index %v: %w", secondaryKey, err)
+	}
+	return nil
+}
+
+// Remove deletes the entry mapping secondaryKey to shardKey
+func (ix *SecondaryIndex) Remove(ctx context.Context, secondaryKey, shardKey interface{}) error {
+	err := ix.exec(ctx, "DELETE FROM "+ix.table+" WHERE `secondary_key` = ? AND `shard_key` = ?",
+		indexKey(secondaryKey), indexKey(shardKey))
+	if err != nil {
+		return fmt.Errorf("unindex %v: %w", secondaryKey, err)
+	}
+	return nil
+}
+
+// Lookup returns the shard keys of the rows with secondaryKey. It returns
+// ErrNoRows if there are none.
+func (ix *SecondaryIndex) Lookup(ctx context.Context, secondaryKey interface{}) ([]string, error) {
+	resp, err := ix.client.Query(WithCacheHint(ctx, CacheBypass()),
+		"SELECT `shard_key` FROM "+ix.table+" WHERE `secondary_key` = ?", indexKey(secondaryKey))
+	if err == nil {
+		err = resp.failure()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lookup %v: %w", secondaryKey, err)
+	}
+	if len(resp.Data) == 0 {
+		return nil, fmt.Errorf("lookup %v: %w", secondaryKey, ErrNoRows)
+	}
+	keys := make([]string, len(resp.Data))
+	for i, row := range resp.Data {
+		keys[i] = indexKey(row["shard_key"])
+	}
+	return keys, nil
+}
+
+// Insert writes a row through the index: the entry for secondaryKey is
+// recorded, then sql runs routed by shardKey. The entry is removed again
+// if the statement fails.
+func (ix *SecondaryIndex) Insert(ctx context.Context, secondaryKey, shardKey interface{}, sql string, params ...interface{}) (*ExecResponse, error) {
+	if err := ix.Put(ctx, secondaryKey, shardKey); err != nil {
+		return nil, err
+	}
+	resp, err := ix.routedExec(ctx, shardKey, sql, params...)
+	if err != nil {
+		// Best effort: a stale entry only costs a lookup finding no row
+		_ = ix.Remove(context.WithoutCancel(ctx), secondaryKey, shardKey)
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Update runs sql, which changes the secondary key of rows under shardKey
+// from oldKey to newKey, keeping the index in step: the new entry is
+// recorded before and the old one removed after the statement
+func (ix *SecondaryIndex) Update(ctx context.Context, oldKey, newKey, shardKey interface{}, sql string, params ...interface{}) (*ExecResponse, error) {
+	changed := indexKey(oldKey) != indexKey(newKey)
+	if changed {
+		if err := ix.Put(ctx, newKey, shardKey); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := ix.routedExec(ctx, shardKey, sql, params...)
+	if err != nil {
+		return nil, err
+	}
+	if changed {
+		// Matching the shard key too leaves a unique key taken over by
+		// another row in the meantime alone
+		if err := ix.Remove(ctx, oldKey, shardKey); err != nil {
+			return resp, err
+		}
+	}
+	return resp, nil
+}
+
+// Delete runs sql, which deletes the rows with secondaryKey under shardKey,
+// then removes their entry
+func (ix *SecondaryIndex) Delete(ctx context.Context, secondaryKey, shardKey interface{}, sql string, params ...interface{}) (*ExecResponse, error) {
+	resp, err := ix.routedExec(ctx, shardKey, sql, params...)
+	if err != nil {
+		return nil, err
+	}
+	if err := ix.Remove(ctx, secondaryKey, shardKey); err != nil {
+		return resp, err
+	}
+	return resp, nil
+}
+
+// Query looks up the shard keys of secondaryKey and runs sql routed by each
+// of them, returning the rows of all. It returns an empty response if the
+// key isn't indexed.
+func (ix *SecondaryIndex) Query(ctx context.Context, secondaryKey interface{}, sql string, params ...interface{}) (*QueryResponse, error) {
+	shardKeys, err := ix.Lookup(ctx, secondaryKey)
+	if errors.Is(err, ErrNoRows) {
+		return &QueryResponse{Success: true}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	merged := &QueryResponse{Success: true}
+	for _, shardKey := range shardKeys {
+		resp, err := ix.client.Query(WithShardKey(ctx, shardKey), sql, params...)
+		if err == nil {
+			err = resp.failure()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if merged.Columns == nil {
+			merged.Columns = resp.Columns
+		}
+		merged.Data = append(merged.Data, resp.Data...)
+	}
+	merged.RowCount = len(merged.Data)
+	return merged, nil
+}
+
+func (ix *SecondaryIndex) routedExec(ctx context.Context, shardKey interface{}, sql string, params ...interface{}) (*ExecResponse, error) {
+	resp, err := ix.client.Exec(WithShardKey(ctx, indexKey(shardKey)), sql, params...)
+	if err == nil {
+		err = resp.failure()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (ix *SecondaryIndex) exec(ctx context.Context, sql string, params ...interface{}) error {
+	resp, err := ix.client.Exec(ctx, sql, params...)
+	if err != nil {
+		return err
+	}
+	return resp.failure()
+}
+
+// indexKey renders a key the way it is stored in the lookup table
+func indexKey(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	return fmt.Sprint(v)
+}
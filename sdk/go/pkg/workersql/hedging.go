@@ -0,0 +1,214 @@
+package workersql
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Hedging defaults
+const (
+	DefaultHedgePercentile = 0.95
+	DefaultHedgeMinDelay   = 5 * time.Millisecond
+	DefaultHedgeMaxDelay   = time.Second
+)
+
+const (
+	// hedgeSamples is how many recent read latencies the hedge delay is
+	// computed from
+	hedgeSamples = 1000
+	// hedgeWarmup is how many samples are needed before the percentile is
+	// used instead of MaxDelay
+	hedgeWarmup = 20
+	// hedgeRecompute is how many samples are added between recomputations
+	// of the delay
+	hedgeRecompute = 50
+)
+
+// HedgingConfig enables hedged reads across Config.Endpoints: a read query
+// that hasn't been answered after the hedge delay is sent again to another
+// endpoint, the first successful response wins and the other request is
+// cancelled
+type HedgingConfig struct {
+	// Percentile of recent read latencies after which a read is hedged
+	// (default: 0.95)
+	Percentile float64
+	// MinDelay and MaxDelay bound the hedge delay (defaults: 5ms and 1s).
+	// MaxDelay is used until enough latencies have been observed.
+	MinDelay time.Duration
+	MaxDelay time.Duration
+}
+
+// hedger tracks read latencies and derives the hedge delay from them. The
+// methods of a nil hedger do nothing.
+type hedger struct {
+	config HedgingConfig
+
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+	added   int
+	delay   time.Duration
+}
+
+func newHedger(config *HedgingConfig, endpoints []string) *hedger {
+	if config == nil || len(endpoints) < 2 {
+		return nil
+	}
+	h := &hedger{config: *config}
+	if h.config.Percentile <= 0 || h.config.Percentile >= 1 {
+		h.config.Percentile = DefaultHedgePercentile
+	}
+	if h.config.MinDelay <= 0 {
+		h.config.MinDelay = DefaultHedgeMinDelay
+	}
+	if h.config.MaxDelay <= 0 {
+		h.config.MaxDelay = DefaultHedgeMaxDelay
+	}
+	if h.config.MaxDelay < h.config.MinDelay {
+		h.config.MaxDelay = h.config.MinDelay
+	}
+	h.delay = h.config.MaxDelay
+	return h
+}
+
+// observe records the latency of a successful read
+func (h *hedger) observe(latency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.samples) < hedgeSamples {
+		h.samples = append(h.samples, latency)
+	} else {
+		h.samples[h.next] = latency
+		h.next = (h.next + 1) % hedgeSamples
+	}
+	h.added++
+	if h.added < hedgeWarmup || (h.added > hedgeWarmup && h.added%hedgeRecompute != 0) {
+		return
+	}
+	sorted := append([]time.Duration(nil), h.samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	delay := sorted[int(h.config.Percentile*float64(len(sorted)-1))]
+	if delay < h.config.MinDelay {
+		delay = h.config.MinDelay
+	}
+	if delay > h.config.MaxDelay {
+		delay = h.config.MaxDelay
+	}
+	h.delay = delay
+}
+
+func (h *hedger) currentDelay() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.delay
+}
+
+// hedgeable reports whether request is an idempotent read that may be
+// sent twice: a read-only statement outside exec mode, not pinned to an
+// endpoint
+func (c *Client) hedgeable(ctx context.Context, request map[string]interface{}) bool {
+	if c.hedger == nil || request["mode"] == "exec" {
+		return false
+	}
+	if _, pinned := ctx.Value(endpointKey{}).(string); pinned {
+		return false
+	}
+	sql, _ := request["sql"].(string)
+	return isReadStatement(sql)
+}
+
+type hedgeResult struct {
+	response *QueryResponse
+	err      error
+	hedge    bool
+}
+
+// sendQuery sends a /query request into response, hedging it when it is a
+// read and hedging is on
+func (c *Client) sendQuery(ctx context.Context, request map[string]interface{}, response *QueryResponse) error {
+	if !c.hedgeable(ctx, request) {
+		return c.doRequest(ctx, "POST", "/query", request, response)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	// Cancels the losing request
+	defer cancel()
+	// Both requests share the endpoints tried, so the hedge goes elsewhere
+	ctx = withTriedEndpoints(ctx)
+
+	start := time.Now()
+	results := make(chan hedgeResult, 2)
+	send := func(hedge bool) {
+		var resp QueryResponse
+		err := c.doRequest(ctx, "POST", "/query", request, &resp)
+		results <- hedgeResult{response: &resp, err: err, hedge: hedge}
+	}
+	go send(false)
+
+	timer := time.NewTimer(c.hedger.currentDelay())
+	defer timer.Stop()
+	pending, hedged := 1, false
+	for {
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil && r.response.Success {
+				c.hedger.observe(time.Since(start))
+				if r.hedge {
+					atomic.AddInt64(&c.stats.hedgeWins, 1)
+				}
+				*response = *r.response
+				return nil
+			}
+			if pending == 0 {
+				if r.err == nil {
+					*response = *r.response
+				}
+				return r.err
+			}
+		case <-timer.C:
+			if !hedged {
+				hedged = true
+				pending++
+				atomic.AddInt64(&c.stats.hedges, 1)
+				go send(true)
+			}
+		}
+	}
+}
+
+// triedEndpoints is the set of endpoints the requests of one call were
+// sent to, shared by hedged requests
+type triedEndpoints struct {
+	mu   sync.Mutex
+	urls map[string]bool
+}
+
+type triedEndpointsKey struct{}
+
+func withTriedEndpoints(ctx context.Context) context.Context {
+	return context.WithValue(ctx, triedEndpointsKey{}, &triedEndpoints{urls: make(map[string]bool)})
+}
+
+// triedEndpointsFrom returns the set shared through ctx, or a new one
+func triedEndpointsFrom(ctx context.Context) *triedEndpoints {
+	if tried, ok := ctx.Value(triedEndpointsKey{}).(*triedEndpoints); ok {
+		return tried
+	}
+	return &triedEndpoints{urls: make(map[string]bool)}
+}
+
+func (t *triedEndpoints) add(url string) {
+	t.mu.Lock()
+	t.urls[url] = true
+	t.mu.Unlock()
+}
+
+func (t *triedEndpoints) has(url string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.urls[url]
+}
@@ -0,0 +1,204 @@
+package workersql
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Hot-key detection defaults
+const (
+	DefaultHotKeyThreshold = 100
+	DefaultHotKeyWindow    = 10 * time.Second
+	DefaultHotKeyMaxKeys   = 10000
+)
+
+// HotKeyConfig configures client-side hot-key detection
+type HotKeyConfig struct {
+	// Threshold is the request rate, per second, above which a routing key
+	// is hot (default: 100)
+	Threshold float64
+	// Window is the sliding window rates are measured over (default: 10s)
+	Window time.Duration
+	// MaxKeys bounds the keys tracked per window; requests for further keys
+	// aren't counted until the window rolls over (default: 10000)
+	MaxKeys int
+	// OnHotKey, if set, is called when a key exceeds Threshold, at most once
+	// per key and window. It runs on the request path and should return
+	// quickly.
+	OnHotKey func(HotKey)
+}
+
+// HotKey is a routing key whose request rate exceeds the threshold
+type HotKey struct {
+	Key string
+	// Table is the table of the request that made the key hot
+	Table string
+	// Rate is the estimated requests per second over the window
+	Rate float64
+}
+
+// hotKeyTracker counts requests per routing key in fixed windows, estimating
+// the rate over a sliding window by weighting the previous window's count
+// by how much of it the sliding window still covers
+type hotKeyTracker struct {
+	config HotKeyConfig
+	now    func() time.Time
+
+	mu    sync.Mutex
+	start time.Time
+	cur   map[string]*hotKeyCount
+	prev  map[string]*hotKeyCount
+}
+
+type hotKeyCount struct {
+	table    string
+	n        int64
+	reported bool
+}
+
+func newHotKeyTracker(config *HotKeyConfig) *hotKeyTracker {
+	if config == nil {
+		return nil
+	}
+	c := *config
+	if c.Threshold <= 0 {
+		c.Threshold = DefaultHotKeyThreshold
+	}
+	if c.Window <= 0 {
+		c.Window = DefaultHotKeyWindow
+	}
+	if c.MaxKeys <= 0 {
+		c.MaxKeys = DefaultHotKeyMaxKeys
+	}
+	return &hotKeyTracker{
+		config: c,
+		now:    time.Now,
+		start:  time.Now(),
+		cur:    make(map[string]*hotKeyCount),
+		prev:   make(map[string]*hotKeyCount),
+	}
+}
+
+// observe counts a request for key and reports whether it just became hot
+func (t *hotKeyTracker) observe(key, table string) (HotKey, bool) {
+	if t == nil || key == "" {
+		return HotKey{}, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	t.roll(now)
+
+	count, ok := t.cur[key]
+	if !ok {
+		if len(t.cur) >= t.config.MaxKeys {
+			return HotKey{}, false
+		}
+		count = &hotKeyCount{}
+		t.cur[key] = count
+	}
+	count.n++
+	count.table = table
+
+	rate := t.rate(key, now)
+	if rate <= t.config.Threshold || count.reported {
+		return HotKey{}, false
+	}
+	count.reported = true
+	return HotKey{Key: key, Table: table, Rate: rate}, true
+}
+
+// roll starts a new window once the current one is over
+func (t *hotKeyTracker) roll(now time.Time) {
+	elapsed := now.Sub(t.start)
+	if elapsed < t.config.Window {
+		return
+	}
+	if elapsed >= 2*t.config.Window {
+		t.prev = make(map[string]*hotKeyCount)
+	} else {
+		t.prev = t.cur
+	}
+	t.cur = make(map[string]*hotKeyCount)
+	t.start = t.start.Add(elapsed / t.config.Window * t.config.Window)
+}
+
+func (t *hotKeyTracker) rate(key string, now time.Time) float64 {
+	var n float64
+	if c, ok := t.cur[key]; ok {
+		n = float64(c.n)
+	}
+	if c, ok := t.prev[key]; ok {
+		covered := 1 - float64(now.Sub(t.start))/float64(t.config.Window)
+		n += float64(c.n) * covered
+	}
+	return n / t.config.Window.Seconds()
+}
+
+// hot returns the keys currently above the threshold, hottest first
+func (t *hotKeyTracker) hot() []HotKey {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	t.roll(now)
+
+	var keys []HotKey
+	seen := make(map[string]bool)
+	for _, m := range []map[string]*hotKeyCount{t.cur, t.prev} {
+		for key, c := range m {
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			if rate := t.rate(key, now); rate > t.config.Threshold {
+				keys = append(keys, HotKey{Key: key, Table: c.table, Rate: rate})
+			}
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Rate != keys[j].Rate {
+			return keys[i].Rate > keys[j].Rate
+		}
+		return keys[i].Key < keys[j].Key
+	})
+	return keys
+}
+
+// trackHotKey counts the request against its routing key, the shardKey
+// hint, reporting the key if it just became hot
+func (c *Client) trackHotKey(request map[string]interface{}) {
+	if c.hotKeys == nil {
+		return
+	}
+	hints, _ := request["hints"].(map[string]interface{})
+	key, _ := hints["shardKey"].(string)
+	if key == "" {
+		return
+	}
+	var table string
+	if sql, ok := request["sql"].(string); ok {
+		if tables := statementTables(sql); len(tables) > 0 {
+			table = tables[0]
+		}
+	}
+	hot, ok := c.hotKeys.observe(key, table)
+	if !ok {
+		return
+	}
+	atomic.AddInt64(&c.stats.hotKeys, 1)
+	if c.hotKeys.config.OnHotKey != nil {
+		c.hotKeys.config.OnHotKey(hot)
+	}
+}
+
+// HotKeys returns the routing keys whose request rate currently exceeds
+// Config.HotKeys.Threshold, hottest first. It returns nil when hot-key
+// detection is off.
+func (c *Client) HotKeys() []HotKey {
+	return c.hotKeys.hot()
+}
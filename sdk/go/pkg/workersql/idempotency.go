@@ -0,0 +1,55 @@
+package workersql
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+)
+
+// IdempotencyKeyHeader carries the key the gateway dedupes writes by, so a
+// write retried after a timeout is applied once
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+type idempotencyKeyKey struct{}
+
+// WithIdempotencyKey makes the write sent with ctx carry key instead of a
+// generated one, so retries by the caller, such as a job re-run after a
+// crash, are deduped with the original attempt. Use a new context, and so a
+// new key, for every distinct write.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyKey{}, key)
+}
+
+// idempotencyKey returns the key of a call: the caller's if given through
+// opts or ctx, else a generated one when write is true, so every retry of
+// the call sends the same key. It returns "" for reads without a key.
+func idempotencyKey(ctx context.Context, supplied string, write bool) (string, error) {
+	if supplied != "" {
+		return supplied, nil
+	}
+	if key, ok := ctx.Value(idempotencyKeyKey{}).(string); ok && key != "" {
+		return key, nil
+	}
+	if !write {
+		return "", nil
+	}
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("generating idempotency key: %w", err)
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// withIdempotencyKey attaches the idempotency key of a call to the
+// requests sent with ctx
+func withIdempotencyKey(ctx context.Context, supplied string, write bool) (context.Context, error) {
+	key, err := idempotencyKey(ctx, supplied, write)
+	if err != nil || key == "" {
+		return ctx, err
+	}
+	h := http.Header{}
+	h.Set(IdempotencyKeyHeader, key)
+	return withRequestHeaders(ctx, h), nil
+}
@@ -0,0 +1,202 @@
+package workersql
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DefaultImportBatchSize is the number of CSV rows inserted per statement
+const DefaultImportBatchSize = 500
+
+// ImportOptions configures ImportCSV
+type ImportOptions struct {
+	// Delimiter separates fields (default: ',')
+	Delimiter rune
+	// HasHeader treats the first record as column names
+	HasHeader bool
+	// Columns names the CSV fields in order when there is no header
+	Columns []string
+	// ColumnMapping maps CSV column names to table columns. When set, CSV
+	// columns without a mapping are not imported.
+	ColumnMapping map[string]string
+	// BatchSize is the number of rows per INSERT statement (default: 500)
+	BatchSize int
+	// NullValue is a field value imported as NULL, e.g. `\N` as written by
+	// mysqldump. Empty means no field is treated as NULL.
+	NullValue string
+	// OnConflict selects the duplicate key behaviour (default: ConflictError)
+	OnConflict ConflictAction
+	// SkipRows skips this many data rows before importing, to resume an
+	// import from ImportError.ResumeRow
+	SkipRows int64
+	// OnProgress is called after every committed batch
+	OnProgress func(ImportProgress)
+}
+
+// ImportProgress reports how far an import has got
+type ImportProgress struct {
+	// RowsRead counts data rows read from the input, including skipped rows
+	RowsRead int64
+	// RowsImported counts rows in committed batches, excluding skipped rows
+	RowsImported int64
+	// AffectedRows is the sum of affected rows reported for committed batches
+	AffectedRows int64
+	// Batches is the number of committed batches
+	Batches int
+}
+
+// ImportError is returned when a batch fails. Every row before ResumeRow
+// was committed, so the import can be resumed by calling ImportCSV again on
+// the same input with ImportOptions.SkipRows set to ResumeRow.
+type ImportError struct {
+	ResumeRow int64
+	Progress  ImportProgress
+	Err       error
+}
+
+func (e *ImportError) Error() string {
+	return fmt.Sprintf("csv import failed at data row %d: %v", e.ResumeRow, e.Err)
+}
+
+func (e *ImportError) Unwrap() error {
+	return e.Err
+}
+
+// ImportCSV streams CSV records from r into table using batched multi-row
+// INSERT statements, the equivalent of MySQL's LOAD DATA. Batches run in
+// order, each with the client's retry policy; if one still fails the
+// returned *ImportError says where to resume.
+func (c *Client) ImportCSV(ctx context.Context, table string, r io.Reader, opts ImportOptions) (*ImportProgress, error) {
+	progress := &ImportProgress{}
+	if table == "" {
+		return progress, fmt.Errorf("csv import: table name is required")
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultImportBatchSize
+	}
+
+	reader := csv.NewReader(r)
+	if opts.Delimiter != 0 {
+		reader.Comma = opts.Delimiter
+	}
+	reader.ReuseRecord = true
+	reader.FieldsPerRecord = -1
+
+	header := opts.Columns
+	if opts.HasHeader {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return progress, nil
+		}
+		if err != nil {
+			return progress, fmt.Errorf("csv import: reading header: %w", err)
+		}
+		header = append([]string(nil), record...)
+	}
+	if len(header) == 0 {
+		return progress, fmt.Errorf("csv import: column names are required when HasHeader is false")
+	}
+
+	// fields[i] is the table column for CSV field i, "" to skip it
+	fields := make([]string, len(header))
+	var columns []string
+	for i, name := range header {
+		column := name
+		if opts.ColumnMapping != nil {
+			column = opts.ColumnMapping[name]
+		}
+		if column == "" {
+			continue
+		}
+		fields[i] = column
+		columns = append(columns, column)
+	}
+	if len(columns) == 0 {
+		return progress, fmt.Errorf("csv import: no columns to import")
+	}
+
+	bulk := BulkOptions{OnConflict: opts.OnConflict}
+	batch := make([]map[string]interface{}, 0, opts.BatchSize)
+	batchStart := opts.SkipRows
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return &ImportError{ResumeRow: batchStart, Progress: *progress, Err: err}
+		}
+
+		sql, params := buildBulkInsert(table, columns, batch, bulk)
+		resp, err := c.Exec(ctx, sql, params...)
+		if err == nil {
+			err = resp.failure()
+		}
+		if err != nil {
+			return &ImportError{ResumeRow: batchStart, Progress: *progress, Err: err}
+		}
+
+		progress.RowsImported += int64(len(batch))
+		progress.AffectedRows += resp.AffectedRows
+		progress.Batches++
+		batchStart += int64(len(batch))
+		batch = batch[:0]
+		if opts.OnProgress != nil {
+			opts.OnProgress(*progress)
+		}
+		return nil
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				return progress, &ImportError{ResumeRow: batchStart, Progress: *progress, Err: err}
+			}
+			return progress, fmt.Errorf("csv import: %w", err)
+		}
+
+		progress.RowsRead++
+		if progress.RowsRead <= opts.SkipRows {
+			continue
+		}
+		if len(record) != len(header) {
+			return progress, &ImportError{
+				ResumeRow: batchStart,
+				Progress:  *progress,
+				Err:       fmt.Errorf("data row %d has %d fields, expected %d", progress.RowsRead, len(record), len(header)),
+			}
+		}
+
+		row := make(map[string]interface{}, len(columns))
+		for i, value := range record {
+			if fields[i] == "" {
+				continue
+			}
+			if opts.NullValue != "" && value == opts.NullValue {
+				row[fields[i]] = nil
+			} else {
+				row[fields[i]] = value
+			}
+		}
+		batch = append(batch, row)
+
+		if len(batch) >= opts.BatchSize {
+			if err := flush(); err != nil {
+				return progress, err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return progress, err
+	}
+	return progress, nil
+}
@@ -0,0 +1,231 @@
+package workersql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Integrity checker defaults
+const (
+	DefaultIntegrityBatchSize     = 500
+	DefaultIntegrityMaxViolations = 1000
+)
+
+// IntegrityOptions configures CheckIntegrity
+type IntegrityOptions struct {
+	// Graph holds the declared foreign keys to check (default: introspected
+	// with FKGraph)
+	Graph *FKGraph
+	// Keys are logical foreign keys checked in addition to the declared ones,
+	// for relationships the database does not enforce, e.g. across shards
+	Keys []ForeignKey
+	// Tables limits the check to foreign keys defined on these tables
+	// (default: all)
+	Tables []string
+	// BatchSize is the number of distinct key values read per query
+	// (default: 500)
+	BatchSize int
+	// MaxViolations stops the check once this many orphaned keys have been
+	// found (default: 1000)
+	MaxViolations int
+}
+
+// IntegrityViolation is a foreign key value with no matching parent row
+type IntegrityViolation struct {
+	ForeignKey ForeignKey
+	// Key holds the values of ForeignKey.Columns found in the child table
+	Key []interface{}
+}
+
+// IntegrityReport is the outcome of CheckIntegrity
+type IntegrityReport struct {
+	// Checked lists the foreign keys that were scanned
+	Checked []ForeignKey
+	// Violations lists orphaned key values, by foreign key and key order
+	Violations []IntegrityViolation
+	// KeysScanned is the number of distinct child key values examined
+	KeysScanned int64
+	// Truncated is set when the check stopped at MaxViolations
+	Truncated bool
+}
+
+// CheckIntegrity scans child tables for rows whose foreign key values have
+// no matching parent row. Each key is checked in batches: a page of
+// distinct, non-NULL child values is read in key order, then the parent
+// table is asked which of them exist. The two tables are never joined, so
+// keys spanning shards are checked the same way as local ones.
+func (c *Client) CheckIntegrity(ctx context.Context, opts IntegrityOptions) (*IntegrityReport, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultIntegrityBatchSize
+	}
+	if opts.MaxViolations <= 0 {
+		opts.MaxViolations = DefaultIntegrityMaxViolations
+	}
+	if opts.Graph == nil {
+		graph, err := c.FKGraph(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("integrity check: %w", err)
+		}
+		opts.Graph = graph
+	}
+
+	var keys []ForeignKey
+	for _, table := range opts.Graph.Tables() {
+		keys = append(keys, opts.Graph.ForeignKeys(table)...)
+	}
+	keys = append(keys, opts.Keys...)
+
+	report := &IntegrityReport{}
+	for _, fk := range keys {
+		if len(opts.Tables) > 0 && !containsString(opts.Tables, fk.Table) {
+			continue
+		}
+		if len(fk.RefColumns) != len(fk.Columns) {
+			return report, fmt.Errorf("integrity check: foreign key %s%v -> %s does not name the referenced columns", fk.Table, fk.Columns, fk.RefTable)
+		}
+		report.Checked = append(report.Checked, fk)
+		if err := c.checkForeignKey(ctx, fk, opts, report); err != nil {
+			return report, fmt.Errorf("integrity check: %s%v -> %s%v: %w", fk.Table, fk.Columns, fk.RefTable, fk.RefColumns, err)
+		}
+		if report.Truncated {
+			break
+		}
+	}
+	return report, nil
+}
+
+// checkForeignKey pages through the distinct values of one foreign key and
+// records those missing from the parent table
+func (c *Client) checkForeignKey(ctx context.Context, fk ForeignKey, opts IntegrityOptions, report *IntegrityReport) error {
+	notNull := make([]string, len(fk.Columns))
+	for i, col := range fk.Columns {
+		notNull[i] = quoteIdentifier(col) + " IS NOT NULL"
+	}
+	base := "SELECT DISTINCT " + quoteIdentifiers(fk.Columns) + " FROM " + quoteIdentifier(fk.Table) +
+		" WHERE " + strings.Join(notNull, " AND ")
+
+	var lastKey []interface{}
+	for {
+		sql, params := base, []interface{}(nil)
+		if lastKey != nil {
+			cond, keyParams := keysetAfter(fk.Columns, lastKey, false)
+			sql += " AND " + cond
+			params = keyParams
+		}
+		sql += fmt.Sprintf(" ORDER BY %s LIMIT %d", keysetOrder(fk.Columns, false), opts.BatchSize)
+
+		resp, err := c.Query(ctx, sql, params...)
+		if err != nil {
+			return err
+		}
+		if err := resp.failure(); err != nil {
+			return err
+		}
+
+		values := make([][]interface{}, 0, len(resp.Data))
+		for _, row := range resp.Data {
+			key, ok := rowKey(row, fk.Columns)
+			if !ok {
+				return fmt.Errorf("key columns missing from results")
+			}
+			values = append(values, key)
+		}
+		if len(values) == 0 {
+			return nil
+		}
+		report.KeysScanned += int64(len(values))
+
+		missing, err := c.missingParents(ctx, fk, values)
+		if err != nil {
+			return err
+		}
+		for _, key := range missing {
+			if len(report.Violations) >= opts.MaxViolations {
+				report.Truncated = true
+				return nil
+			}
+			report.Violations = append(report.Violations, IntegrityViolation{ForeignKey: fk, Key: key})
+		}
+
+		if len(values) < opts.BatchSize {
+			return nil
+		}
+		lastKey = values[len(values)-1]
+	}
+}
+
+// missingParents returns the values that have no row in the parent table
+func (c *Client) missingParents(ctx context.Context, fk ForeignKey, values [][]interface{}) ([][]interface{}, error) {
+	var (
+		sql    string
+		params []interface{}
+	)
+	if len(fk.RefColumns) == 1 {
+		list := make([]interface{}, len(values))
+		for i, v := range values {
+			list[i] = v[0]
+		}
+		sql = "SELECT " + quoteIdentifier(fk.RefColumns[0]) + " FROM " + quoteIdentifier(fk.RefTable) +
+			" WHERE " + quoteIdentifier(fk.RefColumns[0]) + " IN (?)"
+		params = []interface{}{In(list...)}
+	} else {
+		match := make([]string, len(fk.RefColumns))
+		for i, col := range fk.RefColumns {
+			match[i] = quoteIdentifier(col) + " = ?"
+		}
+		tuple := "(" + strings.Join(match, " AND ") + ")"
+		conditions := make([]string, len(values))
+		for i, v := range values {
+			conditions[i] = tuple
+			params = append(params, v...)
+		}
+		sql = "SELECT " + quoteIdentifiers(fk.RefColumns) + " FROM " + quoteIdentifier(fk.RefTable) +
+			" WHERE " + strings.Join(conditions, " OR ")
+	}
+
+	resp, err := c.Query(ctx, sql, params...)
+	if err != nil {
+		return nil, err
+	}
+	if err := resp.failure(); err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]bool, len(resp.Data))
+	for _, row := range resp.Data {
+		if key, ok := rowKey(row, fk.RefColumns); ok {
+			found[keyString(key)] = true
+		}
+	}
+	var missing [][]interface{}
+	for _, v := range values {
+		if !found[keyString(v)] {
+			missing = append(missing, v)
+		}
+	}
+	return missing, nil
+}
+
+// keyString renders key values for comparison, so that numbers decoded as
+// int64 on one side and float64 or json.Number on the other still match
+func keyString(key []interface{}) string {
+	parts := make([]string, len(key))
+	for i, v := range key {
+		if s, ok := stringValue(v); ok {
+			parts[i] = s
+		} else {
+			parts[i] = fmt.Sprint(v)
+		}
+	}
+	return strings.Join(parts, "\x00")
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,501 @@
+package workersql
+
+import (
+	"bufio"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultJoinMemoryLimit is the approximate number of bytes of build-side
+// rows a HashJoin holds in memory
+const DefaultJoinMemoryLimit = 64 << 20
+
+// DefaultJoinPartitions is the number of partitions a spilling HashJoin
+// splits each side into
+const DefaultJoinPartitions = 16
+
+// ErrJoinMemoryLimit is returned by HashJoin when the build side doesn't
+// fit in JoinSpec.MemoryLimit and can't be spilled
+var ErrJoinMemoryLimit = errors.New("join exceeds its memory limit")
+
+// JoinType selects the rows a HashJoin returns
+type JoinType string
+
+const (
+	// JoinInner returns the pairs of rows whose keys match
+	JoinInner JoinType = "INNER"
+	// JoinLeft also returns the left rows without a match, with the right
+	// columns NULL
+	JoinLeft JoinType = "LEFT"
+)
+
+// JoinSpec describes an application-side join of two result sets, such as
+// queries against different tenant databases or shards, which the gateway
+// can't join itself
+type JoinSpec struct {
+	// Left is streamed and each of its rows matched against Right
+	Left RowSource
+	// Right is the build side, held in memory as a hash table; make it the
+	// smaller of the two
+	Right RowSource
+	// LeftKeys and RightKeys are the columns compared pairwise, as in
+	// ON l.LeftKeys[0] = r.RightKeys[0] AND ... NULL keys never match, and
+	// numbers match by value whatever their Go type.
+	LeftKeys  []string
+	RightKeys []string
+	// Type is JoinInner (the default) or JoinLeft
+	Type JoinType
+	// RightPrefix is prepended to the names of the right columns in joined
+	// rows. A right column whose name is taken by a left column is dropped,
+	// keeping the left value.
+	RightPrefix string
+	// MemoryLimit is the approximate number of bytes of right rows held in
+	// memory (default: DefaultJoinMemoryLimit)
+	MemoryLimit int64
+	// SpillDir is the directory a right side beyond MemoryLimit is spilled
+	// to. Both sides are then partitioned by key into temporary files and
+	// joined a partition at a time, so each partition must fit in
+	// MemoryLimit. Empty fails the join with ErrJoinMemoryLimit instead.
+	SpillDir string
+	// Partitions is the number of partitions of a spilled join (default:
+	// DefaultJoinPartitions)
+	Partitions int
+}
+
+// JoinResult counts the rows of a HashJoin
+type JoinResult struct {
+	// LeftRows and RightRows are the number of rows read from each side
+	LeftRows  int64
+	RightRows int64
+	// Rows is the number of joined rows emitted
+	Rows int64
+	// Spilled reports whether the join was partitioned to disk, and
+	// SpilledBytes how much it wrote there
+	Spilled      bool
+	SpilledBytes int64
+}
+
+// HashJoin joins the rows of spec.Left and spec.Right on their key columns
+// and calls emit with each joined row. Joined rows follow the order of the
+// left side, except in a spilled join, where they come a partition at a
+// time. Left rows are read only once the right side has been.
+//
+//	orders := workersql.QuerySource(tenantA, "SELECT id, customer_id, total FROM orders")
+//	customers := workersql.QuerySource(crm, "SELECT id, name FROM customers")
+//	result, err := workersql.HashJoin(ctx, workersql.JoinSpec{
+//		Left: orders, Right: customers,
+//		LeftKeys: []string{"customer_id"}, RightKeys: []string{"id"},
+//		Type: workersql.JoinLeft, RightPrefix: "customer_",
+//		SpillDir: os.TempDir(),
+//	}, func(row map[string]interface{}) error {
+//		return report.Write(row)
+//	})
+func HashJoin(ctx context.Context, spec JoinSpec, emit func(row map[string]interface{}) error) (*JoinResult, error) {
+	if err := spec.validate(); err != nil {
+		return nil, fmt.Errorf("hash join: %w", err)
+	}
+	j := &hashJoin{
+		spec:      spec,
+		result:    &JoinResult{},
+		table:     make(map[string][]map[string]interface{}),
+		rightCols: make(map[string]bool),
+		limit:     spec.MemoryLimit,
+	}
+	if j.limit <= 0 {
+		j.limit = DefaultJoinMemoryLimit
+	}
+	if j.spec.Partitions <= 0 {
+		j.spec.Partitions = DefaultJoinPartitions
+	}
+	j.emit = func(row map[string]interface{}) error {
+		if err := emit(row); err != nil {
+			return err
+		}
+		j.result.Rows++
+		return nil
+	}
+	defer j.removeSpill()
+
+	err := spec.Right(ctx, func(row map[string]interface{}) error {
+		j.result.RightRows++
+		return j.build(row)
+	})
+	if err != nil {
+		return j.result, fmt.Errorf("hash join: right side: %w", err)
+	}
+
+	probe := j.probe
+	if j.spill != nil {
+		probe = j.partitionLeft
+	}
+	err = spec.Left(ctx, func(row map[string]interface{}) error {
+		j.result.LeftRows++
+		return probe(row)
+	})
+	if err != nil {
+		return j.result, fmt.Errorf("hash join: left side: %w", err)
+	}
+	if j.spill != nil {
+		if err := j.joinPartitions(ctx); err != nil {
+			return j.result, fmt.Errorf("hash join: %w", err)
+		}
+	}
+	return j.result, nil
+}
+
+// JoinSource returns the joined rows of spec as a RowSource, for a
+// RowPipeline
+func JoinSource(spec JoinSpec) RowSource {
+	return func(ctx context.Context, emit func(row map[string]interface{}) error) error {
+		_, err := HashJoin(ctx, spec, emit)
+		return err
+	}
+}
+
+func (s *JoinSpec) validate() error {
+	switch {
+	case s.Left == nil || s.Right == nil:
+		return errors.New("both sides are required")
+	case len(s.LeftKeys) == 0:
+		return errors.New("join keys are required")
+	case len(s.LeftKeys) != len(s.RightKeys):
+		return fmt.Errorf("%d left keys but %d right keys", len(s.LeftKeys), len(s.RightKeys))
+	}
+	switch s.Type {
+	case "":
+		s.Type = JoinInner
+	case JoinInner, JoinLeft:
+	default:
+		return fmt.Errorf("unsupported join type %q", s.Type)
+	}
+	return nil
+}
+
+// hashJoin is the state of one HashJoin
+type hashJoin struct {
+	spec   JoinSpec
+	result *JoinResult
+	emit   func(row map[string]interface{}) error
+
+	// table holds the right rows by key, taking up about size bytes
+	table map[string][]map[string]interface{}
+	size  int64
+	limit int64
+
+	// rightCols are the right columns seen, in order, for the NULL columns
+	// of unmatched left rows
+	rightCols  map[string]bool
+	rightOrder []string
+
+	// spill is set once the right side has overflowed to disk
+	spill *joinSpill
+}
+
+// build adds a right row to the hash table, spilling it once it is full
+func (j *hashJoin) build(row map[string]interface{}) error {
+	for col := range row {
+		if !j.rightCols[col] {
+			j.rightCols[col] = true
+			j.rightOrder = append(j.rightOrder, col)
+		}
+	}
+	key, ok := joinKey(row, j.spec.RightKeys)
+	if !ok {
+		return nil // a NULL key matches nothing
+	}
+	if j.spill != nil {
+		return j.spill.right.write(key, row)
+	}
+	j.add(key, row)
+	if j.size <= j.limit {
+		return nil
+	}
+	if j.spec.SpillDir == "" {
+		return fmt.Errorf("%w of %d bytes; set SpillDir to spill to disk", ErrJoinMemoryLimit, j.limit)
+	}
+	return j.startSpill()
+}
+
+func (j *hashJoin) add(key string, row map[string]interface{}) {
+	if _, ok := j.table[key]; !ok {
+		j.size += int64(len(key)) + 48
+	}
+	j.table[key] = append(j.table[key], row)
+	j.size += estimateRowSize(row)
+}
+
+// startSpill moves the hash table to partition files
+func (j *hashJoin) startSpill() error {
+	spill, err := newJoinSpill(j.spec.SpillDir, j.spec.Partitions)
+	if err != nil {
+		return err
+	}
+	j.spill = spill
+	j.result.Spilled = true
+	for key, rows := range j.table {
+		for _, row := range rows {
+			if err := spill.right.write(key, row); err != nil {
+				return err
+			}
+		}
+	}
+	j.table = nil
+	j.size = 0
+	return nil
+}
+
+// probe emits the joined rows of a left row
+func (j *hashJoin) probe(row map[string]interface{}) error {
+	var matches []map[string]interface{}
+	if key, ok := joinKey(row, j.spec.LeftKeys); ok {
+		matches = j.table[key]
+	}
+	if len(matches) == 0 {
+		if j.spec.Type == JoinLeft {
+			return j.emit(j.joinRows(row, nil))
+		}
+		return nil
+	}
+	for _, match := range matches {
+		if err := j.emit(j.joinRows(row, match)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// partitionLeft writes a left row to its partition of a spilled join
+func (j *hashJoin) partitionLeft(row map[string]interface{}) error {
+	key, ok := joinKey(row, j.spec.LeftKeys)
+	if !ok {
+		return j.probe(row) // matches nothing in any partition
+	}
+	return j.spill.left.write(key, row)
+}
+
+// joinPartitions joins the partitions of a spilled join one at a time
+func (j *hashJoin) joinPartitions(ctx context.Context) error {
+	if err := j.spill.flush(); err != nil {
+		return err
+	}
+	j.result.SpilledBytes = j.spill.bytes()
+	for p := 0; p < j.spec.Partitions; p++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		j.table = make(map[string][]map[string]interface{})
+		j.size = 0
+		err := j.spill.right.read(p, func(row map[string]interface{}) error {
+			key, _ := joinKey(row, j.spec.RightKeys)
+			j.add(key, row)
+			if j.size > j.limit {
+				return fmt.Errorf("partition %d of %d: %w of %d bytes; raise Partitions or MemoryLimit", p, j.spec.Partitions, ErrJoinMemoryLimit, j.limit)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if err := j.spill.left.read(p, j.probe); err != nil {
+			return err
+		}
+	}
+	j.table = nil
+	return nil
+}
+
+// joinRows returns the joined row of left and right; a nil right gives
+// the right columns NULL values
+func (j *hashJoin) joinRows(left, right map[string]interface{}) map[string]interface{} {
+	joined := make(map[string]interface{}, len(left)+len(j.rightOrder))
+	for col, v := range left {
+		joined[col] = v
+	}
+	for _, col := range j.rightOrder {
+		name := j.spec.RightPrefix + col
+		if _, ok := left[name]; ok {
+			continue
+		}
+		joined[name] = right[col]
+	}
+	return joined
+}
+
+// joinKey encodes the values of a row's key columns as a comparable key.
+// It reports false when a key is NULL.
+func joinKey(row map[string]interface{}, columns []string) (string, bool) {
+	var b strings.Builder
+	for _, col := range columns {
+		switch v := row[col].(type) {
+		case nil:
+			return "", false
+		case string:
+			fmt.Fprintf(&b, "s%q;", v)
+		case []byte:
+			fmt.Fprintf(&b, "s%q;", v)
+		case time.Time:
+			fmt.Fprintf(&b, "t%d;", v.UnixNano())
+		case bool:
+			fmt.Fprintf(&b, "b%t;", v)
+		default:
+			if r, ok := numericRat(v); ok {
+				fmt.Fprintf(&b, "#%s;", r.RatString())
+				continue
+			}
+			fmt.Fprintf(&b, "%T:%v;", v, v)
+		}
+	}
+	return b.String(), true
+}
+
+// estimateRowSize approximates the memory a row takes up
+func estimateRowSize(row map[string]interface{}) int64 {
+	size := int64(64)
+	for col, v := range row {
+		size += int64(len(col)) + 32
+		switch t := v.(type) {
+		case string:
+			size += int64(len(t))
+		case []byte:
+			size += int64(len(t))
+		case json.Number:
+			size += int64(len(t))
+		case map[string]interface{}:
+			size += estimateRowSize(t)
+		case []interface{}:
+			size += int64(len(t)) * 32
+		}
+	}
+	return size
+}
+
+var registerSpillTypes sync.Once
+
+// joinSpill holds the partition files of both sides of a spilled join
+type joinSpill struct {
+	left, right *spillPartitions
+}
+
+func newJoinSpill(dir string, partitions int) (*joinSpill, error) {
+	registerSpillTypes.Do(func() {
+		// Row values of these types are stored in interfaces, which gob
+		// only encodes for registered types
+		gob.Register(json.Number(""))
+		gob.Register(time.Time{})
+		gob.Register(map[string]interface{}{})
+		gob.Register([]interface{}{})
+	})
+	s := &joinSpill{}
+	var err error
+	if s.left, err = newSpillPartitions(dir, "left", partitions); err != nil {
+		return nil, err
+	}
+	if s.right, err = newSpillPartitions(dir, "right", partitions); err != nil {
+		s.left.remove()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *joinSpill) flush() error {
+	if err := s.left.flush(); err != nil {
+		return err
+	}
+	return s.right.flush()
+}
+
+func (s *joinSpill) bytes() int64 {
+	return s.left.written + s.right.written
+}
+
+func (j *hashJoin) removeSpill() {
+	if j.spill != nil {
+		j.spill.left.remove()
+		j.spill.right.remove()
+	}
+}
+
+// spillPartitions are the gob-encoded rows of one side of a spilled join,
+// in a temporary file per partition
+type spillPartitions struct {
+	files   []*os.File
+	writers []*bufio.Writer
+	encs    []*gob.Encoder
+	written int64
+}
+
+func newSpillPartitions(dir, side string, n int) (*spillPartitions, error) {
+	s := &spillPartitions{}
+	for i := 0; i < n; i++ {
+		f, err := os.CreateTemp(dir, fmt.Sprintf("workersql-join-%s-%d-*", side, i))
+		if err != nil {
+			s.remove()
+			return nil, fmt.Errorf("spill: %w", err)
+		}
+		w := bufio.NewWriter(f)
+		s.files = append(s.files, f)
+		s.writers = append(s.writers, w)
+		s.encs = append(s.encs, gob.NewEncoder(w))
+	}
+	return s, nil
+}
+
+func (s *spillPartitions) write(key string, row map[string]interface{}) error {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	p := int(h.Sum32() % uint32(len(s.files)))
+	if err := s.encs[p].Encode(row); err != nil {
+		return fmt.Errorf("spill: %w", err)
+	}
+	return nil
+}
+
+func (s *spillPartitions) flush() error {
+	for i, w := range s.writers {
+		if err := w.Flush(); err != nil {
+			return fmt.Errorf("spill: %w", err)
+		}
+		info, err := s.files[i].Stat()
+		if err != nil {
+			return fmt.Errorf("spill: %w", err)
+		}
+		s.written += info.Size()
+	}
+	return nil
+}
+
+// read calls fn with each row of partition p, in the order written
+func (s *spillPartitions) read(p int, fn func(row map[string]interface{}) error) error {
+	f := s.files[p]
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("spill: %w", err)
+	}
+	dec := gob.NewDecoder(bufio.NewReader(f))
+	for {
+		var row map[string]interface{}
+		if err := dec.Decode(&row); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("spill: %w", err)
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *spillPartitions) remove() {
+	for _, f := range s.files {
+		f.Close()
+		os.Remove(f.Name())
+	}
+}
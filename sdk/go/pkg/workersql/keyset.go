@@ -0,0 +1,56 @@
+package workersql
+
+import (
+	"strings"
+)
+
+// keysetAfter renders the condition selecting rows that sort after key in
+// the order of columns, descending when desc is set. Composite keys use a
+// row-value comparison, `(a, b) > (?, ?)`, which matches the ORDER BY
+// produced by keysetOrder.
+func keysetAfter(columns []string, key []interface{}, desc bool) (string, []interface{}) {
+	op := " > "
+	if desc {
+		op = " < "
+	}
+	if len(columns) == 1 {
+		return quoteIdentifier(columns[0]) + op + "?", key[:1]
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	return "(" + quoteIdentifiers(columns) + ")" + op + "(" + placeholders + ")", key[:len(columns)]
+}
+
+// keysetOrder renders the ORDER BY list for keyset pagination over columns
+func keysetOrder(columns []string, desc bool) string {
+	if !desc {
+		return quoteIdentifiers(columns)
+	}
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = quoteIdentifier(col) + " DESC"
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// rowKey extracts the key columns from a result row. It reports false if
+// any of them is missing.
+func rowKey(row map[string]interface{}, columns []string) ([]interface{}, bool) {
+	key := make([]interface{}, len(columns))
+	for i, col := range columns {
+		v, ok := row[col]
+		if !ok {
+			return nil, false
+		}
+		key[i] = v
+	}
+	return key, true
+}
+
+// quoteIdentifiers quotes and comma-separates column names
+func quoteIdentifiers(columns []string) string {
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = quoteIdentifier(col)
+	}
+	return strings.Join(quoted, ", ")
+}
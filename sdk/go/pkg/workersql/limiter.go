@@ -0,0 +1,177 @@
+package workersql
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultLimiterMaxIdleConnsPerHost is how many idle sockets a Limiter's
+// transport keeps for each gateway host
+const DefaultLimiterMaxIdleConnsPerHost = 16
+
+// LimiterConfig configures a Limiter
+type LimiterConfig struct {
+	// MaxInFlight caps the HTTP requests in flight across the limiter's
+	// clients; further requests wait for a slot until their context ends.
+	// Zero means no limit.
+	MaxInFlight int
+	// MaxConnsPerHost caps the sockets open to each gateway host, dialing
+	// included. Zero means no limit.
+	MaxConnsPerHost int
+	// MaxIdleConnsPerHost is how many idle sockets are kept for each
+	// gateway host (default: 16)
+	MaxIdleConnsPerHost int
+	// Transport, if set, sends the requests instead of a transport the
+	// limiter builds; MaxConnsPerHost and MaxIdleConnsPerHost then don't
+	// apply
+	Transport http.RoundTripper
+}
+
+// LimiterStats is a snapshot of a Limiter
+type LimiterStats struct {
+	InFlight int64 `json:"inFlight"`
+	// Waiting counts requests waiting for a slot
+	Waiting int64 `json:"waiting"`
+	// Waits counts requests that had to wait, WaitDuration their total wait
+	Waits        int64         `json:"waits"`
+	WaitDuration time.Duration `json:"waitDuration"`
+	// Abandoned counts requests whose context ended while waiting
+	Abandoned   int64 `json:"abandoned"`
+	MaxInFlight int   `json:"maxInFlight"`
+}
+
+// Limiter is an HTTP transport shared by clients through Config.Limiter,
+// so the sockets and in-flight requests of every client in the process
+// respect one set of caps, however many clients there are:
+//
+//	limiter := workersql.NewLimiter(workersql.LimiterConfig{MaxInFlight: 256, MaxConnsPerHost: 64})
+//	orders, _ := workersql.NewClient(workersql.Config{APIEndpoint: ordersURL, Limiter: limiter})
+//	billing, _ := workersql.NewClient(workersql.Config{APIEndpoint: billingURL, Limiter: limiter})
+//
+// A request holds its slot until its response body is read. WebSocket
+// transactions don't go through the limiter.
+type Limiter struct {
+	transport http.RoundTripper
+	// own is the transport the limiter built
+	own *http.Transport
+	// slots holds a token per request in flight, nil without MaxInFlight
+	slots chan struct{}
+
+	inFlight     int64
+	waiting      int64
+	waits        int64
+	waitDuration int64
+	abandoned    int64
+}
+
+var _ http.RoundTripper = (*Limiter)(nil)
+
+// NewLimiter returns a Limiter for config
+func NewLimiter(config LimiterConfig) *Limiter {
+	l := &Limiter{transport: config.Transport}
+	if l.transport == nil {
+		if config.MaxIdleConnsPerHost <= 0 {
+			config.MaxIdleConnsPerHost = DefaultLimiterMaxIdleConnsPerHost
+		}
+		l.own = http.DefaultTransport.(*http.Transport).Clone()
+		l.own.MaxIdleConns = 0
+		l.own.MaxIdleConnsPerHost = config.MaxIdleConnsPerHost
+		l.own.MaxConnsPerHost = config.MaxConnsPerHost
+		l.transport = l.own
+	}
+	if config.MaxInFlight > 0 {
+		l.slots = make(chan struct{}, config.MaxInFlight)
+	}
+	return l
+}
+
+// RoundTrip sends req once a slot is free
+func (l *Limiter) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := l.acquire(req); err != nil {
+		return nil, err
+	}
+	resp, err := l.transport.RoundTrip(req)
+	if err != nil {
+		l.release()
+		return nil, err
+	}
+	resp.Body = &slotBody{ReadCloser: resp.Body, release: l.release}
+	return resp, nil
+}
+
+func (l *Limiter) acquire(req *http.Request) error {
+	atomic.AddInt64(&l.inFlight, 1)
+	if l.slots == nil {
+		return nil
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	start := time.Now()
+	atomic.AddInt64(&l.waiting, 1)
+	defer func() {
+		atomic.AddInt64(&l.waiting, -1)
+		atomic.AddInt64(&l.waits, 1)
+		atomic.AddInt64(&l.waitDuration, int64(time.Since(start)))
+	}()
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-req.Context().Done():
+		atomic.AddInt64(&l.inFlight, -1)
+		atomic.AddInt64(&l.abandoned, 1)
+		return req.Context().Err()
+	}
+}
+
+func (l *Limiter) release() {
+	atomic.AddInt64(&l.inFlight, -1)
+	if l.slots != nil {
+		<-l.slots
+	}
+}
+
+// Stats returns a snapshot of the limiter
+func (l *Limiter) Stats() LimiterStats {
+	return LimiterStats{
+		InFlight:     atomic.LoadInt64(&l.inFlight),
+		Waiting:      atomic.LoadInt64(&l.waiting),
+		Waits:        atomic.LoadInt64(&l.waits),
+		WaitDuration: time.Duration(atomic.LoadInt64(&l.waitDuration)),
+		Abandoned:    atomic.LoadInt64(&l.abandoned),
+		MaxInFlight:  cap(l.slots),
+	}
+}
+
+// CloseIdleConnections closes the idle sockets of a transport the limiter
+// built. Closing a client doesn't, as other clients may use them.
+func (l *Limiter) CloseIdleConnections() {
+	if l.own != nil {
+		l.own.CloseIdleConnections()
+	}
+}
+
+// sharedTransport hides CloseIdleConnections from the clients sharing a
+// transport, so closing one doesn't close the others' idle sockets
+type sharedTransport struct {
+	http.RoundTripper
+}
+
+// slotBody releases its request's slot when closed
+type slotBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *slotBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
@@ -0,0 +1,434 @@
+package workersql
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Local development defaults
+const (
+	// DefaultLocalPort is the port wrangler dev listens on by default
+	DefaultLocalPort         = 8787
+	DefaultLocalScanPorts    = 10
+	DefaultLocalStartTimeout = time.Minute
+)
+
+// ErrNoLocalGateway is returned by NewLocalClient when no wrangler dev
+// instance answers and LocalOptions.Start is false
+var ErrNoLocalGateway = errors.New("no local gateway found")
+
+// wranglerConfigNames are the names of wrangler's configuration file, in
+// the order wrangler prefers them
+var wranglerConfigNames = []string{"wrangler.json", "wrangler.jsonc", "wrangler.toml"}
+
+// LocalOptions configures NewLocalClient
+type LocalOptions struct {
+	// ConfigPath is the gateway's wrangler.toml, wrangler.json or
+	// wrangler.jsonc, whose [dev] settings give the host, port and
+	// protocol (default: the first found in the working directory or its
+	// parents)
+	ConfigPath string
+	// Host is the host the gateway listens on (default: the dev ip of the
+	// configuration, or localhost)
+	Host string
+	// Port skips discovery and uses this port (default: the dev port of
+	// the configuration, then ScanPorts ports from 8787)
+	Port int
+	// ScanPorts is how many ports from 8787 are probed (default: 10)
+	ScanPorts int
+
+	// Start launches wrangler dev when no instance answers, on a free port
+	// unless Port is set. Closing the client stops it.
+	Start bool
+	// Command replaces "npx wrangler dev --local"; the flags selecting the
+	// port, configuration and environment are appended
+	Command []string
+	// Env is the wrangler environment to start (--env)
+	Env string
+	// StartTimeout bounds how long a launched instance takes to answer
+	// (default: 1m)
+	StartTimeout time.Duration
+	// Output receives the output of a launched instance (default:
+	// discarded)
+	Output io.Writer
+
+	// Config is the base client configuration; its endpoint fields are
+	// replaced by the local gateway's
+	Config Config
+}
+
+// wranglerDev is the [dev] section of a wrangler configuration
+type wranglerDev struct {
+	IP            string `json:"ip"`
+	Port          int    `json:"port"`
+	LocalProtocol string `json:"local_protocol"`
+}
+
+// NewLocalClient returns a client of a gateway running under wrangler dev
+// (or miniflare) on this machine, for local development and tests. It
+// probes /v1/health on the port of the wrangler configuration and the
+// usual wrangler ports; with Start it launches wrangler dev when none
+// answers, and stops it when the client is closed.
+//
+//	client, err := workersql.NewLocalClient(ctx, workersql.LocalOptions{
+//		ConfigPath: "../../wrangler.toml",
+//		Start:      true,
+//	})
+func NewLocalClient(ctx context.Context, opts LocalOptions) (*Client, error) {
+	var dev wranglerDev
+	if opts.ConfigPath == "" {
+		opts.ConfigPath = findWranglerConfig()
+	}
+	if opts.ConfigPath != "" {
+		var err error
+		if dev, err = readWranglerDev(opts.ConfigPath); err != nil {
+			return nil, err
+		}
+	}
+
+	host := opts.Host
+	if host == "" {
+		host = dev.IP
+	}
+	if host == "" || host == "*" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	scheme := "http"
+	if dev.LocalProtocol == "https" {
+		scheme = "https"
+	}
+
+	var ports []int
+	switch {
+	case opts.Port > 0:
+		ports = []int{opts.Port}
+	default:
+		if dev.Port > 0 {
+			ports = append(ports, dev.Port)
+		}
+		if opts.ScanPorts <= 0 {
+			opts.ScanPorts = DefaultLocalScanPorts
+		}
+		for port := DefaultLocalPort; port < DefaultLocalPort+opts.ScanPorts; port++ {
+			if port != dev.Port {
+				ports = append(ports, port)
+			}
+		}
+	}
+
+	transport := localTransport(scheme)
+	probe := newLocalProbe(transport)
+	for _, port := range ports {
+		endpoint := localEndpoint(scheme, host, port)
+		if probe.check(ctx, endpoint) {
+			return newLocalClient(opts.Config, endpoint, transport, nil)
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+	if !opts.Start {
+		return nil, fmt.Errorf("%w: probed %s on ports %v", ErrNoLocalGateway, host, ports)
+	}
+
+	port := opts.Port
+	if port <= 0 {
+		var err error
+		if port, err = freePort(host); err != nil {
+			return nil, fmt.Errorf("local gateway: finding a free port: %w", err)
+		}
+	}
+	process, err := startWrangler(opts, port)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := localEndpoint(scheme, host, port)
+	if err := process.waitReady(ctx, probe, endpoint, opts.StartTimeout); err != nil {
+		process.stop()
+		return nil, err
+	}
+	return newLocalClient(opts.Config, endpoint, transport, process)
+}
+
+func localEndpoint(scheme, host string, port int) string {
+	return fmt.Sprintf("%s://%s/v1", scheme, net.JoinHostPort(host, strconv.Itoa(port)))
+}
+
+func newLocalClient(config Config, endpoint string, transport http.RoundTripper, process *localProcess) (*Client, error) {
+	config.APIEndpoint = endpoint
+	config.Endpoints = nil
+	config.Host, config.Port = "", 0
+	config.SSL = strings.HasPrefix(endpoint, "https:")
+	if config.Transport == nil && config.Limiter == nil {
+		config.Transport = transport
+	}
+	client, err := NewClient(config)
+	if err != nil {
+		process.stop()
+		return nil, err
+	}
+	client.local = process
+	return client, nil
+}
+
+// findWranglerConfig returns the wrangler configuration in the working
+// directory or the closest of its parents, or "" if there is none
+func findWranglerConfig() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for {
+		for _, name := range wranglerConfigNames {
+			path := filepath.Join(dir, name)
+			if _, err := os.Stat(path); err == nil {
+				return path
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// readWranglerDev reads the dev settings of a wrangler configuration
+func readWranglerDev(path string) (wranglerDev, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return wranglerDev{}, fmt.Errorf("local gateway: reading %s: %w", path, err)
+	}
+	if strings.HasSuffix(path, ".toml") {
+		return parseWranglerTOML(content), nil
+	}
+	var config struct {
+		Dev wranglerDev `json:"dev"`
+	}
+	if err := json.Unmarshal(stripJSONComments(content), &config); err != nil {
+		return wranglerDev{}, fmt.Errorf("local gateway: parsing %s: %w", path, err)
+	}
+	return config.Dev, nil
+}
+
+// parseWranglerTOML reads the [dev] table of a wrangler.toml. Only the
+// scalar keys wrangler dev uses are understood.
+func parseWranglerTOML(content []byte) wranglerDev {
+	var dev wranglerDev
+	inDev := false
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			inDev = line == "[dev]"
+			continue
+		}
+		if !inDev {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if strings.HasPrefix(value, `"`) || strings.HasPrefix(value, "'") {
+			quote := value[:1]
+			if end := strings.Index(value[1:], quote); end >= 0 {
+				value = value[1 : end+1]
+			}
+		} else if hash := strings.Index(value, "#"); hash >= 0 {
+			value = strings.TrimSpace(value[:hash])
+		}
+		switch strings.TrimSpace(key) {
+		case "ip":
+			dev.IP = value
+		case "port":
+			dev.Port, _ = strconv.Atoi(value)
+		case "local_protocol":
+			dev.LocalProtocol = value
+		}
+	}
+	return dev
+}
+
+// stripJSONComments removes the // and /* */ comments of a JSONC document
+func stripJSONComments(content []byte) []byte {
+	var out bytes.Buffer
+	inString := false
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		switch {
+		case inString:
+			out.WriteByte(c)
+			if c == '\\' && i+1 < len(content) {
+				i++
+				out.WriteByte(content[i])
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+			out.WriteByte(c)
+		case c == '/' && i+1 < len(content) && content[i+1] == '/':
+			for i < len(content) && content[i] != '\n' {
+				i++
+			}
+			out.WriteByte('\n')
+		case c == '/' && i+1 < len(content) && content[i+1] == '*':
+			end := bytes.Index(content[i+2:], []byte("*/"))
+			if end < 0 {
+				return out.Bytes()
+			}
+			i += end + 3
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.Bytes()
+}
+
+// localProbe recognizes a WorkerSQL gateway by its health response
+type localProbe struct {
+	client *http.Client
+}
+
+func newLocalProbe(transport http.RoundTripper) *localProbe {
+	return &localProbe{client: &http.Client{Timeout: time.Second, Transport: transport}}
+}
+
+// localTransport returns the transport for a local gateway. wrangler dev
+// serves https with a self-signed certificate, which isn't verified.
+func localTransport(scheme string) http.RoundTripper {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if scheme == "https" {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return transport
+}
+
+// check reports whether a gateway answers /health at endpoint. An
+// unhealthy gateway still counts: it is running, only its database isn't.
+func (p *localProbe) check(ctx context.Context, endpoint string) bool {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"/health", nil)
+	if err != nil {
+		return false
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	var health struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&health); err != nil {
+		return false
+	}
+	return health.Status != ""
+}
+
+// freePort returns a port nothing listens on
+func freePort(host string) (int, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// localProcess is a wrangler dev instance launched by NewLocalClient
+type localProcess struct {
+	cmd    *exec.Cmd
+	exited chan struct{}
+	err    error
+	once   sync.Once
+}
+
+// startWrangler launches wrangler dev on port
+func startWrangler(opts LocalOptions, port int) (*localProcess, error) {
+	args := opts.Command
+	if len(args) == 0 {
+		args = []string{"npx", "wrangler", "dev", "--local"}
+	}
+	args = append(append([]string(nil), args...), "--port", strconv.Itoa(port))
+	if opts.ConfigPath != "" {
+		args = append(args, "--config", opts.ConfigPath)
+	}
+	if opts.Env != "" {
+		args = append(args, "--env", opts.Env)
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	if opts.ConfigPath != "" {
+		cmd.Dir = filepath.Dir(opts.ConfigPath)
+	}
+	cmd.Stdout, cmd.Stderr = opts.Output, opts.Output
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("local gateway: starting %s: %w", strings.Join(args, " "), err)
+	}
+	p := &localProcess{cmd: cmd, exited: make(chan struct{})}
+	go func() {
+		p.err = cmd.Wait()
+		close(p.exited)
+	}()
+	return p, nil
+}
+
+// waitReady waits until the gateway answers at endpoint
+func (p *localProcess) waitReady(ctx context.Context, probe *localProbe, endpoint string, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = DefaultLocalStartTimeout
+	}
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if probe.check(ctx, endpoint) {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-p.exited:
+			return fmt.Errorf("local gateway: wrangler dev exited before answering: %v", p.err)
+		case <-deadline.C:
+			return fmt.Errorf("local gateway: wrangler dev didn't answer at %s within %s", endpoint, timeout)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// stop terminates the process and its children, killing them if they
+// don't exit within 5s
+func (p *localProcess) stop() {
+	if p == nil {
+		return
+	}
+	p.once.Do(func() {
+		terminateProcessGroup(p.cmd)
+		select {
+		case <-p.exited:
+		case <-time.After(5 * time.Second):
+			killProcessGroup(p.cmd)
+			<-p.exited
+		}
+	})
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package workersql
+
+import "os/exec"
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func terminateProcessGroup(cmd *exec.Cmd) {
+	_ = cmd.Process.Kill()
+}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	_ = cmd.Process.Kill()
+}
@@ -0,0 +1,207 @@
+package workersql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// DefaultLockHeartbeatInterval is how often a held advisory lock is checked
+// by default
+const DefaultLockHeartbeatInterval = 10 * time.Second
+
+// lockWaitSlice caps how long one GET_LOCK call waits, so waiting for a
+// lock never outlasts a frame timeout and notices ctx ending
+const lockWaitSlice = 10 * time.Second
+
+var (
+	// ErrLockTimeout is returned by AcquireLock when the lock is still held
+	// by another session once the timeout passed
+	ErrLockTimeout = errors.New("timed out waiting for lock")
+	// ErrLockLost is returned by Release when the lock was lost, its session
+	// having been disconnected
+	ErrLockLost = errors.New("lock lost")
+)
+
+// Lock is a MySQL advisory lock held with GET_LOCK on a session of its own.
+// A heartbeat checks the lock every Config.LockHeartbeatInterval, keeping
+// the session active; the lock is lost if the session is disconnected,
+// which the server treats as a release.
+type Lock struct {
+	name    string
+	session *Session
+	// dials is the session's dial count when the lock was acquired
+	dials int
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+	lost     chan struct{}
+	lostOnce sync.Once
+}
+
+// AcquireLock takes the advisory lock name, waiting up to timeout while
+// another session holds it. A zero timeout tries once. The lock is held
+// until Release, or lost with its session.
+func (c *Client) AcquireLock(ctx context.Context, name string, timeout time.Duration) (*Lock, error) {
+	session, err := c.Session(ctx)
+	if err != nil {
+		return nil, err
+	}
+	l := &Lock{
+		name:    name,
+		session: session,
+		stop:    make(chan struct{}),
+		lost:    make(chan struct{}),
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		wait := time.Until(deadline)
+		if wait < 0 {
+			wait = 0
+		}
+		if wait > lockWaitSlice {
+			wait = lockWaitSlice
+		}
+		acquired, err := l.get(ctx, wait)
+		if err != nil {
+			_ = session.Close()
+			return nil, fmt.Errorf("failed to acquire lock %q: %w", name, err)
+		}
+		if acquired {
+			// Connections lost while waiting held nothing
+			l.dials = session.dialCount()
+			break
+		}
+		if !time.Now().Before(deadline) {
+			_ = session.Close()
+			return nil, fmt.Errorf("lock %q: %w", name, ErrLockTimeout)
+		}
+	}
+
+	interval := c.config.LockHeartbeatInterval
+	if interval == 0 {
+		interval = DefaultLockHeartbeatInterval
+	}
+	if interval > 0 {
+		l.wg.Add(1)
+		go l.heartbeat(interval)
+	}
+	return l, nil
+}
+
+// get runs GET_LOCK, waiting up to wait for the lock
+func (l *Lock) get(ctx context.Context, wait time.Duration) (bool, error) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	resp, err := l.session.Query(ctx, "SELECT GET_LOCK(?, ?) AS acquired", l.name, seconds)
+	if err != nil {
+		return false, err
+	}
+	if resp.Success && len(resp.Data) > 0 && resp.Data[0]["acquired"] == nil {
+		return false, fmt.Errorf("GET_LOCK returned NULL")
+	}
+	return lockResult(resp, "acquired")
+}
+
+// lockResult reads the boolean column of a lock function's result, NULL
+// meaning the lock isn't held by anyone
+func lockResult(resp *QueryResponse, column string) (bool, error) {
+	if !resp.Success || len(resp.Data) == 0 {
+		if resp.Error != nil {
+			return false, fmt.Errorf("%s: %s", resp.Error.Code, resp.Error.Message)
+		}
+		return false, fmt.Errorf("lock query returned no result")
+	}
+	value := resp.Data[0][column]
+	if value == nil {
+		return false, nil
+	}
+	held, ok := toBool(value)
+	if !ok {
+		return false, fmt.Errorf("lock query returned %v", resp.Data[0][column])
+	}
+	return held, nil
+}
+
+// heartbeat checks the lock every interval until Release, marking it lost
+// once the session was re-dialed or the server says another connection
+// holds it
+func (l *Lock) heartbeat(interval time.Duration) {
+	defer l.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		resp, err := l.session.Query(ctx, "SELECT IS_USED_LOCK(?) = CONNECTION_ID() AS held", l.name)
+		cancel()
+		if l.session.dialCount() != l.dials {
+			l.markLost()
+			return
+		}
+		if err != nil {
+			// Transient failures are retried on the next tick
+			continue
+		}
+		if held, err := lockResult(resp, "held"); err == nil && !held {
+			l.markLost()
+			return
+		}
+	}
+}
+
+func (l *Lock) markLost() {
+	l.lostOnce.Do(func() { close(l.lost) })
+}
+
+// Name returns the name of the lock
+func (l *Lock) Name() string {
+	return l.name
+}
+
+// Lost returns a channel closed once the lock is found lost, so a job can
+// stop work that required it
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Release releases the lock with RELEASE_LOCK and closes its session. It
+// returns ErrLockLost if the lock was lost before.
+func (l *Lock) Release(ctx context.Context) error {
+	l.stopOnce.Do(func() { close(l.stop) })
+	l.wg.Wait()
+	defer l.session.Close()
+
+	select {
+	case <-l.lost:
+		return fmt.Errorf("lock %q: %w", l.name, ErrLockLost)
+	default:
+	}
+
+	resp, err := l.session.Query(ctx, "SELECT RELEASE_LOCK(?) AS released", l.name)
+	if err == nil && l.session.dialCount() != l.dials {
+		l.markLost()
+		return fmt.Errorf("lock %q: %w", l.name, ErrLockLost)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to release lock %q: %w", l.name, err)
+	}
+	released, err := lockResult(resp, "released")
+	if err != nil {
+		return fmt.Errorf("failed to release lock %q: %w", l.name, err)
+	}
+	if !released {
+		l.markLost()
+		return fmt.Errorf("lock %q: %w", l.name, ErrLockLost)
+	}
+	return nil
+}
@@ -0,0 +1,346 @@
+package workersql
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/internal/dsn"
+)
+
+// Client manager defaults
+const (
+	DefaultManagerMaxClients   = 256
+	DefaultManagerIdleTimeout  = 10 * time.Minute
+	DefaultManagerDrainTimeout = 30 * time.Second
+)
+
+// ClientManagerConfig configures a ClientManager
+type ClientManagerConfig struct {
+	// Resolve returns the configuration of the client for key, e.g. by
+	// looking a tenant up (default: key is parsed as a DSN)
+	Resolve func(ctx context.Context, key string) (Config, error)
+	// MaxClients caps the clients kept; the least recently used is evicted
+	// to make room (default: 256)
+	MaxClients int
+	// IdleTimeout evicts clients unused for this long (default: 10m). A
+	// negative value keeps them until MaxClients evicts them.
+	IdleTimeout time.Duration
+	// MaxConnections caps the HTTP requests in flight across all clients;
+	// further requests wait for a slot until their context ends. Zero
+	// means no limit.
+	MaxConnections int
+	// MaxIdleConnsPerHost is how many idle sockets the shared transport
+	// keeps for each gateway host (default: 16)
+	MaxIdleConnsPerHost int
+	// Transport, if set, replaces the shared transport the manager builds
+	Transport http.RoundTripper
+	// Limiter, if set, is shared by the clients instead of one built from
+	// the fields above, e.g. to share caps with clients made elsewhere
+	Limiter *Limiter
+	// DrainTimeout bounds the Shutdown of evicted clients (default: 30s)
+	DrainTimeout time.Duration
+}
+
+// ClientManager lazily creates, caches and evicts clients keyed by DSN or
+// tenant, for services talking to many databases. Its clients share one
+// HTTP transport, so sockets to a gateway are reused across tenants, and
+// MaxConnections bounds the requests all of them have in flight.
+//
+// Evicted clients are shut down gracefully, so call Get for each unit of
+// work rather than keeping the client:
+//
+//	manager := workersql.NewClientManager(workersql.ClientManagerConfig{
+//		Resolve: func(ctx context.Context, tenant string) (workersql.Config, error) {
+//			return tenantConfig(ctx, tenant)
+//		},
+//		MaxConnections: 512,
+//	})
+//	defer manager.Close()
+//	client, err := manager.Get(ctx, tenantID)
+type ClientManager struct {
+	config  ClientManagerConfig
+	limiter *Limiter
+	// ownLimiter is set when the manager built limiter, closing it with
+	// the manager
+	ownLimiter bool
+
+	mu      sync.Mutex
+	clients map[string]*managedClient
+	// lru orders clients from most to least recently used
+	lru    *list.List
+	closed bool
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	// wg tracks the idle sweeper and the shutdowns of evicted clients
+	wg sync.WaitGroup
+}
+
+// managedClient is a client of a ClientManager, ready once created
+type managedClient struct {
+	key      string
+	ready    chan struct{}
+	client   *Client
+	err      error
+	lastUsed time.Time
+	elem     *list.Element
+}
+
+// NewClientManager returns a ClientManager without clients
+func NewClientManager(config ClientManagerConfig) *ClientManager {
+	if config.MaxClients <= 0 {
+		config.MaxClients = DefaultManagerMaxClients
+	}
+	if config.IdleTimeout == 0 {
+		config.IdleTimeout = DefaultManagerIdleTimeout
+	}
+	if config.DrainTimeout <= 0 {
+		config.DrainTimeout = DefaultManagerDrainTimeout
+	}
+
+	m := &ClientManager{
+		config:  config,
+		clients: make(map[string]*managedClient),
+		lru:     list.New(),
+		stop:    make(chan struct{}),
+	}
+	m.limiter = config.Limiter
+	if m.limiter == nil {
+		m.limiter = NewLimiter(LimiterConfig{
+			MaxInFlight:         config.MaxConnections,
+			MaxIdleConnsPerHost: config.MaxIdleConnsPerHost,
+			Transport:           config.Transport,
+		})
+		m.ownLimiter = true
+	}
+
+	if config.IdleTimeout > 0 {
+		m.wg.Add(1)
+		go m.sweep()
+	}
+	return m
+}
+
+// Get returns the client for key, creating it on first use. Concurrent
+// calls for a new key share its creation; a failed creation isn't cached.
+func (m *ClientManager) Get(ctx context.Context, key string) (*Client, error) {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil, ErrClientClosed
+	}
+	if e, ok := m.clients[key]; ok {
+		e.lastUsed = time.Now()
+		m.lru.MoveToFront(e.elem)
+		m.mu.Unlock()
+		select {
+		case <-e.ready:
+			return e.client, e.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	e := &managedClient{key: key, ready: make(chan struct{}), lastUsed: time.Now()}
+	e.elem = m.lru.PushFront(e)
+	m.clients[key] = e
+	var evicted []*managedClient
+	for m.lru.Len() > m.config.MaxClients {
+		evicted = append(evicted, m.remove(m.lru.Back().Value.(*managedClient)))
+	}
+	m.mu.Unlock()
+	for _, old := range evicted {
+		m.retire(old)
+	}
+
+	e.client, e.err = m.create(ctx, key)
+	if e.err != nil {
+		m.mu.Lock()
+		if m.clients[key] == e {
+			m.remove(e)
+		}
+		m.mu.Unlock()
+	}
+	close(e.ready)
+	return e.client, e.err
+}
+
+// create builds the client for key on the shared transport
+func (m *ClientManager) create(ctx context.Context, key string) (*Client, error) {
+	var config Config
+	if m.config.Resolve != nil {
+		var err error
+		if config, err = m.config.Resolve(ctx, key); err != nil {
+			return nil, fmt.Errorf("client manager: resolving %q: %w", key, err)
+		}
+	} else {
+		parsed, err := dsn.Parse(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse DSN: %w", err)
+		}
+		config = configFromDSN(parsed)
+	}
+	if config.Transport == nil && config.Limiter == nil {
+		config.Limiter = m.limiter
+	}
+	return NewClient(config)
+}
+
+// Evict drops the client for key, e.g. after the tenant's configuration
+// changed. The client is shut down in the background; the next Get
+// creates a new one.
+func (m *ClientManager) Evict(key string) {
+	m.mu.Lock()
+	e, ok := m.clients[key]
+	if ok {
+		m.remove(e)
+	}
+	m.mu.Unlock()
+	if ok {
+		m.retire(e)
+	}
+}
+
+// Limiter returns the limiter shared by the manager's clients, e.g. for
+// its stats
+func (m *ClientManager) Limiter() *Limiter {
+	return m.limiter
+}
+
+// Len returns the number of clients kept
+func (m *ClientManager) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.clients)
+}
+
+// remove drops e from the cache and returns it. m.mu must be held.
+func (m *ClientManager) remove(e *managedClient) *managedClient {
+	delete(m.clients, e.key)
+	m.lru.Remove(e.elem)
+	return e
+}
+
+// retire shuts the client of an evicted entry down once it is created,
+// letting callers that got it finish their work
+func (m *ClientManager) retire(e *managedClient) {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		<-e.ready
+		if e.client == nil {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), m.config.DrainTimeout)
+		defer cancel()
+		_ = e.client.Shutdown(ctx)
+	}()
+}
+
+// sweep evicts clients idle for longer than IdleTimeout until the manager
+// is closed
+func (m *ClientManager) sweep() {
+	defer m.wg.Done()
+	ticker := time.NewTicker(m.config.IdleTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case now := <-ticker.C:
+			var idle []*managedClient
+			m.mu.Lock()
+			for elem := m.lru.Back(); elem != nil; {
+				e := elem.Value.(*managedClient)
+				if now.Sub(e.lastUsed) < m.config.IdleTimeout {
+					break
+				}
+				elem = elem.Prev()
+				idle = append(idle, m.remove(e))
+			}
+			m.mu.Unlock()
+			for _, e := range idle {
+				m.retire(e)
+			}
+		}
+	}
+}
+
+// Shutdown shuts every client down, as by Client.Shutdown, and makes Get
+// fail with ErrClientClosed. If ctx ends first the remaining work is
+// abandoned and the errors are returned.
+func (m *ClientManager) Shutdown(ctx context.Context) error {
+	all := m.closeAll()
+	errs := make([]error, len(all))
+	var wg sync.WaitGroup
+	for i, e := range all {
+		wg.Add(1)
+		go func(i int, e *managedClient) {
+			defer wg.Done()
+			select {
+			case <-e.ready:
+			case <-ctx.Done():
+				errs[i] = fmt.Errorf("client manager: %q: %w", e.key, ctx.Err())
+				return
+			}
+			if e.client != nil {
+				if err := e.client.Shutdown(ctx); err != nil {
+					errs[i] = fmt.Errorf("client manager: %q: %w", e.key, err)
+				}
+			}
+		}(i, e)
+	}
+	wg.Wait()
+
+	// Evicted clients still draining get until ctx ends too
+	retired := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(retired)
+	}()
+	select {
+	case <-retired:
+	case <-ctx.Done():
+	}
+	if m.ownLimiter {
+		m.limiter.CloseIdleConnections()
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes every client straight away, abandoning their work, and
+// makes Get fail with ErrClientClosed. Evicted clients still draining
+// finish within DrainTimeout.
+func (m *ClientManager) Close() error {
+	var errs []error
+	for _, e := range m.closeAll() {
+		<-e.ready
+		if e.client != nil {
+			if err := e.client.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("client manager: %q: %w", e.key, err))
+			}
+		}
+	}
+	if m.ownLimiter {
+		m.limiter.CloseIdleConnections()
+	}
+	return errors.Join(errs...)
+}
+
+// closeAll stops the manager and takes its clients
+func (m *ClientManager) closeAll() []*managedClient {
+	m.mu.Lock()
+	m.closed = true
+	var all []*managedClient
+	for _, e := range m.clients {
+		all = append(all, m.remove(e))
+	}
+	m.mu.Unlock()
+	m.stopOnce.Do(func() { close(m.stop) })
+	return all
+}
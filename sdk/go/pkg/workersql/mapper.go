@@ -0,0 +1,352 @@
+package workersql
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// fieldInfo describes how a struct field maps to a column. Options follow the
+// column name in the `db` tag:
+//
+//	pk         part of the primary key; several fields form a composite key
+//	auto       AUTO_INCREMENT; omitted on insert when zero and set from LastInsertID
+//	default    has a column DEFAULT; omitted on insert when zero and read back
+//	generated  generated by the database; never written and read back after writes
+type fieldInfo struct {
+	column     string
+	index      []int
+	tagged     bool
+	pk         bool
+	auto       bool
+	hasDefault bool
+	generated  bool
+}
+
+// structInfo is the cached column mapping of a struct type
+type structInfo struct {
+	fields   []*fieldInfo
+	byColumn map[string]*fieldInfo
+	// byFold finds untagged fields case-insensitively
+	byFold map[string]*fieldInfo
+	pk     []*fieldInfo
+}
+
+var structInfos sync.Map // reflect.Type -> *structInfo
+
+// getStructInfo returns the column mapping of struct type t
+func getStructInfo(t reflect.Type) *structInfo {
+	if cached, ok := structInfos.Load(t); ok {
+		return cached.(*structInfo)
+	}
+
+	info := &structInfo{
+		byColumn: make(map[string]*fieldInfo),
+		byFold:   make(map[string]*fieldInfo),
+	}
+	collectFields(info, t, nil)
+	for _, f := range info.fields {
+		if _, dup := info.byColumn[f.column]; !dup {
+			info.byColumn[f.column] = f
+		}
+		if !f.tagged {
+			if _, dup := info.byFold[strings.ToLower(f.column)]; !dup {
+				info.byFold[strings.ToLower(f.column)] = f
+			}
+		}
+		if f.pk {
+			info.pk = append(info.pk, f)
+		}
+	}
+
+	cached, _ := structInfos.LoadOrStore(t, info)
+	return cached.(*structInfo)
+}
+
+func collectFields(info *structInfo, t reflect.Type, index []int) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		path := append(append([]int(nil), index...), i)
+
+		tag := sf.Tag.Get("db")
+		if tag == "-" {
+			continue
+		}
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct && tag == "" {
+			// Exported fields of embedded structs are promoted even when the
+			// embedded type itself is unexported
+			collectFields(info, sf.Type, path)
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		f := &fieldInfo{column: sf.Name, index: path}
+		if tag != "" {
+			parts := strings.Split(tag, ",")
+			if parts[0] != "" {
+				f.column = parts[0]
+				f.tagged = true
+			}
+			for _, opt := range parts[1:] {
+				switch strings.TrimSpace(opt) {
+				case "pk":
+					f.pk = true
+				case "auto":
+					f.auto = true
+				case "default":
+					f.hasDefault = true
+				case "generated":
+					f.generated = true
+				}
+			}
+		}
+		info.fields = append(info.fields, f)
+	}
+}
+
+// lookup returns the field mapped to column, or nil
+func (s *structInfo) lookup(column string) *fieldInfo {
+	if f, ok := s.byColumn[column]; ok {
+		return f
+	}
+	return s.byFold[strings.ToLower(column)]
+}
+
+// structPointer checks that v points to a struct and returns the struct
+func structPointer(v interface{}) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("expected a pointer to a struct, got %T", v)
+	}
+	return rv.Elem(), nil
+}
+
+// pkCondition renders "`a` = ? AND `b` = ?" for the struct's primary key,
+// taking the key values from pk when given and from the struct otherwise.
+// Composite keys are matched in field declaration order.
+func (s *structInfo) pkCondition(rv reflect.Value, pk []interface{}) (string, []interface{}, error) {
+	if len(s.pk) == 0 {
+		return "", nil, fmt.Errorf("%s has no field tagged as primary key (db:\"column,pk\")", rv.Type())
+	}
+	if len(pk) > 0 && len(pk) != len(s.pk) {
+		return "", nil, fmt.Errorf("%s: expected %d primary key values (%s), got %d", rv.Type(), len(s.pk), strings.Join(s.pkColumns(), ", "), len(pk))
+	}
+
+	conditions := make([]string, len(s.pk))
+	params := make([]interface{}, len(s.pk))
+	for i, f := range s.pk {
+		conditions[i] = quoteIdentifier(f.column) + " = ?"
+		if len(pk) > 0 {
+			params[i] = pk[i]
+		} else {
+			params[i] = rv.FieldByIndex(f.index).Interface()
+		}
+	}
+	return strings.Join(conditions, " AND "), params, nil
+}
+
+// pkColumns returns the primary key column names in declaration order
+func (s *structInfo) pkColumns() []string {
+	columns := make([]string, len(s.pk))
+	for i, f := range s.pk {
+		columns[i] = f.column
+	}
+	return columns
+}
+
+// readBack selects columns for the row identified by the struct's primary
+// key and scans them into the struct, emulating INSERT ... RETURNING
+func (c *Client) readBack(ctx context.Context, table string, rv reflect.Value, info *structInfo, fields []*fieldInfo) error {
+	where, params, err := info.pkCondition(rv, nil)
+	if err != nil {
+		return fmt.Errorf("reading back generated columns: %w", err)
+	}
+
+	columns := make([]string, len(fields))
+	for i, f := range fields {
+		columns[i] = quoteIdentifier(f.column)
+	}
+	sql := "SELECT " + strings.Join(columns, ", ") + " FROM " + quoteIdentifier(table) + " WHERE " + where
+
+	resp, err := c.Query(ctx, sql, params...)
+	if err != nil {
+		return fmt.Errorf("reading back generated columns: %w", err)
+	}
+	if err := resp.failure(); err != nil {
+		return fmt.Errorf("reading back generated columns: %w", err)
+	}
+	if len(resp.Data) == 0 {
+		return fmt.Errorf("reading back generated columns: %w", ErrNoRows)
+	}
+	return ScanStruct(resp.Data[0], rv.Addr().Interface())
+}
+
+// InsertStruct inserts the struct v points to into table. Fields tagged
+// `generated`, and fields tagged `auto` or `default` that hold their zero
+// value, are left to the database; afterwards an `auto` key is set from
+// LastInsertID and the other database-populated columns are read back into
+// v, so defaults such as CURRENT_TIMESTAMP round-trip.
+func (c *Client) InsertStruct(ctx context.Context, table string, v interface{}) (*ExecResponse, error) {
+	rv, err := structPointer(v)
+	if err != nil {
+		return nil, fmt.Errorf("insert: %w", err)
+	}
+	info := getStructInfo(rv.Type())
+
+	var (
+		columns  []string
+		params   []interface{}
+		autoKey  *fieldInfo
+		readback []*fieldInfo
+	)
+	for _, f := range info.fields {
+		field := rv.FieldByIndex(f.index)
+		switch {
+		case f.generated:
+			readback = append(readback, f)
+			continue
+		case f.auto && field.IsZero():
+			autoKey = f
+			continue
+		case f.hasDefault && field.IsZero():
+			readback = append(readback, f)
+			continue
+		}
+		columns = append(columns, quoteIdentifier(f.column))
+		params = append(params, field.Interface())
+	}
+
+	sql := "INSERT INTO " + quoteIdentifier(table) + " (" + strings.Join(columns, ", ") + ") VALUES (" +
+		strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+	resp, err := c.Exec(ctx, sql, params...)
+	if err != nil {
+		return nil, err
+	}
+	if err := resp.failure(); err != nil {
+		return resp, err
+	}
+
+	if autoKey != nil {
+		if err := assign(rv.FieldByIndex(autoKey.index), resp.LastInsertID); err != nil {
+			return resp, fmt.Errorf("insert: setting %s: %w", autoKey.column, err)
+		}
+	}
+	if len(readback) > 0 {
+		if err := c.readBack(ctx, table, rv, info, readback); err != nil {
+			return resp, fmt.Errorf("insert: %w", err)
+		}
+	}
+	return resp, nil
+}
+
+// GetByPK loads the row of table with the given primary key into the struct
+// dest points to. With no pk values, the key is taken from dest. It returns
+// ErrNoRows when no row matches.
+func (c *Client) GetByPK(ctx context.Context, table string, dest interface{}, pk ...interface{}) error {
+	rv, err := structPointer(dest)
+	if err != nil {
+		return fmt.Errorf("get: %w", err)
+	}
+	info := getStructInfo(rv.Type())
+
+	where, params, err := info.pkCondition(rv, pk)
+	if err != nil {
+		return fmt.Errorf("get: %w", err)
+	}
+
+	columns := make([]string, len(info.fields))
+	for i, f := range info.fields {
+		columns[i] = quoteIdentifier(f.column)
+	}
+	sql := "SELECT " + strings.Join(columns, ", ") + " FROM " + quoteIdentifier(table) + " WHERE " + where + " LIMIT 1"
+
+	resp, err := c.Query(ctx, sql, params...)
+	if err != nil {
+		return err
+	}
+	if err := resp.failure(); err != nil {
+		return err
+	}
+	if len(resp.Data) == 0 {
+		return ErrNoRows
+	}
+	return ScanStruct(resp.Data[0], dest)
+}
+
+// UpdateStruct writes every column of the struct v points to, except the
+// primary key and generated columns, to the row with v's primary key.
+// Generated columns are read back afterwards.
+func (c *Client) UpdateStruct(ctx context.Context, table string, v interface{}) (*ExecResponse, error) {
+	rv, err := structPointer(v)
+	if err != nil {
+		return nil, fmt.Errorf("update: %w", err)
+	}
+	info := getStructInfo(rv.Type())
+
+	where, pkParams, err := info.pkCondition(rv, nil)
+	if err != nil {
+		return nil, fmt.Errorf("update: %w", err)
+	}
+
+	var (
+		assignments []string
+		params      []interface{}
+		readback    []*fieldInfo
+	)
+	for _, f := range info.fields {
+		switch {
+		case f.generated:
+			readback = append(readback, f)
+			continue
+		case f.pk:
+			continue
+		}
+		assignments = append(assignments, quoteIdentifier(f.column)+" = ?")
+		params = append(params, rv.FieldByIndex(f.index).Interface())
+	}
+	if len(assignments) == 0 {
+		return nil, fmt.Errorf("update: %s has no updatable columns", rv.Type())
+	}
+
+	sql := "UPDATE " + quoteIdentifier(table) + " SET " + strings.Join(assignments, ", ") + " WHERE " + where
+	resp, err := c.Exec(ctx, sql, append(params, pkParams...)...)
+	if err != nil {
+		return nil, err
+	}
+	if err := resp.failure(); err != nil {
+		return resp, err
+	}
+
+	if len(readback) > 0 {
+		if err := c.readBack(ctx, table, rv, info, readback); err != nil {
+			return resp, fmt.Errorf("update: %w", err)
+		}
+	}
+	return resp, nil
+}
+
+// DeleteByPK deletes the row of table with the given primary key. model is
+// the struct (or a pointer to it) describing the table; with no pk values,
+// the key is taken from model.
+func (c *Client) DeleteByPK(ctx context.Context, table string, model interface{}, pk ...interface{}) (*ExecResponse, error) {
+	rv := reflect.Indirect(reflect.ValueOf(model))
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("delete: expected a struct, got %T", model)
+	}
+	info := getStructInfo(rv.Type())
+
+	where, params, err := info.pkCondition(rv, pk)
+	if err != nil {
+		return nil, fmt.Errorf("delete: %w", err)
+	}
+
+	resp, err := c.Exec(ctx, "DELETE FROM "+quoteIdentifier(table)+" WHERE "+where, params...)
+	if err != nil {
+		return nil, err
+	}
+	return resp, resp.failure()
+}
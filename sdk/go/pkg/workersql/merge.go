@@ -0,0 +1,410 @@
+package workersql
+
+import (
+	"bytes"
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AggregateFunc is an aggregate that can be recombined from per-shard
+// partial results
+type AggregateFunc string
+
+// Re-aggregatable functions. AVG is not among them: rewrite it as SUM and
+// COUNT columns and divide after merging.
+const (
+	AggregateSum   AggregateFunc = "SUM"
+	AggregateCount AggregateFunc = "COUNT"
+	AggregateMin   AggregateFunc = "MIN"
+	AggregateMax   AggregateFunc = "MAX"
+)
+
+// SortKey is one ORDER BY column of merged results
+type SortKey struct {
+	Column     string
+	Descending bool
+}
+
+// Aggregate re-aggregates a result column of a grouped query
+type Aggregate struct {
+	// Column is the result column, i.e. the aggregate's alias
+	Column string
+	Func   AggregateFunc
+}
+
+// MergeOptions describes how per-shard results of the same query combine
+// into one result
+type MergeOptions struct {
+	// OrderBy orders the merged rows. Without GroupBy every shard's rows
+	// must already be in this order, as they are when the query has the
+	// same ORDER BY; they are then merged without a full sort.
+	OrderBy []SortKey
+	// GroupBy lists the grouping columns of a grouped query. Rows with
+	// equal values are combined into one, re-aggregating Aggregates; other
+	// columns keep the first shard's value.
+	GroupBy    []string
+	Aggregates []Aggregate
+	// Distinct drops duplicate rows, such as those of tables replicated to
+	// every shard
+	Distinct bool
+	// Limit and Offset trim the merged rows. Zero Limit means no limit.
+	Limit  int
+	Offset int
+}
+
+// MergeResults combines per-shard results of one query into a single
+// result according to opts. It fails if any result is unsuccessful.
+func MergeResults(results []*QueryResponse, opts MergeOptions) (*QueryResponse, error) {
+	merged := &QueryResponse{Success: true, Cached: len(results) > 0}
+	for i, r := range results {
+		if err := r.failure(); err != nil {
+			return nil, fmt.Errorf("merge results: result %d: %w", i, err)
+		}
+		if merged.Columns == nil {
+			merged.Columns = r.Columns
+		}
+		if r.ExecutionTime > merged.ExecutionTime {
+			merged.ExecutionTime = r.ExecutionTime
+		}
+		merged.Cached = merged.Cached && r.Cached
+	}
+
+	var rows []map[string]interface{}
+	var err error
+	switch {
+	case len(opts.GroupBy) > 0:
+		if rows, err = regroup(results, opts.GroupBy, opts.Aggregates); err != nil {
+			return nil, err
+		}
+		sortRows(rows, opts.OrderBy)
+	case len(opts.OrderBy) > 0:
+		rows = mergeSorted(results, opts.OrderBy)
+	default:
+		for _, r := range results {
+			rows = append(rows, r.Data...)
+		}
+	}
+
+	if opts.Distinct {
+		rows = distinctRows(rows)
+	}
+	rows = trimRows(rows, opts.Offset, opts.Limit)
+
+	merged.Data = rows
+	merged.RowCount = len(rows)
+	return merged, nil
+}
+
+var trailingLimit = regexp.MustCompile(`(?is)\s+LIMIT\s+(\d+)(?:\s*(?:,|\s+OFFSET\s+)\s*(\d+))?\s*;?\s*$`)
+
+// PushDownLimit rewrites sql for running on each shard of a merge with
+// opts: a shard must return Offset+Limit rows for the merged page to be
+// complete, so a trailing LIMIT clause is replaced by, or sql is extended
+// with, LIMIT Offset+Limit. Grouped merges need every group and are
+// returned unchanged, as are merges without a limit.
+func PushDownLimit(sql string, opts MergeOptions) string {
+	if opts.Limit <= 0 || len(opts.GroupBy) > 0 || opts.Distinct {
+		return sql
+	}
+	limit := " LIMIT " + strconv.Itoa(opts.Offset+opts.Limit)
+	if loc := trailingLimit.FindStringIndex(sql); loc != nil {
+		return sql[:loc[0]] + limit
+	}
+	return strings.TrimRight(strings.TrimSpace(sql), ";") + limit
+}
+
+// mergeHeap orders the heads of per-shard row lists
+type mergeHeap struct {
+	keys  []SortKey
+	lists [][]map[string]interface{}
+	pos   []int
+	items []int
+}
+
+func (h *mergeHeap) Len() int { return len(h.items) }
+func (h *mergeHeap) Less(i, j int) bool {
+	a, b := h.items[i], h.items[j]
+	if c := compareRows(h.lists[a][h.pos[a]], h.lists[b][h.pos[b]], h.keys); c != 0 {
+		return c < 0
+	}
+	// Keep shard order for equal rows, making the merge stable
+	return a < b
+}
+func (h *mergeHeap) Swap(i, j int)      { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *mergeHeap) Push(x interface{}) { h.items = append(h.items, x.(int)) }
+func (h *mergeHeap) Pop() interface{} {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
+
+// mergeSorted k-way merges row lists each already sorted by keys
+func mergeSorted(results []*QueryResponse, keys []SortKey) []map[string]interface{} {
+	h := &mergeHeap{keys: keys, pos: make([]int, len(results))}
+	total := 0
+	for i, r := range results {
+		h.lists = append(h.lists, r.Data)
+		if len(r.Data) > 0 {
+			h.items = append(h.items, i)
+		}
+		total += len(r.Data)
+	}
+	heap.Init(h)
+
+	rows := make([]map[string]interface{}, 0, total)
+	for h.Len() > 0 {
+		i := h.items[0]
+		rows = append(rows, h.lists[i][h.pos[i]])
+		h.pos[i]++
+		if h.pos[i] == len(h.lists[i]) {
+			heap.Pop(h)
+		} else {
+			heap.Fix(h, 0)
+		}
+	}
+	return rows
+}
+
+func sortRows(rows []map[string]interface{}, keys []SortKey) {
+	if len(keys) == 0 {
+		return
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return compareRows(rows[i], rows[j], keys) < 0 })
+}
+
+func compareRows(a, b map[string]interface{}, keys []SortKey) int {
+	for _, k := range keys {
+		c := compareValues(a[k.Column], b[k.Column])
+		if k.Descending {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// compareValues orders row values the way MySQL does for common types,
+// with NULL first
+func compareValues(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	if x, ok := numericRat(a); ok {
+		if y, ok := numericRat(b); ok {
+			return x.Cmp(y)
+		}
+	}
+	switch x := a.(type) {
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y)
+		}
+	case time.Time:
+		if y, ok := b.(time.Time); ok {
+			return x.Compare(y)
+		}
+	case []byte:
+		if y, ok := b.([]byte); ok {
+			return bytes.Compare(x, y)
+		}
+	case bool:
+		if y, ok := b.(bool); ok {
+			switch {
+			case x == y:
+				return 0
+			case !x:
+				return -1
+			}
+			return 1
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// numericRat returns the exact value of a numeric row value
+func numericRat(v interface{}) (*big.Rat, bool) {
+	switch v.(type) {
+	case json.Number, int64, uint64, float64, int:
+	default:
+		return nil, false
+	}
+	if i, ok := v.(int); ok {
+		v = int64(i)
+	}
+	text, err := numberText(v)
+	if err != nil {
+		return nil, false
+	}
+	r, ok := new(big.Rat).SetString(text)
+	return r, ok
+}
+
+// regroup combines the rows of grouped per-shard results by the groupBy
+// columns
+func regroup(results []*QueryResponse, groupBy []string, aggregates []Aggregate) ([]map[string]interface{}, error) {
+	for _, agg := range aggregates {
+		switch agg.Func {
+		case AggregateSum, AggregateCount, AggregateMin, AggregateMax:
+		default:
+			return nil, fmt.Errorf("merge results: cannot re-aggregate %s(%s)", agg.Func, agg.Column)
+		}
+	}
+
+	groups := make(map[string]map[string]interface{})
+	var order []string
+	for _, r := range results {
+		for _, row := range r.Data {
+			key := rowIdentity(row, groupBy)
+			group, ok := groups[key]
+			if !ok {
+				group = make(map[string]interface{}, len(row))
+				for k, v := range row {
+					group[k] = v
+				}
+				groups[key] = group
+				order = append(order, key)
+				continue
+			}
+			for _, agg := range aggregates {
+				v, err := combine(agg.Func, group[agg.Column], row[agg.Column])
+				if err != nil {
+					return nil, fmt.Errorf("merge results: column %s: %w", agg.Column, err)
+				}
+				group[agg.Column] = v
+			}
+		}
+	}
+
+	rows := make([]map[string]interface{}, len(order))
+	for i, key := range order {
+		rows[i] = groups[key]
+	}
+	return rows, nil
+}
+
+// combine merges two partial aggregates. NULL partials, from shards without
+// matching rows, are ignored.
+func combine(fn AggregateFunc, a, b interface{}) (interface{}, error) {
+	if a == nil {
+		return b, nil
+	}
+	if b == nil {
+		return a, nil
+	}
+	switch fn {
+	case AggregateMin:
+		if compareValues(b, a) < 0 {
+			return b, nil
+		}
+		return a, nil
+	case AggregateMax:
+		if compareValues(b, a) > 0 {
+			return b, nil
+		}
+		return a, nil
+	}
+
+	x, ok := numericRat(a)
+	y, ok2 := numericRat(b)
+	if !ok || !ok2 {
+		return nil, fmt.Errorf("cannot add non-numeric values %T and %T", a, b)
+	}
+	sum := new(big.Rat).Add(x, y)
+	switch {
+	case isJSONNumber(a) || isJSONNumber(b):
+		return json.Number(ratText(sum, a, b)), nil
+	case sum.IsInt() && sum.Num().IsInt64() && isInteger(a) && isInteger(b):
+		return sum.Num().Int64(), nil
+	}
+	f, _ := sum.Float64()
+	return f, nil
+}
+
+func isJSONNumber(v interface{}) bool {
+	_, ok := v.(json.Number)
+	return ok
+}
+
+func isInteger(v interface{}) bool {
+	switch v.(type) {
+	case int64, uint64, int:
+		return true
+	}
+	return false
+}
+
+// ratText formats r with as many decimals as the more precise operand
+func ratText(r *big.Rat, operands ...interface{}) string {
+	scale := 0
+	for _, v := range operands {
+		text, _ := numberText(v)
+		if i := strings.IndexByte(text, '.'); i >= 0 && len(text)-i-1 > scale {
+			scale = len(text) - i - 1
+		}
+	}
+	return r.FloatString(scale)
+}
+
+// rowIdentity encodes the values of columns, or of the whole row when
+// columns is empty, as a comparable key
+func rowIdentity(row map[string]interface{}, columns []string) string {
+	if len(columns) == 0 {
+		columns = make([]string, 0, len(row))
+		for k := range row {
+			columns = append(columns, k)
+		}
+		sort.Strings(columns)
+	}
+	var b strings.Builder
+	for _, c := range columns {
+		v := row[c]
+		if r, ok := numericRat(v); ok {
+			// int64 1, float64 1 and json.Number "1.0" are the same value
+			fmt.Fprintf(&b, "%q=#%s;", c, r.RatString())
+			continue
+		}
+		fmt.Fprintf(&b, "%q=%T:%v;", c, v, v)
+	}
+	return b.String()
+}
+
+func distinctRows(rows []map[string]interface{}) []map[string]interface{} {
+	seen := make(map[string]bool, len(rows))
+	kept := rows[:0]
+	for _, row := range rows {
+		key := rowIdentity(row, nil)
+		if !seen[key] {
+			seen[key] = true
+			kept = append(kept, row)
+		}
+	}
+	return kept
+}
+
+func trimRows(rows []map[string]interface{}, offset, limit int) []map[string]interface{} {
+	if offset > 0 {
+		if offset >= len(rows) {
+			return []map[string]interface{}{}
+		}
+		rows = rows[offset:]
+	}
+	if limit > 0 && limit < len(rows) {
+		rows = rows[:limit]
+	}
+	return rows
+}
@@ -0,0 +1,298 @@
+package workersql
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Notebook is a sequence of named, parameterized statements kept as data,
+// such as an ops runbook or a report definition, and run by RunNotebook.
+// It is read from YAML or JSON:
+//
+//	name: tenant-usage
+//	variables:
+//	  since: "2024-01-01"
+//	steps:
+//	  - name: tenants
+//	    sql: SELECT id FROM tenants WHERE created_at >= ?
+//	    params: ["${since}"]
+//	    capture_all: {tenant_ids: id}
+//	  - name: orders
+//	    sql: SELECT tenant_id, COUNT(*) AS n FROM orders WHERE tenant_id IN (?) GROUP BY tenant_id
+//	    params: ["${tenant_ids}"]
+//
+// A param that is exactly "${name}" is replaced by the value of the
+// variable, keeping its type, so a list captured by CaptureAll expands into
+// an IN list; "${name}" inside a longer string is replaced by the value's
+// text. Variables are never substituted into SQL itself.
+type Notebook struct {
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	// Variables are the inputs of the notebook with their default values,
+	// overridden by the variables passed to RunNotebook. Declare an input
+	// without a default as null.
+	Variables map[string]interface{} `yaml:"variables,omitempty" json:"variables,omitempty"`
+	Steps     []NotebookStep         `yaml:"steps" json:"steps"`
+}
+
+// NotebookStep is a statement of a Notebook
+type NotebookStep struct {
+	// Name identifies the step in the results; it must be unique
+	Name   string        `yaml:"name" json:"name"`
+	SQL    string        `yaml:"sql" json:"sql"`
+	Params []interface{} `yaml:"params,omitempty" json:"params,omitempty"`
+	// Capture sets variables to columns of the first row of the result,
+	// variable name to column name. A result without rows fails the step.
+	Capture map[string]string `yaml:"capture,omitempty" json:"capture,omitempty"`
+	// CaptureAll sets variables to the list of a column's values in every
+	// row, variable name to column name
+	CaptureAll map[string]string `yaml:"capture_all,omitempty" json:"capture_all,omitempty"`
+	// ContinueOnError runs the following steps when this one fails. Its
+	// captures are left unset.
+	ContinueOnError bool `yaml:"continue_on_error,omitempty" json:"continue_on_error,omitempty"`
+}
+
+// NotebookResult holds the results of a notebook run
+type NotebookResult struct {
+	Notebook string `json:"notebook"`
+	// Variables holds the variables at the end of the run, inputs and
+	// captures
+	Variables map[string]interface{} `json:"variables"`
+	Steps     []NotebookStepResult   `json:"steps"`
+	Duration  time.Duration          `json:"duration"`
+}
+
+// NotebookStepResult is the result of a step of a notebook run
+type NotebookStepResult struct {
+	Name string `json:"name"`
+	// Params are the params sent, variables substituted
+	Params       []interface{}            `json:"params,omitempty"`
+	Columns      []string                 `json:"columns,omitempty"`
+	Rows         []map[string]interface{} `json:"rows,omitempty"`
+	AffectedRows int64                    `json:"affectedRows,omitempty"`
+	LastInsertID int64                    `json:"lastInsertId,omitempty"`
+	Duration     time.Duration            `json:"duration"`
+	// Error describes why the step failed
+	Error string `json:"error,omitempty"`
+}
+
+// Step returns the result of the step named name, or nil if it didn't run
+func (r *NotebookResult) Step(name string) *NotebookStepResult {
+	for i := range r.Steps {
+		if r.Steps[i].Name == name {
+			return &r.Steps[i]
+		}
+	}
+	return nil
+}
+
+// notebookVariable matches a variable reference in a param
+var notebookVariable = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// ParseNotebook parses a notebook from YAML or JSON and validates it
+func ParseNotebook(data []byte) (*Notebook, error) {
+	var notebook Notebook
+	if err := yaml.Unmarshal(data, &notebook); err != nil {
+		return nil, fmt.Errorf("notebook: %w", err)
+	}
+	if err := notebook.Validate(); err != nil {
+		return nil, err
+	}
+	return &notebook, nil
+}
+
+// LoadNotebook reads and parses the notebook file at path
+func LoadNotebook(path string) (*Notebook, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("notebook: %w", err)
+	}
+	return ParseNotebook(data)
+}
+
+// Validate checks that steps have unique names and SQL, and that params
+// only reference variables declared by the notebook or captured by an
+// earlier step
+func (n *Notebook) Validate() error {
+	return n.validate(nil)
+}
+
+// validate checks the notebook, the variables of inputs counting as
+// declared
+func (n *Notebook) validate(inputs map[string]interface{}) error {
+	if len(n.Steps) == 0 {
+		return fmt.Errorf("notebook %s: no steps", n.Name)
+	}
+	known := make(map[string]bool, len(n.Variables)+len(inputs))
+	for name := range n.Variables {
+		known[name] = true
+	}
+	for name := range inputs {
+		known[name] = true
+	}
+	names := make(map[string]bool, len(n.Steps))
+	for i, step := range n.Steps {
+		if step.Name == "" {
+			return fmt.Errorf("notebook %s: step %d has no name", n.Name, i+1)
+		}
+		if names[step.Name] {
+			return fmt.Errorf("notebook %s: duplicate step %s", n.Name, step.Name)
+		}
+		names[step.Name] = true
+		if strings.TrimSpace(step.SQL) == "" {
+			return fmt.Errorf("notebook %s: step %s has no sql", n.Name, step.Name)
+		}
+		for _, param := range step.Params {
+			s, ok := param.(string)
+			if !ok {
+				continue
+			}
+			for _, ref := range notebookVariable.FindAllStringSubmatch(s, -1) {
+				if !known[ref[1]] {
+					return fmt.Errorf("notebook %s: step %s references undefined variable %s", n.Name, step.Name, ref[1])
+				}
+			}
+		}
+		for name := range step.Capture {
+			known[name] = true
+		}
+		for name := range step.CaptureAll {
+			known[name] = true
+		}
+	}
+	return nil
+}
+
+// RunNotebook runs the steps of notebook in order with vars overriding its
+// variables, and returns the results of the steps run. It stops at the
+// first failed step without ContinueOnError, returning the results so far
+// with the error. Each step is a separate call; run the notebook with
+// TransactionClient.RunNotebook if its writes must be atomic.
+func (c *Client) RunNotebook(ctx context.Context, notebook *Notebook, vars map[string]interface{}) (*NotebookResult, error) {
+	return runNotebook(ctx, c, notebook, vars)
+}
+
+// RunNotebook runs notebook within the transaction, see Client.RunNotebook
+func (tx *TransactionClient) RunNotebook(ctx context.Context, notebook *Notebook, vars map[string]interface{}) (*NotebookResult, error) {
+	return runNotebook(ctx, tx, notebook, vars)
+}
+
+func runNotebook(ctx context.Context, q Querier, notebook *Notebook, vars map[string]interface{}) (*NotebookResult, error) {
+	if err := notebook.validate(vars); err != nil {
+		return nil, err
+	}
+	result := &NotebookResult{
+		Notebook:  notebook.Name,
+		Variables: make(map[string]interface{}, len(notebook.Variables)+len(vars)),
+	}
+	for name, value := range notebook.Variables {
+		result.Variables[name] = value
+	}
+	for name, value := range vars {
+		result.Variables[name] = value
+	}
+
+	start := time.Now()
+	defer func() { result.Duration = time.Since(start) }()
+	for _, step := range notebook.Steps {
+		stepResult, err := runNotebookStep(ctx, q, step, result.Variables)
+		result.Steps = append(result.Steps, stepResult)
+		if err == nil {
+			continue
+		}
+		if ctx.Err() != nil || !step.ContinueOnError {
+			return result, fmt.Errorf("notebook %s: step %s: %w", notebook.Name, step.Name, err)
+		}
+	}
+	return result, nil
+}
+
+func runNotebookStep(ctx context.Context, q Querier, step NotebookStep, vars map[string]interface{}) (result NotebookStepResult, err error) {
+	result.Name = step.Name
+	start := time.Now()
+	defer func() {
+		result.Duration = time.Since(start)
+		if err != nil {
+			result.Error = err.Error()
+		}
+	}()
+
+	result.Params = make([]interface{}, len(step.Params))
+	for i, param := range step.Params {
+		result.Params[i], err = substituteVariables(param, vars)
+		if err != nil {
+			return result, err
+		}
+	}
+	response, err := q.Query(ctx, step.SQL, result.Params...)
+	if err != nil {
+		return result, err
+	}
+	if err := response.failure(); err != nil {
+		return result, err
+	}
+	for _, column := range response.Columns {
+		result.Columns = append(result.Columns, column.Name)
+	}
+	result.Rows = response.Data
+	result.AffectedRows = response.AffectedRows
+	result.LastInsertID = response.LastInsertID
+
+	for name, column := range step.Capture {
+		if len(response.Data) == 0 {
+			return result, fmt.Errorf("capture %s: no rows", name)
+		}
+		value, ok := response.Data[0][column]
+		if !ok {
+			return result, fmt.Errorf("capture %s: no column %s", name, column)
+		}
+		vars[name] = value
+	}
+	for name, column := range step.CaptureAll {
+		values := make([]interface{}, 0, len(response.Data))
+		for _, row := range response.Data {
+			value, ok := row[column]
+			if !ok {
+				return result, fmt.Errorf("capture %s: no column %s", name, column)
+			}
+			values = append(values, value)
+		}
+		vars[name] = values
+	}
+	return result, nil
+}
+
+// substituteVariables replaces the variable references of a string param
+func substituteVariables(param interface{}, vars map[string]interface{}) (interface{}, error) {
+	s, ok := param.(string)
+	if !ok {
+		return param, nil
+	}
+	if m := notebookVariable.FindStringSubmatch(s); m != nil && m[0] == s {
+		value, ok := vars[m[1]]
+		if !ok {
+			return nil, fmt.Errorf("undefined variable %s", m[1])
+		}
+		return value, nil
+	}
+	var missing string
+	out := notebookVariable.ReplaceAllStringFunc(s, func(ref string) string {
+		name := ref[2 : len(ref)-1]
+		value, ok := vars[name]
+		if !ok {
+			missing = name
+			return ref
+		}
+		return fmt.Sprint(value)
+	})
+	if missing != "" {
+		return nil, fmt.Errorf("undefined variable %s", missing)
+	}
+	return out, nil
+}
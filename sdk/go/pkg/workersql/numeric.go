@@ -0,0 +1,88 @@
+package workersql
+
+import (
+	"database/sql"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+)
+
+// ScanNumber converts a numeric row value into dest without going through
+// float64, so DECIMAL and BIGINT UNSIGNED values keep full precision when the
+// client is configured with UseNumber. Supported destinations are *big.Int,
+// *big.Float, *big.Rat, *int64, *uint64, *float64, *string, *json.Number and
+// any sql.Scanner or encoding.TextUnmarshaler, which covers decimal types
+// such as shopspring/decimal.Decimal.
+func ScanNumber(value interface{}, dest interface{}) error {
+	text, err := numberText(value)
+	if err != nil {
+		return err
+	}
+
+	switch d := dest.(type) {
+	case *big.Int:
+		if _, ok := d.SetString(text, 10); !ok {
+			return fmt.Errorf("cannot scan %q into *big.Int", text)
+		}
+	case *big.Float:
+		if _, ok := d.SetString(text); !ok {
+			return fmt.Errorf("cannot scan %q into *big.Float", text)
+		}
+	case *big.Rat:
+		if _, ok := d.SetString(text); !ok {
+			return fmt.Errorf("cannot scan %q into *big.Rat", text)
+		}
+	case *int64:
+		n, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return fmt.Errorf("cannot scan %q into *int64: %w", text, err)
+		}
+		*d = n
+	case *uint64:
+		n, err := strconv.ParseUint(text, 10, 64)
+		if err != nil {
+			return fmt.Errorf("cannot scan %q into *uint64: %w", text, err)
+		}
+		*d = n
+	case *float64:
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return fmt.Errorf("cannot scan %q into *float64: %w", text, err)
+		}
+		*d = f
+	case *string:
+		*d = text
+	case *json.Number:
+		*d = json.Number(text)
+	case sql.Scanner:
+		return d.Scan(text)
+	case encoding.TextUnmarshaler:
+		return d.UnmarshalText([]byte(text))
+	default:
+		return fmt.Errorf("unsupported ScanNumber destination %T", dest)
+	}
+	return nil
+}
+
+// numberText returns the exact textual form of a numeric row value
+func numberText(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case json.Number:
+		return v.String(), nil
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case nil:
+		return "", fmt.Errorf("cannot scan NULL into a number")
+	}
+	return "", fmt.Errorf("unsupported numeric value %T", value)
+}
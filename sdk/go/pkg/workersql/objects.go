@@ -0,0 +1,282 @@
+package workersql
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Object store defaults
+const (
+	DefaultObjectTable     = "workersql_objects"
+	DefaultObjectChunkSize = 256 << 10
+)
+
+// ErrObjectCorrupt is returned by GetObject when the stored parts don't
+// match the object's recorded size or SHA-256 digest
+var ErrObjectCorrupt = errors.New("stored object is corrupt")
+
+// ObjectStoreOptions configures Client.Objects
+type ObjectStoreOptions struct {
+	// Table is the manifest table; parts are stored in Table + "_chunks"
+	// (default: "workersql_objects")
+	Table string
+	// ChunkSize is the number of bytes stored per part row, before base64
+	// encoding (default: 256 KiB)
+	ChunkSize int
+}
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Key       string
+	Size      int64
+	Chunks    int
+	ChunkSize int
+	// SHA256 is the hex digest of the content
+	SHA256    string
+	UpdatedAt time.Time
+}
+
+// ObjectStore stores objects larger than a row or request allows by
+// splitting them into parts. A manifest row per key records the current
+// version; parts are written under a new version before the manifest is
+// switched to it, so readers never see a partially written object. Parts
+// are stored base64-encoded in a TEXT column, as requests carry JSON.
+type ObjectStore struct {
+	client    *Client
+	manifest  string
+	chunks    string
+	chunkSize int
+}
+
+// Objects returns an object store backed by the client's database
+func (c *Client) Objects(opts ObjectStoreOptions) *ObjectStore {
+	if opts.Table == "" {
+		opts.Table = DefaultObjectTable
+	}
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = DefaultObjectChunkSize
+	}
+	return &ObjectStore{
+		client:    c,
+		manifest:  quoteIdentifier(opts.Table),
+		chunks:    quoteIdentifier(opts.Table + "_chunks"),
+		chunkSize: opts.ChunkSize,
+	}
+}
+
+// EnsureSchema creates the manifest and part tables if they don't exist
+func (s *ObjectStore) EnsureSchema(ctx context.Context) error {
+	statements := []string{
+		"CREATE TABLE IF NOT EXISTS " + s.manifest + " (" +
+			"`object_key` VARCHAR(255) NOT NULL PRIMARY KEY, " +
+			"`version` CHAR(32) NOT NULL, " +
+			"`size` BIGINT NOT NULL, " +
+			"`chunks` INT NOT NULL, " +
+			"`chunk_size` INT NOT NULL, " +
+			"`sha256` CHAR(64) NOT NULL, " +
+			"`updated_at` BIGINT NOT NULL)",
+		"CREATE TABLE IF NOT EXISTS " + s.chunks + " (" +
+			"`object_key` VARCHAR(255) NOT NULL, " +
+			"`version` CHAR(32) NOT NULL, " +
+			"`seq` INT NOT NULL, " +
+			"`data` LONGTEXT NOT NULL, " +
+			"PRIMARY KEY (`object_key`, `version`, `seq`))",
+	}
+	for _, sql := range statements {
+		if err := s.exec(ctx, sql); err != nil {
+			return fmt.Errorf("creating object tables: %w", err)
+		}
+	}
+	return nil
+}
+
+// PutObject stores the content of r under key, replacing any existing
+// object once the new content is completely written
+func (s *ObjectStore) PutObject(ctx context.Context, key string, r io.Reader) (*ObjectInfo, error) {
+	previous, err := s.stat(ctx, key)
+	if err != nil && !errors.Is(err, ErrNoRows) {
+		return nil, err
+	}
+
+	version, err := newObjectVersion()
+	if err != nil {
+		return nil, err
+	}
+	info, err := s.writeChunks(ctx, key, version, r)
+	if err == nil {
+		err = s.exec(ctx, "INSERT INTO "+s.manifest+
+			" (`object_key`, `version`, `size`, `chunks`, `chunk_size`, `sha256`, `updated_at`) VALUES (?, ?, ?, ?, ?, ?, ?)"+
+			" ON DUPLICATE KEY UPDATE `version` = VALUES(`version`), `size` = VALUES(`size`), `chunks` = VALUES(`chunks`),"+
+			" `chunk_size` = VALUES(`chunk_size`), `sha256` = VALUES(`sha256`), `updated_at` = VALUES(`updated_at`)",
+			key, version, info.Size, info.Chunks, info.ChunkSize, info.SHA256, info.UpdatedAt.UnixMilli())
+	}
+	if err != nil {
+		// Best effort: the parts are unreachable without a manifest anyway
+		_ = s.deleteVersion(ctx, key, version)
+		return nil, fmt.Errorf("put object %q: %w", key, err)
+	}
+
+	if previous != nil {
+		_ = s.deleteVersion(ctx, key, previous.version)
+	}
+	return &info.ObjectInfo, nil
+}
+
+// storedObject is an ObjectInfo with the version its parts are stored under
+type storedObject struct {
+	ObjectInfo
+	version string
+}
+
+func (s *ObjectStore) writeChunks(ctx context.Context, key, version string, r io.Reader) (*storedObject, error) {
+	hash := sha256.New()
+	buf := make([]byte, s.chunkSize)
+	info := &storedObject{ObjectInfo: ObjectInfo{Key: key, ChunkSize: s.chunkSize}, version: version}
+
+	for {
+		n, readErr := io.ReadFull(r, buf)
+		if n > 0 {
+			hash.Write(buf[:n])
+			err := s.exec(ctx, "INSERT INTO "+s.chunks+" (`object_key`, `version`, `seq`, `data`) VALUES (?, ?, ?, ?)",
+				key, version, info.Chunks, base64.StdEncoding.EncodeToString(buf[:n]))
+			if err != nil {
+				return nil, fmt.Errorf("writing part %d: %w", info.Chunks, err)
+			}
+			info.Chunks++
+			info.Size += int64(n)
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return nil, fmt.Errorf("reading content: %w", readErr)
+		}
+	}
+
+	info.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	info.UpdatedAt = time.Now().UTC()
+	return info, nil
+}
+
+// GetObject writes the content stored under key to w, one part at a time.
+// It returns an error wrapping ErrNoRows if there is no such object, and
+// ErrObjectCorrupt if the content doesn't match its digest; in that case
+// corrupt data may already have been written to w.
+func (s *ObjectStore) GetObject(ctx context.Context, key string, w io.Writer) (*ObjectInfo, error) {
+	obj, err := s.stat(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.New()
+	var size int64
+	for seq := 0; seq < obj.Chunks; seq++ {
+		resp, err := s.client.Query(ctx, "SELECT `data` FROM "+s.chunks+" WHERE `object_key` = ? AND `version` = ? AND `seq` = ?",
+			key, obj.version, seq)
+		if err == nil {
+			err = resp.failure()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("get object %q: reading part %d: %w", key, seq, err)
+		}
+		if len(resp.Data) == 0 {
+			return nil, fmt.Errorf("get object %q: part %d is missing: %w", key, seq, ErrObjectCorrupt)
+		}
+		encoded, _ := resp.Data[0]["data"].(string)
+		part, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("get object %q: part %d: %v: %w", key, seq, err, ErrObjectCorrupt)
+		}
+
+		hash.Write(part)
+		size += int64(len(part))
+		if _, err := w.Write(part); err != nil {
+			return nil, fmt.Errorf("get object %q: %w", key, err)
+		}
+	}
+
+	if size != obj.Size || hex.EncodeToString(hash.Sum(nil)) != obj.SHA256 {
+		return nil, fmt.Errorf("get object %q: %w", key, ErrObjectCorrupt)
+	}
+	return &obj.ObjectInfo, nil
+}
+
+// Stat describes the object stored under key, or returns an error wrapping
+// ErrNoRows
+func (s *ObjectStore) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	obj, err := s.stat(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return &obj.ObjectInfo, nil
+}
+
+func (s *ObjectStore) stat(ctx context.Context, key string) (*storedObject, error) {
+	resp, err := s.client.Query(ctx, "SELECT `version`, `size`, `chunks`, `chunk_size`, `sha256`, `updated_at` FROM "+
+		s.manifest+" WHERE `object_key` = ?", key)
+	if err == nil {
+		err = resp.failure()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("stat object %q: %w", key, err)
+	}
+	if len(resp.Data) == 0 {
+		return nil, fmt.Errorf("object %q: %w", key, ErrNoRows)
+	}
+
+	row := resp.Data[0]
+	obj := &storedObject{ObjectInfo: ObjectInfo{Key: key}}
+	var updated int64
+	for _, field := range []struct {
+		column string
+		dest   interface{}
+	}{
+		{"version", &obj.version}, {"size", &obj.Size}, {"chunks", &obj.Chunks},
+		{"chunk_size", &obj.ChunkSize}, {"sha256", &obj.SHA256}, {"updated_at", &updated},
+	} {
+		if err := ScanValue(row[field.column], field.dest); err != nil {
+			return nil, fmt.Errorf("stat object %q: column %s: %w", key, field.column, err)
+		}
+	}
+	obj.UpdatedAt = time.UnixMilli(updated).UTC()
+	return obj, nil
+}
+
+// DeleteObject removes the object stored under key and all of its parts.
+// Deleting a missing object is not an error.
+func (s *ObjectStore) DeleteObject(ctx context.Context, key string) error {
+	if err := s.exec(ctx, "DELETE FROM "+s.manifest+" WHERE `object_key` = ?", key); err != nil {
+		return fmt.Errorf("delete object %q: %w", key, err)
+	}
+	if err := s.exec(ctx, "DELETE FROM "+s.chunks+" WHERE `object_key` = ?", key); err != nil {
+		return fmt.Errorf("delete object %q: %w", key, err)
+	}
+	return nil
+}
+
+func (s *ObjectStore) deleteVersion(ctx context.Context, key, version string) error {
+	return s.exec(ctx, "DELETE FROM "+s.chunks+" WHERE `object_key` = ? AND `version` = ?", key, version)
+}
+
+func (s *ObjectStore) exec(ctx context.Context, sql string, params ...interface{}) error {
+	resp, err := s.client.Exec(ctx, sql, params...)
+	if err != nil {
+		return err
+	}
+	return resp.failure()
+}
+
+func newObjectVersion() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("generating object version: %w", err)
+	}
+	return hex.EncodeToString(b[:]), nil
+}
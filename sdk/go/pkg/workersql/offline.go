@@ -0,0 +1,195 @@
+package workersql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OfflineConfig configures Config.OfflineFallback
+type OfflineConfig struct {
+	// DB is the embedded database queries run against while the gateway
+	// is unreachable, typically SQLite opened with the driver of the
+	// application's choice, e.g. sql.Open("sqlite", "dev.db")
+	DB *sql.DB
+	// Schema lists statements creating the gateway database's tables in
+	// DB, run in order before its first use, and again before the next one
+	// when they fail; write them so they can run again, e.g. with CREATE
+	// TABLE IF NOT EXISTS
+	Schema []string
+	// AllowWrites runs writes offline too. They stay in DB and aren't sent
+	// to the gateway later. Without it, writes fail as they would without
+	// a fallback.
+	AllowWrites bool
+	// OnOffline, if set, is called with the error that made the client
+	// fall back, once per outage
+	OnOffline func(err error)
+	// OnOnline, if set, is called when the gateway answers again after an
+	// outage
+	OnOnline func()
+}
+
+// offlineFallback runs the statements of an unreachable gateway against
+// the embedded database
+type offlineFallback struct {
+	config  OfflineConfig
+	decoder *rowDecoder
+
+	// schemaMu guards schemaLoaded, set once the schema ran successfully
+	schemaMu     sync.Mutex
+	schemaLoaded bool
+	// offline is set from falling back until the gateway answers again
+	offline int32
+}
+
+func newOfflineFallback(config *OfflineConfig, decoder *rowDecoder) *offlineFallback {
+	if config == nil || config.DB == nil {
+		return nil
+	}
+	return &offlineFallback{config: *config, decoder: decoder}
+}
+
+// gatewayUnreachable reports whether err means the request never got an
+// HTTP response, as opposed to the gateway answering with an error or the
+// caller giving up
+func gatewayUnreachable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, ErrClientClosed) {
+		return false
+	}
+	var status *statusError
+	if errors.As(err, &status) {
+		return false
+	}
+	var urlErr *url.Error
+	var netErr net.Error
+	return errors.As(err, &urlErr) || errors.As(err, &netErr)
+}
+
+// fallback runs the statement of request offline when err says the
+// gateway is unreachable. It reports false when the statement isn't run,
+// leaving err to the caller.
+func (f *offlineFallback) fallback(ctx context.Context, op string, request map[string]interface{}, err error) (*QueryResponse, bool) {
+	if f == nil || !gatewayUnreachable(err) {
+		return nil, false
+	}
+	sqlText, _ := request["sql"].(string)
+	params, _ := request["params"].([]interface{})
+	read := op == "Query" && isReadStatement(sqlText)
+	if !read && !f.config.AllowWrites {
+		return nil, false
+	}
+	if atomic.CompareAndSwapInt32(&f.offline, 0, 1) && f.config.OnOffline != nil {
+		f.config.OnOffline(err)
+	}
+	// The caller's context may have expired waiting for the gateway
+	ctx = context.WithoutCancel(ctx)
+
+	start := time.Now()
+	var response *QueryResponse
+	var runErr error
+	switch schemaErr := f.loadSchema(ctx); {
+	case schemaErr != nil:
+		runErr = schemaErr
+	case read:
+		response, runErr = f.query(ctx, sqlText, params)
+	default:
+		response, runErr = f.exec(ctx, sqlText, params)
+	}
+	if runErr != nil {
+		// Like the gateway, a failing statement is an unsuccessful response
+		response = &QueryResponse{
+			Success: false,
+			Error:   &ErrorResponse{Code: "OFFLINE_ERROR", Message: runErr.Error()},
+		}
+	}
+	response.Offline = true
+	response.ExecutionTime = float64(time.Since(start).Microseconds()) / 1000
+	return response, true
+}
+
+// loadSchema runs the schema statements before the first statement run
+// offline. A failing schema is run again on the next one, so an error such
+// as a locked database file doesn't keep the fallback down.
+func (f *offlineFallback) loadSchema(ctx context.Context) error {
+	f.schemaMu.Lock()
+	defer f.schemaMu.Unlock()
+	if f.schemaLoaded {
+		return nil
+	}
+	for _, stmt := range f.config.Schema {
+		if _, err := f.config.DB.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("offline schema: %w", err)
+		}
+	}
+	f.schemaLoaded = true
+	return nil
+}
+
+// online notes that the gateway answered
+func (f *offlineFallback) online() {
+	if f != nil && atomic.CompareAndSwapInt32(&f.offline, 1, 0) && f.config.OnOnline != nil {
+		f.config.OnOnline()
+	}
+}
+
+func (f *offlineFallback) query(ctx context.Context, sqlText string, params []interface{}) (*QueryResponse, error) {
+	rows, err := f.config.DB.QueryContext(ctx, sqlText, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	columns := make([]ColumnMeta, len(types))
+	for i, t := range types {
+		nullable, _ := t.Nullable()
+		columns[i] = ColumnMeta{Name: t.Name(), DatabaseType: t.DatabaseTypeName(), Nullable: nullable}
+	}
+
+	data := []map[string]interface{}{}
+	values := make([]interface{}, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{}, len(columns))
+		for i, col := range columns {
+			v := values[i]
+			// Text comes back as bytes from some drivers
+			if b, ok := v.([]byte); ok && !strings.Contains(strings.ToUpper(col.DatabaseType), "BLOB") {
+				v = string(b)
+			}
+			row[col.Name] = v
+		}
+		data = append(data, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	f.decoder.decodeRows(columns, data)
+	return &QueryResponse{Success: true, Data: data, Columns: columns, RowCount: len(data)}, nil
+}
+
+func (f *offlineFallback) exec(ctx context.Context, sqlText string, params []interface{}) (*QueryResponse, error) {
+	result, err := f.config.DB.ExecContext(ctx, sqlText, params...)
+	if err != nil {
+		return nil, err
+	}
+	affected, _ := result.RowsAffected()
+	lastID, _ := result.LastInsertId()
+	return &QueryResponse{Success: true, AffectedRows: affected, LastInsertID: lastID}, nil
+}
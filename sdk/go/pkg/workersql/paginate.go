@@ -0,0 +1,192 @@
+package workersql
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DefaultPageSize is the number of rows per page when PageOptions.Size is unset
+const DefaultPageSize = 100
+
+// ErrInvalidCursor is returned for a cursor token that is malformed or was
+// issued for a different ordering
+var ErrInvalidCursor = errors.New("invalid page cursor")
+
+// ErrNoMorePages is returned by Paginator.Next after the last page
+var ErrNoMorePages = errors.New("no more pages")
+
+// PageOptions configures a Paginator
+type PageOptions struct {
+	// Size is the number of rows per page (default: 100)
+	Size int
+	// OrderBy are the columns of a unique, sortable key that pages are
+	// ordered and split by, such as a composite primary key (default: "id")
+	OrderBy []string
+	// Descending pages through the key in descending order
+	Descending bool
+	// Params are bound to the placeholders in the paginated query
+	Params []interface{}
+	// Cursor resumes after the page a previous Page.Cursor was returned with
+	Cursor string
+}
+
+// Page is one page of a paginated query
+type Page struct {
+	*QueryResponse
+	// Cursor is an opaque token for the following page, suitable for a URL
+	// query string. It is empty on the last page.
+	Cursor string
+}
+
+// Paginator fetches successive pages of a query with keyset pagination
+type Paginator struct {
+	client  *Client
+	sql     string
+	opts    PageOptions
+	lastKey []interface{}
+	done    bool
+	err     error
+}
+
+// pageCursor is the decoded form of a cursor token
+type pageCursor struct {
+	Order string        `json:"o"`
+	Key   []interface{} `json:"k"`
+}
+
+// Paginate returns a Paginator over the rows of sql, a SELECT statement
+// without ORDER BY or LIMIT. Each page is fetched with a keyset condition on
+// the OrderBy columns, so deep pages cost the same as the first one and rows
+// inserted between requests do not shift page boundaries.
+//
+//	p := client.Paginate("SELECT id, email FROM users WHERE active = ?", workersql.PageOptions{
+//		Size:   50,
+//		Params: []interface{}{true},
+//		Cursor: r.URL.Query().Get("cursor"),
+//	})
+//	page, err := p.Next(ctx)
+//	// respond with page.Data and page.Cursor
+func (c *Client) Paginate(sql string, opts PageOptions) *Paginator {
+	opts = opts.withDefaults()
+	p := &Paginator{client: c, sql: sql, opts: opts}
+	if opts.Cursor != "" {
+		p.lastKey, p.err = p.decodeCursor(opts.Cursor)
+	}
+	return p
+}
+
+func (o PageOptions) withDefaults() PageOptions {
+	if o.Size <= 0 {
+		o.Size = DefaultPageSize
+	}
+	if len(o.OrderBy) == 0 {
+		o.OrderBy = []string{"id"}
+	}
+	return o
+}
+
+// More reports whether Next may return another page
+func (p *Paginator) More() bool {
+	return !p.done
+}
+
+// Next fetches the next page. It returns ErrNoMorePages once the last page
+// has been returned.
+func (p *Paginator) Next(ctx context.Context) (*Page, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	if p.done {
+		return nil, ErrNoMorePages
+	}
+
+	sql, params := keysetPageQuery(p.sql, p.opts, p.lastKey)
+	resp, err := p.client.Query(ctx, sql, params...)
+	if err != nil {
+		return nil, fmt.Errorf("paginate: %w", err)
+	}
+	if err := resp.failure(); err != nil {
+		return nil, fmt.Errorf("paginate: %w", err)
+	}
+
+	// One extra row is fetched to learn whether another page follows
+	page := &Page{QueryResponse: resp}
+	if len(resp.Data) <= p.opts.Size {
+		p.done = true
+		return page, nil
+	}
+	resp.Data = resp.Data[:p.opts.Size]
+	resp.RowCount = len(resp.Data)
+
+	key, ok := rowKey(resp.Data[len(resp.Data)-1], p.opts.OrderBy)
+	if !ok {
+		return nil, fmt.Errorf("paginate: order columns %v missing from results", p.opts.OrderBy)
+	}
+	if page.Cursor, err = p.encodeCursor(key); err != nil {
+		return nil, fmt.Errorf("paginate: %w", err)
+	}
+	p.lastKey = key
+	return page, nil
+}
+
+// keysetPageQuery builds the query for the page of sql after lastKey,
+// fetching one extra row to learn whether another page follows
+func keysetPageQuery(sql string, opts PageOptions, lastKey []interface{}) (string, []interface{}) {
+	var sb strings.Builder
+	sb.WriteString("SELECT * FROM (")
+	sb.WriteString(strings.TrimRight(strings.TrimSpace(sql), ";"))
+	sb.WriteString(") AS page_source")
+	params := append([]interface{}(nil), opts.Params...)
+
+	if lastKey != nil {
+		cond, keyParams := keysetAfter(opts.OrderBy, lastKey, opts.Descending)
+		sb.WriteString(" WHERE " + cond)
+		params = append(params, keyParams...)
+	}
+	fmt.Fprintf(&sb, " ORDER BY %s LIMIT %d", keysetOrder(opts.OrderBy, opts.Descending), opts.Size+1)
+	return sb.String(), params
+}
+
+// order identifies the ordering a cursor belongs to
+func (p *Paginator) order() string {
+	return pageOrder(p.opts)
+}
+
+func pageOrder(opts PageOptions) string {
+	order := strings.Join(opts.OrderBy, ",")
+	if opts.Descending {
+		order += " desc"
+	}
+	return order
+}
+
+func (p *Paginator) encodeCursor(key []interface{}) (string, error) {
+	encoded, err := json.Marshal(pageCursor{Order: p.order(), Key: key})
+	if err != nil {
+		return "", fmt.Errorf("encoding cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(encoded), nil
+}
+
+func (p *Paginator) decodeCursor(token string) ([]interface{}, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("paginate: %w", ErrInvalidCursor)
+	}
+
+	var cursor pageCursor
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&cursor); err != nil {
+		return nil, fmt.Errorf("paginate: %w", ErrInvalidCursor)
+	}
+	if cursor.Order != p.order() || len(cursor.Key) != len(p.opts.OrderBy) {
+		return nil, fmt.Errorf("paginate: %w: issued for a different ordering", ErrInvalidCursor)
+	}
+	return cursor.Key, nil
+}
@@ -0,0 +1,53 @@
+package workersql
+
+import (
+	"database/sql/driver"
+	"fmt"
+
+	"github.com/healthfees-org/workersql/sdk/go/internal/params"
+)
+
+// In marks values as a list parameter. The placeholder it is bound to is
+// expanded into one placeholder per value, so
+//
+//	client.Query(ctx, "SELECT * FROM users WHERE id IN (?)", workersql.In(1, 2, 3))
+//
+// is sent as `WHERE id IN (?, ?, ?)`. Slices other than []byte are expanded
+// automatically, so In is only needed to build a list from individual values.
+// An empty list expands to a subquery returning no rows.
+func In(values ...interface{}) interface{} {
+	return params.List(values)
+}
+
+// expandParams rewrites list parameters into individual placeholders,
+// resolves driver.Valuer arguments such as sql.NullString and Null[T], so
+// invalid values are sent as NULL, and maps registered enums to their
+// database values
+func expandParams(sql string, args []interface{}) (string, []interface{}, error) {
+	resolved := args
+	for i, arg := range args {
+		valuer, ok := arg.(driver.Valuer)
+		if !ok {
+			continue
+		}
+		v, err := valuer.Value()
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid params: param %d: %w", i+1, err)
+		}
+		if &resolved[0] == &args[0] {
+			// Don't modify the caller's slice
+			resolved = append([]interface{}(nil), args...)
+		}
+		resolved[i] = v
+	}
+
+	expanded, flat, err := params.Expand(sql, resolved)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid params: %w", err)
+	}
+	flat, err = encodeEnums(flat)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid params: %w", err)
+	}
+	return expanded, flat, nil
+}
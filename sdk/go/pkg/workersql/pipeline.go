@@ -0,0 +1,124 @@
+package workersql
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/internal/websocket"
+)
+
+// Pipeline queues statements of a transaction and sends them to the server
+// in a single WebSocket frame, so N statements cost one round trip instead
+// of N. Statements run in the order they were queued.
+type Pipeline struct {
+	tx         *TransactionClient
+	statements []websocket.Statement
+	err        error
+}
+
+// PipelineError reports the statement that failed in a flushed pipeline
+type PipelineError struct {
+	// Index is the position of the failed statement in the pipeline
+	Index int
+	SQL   string
+	Err   error
+}
+
+func (e *PipelineError) Error() string {
+	return fmt.Sprintf("pipeline statement %d (%s): %v", e.Index, e.SQL, e.Err)
+}
+
+func (e *PipelineError) Unwrap() error {
+	return e.Err
+}
+
+// Pipeline returns an empty pipeline for the transaction
+func (tx *TransactionClient) Pipeline() *Pipeline {
+	return &Pipeline{tx: tx}
+}
+
+// Query queues a query and returns its index in the results of Flush
+func (p *Pipeline) Query(sql string, params ...interface{}) int {
+	return p.add("", sql, params)
+}
+
+// Exec queues a write statement, whose result reports affected rows and the
+// last insert ID, and returns its index in the results of Flush
+func (p *Pipeline) Exec(sql string, params ...interface{}) int {
+	return p.add("exec", sql, params)
+}
+
+func (p *Pipeline) add(mode, sql string, params []interface{}) int {
+	index := len(p.statements)
+	sql, params, err := expandParams(sql, params)
+	if err != nil && p.err == nil {
+		p.err = &PipelineError{Index: index, SQL: sql, Err: err}
+	}
+	p.statements = append(p.statements, websocket.Statement{SQL: sql, Params: params, Mode: mode})
+	return index
+}
+
+// Len returns the number of queued statements
+func (p *Pipeline) Len() int {
+	return len(p.statements)
+}
+
+// Flush sends the queued statements and returns their results in queue
+// order, leaving the pipeline empty for reuse. The server stops at the first
+// failing statement: the results then end with its failed response and the
+// error is a *PipelineError identifying it. A failed statement does not end
+// the transaction; roll back or continue as with Query and Exec.
+func (p *Pipeline) Flush(ctx context.Context) ([]*QueryResponse, error) {
+	statements, queueErr := p.statements, p.err
+	p.statements, p.err = nil, nil
+
+	if p.tx.isDone() {
+		return nil, ErrTxDone
+	}
+	if queueErr != nil {
+		return nil, queueErr
+	}
+	if len(statements) == 0 {
+		return nil, nil
+	}
+
+	for _, statement := range statements {
+		p.tx.queries.notify("Pipeline", statement.SQL)
+	}
+	budget := budgetFrom(ctx)
+	if err := budget.admit(len(statements)); err != nil {
+		return nil, err
+	}
+	defer budget.spend(time.Now())
+
+	var wsResults []*websocket.QueryResponse
+	var err error
+	start := time.Now()
+	instrument(ctx, p.tx.labels, "Pipeline", "", func(ctx context.Context) {
+		wsResults, err = p.tx.conn.Pipeline(ctx, statements)
+	})
+	if err != nil {
+		p.tx.stats.record(len(statements), time.Since(start), len(statements), 0)
+		return nil, err
+	}
+
+	results := make([]*QueryResponse, len(wsResults))
+	var failure error
+	for i, wsResp := range wsResults {
+		results[i] = p.tx.decoder.queryResponseFromWS(wsResp)
+		if err := results[i].failure(); err != nil {
+			failure = &PipelineError{Index: i, SQL: statements[i].SQL, Err: err}
+			break
+		}
+		p.tx.schema.observe(statements[i].SQL)
+	}
+
+	// Statements skipped after a failure are not counted
+	failed := 0
+	if failure != nil {
+		failed = 1
+	}
+	p.tx.stats.record(len(wsResults), time.Since(start), failed, 0)
+	return results, failure
+}
@@ -0,0 +1,213 @@
+package workersql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Probe defaults
+const (
+	DefaultProbeMaxErrorRate       = 0.5
+	DefaultProbeMinRequests        = 10
+	DefaultProbeErrorWindow        = time.Minute
+	DefaultProbeHealthCheckMaxAge  = 30 * time.Second
+	DefaultProbeHealthCheckTimeout = 2 * time.Second
+)
+
+// ProbeConfig tunes ReadinessHandler
+type ProbeConfig struct {
+	// MaxErrorRate is the fraction of statements failed within ErrorWindow
+	// above which the client isn't ready (default: 0.5)
+	MaxErrorRate float64
+	// MinRequests is how many statements ErrorWindow must hold before the
+	// error rate counts (default: 10)
+	MinRequests int64
+	// ErrorWindow is how far back errors and pool acquire timeouts count
+	// (default: 1m)
+	ErrorWindow time.Duration
+	// HealthCheckMaxAge is how old the last successful /health check may
+	// be; an older one makes the probe check again (default: 30s)
+	HealthCheckMaxAge time.Duration
+	// HealthCheckTimeout bounds the probe's own /health check (default: 2s)
+	HealthCheckTimeout time.Duration
+}
+
+// ProbeCheck is the outcome of one readiness check
+type ProbeCheck struct {
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+// ProbeResult is the body served by ReadinessHandler and LivenessHandler
+type ProbeResult struct {
+	// Status is "ok" or "unavailable"
+	Status string                `json:"status"`
+	Checks map[string]ProbeCheck `json:"checks"`
+}
+
+// probeSample is the client's counters at a readiness check
+type probeSample struct {
+	at              time.Time
+	queries         int64
+	errors          int64
+	acquireTimeouts int64
+}
+
+// probes holds the state readiness checks share: the samples the recent
+// error rate is computed from and the time of the last successful health
+// check
+type probes struct {
+	config ProbeConfig
+	// lastHealthy is the UnixNano time of the last successful /health
+	// check, by the probe or otherwise
+	lastHealthy int64
+
+	mu      sync.Mutex
+	samples []probeSample
+}
+
+func newProbes(config *ProbeConfig) *probes {
+	// The client starts with no statements, the first baseline
+	p := &probes{samples: []probeSample{{at: time.Now()}}}
+	if config != nil {
+		p.config = *config
+	}
+	if p.config.MaxErrorRate <= 0 {
+		p.config.MaxErrorRate = DefaultProbeMaxErrorRate
+	}
+	if p.config.MinRequests <= 0 {
+		p.config.MinRequests = DefaultProbeMinRequests
+	}
+	if p.config.ErrorWindow <= 0 {
+		p.config.ErrorWindow = DefaultProbeErrorWindow
+	}
+	if p.config.HealthCheckMaxAge <= 0 {
+		p.config.HealthCheckMaxAge = DefaultProbeHealthCheckMaxAge
+	}
+	if p.config.HealthCheckTimeout <= 0 {
+		p.config.HealthCheckTimeout = DefaultProbeHealthCheckTimeout
+	}
+	return p
+}
+
+func (p *probes) healthy() {
+	atomic.StoreInt64(&p.lastHealthy, time.Now().UnixNano())
+}
+
+// window records current and returns the sample to compare it with: the
+// latest one taken before ErrorWindow, or the oldest one kept
+func (p *probes) window(current probeSample) probeSample {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	cutoff := current.at.Add(-p.config.ErrorWindow)
+	// Keep one sample older than the window as its baseline
+	drop := 0
+	for drop+1 < len(p.samples) && !p.samples[drop+1].at.After(cutoff) {
+		drop++
+	}
+	p.samples = append(p.samples[drop:], current)
+	return p.samples[0]
+}
+
+// ReadinessHandler returns an http.Handler for a Kubernetes readiness
+// probe. It answers 503 once shutdown begins, while every endpoint is
+// ejected, when the pool timed out handing out connections or too many
+// statements failed within ProbeConfig.ErrorWindow, or when the gateway's
+// /health check fails; otherwise 200. The body is a ProbeResult.
+func (c *Client) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeProbe(w, c.readiness(r.Context()))
+	})
+}
+
+// LivenessHandler returns an http.Handler for a Kubernetes liveness probe.
+// It only fails, with 503, once the client is closed, since a closed
+// client never recovers; gateway trouble fails readiness instead, so pods
+// aren't restarted over an outage they can't fix.
+func (c *Client) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result := ProbeResult{Checks: map[string]ProbeCheck{"client": {OK: true}}}
+		if c.life.isClosing() {
+			result.Checks["client"] = ProbeCheck{Message: "client closed"}
+		}
+		writeProbe(w, result)
+	})
+}
+
+func (c *Client) readiness(ctx context.Context) ProbeResult {
+	p := c.probes
+	checks := make(map[string]ProbeCheck)
+
+	checks["lifecycle"] = ProbeCheck{OK: true}
+	if c.life.isClosing() {
+		checks["lifecycle"] = ProbeCheck{Message: "shutting down"}
+	}
+
+	if endpoints := c.Endpoints(); endpoints != nil {
+		healthy := 0
+		for _, e := range endpoints {
+			if e.Healthy {
+				healthy++
+			}
+		}
+		checks["endpoints"] = ProbeCheck{OK: healthy > 0, Message: fmt.Sprintf("%d of %d healthy", healthy, len(endpoints))}
+	}
+
+	stats := c.Stats()
+	current := probeSample{at: time.Now(), queries: stats.Queries, errors: stats.Errors}
+	if stats.Pool != nil {
+		current.acquireTimeouts, _ = stats.Pool["acquireTimeouts"].(int64)
+	}
+	baseline := p.window(current)
+
+	if stats.Pool != nil {
+		timeouts := current.acquireTimeouts - baseline.acquireTimeouts
+		checks["pool"] = ProbeCheck{OK: timeouts == 0}
+		if timeouts > 0 {
+			checks["pool"] = ProbeCheck{Message: fmt.Sprintf("%d acquire timeouts", timeouts)}
+		}
+	}
+
+	queries, failed := current.queries-baseline.queries, current.errors-baseline.errors
+	checks["errors"] = ProbeCheck{OK: true}
+	if queries >= p.config.MinRequests {
+		rate := float64(failed) / float64(queries)
+		checks["errors"] = ProbeCheck{
+			OK:      rate <= p.config.MaxErrorRate,
+			Message: fmt.Sprintf("%d of %d statements failed", failed, queries),
+		}
+	}
+
+	last := time.Unix(0, atomic.LoadInt64(&p.lastHealthy))
+	checks["health"] = ProbeCheck{OK: true}
+	if time.Since(last) > p.config.HealthCheckMaxAge && !c.life.isClosing() {
+		ctx, cancel := context.WithTimeout(ctx, p.config.HealthCheckTimeout)
+		_, err := c.Health(ctx)
+		cancel()
+		if err != nil {
+			checks["health"] = ProbeCheck{Message: err.Error()}
+		}
+	}
+
+	return ProbeResult{Checks: checks}
+}
+
+func writeProbe(w http.ResponseWriter, result ProbeResult) {
+	status := http.StatusOK
+	result.Status = "ok"
+	for _, check := range result.Checks {
+		if !check.OK {
+			status = http.StatusServiceUnavailable
+			result.Status = "unavailable"
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(result)
+}
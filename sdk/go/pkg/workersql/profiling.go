@@ -0,0 +1,71 @@
+package workersql
+
+import (
+	"context"
+	"regexp"
+	"runtime/pprof"
+	"runtime/trace"
+	"strings"
+)
+
+// maxFingerprintLen keeps profile labels and trace logs readable
+const maxFingerprintLen = 256
+
+var (
+	fingerprintLiteral = regexp.MustCompile(`'(?:[^'\\]|\\.|'')*'|"(?:[^"\\]|\\.)*"|\b\d+(?:\.\d+)?(?:[eE][-+]?\d+)?\b`)
+	fingerprintList    = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+	fingerprintSpace   = regexp.MustCompile(`\s+`)
+	statementTableRe   = regexp.MustCompile("(?i)\\b(?:from|into|update|join)\\s+(`[^`]+`|[\\w.]+)")
+)
+
+// Fingerprint normalizes sql into a query shape shared by every execution
+// with different values: literals become ?, placeholder lists such as IN
+// clauses collapse to (?+) and whitespace is collapsed
+func Fingerprint(sql string) string {
+	fp := fingerprintLiteral.ReplaceAllString(sql, "?")
+	fp = fingerprintList.ReplaceAllString(fp, "(?+)")
+	fp = strings.TrimSpace(fingerprintSpace.ReplaceAllString(fp, " "))
+	if len(fp) > maxFingerprintLen {
+		fp = fp[:maxFingerprintLen]
+	}
+	return fp
+}
+
+// statementTable returns the first table sql reads or writes, or "" if none
+// is found
+func statementTable(sql string) string {
+	m := statementTableRe.FindStringSubmatch(sql)
+	if m == nil {
+		return ""
+	}
+	return normalizeTableName(m[1])
+}
+
+// instrument runs fn inside a runtime/trace region named after op. With
+// labels set it also runs fn under pprof labels identifying the call, so
+// CPU and goroutine profiles attribute time to it; the labels are inherited
+// by goroutines fn starts. sql may be empty for calls without a single
+// statement.
+func instrument(ctx context.Context, labels bool, op, sql string, fn func(context.Context)) {
+	region := trace.StartRegion(ctx, "workersql."+op)
+	defer region.End()
+
+	var fp string
+	if sql != "" && (labels || trace.IsEnabled()) {
+		fp = Fingerprint(sql)
+		trace.Log(ctx, "workersql.query", fp)
+	}
+	if !labels {
+		fn(ctx)
+		return
+	}
+
+	kv := []string{"workersql.op", op}
+	if fp != "" {
+		kv = append(kv, "workersql.query", fp)
+	}
+	if table := statementTable(sql); table != "" {
+		kv = append(kv, "workersql.table", table)
+	}
+	pprof.Do(ctx, pprof.Labels(kv...), fn)
+}
@@ -0,0 +1,210 @@
+package qb
+
+// Cond is a condition of a WHERE, HAVING or ON clause
+type Cond interface {
+	writeCond(w *writer)
+}
+
+// writeCond makes an Expr usable as a condition, parenthesized so its
+// operators don't bind with the statement's
+func (e Expr) writeCond(w *writer) {
+	w.write("(")
+	w.expr(e)
+	w.write(")")
+}
+
+type compare struct {
+	column string
+	op     string
+	value  interface{}
+}
+
+func (c compare) writeCond(w *writer) {
+	w.ident(c.column)
+	w.write(" " + c.op + " ")
+	w.value(c.value)
+}
+
+// Eq is column = value, or column IS NULL for a nil value
+func Eq(column string, value interface{}) Cond {
+	if value == nil {
+		return IsNull(column)
+	}
+	return compare{column, "=", value}
+}
+
+// NotEq is column <> value, or column IS NOT NULL for a nil value
+func NotEq(column string, value interface{}) Cond {
+	if value == nil {
+		return IsNotNull(column)
+	}
+	return compare{column, "<>", value}
+}
+
+// Lt is column < value
+func Lt(column string, value interface{}) Cond { return compare{column, "<", value} }
+
+// Lte is column <= value
+func Lte(column string, value interface{}) Cond { return compare{column, "<=", value} }
+
+// Gt is column > value
+func Gt(column string, value interface{}) Cond { return compare{column, ">", value} }
+
+// Gte is column >= value
+func Gte(column string, value interface{}) Cond { return compare{column, ">=", value} }
+
+// Like is column LIKE pattern
+func Like(column string, pattern interface{}) Cond { return compare{column, "LIKE", pattern} }
+
+// NotLike is column NOT LIKE pattern
+func NotLike(column string, pattern interface{}) Cond { return compare{column, "NOT LIKE", pattern} }
+
+type null struct {
+	column string
+	not    bool
+}
+
+func (n null) writeCond(w *writer) {
+	w.ident(n.column)
+	if n.not {
+		w.write(" IS NOT NULL")
+	} else {
+		w.write(" IS NULL")
+	}
+}
+
+// IsNull is column IS NULL
+func IsNull(column string) Cond { return null{column: column} }
+
+// IsNotNull is column IS NOT NULL
+func IsNotNull(column string) Cond { return null{column: column, not: true} }
+
+type in struct {
+	column string
+	values interface{}
+	not    bool
+}
+
+func (c in) writeCond(w *writer) {
+	op := " IN "
+	if c.not {
+		op = " NOT IN "
+	}
+	if sub, ok := c.values.(Statement); ok {
+		w.ident(c.column)
+		w.write(op)
+		w.subquery(sub)
+		return
+	}
+	list, ok := values(c.values)
+	if !ok {
+		list = []interface{}{c.values}
+	}
+	if len(list) == 0 {
+		// Nothing is in an empty list
+		if c.not {
+			w.write("1 = 1")
+		} else {
+			w.write("1 = 0")
+		}
+		return
+	}
+	w.ident(c.column)
+	w.write(op + "(")
+	for i, v := range list {
+		if i > 0 {
+			w.write(", ")
+		}
+		w.value(v)
+	}
+	w.write(")")
+}
+
+// In is column IN (values...), for a slice of values or a subquery. An
+// empty slice matches no rows.
+func In(column string, values interface{}) Cond { return in{column: column, values: values} }
+
+// NotIn is column NOT IN (values...), for a slice of values or a subquery.
+// An empty slice matches every row.
+func NotIn(column string, values interface{}) Cond {
+	return in{column: column, values: values, not: true}
+}
+
+type between struct {
+	column    string
+	low, high interface{}
+}
+
+func (b between) writeCond(w *writer) {
+	w.ident(b.column)
+	w.write(" BETWEEN ")
+	w.value(b.low)
+	w.write(" AND ")
+	w.value(b.high)
+}
+
+// Between is column BETWEEN low AND high
+func Between(column string, low, high interface{}) Cond { return between{column, low, high} }
+
+type junction struct {
+	op    string
+	conds []Cond
+}
+
+func (j junction) writeCond(w *writer) {
+	if len(j.conds) == 0 {
+		// The identity of the junction
+		if j.op == "AND" {
+			w.write("1 = 1")
+		} else {
+			w.write("1 = 0")
+		}
+		return
+	}
+	w.write("(")
+	for i, c := range j.conds {
+		if i > 0 {
+			w.write(" " + j.op + " ")
+		}
+		c.writeCond(w)
+	}
+	w.write(")")
+}
+
+// And is true when every condition is
+func And(conds ...Cond) Cond { return junction{"AND", conds} }
+
+// Or is true when any condition is
+func Or(conds ...Cond) Cond { return junction{"OR", conds} }
+
+type not struct {
+	cond Cond
+}
+
+func (n not) writeCond(w *writer) {
+	w.write("NOT (")
+	n.cond.writeCond(w)
+	w.write(")")
+}
+
+// Not negates cond
+func Not(cond Cond) Cond { return not{cond} }
+
+type exists struct {
+	query Statement
+	not   bool
+}
+
+func (e exists) writeCond(w *writer) {
+	if e.not {
+		w.write("NOT ")
+	}
+	w.write("EXISTS ")
+	w.subquery(e.query)
+}
+
+// Exists is true when query returns a row
+func Exists(query Statement) Cond { return exists{query: query} }
+
+// NotExists is true when query returns no rows
+func NotExists(query Statement) Cond { return exists{query: query, not: true} }
@@ -0,0 +1,188 @@
+// Package qb builds WorkerSQL statements fluently instead of concatenating
+// strings. Values are always bound as parameters and identifiers are
+// quoted, so input never ends up in the SQL text:
+//
+//	sql, params, err := qb.Select("id", "name").From("users").Where(qb.Eq("status", "active")).Limit(10).ToSQL()
+//	resp, err := client.Query(ctx, sql, params...)
+//
+// or, running the statement directly on a Client, TransactionClient or
+// Session:
+//
+//	resp, err := qb.Select("id", "name").From("users").Where(qb.Eq("status", "active")).Query(ctx, client)
+//
+// Builders are changed in place by their methods, which return them for
+// chaining. A select builder used as a value, e.g. in In or Eq, is a
+// subquery.
+package qb
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Statement is a built statement: its SQL text, with ? placeholders, and
+// the parameters bound to them
+type Statement interface {
+	ToSQL() (string, []interface{}, error)
+}
+
+// Expr is a fragment of SQL placed in a statement as is, with parameters
+// for its placeholders. It covers what the builders don't, such as
+// function calls; never build its text from input.
+type Expr struct {
+	SQL    string
+	Params []interface{}
+}
+
+// Raw returns an Expr for sql and its parameters
+func Raw(sql string, params ...interface{}) Expr {
+	return Expr{SQL: sql, Params: params}
+}
+
+// Column is a column compared as a value, e.g. in the ON condition of a
+// join: qb.Eq("orders.user_id", qb.Col("users.id"))
+type Column string
+
+// Col returns the column name, to use as a value
+func Col(name string) Column {
+	return Column(name)
+}
+
+// writer accumulates the SQL text and parameters of a statement, keeping
+// the first error
+type writer struct {
+	sb     strings.Builder
+	params []interface{}
+	err    error
+}
+
+func (w *writer) write(s string) {
+	w.sb.WriteString(s)
+}
+
+func (w *writer) fail(format string, args ...interface{}) {
+	if w.err == nil {
+		w.err = fmt.Errorf("qb: "+format, args...)
+	}
+}
+
+// ident writes a quoted identifier, dotted for qualified names. A * is
+// written as is, as the last part of a name.
+func (w *writer) ident(name string) {
+	if name == "" {
+		w.fail("empty identifier")
+		return
+	}
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		if i > 0 {
+			w.write(".")
+		}
+		switch {
+		case part == "*" && i == len(parts)-1:
+			w.write("*")
+		case part == "":
+			w.fail("invalid identifier %q", name)
+			return
+		default:
+			w.write("`" + strings.ReplaceAll(part, "`", "``") + "`")
+		}
+	}
+}
+
+// identAlias writes a name optionally followed by an alias, as in
+// "users u" or "users AS u"
+func (w *writer) identAlias(name string) {
+	fields := strings.Fields(name)
+	switch {
+	case len(fields) == 1:
+		w.ident(fields[0])
+	case len(fields) == 2:
+		w.ident(fields[0])
+		w.write(" AS ")
+		w.ident(fields[1])
+	case len(fields) == 3 && strings.EqualFold(fields[1], "AS"):
+		w.ident(fields[0])
+		w.write(" AS ")
+		w.ident(fields[2])
+	default:
+		w.fail("invalid name %q", name)
+	}
+}
+
+func (w *writer) idents(names []string) {
+	for i, name := range names {
+		if i > 0 {
+			w.write(", ")
+		}
+		w.ident(name)
+	}
+}
+
+// value writes v: a parameter placeholder, a parenthesized subquery, a
+// column or an Expr
+func (w *writer) value(v interface{}) {
+	switch v := v.(type) {
+	case Column:
+		w.ident(string(v))
+	case Expr:
+		w.expr(v)
+	case Statement:
+		w.subquery(v)
+	default:
+		w.write("?")
+		w.params = append(w.params, v)
+	}
+}
+
+func (w *writer) expr(e Expr) {
+	w.write(e.SQL)
+	w.params = append(w.params, e.Params...)
+}
+
+func (w *writer) subquery(s Statement) {
+	sql, params, err := s.ToSQL()
+	if err != nil {
+		if w.err == nil {
+			w.err = err
+		}
+		return
+	}
+	w.write("(" + sql + ")")
+	w.params = append(w.params, params...)
+}
+
+// conds writes conditions joined with AND
+func (w *writer) conds(conds []Cond) {
+	for i, c := range conds {
+		if i > 0 {
+			w.write(" AND ")
+		}
+		c.writeCond(w)
+	}
+}
+
+func (w *writer) result() (string, []interface{}, error) {
+	if w.err != nil {
+		return "", nil, w.err
+	}
+	return w.sb.String(), w.params, nil
+}
+
+// values returns the elements of a slice or array v, or nil and false if v
+// isn't one. Byte slices are single values.
+func values(v interface{}) ([]interface{}, bool) {
+	if _, ok := v.([]byte); ok {
+		return nil, false
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+	out := make([]interface{}, rv.Len())
+	for i := range out {
+		out[i] = rv.Index(i).Interface()
+	}
+	return out, true
+}
@@ -0,0 +1,224 @@
+package qb
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+)
+
+// SelectBuilder builds a SELECT statement
+type SelectBuilder struct {
+	distinct bool
+	// columns holds names, possibly aliased, and aliased Exprs
+	columns []interface{}
+	from    string
+	fromSub Statement
+	joins   []join
+	where   []Cond
+	groupBy []string
+	having  []Cond
+	orderBy []string
+	limit   int
+	offset  int
+}
+
+type join struct {
+	kind  string
+	table string
+	on    Cond
+}
+
+type aliasedExpr struct {
+	expr  Expr
+	alias string
+}
+
+// Select starts a SELECT of columns, each a name optionally followed by an
+// alias, as in "u.name AS author". No columns select *.
+func Select(columns ...string) *SelectBuilder {
+	b := &SelectBuilder{limit: -1, offset: -1}
+	for _, col := range columns {
+		b.columns = append(b.columns, col)
+	}
+	return b
+}
+
+// Distinct makes the statement SELECT DISTINCT
+func (b *SelectBuilder) Distinct() *SelectBuilder {
+	b.distinct = true
+	return b
+}
+
+// ColumnExpr adds an expression to the selected columns, named alias if
+// not empty, e.g. ColumnExpr(qb.Raw("COUNT(*)"), "n")
+func (b *SelectBuilder) ColumnExpr(expr Expr, alias string) *SelectBuilder {
+	b.columns = append(b.columns, aliasedExpr{expr, alias})
+	return b
+}
+
+// From selects from table, optionally followed by an alias
+func (b *SelectBuilder) From(table string) *SelectBuilder {
+	b.from, b.fromSub = table, nil
+	return b
+}
+
+// FromSubquery selects from the rows of query, named alias
+func (b *SelectBuilder) FromSubquery(query Statement, alias string) *SelectBuilder {
+	b.from, b.fromSub = alias, query
+	return b
+}
+
+// Join adds an INNER JOIN of table, optionally followed by an alias, on
+// the condition
+func (b *SelectBuilder) Join(table string, on Cond) *SelectBuilder {
+	b.joins = append(b.joins, join{"JOIN", table, on})
+	return b
+}
+
+// LeftJoin adds a LEFT JOIN of table, optionally followed by an alias, on
+// the condition
+func (b *SelectBuilder) LeftJoin(table string, on Cond) *SelectBuilder {
+	b.joins = append(b.joins, join{"LEFT JOIN", table, on})
+	return b
+}
+
+// Where adds conditions the rows must meet, all of them across calls
+func (b *SelectBuilder) Where(conds ...Cond) *SelectBuilder {
+	b.where = append(b.where, conds...)
+	return b
+}
+
+// GroupBy groups the rows by columns
+func (b *SelectBuilder) GroupBy(columns ...string) *SelectBuilder {
+	b.groupBy = append(b.groupBy, columns...)
+	return b
+}
+
+// Having adds conditions the groups must meet
+func (b *SelectBuilder) Having(conds ...Cond) *SelectBuilder {
+	b.having = append(b.having, conds...)
+	return b
+}
+
+// OrderBy orders the rows by columns, each optionally followed by ASC or
+// DESC, as in "created_at DESC"
+func (b *SelectBuilder) OrderBy(columns ...string) *SelectBuilder {
+	b.orderBy = append(b.orderBy, columns...)
+	return b
+}
+
+// Limit returns at most n rows
+func (b *SelectBuilder) Limit(n int) *SelectBuilder {
+	b.limit = n
+	return b
+}
+
+// Offset skips the first n rows
+func (b *SelectBuilder) Offset(n int) *SelectBuilder {
+	b.offset = n
+	return b
+}
+
+// ToSQL returns the statement and its parameters
+func (b *SelectBuilder) ToSQL() (string, []interface{}, error) {
+	w := &writer{}
+	w.write("SELECT ")
+	if b.distinct {
+		w.write("DISTINCT ")
+	}
+	if len(b.columns) == 0 {
+		w.write("*")
+	}
+	for i, col := range b.columns {
+		if i > 0 {
+			w.write(", ")
+		}
+		switch col := col.(type) {
+		case string:
+			w.identAlias(col)
+		case aliasedExpr:
+			w.expr(col.expr)
+			if col.alias != "" {
+				w.write(" AS ")
+				w.ident(col.alias)
+			}
+		}
+	}
+
+	switch {
+	case b.fromSub != nil:
+		w.write(" FROM ")
+		w.subquery(b.fromSub)
+		w.write(" AS ")
+		w.ident(b.from)
+	case b.from != "":
+		w.write(" FROM ")
+		w.identAlias(b.from)
+	case len(b.joins) > 0:
+		w.fail("JOIN without FROM")
+	}
+	for _, j := range b.joins {
+		w.write(" " + j.kind + " ")
+		w.identAlias(j.table)
+		w.write(" ON ")
+		j.on.writeCond(w)
+	}
+	if len(b.where) > 0 {
+		w.write(" WHERE ")
+		w.conds(b.where)
+	}
+	if len(b.groupBy) > 0 {
+		w.write(" GROUP BY ")
+		w.idents(b.groupBy)
+	}
+	if len(b.having) > 0 {
+		w.write(" HAVING ")
+		w.conds(b.having)
+	}
+	if len(b.orderBy) > 0 {
+		w.write(" ORDER BY ")
+		for i, col := range b.orderBy {
+			if i > 0 {
+				w.write(", ")
+			}
+			w.order(col)
+		}
+	}
+	if b.limit >= 0 {
+		w.write(" LIMIT " + strconv.Itoa(b.limit))
+	}
+	if b.offset >= 0 {
+		if b.limit < 0 {
+			w.fail("OFFSET without LIMIT")
+		}
+		w.write(" OFFSET " + strconv.Itoa(b.offset))
+	}
+	return w.result()
+}
+
+// order writes an ORDER BY term, a column optionally followed by ASC or
+// DESC
+func (w *writer) order(term string) {
+	fields := strings.Fields(term)
+	switch {
+	case len(fields) == 1:
+		w.ident(fields[0])
+	case len(fields) == 2 && (strings.EqualFold(fields[1], "ASC") || strings.EqualFold(fields[1], "DESC")):
+		w.ident(fields[0])
+		w.write(" " + strings.ToUpper(fields[1]))
+	default:
+		w.fail("invalid ORDER BY term %q", term)
+	}
+}
+
+// Query builds the statement and runs it with q, a Client,
+// TransactionClient or Session
+func (b *SelectBuilder) Query(ctx context.Context, q workersql.Querier) (*workersql.QueryResponse, error) {
+	sql, params, err := b.ToSQL()
+	if err != nil {
+		return nil, err
+	}
+	return q.Query(ctx, sql, params...)
+}
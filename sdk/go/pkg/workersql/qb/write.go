@@ -0,0 +1,223 @@
+package qb
+
+import (
+	"context"
+	"sort"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+)
+
+// InsertBuilder builds an INSERT statement
+type InsertBuilder struct {
+	table   string
+	columns []string
+	rows    [][]interface{}
+	query   Statement
+}
+
+// Insert starts an INSERT into table
+func Insert(table string) *InsertBuilder {
+	return &InsertBuilder{table: table}
+}
+
+// Columns sets the columns the values are for
+func (b *InsertBuilder) Columns(columns ...string) *InsertBuilder {
+	b.columns = columns
+	return b
+}
+
+// Values adds a row, one value per column. Call it again for more rows.
+func (b *InsertBuilder) Values(values ...interface{}) *InsertBuilder {
+	b.rows = append(b.rows, values)
+	return b
+}
+
+// SetMap sets the columns, in name order, and the row from values
+func (b *InsertBuilder) SetMap(values map[string]interface{}) *InsertBuilder {
+	b.columns = sortedKeys(values)
+	row := make([]interface{}, len(b.columns))
+	for i, col := range b.columns {
+		row[i] = values[col]
+	}
+	b.rows = [][]interface{}{row}
+	return b
+}
+
+// Select inserts the rows of query instead of values
+func (b *InsertBuilder) Select(query Statement) *InsertBuilder {
+	b.query = query
+	return b
+}
+
+// ToSQL returns the statement and its parameters
+func (b *InsertBuilder) ToSQL() (string, []interface{}, error) {
+	w := &writer{}
+	w.write("INSERT INTO ")
+	w.ident(b.table)
+	if len(b.columns) > 0 {
+		w.write(" (")
+		w.idents(b.columns)
+		w.write(")")
+	}
+	switch {
+	case b.query != nil && len(b.rows) > 0:
+		w.fail("INSERT with both values and a query")
+	case b.query != nil:
+		w.write(" ")
+		sql, params, err := b.query.ToSQL()
+		if err != nil {
+			return "", nil, err
+		}
+		w.write(sql)
+		w.params = append(w.params, params...)
+	case len(b.rows) == 0:
+		w.fail("INSERT without values")
+	default:
+		w.write(" VALUES ")
+		for i, row := range b.rows {
+			if len(b.columns) > 0 && len(row) != len(b.columns) {
+				w.fail("row %d has %d values for %d columns", i, len(row), len(b.columns))
+			}
+			if i > 0 {
+				w.write(", ")
+			}
+			w.write("(")
+			for j, v := range row {
+				if j > 0 {
+					w.write(", ")
+				}
+				w.value(v)
+			}
+			w.write(")")
+		}
+	}
+	return w.result()
+}
+
+// Exec builds the statement and runs it with q, a Client,
+// TransactionClient or Session
+func (b *InsertBuilder) Exec(ctx context.Context, q workersql.Querier) (*workersql.ExecResponse, error) {
+	return exec(ctx, q, b)
+}
+
+// UpdateBuilder builds an UPDATE statement
+type UpdateBuilder struct {
+	table string
+	sets  []set
+	where []Cond
+}
+
+type set struct {
+	column string
+	value  interface{}
+}
+
+// Update starts an UPDATE of table
+func Update(table string) *UpdateBuilder {
+	return &UpdateBuilder{table: table}
+}
+
+// Set assigns value to column. The value may be an Expr, such as
+// qb.Raw("stock - ?", 1), or a subquery.
+func (b *UpdateBuilder) Set(column string, value interface{}) *UpdateBuilder {
+	b.sets = append(b.sets, set{column, value})
+	return b
+}
+
+// SetMap assigns values to their columns, in name order
+func (b *UpdateBuilder) SetMap(values map[string]interface{}) *UpdateBuilder {
+	for _, col := range sortedKeys(values) {
+		b.Set(col, values[col])
+	}
+	return b
+}
+
+// Where adds conditions the updated rows must meet, all of them across
+// calls
+func (b *UpdateBuilder) Where(conds ...Cond) *UpdateBuilder {
+	b.where = append(b.where, conds...)
+	return b
+}
+
+// ToSQL returns the statement and its parameters
+func (b *UpdateBuilder) ToSQL() (string, []interface{}, error) {
+	w := &writer{}
+	w.write("UPDATE ")
+	w.ident(b.table)
+	if len(b.sets) == 0 {
+		w.fail("UPDATE without SET")
+	}
+	w.write(" SET ")
+	for i, s := range b.sets {
+		if i > 0 {
+			w.write(", ")
+		}
+		w.ident(s.column)
+		w.write(" = ")
+		w.value(s.value)
+	}
+	if len(b.where) > 0 {
+		w.write(" WHERE ")
+		w.conds(b.where)
+	}
+	return w.result()
+}
+
+// Exec builds the statement and runs it with q, a Client,
+// TransactionClient or Session
+func (b *UpdateBuilder) Exec(ctx context.Context, q workersql.Querier) (*workersql.ExecResponse, error) {
+	return exec(ctx, q, b)
+}
+
+// DeleteBuilder builds a DELETE statement
+type DeleteBuilder struct {
+	table string
+	where []Cond
+}
+
+// Delete starts a DELETE from table
+func Delete(table string) *DeleteBuilder {
+	return &DeleteBuilder{table: table}
+}
+
+// Where adds conditions the deleted rows must meet, all of them across
+// calls
+func (b *DeleteBuilder) Where(conds ...Cond) *DeleteBuilder {
+	b.where = append(b.where, conds...)
+	return b
+}
+
+// ToSQL returns the statement and its parameters
+func (b *DeleteBuilder) ToSQL() (string, []interface{}, error) {
+	w := &writer{}
+	w.write("DELETE FROM ")
+	w.ident(b.table)
+	if len(b.where) > 0 {
+		w.write(" WHERE ")
+		w.conds(b.where)
+	}
+	return w.result()
+}
+
+// Exec builds the statement and runs it with q, a Client,
+// TransactionClient or Session
+func (b *DeleteBuilder) Exec(ctx context.Context, q workersql.Querier) (*workersql.ExecResponse, error) {
+	return exec(ctx, q, b)
+}
+
+func exec(ctx context.Context, q workersql.Querier, s Statement) (*workersql.ExecResponse, error) {
+	sql, params, err := s.ToSQL()
+	if err != nil {
+		return nil, err
+	}
+	return q.Exec(ctx, sql, params...)
+}
+
+func sortedKeys(values map[string]interface{}) []string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
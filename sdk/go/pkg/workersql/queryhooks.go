@@ -0,0 +1,71 @@
+package workersql
+
+import "sync"
+
+// QueryEvent describes a statement issued through the client, before it is
+// sent or answered from a cache
+type QueryEvent struct {
+	// Op is the call issuing the statement: "Query", "Exec" or
+	// "BatchQuery" on the client, "TxQuery", "TxExec" or "Pipeline" in a
+	// transaction
+	Op string
+	// SQL is the statement with IN-clause parameters expanded
+	SQL string
+}
+
+// queryListeners fans query events out to the functions registered with
+// OnQuery
+type queryListeners struct {
+	mu        sync.RWMutex
+	nextID    int
+	listeners map[int]func(QueryEvent)
+}
+
+func newQueryListeners() *queryListeners {
+	return &queryListeners{listeners: make(map[int]func(QueryEvent))}
+}
+
+func (l *queryListeners) add(fn func(QueryEvent)) func() {
+	l.mu.Lock()
+	id := l.nextID
+	l.nextID++
+	l.listeners[id] = fn
+	l.mu.Unlock()
+
+	return func() {
+		l.mu.Lock()
+		delete(l.listeners, id)
+		l.mu.Unlock()
+	}
+}
+
+// notify calls the listeners with the event of sql issued by op. It does
+// nothing on nil listeners.
+func (l *queryListeners) notify(op, sql string) {
+	if l == nil {
+		return
+	}
+	l.mu.RLock()
+	if len(l.listeners) == 0 {
+		l.mu.RUnlock()
+		return
+	}
+	fns := make([]func(QueryEvent), 0, len(l.listeners))
+	for _, fn := range l.listeners {
+		fns = append(fns, fn)
+	}
+	l.mu.RUnlock()
+
+	event := QueryEvent{Op: op, SQL: sql}
+	for _, fn := range fns {
+		fn(event)
+	}
+}
+
+// OnQuery registers fn to be called with every statement issued through
+// this client and its transactions, for query logging and regression
+// harnesses. fn is called on the issuing goroutine and shouldn't block. It
+// returns a function that unregisters fn.
+func (c *Client) OnQuery(fn func(QueryEvent)) (unregister func()) {
+	return c.queries.add(fn)
+}
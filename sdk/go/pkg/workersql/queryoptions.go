@@ -0,0 +1,186 @@
+package workersql
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Consistency selects how fresh the data a query reads must be
+type Consistency string
+
+// Consistency levels understood by the gateway
+const (
+	// ConsistencyStrong always reads from the shard, bypassing the cache
+	ConsistencyStrong Consistency = "strong"
+	// ConsistencyBounded accepts cached results up to the gateway's
+	// staleness bound
+	ConsistencyBounded Consistency = "bounded"
+	// ConsistencyCached serves cached results whenever available
+	ConsistencyCached Consistency = "cached"
+)
+
+// Priority tells the gateway how to schedule a query under load
+type Priority string
+
+// Query priorities
+const (
+	PriorityLow    Priority = "low"
+	PriorityNormal Priority = "normal"
+	PriorityHigh   Priority = "high"
+)
+
+// CacheHint controls how the gateway caches one query's result
+type CacheHint struct {
+	// TTL overrides how long the result may be cached. Zero uses the
+	// gateway default.
+	TTL time.Duration
+	// Bypass skips the cache for both reading and storing the result
+	Bypass bool
+}
+
+// QueryOptions overrides client defaults for a single query. Zero values
+// keep the defaults.
+type QueryOptions struct {
+	// Timeout bounds the query including retries. It is also sent to the
+	// gateway so it can abandon the statement. It cannot extend
+	// Config.Timeout, which still bounds each attempt.
+	Timeout     time.Duration
+	Priority    Priority
+	Consistency Consistency
+	Cache       CacheHint
+	// IdempotencyKey is sent as the Idempotency-Key header so the gateway
+	// applies a write once however often it is retried. Writes without one
+	// get a generated key shared by their retries.
+	IdempotencyKey string
+	// ServerBudget overrides the time the gateway is given for the query,
+	// as WithServerBudget does
+	ServerBudget time.Duration
+	// AsOf reads the database as it was at that time, from the history the
+	// platform retains. Only read statements are allowed.
+	AsOf time.Time
+	// Snapshot reads from the snapshot of a token returned by
+	// Client.Snapshot or Snapshot.Token, so several calls see the same
+	// state. Only read statements are allowed.
+	Snapshot string
+}
+
+// QueryWithOptions executes a SQL query like Query, applying opts to this
+// query only
+func (c *Client) QueryWithOptions(ctx context.Context, sql string, params []interface{}, opts QueryOptions) (*QueryResponse, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	if (!opts.AsOf.IsZero() || opts.Snapshot != "") && !isReadStatement(sql) {
+		return nil, ErrReadOnly
+	}
+	sql, params, err := expandParams(sql, params)
+	if err != nil {
+		return nil, err
+	}
+
+	request := map[string]interface{}{
+		"sql": sql,
+	}
+	if len(params) > 0 {
+		request["params"] = params
+	}
+	opts.apply(request)
+
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	if opts.IdempotencyKey != "" {
+		ctx = WithIdempotencyKey(ctx, opts.IdempotencyKey)
+	}
+	if opts.ServerBudget != 0 {
+		ctx = WithServerBudget(ctx, opts.ServerBudget)
+	}
+	return c.query(withRequestHeaders(ctx, opts.headers()), request)
+}
+
+func (o QueryOptions) validate() error {
+	switch o.Consistency {
+	case "", ConsistencyStrong, ConsistencyBounded, ConsistencyCached:
+	default:
+		return fmt.Errorf("invalid consistency %q", o.Consistency)
+	}
+	switch o.Priority {
+	case "", PriorityLow, PriorityNormal, PriorityHigh:
+	default:
+		return fmt.Errorf("invalid priority %q", o.Priority)
+	}
+	if o.Timeout < 0 || o.Cache.TTL < 0 {
+		return fmt.Errorf("query options: negative durations are not allowed")
+	}
+	if !o.AsOf.IsZero() && o.Snapshot != "" {
+		return fmt.Errorf("query options: AsOf and Snapshot are exclusive")
+	}
+	if o.AsOf.After(time.Now()) {
+		return fmt.Errorf("query options: AsOf %v is in the future", o.AsOf)
+	}
+	return nil
+}
+
+// apply adds the options to a /query request body. Consistency travels in
+// the gateway's query hints; snapshot reads are strong, like those of
+// Snapshot.Query.
+func (o QueryOptions) apply(request map[string]interface{}) {
+	consistency := o.Consistency
+	if consistency == "" && o.Snapshot != "" {
+		consistency = ConsistencyStrong
+	}
+	if consistency != "" {
+		request["hints"] = map[string]interface{}{"consistency": string(consistency)}
+	}
+	if !o.AsOf.IsZero() {
+		request["asOf"] = formatAsOf(o.AsOf)
+	}
+	if o.Snapshot != "" {
+		request["snapshot"] = o.Snapshot
+	}
+	if o.Timeout > 0 {
+		request["timeoutMs"] = o.Timeout.Milliseconds()
+	}
+	if o.Priority != "" {
+		request["priority"] = string(o.Priority)
+	}
+	o.Cache.apply(request)
+}
+
+// headers mirrors the options as HTTP headers, so caches and proxies in
+// front of the gateway honour them too
+func (o QueryOptions) headers() http.Header {
+	h := http.Header{}
+	o.Cache.setHeader(h)
+	if o.Priority != "" {
+		h.Set("X-WorkerSQL-Priority", string(o.Priority))
+	}
+	return h
+}
+
+type requestHeadersKey struct{}
+
+// withRequestHeaders attaches headers doRequest adds to every request
+// sent with ctx, on top of those attached already
+func withRequestHeaders(ctx context.Context, h http.Header) context.Context {
+	if len(h) == 0 {
+		return ctx
+	}
+	if existing := requestHeadersFrom(ctx); len(existing) > 0 {
+		merged := existing.Clone()
+		for name, values := range h {
+			merged[name] = values
+		}
+		h = merged
+	}
+	return context.WithValue(ctx, requestHeadersKey{}, h)
+}
+
+func requestHeadersFrom(ctx context.Context) http.Header {
+	h, _ := ctx.Value(requestHeadersKey{}).(http.Header)
+	return h
+}
@@ -0,0 +1,527 @@
+package workersql
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Result cache defaults
+const (
+	DefaultResultCacheTTL        = time.Minute
+	DefaultResultCacheMaxEntries = 1000
+	DefaultNegativeCacheTTL      = 5 * time.Second
+)
+
+// ResultCacheConfig enables an in-process cache of query results
+type ResultCacheConfig struct {
+	// TTL is how long a result is served from the cache (default: 1m). A
+	// cache hint TTL on the query overrides it.
+	TTL time.Duration
+	// MaxEntries bounds the cache; the least recently used result is
+	// evicted first (default: 1000)
+	MaxEntries int
+	// StaleWhileRevalidate serves results for this long past their TTL
+	// while one background query refreshes them. Zero disables it.
+	StaleWhileRevalidate time.Duration
+	// Adaptive, if set, picks the TTL of each query shape from the
+	// server's Cache-Control hints and its observed read/write ratio,
+	// within bounds, instead of using TTL for every result. A cache hint
+	// TTL on the query still wins.
+	Adaptive *AdaptiveCacheConfig
+}
+
+// NegativeCacheConfig enables caching of empty results for a short TTL, so
+// repeated lookups of keys that don't exist don't reach the shards
+type NegativeCacheConfig struct {
+	// TTL is how long an empty result is served from the cache (default:
+	// 5s)
+	TTL time.Duration
+	// Queries lists the queries whose empty results are cached, matched by
+	// their Fingerprint so any query of the same shape qualifies. Empty
+	// means every read.
+	Queries []string
+}
+
+// ResultCacheStats reports the activity of the client-side result cache
+type ResultCacheStats struct {
+	Hits int64
+	// StaleHits counts stale results served while being refreshed
+	StaleHits int64
+	// NegativeHits counts empty results served by the negative cache, also
+	// counted in Hits
+	NegativeHits int64
+	Misses       int64
+	Evictions    int64
+	Entries      int
+}
+
+// resultCache is an LRU cache of SELECT results keyed by normalized SQL
+// and params. Entries are dropped when a statement run through the client
+// writes to a table they read, and on schema changes. Without ResultCache
+// it only holds the empty results of the negative cache. The methods of a
+// nil cache do nothing.
+type resultCache struct {
+	mu         sync.Mutex
+	positive   bool
+	ttl        time.Duration
+	stale      time.Duration
+	maxEntries int
+	adaptive   *adaptiveTTL
+	negative   *negativePolicy
+	lru        *list.List
+	entries    map[string]*list.Element
+	// generation counts invalidations, so results fetched before one are
+	// not stored afterwards
+	generation uint64
+	// waiters holds the callbacks of stale-while-revalidate reads waiting
+	// for a refresh another read started, by key
+	waiters map[string][]func(*QueryResponse, error)
+
+	hits, staleHits, negativeHits, misses, evictions int64
+}
+
+type resultEntry struct {
+	key        string
+	response   *QueryResponse
+	tables     []string
+	expires    time.Time
+	refreshing bool
+	// negative marks an empty result of the negative cache, which is never
+	// served stale
+	negative bool
+}
+
+// negativePolicy selects the empty results the negative cache holds
+type negativePolicy struct {
+	ttl time.Duration
+	// shapes holds the fingerprints of NegativeCacheConfig.Queries; nil
+	// matches every read
+	shapes map[string]bool
+}
+
+func newResultCache(config *ResultCacheConfig, negative *NegativeCacheConfig) *resultCache {
+	if config == nil && negative == nil {
+		return nil
+	}
+	c := &resultCache{
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+		waiters: make(map[string][]func(*QueryResponse, error)),
+	}
+	if config != nil {
+		c.positive = true
+		c.ttl = config.TTL
+		c.stale = config.StaleWhileRevalidate
+		c.maxEntries = config.MaxEntries
+	}
+	if c.ttl <= 0 {
+		c.ttl = DefaultResultCacheTTL
+	}
+	if c.maxEntries <= 0 {
+		c.maxEntries = DefaultResultCacheMaxEntries
+	}
+	if config != nil {
+		c.adaptive = newAdaptiveTTL(config.Adaptive, c.maxEntries)
+	}
+	if negative != nil {
+		c.negative = &negativePolicy{ttl: negative.TTL}
+		if c.negative.ttl <= 0 {
+			c.negative.ttl = DefaultNegativeCacheTTL
+		}
+		if len(negative.Queries) > 0 {
+			c.negative.shapes = make(map[string]bool, len(negative.Queries))
+			for _, sql := range negative.Queries {
+				c.negative.shapes[Fingerprint(sql)] = true
+			}
+		}
+	}
+	return c
+}
+
+// applies reports whether the negative cache holds response, an empty
+// result of sql
+func (p *negativePolicy) applies(sql string, response *QueryResponse) bool {
+	if p == nil || len(response.Data) > 0 {
+		return false
+	}
+	return p.shapes == nil || p.shapes[Fingerprint(sql)]
+}
+
+// cacheKey returns the key for a /query request, or "" if its result must
+// not be cached: writes, strongly consistent reads and bypassed queries
+func (c *resultCache) cacheKey(ctx context.Context, request map[string]interface{}) string {
+	if c == nil {
+		return ""
+	}
+	if hints, ok := request["hints"].(map[string]interface{}); ok && hints["consistency"] == string(ConsistencyStrong) {
+		return ""
+	}
+	if hint, ok := request["cache"].(map[string]interface{}); ok && hint["bypass"] == true {
+		return ""
+	}
+	return readKey(ctx, request)
+}
+
+// readKey identifies a read-only /query request by its normalized SQL,
+// params, hints and target endpoint. It returns "" for statements that may
+// write.
+func readKey(ctx context.Context, request map[string]interface{}) string {
+	if request["mode"] == "exec" {
+		return ""
+	}
+	sql, _ := request["sql"].(string)
+	if !isReadStatement(sql) {
+		return ""
+	}
+
+	keyed := make(map[string]interface{}, len(request))
+	for k, v := range request {
+		if k != "cache" {
+			keyed[k] = v
+		}
+	}
+	keyed["sql"] = strings.TrimSpace(fingerprintSpace.ReplaceAllString(sql, " "))
+	key, err := json.Marshal(keyed)
+	if err != nil {
+		return ""
+	}
+	if endpoint, ok := ctx.Value(endpointKey{}).(string); ok {
+		// Results of different shards are different results
+		return endpoint + " " + string(key)
+	}
+	return string(key)
+}
+
+// get returns a copy of the cached result for key. refresh is true for a
+// stale result the caller must refresh; only one caller gets it per entry.
+// A stale-while-revalidate read gets expired results of any age, and
+// waits for a refresh already running with its callback.
+func (c *resultCache) get(key string, read *staleRead) (response *QueryResponse, refresh bool, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, found := c.entries[key]
+	if !found {
+		c.misses++
+		return nil, false, false
+	}
+	entry := el.Value.(*resultEntry)
+	now := time.Now()
+	stale := c.stale
+	if entry.negative {
+		stale = 0
+	}
+	switch {
+	case now.Before(entry.expires):
+		c.hits++
+		if entry.negative {
+			c.negativeHits++
+		}
+	case now.Before(entry.expires.Add(stale)) || (read != nil && !entry.negative):
+		c.staleHits++
+		if !entry.refreshing {
+			entry.refreshing = true
+			refresh = true
+		} else if read != nil && read.onFresh != nil {
+			c.waiters[key] = append(c.waiters[key], read.onFresh)
+		}
+	default:
+		c.remove(el)
+		c.misses++
+		return nil, false, false
+	}
+	c.lru.MoveToFront(el)
+	response = cloneResponse(entry.response)
+	response.Stale = !now.Before(entry.expires)
+	return response, refresh, true
+}
+
+func (c *resultCache) currentGeneration() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// put stores a copy of response under key, unless the cache was
+// invalidated since generation. It reports whether it stored the result.
+func (c *resultCache) put(key string, generation uint64, request map[string]interface{}, response *QueryResponse) bool {
+	if response.Offline {
+		// Offline results must not outlive the outage
+		return false
+	}
+	sql, _ := request["sql"].(string)
+	negative := c.negative.applies(sql, response)
+	ttl, ok := c.adaptive.ttl(sql, response, c.ttl)
+	if negative {
+		ttl = c.negative.ttl
+	} else if !c.positive {
+		return false
+	}
+	if hint, hinted := request["cache"].(map[string]interface{}); hinted {
+		if ms, hinted := hint["ttlMs"].(int64); hinted && ms > 0 {
+			ttl, ok = time.Duration(ms)*time.Millisecond, true
+		}
+	}
+	if !ok {
+		return false
+	}
+	entry := &resultEntry{
+		key:      key,
+		response: cloneResponse(response),
+		tables:   statementTables(sql),
+		expires:  time.Now().Add(ttl),
+		negative: negative,
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return false
+	}
+	if el, found := c.entries[key]; found {
+		el.Value = entry
+		c.lru.MoveToFront(el)
+		return true
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.maxEntries {
+		c.remove(c.lru.Back())
+		c.evictions++
+	}
+	return true
+}
+
+// refreshFailed lets a later reader retry refreshing a stale entry
+func (c *resultCache) refreshFailed(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, found := c.entries[key]; found {
+		el.Value.(*resultEntry).refreshing = false
+	}
+}
+
+// takeWaiters returns and forgets the callbacks waiting for the refresh of
+// key
+func (c *resultCache) takeWaiters(key string) []func(*QueryResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	waiters := c.waiters[key]
+	delete(c.waiters, key)
+	return waiters
+}
+
+// remove drops el. c.mu must be held.
+func (c *resultCache) remove(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*resultEntry).key)
+}
+
+// invalidate drops results reading any of tables, or every result if
+// tables is empty
+func (c *resultCache) invalidate(tables []string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	for el := c.lru.Front(); el != nil; {
+		next := el.Next()
+		entry := el.Value.(*resultEntry)
+		if len(tables) == 0 || len(entry.tables) == 0 || sharesTable(entry.tables, tables) {
+			c.remove(el)
+		}
+		el = next
+	}
+}
+
+// observe drops the results a successful statement may have changed
+func (c *resultCache) observe(sql string) {
+	if c == nil || isReadStatement(sql) {
+		return
+	}
+	tables := statementTables(sql)
+	c.adaptive.write(tables)
+	c.invalidate(tables)
+}
+
+func (c *resultCache) stats() ResultCacheStats {
+	if c == nil {
+		return ResultCacheStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return ResultCacheStats{
+		Hits:         c.hits,
+		StaleHits:    c.staleHits,
+		NegativeHits: c.negativeHits,
+		Misses:       c.misses,
+		Evictions:    c.evictions,
+		Entries:      c.lru.Len(),
+	}
+}
+
+// cachedQuery serves request from the result cache when possible, calling
+// fetch on a miss. Stale results are returned while fetch refreshes them
+// in the background, detached from ctx's cancellation.
+func (c *Client) cachedQuery(ctx context.Context, request map[string]interface{}, fetch func(context.Context) (*QueryResponse, error)) (*QueryResponse, error) {
+	key := c.results.cacheKey(ctx, request)
+	if key == "" {
+		return fetch(ctx)
+	}
+
+	sql, _ := request["sql"].(string)
+	c.results.adaptive.read(sql)
+	generation := c.results.currentGeneration()
+	read := staleReadFrom(ctx)
+	if response, refresh, ok := c.results.get(key, read); ok {
+		if refresh {
+			go func() {
+				fresh, err := fetch(context.WithoutCancel(ctx))
+				if err != nil || !fresh.Success || !c.results.put(key, generation, request, fresh) {
+					c.results.refreshFailed(key)
+				}
+				waiters := c.results.takeWaiters(key)
+				if read != nil && read.onFresh != nil {
+					waiters = append(waiters, read.onFresh)
+				}
+				for _, onFresh := range waiters {
+					if err != nil {
+						onFresh(nil, err)
+					} else {
+						onFresh(cloneResponse(fresh), nil)
+					}
+				}
+			}()
+		}
+		return response, nil
+	}
+
+	response, err := fetch(ctx)
+	if err == nil && response.Success {
+		c.results.put(key, generation, request, response)
+	}
+	return response, err
+}
+
+// ResultCacheStats returns counters of the client-side result cache, all
+// zero when neither Config.ResultCache nor Config.NegativeCache is set
+func (c *Client) ResultCacheStats() ResultCacheStats {
+	return c.results.stats()
+}
+
+// isReadStatement reports whether sql only reads. Locking reads (FOR
+// UPDATE, FOR SHARE, LOCK IN SHARE MODE) don't count, and a WITH statement
+// is classified by the statement following its common table expressions.
+func isReadStatement(sql string) bool {
+	tokens := sqlTokens(sql)
+	if len(tokens) == 0 {
+		return false
+	}
+	switch strings.ToUpper(tokens[0]) {
+	case "WITH":
+		if withStatementVerb(sql) != "SELECT" {
+			return false
+		}
+	case "SELECT", "SHOW", "DESCRIBE", "DESC", "EXPLAIN":
+	default:
+		return false
+	}
+	return !lockingClause.MatchString(sql)
+}
+
+// withStatementVerb returns the verb of the statement a WITH clause
+// introduces: the first SELECT, INSERT, UPDATE, DELETE or REPLACE outside
+// parentheses, string literals and comments, or "" if there is none
+func withStatementVerb(sql string) string {
+	depth := 0
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			i++
+			for i < len(sql) && sql[i] != c {
+				if sql[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			i++
+		case strings.HasPrefix(sql[i:], "--") || c == '#':
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				return ""
+			}
+			i += end + 1
+		case strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i:], "*/")
+			if end < 0 {
+				return ""
+			}
+			i += end + 2
+		case c == '(':
+			depth++
+			i++
+		case c == ')':
+			depth--
+			i++
+		case isWordByte(c):
+			start := i
+			for i < len(sql) && (isWordByte(sql[i]) || isDigit(sql[i])) {
+				i++
+			}
+			if depth > 0 {
+				continue
+			}
+			switch word := strings.ToUpper(sql[start:i]); word {
+			case "SELECT", "INSERT", "UPDATE", "DELETE", "REPLACE":
+				return word
+			}
+		default:
+			i++
+		}
+	}
+	return ""
+}
+
+// statementTables returns every table sql reads or writes that can be
+// found, normalized
+func statementTables(sql string) []string {
+	var tables []string
+	for _, m := range statementTableRe.FindAllStringSubmatch(sql, -1) {
+		tables = append(tables, normalizeTableName(m[1]))
+	}
+	return tables
+}
+
+func sharesTable(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cloneResponse copies response and its rows so callers can't modify cached
+// data
+func cloneResponse(response *QueryResponse) *QueryResponse {
+	clone := *response
+	if response.Data != nil {
+		clone.Data = make([]map[string]interface{}, len(response.Data))
+		for i, row := range response.Data {
+			copied := make(map[string]interface{}, len(row))
+			for k, v := range row {
+				copied[k] = v
+			}
+			clone.Data[i] = copied
+		}
+	}
+	return &clone
+}
@@ -0,0 +1,66 @@
+package workersql
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+const (
+	regionHeader   = "X-WorkerSQL-Region"
+	shardKeyHeader = "X-WorkerSQL-Shard-Key"
+	// shardHeader names the shard that ran a query in responses
+	shardHeader = "X-WorkerSQL-Shard"
+)
+
+type shardKeyKey struct{}
+
+// WithRegion pins queries made with ctx to a region or colo, such as
+// "weur" or "LHR", for latency-sensitive callers. The gateway and the edge
+// in front of it read the X-WorkerSQL-Region header.
+func WithRegion(ctx context.Context, region string) context.Context {
+	h := http.Header{}
+	h.Set(regionHeader, region)
+	return withRequestHeaders(ctx, h)
+}
+
+// WithShardKey routes queries made with ctx by key, sent as the
+// X-WorkerSQL-Shard-Key header and as the shardKey query hint. It takes
+// precedence over a key extracted with Config.Sharding.
+func WithShardKey(ctx context.Context, key string) context.Context {
+	h := http.Header{}
+	h.Set(shardKeyHeader, key)
+	return withRequestHeaders(context.WithValue(ctx, shardKeyKey{}, key), h)
+}
+
+// applyContextShardKey adds the shard key attached to ctx to the query
+// hints, unless the request has one already
+func applyContextShardKey(ctx context.Context, request map[string]interface{}) {
+	key, ok := ctx.Value(shardKeyKey{}).(string)
+	if !ok {
+		return
+	}
+	hints, _ := request["hints"].(map[string]interface{})
+	if hints == nil {
+		hints = make(map[string]interface{})
+		request["hints"] = hints
+	}
+	if hints["shardKey"] == nil {
+		hints["shardKey"] = key
+	}
+}
+
+// servedRegion returns the region that answered a request: the gateway's
+// X-WorkerSQL-Region response header, or else the Cloudflare colo at the
+// end of the CF-Ray header
+func servedRegion(h http.Header) string {
+	if region := h.Get(regionHeader); region != "" {
+		return region
+	}
+	if ray := h.Get("CF-Ray"); ray != "" {
+		if i := strings.LastIndexByte(ray, '-'); i >= 0 {
+			return ray[i+1:]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,426 @@
+package workersql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RoutingKey extracts the shard key of a statement: the value its table's
+// shard key column is compared with for equality. It understands
+//
+//	SELECT ... FROM t [alias] [JOIN ...] WHERE ... AND [alias.]key = value ...
+//	UPDATE t SET ... WHERE ...
+//	DELETE FROM t WHERE ...
+//	INSERT INTO t (..., key, ...) VALUES (..., value, ...)
+//
+// where value is a placeholder, a string or a number, `key IN (value)` with
+// one value counts as equality, and multi-row inserts need every row to
+// share the key. Conditions combined with OR at the top level of the WHERE
+// clause don't pin a shard, so no key is returned for them.
+func (s *ShardingConfig) RoutingKey(sql string, params ...interface{}) (table, key string, ok bool) {
+	tokens := lexSQL(sql)
+	if len(tokens) == 0 {
+		return "", "", false
+	}
+	table, alias := statementTarget(tokens)
+	if table == "" {
+		return "", "", false
+	}
+	column := s.ShardKeyColumn(table)
+	if column == "" {
+		return table, "", false
+	}
+
+	var value *sqlToken
+	if strings.EqualFold(tokens[0].text, "INSERT") || strings.EqualFold(tokens[0].text, "REPLACE") {
+		value = insertedKey(tokens, column)
+	} else {
+		value = whereKey(tokens, column, table, alias)
+	}
+	if value == nil {
+		return table, "", false
+	}
+	key, ok = value.resolve(params)
+	return table, key, ok
+}
+
+type sqlTokenKind int
+
+const (
+	tokenWord sqlTokenKind = iota
+	tokenString
+	tokenNumber
+	tokenPlaceholder
+	tokenSymbol
+)
+
+type sqlToken struct {
+	kind sqlTokenKind
+	text string
+	// param is the index of a placeholder among the statement's params
+	param int
+}
+
+// resolve returns the value of a literal or bound placeholder as the key
+// string the gateway hashes
+func (t *sqlToken) resolve(params []interface{}) (string, bool) {
+	switch t.kind {
+	case tokenString, tokenNumber:
+		return t.text, true
+	case tokenPlaceholder:
+		if t.param >= len(params) {
+			return "", false
+		}
+		switch v := params[t.param].(type) {
+		case nil:
+			return "", false
+		case []byte:
+			return string(v), true
+		default:
+			return fmt.Sprint(v), true
+		}
+	}
+	return "", false
+}
+
+func (t *sqlToken) is(text string) bool {
+	return (t.kind == tokenWord || t.kind == tokenSymbol) && strings.EqualFold(t.text, text)
+}
+
+func (t *sqlToken) isValue() bool {
+	return t.kind == tokenString || t.kind == tokenNumber || t.kind == tokenPlaceholder
+}
+
+// lexSQL splits sql into words (identifiers, with backticks removed, and
+// keywords), string and number literals, placeholders and symbols,
+// skipping comments
+func lexSQL(sql string) []sqlToken {
+	var tokens []sqlToken
+	params := 0
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case strings.HasPrefix(sql[i:], "--") || c == '#':
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				return tokens
+			}
+			i += end + 1
+		case strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				return tokens
+			}
+			i += end + 4
+		case c == '\'' || c == '"':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(sql); j++ {
+				if sql[j] == '\\' && j+1 < len(sql) {
+					j++
+					b.WriteByte(sql[j])
+					continue
+				}
+				if sql[j] == c {
+					if j+1 < len(sql) && sql[j+1] == c {
+						// Doubled quote
+						j++
+						b.WriteByte(c)
+						continue
+					}
+					break
+				}
+				b.WriteByte(sql[j])
+			}
+			tokens = append(tokens, sqlToken{kind: tokenString, text: b.String()})
+			i = j + 1
+		case c == '`':
+			end := strings.IndexByte(sql[i+1:], '`')
+			if end < 0 {
+				return tokens
+			}
+			tokens = append(tokens, sqlToken{kind: tokenWord, text: sql[i+1 : i+1+end]})
+			i += end + 2
+		case c == '?':
+			tokens = append(tokens, sqlToken{kind: tokenPlaceholder, text: "?", param: params})
+			params++
+			i++
+		case isDigit(c) || (c == '-' && i+1 < len(sql) && isDigit(sql[i+1]) && !followsOperand(tokens)):
+			j := i + 1
+			for j < len(sql) && (isDigit(sql[j]) || sql[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, sqlToken{kind: tokenNumber, text: sql[i:j]})
+			i = j
+		case isWordByte(c):
+			j := i + 1
+			for j < len(sql) && (isWordByte(sql[j]) || isDigit(sql[j])) {
+				j++
+			}
+			tokens = append(tokens, sqlToken{kind: tokenWord, text: sql[i:j]})
+			i = j
+		default:
+			j := i + 1
+			if j < len(sql) && ((strings.IndexByte("<>=!", c) >= 0 && strings.IndexByte("<>=", sql[j]) >= 0) || (c == '|' && sql[j] == '|')) {
+				j++
+			}
+			tokens = append(tokens, sqlToken{kind: tokenSymbol, text: sql[i:j]})
+			i = j
+		}
+	}
+	return tokens
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || c == '@' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+// followsOperand reports whether a '-' after tokens is a binary minus
+func followsOperand(tokens []sqlToken) bool {
+	if len(tokens) == 0 {
+		return false
+	}
+	last := tokens[len(tokens)-1]
+	return last.kind != tokenSymbol || last.text == ")"
+}
+
+// statementTarget returns the table a statement reads or writes first and
+// its alias
+func statementTarget(tokens []sqlToken) (table, alias string) {
+	depth := 0
+	for i := 0; i+1 < len(tokens); i++ {
+		t := tokens[i]
+		switch {
+		case t.is("("):
+			depth++
+		case t.is(")"):
+			depth--
+		}
+		if depth != 0 || !(t.is("FROM") || t.is("INTO") || (i == 0 && t.is("UPDATE"))) {
+			continue
+		}
+		j := i + 1
+		if tokens[j].kind != tokenWord {
+			return "", ""
+		}
+		table = tokens[j].text
+		// Qualified names: db.table
+		for j+2 < len(tokens) && tokens[j+1].is(".") && tokens[j+2].kind == tokenWord {
+			j += 2
+			table = tokens[j].text
+		}
+		j++
+		if j < len(tokens) && tokens[j].is("AS") {
+			j++
+		}
+		if j < len(tokens) && tokens[j].kind == tokenWord && !isClauseKeyword(tokens[j].text) {
+			alias = tokens[j].text
+		}
+		return normalizeTableName(table), alias
+	}
+	return "", ""
+}
+
+func isClauseKeyword(word string) bool {
+	switch strings.ToUpper(word) {
+	case "WHERE", "SET", "JOIN", "INNER", "LEFT", "RIGHT", "CROSS", "STRAIGHT_JOIN", "NATURAL",
+		"ON", "USING", "GROUP", "ORDER", "LIMIT", "HAVING", "UNION", "FOR", "VALUES", "VALUE",
+		"SELECT", "LOCK", "WINDOW", "PARTITION", "USE", "FORCE", "IGNORE":
+		return true
+	}
+	return false
+}
+
+// whereKey finds the value compared with column in the top-level AND
+// conditions of the WHERE clause
+func whereKey(tokens []sqlToken, column, table, alias string) *sqlToken {
+	start := -1
+	depth := 0
+	for i, t := range tokens {
+		switch {
+		case t.is("("):
+			depth++
+		case t.is(")"):
+			depth--
+		case depth == 0 && t.is("WHERE"):
+			start = i + 1
+		}
+		if start >= 0 {
+			break
+		}
+	}
+	if start < 0 {
+		return nil
+	}
+
+	end := len(tokens)
+	for i := start; i < len(tokens); i++ {
+		t := tokens[i]
+		switch {
+		case t.is("("):
+			depth++
+		case t.is(")"):
+			depth--
+		case depth == 0 && (t.is("GROUP") || t.is("ORDER") || t.is("LIMIT") || t.is("HAVING") ||
+			t.is("UNION") || t.is("FOR") || t.is("LOCK") || t.is("WINDOW") || t.is(";")):
+			end = i
+		case depth == 0 && (t.is("OR") || t.is("||") || t.is("XOR")):
+			return nil
+		}
+		if end < len(tokens) {
+			break
+		}
+	}
+
+	var found *sqlToken
+	cond := tokens[start:end]
+	for i := 0; i < len(cond); i++ {
+		// Skip nested conditions; only top-level ones pin the whole statement
+		if cond[i].is("(") {
+			depth := 1
+			for i++; i < len(cond) && depth > 0; i++ {
+				if cond[i].is("(") {
+					depth++
+				} else if cond[i].is(")") {
+					depth--
+				}
+			}
+			i--
+			continue
+		}
+		if i > 0 && cond[i-1].is(".") {
+			continue
+		}
+		n := columnRef(cond[i:], column, table, alias)
+		if n == 0 {
+			continue
+		}
+		rest := cond[i+n:]
+		var value *sqlToken
+		switch {
+		case len(rest) >= 2 && (rest[0].is("=") || rest[0].is("<=>")) && rest[1].isValue():
+			value = &rest[1]
+		case len(rest) >= 4 && rest[0].is("IN") && rest[1].is("(") && rest[2].isValue() && rest[3].is(")"):
+			value = &rest[2]
+		}
+		if value == nil && i >= 2 && cond[i-1].is("=") && cond[i-2].isValue() {
+			// value = key
+			value = &cond[i-2]
+		}
+		if value != nil {
+			if found != nil && !sameValue(found, value) {
+				return nil
+			}
+			found = value
+		}
+		i += n - 1
+	}
+	return found
+}
+
+// columnRef returns how many tokens at the start of tokens refer to column,
+// possibly qualified by the table or its alias, or 0
+func columnRef(tokens []sqlToken, column, table, alias string) int {
+	if len(tokens) >= 3 && tokens[0].kind == tokenWord && tokens[1].is(".") && tokens[2].kind == tokenWord {
+		q := tokens[0].text
+		if !strings.EqualFold(tokens[2].text, column) {
+			return 0
+		}
+		if strings.EqualFold(q, table) || (alias != "" && strings.EqualFold(q, alias)) {
+			return 3
+		}
+		return 0
+	}
+	if tokens[0].kind == tokenWord && strings.EqualFold(tokens[0].text, column) {
+		if len(tokens) > 1 && tokens[1].is(".") {
+			return 0
+		}
+		return 1
+	}
+	return 0
+}
+
+func sameValue(a, b *sqlToken) bool {
+	if a.kind == tokenPlaceholder || b.kind == tokenPlaceholder {
+		return a.kind == b.kind && a.param == b.param
+	}
+	return a.text == b.text
+}
+
+// insertedKey finds the value inserted into column, which must be the same
+// in every row
+func insertedKey(tokens []sqlToken, column string) *sqlToken {
+	i := 0
+	for i < len(tokens) && !tokens[i].is("(") {
+		if tokens[i].is("VALUES") || tokens[i].is("VALUE") || tokens[i].is("SELECT") || tokens[i].is("SET") {
+			return nil
+		}
+		i++
+	}
+	// Column list
+	pos := -1
+	n := 0
+	for i++; i < len(tokens) && !tokens[i].is(")"); i++ {
+		switch {
+		case tokens[i].is(","):
+			n++
+		case tokens[i].kind == tokenWord && strings.EqualFold(tokens[i].text, column):
+			pos = n
+		}
+	}
+	if pos < 0 || i >= len(tokens) {
+		return nil
+	}
+	i++
+	if i >= len(tokens) || !(tokens[i].is("VALUES") || tokens[i].is("VALUE")) {
+		return nil
+	}
+
+	var found *sqlToken
+	for i++; i < len(tokens) && tokens[i].is("("); {
+		// One row: the value at pos must be a single literal or placeholder
+		field, depth := 0, 0
+		var value *sqlToken
+		size := 0
+		for i++; i < len(tokens); i++ {
+			t := &tokens[i]
+			if depth == 0 && (t.is(",") || t.is(")")) {
+				if field == pos && size != 1 {
+					value = nil
+				}
+				if t.is(")") {
+					break
+				}
+				field++
+				size = 0
+				continue
+			}
+			if t.is("(") {
+				depth++
+			} else if t.is(")") {
+				depth--
+			}
+			if field == pos {
+				size++
+				if size == 1 && t.isValue() {
+					value = t
+				} else {
+					value = nil
+				}
+			}
+		}
+		if value == nil || (found != nil && !sameValue(found, value)) {
+			return nil
+		}
+		found = value
+		i++
+		if i < len(tokens) && tokens[i].is(",") {
+			i++
+		}
+	}
+	return found
+}
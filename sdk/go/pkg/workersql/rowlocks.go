@@ -0,0 +1,94 @@
+package workersql
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/healthfees-org/workersql/sdk/go/internal/websocket"
+)
+
+// LockMode selects the locking clause of a locking read. Combine a
+// strength with at most one wait policy, e.g. LockForUpdate|LockSkipLocked.
+type LockMode uint8
+
+const (
+	// LockForUpdate takes exclusive locks on the rows read (FOR UPDATE)
+	LockForUpdate LockMode = 1 << iota
+	// LockForShare takes shared locks on the rows read (FOR SHARE), letting
+	// other transactions read but not change them
+	LockForShare
+	// LockNoWait fails with ErrLockNotAvailable instead of waiting when a
+	// row is locked (NOWAIT)
+	LockNoWait
+	// LockSkipLocked leaves locked rows out of the result instead of
+	// waiting (SKIP LOCKED), for work queues
+	LockSkipLocked
+)
+
+// lockingClause matches a locking clause already ending a statement
+var lockingClause = regexp.MustCompile(`(?i)\b(?:FOR\s+(?:UPDATE|SHARE)|LOCK\s+IN\s+SHARE\s+MODE)\b`)
+
+// clause returns the SQL locking clause of m
+func (m LockMode) clause() (string, error) {
+	var parts []string
+	switch m & (LockForUpdate | LockForShare) {
+	case LockForUpdate, 0:
+		parts = append(parts, "FOR UPDATE")
+	case LockForShare:
+		parts = append(parts, "FOR SHARE")
+	default:
+		return "", fmt.Errorf("lock mode can't be both FOR UPDATE and FOR SHARE")
+	}
+	switch m & (LockNoWait | LockSkipLocked) {
+	case LockNoWait:
+		parts = append(parts, "NOWAIT")
+	case LockSkipLocked:
+		parts = append(parts, "SKIP LOCKED")
+	case LockNoWait | LockSkipLocked:
+		return "", fmt.Errorf("lock mode can't be both NOWAIT and SKIP LOCKED")
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// lockedStatement appends the locking clause of mode to the SELECT sql
+func lockedStatement(sql string, mode LockMode) (string, error) {
+	clause, err := mode.clause()
+	if err != nil {
+		return "", err
+	}
+	sql = strings.TrimRight(strings.TrimSpace(sql), ";")
+	if !strings.EqualFold(firstKeyword(sql), "SELECT") {
+		return "", fmt.Errorf("locking reads need a SELECT statement")
+	}
+	if lockingClause.MatchString(sql) {
+		return "", fmt.Errorf("statement already has a locking clause")
+	}
+	return sql + " " + clause, nil
+}
+
+// QueryForUpdate runs the SELECT sql with FOR UPDATE, locking the rows it
+// reads until the transaction ends
+func (tx *TransactionClient) QueryForUpdate(ctx context.Context, sql string, params ...interface{}) (*QueryResponse, error) {
+	return tx.QueryLocked(ctx, LockForUpdate, sql, params...)
+}
+
+// QueryLocked runs the SELECT sql with the locking clause of mode. A read
+// the server failed is returned as an error keeping its code: with
+// LockNoWait, rows locked by another transaction fail it with an error
+// matching ErrLockNotAvailable.
+func (tx *TransactionClient) QueryLocked(ctx context.Context, mode LockMode, sql string, params ...interface{}) (*QueryResponse, error) {
+	locked, err := lockedStatement(sql, mode)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := tx.Query(ctx, locked, params...)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Success && resp.Error != nil {
+		return nil, &websocket.ServerError{Code: resp.Error.Code, Message: resp.Error.Message}
+	}
+	return resp, nil
+}
@@ -0,0 +1,371 @@
+package workersql
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultRowPipelineBatchSize is the number of rows a RowPipeline hands
+// its sink at once
+const DefaultRowPipelineBatchSize = 500
+
+// RowSource feeds a RowPipeline: it calls emit with each row in order and
+// returns once it has none left. emit blocks while the stages after it are
+// busy, and returns an error once the pipeline has failed, which the source
+// should return.
+type RowSource func(ctx context.Context, emit func(row map[string]interface{}) error) error
+
+// RowSink receives the rows coming out of a RowPipeline, a batch at a time,
+// from a single goroutine
+type RowSink interface {
+	WriteRows(ctx context.Context, rows []map[string]interface{}) error
+}
+
+// RowSinkFunc adapts a function to a RowSink
+type RowSinkFunc func(ctx context.Context, rows []map[string]interface{}) error
+
+// WriteRows calls f
+func (f RowSinkFunc) WriteRows(ctx context.Context, rows []map[string]interface{}) error {
+	return f(ctx, rows)
+}
+
+// RowPipeline streams rows from a source through map, filter and batch stages
+// into a sink. Each stage runs in its own goroutine connected to the next
+// by a small buffer, so a slow stage or sink holds back the source rather
+// than rows piling up in memory. Rows keep their order, including through
+// concurrent Map stages.
+//
+//	p := workersql.NewRowPipeline(workersql.PaginatorSource(src.Paginate("SELECT * FROM users", workersql.PageOptions{Size: 1000})))
+//	p.Filter(func(row map[string]interface{}) bool { return row["deleted_at"] == nil })
+//	p.Map(8, func(ctx context.Context, row map[string]interface{}) (map[string]interface{}, error) {
+//		row["email"] = strings.ToLower(row["email"].(string))
+//		return row, nil
+//	})
+//	result, err := p.Run(ctx, workersql.BulkInsertSink(dst, "users", workersql.BulkOptions{OnConflict: workersql.ConflictIgnore}))
+type RowPipeline struct {
+	source    RowSource
+	stages    []rowStage
+	batchSize int
+}
+
+// RowPipelineResult counts the rows of a pipeline run
+type RowPipelineResult struct {
+	// Read is the number of rows the source emitted
+	Read int64
+	// Dropped is the number of rows removed by Filter and Map stages
+	Dropped int64
+	// Written is the number of rows the sink accepted
+	Written int64
+}
+
+// rowStage reads rows from in until it is closed and sends its output
+// to out; the pipeline closes out when it returns
+type rowStage func(ctx context.Context, in <-chan map[string]interface{}, out chan<- map[string]interface{}, result *RowPipelineResult) error
+
+// NewRowPipeline returns a pipeline reading from source
+func NewRowPipeline(source RowSource) *RowPipeline {
+	return &RowPipeline{source: source, batchSize: DefaultRowPipelineBatchSize}
+}
+
+// SinkBatchSize sets the number of rows handed to the sink at once
+// (default: 500). The last batch may be smaller.
+func (p *RowPipeline) SinkBatchSize(size int) *RowPipeline {
+	if size > 0 {
+		p.batchSize = size
+	}
+	return p
+}
+
+// Filter adds a stage keeping the rows keep returns true for
+func (p *RowPipeline) Filter(keep func(row map[string]interface{}) bool) *RowPipeline {
+	p.stages = append(p.stages, func(ctx context.Context, in <-chan map[string]interface{}, out chan<- map[string]interface{}, result *RowPipelineResult) error {
+		for row := range in {
+			if !keep(row) {
+				atomic.AddInt64(&result.Dropped, 1)
+				continue
+			}
+			if err := sendRow(ctx, out, row); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return p
+}
+
+// Map adds a stage replacing each row with the one fn returns, calling fn
+// on up to concurrency rows at a time (at least 1). A nil row drops the row.
+// Rows leave the stage in the order they entered it.
+func (p *RowPipeline) Map(concurrency int, fn func(ctx context.Context, row map[string]interface{}) (map[string]interface{}, error)) *RowPipeline {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	p.stages = append(p.stages, func(ctx context.Context, in <-chan map[string]interface{}, out chan<- map[string]interface{}, result *RowPipelineResult) error {
+		type mapped struct {
+			row map[string]interface{}
+			err error
+		}
+		ctx, cancel := context.WithCancel(ctx)
+		var wg sync.WaitGroup
+		defer wg.Wait()
+		defer cancel()
+
+		// pending holds the results in input order; its capacity and the
+		// semaphore bound the rows in flight
+		pending := make(chan chan mapped, concurrency)
+		sem := make(chan struct{}, concurrency)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(pending)
+			for {
+				var row map[string]interface{}
+				var ok bool
+				select {
+				case row, ok = <-in:
+					if !ok {
+						return
+					}
+				case <-ctx.Done():
+					return
+				}
+				select {
+				case sem <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+				done := make(chan mapped, 1)
+				select {
+				case pending <- done:
+				case <-ctx.Done():
+					<-sem
+					return
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer func() { <-sem }()
+					row, err := fn(ctx, row)
+					done <- mapped{row, err}
+				}()
+			}
+		}()
+
+		for done := range pending {
+			var m mapped
+			select {
+			case m = <-done:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			if m.err != nil {
+				return m.err
+			}
+			if m.row == nil {
+				atomic.AddInt64(&result.Dropped, 1)
+				continue
+			}
+			if err := sendRow(ctx, out, m.row); err != nil {
+				return err
+			}
+		}
+		return ctx.Err()
+	})
+	return p
+}
+
+// Batch adds a stage calling fn with up to size rows at a time and passing
+// on the rows it returns, for work done more cheaply on many rows at once,
+// such as looking up related rows with one query. fn may return fewer or
+// more rows than it was given.
+func (p *RowPipeline) Batch(size int, fn func(ctx context.Context, rows []map[string]interface{}) ([]map[string]interface{}, error)) *RowPipeline {
+	if size < 1 {
+		size = 1
+	}
+	p.stages = append(p.stages, func(ctx context.Context, in <-chan map[string]interface{}, out chan<- map[string]interface{}, result *RowPipelineResult) error {
+		batch := make([]map[string]interface{}, 0, size)
+		flush := func() error {
+			rows, err := fn(ctx, batch)
+			if err != nil {
+				return err
+			}
+			if dropped := len(batch) - len(rows); dropped > 0 {
+				atomic.AddInt64(&result.Dropped, int64(dropped))
+			}
+			batch = make([]map[string]interface{}, 0, size)
+			for _, row := range rows {
+				if err := sendRow(ctx, out, row); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		for row := range in {
+			batch = append(batch, row)
+			if len(batch) == size {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+		if len(batch) > 0 && ctx.Err() == nil {
+			return flush()
+		}
+		return ctx.Err()
+	})
+	return p
+}
+
+// Run streams every row of the source through the stages into sink, and
+// returns once the sink has written the last batch. The first error of the
+// source, a stage or the sink stops the pipeline and is returned, with the
+// counts of the rows processed so far; batches the sink wrote before are
+// not undone.
+func (p *RowPipeline) Run(ctx context.Context, sink RowSink) (*RowPipelineResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	result := &RowPipelineResult{}
+	var (
+		once     sync.Once
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	fail := func(err error) {
+		if err != nil {
+			once.Do(func() {
+				firstErr = err
+				cancel()
+			})
+		}
+	}
+
+	source := make(chan map[string]interface{}, 1)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(source)
+		fail(p.source(ctx, func(row map[string]interface{}) error {
+			if err := sendRow(ctx, source, row); err != nil {
+				return err
+			}
+			atomic.AddInt64(&result.Read, 1)
+			return nil
+		}))
+	}()
+	in := (<-chan map[string]interface{})(source)
+	for _, stage := range p.stages {
+		out := make(chan map[string]interface{}, 1)
+		wg.Add(1)
+		go func(stage rowStage, in <-chan map[string]interface{}, out chan map[string]interface{}) {
+			defer wg.Done()
+			defer close(out)
+			fail(stage(ctx, in, out, result))
+		}(stage, in, out)
+		in = out
+	}
+
+	batch := make([]map[string]interface{}, 0, p.batchSize)
+	write := func() {
+		if err := sink.WriteRows(ctx, batch); err != nil {
+			fail(fmt.Errorf("row pipeline sink: %w", err))
+			return
+		}
+		atomic.AddInt64(&result.Written, int64(len(batch)))
+		batch = make([]map[string]interface{}, 0, p.batchSize)
+	}
+	for row := range in {
+		if ctx.Err() != nil {
+			continue // drain until the stages stop
+		}
+		batch = append(batch, row)
+		if len(batch) == p.batchSize {
+			write()
+		}
+	}
+	if len(batch) > 0 && ctx.Err() == nil {
+		write()
+	}
+	wg.Wait()
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	return result, firstErr
+}
+
+// sendRow sends row to out, unless ctx ends first
+func sendRow(ctx context.Context, out chan<- map[string]interface{}, row map[string]interface{}) error {
+	select {
+	case out <- row:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// PaginatorSource emits the rows of every remaining page of p
+func PaginatorSource(p *Paginator) RowSource {
+	return func(ctx context.Context, emit func(row map[string]interface{}) error) error {
+		for p.More() {
+			page, err := p.Next(ctx)
+			if err != nil {
+				return err
+			}
+			for _, row := range page.Data {
+				if err := emit(row); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// QuerySource emits the rows of a single query, for results small enough
+// to fetch at once; use PaginatorSource for large ones
+func QuerySource(q Querier, sql string, params ...interface{}) RowSource {
+	return func(ctx context.Context, emit func(row map[string]interface{}) error) error {
+		response, err := q.Query(ctx, sql, params...)
+		if err != nil {
+			return err
+		}
+		if err := response.failure(); err != nil {
+			return err
+		}
+		for _, row := range response.Data {
+			if err := emit(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// BulkInsertSink inserts the rows into table with BulkInsert, a batch at a
+// time
+func BulkInsertSink(c *Client, table string, opts BulkOptions) RowSink {
+	return RowSinkFunc(func(ctx context.Context, rows []map[string]interface{}) error {
+		_, err := c.BulkInsert(ctx, table, rows, opts)
+		return err
+	})
+}
+
+// ExportSink writes the rows to spec.Writer in spec.Format, as Export
+// does, with the CSV header first. spec.Columns sets the CSV columns
+// (default: the keys of the first row, sorted). Only Writer, Format,
+// Columns and NullValue are used.
+func ExportSink(spec ExportSpec) RowSink {
+	if spec.NullValue == "" {
+		spec.NullValue = `\N`
+	}
+	w := newExportWriter(spec, spec.Columns, true)
+	return RowSinkFunc(func(ctx context.Context, rows []map[string]interface{}) error {
+		for _, row := range rows {
+			if err := w.write(nil, row); err != nil {
+				return fmt.Errorf("export: %w", err)
+			}
+		}
+		return w.flush()
+	})
+}
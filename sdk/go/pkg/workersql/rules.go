@@ -0,0 +1,497 @@
+package workersql
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RuleKind is the check a validation Rule makes
+type RuleKind string
+
+const (
+	// RuleUnique requires the values of Columns to be unique, within each
+	// group of rows sharing the values of Scope
+	RuleUnique RuleKind = "unique"
+	// RuleReference requires the values of Columns to match a row of
+	// RefTable, as a foreign key would
+	RuleReference RuleKind = "reference"
+	// RuleRange requires the value of the single column in Columns to lie
+	// between Min and Max and be one of In
+	RuleRange RuleKind = "range"
+)
+
+// Rule is a declarative constraint on the rows of a table, for invariants
+// a sharded database can't enforce itself. Rules are kept as data in a
+// RuleSet, read from YAML or JSON:
+//
+//	rules:
+//	  - name: email-per-tenant
+//	    kind: unique
+//	    table: users
+//	    columns: [email]
+//	    scope: [tenant_id]
+//	  - kind: reference
+//	    table: orders
+//	    columns: [user_id]
+//	    ref_table: users
+//	    ref_columns: [id]
+//	  - kind: range
+//	    table: orders
+//	    columns: [total]
+//	    min: 0
+//	    not_null: true
+type Rule struct {
+	// Name identifies the rule in violations (default: derived from its
+	// kind, table and columns)
+	Name  string   `yaml:"name,omitempty" json:"name,omitempty"`
+	Kind  RuleKind `yaml:"kind" json:"kind"`
+	Table string   `yaml:"table" json:"table"`
+	// Columns are the columns checked; a range rule takes exactly one
+	Columns []string `yaml:"columns" json:"columns"`
+	// Scope makes a unique rule apply within each group of rows with the
+	// same values of these columns, such as email addresses per tenant
+	Scope []string `yaml:"scope,omitempty" json:"scope,omitempty"`
+	// RefTable and RefColumns are the rows a reference rule's Columns must
+	// match
+	RefTable   string   `yaml:"ref_table,omitempty" json:"ref_table,omitempty"`
+	RefColumns []string `yaml:"ref_columns,omitempty" json:"ref_columns,omitempty"`
+	// Min and Max bound a range rule's values, inclusive; nil leaves that
+	// end open. Numbers compare by value, times by instant.
+	Min interface{} `yaml:"min,omitempty" json:"min,omitempty"`
+	Max interface{} `yaml:"max,omitempty" json:"max,omitempty"`
+	// In lists the values a range rule allows (default: any)
+	In []interface{} `yaml:"in,omitempty" json:"in,omitempty"`
+	// NotNull makes a range rule reject NULL values, which otherwise pass
+	NotNull bool `yaml:"not_null,omitempty" json:"not_null,omitempty"`
+}
+
+// RuleSet is a set of validation rules, checked by CheckRules before
+// writes and by AuditRules against the stored rows
+type RuleSet struct {
+	Rules []Rule `yaml:"rules" json:"rules"`
+}
+
+// RuleViolation is a row, or set of rows, breaking a Rule
+type RuleViolation struct {
+	Rule  string
+	Kind  RuleKind
+	Table string
+	// Values holds the offending values by column: the rule's columns and
+	// scope, or the whole row for a range rule found by an audit
+	Values map[string]interface{}
+	// Count is the number of rows sharing the values of a unique rule
+	// found by an audit, and 1 otherwise
+	Count   int64
+	Message string
+}
+
+// ValidationReport is the outcome of AuditRules
+type ValidationReport struct {
+	// Rules lists the names of the rules checked
+	Rules      []string
+	Violations []RuleViolation
+	// Truncated is set when a rule had more than MaxViolations violations
+	Truncated bool
+	StartedAt time.Time
+	Duration  time.Duration
+}
+
+// Valid reports whether no violations were found
+func (r *ValidationReport) Valid() bool {
+	return len(r.Violations) == 0
+}
+
+// ValidationError reports the rules a row about to be written breaks. It
+// matches ErrConstraintViolation.
+type ValidationError struct {
+	Table      string
+	Violations []RuleViolation
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return fmt.Sprintf("%s: %s: %s", ErrConstraintViolation, e.Table, strings.Join(messages, "; "))
+}
+
+// Is reports whether target is ErrConstraintViolation
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrConstraintViolation
+}
+
+// ParseRules parses a rule set from YAML or JSON and validates it
+func ParseRules(data []byte) (*RuleSet, error) {
+	var rules RuleSet
+	if err := yaml.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("rules: %w", err)
+	}
+	if err := rules.Validate(); err != nil {
+		return nil, err
+	}
+	return &rules, nil
+}
+
+// LoadRules reads and parses the rule file at path
+func LoadRules(path string) (*RuleSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("rules: %w", err)
+	}
+	return ParseRules(data)
+}
+
+// Validate checks that every rule names a table and columns and has the
+// settings its kind needs
+func (s *RuleSet) Validate() error {
+	for i, r := range s.Rules {
+		if err := r.validate(); err != nil {
+			return fmt.Errorf("rules: rule %d (%s): %w", i+1, r.label(), err)
+		}
+	}
+	return nil
+}
+
+func (r *Rule) validate() error {
+	if r.Table == "" {
+		return fmt.Errorf("no table")
+	}
+	if len(r.Columns) == 0 {
+		return fmt.Errorf("no columns")
+	}
+	switch r.Kind {
+	case RuleUnique:
+	case RuleReference:
+		if r.RefTable == "" || len(r.RefColumns) != len(r.Columns) {
+			return fmt.Errorf("ref_table and as many ref_columns as columns are required")
+		}
+	case RuleRange:
+		if len(r.Columns) != 1 {
+			return fmt.Errorf("a range rule takes one column, not %d", len(r.Columns))
+		}
+		if r.Min == nil && r.Max == nil && len(r.In) == 0 && !r.NotNull {
+			return fmt.Errorf("a range rule needs min, max, in or not_null")
+		}
+	default:
+		return fmt.Errorf("unknown kind %q", r.Kind)
+	}
+	return nil
+}
+
+// label returns the rule's name, or a description of it
+func (r *Rule) label() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	label := fmt.Sprintf("%s %s%v", r.Kind, r.Table, r.Columns)
+	if len(r.Scope) > 0 {
+		label += fmt.Sprintf(" per %v", r.Scope)
+	}
+	return label
+}
+
+// rules returns the rules on table, or every rule if table is empty, and
+// only those on tables if any are given
+func (s *RuleSet) rules(table string, tables []string) []Rule {
+	var out []Rule
+	for _, r := range s.Rules {
+		if (table == "" || r.Table == table) && (len(tables) == 0 || containsString(tables, r.Table)) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// CheckRules checks row, about to be inserted into table, against the
+// rules on table and returns a *ValidationError listing every rule it
+// breaks. Unique and reference rules look up existing rows; rules on
+// columns missing from row, and unique and reference rules on NULL values,
+// are skipped. As with CheckInsert, a concurrent writer can slip in between
+// the check and the write, so audits remain necessary.
+func (c *Client) CheckRules(ctx context.Context, rules *RuleSet, table string, row map[string]interface{}) error {
+	var violations []RuleViolation
+	for _, r := range rules.rules(table, nil) {
+		if err := r.validate(); err != nil {
+			return fmt.Errorf("checking rule %s: %w", r.label(), err)
+		}
+		violation, err := c.checkRule(ctx, r, row)
+		if err != nil {
+			return fmt.Errorf("checking rule %s: %w", r.label(), err)
+		}
+		if violation != nil {
+			violations = append(violations, *violation)
+		}
+	}
+	if len(violations) > 0 {
+		return &ValidationError{Table: table, Violations: violations}
+	}
+	return nil
+}
+
+// checkRule checks row against one rule, returning its violation if any
+func (c *Client) checkRule(ctx context.Context, r Rule, row map[string]interface{}) (*RuleViolation, error) {
+	violation := func(columns []string, format string, args ...interface{}) *RuleViolation {
+		values := make(map[string]interface{}, len(columns))
+		for _, col := range columns {
+			values[col] = row[col]
+		}
+		message := r.label() + ": " + fmt.Sprintf(format, args...)
+		return &RuleViolation{Rule: r.label(), Kind: r.Kind, Table: r.Table, Values: values, Count: 1, Message: message}
+	}
+
+	switch r.Kind {
+	case RuleUnique:
+		columns := append(append([]string(nil), r.Scope...), r.Columns...)
+		values, ok := constraintValues(row, columns)
+		if !ok {
+			return nil, nil
+		}
+		exists, err := c.rowExists(ctx, r.Table, columns, values)
+		if err != nil || !exists {
+			return nil, err
+		}
+		return violation(columns, "%v = %v already exists", columns, values), nil
+	case RuleReference:
+		values, ok := constraintValues(row, r.Columns)
+		if !ok {
+			return nil, nil
+		}
+		exists, err := c.rowExists(ctx, r.RefTable, r.RefColumns, values)
+		if err != nil || exists {
+			return nil, err
+		}
+		return violation(r.Columns, "%v = %v has no matching row in %s", r.Columns, values, r.RefTable), nil
+	}
+
+	v, ok := row[r.Columns[0]]
+	if !ok {
+		return nil, nil
+	}
+	if message := r.rangeViolation(v); message != "" {
+		return violation(r.Columns, "%s", message), nil
+	}
+	return nil, nil
+}
+
+// rangeViolation describes how v breaks a range rule, or returns ""
+func (r *Rule) rangeViolation(v interface{}) string {
+	column := r.Columns[0]
+	if v == nil {
+		if r.NotNull {
+			return column + " is NULL"
+		}
+		return ""
+	}
+	if r.Min != nil && compareBound(v, r.Min) < 0 {
+		return fmt.Sprintf("%s = %v is below %v", column, v, r.Min)
+	}
+	if r.Max != nil && compareBound(v, r.Max) > 0 {
+		return fmt.Sprintf("%s = %v is above %v", column, v, r.Max)
+	}
+	if len(r.In) > 0 {
+		for _, allowed := range r.In {
+			if compareBound(v, allowed) == 0 {
+				return ""
+			}
+		}
+		return fmt.Sprintf("%s = %v is not one of %v", column, v, r.In)
+	}
+	return ""
+}
+
+// compareBound compares a row value with a bound of a range rule. A bound
+// written as a string compares as a time with a time value, and the
+// reverse.
+func compareBound(v, bound interface{}) int {
+	if t, ok := v.(time.Time); ok {
+		if b, ok := toTime(bound, t.Location()); ok {
+			return t.Compare(b)
+		}
+	}
+	if b, ok := bound.(time.Time); ok {
+		if t, ok := toTime(v, b.Location()); ok {
+			return t.Compare(b)
+		}
+	}
+	return compareValues(v, bound)
+}
+
+// AuditRules scans the stored rows for violations of every rule, or of
+// the rules on opts.Tables: duplicate values of unique rules, references
+// without a matching row (checked with CheckIntegrity), and values out of
+// range. Up to opts.MaxViolations violations are reported per rule;
+// opts.Graph and opts.Keys are ignored.
+func (c *Client) AuditRules(ctx context.Context, rules *RuleSet, opts IntegrityOptions) (*ValidationReport, error) {
+	if opts.MaxViolations <= 0 {
+		opts.MaxViolations = DefaultIntegrityMaxViolations
+	}
+	report := &ValidationReport{StartedAt: time.Now()}
+	defer func() { report.Duration = time.Since(report.StartedAt) }()
+
+	for _, r := range rules.rules("", opts.Tables) {
+		if err := r.validate(); err != nil {
+			return report, fmt.Errorf("auditing rule %s: %w", r.label(), err)
+		}
+		report.Rules = append(report.Rules, r.label())
+		var err error
+		switch r.Kind {
+		case RuleUnique:
+			err = c.auditUnique(ctx, r, opts, report)
+		case RuleReference:
+			err = c.auditReference(ctx, r, opts, report)
+		case RuleRange:
+			err = c.auditRange(ctx, r, opts, report)
+		}
+		if err != nil {
+			return report, fmt.Errorf("auditing rule %s: %w", r.label(), err)
+		}
+	}
+	return report, nil
+}
+
+// auditUnique finds groups of rows sharing the values of a unique rule
+func (c *Client) auditUnique(ctx context.Context, r Rule, opts IntegrityOptions, report *ValidationReport) error {
+	columns := append(append([]string(nil), r.Scope...), r.Columns...)
+	notNull := make([]string, len(columns))
+	for i, col := range columns {
+		notNull[i] = quoteIdentifier(col) + " IS NOT NULL"
+	}
+	cols := quoteIdentifiers(columns)
+	sql := fmt.Sprintf("SELECT %s, COUNT(*) AS duplicate_count FROM %s WHERE %s GROUP BY %s HAVING COUNT(*) > 1 ORDER BY %s LIMIT %d",
+		cols, quoteIdentifier(r.Table), strings.Join(notNull, " AND "), cols, cols, opts.MaxViolations+1)
+	rows, err := c.auditQuery(ctx, sql)
+	if err != nil {
+		return err
+	}
+	for i, row := range rows {
+		if i == opts.MaxViolations {
+			report.Truncated = true
+			break
+		}
+		values := make(map[string]interface{}, len(columns))
+		key := make([]interface{}, len(columns))
+		for j, col := range columns {
+			values[col], key[j] = row[col], row[col]
+		}
+		var count int64
+		_ = ScanValue(row["duplicate_count"], &count)
+		report.Violations = append(report.Violations, RuleViolation{
+			Rule: r.label(), Kind: r.Kind, Table: r.Table, Values: values, Count: count,
+			Message: fmt.Sprintf("%s: %v = %v is shared by %d rows", r.label(), columns, key, count),
+		})
+	}
+	return nil
+}
+
+// auditReference finds values of a reference rule without a matching row
+func (c *Client) auditReference(ctx context.Context, r Rule, opts IntegrityOptions, report *ValidationReport) error {
+	fk := ForeignKey{Table: r.Table, Columns: r.Columns, RefTable: r.RefTable, RefColumns: r.RefColumns}
+	integrity, err := c.CheckIntegrity(ctx, IntegrityOptions{
+		Graph:         NewFKGraph(nil, nil),
+		Keys:          []ForeignKey{fk},
+		BatchSize:     opts.BatchSize,
+		MaxViolations: opts.MaxViolations,
+	})
+	if err != nil {
+		return err
+	}
+	report.Truncated = report.Truncated || integrity.Truncated
+	for _, v := range integrity.Violations {
+		values := make(map[string]interface{}, len(r.Columns))
+		for i, col := range r.Columns {
+			values[col] = v.Key[i]
+		}
+		report.Violations = append(report.Violations, RuleViolation{
+			Rule: r.label(), Kind: r.Kind, Table: r.Table, Values: values, Count: 1,
+			Message: fmt.Sprintf("%s: %v = %v has no matching row in %s", r.label(), r.Columns, v.Key, r.RefTable),
+		})
+	}
+	return nil
+}
+
+// auditRange finds the rows whose value breaks a range rule
+func (c *Client) auditRange(ctx context.Context, r Rule, opts IntegrityOptions, report *ValidationReport) error {
+	column := quoteIdentifier(r.Columns[0])
+	var conditions []string
+	var params []interface{}
+	if r.NotNull {
+		conditions = append(conditions, column+" IS NULL")
+	}
+	if r.Min != nil {
+		conditions = append(conditions, column+" < ?")
+		params = append(params, r.Min)
+	}
+	if r.Max != nil {
+		conditions = append(conditions, column+" > ?")
+		params = append(params, r.Max)
+	}
+	if len(r.In) > 0 {
+		conditions = append(conditions, column+" NOT IN (?)")
+		params = append(params, In(r.In...))
+	}
+	sql := fmt.Sprintf("SELECT * FROM %s WHERE %s LIMIT %d",
+		quoteIdentifier(r.Table), strings.Join(conditions, " OR "), opts.MaxViolations+1)
+	rows, err := c.auditQuery(ctx, sql, params...)
+	if err != nil {
+		return err
+	}
+	for i, row := range rows {
+		if i == opts.MaxViolations {
+			report.Truncated = true
+			break
+		}
+		message := r.rangeViolation(row[r.Columns[0]])
+		if message == "" {
+			// The database and the client disagree on the comparison,
+			// e.g. for collations; report the row as the database found it
+			message = fmt.Sprintf("%s = %v is out of range", r.Columns[0], row[r.Columns[0]])
+		}
+		report.Violations = append(report.Violations, RuleViolation{
+			Rule: r.label(), Kind: r.Kind, Table: r.Table, Values: row, Count: 1,
+			Message: r.label() + ": " + message,
+		})
+	}
+	return nil
+}
+
+func (c *Client) auditQuery(ctx context.Context, sql string, params ...interface{}) ([]map[string]interface{}, error) {
+	resp, err := c.Query(ctx, sql, params...)
+	if err != nil {
+		return nil, err
+	}
+	if err := resp.failure(); err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// StartRuleAudit runs AuditRules every interval until ctx ends or the
+// returned stop function is called, passing each outcome to fn
+func (c *Client) StartRuleAudit(ctx context.Context, interval time.Duration, rules *RuleSet, opts IntegrityOptions, fn func(*ValidationReport, error)) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				fn(c.AuditRules(ctx, rules, opts))
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
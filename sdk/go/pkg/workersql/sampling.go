@@ -0,0 +1,162 @@
+package workersql
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// DefaultSampleRows is how many rows of a sampled result are checked when
+// ResultSamplingConfig.MaxRows is unset
+const DefaultSampleRows = 100
+
+// ResultSamplingConfig checks a fraction of query results against
+// data-quality rules, for lightweight monitoring in the access layer
+type ResultSamplingConfig struct {
+	// Rate is the fraction of Query and Exec results checked, from 0 to 1
+	Rate float64
+	// MaxRows caps the rows checked per sampled result (default: 100)
+	MaxRows int
+	// Rules are the expectations checked on the rows
+	Rules []ColumnRule
+	// OnViolation, if set, is called for every violation found. It runs on
+	// the path of the sampled call and should return quickly.
+	OnViolation func(QualityViolation)
+}
+
+// ColumnRule is an expectation on the values of a result column. Rows
+// without the column are skipped, so rules only apply to queries
+// selecting it.
+type ColumnRule struct {
+	// Name identifies the rule in violations (default: the column name)
+	Name string
+	// Table limits the rule to statements reading this table; empty
+	// applies it to every result
+	Table  string
+	Column string
+	// NotNull expects the column never to be NULL
+	NotNull bool
+	// Min and Max, if set, bound numeric values
+	Min *float64
+	Max *float64
+	// Check, if set, validates non-NULL values, returning why a value is
+	// wrong
+	Check func(value interface{}) error
+}
+
+// QualityViolation is a value breaking a ColumnRule
+type QualityViolation struct {
+	Rule        string
+	Table       string
+	Column      string
+	Fingerprint string
+	// Row is the index of the row in the result
+	Row   int
+	Value interface{}
+	Err   error
+}
+
+// resultSampler checks sampled results against the rules. The methods of a
+// nil sampler do nothing.
+type resultSampler struct {
+	client *Client
+	config ResultSamplingConfig
+	sample func() bool
+}
+
+func newResultSampler(client *Client, config *ResultSamplingConfig) *resultSampler {
+	if config == nil || config.Rate <= 0 || len(config.Rules) == 0 {
+		return nil
+	}
+	s := &resultSampler{client: client, config: *config}
+	s.config.Rules = append([]ColumnRule(nil), config.Rules...)
+	if s.config.MaxRows <= 0 {
+		s.config.MaxRows = DefaultSampleRows
+	}
+	for i, rule := range s.config.Rules {
+		s.config.Rules[i].Table = normalizeTableName(rule.Table)
+		if rule.Name == "" {
+			s.config.Rules[i].Name = rule.Column
+		}
+	}
+	rate := s.config.Rate
+	s.sample = func() bool { return rate >= 1 || rand.Float64() < rate }
+	return s
+}
+
+// observe checks the rows of the result of sql if it is sampled
+func (s *resultSampler) observe(sql string, rows []map[string]interface{}) {
+	if s == nil || len(rows) == 0 || !s.sample() {
+		return
+	}
+	atomic.AddInt64(&s.client.stats.resultsSampled, 1)
+
+	tables := statementTables(sql)
+	var fingerprint string
+	for _, rule := range s.config.Rules {
+		if rule.Table != "" && !sharesTable(tables, []string{rule.Table}) {
+			continue
+		}
+		for i, row := range rows {
+			if i >= s.config.MaxRows {
+				break
+			}
+			value, ok := row[rule.Column]
+			if !ok {
+				continue
+			}
+			err := rule.check(value)
+			if err == nil {
+				continue
+			}
+			atomic.AddInt64(&s.client.stats.qualityViolations, 1)
+			if s.config.OnViolation == nil {
+				continue
+			}
+			if fingerprint == "" {
+				fingerprint = Fingerprint(sql)
+			}
+			s.config.OnViolation(QualityViolation{
+				Rule:        rule.Name,
+				Table:       rule.Table,
+				Column:      rule.Column,
+				Fingerprint: fingerprint,
+				Row:         i,
+				Value:       value,
+				Err:         err,
+			})
+		}
+	}
+}
+
+// check returns why value breaks the rule, or nil
+func (r ColumnRule) check(value interface{}) error {
+	if value == nil {
+		if r.NotNull {
+			return fmt.Errorf("%s is NULL", r.Column)
+		}
+		return nil
+	}
+	if r.Min != nil || r.Max != nil {
+		text, err := numberText(value)
+		if err != nil {
+			return fmt.Errorf("%s is not a number: %v", r.Column, value)
+		}
+		n, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+		if err != nil {
+			return fmt.Errorf("%s is not a number: %v", r.Column, value)
+		}
+		if r.Min != nil && n < *r.Min {
+			return fmt.Errorf("%s is %v, below %v", r.Column, n, *r.Min)
+		}
+		if r.Max != nil && n > *r.Max {
+			return fmt.Errorf("%s is %v, above %v", r.Column, n, *r.Max)
+		}
+	}
+	if r.Check != nil {
+		return r.Check(value)
+	}
+	return nil
+}
@@ -0,0 +1,348 @@
+package workersql
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// Null represents a value of type T that may be NULL. It can be used as a
+// ScanValue/ScanStruct destination and as a query parameter, where an invalid
+// value is sent as NULL.
+type Null[T any] struct {
+	V     T
+	Valid bool
+}
+
+// NewNull returns a valid Null holding v
+func NewNull[T any](v T) Null[T] {
+	return Null[T]{V: v, Valid: true}
+}
+
+// Scan implements sql.Scanner
+func (n *Null[T]) Scan(value interface{}) error {
+	if value == nil {
+		var zero T
+		n.V, n.Valid = zero, false
+		return nil
+	}
+	if err := ScanValue(value, &n.V); err != nil {
+		return err
+	}
+	n.Valid = true
+	return nil
+}
+
+// Value implements driver.Valuer
+func (n Null[T]) Value() (driver.Value, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	return n.V, nil
+}
+
+// MarshalJSON encodes an invalid value as null
+func (n Null[T]) MarshalJSON() ([]byte, error) {
+	if !n.Valid {
+		return []byte("null"), nil
+	}
+	return json.Marshal(n.V)
+}
+
+// UnmarshalJSON decodes null as an invalid value
+func (n *Null[T]) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		var zero T
+		n.V, n.Valid = zero, false
+		return nil
+	}
+	if err := json.Unmarshal(data, &n.V); err != nil {
+		return err
+	}
+	n.Valid = true
+	return nil
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	bytesType    = reflect.TypeOf([]byte(nil))
+	scannerType  = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	bigIntType   = reflect.TypeOf(big.Int{})
+	bigFloatType = reflect.TypeOf(big.Float{})
+	bigRatType   = reflect.TypeOf(big.Rat{})
+)
+
+// ScanValue converts a row value into dest, which must be a non-nil pointer.
+// sql.Scanner destinations such as sql.NullString, sql.NullInt64,
+// sql.NullTime and Null[T] receive NULL as an invalid value, and pointer
+// destinations (e.g. **string) are set to nil. Scanning NULL into any other
+// destination is an error, so a missing value is never silently zeroed.
+func ScanValue(value interface{}, dest interface{}) error {
+	if scanner, ok := dest.(sql.Scanner); ok {
+		return scanInto(scanner, value)
+	}
+
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("scan destination must be a non-nil pointer, got %T", dest)
+	}
+	return assign(rv.Elem(), value)
+}
+
+// ScanRow copies the values of row i into dest in column order, like
+// sql.Rows.Scan. It requires column metadata in the response.
+func (r *QueryResponse) ScanRow(i int, dest ...interface{}) error {
+	if i < 0 || i >= len(r.Data) {
+		return fmt.Errorf("row %d out of range (%d rows)", i, len(r.Data))
+	}
+	if len(r.Columns) == 0 {
+		return fmt.Errorf("response has no column metadata")
+	}
+	if len(dest) != len(r.Columns) {
+		return fmt.Errorf("expected %d destination arguments in ScanRow, not %d", len(r.Columns), len(dest))
+	}
+
+	row := r.Data[i]
+	for j, col := range r.Columns {
+		if err := ScanValue(row[col.Name], dest[j]); err != nil {
+			return fmt.Errorf("column %q: %w", col.Name, err)
+		}
+	}
+	return nil
+}
+
+// ScanStruct copies row values into the fields of the struct dest points to.
+// A field is matched by its `db` tag, or by its name case-insensitively when
+// untagged; fields tagged `db:"-"` and columns without a field are skipped.
+// Fields of embedded structs are matched as if declared in dest.
+func ScanStruct(row map[string]interface{}, dest interface{}) error {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("scan destination must be a pointer to a struct, got %T", dest)
+	}
+
+	info := getStructInfo(rv.Elem().Type())
+	for name, value := range row {
+		f := info.lookup(name)
+		if f == nil {
+			continue
+		}
+		if err := assign(rv.Elem().FieldByIndex(f.index), value); err != nil {
+			return fmt.Errorf("column %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// ScanAll copies every row of the response into dest, which must point to a
+// slice of structs or of struct pointers
+func (r *QueryResponse) ScanAll(dest interface{}) error {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("scan destination must be a pointer to a slice, got %T", dest)
+	}
+
+	slice := rv.Elem()
+	elemType := slice.Type().Elem()
+	isPtr := elemType.Kind() == reflect.Ptr
+	if isPtr {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		return fmt.Errorf("scan destination must be a slice of structs, got %T", dest)
+	}
+
+	out := reflect.MakeSlice(slice.Type(), 0, len(r.Data))
+	for i, row := range r.Data {
+		elem := reflect.New(elemType)
+		if err := ScanStruct(row, elem.Interface()); err != nil {
+			return fmt.Errorf("row %d: %w", i, err)
+		}
+		if isPtr {
+			out = reflect.Append(out, elem)
+		} else {
+			out = reflect.Append(out, elem.Elem())
+		}
+	}
+	slice.Set(out)
+	return nil
+}
+
+// scanInto passes value to a sql.Scanner. Time columns are strings unless
+// ParseTime is set, so they are parsed here for sql.NullTime.
+func scanInto(scanner sql.Scanner, value interface{}) error {
+	if _, ok := scanner.(*sql.NullTime); ok {
+		if t, ok := toTime(value, time.UTC); ok {
+			value = t
+		}
+	}
+	return scanner.Scan(driverValue(value))
+}
+
+// driverValue converts a decoded row value into one of the types
+// sql.Scanner implementations expect
+func driverValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		return v.String()
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	}
+	return value
+}
+
+// assign stores value in dst, converting between compatible types
+func assign(dst reflect.Value, value interface{}) error {
+	if dst.CanAddr() && dst.Addr().Type().Implements(scannerType) {
+		return scanInto(dst.Addr().Interface().(sql.Scanner), value)
+	}
+
+	if value == nil {
+		switch dst.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+			dst.Set(reflect.Zero(dst.Type()))
+			return nil
+		}
+		return fmt.Errorf("cannot scan NULL into %s; use a pointer, sql.Null* or workersql.Null", dst.Type())
+	}
+
+	switch dst.Kind() {
+	case reflect.Ptr:
+		elem := reflect.New(dst.Type().Elem())
+		if err := assign(elem.Elem(), value); err != nil {
+			return err
+		}
+		dst.Set(elem)
+		return nil
+	case reflect.Interface:
+		dst.Set(reflect.ValueOf(value))
+		return nil
+	}
+
+	if m := lookupEnum(dst.Type()); m != nil {
+		text, ok := stringValue(value)
+		if !ok {
+			return fmt.Errorf("cannot scan %T into %s", value, dst.Type())
+		}
+		v, err := m.decode(text)
+		if err != nil {
+			return err
+		}
+		dst.Set(v)
+		return nil
+	}
+
+	src := reflect.ValueOf(value)
+	if src.Type().AssignableTo(dst.Type()) {
+		dst.Set(src)
+		return nil
+	}
+
+	switch dst.Type() {
+	case timeType:
+		t, ok := toTime(value, time.UTC)
+		if !ok {
+			return fmt.Errorf("cannot scan %T into time.Time", value)
+		}
+		dst.Set(reflect.ValueOf(t))
+		return nil
+	case bytesType:
+		switch v := value.(type) {
+		case string:
+			dst.SetBytes([]byte(v))
+			return nil
+		case json.Number:
+			dst.SetBytes([]byte(v))
+			return nil
+		}
+		return fmt.Errorf("cannot scan %T into []byte", value)
+	case bigIntType, bigFloatType, bigRatType:
+		return ScanNumber(value, dst.Addr().Interface())
+	}
+
+	switch dst.Kind() {
+	case reflect.String:
+		s, ok := stringValue(value)
+		if !ok {
+			return fmt.Errorf("cannot scan %T into %s", value, dst.Type())
+		}
+		dst.SetString(s)
+		return nil
+	case reflect.Bool:
+		b, ok := toBool(value)
+		if !ok {
+			return fmt.Errorf("cannot scan %v into %s", value, dst.Type())
+		}
+		dst.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		text, err := numberText(value)
+		if err != nil {
+			return err
+		}
+		n, err := strconv.ParseInt(text, 10, dst.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("cannot scan %q into %s: %w", text, dst.Type(), err)
+		}
+		dst.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		text, err := numberText(value)
+		if err != nil {
+			return err
+		}
+		n, err := strconv.ParseUint(text, 10, dst.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("cannot scan %q into %s: %w", text, dst.Type(), err)
+		}
+		dst.SetUint(n)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		text, err := numberText(value)
+		if err != nil {
+			return err
+		}
+		f, err := strconv.ParseFloat(text, dst.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("cannot scan %q into %s: %w", text, dst.Type(), err)
+		}
+		dst.SetFloat(f)
+		return nil
+	}
+
+	if dst.CanAddr() {
+		if u, ok := dst.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			if s, ok := stringValue(value); ok {
+				return u.UnmarshalText([]byte(s))
+			}
+		}
+	}
+	return fmt.Errorf("cannot scan %T into %s", value, dst.Type())
+}
+
+// stringValue formats a scalar row value as text
+func stringValue(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	case time.Time:
+		return v.Format(time.RFC3339Nano), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	if s, err := numberText(value); err == nil {
+		return s, true
+	}
+	return "", false
+}
@@ -0,0 +1,247 @@
+package workersql
+
+import (
+	"strings"
+	"sync"
+)
+
+// SchemaChange describes a change to the database schema, from a DDL
+// statement executed by this client or read from a change feed, or reported
+// through InvalidateSchema
+type SchemaChange struct {
+	// SQL is the DDL statement, empty for changes reported with InvalidateSchema
+	SQL string
+	// Tables lists the affected tables. It is empty when the affected tables
+	// are unknown, in which case every table must be treated as changed.
+	Tables []string
+}
+
+// Affects reports whether the change affects table
+func (s SchemaChange) Affects(table string) bool {
+	if len(s.Tables) == 0 {
+		return true
+	}
+	table = normalizeTableName(table)
+	for _, t := range s.Tables {
+		if t == table {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaListeners fans schema changes out to the caches that depend on table
+// metadata
+type schemaListeners struct {
+	mu        sync.RWMutex
+	nextID    int
+	listeners map[int]func(SchemaChange)
+}
+
+func newSchemaListeners() *schemaListeners {
+	return &schemaListeners{listeners: make(map[int]func(SchemaChange))}
+}
+
+func (l *schemaListeners) add(fn func(SchemaChange)) func() {
+	l.mu.Lock()
+	id := l.nextID
+	l.nextID++
+	l.listeners[id] = fn
+	l.mu.Unlock()
+
+	return func() {
+		l.mu.Lock()
+		delete(l.listeners, id)
+		l.mu.Unlock()
+	}
+}
+
+func (l *schemaListeners) notify(change SchemaChange) {
+	l.mu.RLock()
+	fns := make([]func(SchemaChange), 0, len(l.listeners))
+	for _, fn := range l.listeners {
+		fns = append(fns, fn)
+	}
+	l.mu.RUnlock()
+
+	for _, fn := range fns {
+		fn(change)
+	}
+}
+
+// observe notifies listeners if sql is a DDL statement
+func (l *schemaListeners) observe(sql string) {
+	if tables, ok := ddlTables(sql); ok {
+		l.notify(SchemaChange{SQL: sql, Tables: tables})
+	}
+}
+
+// OnSchemaChange registers fn to be called after this client executes a DDL
+// statement, WatchChanges or Subscribe reads one from a change log, or
+// InvalidateSchema is called, so caches holding table metadata or results
+// can drop stale entries. It returns a function that unregisters fn.
+func (c *Client) OnSchemaChange(fn func(SchemaChange)) (unregister func()) {
+	return c.schema.add(fn)
+}
+
+// InvalidateSchema reports a schema change made outside this client, such as
+// one received from a CDC stream or made by another process. With no tables,
+// every table is treated as changed.
+func (c *Client) InvalidateSchema(tables ...string) {
+	normalized := make([]string, 0, len(tables))
+	for _, t := range tables {
+		normalized = append(normalized, normalizeTableName(t))
+	}
+	c.schema.notify(SchemaChange{Tables: normalized})
+}
+
+// ddlTables reports whether sql is a DDL statement and which tables it
+// affects. A DDL statement whose tables can't be determined returns no
+// tables, meaning all tables.
+func ddlTables(sql string) ([]string, bool) {
+	tokens := sqlTokens(sql)
+	if len(tokens) == 0 {
+		return nil, false
+	}
+
+	switch strings.ToUpper(tokens[0]) {
+	case "CREATE", "ALTER", "DROP":
+		return objectTables(tokens[1:]), true
+	case "TRUNCATE":
+		rest := tokens[1:]
+		if len(rest) > 0 && strings.EqualFold(rest[0], "TABLE") {
+			rest = rest[1:]
+		}
+		if len(rest) == 0 {
+			return nil, true
+		}
+		return []string{normalizeTableName(rest[0])}, true
+	case "RENAME":
+		// RENAME TABLE a TO b, c TO d
+		var tables []string
+		for i := 1; i < len(tokens); i++ {
+			t := tokens[i]
+			if strings.EqualFold(t, "TABLE") || strings.EqualFold(t, "TO") || t == "," {
+				continue
+			}
+			tables = append(tables, normalizeTableName(t))
+		}
+		return tables, true
+	}
+	return nil, false
+}
+
+// objectTables extracts the tables from the remainder of a CREATE, ALTER or
+// DROP statement
+func objectTables(tokens []string) []string {
+	// Skip modifiers such as TEMPORARY, UNIQUE and OR REPLACE
+	i := 0
+	for i < len(tokens) {
+		switch strings.ToUpper(tokens[i]) {
+		case "OR", "REPLACE", "TEMPORARY", "UNIQUE", "FULLTEXT", "SPATIAL", "ONLINE", "OFFLINE", "IGNORE":
+			i++
+			continue
+		}
+		break
+	}
+	if i >= len(tokens) {
+		return nil
+	}
+
+	kind := strings.ToUpper(tokens[i])
+	rest := tokens[i+1:]
+	switch kind {
+	case "TABLE", "VIEW":
+		rest = skipIfExists(rest)
+		var tables []string
+		for j, t := range rest {
+			if t == "," {
+				continue
+			}
+			if j > 0 && rest[j-1] != "," {
+				break
+			}
+			tables = append(tables, normalizeTableName(t))
+		}
+		return tables
+	case "INDEX", "TRIGGER":
+		// CREATE INDEX idx ON table / DROP INDEX idx ON table
+		for j, t := range rest {
+			if strings.EqualFold(t, "ON") && j+1 < len(rest) {
+				return []string{normalizeTableName(rest[j+1])}
+			}
+		}
+	}
+	return nil
+}
+
+func skipIfExists(tokens []string) []string {
+	if len(tokens) >= 2 && strings.EqualFold(tokens[0], "IF") {
+		if strings.EqualFold(tokens[1], "EXISTS") {
+			return tokens[2:]
+		}
+		if len(tokens) >= 3 && strings.EqualFold(tokens[1], "NOT") && strings.EqualFold(tokens[2], "EXISTS") {
+			return tokens[3:]
+		}
+	}
+	return tokens
+}
+
+// normalizeTableName strips identifier quotes and lower-cases name so
+// differently written references to a table compare equal
+func normalizeTableName(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "`", ""))
+}
+
+// sqlTokens splits the start of sql into words, backtick-quoted identifiers
+// and commas, skipping comments. Tokenizing stops at the first parenthesis,
+// quote or semicolon, which is past every table name ddlTables needs.
+func sqlTokens(sql string) []string {
+	var tokens []string
+	s := sql
+	for len(s) > 0 {
+		switch c := s[0]; {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			s = s[1:]
+		case strings.HasPrefix(s, "--") || c == '#':
+			i := strings.IndexByte(s, '\n')
+			if i < 0 {
+				return tokens
+			}
+			s = s[i+1:]
+		case strings.HasPrefix(s, "/*"):
+			i := strings.Index(s, "*/")
+			if i < 0 {
+				return tokens
+			}
+			s = s[i+2:]
+		case c == ',':
+			tokens = append(tokens, ",")
+			s = s[1:]
+		case c == '(' || c == ';' || c == '\'' || c == '"':
+			return tokens
+		default:
+			end := 0
+			for end < len(s) {
+				ch := s[end]
+				if ch == '`' {
+					// Quoted identifiers may contain any character
+					q := strings.IndexByte(s[end+1:], '`')
+					if q < 0 {
+						end = len(s)
+						break
+					}
+					end += q + 2
+					continue
+				}
+				if ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n' || ch == ',' || ch == '(' || ch == ';' {
+					break
+				}
+				end++
+			}
+			tokens = append(tokens, s[:end])
+			s = s[end:]
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,277 @@
+package workersql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/healthfees-org/workersql/sdk/go/internal/websocket"
+)
+
+// ErrSessionClosed is returned by operations on a closed Session
+var ErrSessionClosed = errors.New("session is closed")
+
+// errSessionVarsSet ends a transaction whose connection had session
+// variables changed, so it isn't handed to other transactions
+var errSessionVarsSet = errors.New("session variables changed")
+
+// sessionVarName matches the variable names Set accepts
+var sessionVarName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Set sets the MySQL session variable name to value with SET SESSION, for
+// ORMs relying on sql_mode or time_zone. On a Session the variable applies
+// to its later transactions too and is restored after reconnects.
+// Otherwise it applies to the rest of the transaction, whose connection is
+// then closed rather than reused.
+func (tx *TransactionClient) Set(ctx context.Context, name string, value interface{}) error {
+	if !sessionVarName.MatchString(name) {
+		return fmt.Errorf("invalid session variable name %q", name)
+	}
+	resp, err := tx.Exec(ctx, setStatement(name), value)
+	if err != nil {
+		return err
+	}
+	if !resp.Success {
+		if resp.Error != nil {
+			return fmt.Errorf("setting %s: %s: %s", name, resp.Error.Code, resp.Error.Message)
+		}
+		return fmt.Errorf("setting %s failed", name)
+	}
+	atomic.StoreInt32(&tx.varsSet, 1)
+	tx.session.record(name, value)
+	return nil
+}
+
+func setStatement(name string) string {
+	return "SET SESSION " + name + " = ?"
+}
+
+// Session is a sticky WebSocket session keeping MySQL session variables
+// across its transactions. It runs one transaction at a time; BeginTx
+// waits for the previous one to end. Variables set with Set are restored
+// at the start of the next transaction when the connection had to be
+// re-dialed.
+type Session struct {
+	client *Client
+	// busy holds a token while a transaction runs on the session
+	busy chan struct{}
+
+	mu   sync.Mutex
+	conn *websocket.TransactionClient
+	vars []sessionVar
+	// restore is set while conn lacks the variables
+	restore bool
+	// dials counts the connections the session has dialed
+	dials  int
+	closed bool
+}
+
+type sessionVar struct {
+	name  string
+	value interface{}
+}
+
+// Session opens a sticky WebSocket session. Sessions don't take part in
+// TransactionTransportHTTP and aren't closed by Client.Close; close them
+// with Session.Close.
+func (c *Client) Session(ctx context.Context) (*Session, error) {
+	if c.config.TransactionTransport == TransactionTransportHTTP {
+		return nil, fmt.Errorf("sessions need a WebSocket transaction transport")
+	}
+	s := &Session{client: c, busy: make(chan struct{}, 1)}
+	_, release, err := s.acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open session: %w", err)
+	}
+	release(nil)
+	return s, nil
+}
+
+// acquire waits for the session to be free and returns its connection,
+// re-dialing it if it was lost
+func (s *Session) acquire(ctx context.Context) (txConn, func(error), error) {
+	select {
+	case s.busy <- struct{}{}:
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		<-s.busy
+		return nil, nil, ErrSessionClosed
+	}
+	if s.conn == nil || !s.conn.IsConnected() {
+		conn := websocket.NewTransactionClient(s.client.config.APIEndpoint, s.client.config.APIKey)
+		conn.SetHeartbeat(websocket.HeartbeatOptions{
+			Interval:    s.client.config.TransactionHeartbeatInterval,
+			MaxDuration: s.client.config.MaxTransactionDuration,
+		})
+		conn.SetDialer(s.client.config.Dialer)
+		if err := conn.Connect(ctx); err != nil {
+			<-s.busy
+			return nil, nil, err
+		}
+		s.conn = conn
+		s.dials++
+		s.restore = len(s.vars) > 0
+	}
+
+	conn := s.conn
+	return conn, func(err error) {
+		if err != nil && !errors.Is(err, errSessionVarsSet) {
+			// The session state is uncertain: start over on a new
+			// connection, restoring the variables
+			_ = conn.Close()
+		}
+		<-s.busy
+	}, nil
+}
+
+// BeginTx starts a transaction on the session, once the previous one has
+// ended
+func (s *Session) BeginTx(ctx context.Context) (*TransactionClient, error) {
+	tx, err := s.client.beginTx(ctx, s.acquire)
+	if err != nil {
+		return nil, err
+	}
+	tx.session = s
+	if err := s.restoreVars(ctx, tx); err != nil {
+		_ = tx.Rollback(ctx)
+		return nil, fmt.Errorf("failed to restore session variables: %w", err)
+	}
+	return tx, nil
+}
+
+// restoreVars sets the session variables again in tx when its connection
+// was re-dialed since they were set
+func (s *Session) restoreVars(ctx context.Context, tx *TransactionClient) error {
+	s.mu.Lock()
+	if !s.restore {
+		s.mu.Unlock()
+		return nil
+	}
+	statements := make([]websocket.Statement, len(s.vars))
+	for i, v := range s.vars {
+		statements[i] = websocket.Statement{SQL: setStatement(v.name), Params: []interface{}{v.value}, Mode: "exec"}
+	}
+	s.mu.Unlock()
+
+	results, err := tx.conn.Pipeline(ctx, statements)
+	if err != nil {
+		return err
+	}
+	if last := results[len(results)-1]; !last.Success {
+		return fmt.Errorf("%s: %v", statements[len(results)-1].SQL, last.Error)
+	}
+
+	s.mu.Lock()
+	s.restore = false
+	s.mu.Unlock()
+	return nil
+}
+
+// Transaction runs fn in a transaction on the session, committing it if fn
+// returns nil and rolling it back otherwise
+func (s *Session) Transaction(ctx context.Context, fn func(ctx context.Context, tx *TransactionClient) error) error {
+	tx, err := s.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback(ctx)
+			panic(r)
+		}
+	}()
+
+	if err := fn(ctx, tx); err != nil {
+		if rbErr := tx.Rollback(ctx); rbErr != nil {
+			return fmt.Errorf("transaction error: %w (rollback error: %v)", err, rbErr)
+		}
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// Set sets the MySQL session variable name to value for the transactions
+// of the session
+func (s *Session) Set(ctx context.Context, name string, value interface{}) error {
+	return s.Transaction(ctx, func(ctx context.Context, tx *TransactionClient) error {
+		return tx.Set(ctx, name, value)
+	})
+}
+
+// Vars returns the session variables set on the session, by name
+func (s *Session) Vars() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	vars := make(map[string]interface{}, len(s.vars))
+	for _, v := range s.vars {
+		vars[v.name] = v.value
+	}
+	return vars
+}
+
+// Query runs a query on the session in a transaction of its own
+func (s *Session) Query(ctx context.Context, sql string, params ...interface{}) (*QueryResponse, error) {
+	var resp *QueryResponse
+	err := s.Transaction(ctx, func(ctx context.Context, tx *TransactionClient) (err error) {
+		resp, err = tx.Query(ctx, sql, params...)
+		return err
+	})
+	return resp, err
+}
+
+// Exec runs a statement on the session in a transaction of its own
+func (s *Session) Exec(ctx context.Context, sql string, params ...interface{}) (*ExecResponse, error) {
+	var resp *ExecResponse
+	err := s.Transaction(ctx, func(ctx context.Context, tx *TransactionClient) (err error) {
+		resp, err = tx.Exec(ctx, sql, params...)
+		return err
+	})
+	return resp, err
+}
+
+// Close closes the session's connection, ending a transaction still open
+// on it
+func (s *Session) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+// dialCount returns how many connections the session has dialed, growing
+// when a lost connection is replaced
+func (s *Session) dialCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dials
+}
+
+// record keeps the variable name set to value for restoring. It does
+// nothing on a nil session.
+func (s *Session) record(name string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, v := range s.vars {
+		if strings.EqualFold(v.name, name) {
+			s.vars[i].value = value
+			return
+		}
+	}
+	s.vars = append(s.vars, sessionVar{name: name, value: value})
+}
@@ -0,0 +1,188 @@
+package workersql
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// ShardStatus is the health of a shard as seen by the gateway
+type ShardStatus string
+
+const (
+	ShardHealthy     ShardStatus = "healthy"
+	ShardDegraded    ShardStatus = "degraded"
+	ShardUnavailable ShardStatus = "unavailable"
+	// ShardMigrating shards are being split or merged
+	ShardMigrating ShardStatus = "migrating"
+)
+
+// ShardInfo describes a shard of the gateway
+type ShardInfo struct {
+	ID     string      `json:"id"`
+	Status ShardStatus `json:"status"`
+	// SizeBytes is the storage the shard's Durable Object takes up
+	SizeBytes int64 `json:"sizeBytes"`
+	RowCount  int64 `json:"rowCount"`
+	// Tenants are the logical databases placed on the shard
+	Tenants []string `json:"tenants,omitempty"`
+	// P99LatencyMs is the shard's recent 99th percentile query latency
+	P99LatencyMs  float64   `json:"p99LatencyMs"`
+	LastCheckedAt time.Time `json:"lastCheckedAt"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// SplitOptions controls SplitShard
+type SplitOptions struct {
+	// NewShard is the ID of the shard created by the split (default:
+	// chosen by the gateway)
+	NewShard string
+	// Tenants are moved to the new shard (default: the gateway moves about
+	// half of the shard's data)
+	Tenants []string
+}
+
+// Tenant is a logical database of the gateway
+type Tenant struct {
+	Name      string    `json:"name"`
+	Shard     string    `json:"shard"`
+	SizeBytes int64     `json:"sizeBytes"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// TenantOptions controls CreateTenant
+type TenantOptions struct {
+	// Shard places the tenant on that shard (default: chosen by the
+	// gateway)
+	Shard string
+}
+
+// TenantKey is an API key of a tenant
+type TenantKey struct {
+	ID string `json:"id"`
+	// Key is the secret, returned only when the key is created
+	Key       string    `json:"key"`
+	CreatedAt time.Time `json:"createdAt"`
+	// PreviousExpiresAt is when the key it replaced stops working
+	PreviousExpiresAt time.Time `json:"previousExpiresAt"`
+}
+
+// RotateKeyOptions controls RotateTenantKey
+type RotateKeyOptions struct {
+	// GracePeriod keeps the previous key working for that long so clients
+	// can switch over. Zero revokes it at once.
+	GracePeriod time.Duration
+}
+
+// ListShards returns the gateway's shards with their health and size,
+// ordered by ID
+func (a *AdminClient) ListShards(ctx context.Context) ([]ShardInfo, error) {
+	response, err := a.do(ctx, "GET", "/admin/shards", nil, true)
+	if err != nil {
+		return nil, fmt.Errorf("list shards: %w", err)
+	}
+	return response.Shards, nil
+}
+
+// Shard returns the health and size of the shard id
+func (a *AdminClient) Shard(ctx context.Context, id string) (*ShardInfo, error) {
+	response, err := a.do(ctx, "GET", "/admin/shards/"+url.PathEscape(id), nil, true)
+	if err != nil {
+		return nil, fmt.Errorf("get shard %s: %w", id, err)
+	}
+	if response.Shard == nil {
+		return nil, fmt.Errorf("get shard %s: no shard returned", id)
+	}
+	return response.Shard, nil
+}
+
+// SplitShard starts moving part of the shard id to a new shard and returns
+// the operation running it, for Wait. The shard stays available, with
+// ShardMigrating status, while its data is copied.
+func (a *AdminClient) SplitShard(ctx context.Context, id string, opts SplitOptions) (*Operation, error) {
+	body := map[string]interface{}{}
+	if opts.NewShard != "" {
+		body["newShard"] = opts.NewShard
+	}
+	if len(opts.Tenants) > 0 {
+		body["tenants"] = opts.Tenants
+	}
+	response, err := a.do(ctx, "POST", "/admin/shards/"+url.PathEscape(id)+"/split", body, false)
+	if err != nil {
+		return nil, fmt.Errorf("split shard %s: %w", id, err)
+	}
+	return adminOperation(response, "split shard "+id)
+}
+
+// MergeShards starts moving every tenant of the shard source onto target,
+// removing source once done, and returns the operation running it, for
+// Wait
+func (a *AdminClient) MergeShards(ctx context.Context, source, target string) (*Operation, error) {
+	if source == target {
+		return nil, fmt.Errorf("merge shards: cannot merge shard %s into itself", source)
+	}
+	body := map[string]interface{}{"into": target}
+	response, err := a.do(ctx, "POST", "/admin/shards/"+url.PathEscape(source)+"/merge", body, false)
+	if err != nil {
+		return nil, fmt.Errorf("merge shard %s into %s: %w", source, target, err)
+	}
+	return adminOperation(response, "merge shard "+source)
+}
+
+// ListTenants returns the gateway's logical databases, ordered by name
+func (a *AdminClient) ListTenants(ctx context.Context) ([]Tenant, error) {
+	response, err := a.do(ctx, "GET", "/admin/tenants", nil, true)
+	if err != nil {
+		return nil, fmt.Errorf("list tenants: %w", err)
+	}
+	return response.Tenants, nil
+}
+
+// CreateTenant creates the logical database name
+func (a *AdminClient) CreateTenant(ctx context.Context, name string, opts TenantOptions) (*Tenant, error) {
+	if name == "" {
+		return nil, fmt.Errorf("create tenant: a name is required")
+	}
+	body := map[string]interface{}{"name": name}
+	if opts.Shard != "" {
+		body["shard"] = opts.Shard
+	}
+	response, err := a.do(ctx, "POST", "/admin/tenants", body, false)
+	if err != nil {
+		return nil, fmt.Errorf("create tenant %s: %w", name, err)
+	}
+	if response.Tenant == nil {
+		return nil, fmt.Errorf("create tenant %s: no tenant returned", name)
+	}
+	return response.Tenant, nil
+}
+
+// DropTenant deletes the logical database name with all its data and API
+// keys. It can't be undone except by restoring a backup.
+func (a *AdminClient) DropTenant(ctx context.Context, name string) error {
+	if name == "" {
+		return fmt.Errorf("drop tenant: a name is required")
+	}
+	if _, err := a.do(ctx, "DELETE", "/admin/tenants/"+url.PathEscape(name), nil, false); err != nil {
+		return fmt.Errorf("drop tenant %s: %w", name, err)
+	}
+	return nil
+}
+
+// RotateTenantKey issues a new API key for tenant, returning its secret,
+// and retires the previous one after opts.GracePeriod
+func (a *AdminClient) RotateTenantKey(ctx context.Context, tenant string, opts RotateKeyOptions) (*TenantKey, error) {
+	if opts.GracePeriod < 0 {
+		return nil, fmt.Errorf("rotate key of %s: negative grace period %v", tenant, opts.GracePeriod)
+	}
+	body := map[string]interface{}{"gracePeriodSeconds": int64(opts.GracePeriod / time.Second)}
+	response, err := a.do(ctx, "POST", "/admin/tenants/"+url.PathEscape(tenant)+"/keys/rotate", body, false)
+	if err != nil {
+		return nil, fmt.Errorf("rotate key of %s: %w", tenant, err)
+	}
+	if response.Key == nil || response.Key.Key == "" {
+		return nil, fmt.Errorf("rotate key of %s: no key returned", tenant)
+	}
+	return response.Key, nil
+}
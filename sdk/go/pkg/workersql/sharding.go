@@ -0,0 +1,317 @@
+package workersql
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"unicode/utf16"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Routing strategies of the platform's sharding configuration
+const (
+	StrategyTenantHash = "tenant_hash"
+	StrategyTableHash  = "table_hash"
+	StrategyCustom     = "custom"
+)
+
+// DefaultShardCount is the number of shards assumed when the routing
+// policy doesn't set defaults.shard_count
+const DefaultShardCount = 4
+
+// RoutingPolicy is the routing-policy.yaml of the platform's sharding
+// configuration
+type RoutingPolicy struct {
+	Version int `yaml:"version"`
+	// Tenants pins tenants to shards, ahead of every other rule
+	Tenants map[string]string `yaml:"tenants"`
+	// Ranges route keys starting with a prefix to a shard
+	Ranges   []RangeRule     `yaml:"ranges"`
+	Defaults RoutingDefaults `yaml:"defaults"`
+}
+
+// RangeRule routes keys starting with Prefix to Shard
+type RangeRule struct {
+	Prefix string `yaml:"prefix"`
+	Shard  string `yaml:"shard"`
+}
+
+// RoutingDefaults holds the shard count and strategy used for tables
+// without their own
+type RoutingDefaults struct {
+	ShardCount int    `yaml:"shard_count"`
+	Strategy   string `yaml:"strategy"`
+}
+
+// TablePolicy is the policy file of one table in the platform's sharding
+// configuration
+type TablePolicy struct {
+	PrimaryKey string `yaml:"primary_key"`
+	// ShardBy is the column rows are distributed by
+	ShardBy string             `yaml:"shard_by"`
+	Cache   TableCachePolicy   `yaml:"cache"`
+	Routing TableRoutingPolicy `yaml:"routing"`
+}
+
+// TableCachePolicy is the gateway's caching policy for a table
+type TableCachePolicy struct {
+	Mode                Consistency `yaml:"mode"`
+	TTLMs               int64       `yaml:"ttl_ms"`
+	SWRMs               int64       `yaml:"swr_ms"`
+	AlwaysStrongColumns []string    `yaml:"always_strong_columns"`
+}
+
+// TableRoutingPolicy overrides the default routing for a table
+type TableRoutingPolicy struct {
+	Strategy string `yaml:"strategy"`
+	// ShardKey overrides ShardBy as the routing key column
+	ShardKey string `yaml:"shard_key"`
+}
+
+// ShardingConfig is the platform's sharding configuration: the routing
+// policy and the policies of each table
+type ShardingConfig struct {
+	Routing RoutingPolicy
+	// Tables maps lower-cased table names to their policies
+	Tables map[string]TablePolicy
+}
+
+// ParseRoutingPolicy parses a routing-policy.yaml, applying the gateway's
+// defaults
+func ParseRoutingPolicy(data []byte) (*RoutingPolicy, error) {
+	var policy RoutingPolicy
+	if err := yaml.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("routing policy: %w", err)
+	}
+	if policy.Version == 0 {
+		policy.Version = 1
+	}
+	if policy.Version < 1 {
+		return nil, fmt.Errorf("routing policy: invalid version %d", policy.Version)
+	}
+	for i, r := range policy.Ranges {
+		if r.Prefix == "" || r.Shard == "" {
+			return nil, fmt.Errorf("routing policy: range %d needs a prefix and a shard", i)
+		}
+	}
+	if policy.Defaults.ShardCount < 0 {
+		return nil, fmt.Errorf("routing policy: invalid shard_count %d", policy.Defaults.ShardCount)
+	}
+	if err := validateStrategy(policy.Defaults.Strategy); err != nil {
+		return nil, fmt.Errorf("routing policy: %w", err)
+	}
+	if policy.Tenants == nil {
+		policy.Tenants = make(map[string]string)
+	}
+	return &policy, nil
+}
+
+// ParseTablePolicy parses a table policy file, applying the gateway's
+// defaults: primary key "id" and bounded caching with a 1 minute TTL and
+// 5 minutes of stale-while-revalidate
+func ParseTablePolicy(data []byte) (*TablePolicy, error) {
+	var raw struct {
+		PrimaryKey string `yaml:"primary_key"`
+		ShardBy    string `yaml:"shard_by"`
+		Cache      struct {
+			Mode                Consistency `yaml:"mode"`
+			TTLMs               *int64      `yaml:"ttl_ms"`
+			SWRMs               *int64      `yaml:"swr_ms"`
+			AlwaysStrongColumns []string    `yaml:"always_strong_columns"`
+		} `yaml:"cache"`
+		Routing TableRoutingPolicy `yaml:"routing"`
+	}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("table policy: %w", err)
+	}
+	policy := TablePolicy{
+		PrimaryKey: raw.PrimaryKey,
+		ShardBy:    raw.ShardBy,
+		Cache: TableCachePolicy{
+			Mode:                raw.Cache.Mode,
+			TTLMs:               60000,
+			SWRMs:               300000,
+			AlwaysStrongColumns: raw.Cache.AlwaysStrongColumns,
+		},
+		Routing: raw.Routing,
+	}
+	if raw.Cache.TTLMs != nil {
+		policy.Cache.TTLMs = *raw.Cache.TTLMs
+	}
+	if raw.Cache.SWRMs != nil {
+		policy.Cache.SWRMs = *raw.Cache.SWRMs
+	}
+	if policy.PrimaryKey == "" {
+		policy.PrimaryKey = "id"
+	}
+	if policy.Cache.Mode == "" {
+		policy.Cache.Mode = ConsistencyBounded
+	}
+
+	switch policy.Cache.Mode {
+	case ConsistencyStrong, ConsistencyBounded, ConsistencyCached:
+	default:
+		return nil, fmt.Errorf("table policy: invalid cache mode %q", policy.Cache.Mode)
+	}
+	if policy.Cache.TTLMs < 0 || policy.Cache.SWRMs < 0 {
+		return nil, fmt.Errorf("table policy: negative cache durations are not allowed")
+	}
+	if err := validateStrategy(policy.Routing.Strategy); err != nil {
+		return nil, fmt.Errorf("table policy: %w", err)
+	}
+	return &policy, nil
+}
+
+func validateStrategy(strategy string) error {
+	switch strategy {
+	case "", StrategyTenantHash, StrategyTableHash, StrategyCustom:
+		return nil
+	}
+	return fmt.Errorf("unknown routing strategy %q", strategy)
+}
+
+// LoadShardingConfig loads the sharding configuration in dir, laid out as
+// in the platform's config examples: a routing-policy.yaml and one
+// <table>.yaml per table, either next to it or in a table-policies
+// subdirectory
+func LoadShardingConfig(dir string) (*ShardingConfig, error) {
+	return LoadShardingConfigFS(os.DirFS(dir))
+}
+
+// LoadShardingConfigFS is LoadShardingConfig reading from fsys, e.g. an
+// embedded copy of the configuration
+func LoadShardingConfigFS(fsys fs.FS) (*ShardingConfig, error) {
+	data, err := fs.ReadFile(fsys, "routing-policy.yaml")
+	if err != nil {
+		return nil, fmt.Errorf("sharding config: %w", err)
+	}
+	routing, err := ParseRoutingPolicy(data)
+	if err != nil {
+		return nil, fmt.Errorf("sharding config: %w", err)
+	}
+
+	config := &ShardingConfig{Routing: *routing, Tables: make(map[string]TablePolicy)}
+	for _, dir := range []string{".", "table-policies"} {
+		entries, err := fs.ReadDir(fsys, dir)
+		if err != nil {
+			if dir != "." && errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("sharding config: %w", err)
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			ext := path.Ext(name)
+			if entry.IsDir() || (ext != ".yaml" && ext != ".yml") || name == "routing-policy.yaml" {
+				continue
+			}
+			data, err := fs.ReadFile(fsys, path.Join(dir, name))
+			if err != nil {
+				return nil, fmt.Errorf("sharding config: %w", err)
+			}
+			policy, err := ParseTablePolicy(data)
+			if err != nil {
+				return nil, fmt.Errorf("sharding config: %s: %w", name, err)
+			}
+			config.Tables[normalizeTableName(strings.TrimSuffix(name, ext))] = *policy
+		}
+	}
+	return config, nil
+}
+
+// Table returns the policy of table
+func (s *ShardingConfig) Table(table string) (TablePolicy, bool) {
+	policy, ok := s.Tables[normalizeTableName(table)]
+	return policy, ok
+}
+
+// ShardKeyColumn returns the column routing table's rows, "" if the table
+// isn't sharded by a column
+func (s *ShardingConfig) ShardKeyColumn(table string) string {
+	policy, ok := s.Table(table)
+	if !ok {
+		return ""
+	}
+	if policy.Routing.ShardKey != "" {
+		return policy.Routing.ShardKey
+	}
+	return policy.ShardBy
+}
+
+// ShardFor returns the shard the gateway routes a query on table for
+// tenant to, given the routing key of the statement ("" if none). Tenant
+// assignments win, then the range whose prefix the key starts with, then
+// the hash of the table's strategy.
+func (s *ShardingConfig) ShardFor(tenant, table, key string) string {
+	if shard, ok := s.Routing.Tenants[tenant]; ok {
+		return shard
+	}
+	if key != "" {
+		for _, r := range s.Routing.Ranges {
+			if strings.HasPrefix(key, r.Prefix) {
+				return r.Shard
+			}
+		}
+	}
+
+	strategy := s.Routing.Defaults.Strategy
+	if policy, ok := s.Table(table); ok && policy.Routing.Strategy != "" {
+		strategy = policy.Routing.Strategy
+	}
+	switch strategy {
+	case StrategyTableHash:
+		return s.hashShard(tenant + ":" + normalizeTableName(table))
+	case StrategyCustom:
+		if key == "" {
+			key = tenant
+		}
+		return s.hashShard(key)
+	}
+	return s.hashShard(tenant)
+}
+
+// hashShard mirrors the gateway's hash routing, a 32-bit string hash over
+// UTF-16 code units, so both pick the same shard
+func (s *ShardingConfig) hashShard(key string) string {
+	var hash int32
+	for _, c := range utf16.Encode([]rune(key)) {
+		hash = hash<<5 - hash + int32(c)
+	}
+	n := int64(hash)
+	if n < 0 {
+		n = -n
+	}
+	count := s.Routing.Defaults.ShardCount
+	if count <= 0 {
+		count = DefaultShardCount
+	}
+	return fmt.Sprintf("shard_%d", n%int64(count))
+}
+
+// applyRoutingKey adds the shard key the statement filters on to the query
+// hints, so the gateway routes it without the caller passing one
+func (c *Client) applyRoutingKey(request map[string]interface{}) {
+	s := c.config.Sharding
+	if s == nil {
+		return
+	}
+	hints, _ := request["hints"].(map[string]interface{})
+	if hints != nil && hints["shardKey"] != nil {
+		return
+	}
+	sql, _ := request["sql"].(string)
+	params, _ := request["params"].([]interface{})
+	_, key, ok := s.RoutingKey(sql, params...)
+	if !ok {
+		return
+	}
+	if hints == nil {
+		hints = make(map[string]interface{})
+		request["hints"] = hints
+	}
+	hints["shardKey"] = key
+}
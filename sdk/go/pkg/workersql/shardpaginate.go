@@ -0,0 +1,226 @@
+package workersql
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// ShardPaginator fetches successive pages of a query spanning several
+// shards, merged into one ordered page stream. It keeps a keyset cursor per
+// shard, so each page reads at most Size+1 rows from every shard however
+// deep it is.
+type ShardPaginator struct {
+	client *Client
+	shards []string
+	sql    string
+	opts   PageOptions
+	// lastKeys holds the key of the last row returned from each shard
+	lastKeys  map[string][]interface{}
+	exhausted map[string]bool
+	done      bool
+	err       error
+}
+
+// shardPageCursor is the decoded form of a ShardPaginator cursor token
+type shardPageCursor struct {
+	Order string                   `json:"o"`
+	Keys  map[string][]interface{} `json:"k,omitempty"`
+	Done  []string                 `json:"d,omitempty"`
+}
+
+// PaginateShards returns a paginator over the rows of sql, a SELECT
+// statement without ORDER BY or LIMIT, on each of the given shards of
+// Config.Shards. Pages hold the next Size rows across all shards in the
+// order of the OrderBy key, which needs to be unique only within a shard;
+// rows with equal keys on different shards come in shard order.
+//
+//	p := client.PaginateShards([]string{"shard-0", "shard-1"}, "SELECT id, created_at FROM events",
+//		workersql.PageOptions{Size: 50, OrderBy: []string{"created_at", "id"}, Cursor: cursor})
+//	page, err := p.Next(ctx)
+//	// respond with page.Data and page.Cursor
+//
+// A shard failing fails the page rather than returning an incomplete one.
+func (c *Client) PaginateShards(shards []string, sql string, opts PageOptions) *ShardPaginator {
+	opts = opts.withDefaults()
+	p := &ShardPaginator{
+		client:    c,
+		shards:    shards,
+		sql:       sql,
+		opts:      opts,
+		lastKeys:  make(map[string][]interface{}),
+		exhausted: make(map[string]bool),
+	}
+	if opts.Cursor != "" {
+		p.err = p.decodeCursor(opts.Cursor)
+	}
+	p.done = len(shards) == 0
+	return p
+}
+
+// More reports whether Next may return another page
+func (p *ShardPaginator) More() bool {
+	return !p.done
+}
+
+// Next fetches the next page. It returns ErrNoMorePages once the last page
+// has been returned.
+func (p *ShardPaginator) Next(ctx context.Context) (*Page, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	if p.done {
+		return nil, ErrNoMorePages
+	}
+
+	var active []string
+	for _, shard := range p.shards {
+		if !p.exhausted[shard] {
+			active = append(active, shard)
+		}
+	}
+	results, err := p.fetch(ctx, active)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &mergeHeap{keys: p.sortKeys(), pos: make([]int, len(results))}
+	for i, r := range results {
+		h.lists = append(h.lists, r.Data)
+		if len(r.Data) > 0 {
+			h.items = append(h.items, i)
+		}
+	}
+	heap.Init(h)
+	rows := make([]map[string]interface{}, 0, p.opts.Size)
+	for h.Len() > 0 && len(rows) < p.opts.Size {
+		i := h.items[0]
+		rows = append(rows, h.lists[i][h.pos[i]])
+		h.pos[i]++
+		if h.pos[i] == len(h.lists[i]) {
+			heap.Pop(h)
+		} else {
+			heap.Fix(h, 0)
+		}
+	}
+
+	p.done = true
+	for i, shard := range active {
+		list := h.lists[i]
+		if taken := h.pos[i]; taken > 0 {
+			key, ok := rowKey(list[taken-1], p.opts.OrderBy)
+			if !ok {
+				return nil, fmt.Errorf("paginate: order columns %v missing from results of shard %q", p.opts.OrderBy, shard)
+			}
+			p.lastKeys[shard] = key
+		}
+		// One extra row is fetched from each shard to learn whether it has more
+		if h.pos[i] == len(list) && len(list) <= p.opts.Size {
+			p.exhausted[shard] = true
+		} else {
+			p.done = false
+		}
+	}
+
+	page := &Page{QueryResponse: &QueryResponse{Success: true, Data: rows, RowCount: len(rows)}}
+	for _, r := range results {
+		if len(r.Columns) > 0 {
+			page.Columns = r.Columns
+			break
+		}
+	}
+	if !p.done {
+		if page.Cursor, err = p.encodeCursor(); err != nil {
+			return nil, fmt.Errorf("paginate: %w", err)
+		}
+	}
+	return page, nil
+}
+
+// fetch queries the next rows of each shard concurrently
+func (p *ShardPaginator) fetch(ctx context.Context, shards []string) ([]*QueryResponse, error) {
+	results := make([]*QueryResponse, len(shards))
+	errs := make([]error, len(shards))
+	var wg sync.WaitGroup
+	for i, shard := range shards {
+		wg.Add(1)
+		go func(i int, shard string) {
+			defer wg.Done()
+			sql, params := keysetPageQuery(p.sql, p.opts, p.lastKeys[shard])
+			resp, err := p.client.QueryShard(ctx, shard, sql, params...)
+			if err == nil {
+				err = resp.failure()
+			}
+			results[i], errs[i] = resp, err
+		}(i, shard)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("paginate: %w", err)
+		}
+	}
+	return results, nil
+}
+
+func (p *ShardPaginator) sortKeys() []SortKey {
+	keys := make([]SortKey, len(p.opts.OrderBy))
+	for i, col := range p.opts.OrderBy {
+		keys[i] = SortKey{Column: col, Descending: p.opts.Descending}
+	}
+	return keys
+}
+
+func (p *ShardPaginator) encodeCursor() (string, error) {
+	cursor := shardPageCursor{Order: pageOrder(p.opts), Keys: p.lastKeys}
+	for _, shard := range p.shards {
+		if p.exhausted[shard] {
+			cursor.Done = append(cursor.Done, shard)
+		}
+	}
+	encoded, err := json.Marshal(cursor)
+	if err != nil {
+		return "", fmt.Errorf("encoding cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(encoded), nil
+}
+
+func (p *ShardPaginator) decodeCursor(token string) error {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return fmt.Errorf("paginate: %w", ErrInvalidCursor)
+	}
+
+	var cursor shardPageCursor
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&cursor); err != nil {
+		return fmt.Errorf("paginate: %w", ErrInvalidCursor)
+	}
+	if cursor.Order != pageOrder(p.opts) {
+		return fmt.Errorf("paginate: %w: issued for a different ordering", ErrInvalidCursor)
+	}
+
+	known := make(map[string]bool, len(p.shards))
+	for _, shard := range p.shards {
+		known[shard] = true
+	}
+	for shard, key := range cursor.Keys {
+		if !known[shard] || len(key) != len(p.opts.OrderBy) {
+			return fmt.Errorf("paginate: %w: issued for different shards", ErrInvalidCursor)
+		}
+		p.lastKeys[shard] = key
+	}
+	for _, shard := range cursor.Done {
+		if !known[shard] {
+			return fmt.Errorf("paginate: %w: issued for different shards", ErrInvalidCursor)
+		}
+		p.exhausted[shard] = true
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+package workersql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/internal/breaker"
+)
+
+// ErrShardUnavailable is returned for calls to a shard whose circuit
+// breaker is open after repeated failures
+var ErrShardUnavailable = errors.New("shard unavailable: circuit open")
+
+// ErrUnknownShard is returned for a shard ID missing from Config.Shards
+var ErrUnknownShard = errors.New("unknown shard")
+
+// ShardBreakerConfig tunes the per-shard circuit breakers
+type ShardBreakerConfig struct {
+	// FailureThreshold is the number of failures within Window that opens
+	// a shard's circuit (default: 5)
+	FailureThreshold int
+	// Window is the sliding window failures are counted in (default: 30s)
+	Window time.Duration
+	// Cooldown is how long calls to an open shard fail fast before one
+	// trial call is let through (default: 15s)
+	Cooldown time.Duration
+}
+
+// PartialFailure reports the shards that failed in a call spanning several
+// shards. errors.Is matches the errors of the individual shards.
+type PartialFailure struct {
+	// Failed maps shard IDs to their errors
+	Failed map[string]error
+	// Total is the number of shards the call spanned
+	Total int
+}
+
+func (p *PartialFailure) Error() string {
+	ids := p.shardIDs()
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = fmt.Sprintf("%s: %v", id, p.Failed[id])
+	}
+	return fmt.Sprintf("%d of %d shards failed: %s", len(ids), p.Total, strings.Join(parts, "; "))
+}
+
+func (p *PartialFailure) Unwrap() []error {
+	errs := make([]error, 0, len(p.Failed))
+	for _, id := range p.shardIDs() {
+		errs = append(errs, p.Failed[id])
+	}
+	return errs
+}
+
+func (p *PartialFailure) shardIDs() []string {
+	ids := make([]string, 0, len(p.Failed))
+	for id := range p.Failed {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// ShardResult is the outcome of a query on one shard
+type ShardResult struct {
+	Shard    string
+	Response *QueryResponse
+	Err      error
+	Duration time.Duration
+}
+
+// ShardQueryOptions controls calls spanning several shards
+type ShardQueryOptions struct {
+	// AllowPartial returns the results of the shards that answered when
+	// others fail, reporting the failures in ShardQueryResult.Partial,
+	// instead of failing the whole call. The call still fails if every
+	// shard does.
+	AllowPartial bool
+}
+
+// ShardQueryResult holds the per-shard results of QueryShards
+type ShardQueryResult struct {
+	// Results are in the order the shards were given
+	Results []ShardResult
+	// Partial is set when AllowPartial was used and some shards failed
+	Partial *PartialFailure
+}
+
+// Responses returns the responses of the shards that succeeded
+func (r *ShardQueryResult) Responses() []*QueryResponse {
+	responses := make([]*QueryResponse, 0, len(r.Results))
+	for _, res := range r.Results {
+		if res.Err == nil {
+			responses = append(responses, res.Response)
+		}
+	}
+	return responses
+}
+
+type endpointKey struct{}
+
+// withEndpoint sends requests made with ctx to endpoint instead of
+// Config.APIEndpoint or the balanced Config.Endpoints
+func withEndpoint(ctx context.Context, endpoint string) context.Context {
+	return context.WithValue(ctx, endpointKey{}, endpoint)
+}
+
+func (c *Client) endpoint(ctx context.Context) string {
+	if endpoint, ok := ctx.Value(endpointKey{}).(string); ok {
+		return endpoint
+	}
+	if c.balancer != nil {
+		return c.balancer.pick()
+	}
+	return c.config.APIEndpoint
+}
+
+func newShardBreakers(config Config) *breaker.Set {
+	if len(config.Shards) == 0 {
+		return nil
+	}
+	opts := breaker.Options{}
+	if b := config.ShardBreaker; b != nil {
+		opts = breaker.Options{FailureThreshold: b.FailureThreshold, Window: b.Window, Cooldown: b.Cooldown}
+	}
+	return breaker.NewSet(opts)
+}
+
+// QueryShard runs a query on one shard of Config.Shards. Calls to a shard
+// that keeps failing fail fast with ErrShardUnavailable until its circuit
+// breaker lets a trial call through.
+func (c *Client) QueryShard(ctx context.Context, shard string, sql string, params ...interface{}) (*QueryResponse, error) {
+	var resp *QueryResponse
+	err := c.onShard(ctx, shard, func(ctx context.Context) (err error) {
+		resp, err = c.Query(ctx, sql, params...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// ExecShard executes a statement on one shard of Config.Shards, guarded by
+// the shard's circuit breaker like QueryShard
+func (c *Client) ExecShard(ctx context.Context, shard string, sql string, params ...interface{}) (*ExecResponse, error) {
+	var resp *ExecResponse
+	err := c.onShard(ctx, shard, func(ctx context.Context) (err error) {
+		resp, err = c.Exec(ctx, sql, params...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// onShard runs call against the endpoint of shard, recording the outcome
+// with the shard's circuit breaker
+func (c *Client) onShard(ctx context.Context, shard string, call func(context.Context) error) error {
+	endpoint, ok := c.config.Shards[shard]
+	if !ok {
+		return fmt.Errorf("shard %q: %w", shard, ErrUnknownShard)
+	}
+	if !c.breakers.Allow(shard) {
+		return fmt.Errorf("shard %q: %w", shard, ErrShardUnavailable)
+	}
+
+	err := call(withEndpoint(ctx, endpoint))
+	if isShardFailure(ctx, err) {
+		c.breakers.Failure(shard)
+	} else {
+		c.breakers.Success(shard)
+	}
+	if err != nil {
+		return fmt.Errorf("shard %q: %w", shard, err)
+	}
+	return nil
+}
+
+// QueryShards runs a query on the given shards concurrently. Without
+// AllowPartial the call fails with a *PartialFailure if any shard fails;
+// with it, results are returned as long as one shard answered.
+func (c *Client) QueryShards(ctx context.Context, shards []string, sql string, params []interface{}, opts ShardQueryOptions) (*ShardQueryResult, error) {
+	result := &ShardQueryResult{Results: make([]ShardResult, len(shards))}
+	var wg sync.WaitGroup
+	for i, shard := range shards {
+		wg.Add(1)
+		go func(i int, shard string) {
+			defer wg.Done()
+			start := time.Now()
+			resp, err := c.QueryShard(ctx, shard, sql, params...)
+			if err == nil {
+				err = resp.failure()
+			}
+			result.Results[i] = ShardResult{Shard: shard, Response: resp, Err: err, Duration: time.Since(start)}
+		}(i, shard)
+	}
+	wg.Wait()
+
+	failure := &PartialFailure{Failed: make(map[string]error), Total: len(shards)}
+	for _, res := range result.Results {
+		if res.Err != nil {
+			failure.Failed[res.Shard] = res.Err
+		}
+	}
+	switch {
+	case len(failure.Failed) == 0:
+		return result, nil
+	case opts.AllowPartial && len(failure.Failed) < len(shards):
+		result.Partial = failure
+		return result, nil
+	}
+	return nil, failure
+}
+
+// ScatterResult is the merged result of QueryAllShards along with the
+// outcome and timing of each shard
+type ScatterResult struct {
+	*QueryResponse
+	// Shards holds the per-shard results, ordered by shard ID
+	Shards []ShardResult
+}
+
+// QueryAllShards runs a query without a shard key on every shard of
+// Config.Shards concurrently and merges the rows with MergeResults. The
+// query should have the ORDER BY of opts.OrderBy; a LIMIT is pushed down
+// with PushDownLimit so no shard returns more rows than the merged result
+// needs. Any shard failing fails the call with a *PartialFailure holding
+// each shard's error; to tolerate missing shards, use QueryShards with
+// AllowPartial and merge its responses.
+func (c *Client) QueryAllShards(ctx context.Context, sql string, params []interface{}, opts MergeOptions) (*ScatterResult, error) {
+	if len(c.config.Shards) == 0 {
+		return nil, fmt.Errorf("query all shards: no shards configured")
+	}
+	shards := make([]string, 0, len(c.config.Shards))
+	for shard := range c.config.Shards {
+		shards = append(shards, shard)
+	}
+	sort.Strings(shards)
+
+	result, err := c.QueryShards(ctx, shards, PushDownLimit(sql, opts), params, ShardQueryOptions{})
+	if err != nil {
+		return nil, err
+	}
+	merged, err := MergeResults(result.Responses(), opts)
+	if err != nil {
+		return nil, err
+	}
+	return &ScatterResult{QueryResponse: merged, Shards: result.Results}, nil
+}
+
+// ShardCircuitState returns the circuit breaker state of a shard:
+// "closed", "open" or "half_open"
+func (c *Client) ShardCircuitState(shard string) string {
+	if c.breakers == nil {
+		return string(breaker.Closed)
+	}
+	return string(c.breakers.State(shard))
+}
+
+// isShardFailure reports whether err means the shard, rather than the
+// request or the caller, failed
+func isShardFailure(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	var status *statusError
+	if errors.As(err, &status) {
+		return status.status >= 500
+	}
+	return !errors.Is(err, ErrClientClosed)
+}
@@ -0,0 +1,180 @@
+package workersql
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// lifecycle tracks in-flight HTTP requests and open transactions so
+// Shutdown can wait for them, and rejects new work once shutdown begins
+type lifecycle struct {
+	mu           sync.Mutex
+	closing      bool
+	requests     int
+	transactions int
+	// drained is closed once closing and nothing is in flight
+	drained chan struct{}
+}
+
+func newLifecycle() *lifecycle {
+	return &lifecycle{drained: make(chan struct{})}
+}
+
+// enter registers a request or transaction, failing with ErrClientClosed
+// after shutdown began
+func (l *lifecycle) enter(tx bool) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closing {
+		return ErrClientClosed
+	}
+	if tx {
+		l.transactions++
+	} else {
+		l.requests++
+	}
+	return nil
+}
+
+func (l *lifecycle) leave(tx bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if tx {
+		l.transactions--
+	} else {
+		l.requests--
+	}
+	l.checkDrained()
+}
+
+// close stops new work and returns a channel closed once in-flight work
+// has finished
+func (l *lifecycle) close() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.closing {
+		l.closing = true
+		l.checkDrained()
+	}
+	return l.drained
+}
+
+// checkDrained closes drained when shutdown is complete. l.mu must be held.
+func (l *lifecycle) checkDrained() {
+	if l.closing && l.requests == 0 && l.transactions == 0 {
+		select {
+		case <-l.drained:
+		default:
+			close(l.drained)
+		}
+	}
+}
+
+type admittedKey struct{}
+
+// withAdmitted marks the requests sent with ctx as part of work the
+// lifecycle already tracks, such as an open transaction, so they are sent
+// during shutdown without being counted again
+func withAdmitted(ctx context.Context) context.Context {
+	return context.WithValue(ctx, admittedKey{}, true)
+}
+
+func admitted(ctx context.Context) bool {
+	return ctx.Value(admittedKey{}) != nil
+}
+
+func (l *lifecycle) isClosing() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.closing
+}
+
+func (l *lifecycle) inFlight() (requests, transactions int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.requests, l.transactions
+}
+
+// Shutdown gracefully closes the client. New queries and transactions fail
+// with ErrClientClosed straight away, while requests in flight and open
+// transactions may finish; statements of open transactions keep working
+// until they commit or roll back. Writes waiting in the write batcher are
+// sent at once, and those queued for a dead-letter retry are retried
+// straight away. Once everything is done, or when ctx ends, the pool and
+// WebSocket sessions are closed. If ctx ended first the remaining work is
+// abandoned and the context error is returned.
+func (c *Client) Shutdown(ctx context.Context) error {
+	return c.shutdown(ctx, 0, nil)
+}
+
+// DrainProgress is the work a shutting down client is still waiting for
+type DrainProgress struct {
+	Requests     int
+	Transactions int
+	// QueuedWrites counts failed writes waiting for a dead-letter retry
+	QueuedWrites int
+	// Elapsed is the time since shutdown began
+	Elapsed time.Duration
+}
+
+// Done reports whether nothing is left
+func (p DrainProgress) Done() bool {
+	return p.Requests == 0 && p.Transactions == 0 && p.QueuedWrites == 0
+}
+
+// shutdownPoll is how often shutdown checks the dead-letter queue
+const shutdownPoll = 10 * time.Millisecond
+
+// shutdown runs Shutdown, calling onProgress every interval while waiting
+func (c *Client) shutdown(ctx context.Context, interval time.Duration, onProgress func(DrainProgress)) error {
+	start := time.Now()
+	drained := c.life.close()
+	c.batcher.drain()
+	c.deadLetters.drain()
+
+	progress := func() DrainProgress {
+		requests, transactions := c.life.inFlight()
+		return DrainProgress{
+			Requests:     requests,
+			Transactions: transactions,
+			QueuedWrites: c.deadLetters.queued(),
+			Elapsed:      time.Since(start),
+		}
+	}
+	var report <-chan time.Time
+	if onProgress != nil && interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		report = ticker.C
+	}
+	poll := time.NewTicker(shutdownPoll)
+	defer poll.Stop()
+
+	var waitErr error
+wait:
+	for {
+		select {
+		case <-drained:
+			// Only the dead-letter queue is left to watch
+			drained = nil
+		case <-poll.C:
+		case <-report:
+			onProgress(progress())
+		case <-ctx.Done():
+			p := progress()
+			waitErr = fmt.Errorf("shutdown: abandoning %d requests, %d transactions and %d queued writes: %w",
+				p.Requests, p.Transactions, p.QueuedWrites, ctx.Err())
+			break wait
+		}
+		if drained == nil && c.deadLetters.queued() == 0 {
+			break
+		}
+	}
+
+	if err := c.Close(); err != nil && waitErr == nil {
+		return err
+	}
+	return waitErr
+}
@@ -0,0 +1,84 @@
+package workersql
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Signal shutdown defaults
+const (
+	// DefaultShutdownGracePeriod leaves room within Kubernetes' default
+	// 30s termination grace period for the rest of the process
+	DefaultShutdownGracePeriod = 25 * time.Second
+	DefaultDrainProgressPeriod = time.Second
+)
+
+// SignalShutdownConfig configures ShutdownOnSignal
+type SignalShutdownConfig struct {
+	// Signals start the shutdown (default: SIGTERM and SIGINT)
+	Signals []os.Signal
+	// GracePeriod bounds the drain, after which the remaining work is
+	// abandoned (default: 25s)
+	GracePeriod time.Duration
+	// ProgressInterval is how often OnProgress is called while draining
+	// (default: 1s)
+	ProgressInterval time.Duration
+	// OnProgress, if set, is called with the work left while draining
+	OnProgress func(DrainProgress)
+	// OnShutdown, if set, is called with the result of the shutdown once
+	// the client is closed, typically to let the process exit
+	OnShutdown func(error)
+}
+
+// ShutdownOnSignal shuts the client down gracefully, as by Shutdown within
+// config.GracePeriod, when the process gets one of config.Signals. From
+// the signal on, new queries fail with ErrClientClosed and
+// ReadinessHandler reports the client unavailable. The returned stop
+// stops listening; it doesn't interrupt a shutdown that has begun.
+//
+//	done := make(chan struct{})
+//	client.ShutdownOnSignal(workersql.SignalShutdownConfig{
+//		OnProgress: func(p workersql.DrainProgress) { log.Printf("draining: %+v", p) },
+//		OnShutdown: func(err error) { close(done) },
+//	})
+func (c *Client) ShutdownOnSignal(config SignalShutdownConfig) (stop func()) {
+	if len(config.Signals) == 0 {
+		config.Signals = []os.Signal{syscall.SIGTERM, os.Interrupt}
+	}
+	if config.GracePeriod <= 0 {
+		config.GracePeriod = DefaultShutdownGracePeriod
+	}
+	if config.ProgressInterval <= 0 {
+		config.ProgressInterval = DefaultDrainProgressPeriod
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, config.Signals...)
+	stopped := make(chan struct{})
+	go func() {
+		select {
+		case <-signals:
+		case <-stopped:
+			return
+		}
+		signal.Stop(signals)
+		ctx, cancel := context.WithTimeout(context.Background(), config.GracePeriod)
+		defer cancel()
+		err := c.shutdown(ctx, config.ProgressInterval, config.OnProgress)
+		if config.OnShutdown != nil {
+			config.OnShutdown(err)
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(signals)
+			close(stopped)
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package workersql
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Slow-query reporting defaults
+const (
+	DefaultSlowQueryThreshold   = time.Second
+	DefaultExplainInterval      = 10 * time.Minute
+	DefaultMaxExplainsPerMinute = 10
+	DefaultExplainTimeout       = 5 * time.Second
+)
+
+// SlowQueryConfig reports Query and Exec calls slower than a threshold,
+// optionally with the plan of the statement captured by an EXPLAIN sent
+// right after it
+type SlowQueryConfig struct {
+	// Threshold is how long a call may take, retries included, before it
+	// is reported (default: 1s)
+	Threshold time.Duration
+	// Handler receives the slow queries. It is called from the goroutine of
+	// the slow call, or of its EXPLAIN when one is sent, and shouldn't
+	// block.
+	Handler func(SlowQuery)
+
+	// Explain sends an EXPLAIN of slow SELECT, INSERT, UPDATE, DELETE and
+	// REPLACE statements in the background and attaches the plan to the
+	// SlowQuery
+	Explain bool
+	// ExplainInterval is how long after explaining a fingerprint its slow
+	// queries are reported without a plan, so a query that is always slow
+	// is explained once in a while (default: 10m)
+	ExplainInterval time.Duration
+	// MaxExplainsPerMinute caps the EXPLAINs sent, so a slow database isn't
+	// flooded with them (default: 10)
+	MaxExplainsPerMinute int
+	// ExplainTimeout bounds each EXPLAIN (default: 5s)
+	ExplainTimeout time.Duration
+}
+
+// SlowQuery is a call that took longer than SlowQueryConfig.Threshold
+type SlowQuery struct {
+	// Op is "Query" or "Exec"
+	Op          string
+	SQL         string
+	Params      []interface{}
+	Fingerprint string
+	Duration    time.Duration
+	// Err is the error of the call, if it failed
+	Err error
+	// Plan holds the rows of the statement's EXPLAIN, nil when none was
+	// sent
+	Plan []map[string]interface{}
+	// ExplainErr is why the EXPLAIN that was sent failed
+	ExplainErr error
+}
+
+// slowQueryReporter reports slow calls and explains them. The methods of a
+// nil reporter do nothing.
+type slowQueryReporter struct {
+	client *Client
+	config SlowQueryConfig
+	now    func() time.Time
+	// ctx ends the EXPLAINs in flight on close
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu sync.Mutex
+	// explained holds when each fingerprint was last explained
+	explained map[string]time.Time
+	// window and sent count the EXPLAINs of the current minute
+	window time.Time
+	sent   int
+}
+
+func newSlowQueryReporter(client *Client, config *SlowQueryConfig) *slowQueryReporter {
+	if config == nil || config.Handler == nil {
+		return nil
+	}
+	r := &slowQueryReporter{
+		client:    client,
+		config:    *config,
+		now:       time.Now,
+		explained: make(map[string]time.Time),
+	}
+	if r.config.Threshold <= 0 {
+		r.config.Threshold = DefaultSlowQueryThreshold
+	}
+	if r.config.ExplainInterval <= 0 {
+		r.config.ExplainInterval = DefaultExplainInterval
+	}
+	if r.config.MaxExplainsPerMinute <= 0 {
+		r.config.MaxExplainsPerMinute = DefaultMaxExplainsPerMinute
+	}
+	if r.config.ExplainTimeout <= 0 {
+		r.config.ExplainTimeout = DefaultExplainTimeout
+	}
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+	return r
+}
+
+// observe reports the call of request that started at start, if it was
+// slow
+func (r *slowQueryReporter) observe(op string, request map[string]interface{}, start time.Time, err error) {
+	if r == nil {
+		return
+	}
+	elapsed := r.now().Sub(start)
+	if elapsed < r.config.Threshold {
+		return
+	}
+	atomic.AddInt64(&r.client.stats.slowQueries, 1)
+
+	sql, _ := request["sql"].(string)
+	params, _ := request["params"].([]interface{})
+	slow := SlowQuery{
+		Op:          op,
+		SQL:         sql,
+		Params:      params,
+		Fingerprint: Fingerprint(sql),
+		Duration:    elapsed,
+		Err:         err,
+	}
+	if !r.admitExplain(slow.Fingerprint, sql) {
+		r.config.Handler(slow)
+		return
+	}
+
+	explain := make(map[string]interface{}, len(request))
+	for k, v := range request {
+		if k != "mode" {
+			explain[k] = v
+		}
+	}
+	explain["sql"] = "EXPLAIN " + sql
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		slow.Plan, slow.ExplainErr = r.explain(explain)
+		r.config.Handler(slow)
+	}()
+}
+
+// admitExplain reports whether a slow statement with fingerprint should be
+// explained, recording it as explained if so
+func (r *slowQueryReporter) admitExplain(fingerprint, sql string) bool {
+	if !r.config.Explain {
+		return false
+	}
+	switch firstKeyword(sql) {
+	case "SELECT", "INSERT", "UPDATE", "DELETE", "REPLACE":
+	default:
+		return false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	if last, ok := r.explained[fingerprint]; ok && now.Sub(last) < r.config.ExplainInterval {
+		return false
+	}
+	if now.Sub(r.window) >= time.Minute {
+		r.window = now
+		r.sent = 0
+		// Forget fingerprints that may be explained again
+		for fp, last := range r.explained {
+			if now.Sub(last) >= r.config.ExplainInterval {
+				delete(r.explained, fp)
+			}
+		}
+	}
+	if r.sent >= r.config.MaxExplainsPerMinute {
+		return false
+	}
+	r.sent++
+	r.explained[fingerprint] = now
+	return true
+}
+
+// explain sends request, an EXPLAIN, once. It doesn't carry the context of
+// the slow call, whose idempotency key would make the gateway dedupe it
+// with a write.
+func (r *slowQueryReporter) explain(request map[string]interface{}) ([]map[string]interface{}, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, r.config.ExplainTimeout)
+	defer cancel()
+
+	var response QueryResponse
+	if err := r.client.sendQuery(ctx, request, &response); err != nil {
+		return nil, err
+	}
+	if !response.Success {
+		if response.Error != nil {
+			return nil, fmt.Errorf("%s: %s", response.Error.Code, response.Error.Message)
+		}
+		return nil, fmt.Errorf("explain failed")
+	}
+	return response.Data, nil
+}
+
+// close ends the EXPLAINs in flight, waiting for their slow queries to be
+// handled
+func (r *slowQueryReporter) close() {
+	if r == nil {
+		return
+	}
+	r.cancel()
+	r.wg.Wait()
+}
@@ -0,0 +1,263 @@
+package workersql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ErrSnapshotExpired is returned by queries on a snapshot whose token has
+// expired or been released
+var ErrSnapshotExpired = errors.New("snapshot token has expired or been released")
+
+// ErrReadOnly is returned when a statement that may write is run on a
+// read-only snapshot
+var ErrReadOnly = errors.New("statement is not allowed in a read-only snapshot")
+
+// snapshotResponse is the gateway's reply to a snapshot request
+type snapshotResponse struct {
+	Success   bool           `json:"success"`
+	Token     string         `json:"token"`
+	ExpiresAt time.Time      `json:"expiresAt"`
+	AsOf      time.Time      `json:"asOf"`
+	Error     *ErrorResponse `json:"error,omitempty"`
+}
+
+// Snapshot is a consistent read-only view of the database obtained with a
+// single HTTP call. Every query run through it carries the snapshot token,
+// so multiple reads observe the same state without opening a WebSocket
+// transaction.
+type Snapshot struct {
+	client    *Client
+	token     string
+	expiresAt time.Time
+	asOf      time.Time
+	released  int32
+}
+
+// BeginSnapshot obtains a snapshot token for consistent read-only queries
+func (c *Client) BeginSnapshot(ctx context.Context) (*Snapshot, error) {
+	return c.beginSnapshot(ctx, time.Time{})
+}
+
+// BeginSnapshotAt obtains a snapshot of the database as it was at asOf,
+// from the history the platform retains
+func (c *Client) BeginSnapshotAt(ctx context.Context, asOf time.Time) (*Snapshot, error) {
+	if asOf.IsZero() || asOf.After(time.Now()) {
+		return nil, fmt.Errorf("failed to begin snapshot: as-of time %v is not in the past", asOf)
+	}
+	return c.beginSnapshot(ctx, asOf)
+}
+
+// Snapshot obtains a snapshot and returns its token. Reads made with the
+// token in QueryOptions.Snapshot, from any goroutine or process, see the
+// same state until the token expires or ReleaseSnapshot releases it.
+func (c *Client) Snapshot(ctx context.Context) (string, error) {
+	snap, err := c.BeginSnapshot(ctx)
+	if err != nil {
+		return "", err
+	}
+	return snap.token, nil
+}
+
+// ReleaseSnapshot tells the gateway the snapshot of token is no longer
+// needed
+func (c *Client) ReleaseSnapshot(ctx context.Context, token string) error {
+	request := map[string]interface{}{"token": token}
+	return c.doRequest(ctx, "POST", "/snapshot/release", request, nil)
+}
+
+func (c *Client) beginSnapshot(ctx context.Context, asOf time.Time) (*Snapshot, error) {
+	body := map[string]interface{}{}
+	if !asOf.IsZero() {
+		body["asOf"] = formatAsOf(asOf)
+	}
+	var response snapshotResponse
+	err := c.retryStrategy.Execute(ctx, func() error {
+		return c.doRequest(ctx, "POST", "/snapshot", body, &response)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin snapshot: %w", err)
+	}
+	if !response.Success || response.Token == "" {
+		if response.Error != nil {
+			return nil, fmt.Errorf("failed to begin snapshot: %s: %s", response.Error.Code, response.Error.Message)
+		}
+		return nil, fmt.Errorf("failed to begin snapshot: no token returned")
+	}
+
+	if response.AsOf.IsZero() {
+		response.AsOf = asOf
+	}
+	return &Snapshot{client: c, token: response.Token, expiresAt: response.ExpiresAt, asOf: response.AsOf}, nil
+}
+
+// ReadOnly runs fn with a snapshot and releases it afterwards
+func (c *Client) ReadOnly(ctx context.Context, fn func(ctx context.Context, snap *Snapshot) error) error {
+	snap, err := c.BeginSnapshot(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = snap.Release(ctx) }()
+
+	return fn(ctx, snap)
+}
+
+// Token returns the snapshot token sent with each query
+func (s *Snapshot) Token() string {
+	return s.token
+}
+
+// ExpiresAt returns when the gateway discards the snapshot. It is the zero
+// time when the gateway did not report an expiry.
+func (s *Snapshot) ExpiresAt() time.Time {
+	return s.expiresAt
+}
+
+// AsOf returns the point in time the snapshot reads, as reported by the
+// gateway or requested with BeginSnapshotAt. It is the zero time for a
+// snapshot of the current state whose time the gateway did not report.
+func (s *Snapshot) AsOf() time.Time {
+	return s.asOf
+}
+
+// Query executes a read-only query against the snapshot
+func (s *Snapshot) Query(ctx context.Context, sql string, params ...interface{}) (*QueryResponse, error) {
+	if err := s.check(sql); err != nil {
+		return nil, err
+	}
+
+	sql, params, err := expandParams(sql, params)
+	if err != nil {
+		return nil, err
+	}
+
+	request := map[string]interface{}{
+		"sql":      sql,
+		"snapshot": s.token,
+		"hints":    map[string]interface{}{"consistency": "strong"},
+	}
+	if len(params) > 0 {
+		request["params"] = params
+	}
+
+	return s.client.query(ctx, request)
+}
+
+// QueryRow executes a read-only query expected to return a single row
+func (s *Snapshot) QueryRow(ctx context.Context, sql string, params ...interface{}) (map[string]interface{}, error) {
+	response, err := s.Query(ctx, sql, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	if !response.Success {
+		if response.Error != nil {
+			return nil, fmt.Errorf("%s: %s", response.Error.Code, response.Error.Message)
+		}
+		return nil, fmt.Errorf("query failed")
+	}
+
+	if len(response.Data) == 0 {
+		return nil, fmt.Errorf("no rows returned")
+	}
+
+	return response.Data[0], nil
+}
+
+// Export streams a table or query result like Client.Export, reading it
+// from the snapshot
+func (s *Snapshot) Export(ctx context.Context, spec ExportSpec) (*ExportCheckpoint, error) {
+	return export(ctx, spec, s.Query)
+}
+
+// ExportSnapshot exports several tables or queries, in order, from one
+// snapshot, so the exported rows are a consistent view of the database
+// with no write landing between two tables. It returns the checkpoint of
+// each spec exported so far. Exports can't resume from a checkpoint, as
+// that would mix the state of two snapshots; an interrupted export must be
+// run again, and take less than the snapshot's lifetime.
+func (c *Client) ExportSnapshot(ctx context.Context, specs ...ExportSpec) ([]*ExportCheckpoint, error) {
+	for _, spec := range specs {
+		if spec.Checkpoint != nil {
+			return nil, fmt.Errorf("export: a snapshot export can't resume from a checkpoint")
+		}
+	}
+	var checkpoints []*ExportCheckpoint
+	err := c.ReadOnly(ctx, func(ctx context.Context, snap *Snapshot) error {
+		for _, spec := range specs {
+			checkpoint, err := snap.Export(ctx, spec)
+			if checkpoint != nil {
+				checkpoints = append(checkpoints, checkpoint)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return checkpoints, err
+}
+
+// Release tells the gateway the snapshot is no longer needed. Further
+// queries return ErrSnapshotExpired.
+func (s *Snapshot) Release(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&s.released, 0, 1) {
+		return nil
+	}
+	return s.client.ReleaseSnapshot(ctx, s.token)
+}
+
+// formatAsOf formats a point in time for the gateway
+func formatAsOf(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// check rejects queries on a released or expired snapshot and statements
+// that may write
+func (s *Snapshot) check(sql string) error {
+	if atomic.LoadInt32(&s.released) == 1 {
+		return ErrSnapshotExpired
+	}
+	if !s.expiresAt.IsZero() && time.Now().After(s.expiresAt) {
+		return ErrSnapshotExpired
+	}
+	if !isReadStatement(sql) {
+		return ErrReadOnly
+	}
+	return nil
+}
+
+// firstKeyword returns the upper-cased first keyword of sql, skipping
+// leading whitespace, comments and parentheses
+func firstKeyword(sql string) string {
+	s := sql
+	for {
+		s = strings.TrimLeft(s, " \t\r\n(")
+		switch {
+		case strings.HasPrefix(s, "--"), strings.HasPrefix(s, "#"):
+			i := strings.IndexByte(s, '\n')
+			if i < 0 {
+				return ""
+			}
+			s = s[i+1:]
+		case strings.HasPrefix(s, "/*"):
+			i := strings.Index(s, "*/")
+			if i < 0 {
+				return ""
+			}
+			s = s[i+2:]
+		default:
+			end := strings.IndexFunc(s, func(r rune) bool {
+				return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z')
+			})
+			if end < 0 {
+				end = len(s)
+			}
+			return strings.ToUpper(s[:end])
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package workersql
+
+import "context"
+
+// staleRead is the stale-while-revalidate read mode of a call
+type staleRead struct {
+	onFresh func(*QueryResponse, error)
+}
+
+type staleReadKey struct{}
+
+// WithStaleWhileRevalidate returns a context whose reads are answered from
+// Config.ResultCache whenever it holds a result, however old, so
+// latency-critical paths never wait on the gateway for data they have
+// seen. An expired result comes back with Stale set while one background
+// query refreshes it, and onFresh, if not nil, is called with the fresh
+// result or the refresh's error once it arrives. Reads missing the cache
+// are sent as usual and don't call onFresh. Without ResultCache the mode
+// has no effect.
+func WithStaleWhileRevalidate(ctx context.Context, onFresh func(*QueryResponse, error)) context.Context {
+	return context.WithValue(ctx, staleReadKey{}, &staleRead{onFresh: onFresh})
+}
+
+// staleReadFrom returns the stale-while-revalidate mode of ctx, or nil
+func staleReadFrom(ctx context.Context) *staleRead {
+	read, _ := ctx.Value(staleReadKey{}).(*staleRead)
+	return read
+}
@@ -0,0 +1,244 @@
+package workersql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Standby defaults
+const (
+	DefaultStandbyCheckInterval     = 5 * time.Second
+	DefaultStandbyFailureThreshold  = 3
+	DefaultStandbyRecoveryThreshold = 3
+)
+
+// ErrStandbyWriteRefused is returned for writes while the standby is
+// promoted, when StandbyConfig.PromoteWrites isn't set or its WriteGuard
+// refused them
+var ErrStandbyWriteRefused = errors.New("write refused on promoted standby")
+
+// StandbyConfig configures Config.Standby
+type StandbyConfig struct {
+	// APIEndpoint is the standby gateway, serving a replica of the
+	// primary's database. It is called with Config.APIKey.
+	APIEndpoint string
+	// CheckInterval is how often the /health of the primary and of the
+	// standby are checked (default: 5s)
+	CheckInterval time.Duration
+	// FailureThreshold is how many consecutive failed requests or health
+	// checks of the primary promote the standby, if its last check passed
+	// (default: 3). Failures are transport errors and 5xx responses.
+	FailureThreshold int
+	// RecoveryThreshold is how many consecutive successful requests or
+	// health checks of the primary demote the standby again (default: 3)
+	RecoveryThreshold int
+	// PromoteWrites sends writes to the promoted standby too, once
+	// WriteGuard allows them. Without it, only reads fail over and writes
+	// fail with ErrStandbyWriteRefused while the standby is promoted.
+	PromoteWrites bool
+	// WriteGuard, if set, is asked before each write sent to the promoted
+	// standby and refuses it by returning an error, e.g. until the primary
+	// has been down long enough to rule out a network blip that would
+	// leave two databases taking writes
+	WriteGuard func(ctx context.Context, status StandbyStatus) error
+	// OnPromote, if set, is called with the primary's last error when the
+	// standby is promoted
+	OnPromote func(err error)
+	// OnDemote, if set, is called with how long the standby was promoted
+	// when the primary recovers
+	OnDemote func(promoted time.Duration)
+}
+
+// StandbyStatus is the state of Config.Standby
+type StandbyStatus struct {
+	Endpoint string `json:"endpoint"`
+	// Promoted is set while requests go to the standby
+	Promoted   bool      `json:"promoted"`
+	PromotedAt time.Time `json:"promotedAt,omitempty"`
+	// PrimaryFailures counts the primary's consecutive failures, and
+	// LastError is the latest of them
+	PrimaryFailures int    `json:"primaryFailures"`
+	LastError       string `json:"lastError,omitempty"`
+	// StandbyHealthy is set while the standby's last request or health
+	// check succeeded
+	StandbyHealthy bool `json:"standbyHealthy"`
+}
+
+// standby promotes a standby gateway while the primary keeps failing. The
+// methods of a nil standby do nothing.
+type standby struct {
+	client *Client
+	config StandbyConfig
+
+	mu              sync.Mutex
+	promotedAt      time.Time
+	primaryFailures int
+	primaryPasses   int
+	lastErr         error
+	standbyFailures int
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+func newStandby(client *Client, config *StandbyConfig) *standby {
+	if config == nil || config.APIEndpoint == "" {
+		return nil
+	}
+	s := &standby{client: client, config: *config, stop: make(chan struct{})}
+	if s.config.CheckInterval <= 0 {
+		s.config.CheckInterval = DefaultStandbyCheckInterval
+	}
+	if s.config.FailureThreshold <= 0 {
+		s.config.FailureThreshold = DefaultStandbyFailureThreshold
+	}
+	if s.config.RecoveryThreshold <= 0 {
+		s.config.RecoveryThreshold = DefaultStandbyRecoveryThreshold
+	}
+	return s
+}
+
+// start checks the primary and the standby every CheckInterval until
+// close. The checks' outcomes are recorded by observe, like requests'.
+func (s *standby) start() {
+	if s == nil {
+		return
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.config.CheckInterval)
+		defer ticker.Stop()
+		for {
+			// The standby first, so promotion goes by its latest state
+			for _, endpoint := range []string{s.config.APIEndpoint, s.client.config.APIEndpoint} {
+				ctx, cancel := context.WithTimeout(context.Background(), s.config.CheckInterval)
+				_ = s.client.doRequest(withEndpoint(ctx, endpoint), "GET", "/health", nil, nil)
+				cancel()
+			}
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (s *standby) close() {
+	if s == nil {
+		return
+	}
+	s.stopOnce.Do(func() { close(s.stop) })
+	s.wg.Wait()
+}
+
+// route pins a Query or Exec to the standby while it is promoted. Requests
+// already pinned to an endpoint, e.g. a shard's, are left alone.
+func (s *standby) route(ctx context.Context, op string, request map[string]interface{}) (context.Context, error) {
+	if s == nil {
+		return ctx, nil
+	}
+	if _, pinned := ctx.Value(endpointKey{}).(string); pinned {
+		return ctx, nil
+	}
+	status := s.status()
+	if !status.Promoted {
+		return ctx, nil
+	}
+	sqlText, _ := request["sql"].(string)
+	if op == "Exec" || !isReadStatement(sqlText) {
+		if !s.config.PromoteWrites {
+			return nil, ErrStandbyWriteRefused
+		}
+		if s.config.WriteGuard != nil {
+			if err := s.config.WriteGuard(ctx, status); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrStandbyWriteRefused, err)
+			}
+		}
+	}
+	return withEndpoint(ctx, s.config.APIEndpoint), nil
+}
+
+// observe records the outcome of a request to endpoint, promoting or
+// demoting the standby. Requests to other endpoints than the standby
+// count for the primary.
+func (s *standby) observe(endpoint string, err error) {
+	if s == nil || errors.Is(err, context.Canceled) {
+		return
+	}
+	var promote, demote bool
+	var promoted time.Duration
+	s.mu.Lock()
+	switch {
+	case endpoint == s.config.APIEndpoint && err != nil:
+		s.standbyFailures++
+	case endpoint == s.config.APIEndpoint:
+		s.standbyFailures = 0
+	case err != nil:
+		s.primaryFailures++
+		s.primaryPasses = 0
+		s.lastErr = err
+		if s.promotedAt.IsZero() && s.primaryFailures >= s.config.FailureThreshold && s.standbyFailures == 0 {
+			s.promotedAt = time.Now()
+			promote = true
+		}
+	default:
+		s.primaryFailures = 0
+		s.primaryPasses++
+		if !s.promotedAt.IsZero() && s.primaryPasses >= s.config.RecoveryThreshold {
+			promoted = time.Since(s.promotedAt)
+			s.promotedAt = time.Time{}
+			demote = true
+		}
+	}
+	lastErr := s.lastErr
+	s.mu.Unlock()
+
+	if promote && s.config.OnPromote != nil {
+		s.config.OnPromote(lastErr)
+	}
+	if demote && s.config.OnDemote != nil {
+		s.config.OnDemote(promoted)
+	}
+}
+
+// observeResponse records a response from endpoint, 5xx statuses being
+// failures
+func (s *standby) observeResponse(endpoint string, resp *http.Response) {
+	var err error
+	if resp.StatusCode >= http.StatusInternalServerError {
+		err = fmt.Errorf("HTTP %d from %s", resp.StatusCode, endpoint)
+	}
+	s.observe(endpoint, err)
+}
+
+func (s *standby) status() StandbyStatus {
+	if s == nil {
+		return StandbyStatus{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := StandbyStatus{
+		Endpoint:        s.config.APIEndpoint,
+		Promoted:        !s.promotedAt.IsZero(),
+		PromotedAt:      s.promotedAt,
+		PrimaryFailures: s.primaryFailures,
+		StandbyHealthy:  s.standbyFailures == 0,
+	}
+	if s.lastErr != nil {
+		status.LastError = s.lastErr.Error()
+	}
+	return status
+}
+
+// Standby returns the state of Config.Standby, the zero StandbyStatus
+// without one
+func (c *Client) Standby() StandbyStatus {
+	return c.standby.status()
+}
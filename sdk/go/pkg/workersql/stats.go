@@ -0,0 +1,421 @@
+package workersql
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultStatsInterval is how often StartStatsReporter flushes by default
+const DefaultStatsInterval = 10 * time.Second
+
+// DefaultLatencyBuckets are the upper bounds of the statement latency
+// histogram
+var DefaultLatencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+}
+
+// LatencyHistogram counts statement latencies into buckets
+type LatencyHistogram struct {
+	// Bounds are the inclusive upper bounds of the buckets
+	Bounds []time.Duration
+	// Counts has one entry per bound plus a final overflow bucket
+	Counts []int64
+	Count  int64
+	Sum    time.Duration
+}
+
+// Mean returns the average latency
+func (h LatencyHistogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// Quantile estimates the q-th quantile (0 < q <= 1) as the upper bound of
+// the bucket containing it. Latencies in the overflow bucket report the
+// largest bound.
+func (h LatencyHistogram) Quantile(q float64) time.Duration {
+	if h.Count == 0 || len(h.Bounds) == 0 {
+		return 0
+	}
+	rank := int64(q * float64(h.Count))
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int64
+	for i, n := range h.Counts {
+		seen += n
+		if seen >= rank && i < len(h.Bounds) {
+			return h.Bounds[i]
+		}
+	}
+	return h.Bounds[len(h.Bounds)-1]
+}
+
+func (h LatencyHistogram) sub(prev LatencyHistogram) LatencyHistogram {
+	out := LatencyHistogram{
+		Bounds: h.Bounds,
+		Counts: make([]int64, len(h.Counts)),
+		Count:  h.Count - prev.Count,
+		Sum:    h.Sum - prev.Sum,
+	}
+	for i := range h.Counts {
+		out.Counts[i] = h.Counts[i]
+		if i < len(prev.Counts) {
+			out.Counts[i] -= prev.Counts[i]
+		}
+	}
+	return out
+}
+
+// Stats is a snapshot of client activity since the client was created
+type Stats struct {
+	// Queries counts executed statements, including batch and transaction
+	// statements
+	Queries int64
+	// Errors counts statements that failed, by transport error or an
+	// unsuccessful response
+	Errors int64
+	// CacheHits counts responses the gateway served from its cache
+	CacheHits int64
+	// Retries counts requests sent again after a retryable failure
+	Retries int64
+	// Coalesced counts queries that shared the response of an identical
+	// query in flight instead of sending their own request
+	Coalesced int64
+	// CoalescedWrites counts writes that shared the result of an identical
+	// write under Config.CoalesceWrites instead of being sent
+	CoalescedWrites int64
+	// BatchedExecs counts Exec calls sent together in a /batch request
+	// under Config.BatchExecs
+	BatchedExecs int64
+	// DeadLetters counts failed writes handed to DeadLetterConfig.Handler
+	DeadLetters int64
+	// HotKeys counts routing keys detected exceeding
+	// HotKeyConfig.Threshold, once per key and window
+	HotKeys int64
+	// Hedges counts duplicate requests sent for slow reads, and HedgeWins
+	// those that answered first
+	Hedges    int64
+	HedgeWins int64
+	// SlowQueries counts calls slower than SlowQueryConfig.Threshold
+	SlowQueries int64
+	// CancelledQueries counts queries stopped on the gateway after their
+	// context ended
+	CancelledQueries int64
+	// ResultsSampled counts results checked under Config.ResultSampling,
+	// and QualityViolations the rule violations found in them
+	ResultsSampled    int64
+	QualityViolations int64
+	// Latency is the distribution of round-trip times, one sample per
+	// request; a batch or pipeline counts once
+	Latency LatencyHistogram
+	// Pool holds the connection pool stats, nil without pooling
+	Pool map[string]interface{}
+}
+
+// Sub returns the activity between prev and s. Pool stats are kept from s.
+func (s Stats) Sub(prev Stats) Stats {
+	return Stats{
+		Queries:           s.Queries - prev.Queries,
+		Errors:            s.Errors - prev.Errors,
+		CacheHits:         s.CacheHits - prev.CacheHits,
+		Retries:           s.Retries - prev.Retries,
+		Coalesced:         s.Coalesced - prev.Coalesced,
+		CoalescedWrites:   s.CoalescedWrites - prev.CoalescedWrites,
+		BatchedExecs:      s.BatchedExecs - prev.BatchedExecs,
+		DeadLetters:       s.DeadLetters - prev.DeadLetters,
+		HotKeys:           s.HotKeys - prev.HotKeys,
+		Hedges:            s.Hedges - prev.Hedges,
+		HedgeWins:         s.HedgeWins - prev.HedgeWins,
+		SlowQueries:       s.SlowQueries - prev.SlowQueries,
+		CancelledQueries:  s.CancelledQueries - prev.CancelledQueries,
+		ResultsSampled:    s.ResultsSampled - prev.ResultsSampled,
+		QualityViolations: s.QualityViolations - prev.QualityViolations,
+		Latency:           s.Latency.sub(prev.Latency),
+		Pool:              s.Pool,
+	}
+}
+
+// clientStats accumulates the counters behind Client.Stats
+type clientStats struct {
+	queries           int64
+	errors            int64
+	cacheHits         int64
+	retries           int64
+	coalesced         int64
+	coalescedWrites   int64
+	batchedExecs      int64
+	deadLetters       int64
+	hotKeys           int64
+	hedges            int64
+	hedgeWins         int64
+	slowQueries       int64
+	cancelledQueries  int64
+	resultsSampled    int64
+	qualityViolations int64
+
+	mu      sync.Mutex
+	latency LatencyHistogram
+}
+
+func newClientStats() *clientStats {
+	return &clientStats{latency: LatencyHistogram{
+		Bounds: DefaultLatencyBuckets,
+		Counts: make([]int64, len(DefaultLatencyBuckets)+1),
+	}}
+}
+
+// record adds n statements that completed in one round trip of d
+func (s *clientStats) record(n int, d time.Duration, failed int, cached int) {
+	atomic.AddInt64(&s.queries, int64(n))
+	atomic.AddInt64(&s.errors, int64(failed))
+	atomic.AddInt64(&s.cacheHits, int64(cached))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bucket := len(s.latency.Bounds)
+	for i, bound := range s.latency.Bounds {
+		if d <= bound {
+			bucket = i
+			break
+		}
+	}
+	s.latency.Counts[bucket]++
+	s.latency.Count++
+	s.latency.Sum += d
+}
+
+// recordResponse records a single statement's outcome
+func (s *clientStats) recordResponse(start time.Time, resp *QueryResponse, err error) {
+	failed, cached := 0, 0
+	if err != nil || !resp.Success {
+		failed = 1
+	} else if resp.Cached {
+		cached = 1
+	}
+	s.record(1, time.Since(start), failed, cached)
+}
+
+func (s *clientStats) snapshot() Stats {
+	s.mu.Lock()
+	latency := s.latency
+	latency.Counts = append([]int64(nil), s.latency.Counts...)
+	s.mu.Unlock()
+
+	return Stats{
+		Queries:           atomic.LoadInt64(&s.queries),
+		Errors:            atomic.LoadInt64(&s.errors),
+		CacheHits:         atomic.LoadInt64(&s.cacheHits),
+		Retries:           atomic.LoadInt64(&s.retries),
+		Coalesced:         atomic.LoadInt64(&s.coalesced),
+		CoalescedWrites:   atomic.LoadInt64(&s.coalescedWrites),
+		BatchedExecs:      atomic.LoadInt64(&s.batchedExecs),
+		DeadLetters:       atomic.LoadInt64(&s.deadLetters),
+		HotKeys:           atomic.LoadInt64(&s.hotKeys),
+		Hedges:            atomic.LoadInt64(&s.hedges),
+		HedgeWins:         atomic.LoadInt64(&s.hedgeWins),
+		SlowQueries:       atomic.LoadInt64(&s.slowQueries),
+		CancelledQueries:  atomic.LoadInt64(&s.cancelledQueries),
+		ResultsSampled:    atomic.LoadInt64(&s.resultsSampled),
+		QualityViolations: atomic.LoadInt64(&s.qualityViolations),
+		Latency:           latency,
+	}
+}
+
+// Stats returns the client's cumulative statistics
+func (c *Client) Stats() Stats {
+	stats := c.stats.snapshot()
+	if c.pool != nil {
+		stats.Pool = c.pool.GetStats()
+	}
+	return stats
+}
+
+// StatsReport is the activity of one reporting interval
+type StatsReport struct {
+	// Time is when the report was taken
+	Time time.Time
+	// Interval is the time covered by the report
+	Interval time.Duration
+	// Stats holds the activity during the interval; Pool is current
+	Stats Stats
+}
+
+// StatsSink receives periodic stats reports
+type StatsSink interface {
+	Report(StatsReport) error
+}
+
+// StatsSinkFunc adapts a function to StatsSink, for example to record
+// reports with an OpenTelemetry meter
+type StatsSinkFunc func(StatsReport) error
+
+// Report calls f
+func (f StatsSinkFunc) Report(r StatsReport) error {
+	return f(r)
+}
+
+// StatsReporterOptions configures StartStatsReporter
+type StatsReporterOptions struct {
+	// Sink receives the reports
+	Sink StatsSink
+	// Interval between reports (default: 10s)
+	Interval time.Duration
+	// OnError is called when the sink fails (default: errors are dropped)
+	OnError func(error)
+}
+
+// StartStatsReporter flushes the client's activity to opts.Sink every
+// interval until the returned stop function is called, which sends a final
+// report for the partial interval
+func (c *Client) StartStatsReporter(opts StatsReporterOptions) (stop func(), err error) {
+	if opts.Sink == nil {
+		return nil, fmt.Errorf("stats reporter: Sink is required")
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultStatsInterval
+	}
+
+	prev, prevTime := c.Stats(), time.Now()
+	flush := func() {
+		now, current := time.Now(), c.Stats()
+		report := StatsReport{Time: now, Interval: now.Sub(prevTime), Stats: current.Sub(prev)}
+		prev, prevTime = current, now
+		if err := opts.Sink.Report(report); err != nil && opts.OnError != nil {
+			opts.OnError(err)
+		}
+	}
+
+	stopCh := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(opts.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				flush()
+				return
+			case <-ticker.C:
+				flush()
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stopCh)
+			<-done
+		})
+	}, nil
+}
+
+// statsdMaxPacket keeps StatsD datagrams within a typical MTU
+const statsdMaxPacket = 1400
+
+// StatsDSink sends reports as StatsD metrics over UDP: counters for
+// queries, errors and cache hits, per-bucket latency counters, latency mean
+// and p99 timings, and pool gauges
+type StatsDSink struct {
+	conn   net.Conn
+	prefix string
+}
+
+// NewStatsDSink returns a sink sending to the StatsD server at addr, with
+// metric names prefixed by prefix (e.g. "myapp.workersql")
+func NewStatsDSink(addr, prefix string) (*StatsDSink, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("statsd: %w", err)
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, ".") {
+		prefix += "."
+	}
+	return &StatsDSink{conn: conn, prefix: prefix}, nil
+}
+
+// Report implements StatsSink
+func (s *StatsDSink) Report(r StatsReport) error {
+	st := r.Stats
+	lines := []string{
+		fmt.Sprintf("%squeries:%d|c", s.prefix, st.Queries),
+		fmt.Sprintf("%serrors:%d|c", s.prefix, st.Errors),
+		fmt.Sprintf("%scache_hits:%d|c", s.prefix, st.CacheHits),
+		fmt.Sprintf("%sretries:%d|c", s.prefix, st.Retries),
+		fmt.Sprintf("%scoalesced:%d|c", s.prefix, st.Coalesced),
+		fmt.Sprintf("%scoalesced_writes:%d|c", s.prefix, st.CoalescedWrites),
+		fmt.Sprintf("%sbatched_execs:%d|c", s.prefix, st.BatchedExecs),
+		fmt.Sprintf("%sdead_letters:%d|c", s.prefix, st.DeadLetters),
+		fmt.Sprintf("%shot_keys:%d|c", s.prefix, st.HotKeys),
+		fmt.Sprintf("%shedges:%d|c", s.prefix, st.Hedges),
+		fmt.Sprintf("%shedge_wins:%d|c", s.prefix, st.HedgeWins),
+		fmt.Sprintf("%sslow_queries:%d|c", s.prefix, st.SlowQueries),
+		fmt.Sprintf("%squeries_cancelled:%d|c", s.prefix, st.CancelledQueries),
+		fmt.Sprintf("%sresults_sampled:%d|c", s.prefix, st.ResultsSampled),
+		fmt.Sprintf("%squality_violations:%d|c", s.prefix, st.QualityViolations),
+	}
+	if st.Latency.Count > 0 {
+		lines = append(lines,
+			fmt.Sprintf("%slatency.mean:%d|ms", s.prefix, st.Latency.Mean().Milliseconds()),
+			fmt.Sprintf("%slatency.p99:%d|ms", s.prefix, st.Latency.Quantile(0.99).Milliseconds()),
+		)
+		for i, n := range st.Latency.Counts {
+			bucket := "inf"
+			if i < len(st.Latency.Bounds) {
+				bucket = fmt.Sprintf("%dms", st.Latency.Bounds[i].Milliseconds())
+			}
+			lines = append(lines, fmt.Sprintf("%slatency.le_%s:%d|c", s.prefix, bucket, n))
+		}
+	}
+	for _, name := range []string{"total", "active", "idle", "waiting"} {
+		if v, ok := st.Pool[name].(int); ok {
+			lines = append(lines, fmt.Sprintf("%spool.%s:%d|g", s.prefix, name, v))
+		}
+	}
+	return s.send(lines)
+}
+
+// send writes lines in as few datagrams as fit the packet size
+func (s *StatsDSink) send(lines []string) error {
+	var packet strings.Builder
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > statsdMaxPacket {
+			if _, err := s.conn.Write([]byte(packet.String())); err != nil {
+				return fmt.Errorf("statsd: %w", err)
+			}
+			packet.Reset()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	if packet.Len() > 0 {
+		if _, err := s.conn.Write([]byte(packet.String())); err != nil {
+			return fmt.Errorf("statsd: %w", err)
+		}
+	}
+	return nil
+}
+
+// Close closes the UDP socket
+func (s *StatsDSink) Close() error {
+	return s.conn.Close()
+}
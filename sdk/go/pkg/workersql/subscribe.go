@@ -0,0 +1,177 @@
+package workersql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SubscriptionOptions controls Subscribe
+type SubscriptionOptions struct {
+	// After resumes a subscription from the Offsets of a previous one.
+	// Without it the subscription starts at the end of the change logs,
+	// with the changes made after Subscribe returns.
+	After ChangeOffsets
+	// PollInterval is how often the change logs are checked for new
+	// changes, and how long a failed read waits before it is retried
+	// (default: 1s)
+	PollInterval time.Duration
+	// OnError is called with errors reading the change logs and errors
+	// returned by the handler, before they are retried
+	OnError func(err error)
+}
+
+// Subscription delivers the changes to a table to a handler until it is
+// closed
+type Subscription struct {
+	table  string
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu      sync.Mutex
+	offsets ChangeOffsets
+}
+
+// Subscribe calls handler with each change to the rows of table, from the
+// changes made after it returns, until the subscription is closed or ctx
+// is done. It follows the change logs of every shard of Config.Shards, or
+// of the gateway without them, see WatchChanges.
+//
+// Delivery is at least once: a read failing because the gateway or a shard
+// is unreachable is retried every PollInterval, resuming after the last
+// change delivered, so no change is missed across reconnections, but a
+// handler returning an error is called again with the changes of its batch,
+// including those it already handled. Handlers should be idempotent.
+// Changes to one shard are delivered in order, one at a time.
+func (c *Client) Subscribe(ctx context.Context, table string, handler func(ctx context.Context, change ChangeEvent) error) (*Subscription, error) {
+	return c.SubscribeWithOptions(ctx, table, handler, SubscriptionOptions{})
+}
+
+// SubscribeWithOptions is Subscribe with options
+func (c *Client) SubscribeWithOptions(ctx context.Context, table string, handler func(ctx context.Context, change ChangeEvent) error, opts SubscriptionOptions) (*Subscription, error) {
+	if table == "" {
+		return nil, fmt.Errorf("subscribe: a table is required")
+	}
+	shards := make([]string, 0, len(c.config.Shards))
+	for shard := range c.config.Shards {
+		shards = append(shards, shard)
+	}
+	sort.Strings(shards)
+	if len(shards) == 0 {
+		shards = []string{""}
+	}
+
+	offsets := make(ChangeOffsets, len(shards))
+	for _, shard := range shards {
+		if after, ok := opts.After[shard]; ok {
+			offsets[shard] = after
+			continue
+		}
+		latest, err := c.latestChange(ctx, shard)
+		if err != nil {
+			return nil, fmt.Errorf("subscribe to %s: %w", table, err)
+		}
+		offsets[shard] = latest
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	s := &Subscription{table: table, cancel: cancel, done: make(chan struct{}), offsets: offsets}
+	feed := ChangeFeedOptions{
+		Shards:       shards,
+		Tables:       []string{table},
+		After:        offsets,
+		PollInterval: opts.PollInterval,
+		OnError: func(shard string, err error) {
+			if errors.Is(err, ErrClientClosed) {
+				cancel()
+				return
+			}
+			if opts.OnError != nil {
+				opts.OnError(err)
+			}
+		},
+		OnCommit: s.commit,
+	}
+	go func() {
+		defer close(s.done)
+		_ = c.WatchChanges(ctx, feed, func(ctx context.Context, events []ChangeEvent) error {
+			for _, event := range events {
+				if event.Type == "ddl" {
+					continue
+				}
+				if err := handler(ctx, event); err != nil {
+					return fmt.Errorf("subscription to %s: change %d: %w", table, event.ID, err)
+				}
+			}
+			return nil
+		})
+	}()
+	return s, nil
+}
+
+// Table returns the table subscribed to
+func (s *Subscription) Table() string {
+	return s.table
+}
+
+// Offsets returns the position of the last change delivered on each shard,
+// for SubscriptionOptions.After
+func (s *Subscription) Offsets() ChangeOffsets {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	offsets := make(ChangeOffsets, len(s.offsets))
+	for shard, id := range s.offsets {
+		offsets[shard] = id
+	}
+	return offsets
+}
+
+// Done is closed once the subscription has stopped, after Close, the end
+// of its context, or the client's
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Close stops the subscription and waits for a handler call in progress to
+// return
+func (s *Subscription) Close() {
+	s.cancel()
+	<-s.done
+}
+
+func (s *Subscription) commit(offsets ChangeOffsets) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.offsets = offsets
+}
+
+// latestChange returns the ID of the last change in the change log of
+// shard, 0 for an empty log
+func (c *Client) latestChange(ctx context.Context, shard string) (int64, error) {
+	request := map[string]interface{}{"sql": "SELECT MAX(id) AS id FROM _events"}
+	var response *QueryResponse
+	read := func(ctx context.Context) (err error) {
+		response, err = c.execute(ctx, "Query", request)
+		if err == nil {
+			err = response.failure()
+		}
+		return err
+	}
+	var err error
+	if shard == "" {
+		err = read(ctx)
+	} else {
+		err = c.onShard(ctx, shard, read)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("read change log position: %w", err)
+	}
+	if len(response.Data) == 0 {
+		return 0, nil
+	}
+	id, _ := changeInt(response.Data[0]["id"])
+	return id, nil
+}
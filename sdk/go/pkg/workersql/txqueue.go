@@ -0,0 +1,115 @@
+package workersql
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/internal/websocket"
+)
+
+// transactionLimitCodes are server error codes meaning the shard has too
+// many open transactions; BeginTx waits and retries on them
+var transactionLimitCodes = map[string]bool{
+	"RESOURCE_LIMIT":        true,
+	"TOO_MANY_TRANSACTIONS": true,
+}
+
+const (
+	beginRetryInitialDelay = 50 * time.Millisecond
+	beginRetryMaxDelay     = 1 * time.Second
+)
+
+// txQueue bounds the number of concurrently open transactions and queues
+// BeginTx callers beyond the limit until a slot frees up or their context
+// ends
+type txQueue struct {
+	slots   chan struct{}
+	waiting int64
+}
+
+func newTxQueue(limit int) *txQueue {
+	q := &txQueue{}
+	if limit > 0 {
+		q.slots = make(chan struct{}, limit)
+	}
+	return q
+}
+
+// acquire blocks until a transaction slot is available
+func (q *txQueue) acquire(ctx context.Context) error {
+	if q.slots == nil {
+		return nil
+	}
+
+	select {
+	case q.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	atomic.AddInt64(&q.waiting, 1)
+	defer atomic.AddInt64(&q.waiting, -1)
+
+	select {
+	case q.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release frees a slot taken by acquire
+func (q *txQueue) release() {
+	if q.slots != nil {
+		<-q.slots
+	}
+}
+
+// begin starts a transaction on conn, waiting and retrying while the
+// server reports its transaction limit is reached
+func (q *txQueue) begin(ctx context.Context, conn txConn) error {
+	delay := beginRetryInitialDelay
+	waiting := false
+	defer func() {
+		if waiting {
+			atomic.AddInt64(&q.waiting, -1)
+		}
+	}()
+
+	for {
+		err := conn.Begin(ctx)
+		if err == nil || !isTransactionLimit(err) {
+			return err
+		}
+
+		if !waiting {
+			waiting = true
+			atomic.AddInt64(&q.waiting, 1)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		delay *= 2
+		if delay > beginRetryMaxDelay {
+			delay = beginRetryMaxDelay
+		}
+	}
+}
+
+// depth returns the number of BeginTx calls currently waiting
+func (q *txQueue) depth() int {
+	return int(atomic.LoadInt64(&q.waiting))
+}
+
+func isTransactionLimit(err error) bool {
+	var serverErr *websocket.ServerError
+	return errors.As(err, &serverErr) && transactionLimitCodes[serverErr.Code]
+}
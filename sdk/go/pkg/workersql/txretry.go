@@ -0,0 +1,88 @@
+package workersql
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Transaction retry defaults
+const (
+	DefaultTxRetryAttempts = 3
+	DefaultTxRetryBackoff  = 10 * time.Millisecond
+)
+
+// ErrorCode names a class of server errors a transaction may be retried on
+type ErrorCode string
+
+const (
+	// ErrorCodeDeadlock matches ErrDeadlock
+	ErrorCodeDeadlock ErrorCode = "DEADLOCK"
+	// ErrorCodeConflict matches ErrConflict
+	ErrorCodeConflict ErrorCode = "CONFLICT"
+)
+
+// matches reports whether err is of the class of code
+func (code ErrorCode) matches(err error) bool {
+	switch code {
+	case ErrorCodeDeadlock:
+		return errors.Is(err, ErrDeadlock)
+	case ErrorCodeConflict:
+		return errors.Is(err, ErrConflict)
+	}
+	return false
+}
+
+// TxRetryOptions configures TransactionWithRetry
+type TxRetryOptions struct {
+	// MaxAttempts bounds how many times the transaction runs (default: 3)
+	MaxAttempts int
+	// RetryOn lists the errors that run the transaction again (default:
+	// ErrorCodeDeadlock and ErrorCodeConflict)
+	RetryOn []ErrorCode
+	// Backoff is the wait before the first retry, doubling for each
+	// further one (default: 10ms)
+	Backoff time.Duration
+}
+
+// TransactionWithRetry runs fn in a transaction like Transaction, running
+// it again in a new transaction when fn, or the commit, fails with one of
+// opts.RetryOn. fn may run several times, so it must not have side effects
+// outside the transaction that can't be repeated. The error of the last
+// attempt is returned.
+func (c *Client) TransactionWithRetry(ctx context.Context, fn func(ctx context.Context, tx *TransactionClient) error, opts TxRetryOptions) error {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultTxRetryAttempts
+	}
+	if len(opts.RetryOn) == 0 {
+		opts.RetryOn = []ErrorCode{ErrorCodeDeadlock, ErrorCodeConflict}
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = DefaultTxRetryBackoff
+	}
+
+	backoff := opts.Backoff
+	for attempt := 1; ; attempt++ {
+		err := c.Transaction(ctx, fn)
+		if err == nil || attempt >= opts.MaxAttempts || !retryableTxError(err, opts.RetryOn) {
+			return err
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+func retryableTxError(err error, codes []ErrorCode) bool {
+	for _, code := range codes {
+		if code.matches(err) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,178 @@
+package workersql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/internal/websocket"
+)
+
+// TransactionTransport selects how transactions reach the gateway
+type TransactionTransport string
+
+const (
+	// TransactionTransportAuto uses WebSocket sessions and switches to
+	// HTTP for the rest of the client's life once a WebSocket dial fails
+	TransactionTransportAuto TransactionTransport = "auto"
+	// TransactionTransportWebSocket only uses WebSocket sessions
+	TransactionTransportWebSocket TransactionTransport = "websocket"
+	// TransactionTransportHTTP sends each statement of a transaction as an
+	// HTTP request, for proxies and runtimes that block WebSockets
+	TransactionTransportHTTP TransactionTransport = "http"
+)
+
+func (t TransactionTransport) validate() error {
+	switch t {
+	case "", TransactionTransportAuto, TransactionTransportWebSocket, TransactionTransportHTTP:
+		return nil
+	}
+	return fmt.Errorf("unknown transaction transport %q", t)
+}
+
+// txConn carries the statements of one transaction, over a WebSocket
+// session or HTTP
+type txConn interface {
+	Begin(ctx context.Context) error
+	Query(ctx context.Context, sql string, params []interface{}) (*websocket.QueryResponse, error)
+	Exec(ctx context.Context, sql string, params []interface{}) (*websocket.QueryResponse, error)
+	Pipeline(ctx context.Context, statements []websocket.Statement) ([]*websocket.QueryResponse, error)
+	Commit(ctx context.Context) error
+	Rollback(ctx context.Context) error
+}
+
+// acquireTxConn returns the connection for a new transaction and the
+// function handing it back once the transaction ends, with its error
+func (c *Client) acquireTxConn(ctx context.Context) (txConn, func(error), error) {
+	transport := c.config.TransactionTransport
+	if transport == TransactionTransportHTTP || atomic.LoadInt32(&c.wsBlocked) == 1 {
+		return c.newHTTPTx(), func(error) {}, nil
+	}
+
+	session, err := c.sessions.Acquire(ctx)
+	if err != nil {
+		if transport == TransactionTransportWebSocket || ctx.Err() != nil {
+			return nil, nil, err
+		}
+		// WebSockets are likely blocked on the way to the gateway
+		atomic.StoreInt32(&c.wsBlocked, 1)
+		return c.newHTTPTx(), func(error) {}, nil
+	}
+	return session, func(err error) {
+		if err != nil {
+			c.sessions.Discard(session)
+		} else {
+			c.sessions.Release(session)
+		}
+	}, nil
+}
+
+// httpTx runs a transaction through POST /transactions, which returns its
+// ID, and /transactions/{id}/query, /commit and /rollback. Every request
+// goes to the endpoint the transaction began on.
+type httpTx struct {
+	client      *Client
+	endpoint    string
+	id          string
+	maxDuration time.Duration
+	expires     time.Time
+}
+
+func (c *Client) newHTTPTx() *httpTx {
+	return &httpTx{client: c, maxDuration: c.config.MaxTransactionDuration}
+}
+
+func (t *httpTx) Begin(ctx context.Context) error {
+	t.endpoint = t.client.endpoint(ctx)
+	var response struct {
+		TransactionID string `json:"transactionId"`
+	}
+	if err := t.do(ctx, "/transactions", nil, &response); err != nil {
+		return err
+	}
+	if response.TransactionID == "" {
+		return fmt.Errorf("begin response without transactionId")
+	}
+	t.id = response.TransactionID
+	if t.maxDuration > 0 {
+		t.expires = time.Now().Add(t.maxDuration)
+	}
+	return nil
+}
+
+func (t *httpTx) Query(ctx context.Context, sql string, params []interface{}) (*websocket.QueryResponse, error) {
+	return t.query(ctx, websocket.Statement{SQL: sql, Params: params})
+}
+
+func (t *httpTx) Exec(ctx context.Context, sql string, params []interface{}) (*websocket.QueryResponse, error) {
+	return t.query(ctx, websocket.Statement{SQL: sql, Params: params, Mode: "exec"})
+}
+
+// Pipeline sends the statements one after the other, stopping at the first
+// failure like the server does for WebSocket pipelines
+func (t *httpTx) Pipeline(ctx context.Context, statements []websocket.Statement) ([]*websocket.QueryResponse, error) {
+	results := make([]*websocket.QueryResponse, 0, len(statements))
+	for _, statement := range statements {
+		result, err := t.query(ctx, statement)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+		if !result.Success {
+			break
+		}
+	}
+	return results, nil
+}
+
+func (t *httpTx) query(ctx context.Context, statement websocket.Statement) (*websocket.QueryResponse, error) {
+	if err := t.checkExpired(ctx); err != nil {
+		return nil, err
+	}
+	var response websocket.QueryResponse
+	if err := t.do(ctx, t.path("query"), statement, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+func (t *httpTx) Commit(ctx context.Context) error {
+	if err := t.checkExpired(ctx); err != nil {
+		return err
+	}
+	return t.do(ctx, t.path("commit"), nil, nil)
+}
+
+func (t *httpTx) Rollback(ctx context.Context) error {
+	return t.do(ctx, t.path("rollback"), nil, nil)
+}
+
+// checkExpired rolls the transaction back once it is open for longer than
+// Config.MaxTransactionDuration
+func (t *httpTx) checkExpired(ctx context.Context) error {
+	if t.expires.IsZero() || time.Now().Before(t.expires) {
+		return nil
+	}
+	_ = t.Rollback(ctx)
+	return ErrTransactionExpired
+}
+
+func (t *httpTx) path(action string) string {
+	return "/transactions/" + url.PathEscape(t.id) + "/" + action
+}
+
+// do POSTs body to path on the transaction's endpoint, turning error
+// responses with a code into the server errors WebSocket sessions report.
+// The transaction is tracked by the lifecycle from BeginTx, so its
+// requests keep going through during shutdown.
+func (t *httpTx) do(ctx context.Context, path string, body, response interface{}) error {
+	err := t.client.doRequest(withAdmitted(withEndpoint(ctx, t.endpoint)), "POST", path, body, response)
+	var statusErr *statusError
+	if errors.As(err, &statusErr) && statusErr.code != "" {
+		return &websocket.ServerError{Code: statusErr.code, Message: statusErr.message}
+	}
+	return err
+}
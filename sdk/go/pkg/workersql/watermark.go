@@ -0,0 +1,192 @@
+package workersql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// IncrementalExportSpec describes an export of the rows changed since the
+// previous run
+type IncrementalExportSpec struct {
+	// ExportSpec is the table or query to export and where to write it.
+	// Checkpoint and OnCheckpoint are not supported; the watermark takes
+	// their place.
+	ExportSpec
+	// Name identifies the watermark in Store (default: the table name,
+	// required for a query export)
+	Name string
+	// WatermarkColumn only ever grows when a row changes, such as an
+	// updated_at timestamp or the position of a change in a CDC table.
+	// Rows whose value is NULL are never exported. It must be part of the
+	// exported columns.
+	WatermarkColumn string
+	// Store persists the watermark between runs
+	Store WatermarkStore
+}
+
+// Watermark records how far incremental exports of a table have got. It is
+// JSON serializable so it can be persisted between runs.
+type Watermark struct {
+	// Column is the watermark column
+	Column string `json:"column"`
+	// Position holds the watermark column value and the key column values
+	// of the last exported row. Rows changed after it sort after it.
+	Position []interface{} `json:"position"`
+	// Rows is the number of rows the last run exported
+	Rows int64 `json:"rows"`
+	// ExportedAt is when the last run finished
+	ExportedAt time.Time `json:"exportedAt"`
+}
+
+// WatermarkStore persists the watermarks of incremental exports
+type WatermarkStore interface {
+	// LoadWatermark returns the watermark saved under name, or nil if there
+	// is none
+	LoadWatermark(ctx context.Context, name string) (*Watermark, error)
+	// SaveWatermark saves watermark under name
+	SaveWatermark(ctx context.Context, name string, watermark *Watermark) error
+}
+
+// ExportIncremental exports the rows whose WatermarkColumn moved past the
+// watermark saved by the previous run, or every row on the first run, in
+// watermark order. The new watermark is saved once every row has been
+// written, so a failed run exports its rows again next time: a warehouse
+// load should upsert by key.
+func (c *Client) ExportIncremental(ctx context.Context, spec IncrementalExportSpec) (*Watermark, error) {
+	if spec.WatermarkColumn == "" {
+		return nil, fmt.Errorf("export: WatermarkColumn is required")
+	}
+	if spec.Store == nil {
+		return nil, fmt.Errorf("export: Store is required")
+	}
+	if spec.Checkpoint != nil || spec.OnCheckpoint != nil {
+		return nil, fmt.Errorf("export: incremental exports resume from their watermark, not a checkpoint")
+	}
+	name := spec.Name
+	if name == "" {
+		name = spec.Table
+	}
+	if name == "" {
+		return nil, fmt.Errorf("export: Name is required to export a query incrementally")
+	}
+
+	previous, err := spec.Store.LoadWatermark(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("export: load watermark %q: %w", name, err)
+	}
+	if previous != nil && previous.Column != spec.WatermarkColumn {
+		return nil, fmt.Errorf("export: watermark %q is on column %q, not %q", name, previous.Column, spec.WatermarkColumn)
+	}
+
+	keyColumns := spec.KeyColumns
+	if len(keyColumns) == 0 {
+		keyColumns = []string{"id"}
+	}
+	spec.KeyColumns = append([]string{spec.WatermarkColumn}, keyColumns...)
+	checkpoint := ExportCheckpoint{}
+	if previous != nil {
+		if len(previous.Position) != len(spec.KeyColumns) {
+			return nil, fmt.Errorf("export: watermark %q has %d values for columns %v", name, len(previous.Position), spec.KeyColumns)
+		}
+		checkpoint.LastKey = previous.Position
+	}
+
+	done, err := exportFrom(ctx, spec.ExportSpec, c.Query, checkpoint, true)
+	if err != nil {
+		return nil, err
+	}
+	watermark := &Watermark{
+		Column:     spec.WatermarkColumn,
+		Position:   done.LastKey,
+		Rows:       done.Rows,
+		ExportedAt: time.Now().UTC(),
+	}
+	if err := spec.Store.SaveWatermark(ctx, name, watermark); err != nil {
+		return nil, fmt.Errorf("export: save watermark %q: %w", name, err)
+	}
+	return watermark, nil
+}
+
+// FileWatermarkStore keeps watermarks in a JSON file, replaced atomically
+// on every save
+type FileWatermarkStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileWatermarkStore returns a store keeping watermarks in the file at
+// path, created on the first save
+func NewFileWatermarkStore(path string) *FileWatermarkStore {
+	return &FileWatermarkStore{path: path}
+}
+
+// LoadWatermark returns the watermark saved under name, or nil if there is
+// none
+func (s *FileWatermarkStore) LoadWatermark(_ context.Context, name string) (*Watermark, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	watermarks, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	return watermarks[name], nil
+}
+
+// SaveWatermark saves watermark under name, keeping the others
+func (s *FileWatermarkStore) SaveWatermark(_ context.Context, name string, watermark *Watermark) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	watermarks, err := s.read()
+	if err != nil {
+		return err
+	}
+	watermarks[name] = watermark
+	data, err := json.MarshalIndent(watermarks, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// read returns the saved watermarks. Numbers are kept as json.Number so
+// integer keys beyond 2^53 survive the round trip.
+func (s *FileWatermarkStore) read() (map[string]*Watermark, error) {
+	watermarks := map[string]*Watermark{}
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return watermarks, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&watermarks); err != nil {
+		return nil, fmt.Errorf("%s: %w", s.path, err)
+	}
+	return watermarks, nil
+}
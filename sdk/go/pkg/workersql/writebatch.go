@@ -0,0 +1,200 @@
+package workersql
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Write batching defaults
+const (
+	DefaultWriteBatchWindow  = 5 * time.Millisecond
+	DefaultWriteBatchMaxSize = 100
+)
+
+// WriteBatchingConfig combines Exec calls issued within a short window
+// into one /batch request
+type WriteBatchingConfig struct {
+	// Window is how long the first Exec of a batch waits for others
+	// (default: 5ms)
+	Window time.Duration
+	// MaxSize sends a batch as soon as it holds this many statements
+	// (default: 100)
+	MaxSize int
+}
+
+// writeBatcher queues Exec requests and sends them together. The
+// statements of a batch run independently: each call gets its own result,
+// and a failing statement doesn't fail the others. The methods of a nil
+// batcher accept nothing.
+type writeBatcher struct {
+	client  *Client
+	window  time.Duration
+	maxSize int
+
+	mu      sync.Mutex
+	pending []*batchedExec
+	timer   *time.Timer
+}
+
+type batchedExec struct {
+	ctx      context.Context
+	request  map[string]interface{}
+	done     chan struct{}
+	response *QueryResponse
+	err      error
+}
+
+func newWriteBatcher(client *Client, config *WriteBatchingConfig) *writeBatcher {
+	if config == nil {
+		return nil
+	}
+	b := &writeBatcher{client: client, window: config.Window, maxSize: config.MaxSize}
+	if b.window <= 0 {
+		b.window = DefaultWriteBatchWindow
+	}
+	if b.maxSize <= 0 {
+		b.maxSize = DefaultWriteBatchMaxSize
+	}
+	return b
+}
+
+// accepts reports whether request is a plain Exec that may share a batch:
+// no hints, shard or routing keys, endpoint, caller idempotency key or
+// other per-call headers, none of which /batch carries per statement
+func (b *writeBatcher) accepts(ctx context.Context, request map[string]interface{}) bool {
+	if b == nil || request["mode"] != "exec" {
+		return false
+	}
+	for k := range request {
+		if k != "sql" && k != "params" && k != "mode" {
+			return false
+		}
+	}
+	if _, pinned := ctx.Value(endpointKey{}).(string); pinned {
+		return false
+	}
+	if _, keyed := ctx.Value(idempotencyKeyKey{}).(string); keyed {
+		return false
+	}
+	for name := range requestHeadersFrom(ctx) {
+		if name != http.CanonicalHeaderKey(IdempotencyKeyHeader) {
+			return false
+		}
+	}
+	return true
+}
+
+// submit queues request and waits for its result. The call counts as in
+// flight for Shutdown until its batch has been sent, even if ctx ends
+// first.
+func (b *writeBatcher) submit(ctx context.Context, request map[string]interface{}, response *QueryResponse) error {
+	if err := b.client.life.enter(false); err != nil {
+		return err
+	}
+	call := &batchedExec{ctx: ctx, request: request, done: make(chan struct{})}
+
+	b.mu.Lock()
+	b.pending = append(b.pending, call)
+	var full []*batchedExec
+	if len(b.pending) >= b.maxSize {
+		full = b.takePending()
+	} else if len(b.pending) == 1 {
+		b.timer = time.AfterFunc(b.window, b.flush)
+	}
+	b.mu.Unlock()
+	if full != nil {
+		go b.send(full)
+	}
+
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if call.err != nil {
+		return call.err
+	}
+	*response = *call.response
+	return nil
+}
+
+// takePending empties the queue. b.mu must be held.
+func (b *writeBatcher) takePending() []*batchedExec {
+	pending := b.pending
+	b.pending = nil
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	return pending
+}
+
+// drain sends the queued calls now instead of at the end of the window.
+// The calls count as in flight until sent, so Shutdown waits for them.
+func (b *writeBatcher) drain() {
+	if b != nil {
+		go b.flush()
+	}
+}
+
+// flush sends the queued calls once the window is over
+func (b *writeBatcher) flush() {
+	b.mu.Lock()
+	pending := b.takePending()
+	b.mu.Unlock()
+	if len(pending) > 0 {
+		b.send(pending)
+	}
+}
+
+// send sends calls, alone as a /query request or together as a /batch,
+// and hands each its result
+func (b *writeBatcher) send(calls []*batchedExec) {
+	c := b.client
+	defer func() {
+		for _, call := range calls {
+			close(call.done)
+			c.life.leave(false)
+		}
+	}()
+
+	if len(calls) == 1 {
+		call := calls[0]
+		ctx := withAdmitted(context.WithoutCancel(call.ctx))
+		var response QueryResponse
+		call.err = c.retryStrategy.Execute(ctx, func() error {
+			return c.sendQuery(ctx, call.request, &response)
+		})
+		call.response = &response
+		return
+	}
+
+	statements := make([]BatchStatement, len(calls))
+	for i, call := range calls {
+		statements[i].SQL, _ = call.request["sql"].(string)
+		statements[i].Params, _ = call.request["params"].([]interface{})
+	}
+	// The batch replaces the calls' requests, so it gets its own key
+	ctx, err := withIdempotencyKey(withAdmitted(context.Background()), "", true)
+	var response BatchQueryResponse
+	if err == nil {
+		err = c.retryStrategy.Execute(ctx, func() error {
+			return c.doRequest(ctx, "POST", "/batch", map[string]interface{}{"queries": statements}, &response)
+		})
+	}
+	atomic.AddInt64(&c.stats.batchedExecs, int64(len(calls)))
+	for i, call := range calls {
+		switch {
+		case err != nil:
+			call.err = err
+		case i >= len(response.Results):
+			call.err = fmt.Errorf("batch response has no result for statement %d", i)
+		default:
+			call.response = &response.Results[i]
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package workersql
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultWriteCoalescingWindow is how long an identical write shares the
+// result of the first one by default
+const DefaultWriteCoalescingWindow = 100 * time.Millisecond
+
+// WriteCoalescingConfig collapses identical idempotent writes, such as
+// heartbeat upserts from a chatty client, into one request
+type WriteCoalescingConfig struct {
+	// Window is how long after a write is issued an identical write (same
+	// SQL and params) shares its result instead of being sent (default:
+	// 100ms). Writes issued while it is in flight always share it.
+	Window time.Duration
+	// Queries lists the idempotent writes that may be coalesced, matched
+	// by their Fingerprint. Writes of other shapes are always sent.
+	Queries []string
+}
+
+// writeCoalescer shares the results of identical idempotent writes within
+// a window. The methods of a nil coalescer run every write.
+type writeCoalescer struct {
+	window time.Duration
+	shapes map[string]bool
+
+	mu     sync.Mutex
+	writes map[string]*coalescedWrite
+}
+
+type coalescedWrite struct {
+	done     chan struct{}
+	response *QueryResponse
+	err      error
+	expires  time.Time
+}
+
+func newWriteCoalescer(config *WriteCoalescingConfig) *writeCoalescer {
+	if config == nil || len(config.Queries) == 0 {
+		return nil
+	}
+	w := &writeCoalescer{
+		window: config.Window,
+		shapes: make(map[string]bool, len(config.Queries)),
+		writes: make(map[string]*coalescedWrite),
+	}
+	if w.window <= 0 {
+		w.window = DefaultWriteCoalescingWindow
+	}
+	for _, sql := range config.Queries {
+		w.shapes[Fingerprint(sql)] = true
+	}
+	return w
+}
+
+// key identifies a coalescable write by its normalized SQL, params and
+// target endpoint, or returns "" for reads and writes of other shapes
+func (w *writeCoalescer) key(ctx context.Context, request map[string]interface{}) string {
+	sql, _ := request["sql"].(string)
+	if isReadStatement(sql) || !w.shapes[Fingerprint(sql)] {
+		return ""
+	}
+	params, err := json.Marshal(request["params"])
+	if err != nil {
+		return ""
+	}
+	key := strings.TrimSpace(fingerprintSpace.ReplaceAllString(sql, " ")) + " " + string(params)
+	if endpoint, ok := ctx.Value(endpointKey{}).(string); ok {
+		return endpoint + " " + key
+	}
+	return key
+}
+
+// coalescedWrite runs send for a write request, or shares the result of
+// the identical write in flight or issued within the window. Failed
+// writes are only shared with the writes waiting on them.
+func (c *Client) coalescedWrite(ctx context.Context, request map[string]interface{}, send func(context.Context) (*QueryResponse, error)) (*QueryResponse, error) {
+	w := c.writes
+	if w == nil {
+		return send(ctx)
+	}
+	key := w.key(ctx, request)
+	if key == "" {
+		return send(ctx)
+	}
+
+	now := time.Now()
+	w.mu.Lock()
+	write, shared := w.writes[key]
+	if shared && !now.Before(write.expires) {
+		shared = false
+	}
+	if !shared {
+		write = &coalescedWrite{done: make(chan struct{}), expires: now.Add(w.window)}
+		w.writes[key] = write
+	}
+	w.mu.Unlock()
+
+	if shared {
+		atomic.AddInt64(&c.stats.coalescedWrites, 1)
+	} else {
+		go func() {
+			write.response, write.err = send(context.WithoutCancel(ctx))
+			w.mu.Lock()
+			if write.err != nil || !write.response.Success || !time.Now().Before(write.expires) {
+				if w.writes[key] == write {
+					delete(w.writes, key)
+				}
+			} else {
+				time.AfterFunc(time.Until(write.expires), func() { w.forget(key, write) })
+			}
+			w.mu.Unlock()
+			close(write.done)
+		}()
+	}
+
+	select {
+	case <-write.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if write.err != nil {
+		return nil, write.err
+	}
+	return cloneResponse(write.response), nil
+}
+
+// forget drops write once its window is over, unless a newer write of key
+// replaced it
+func (w *writeCoalescer) forget(key string, write *coalescedWrite) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.writes[key] == write {
+		delete(w.writes, key)
+	}
+}
@@ -0,0 +1,343 @@
+package workersqltest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+)
+
+// RecordEnv is the environment variable that makes cassettes record from
+// the real gateway instead of replaying
+const RecordEnv = "WORKERSQL_RECORD"
+
+// Redacted replaces secrets in recorded cassettes
+const Redacted = "[REDACTED]"
+
+// CassetteMode selects whether a Cassette records or replays
+type CassetteMode int
+
+const (
+	// CassetteReplay answers requests from the cassette file, failing the
+	// test on requests it didn't record. It is the default unless
+	// WORKERSQL_RECORD is set.
+	CassetteReplay CassetteMode = iota
+	// CassetteRecord sends requests to the gateway and writes them with
+	// their responses to the cassette file when the test ends
+	CassetteRecord
+)
+
+// CassetteOptions configures a Cassette
+type CassetteOptions struct {
+	// Mode forces recording or replaying regardless of WORKERSQL_RECORD
+	Mode *CassetteMode
+	// Transport sends the requests being recorded (default:
+	// http.DefaultTransport)
+	Transport http.RoundTripper
+	// Secrets are replaced by Redacted wherever they appear in recorded
+	// paths, bodies and headers, and in requests before they are matched
+	Secrets []string
+	// Redact, if set, is called on every interaction before it is written,
+	// for redaction Secrets can't express
+	Redact func(*Interaction)
+}
+
+// Interaction is a recorded request and its response
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is a request of a cassette. Request headers, the API key
+// included, are never recorded.
+type RecordedRequest struct {
+	Method string `json:"method"`
+	// Path is the request path and query string, without the host, so a
+	// cassette replays against any endpoint
+	Path string          `json:"path"`
+	Body json.RawMessage `json:"body,omitempty"`
+}
+
+// RecordedResponse is a response of a cassette
+type RecordedResponse struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+	// Text holds a body that isn't JSON
+	Text string `json:"text,omitempty"`
+}
+
+// cassetteFile is the JSON layout of a cassette
+type cassetteFile struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// sensitiveHeaders are response headers never written to a cassette
+var sensitiveHeaders = map[string]bool{
+	"Set-Cookie":    true,
+	"Authorization": true,
+}
+
+// Cassette is a VCR-style http.RoundTripper for a client's Config.Transport.
+// Recording, it passes requests to the gateway and writes them with their
+// responses to a JSON file when the test ends; replaying, it answers from
+// the file, so tests run hermetically and deterministically in CI:
+//
+//	cassette := workersqltest.NewCassette(t, "testdata/checkout.json", workersqltest.CassetteOptions{
+//		Secrets: []string{os.Getenv("WORKERSQL_API_KEY")},
+//	})
+//	client := cassette.NewClient(t, workersql.Config{APIEndpoint: endpoint, APIKey: apiKey})
+//
+// Run the tests with WORKERSQL_RECORD=1 against a gateway to record. Only
+// HTTP requests go through the transport, so the cassette's clients run
+// transactions over HTTP.
+type Cassette struct {
+	t       testing.TB
+	path    string
+	options CassetteOptions
+	mode    CassetteMode
+
+	mu           sync.Mutex
+	interactions []*Interaction
+	// used marks replayed interactions
+	used []bool
+}
+
+// NewCassette returns a cassette for the file at path. Replaying, a
+// missing file fails the test.
+func NewCassette(t testing.TB, path string, options CassetteOptions) *Cassette {
+	t.Helper()
+	c := &Cassette{t: t, path: path, options: options, mode: CassetteReplay}
+	if options.Mode != nil {
+		c.mode = *options.Mode
+	} else if os.Getenv(RecordEnv) != "" {
+		c.mode = CassetteRecord
+	}
+	if c.options.Transport == nil {
+		c.options.Transport = http.DefaultTransport
+	}
+
+	if c.mode == CassetteRecord {
+		t.Cleanup(c.save)
+		return c
+	}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("workersqltest: cassette %s doesn't exist; run with %s=1 to record it", path, RecordEnv)
+	}
+	if err != nil {
+		t.Fatalf("workersqltest: reading cassette: %v", err)
+	}
+	var file cassetteFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		t.Fatalf("workersqltest: parsing cassette %s: %v", path, err)
+	}
+	c.interactions = file.Interactions
+	c.used = make([]bool, len(file.Interactions))
+	return c
+}
+
+// Recording reports whether the cassette records rather than replays
+func (c *Cassette) Recording() bool {
+	return c.mode == CassetteRecord
+}
+
+// Config returns config sending its requests through the cassette, with
+// transactions over HTTP
+func (c *Cassette) Config(config workersql.Config) workersql.Config {
+	config.Transport = c
+	config.TransactionTransport = workersql.TransactionTransportHTTP
+	return config
+}
+
+// NewClient returns a client of Config(config), closed when the test ends
+func (c *Cassette) NewClient(t testing.TB, config workersql.Config) *workersql.Client {
+	t.Helper()
+	client, err := workersql.NewClient(c.Config(config))
+	if err != nil {
+		t.Fatalf("workersqltest: creating client: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+// RoundTrip records or replays req
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorded, err := c.request(req)
+	if err != nil {
+		return nil, err
+	}
+	if c.mode == CassetteRecord {
+		return c.record(req, recorded)
+	}
+	return c.replay(req, recorded)
+}
+
+// request reads req into its recorded form, redacted
+func (c *Cassette) request(req *http.Request) (RecordedRequest, error) {
+	recorded := RecordedRequest{Method: req.Method, Path: c.redact(req.URL.RequestURI())}
+	if req.Body == nil {
+		return recorded, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return recorded, fmt.Errorf("workersqltest: reading request body: %w", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	recorded.Body, _ = c.jsonBody(body)
+	return recorded, nil
+}
+
+// jsonBody returns body redacted and compacted when it is JSON
+func (c *Cassette) jsonBody(body []byte) (json.RawMessage, bool) {
+	if len(body) == 0 {
+		return nil, true
+	}
+	redacted := []byte(c.redact(string(body)))
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, redacted); err != nil {
+		return nil, false
+	}
+	return compact.Bytes(), true
+}
+
+func (c *Cassette) redact(s string) string {
+	for _, secret := range c.options.Secrets {
+		if secret != "" {
+			s = strings.ReplaceAll(s, secret, Redacted)
+		}
+	}
+	return s
+}
+
+func (c *Cassette) record(req *http.Request, recorded RecordedRequest) (*http.Response, error) {
+	resp, err := c.options.Transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("workersqltest: reading response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	interaction := &Interaction{
+		Request:  recorded,
+		Response: RecordedResponse{Status: resp.StatusCode, Headers: make(map[string]string)},
+	}
+	for name := range resp.Header {
+		if !sensitiveHeaders[name] {
+			interaction.Response.Headers[name] = c.redact(resp.Header.Get(name))
+		}
+	}
+	if jsonBody, ok := c.jsonBody(body); ok {
+		interaction.Response.Body = jsonBody
+	} else {
+		interaction.Response.Text = c.redact(string(body))
+	}
+	if c.options.Redact != nil {
+		c.options.Redact(interaction)
+	}
+
+	c.mu.Lock()
+	c.interactions = append(c.interactions, interaction)
+	c.mu.Unlock()
+	return resp, nil
+}
+
+// replay answers with the first unused interaction matching recorded. Once
+// all of its matches are used the last one answers again, so repeated
+// polls such as health checks don't exhaust the cassette.
+func (c *Cassette) replay(req *http.Request, recorded RecordedRequest) (*http.Response, error) {
+	c.mu.Lock()
+	var match *Interaction
+	for i, interaction := range c.interactions {
+		if !sameRequest(interaction.Request, recorded) {
+			continue
+		}
+		match = interaction
+		if !c.used[i] {
+			c.used[i] = true
+			break
+		}
+	}
+	c.mu.Unlock()
+
+	if match == nil {
+		err := fmt.Errorf("workersqltest: cassette %s has no %s %s %s; run with %s=1 to record it again",
+			c.path, recorded.Method, recorded.Path, recorded.Body, RecordEnv)
+		c.t.Errorf("%v", err)
+		return nil, err
+	}
+
+	resp := &http.Response{
+		Status:     fmt.Sprintf("%d %s", match.Response.Status, http.StatusText(match.Response.Status)),
+		StatusCode: match.Response.Status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Request:    req,
+	}
+	for name, value := range match.Response.Headers {
+		resp.Header.Set(name, value)
+	}
+	body := []byte(match.Response.Body)
+	if match.Response.Text != "" {
+		body = []byte(match.Response.Text)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	return resp, nil
+}
+
+// sameRequest compares requests, their JSON bodies by value
+func sameRequest(a, b RecordedRequest) bool {
+	if a.Method != b.Method || a.Path != b.Path {
+		return false
+	}
+	if len(a.Body) == 0 || len(b.Body) == 0 {
+		return len(a.Body) == len(b.Body)
+	}
+	var av, bv interface{}
+	if json.Unmarshal(a.Body, &av) != nil || json.Unmarshal(b.Body, &bv) != nil {
+		return bytes.Equal(a.Body, b.Body)
+	}
+	aj, _ := json.Marshal(av)
+	bj, _ := json.Marshal(bv)
+	return bytes.Equal(aj, bj)
+}
+
+// save writes the recorded interactions to the cassette file
+func (c *Cassette) save() {
+	c.mu.Lock()
+	file := cassetteFile{Interactions: c.interactions}
+	c.mu.Unlock()
+	if file.Interactions == nil {
+		file.Interactions = []*Interaction{}
+	}
+	content, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		c.t.Errorf("workersqltest: encoding cassette: %v", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		c.t.Errorf("workersqltest: creating cassette directory: %v", err)
+		return
+	}
+	if err := os.WriteFile(c.path, append(content, '\n'), 0o644); err != nil {
+		c.t.Errorf("workersqltest: writing cassette: %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package workersqltest
+
+import (
+	"context"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+)
+
+// FakeClient is an in-process workersql.Querier answering from its
+// Script, for unit tests of code taking a Querier that don't need a real
+// client:
+//
+//	fake := workersqltest.NewFakeClient()
+//	fake.On("UPDATE users SET name = ? WHERE id = ?").ReturnExec(1, 0)
+//	err := renameUser(ctx, fake, 7, "ada")
+//	assert.Equal(t, []interface{}{"ada", 7}, fake.Calls()[0].Params)
+type FakeClient struct {
+	*Script
+}
+
+var _ workersql.Querier = (*FakeClient)(nil)
+
+// NewFakeClient returns a FakeClient with an empty script
+func NewFakeClient() *FakeClient {
+	return &FakeClient{Script: &Script{}}
+}
+
+// Query answers from the script, or fails with the context error
+func (f *FakeClient) Query(ctx context.Context, sql string, params ...interface{}) (*workersql.QueryResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return f.answer(Call{Op: OpQuery, SQL: sql, Params: params}).response(), nil
+}
+
+// Exec answers from the script, or fails with the context error
+func (f *FakeClient) Exec(ctx context.Context, sql string, params ...interface{}) (*workersql.ExecResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	resp := f.answer(Call{Op: OpExec, SQL: sql, Params: params}).response()
+	return &workersql.ExecResponse{
+		Success:      resp.Success,
+		AffectedRows: resp.AffectedRows,
+		LastInsertID: resp.LastInsertID,
+		Error:        resp.Error,
+	}, nil
+}
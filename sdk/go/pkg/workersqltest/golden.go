@@ -0,0 +1,134 @@
+package workersqltest
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+)
+
+// UpdateGoldenEnv is the environment variable that makes AssertGolden
+// rewrite golden files with the recorded queries instead of comparing
+const UpdateGoldenEnv = "WORKERSQL_UPDATE_GOLDEN"
+
+// QueryRecorder records the statements a client issues, normalized with
+// workersql.Fingerprint so values don't matter
+type QueryRecorder struct {
+	mu      sync.Mutex
+	queries []string
+}
+
+// RecordQueries records the statements client issues until the test ends
+func RecordQueries(t testing.TB, client *workersql.Client) *QueryRecorder {
+	t.Helper()
+	r := &QueryRecorder{}
+	t.Cleanup(client.OnQuery(func(event workersql.QueryEvent) {
+		r.mu.Lock()
+		r.queries = append(r.queries, event.Op+" "+workersql.Fingerprint(event.SQL))
+		r.mu.Unlock()
+	}))
+	return r
+}
+
+// Queries returns the recorded statements in order, each as its operation
+// and fingerprint, e.g. "Query SELECT * FROM users WHERE id = ?"
+func (r *QueryRecorder) Queries() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.queries...)
+}
+
+// Reset forgets the statements recorded so far, to leave fixture setup out
+// of a golden file
+func (r *QueryRecorder) Reset() {
+	r.mu.Lock()
+	r.queries = nil
+	r.mu.Unlock()
+}
+
+// AssertGolden compares the statements recorded by r with the golden file
+// at path, one statement per line, and fails the test with a diff when
+// they differ, catching added queries such as N+1s and changed query
+// shapes. With WORKERSQL_UPDATE_GOLDEN=1 it writes the file instead. The
+// comparison is ordered, so record concurrent code paths separately.
+func AssertGolden(t testing.TB, r *QueryRecorder, path string) {
+	t.Helper()
+	got := r.Queries()
+	content := strings.Join(got, "\n")
+	if len(got) > 0 {
+		content += "\n"
+	}
+
+	if os.Getenv(UpdateGoldenEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("workersqltest: creating golden directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("workersqltest: writing golden file: %v", err)
+		}
+		return
+	}
+
+	golden, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("workersqltest: golden file %s doesn't exist; run with %s=1 to create it", path, UpdateGoldenEnv)
+	}
+	if err != nil {
+		t.Fatalf("workersqltest: reading golden file: %v", err)
+	}
+	if string(golden) == content {
+		return
+	}
+
+	want := strings.Split(strings.TrimSuffix(string(golden), "\n"), "\n")
+	if len(golden) == 0 {
+		want = nil
+	}
+	t.Errorf("workersqltest: queries differ from %s (-golden +recorded); run with %s=1 to accept them:\n%s",
+		path, UpdateGoldenEnv, diffLines(want, got))
+}
+
+// diffLines returns a line diff turning want into got, built from their
+// longest common subsequence
+func diffLines(want, got []string) string {
+	// lcs[i][j] is the length of the LCS of want[i:] and got[j:]
+	lcs := make([][]int, len(want)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(got)+1)
+	}
+	for i := len(want) - 1; i >= 0; i-- {
+		for j := len(got) - 1; j >= 0; j-- {
+			if want[i] == got[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var b strings.Builder
+	i, j := 0, 0
+	for i < len(want) || j < len(got) {
+		switch {
+		case i < len(want) && j < len(got) && want[i] == got[j]:
+			fmt.Fprintf(&b, "  %s\n", want[i])
+			i++
+			j++
+		case j < len(got) && (i == len(want) || lcs[i][j+1] >= lcs[i+1][j]):
+			fmt.Fprintf(&b, "+ %s\n", got[j])
+			j++
+		default:
+			fmt.Fprintf(&b, "- %s\n", want[i])
+			i++
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,368 @@
+package workersqltest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	gws "github.com/gorilla/websocket"
+
+	"github.com/healthfees-org/workersql/sdk/go/internal/websocket"
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+)
+
+// MockServer is an in-memory WorkerSQL gateway answering /query, /batch,
+// /health, HTTP transactions and the WebSocket transaction protocol from
+// its Script, so code using a real Client, transactions included, can be
+// tested without a gateway:
+//
+//	server := workersqltest.NewMockServer(t)
+//	server.On("SELECT * FROM users WHERE id = ?").Return(map[string]interface{}{"id": 1, "name": "ada"})
+//	client := server.NewClient(t)
+type MockServer struct {
+	*Script
+	*httptest.Server
+
+	mu           sync.Mutex
+	unhealthy    bool
+	unavailable  bool
+	healthChecks int
+	transactions []*Transaction
+	routes       map[string]http.Handler
+}
+
+// Transaction is a transaction opened on a MockServer
+type Transaction struct {
+	ID         string
+	Statements []Call
+	Committed  bool
+	RolledBack bool
+}
+
+// NewMockServer starts a MockServer, closed when the test ends
+func NewMockServer(t testing.TB) *MockServer {
+	t.Helper()
+	s := &MockServer{Script: &Script{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Server.Close)
+	return s
+}
+
+// Config returns a client configuration pointing at the server, without
+// retries so scripted failures surface straight away
+func (s *MockServer) Config() workersql.Config {
+	return workersql.Config{APIEndpoint: s.URL, RetryAttempts: 1}
+}
+
+// NewClient returns a client of the server, closed when the test ends
+func (s *MockServer) NewClient(t testing.TB) *workersql.Client {
+	t.Helper()
+	client, err := workersql.NewClient(s.Config())
+	if err != nil {
+		t.Fatalf("workersqltest: creating client: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+// SetHealthy sets whether /health reports the gateway healthy, which it
+// does initially
+func (s *MockServer) SetHealthy(healthy bool) {
+	s.mu.Lock()
+	s.unhealthy = !healthy
+	s.mu.Unlock()
+}
+
+// Handle serves the requests for path, without its /v1 prefix, with
+// handler instead of the script, for gateway APIs the script doesn't cover.
+// A path ending in a slash also matches the paths below it.
+func (s *MockServer) Handle(path string, handler http.Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.routes == nil {
+		s.routes = make(map[string]http.Handler)
+	}
+	s.routes[path] = handler
+}
+
+// route returns the handler added for path, preferring the longest match
+func (s *MockServer) route(path string) http.Handler {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var handler http.Handler
+	matched := -1
+	for pattern, h := range s.routes {
+		if pattern == path || (strings.HasSuffix(pattern, "/") && strings.HasPrefix(path, pattern)) {
+			if len(pattern) > matched {
+				handler, matched = h, len(pattern)
+			}
+		}
+	}
+	return handler
+}
+
+// SetAvailable sets whether the server answers at all. While unavailable,
+// every request, health checks included, is answered 503 as by a gateway
+// that is down, and no statement is recorded.
+func (s *MockServer) SetAvailable(available bool) {
+	s.mu.Lock()
+	s.unavailable = !available
+	s.mu.Unlock()
+}
+
+// HealthChecks returns the number of /health requests received so far
+func (s *MockServer) HealthChecks() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.healthChecks
+}
+
+// Transactions returns the transactions opened so far, in order
+func (s *MockServer) Transactions() []Transaction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Transaction, len(s.transactions))
+	for i, tx := range s.transactions {
+		out[i] = *tx
+		out[i].Statements = append([]Call(nil), tx.Statements...)
+	}
+	return out
+}
+
+// statement is a statement of a request body
+type statement struct {
+	SQL    string        `json:"sql"`
+	Params []interface{} `json:"params"`
+	Mode   string        `json:"mode"`
+}
+
+func (st statement) call(txID string, header http.Header) Call {
+	op := OpQuery
+	if st.Mode == "exec" {
+		op = OpExec
+	}
+	return Call{Op: op, SQL: st.SQL, Params: st.Params, TransactionID: txID, Header: header}
+}
+
+func (s *MockServer) serve(w http.ResponseWriter, r *http.Request) {
+	// DSNs point clients at the /v1 API
+	path := strings.TrimPrefix(r.URL.Path, "/v1")
+	s.mu.Lock()
+	if path == "/health" {
+		s.healthChecks++
+	}
+	unavailable := s.unavailable
+	s.mu.Unlock()
+	if unavailable {
+		writeError(w, http.StatusServiceUnavailable, "UNAVAILABLE", "gateway unavailable")
+		return
+	}
+	if handler := s.route(path); handler != nil {
+		handler.ServeHTTP(w, r)
+		return
+	}
+	switch {
+	case path == "/health":
+		s.mu.Lock()
+		unhealthy := s.unhealthy
+		s.mu.Unlock()
+		if unhealthy {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{"status": "unhealthy"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"status": "healthy", "database": map[string]interface{}{"connected": true}})
+	case path == "/query":
+		var st statement
+		if !decode(w, r, &st) {
+			return
+		}
+		result := s.answer(st.call("", r.Header))
+		status := result.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if status/100 != 2 {
+			var response workersql.ErrorResponse
+			if result.Error != nil {
+				response = *result.Error
+			}
+			writeJSON(w, status, response)
+			return
+		}
+		writeJSON(w, status, result.response())
+	case path == "/batch":
+		s.batch(w, r)
+	case path == "/ws":
+		s.websocket(w, r)
+	case path == "/transactions":
+		tx := s.begin()
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "transactionId": tx.ID})
+	case strings.HasPrefix(path, "/transactions/"):
+		parts := strings.Split(strings.TrimPrefix(path, "/transactions/"), "/")
+		tx := s.transaction(parts[0])
+		if tx == nil || len(parts) != 2 {
+			writeError(w, http.StatusNotFound, "TRANSACTION_NOT_FOUND", "no such transaction")
+			return
+		}
+		switch parts[1] {
+		case "query":
+			var st statement
+			if !decode(w, r, &st) {
+				return
+			}
+			writeJSON(w, http.StatusOK, s.execute(tx, st, r.Header))
+		case "commit", "rollback":
+			s.finish(tx, parts[1] == "commit")
+			writeJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+		default:
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "unknown transaction action")
+		}
+	default:
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "unknown path "+r.URL.Path)
+	}
+}
+
+func (s *MockServer) batch(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Queries     []statement `json:"queries"`
+		StopOnError bool        `json:"stopOnError"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	response := workersql.BatchQueryResponse{Success: true}
+	for _, st := range req.Queries {
+		call := st.call("", r.Header)
+		call.Op = OpBatch
+		result := s.answer(call).response()
+		response.Results = append(response.Results, *result)
+		if !result.Success {
+			response.Success = false
+			if req.StopOnError {
+				break
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *MockServer) begin() *Transaction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx := &Transaction{ID: fmt.Sprintf("tx-%d", len(s.transactions)+1)}
+	s.transactions = append(s.transactions, tx)
+	return tx
+}
+
+func (s *MockServer) transaction(id string) *Transaction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, tx := range s.transactions {
+		if tx.ID == id && !tx.Committed && !tx.RolledBack {
+			return tx
+		}
+	}
+	return nil
+}
+
+// execute runs a statement of tx
+func (s *MockServer) execute(tx *Transaction, st statement, header http.Header) *workersql.QueryResponse {
+	call := st.call(tx.ID, header)
+	s.mu.Lock()
+	tx.Statements = append(tx.Statements, call)
+	s.mu.Unlock()
+	return s.answer(call).response()
+}
+
+func (s *MockServer) finish(tx *Transaction, commit bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx.Committed, tx.RolledBack = commit, !commit
+}
+
+// websocket serves a transaction session. Transactions left open when the
+// connection closes are rolled back, as by the gateway.
+func (s *MockServer) websocket(w http.ResponseWriter, r *http.Request) {
+	upgrader := gws.Upgrader{Subprotocols: []string{fmt.Sprintf("workersql.v%d", websocket.ProtocolVersion)}}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	open := make(map[string]*Transaction)
+	defer func() {
+		for _, tx := range open {
+			s.finish(tx, false)
+		}
+	}()
+	for {
+		var msg websocket.Message
+		if err := conn.ReadJSON(&msg); err != nil {
+			return
+		}
+		reply := websocket.Message{Type: websocket.FrameResponse, ID: msg.ID}
+		tx := open[msg.TransactionID]
+		switch {
+		case msg.Type == websocket.FrameBegin:
+			tx = s.begin()
+			open[tx.ID] = tx
+			reply.Data = map[string]interface{}{"success": true, "transactionId": tx.ID}
+		case tx == nil:
+			reply = websocket.Message{Type: websocket.FrameError, ID: msg.ID, Error: map[string]interface{}{
+				"code": "TRANSACTION_NOT_FOUND", "message": "no such transaction",
+			}}
+		case msg.Type == websocket.FrameQuery:
+			reply.Data = s.execute(tx, statement{SQL: msg.SQL, Params: msg.Params, Mode: msg.Mode}, nil)
+		case msg.Type == websocket.FramePipeline:
+			// Like the gateway, stop at the first failing statement
+			var results []*workersql.QueryResponse
+			for _, st := range msg.Statements {
+				result := s.execute(tx, statement{SQL: st.SQL, Params: st.Params, Mode: st.Mode}, nil)
+				results = append(results, result)
+				if !result.Success {
+					break
+				}
+			}
+			reply.Data = map[string]interface{}{"results": results}
+		case msg.Type == websocket.FrameCommit, msg.Type == websocket.FrameRollback:
+			s.finish(tx, msg.Type == websocket.FrameCommit)
+			delete(open, tx.ID)
+			reply.Data = map[string]interface{}{"success": true}
+		case msg.Type == websocket.FramePing:
+			reply.Type = websocket.FramePong
+		default:
+			reply = websocket.Message{Type: websocket.FrameError, ID: msg.ID, Error: map[string]interface{}{
+				"code": "INVALID_FRAME", "message": fmt.Sprintf("unexpected %q frame", msg.Type),
+			}}
+		}
+		if err := conn.WriteJSON(reply); err != nil {
+			return
+		}
+	}
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"success": false,
+		"error":   map[string]interface{}{"code": code, "message": message},
+	})
+}
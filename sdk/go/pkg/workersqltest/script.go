@@ -0,0 +1,159 @@
+package workersqltest
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+)
+
+// Statement operations recorded in a Call
+const (
+	OpQuery = "query"
+	OpExec  = "exec"
+	OpBatch = "batch"
+)
+
+// Call is a statement received by a MockServer or FakeClient
+type Call struct {
+	// Op is OpQuery, OpExec, or OpBatch for a statement of a /batch request
+	Op     string
+	SQL    string
+	Params []interface{}
+	// TransactionID is set for the statements of a transaction
+	TransactionID string
+	// Header holds the headers of the HTTP request a MockServer received
+	// the statement in, and is nil for WebSocket frames and FakeClient
+	Header http.Header
+}
+
+// Result is the scripted outcome of a statement
+type Result struct {
+	Rows         []map[string]interface{}
+	Columns      []workersql.ColumnMeta
+	AffectedRows int64
+	LastInsertID int64
+	// ExecutionTime is the server-side run time reported, in milliseconds,
+	// and Shard the shard reported to have run the statement
+	ExecutionTime float64
+	Shard         string
+	// Error, if set, makes the statement fail with its code and message
+	Error *workersql.ErrorResponse
+	// Status, if set, is the HTTP status a MockServer answers a /query
+	// request with. An error status carries only Error, as the gateway's
+	// error responses do.
+	Status int
+}
+
+// response converts r to the gateway's response
+func (r Result) response() *workersql.QueryResponse {
+	if r.Error != nil {
+		return &workersql.QueryResponse{Success: false, Error: r.Error, Shard: r.Shard}
+	}
+	return &workersql.QueryResponse{
+		Success:       true,
+		Data:          r.Rows,
+		Columns:       r.Columns,
+		RowCount:      len(r.Rows),
+		AffectedRows:  r.AffectedRows,
+		LastInsertID:  r.LastInsertID,
+		ExecutionTime: r.ExecutionTime,
+		Shard:         r.Shard,
+	}
+}
+
+// Script holds the scripted results of a MockServer or FakeClient and
+// records the statements they receive. Statements no rule matches succeed
+// with no rows.
+type Script struct {
+	mu    sync.Mutex
+	rules []*Rule
+	calls []Call
+}
+
+// Rule answers the statements it matches. Rules added later take
+// precedence, so a test can override a shared default.
+type Rule struct {
+	match   func(Call) bool
+	respond func(Call) Result
+	// remaining is how many more statements the rule answers, unlimited
+	// when negative
+	remaining int
+}
+
+// On adds a rule matching statements with the fingerprint of sql, so
+// literal values and the length of IN lists don't matter
+func (s *Script) On(sql string) *Rule {
+	fingerprint := workersql.Fingerprint(sql)
+	return s.OnMatch(func(c Call) bool { return workersql.Fingerprint(c.SQL) == fingerprint })
+}
+
+// OnMatch adds a rule matching the statements match accepts
+func (s *Script) OnMatch(match func(Call) bool) *Rule {
+	r := &Rule{match: match, respond: func(Call) Result { return Result{} }, remaining: -1}
+	s.mu.Lock()
+	s.rules = append(s.rules, r)
+	s.mu.Unlock()
+	return r
+}
+
+// Return answers with rows
+func (r *Rule) Return(rows ...map[string]interface{}) *Rule {
+	return r.Respond(func(Call) Result { return Result{Rows: rows} })
+}
+
+// ReturnExec answers with the affected rows and generated key of a write
+func (r *Rule) ReturnExec(affectedRows, lastInsertID int64) *Rule {
+	return r.Respond(func(Call) Result { return Result{AffectedRows: affectedRows, LastInsertID: lastInsertID} })
+}
+
+// Fail answers with an unsuccessful response
+func (r *Rule) Fail(code, message string) *Rule {
+	return r.Respond(func(Call) Result {
+		return Result{Error: &workersql.ErrorResponse{Code: code, Message: message}}
+	})
+}
+
+// Respond answers with what fn returns for each statement
+func (r *Rule) Respond(fn func(Call) Result) *Rule {
+	r.respond = fn
+	return r
+}
+
+// Times limits the rule to the next n statements it matches, after which
+// older rules apply again
+func (r *Rule) Times(n int) *Rule {
+	r.remaining = n
+	return r
+}
+
+// Calls returns the statements received so far, in order
+func (s *Script) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Call(nil), s.calls...)
+}
+
+// answer records call and returns its scripted result
+func (s *Script) answer(call Call) Result {
+	s.mu.Lock()
+	s.calls = append(s.calls, call)
+	var respond func(Call) Result
+	for i := len(s.rules) - 1; i >= 0; i-- {
+		r := s.rules[i]
+		if r.remaining == 0 || !r.match(call) {
+			continue
+		}
+		if r.remaining > 0 {
+			r.remaining--
+		}
+		respond = r.respond
+		break
+	}
+	s.mu.Unlock()
+
+	if respond == nil {
+		return Result{}
+	}
+	return respond(call)
+}
@@ -0,0 +1,56 @@
+// Package workersqltest helps integration tests run against a shared
+// WorkerSQL database. Each test runs inside a transaction that is rolled
+// back when it ends, so tests stay isolated without truncating tables
+// between them, and the queries a code path issues can be compared with a
+// committed golden file to catch query regressions. Tests without a
+// database use MockServer, an in-memory gateway for real clients, or
+// FakeClient, an in-process Querier, both answering from a script of
+// results and recording the statements they get, or a Cassette replaying
+// traffic recorded from a real gateway.
+package workersqltest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+)
+
+// RunInRollbackTx runs fn inside a transaction of client and rolls it back
+// afterwards, also when fn fails the test or panics. fn gets a Querier so
+// it can't commit the transaction.
+//
+//	workersqltest.RunInRollbackTx(t, client, func(tx workersql.Querier) {
+//		_, err := tx.Exec(ctx, "INSERT INTO users (name) VALUES (?)", "ada")
+//		require.NoError(t, err)
+//	})
+func RunInRollbackTx(t testing.TB, client *workersql.Client, fn func(tx workersql.Querier)) {
+	t.Helper()
+	ctx := context.Background()
+
+	tx, err := client.BeginTx(ctx)
+	if err != nil {
+		t.Fatalf("workersqltest: beginning transaction: %v", err)
+	}
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil && !errors.Is(err, workersql.ErrTxDone) {
+			t.Errorf("workersqltest: rolling back transaction: %v", err)
+		}
+	}()
+
+	fn(querier{tx})
+}
+
+// querier hides the transaction's Commit and Rollback from the test
+type querier struct {
+	tx *workersql.TransactionClient
+}
+
+func (q querier) Query(ctx context.Context, sql string, params ...interface{}) (*workersql.QueryResponse, error) {
+	return q.tx.Query(ctx, sql, params...)
+}
+
+func (q querier) Exec(ctx context.Context, sql string, params ...interface{}) (*workersql.ExecResponse, error) {
+	return q.tx.Exec(ctx, sql, params...)
+}
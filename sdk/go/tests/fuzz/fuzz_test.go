@@ -1,6 +1,7 @@
 package fuzz
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/healthfees-org/workersql/sdk/go/internal/dsn"
@@ -119,7 +120,7 @@ func FuzzDSNStringify(f *testing.F) {
 		}
 
 		// Result should always start with protocol
-		if len(result) > 0 && result[:11] != "workersql://" {
+		if result != "" && !strings.HasPrefix(result, "workersql://") {
 			t.Errorf("stringify result should start with 'workersql://': %s", result)
 		}
 	})
@@ -0,0 +1,59 @@
+package breaker_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/internal/breaker"
+	"github.com/stretchr/testify/assert"
+)
+
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newSet(opts breaker.Options) (*breaker.Set, *clock) {
+	c := &clock{t: time.Unix(1700000000, 0)}
+	s := breaker.NewSet(opts)
+	s.SetClock(c.now)
+	return s, c
+}
+
+func TestOpensAfterThresholdWithinWindow(t *testing.T) {
+	s, clk := newSet(breaker.Options{FailureThreshold: 3, Window: 10 * time.Second, Cooldown: 5 * time.Second})
+
+	s.Failure("shard-a")
+	s.Failure("shard-a")
+	clk.advance(11 * time.Second)
+	s.Failure("shard-a")
+	assert.Equal(t, breaker.Closed, s.State("shard-a"), "failures outside the window don't count")
+
+	s.Failure("shard-a")
+	s.Failure("shard-a")
+	assert.Equal(t, breaker.Open, s.State("shard-a"))
+	assert.False(t, s.Allow("shard-a"))
+	assert.True(t, s.Allow("shard-b"), "circuits are per key")
+}
+
+func TestHalfOpenAllowsOneTrial(t *testing.T) {
+	s, clk := newSet(breaker.Options{FailureThreshold: 1, Cooldown: 5 * time.Second})
+
+	s.Failure("shard-a")
+	assert.False(t, s.Allow("shard-a"))
+
+	clk.advance(5 * time.Second)
+	assert.Equal(t, breaker.HalfOpen, s.State("shard-a"))
+	assert.True(t, s.Allow("shard-a"))
+	assert.False(t, s.Allow("shard-a"), "only one trial call at a time")
+
+	s.Failure("shard-a")
+	assert.Equal(t, breaker.Open, s.State("shard-a"), "a failed trial reopens the circuit")
+
+	clk.advance(5 * time.Second)
+	assert.True(t, s.Allow("shard-a"))
+	s.Success("shard-a")
+	assert.Equal(t, breaker.Closed, s.State("shard-a"))
+	assert.True(t, s.Allow("shard-a"))
+	assert.True(t, s.Allow("shard-a"))
+}
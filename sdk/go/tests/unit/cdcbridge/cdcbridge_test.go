@@ -0,0 +1,99 @@
+package cdcbridge_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/cdcbridge"
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersqltest"
+)
+
+// changeLog serves a change log of inserts into the given tables
+func changeLog(t *testing.T, tables ...string) *workersql.Client {
+	server := workersqltest.NewMockServer(t)
+	server.OnMatch(func(workersqltest.Call) bool { return true }).Respond(func(call workersqltest.Call) workersqltest.Result {
+		var result workersqltest.Result
+		after, limit := int(call.Params[0].(float64)), int(call.Params[1].(float64))
+		for id := after + 1; id <= len(tables) && len(result.Rows) < limit; id++ {
+			payload, _ := json.Marshal(map[string]interface{}{"tenantId": "acme", "table": tables[id-1], "sql": "INSERT ..."})
+			result.Rows = append(result.Rows, map[string]interface{}{"id": id, "ts": 1700000000000, "type": "mutation", "payload": string(payload)})
+		}
+		return result
+	})
+	return server.NewClient(t)
+}
+
+func TestBridgePublishesAtLeastOnce(t *testing.T) {
+	client := changeLog(t, "orders", "users", "orders")
+
+	var (
+		mu        sync.Mutex
+		published []cdcbridge.Message
+		attempts  int
+		offsets   workersql.ChangeOffsets
+	)
+	bridge, err := cdcbridge.New(client, cdcbridge.Config{
+		Producer: cdcbridge.ProducerFunc(func(_ context.Context, msgs []cdcbridge.Message) error {
+			mu.Lock()
+			defer mu.Unlock()
+			attempts++
+			if attempts == 1 {
+				// The broker takes the first message, then fails
+				published = append(published, msgs[0])
+				return errors.New("broker unavailable")
+			}
+			published = append(published, msgs...)
+			return nil
+		}),
+		Topic: func(event workersql.ChangeEvent) string { return "cdc." + event.Table },
+		Feed: workersql.ChangeFeedOptions{
+			PollInterval: 5 * time.Millisecond,
+			OnCommit:     func(o workersql.ChangeOffsets) { mu.Lock(); offsets = o; mu.Unlock() },
+		},
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- bridge.Run(ctx) }()
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return offsets[""] == 3
+	}, 2*time.Second, 5*time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	// The first change is published twice, every change at least once
+	require.Len(t, published, 4)
+	var ids []string
+	for _, msg := range published {
+		ids = append(ids, msg.Headers["workersql-change-id"])
+	}
+	assert.Equal(t, []string{"1", "1", "2", "3"}, ids)
+
+	msg := published[3]
+	assert.Equal(t, "cdc.orders", msg.Topic)
+	assert.Equal(t, "acme/orders", msg.Key)
+	var event workersql.ChangeEvent
+	require.NoError(t, json.Unmarshal(msg.Value, &event))
+	assert.Equal(t, int64(3), event.ID)
+	assert.Equal(t, "orders", event.Table)
+
+	assert.Equal(t, cdcbridge.Stats{Published: 3, Failures: 1}, bridge.Stats())
+}
+
+func TestNewRequiresProducer(t *testing.T) {
+	client := changeLog(t)
+	_, err := cdcbridge.New(client, cdcbridge.Config{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,170 @@
+package codegen_test
+
+import (
+	"context"
+	"encoding/json"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/healthfees-org/workersql/sdk/go/internal/codegen"
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+)
+
+const querySQL = `-- Queries on users
+
+-- name: GetUser :one
+-- GetUser returns a user by ID
+SELECT id, email, created_at FROM users WHERE id = ?;
+
+-- name: ListUsers :many
+SELECT u.id, u.email, u.created_at FROM users u
+WHERE u.status IN (?) AND u.email LIKE ?
+ORDER BY u.id LIMIT ?, ?;
+
+-- name: CountUsers :one
+SELECT COUNT(*) AS total FROM users;
+
+-- name: CreateUser :execresult
+INSERT INTO users (email, status, type) VALUES (?, ?, ?);
+
+-- name: SetEmail :execrows
+UPDATE users SET email = ? WHERE id = ? AND email <> ?;
+
+-- name: Touch :exec
+UPDATE users SET created_at = NOW() WHERE id = ? OR ? = 1;
+`
+
+func TestParse(t *testing.T) {
+	queries, err := codegen.Parse("users.sql", []byte(querySQL))
+	require.NoError(t, err)
+	require.Len(t, queries, 6)
+	assert.Equal(t, "GetUser", queries[0].Name)
+	assert.Equal(t, codegen.CmdOne, queries[0].Cmd)
+	assert.Equal(t, []string{"GetUser returns a user by ID"}, queries[0].Doc)
+	assert.Equal(t, "SELECT id, email, created_at FROM users WHERE id = ?", queries[0].SQL)
+	assert.Equal(t, 3, queries[0].Line)
+	assert.Equal(t, "SELECT u.id, u.email, u.created_at FROM users u\nWHERE u.status IN (?) AND u.email LIKE ?\nORDER BY u.id LIMIT ?, ?", queries[1].SQL)
+	assert.Equal(t, codegen.CmdExecRows, queries[4].Cmd)
+
+	for src, msg := range map[string]string{
+		"SELECT 1;\n-- name: A :one\nSELECT 1":            "users.sql:1: statement before the first -- name: annotation",
+		"-- name: A :all\nSELECT 1":                       "users.sql:1: unknown command :all",
+		"-- name: getUser :one\nSELECT 1":                 "users.sql:1: query name getUser must be an exported Go identifier",
+		"-- name: A :one\nSELECT 1;\n-- name: A :exec\nX": "users.sql:3: query A already defined on line 1",
+		"-- name: A :one\n\n-- name: B :exec\nX":          "users.sql:1: query A has no statement",
+	} {
+		_, err := codegen.Parse("users.sql", []byte(src))
+		assert.EqualError(t, err, msg)
+	}
+}
+
+// describeServer answers the information_schema query and describes the
+// LIMIT 0 probes of the queries in querySQL
+func describeServer(t *testing.T) *workersql.Client {
+	schema := []map[string]interface{}{
+		{"TABLE_NAME": "users", "COLUMN_NAME": "id", "COLUMN_TYPE": "bigint(20) unsigned", "IS_NULLABLE": "NO"},
+		{"TABLE_NAME": "users", "COLUMN_NAME": "email", "COLUMN_TYPE": "varchar(255)", "IS_NULLABLE": "YES"},
+		{"TABLE_NAME": "users", "COLUMN_NAME": "status", "COLUMN_TYPE": "enum('active','banned')", "IS_NULLABLE": "NO"},
+		{"TABLE_NAME": "users", "COLUMN_NAME": "type", "COLUMN_TYPE": "tinyint(1)", "IS_NULLABLE": "NO"},
+		{"TABLE_NAME": "users", "COLUMN_NAME": "created_at", "COLUMN_TYPE": "datetime", "IS_NULLABLE": "NO"},
+	}
+	userColumns := []map[string]interface{}{
+		{"name": "id", "type": "BIGINT UNSIGNED"},
+		{"name": "email", "type": "VARCHAR", "nullable": true},
+		{"name": "created_at", "type": "DATETIME"},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			SQL    string        `json:"sql"`
+			Params []interface{} `json:"params"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		resp := map[string]interface{}{"success": true}
+		switch {
+		case strings.Contains(req.SQL, "information_schema.COLUMNS"):
+			resp["data"] = schema
+		case strings.Contains(req.SQL, "COUNT(*)"):
+			resp["columns"] = []map[string]interface{}{{"name": "total", "type": "BIGINT"}}
+		case strings.Contains(req.SQL, "LIMIT ?, ?"):
+			// LIMIT gets numbers, other placeholders NULL
+			assert.Equal(t, []interface{}{nil, nil, 0.0, 0.0}, req.Params)
+			resp["columns"] = userColumns
+		default:
+			resp["columns"] = userColumns
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(server.Close)
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: server.URL, RetryAttempts: 1})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func TestDescribeAndGenerate(t *testing.T) {
+	client := describeServer(t)
+	ctx := context.Background()
+	queries, err := codegen.Parse("users.sql", []byte(querySQL))
+	require.NoError(t, err)
+	schema, err := codegen.LoadSchema(ctx, client)
+	require.NoError(t, err)
+	for i := range queries {
+		require.NoError(t, codegen.Describe(ctx, client, schema, &queries[i]))
+	}
+
+	assert.Equal(t, []codegen.Field{{Name: "id", Column: "id", Type: "uint64"}}, queries[0].Params)
+	assert.Equal(t, []codegen.Field{
+		{Name: "ID", Column: "id", Type: "uint64"},
+		{Name: "Email", Column: "email", Type: "workersql.Null[string]"},
+		{Name: "CreatedAt", Column: "created_at", Type: "time.Time"},
+	}, queries[0].Columns)
+	assert.Equal(t, []codegen.Field{
+		{Name: "status", Column: "status", Type: "[]string"},
+		{Name: "email", Column: "email", Type: "string"},
+		{Name: "offset", Type: "int64"},
+		{Name: "limit", Type: "int64"},
+	}, queries[1].Params)
+	assert.Equal(t, []codegen.Field{
+		{Name: "email", Column: "email", Type: "workersql.Null[string]"},
+		{Name: "status", Column: "status", Type: "string"},
+		{Name: "typeParam", Column: "type", Type: "bool"},
+	}, queries[3].Params)
+	assert.Equal(t, []codegen.Field{
+		{Name: "email", Column: "email", Type: "workersql.Null[string]"},
+		{Name: "id", Column: "id", Type: "uint64"},
+		{Name: "email2", Column: "email", Type: "string"},
+	}, queries[4].Params)
+	assert.Equal(t, []codegen.Field{
+		{Name: "id", Column: "id", Type: "uint64"},
+		{Name: "arg2", Type: "interface{}"},
+	}, queries[5].Params)
+
+	src, err := codegen.Generate("db", queries)
+	require.NoError(t, err)
+	_, err = parser.ParseFile(token.NewFileSet(), "queries.go", src, 0)
+	require.NoError(t, err)
+	code := string(src)
+	for _, want := range []string{
+		"// Code generated by workersql-gen. DO NOT EDIT.",
+		"package db",
+		"\t\"time\"\n",
+		"// GetUser returns a user by ID\nfunc (q *Queries) GetUser(ctx context.Context, id uint64) (GetUserRow, error) {",
+		"\tEmail     workersql.Null[string] `db:\"email\"`\n",
+		"func (q *Queries) ListUsers(ctx context.Context, status []string, email string, offset int64, limit int64) ([]ListUsersRow, error) {",
+		"// CountUsers runs users.sql:12\nfunc (q *Queries) CountUsers(ctx context.Context) (int64, error) {",
+		"err = workersql.ScanValue(resp.Data[0][\"total\"], &row)",
+		"func (q *Queries) CreateUser(ctx context.Context, email workersql.Null[string], status string, typeParam bool) (*workersql.ExecResponse, error) {",
+		"func (q *Queries) SetEmail(ctx context.Context, email workersql.Null[string], id uint64, email2 string) (int64, error) {",
+		"func (q *Queries) Touch(ctx context.Context, id uint64, arg2 interface{}) error {",
+	} {
+		assert.Contains(t, code, want)
+	}
+	assert.NotContains(t, code, "CountUsersRow")
+}
@@ -0,0 +1,152 @@
+package faultinject_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/faultinject"
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersqltest"
+)
+
+func newClient(t *testing.T, server *workersqltest.MockServer, chaos *faultinject.Injector) *workersql.Client {
+	client, err := workersql.NewClient(chaos.Apply(server.Config()))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func TestServerErrors(t *testing.T) {
+	server := workersqltest.NewMockServer(t)
+	chaos := faultinject.New(faultinject.Config{ServerErrorRate: 1})
+	client := newClient(t, server, chaos)
+
+	_, err := client.Query(context.Background(), "SELECT 1")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "503")
+	assert.Empty(t, server.Calls(), "injected errors don't reach the gateway")
+	assert.Equal(t, int64(1), chaos.Stats().ServerErrors)
+}
+
+func TestServerErrorBody(t *testing.T) {
+	server := workersqltest.NewMockServer(t)
+	chaos := faultinject.New(faultinject.Config{
+		ServerErrorRate:   1,
+		ServerErrorStatus: http.StatusBadGateway,
+		ServerErrorBody:   `{"code":"CONNECTION_ERROR","message":"upstream went away"}`,
+	})
+	config := chaos.Apply(server.Config())
+	config.RetryAttempts = 3
+	config.RetryDelay = time.Millisecond
+	client, err := workersql.NewClient(config)
+	require.NoError(t, err)
+	defer client.Close()
+
+	_, err = client.Query(context.Background(), "SELECT 1")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "CONNECTION_ERROR: upstream went away")
+	assert.Equal(t, int64(3), chaos.Stats().ServerErrors, "gateway-style errors are retried")
+}
+
+func TestMalformedJSON(t *testing.T) {
+	server := workersqltest.NewMockServer(t)
+	server.On("SELECT name FROM users").Return(map[string]interface{}{"name": "ada"})
+	chaos := faultinject.New(faultinject.Config{MalformedJSONRate: 1})
+	client := newClient(t, server, chaos)
+
+	_, err := client.Query(context.Background(), "SELECT name FROM users")
+	require.Error(t, err)
+	assert.Len(t, server.Calls(), 1)
+	assert.Equal(t, int64(1), chaos.Stats().Malformed)
+}
+
+func TestDroppedConnections(t *testing.T) {
+	server := workersqltest.NewMockServer(t)
+	chaos := faultinject.New(faultinject.Config{DropRate: 1})
+	client := newClient(t, server, chaos)
+	ctx := context.Background()
+
+	_, err := client.Exec(ctx, "UPDATE users SET name = ?", "ada")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "connection reset by peer")
+	assert.Len(t, server.Calls(), 1, "the gateway ran the statement before the connection dropped")
+
+	chaos.SetEnabled(false)
+	_, err = client.Exec(ctx, "UPDATE users SET name = ?", "ada")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), chaos.Stats().Dropped)
+}
+
+func TestLatency(t *testing.T) {
+	server := workersqltest.NewMockServer(t)
+	chaos := faultinject.New(faultinject.Config{Latency: time.Minute, LatencyRate: 1})
+	client := newClient(t, server, chaos)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := client.Query(ctx, "SELECT 1")
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second, "the delay ends with the context")
+	assert.Empty(t, server.Calls())
+	assert.Equal(t, int64(1), chaos.Stats().Delayed)
+}
+
+func TestMatch(t *testing.T) {
+	server := workersqltest.NewMockServer(t)
+	chaos := faultinject.New(faultinject.Config{
+		ServerErrorRate: 1,
+		Match:           func(req *http.Request) bool { return req.URL.Path == "/query" },
+	})
+	client := newClient(t, server, chaos)
+
+	_, err := client.Health(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, chaos.Stats().Requests)
+}
+
+func TestSeedReplaysFaults(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"success":true}`))
+	}))
+	defer srv.Close()
+
+	outcomes := func() []int {
+		chaos := faultinject.New(faultinject.Config{Seed: 42, ServerErrorRate: 0.5})
+		httpClient := &http.Client{Transport: chaos.Transport(nil)}
+		var statuses []int
+		for i := 0; i < 20; i++ {
+			resp, err := httpClient.Get(srv.URL)
+			require.NoError(t, err)
+			resp.Body.Close()
+			statuses = append(statuses, resp.StatusCode)
+		}
+		return statuses
+	}
+	first := outcomes()
+	assert.Equal(t, first, outcomes())
+	assert.Contains(t, first, http.StatusOK)
+	assert.Contains(t, first, http.StatusServiceUnavailable)
+}
+
+func TestWSDisconnects(t *testing.T) {
+	server := workersqltest.NewMockServer(t)
+	chaos := faultinject.New(faultinject.Config{WSDisconnectRate: 1, WSDisconnectAfter: 50 * time.Millisecond})
+	client := newClient(t, server, chaos)
+
+	err := client.Transaction(context.Background(), func(ctx context.Context, tx *workersql.TransactionClient) error {
+		time.Sleep(200 * time.Millisecond)
+		_, err := tx.Exec(ctx, "UPDATE users SET name = ?", "ada")
+		return err
+	})
+	require.Error(t, err)
+	stats := chaos.Stats()
+	assert.Equal(t, int64(1), stats.Dials)
+	assert.Equal(t, int64(1), stats.Disconnects)
+}
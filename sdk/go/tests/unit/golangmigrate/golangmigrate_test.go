@@ -0,0 +1,262 @@
+package golangmigrate_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	gws "github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/healthfees-org/workersql/sdk/go/internal/websocket"
+	"github.com/healthfees-org/workersql/sdk/go/pkg/migrate/golangmigrate"
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+)
+
+// gateway fakes WorkerSQL for the driver: /query runs migration statements
+// and reads the version row, and WebSocket sessions hold advisory locks
+// and run the transactions writing the version row and dropping tables
+type gateway struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	version  map[string]interface{}
+	executed []string
+	tables   []string
+	locks    map[string]*gws.Conn
+}
+
+func newGateway(t *testing.T) *gateway {
+	g := &gateway{locks: make(map[string]*gws.Conn), tables: []string{"users", "schema_migrations"}}
+	upgrader := gws.Upgrader{}
+	g.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/query" {
+			g.query(w, r)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer func() {
+			conn.Close()
+			g.mu.Lock()
+			for name, holder := range g.locks {
+				if holder == conn {
+					delete(g.locks, name)
+				}
+			}
+			g.mu.Unlock()
+		}()
+		g.session(conn)
+	}))
+	t.Cleanup(g.Close)
+	return g
+}
+
+func (g *gateway) query(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		SQL string `json:"sql"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	resp := map[string]interface{}{"success": true}
+	switch {
+	case strings.HasPrefix(req.SQL, "CREATE TABLE IF NOT EXISTS `schema_migrations`"):
+	case strings.HasPrefix(req.SQL, "SELECT version, dirty FROM `schema_migrations`"):
+		data := []interface{}{}
+		if g.version != nil {
+			data = append(data, g.version)
+		}
+		resp["data"] = data
+	case strings.Contains(req.SQL, "FAIL"):
+		resp = map[string]interface{}{"success": false, "error": map[string]interface{}{"code": "ER_PARSE_ERROR", "message": "syntax error"}}
+	default:
+		g.executed = append(g.executed, req.SQL)
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func (g *gateway) session(conn *gws.Conn) {
+	var staged []func()
+	for {
+		var msg websocket.Message
+		if err := conn.ReadJSON(&msg); err != nil {
+			return
+		}
+		data := map[string]interface{}{"success": true}
+		switch msg.Type {
+		case websocket.FrameBegin:
+			data["transactionId"] = "tx"
+			staged = nil
+		case websocket.FrameCommit:
+			g.mu.Lock()
+			for _, apply := range staged {
+				apply()
+			}
+			g.mu.Unlock()
+			staged = nil
+		case websocket.FrameRollback:
+			staged = nil
+		case websocket.FrameQuery:
+			g.mu.Lock()
+			rows, apply := g.statement(conn, msg.SQL, msg.Params)
+			g.mu.Unlock()
+			if rows != nil {
+				data["data"] = rows
+			}
+			if apply != nil {
+				staged = append(staged, apply)
+			}
+		}
+		if err := conn.WriteJSON(websocket.Message{Type: websocket.FrameResponse, ID: msg.ID, Data: data}); err != nil {
+			return
+		}
+	}
+}
+
+// statement runs sql on a session, returning its rows and what it changes
+// on commit
+func (g *gateway) statement(conn *gws.Conn, sql string, params []interface{}) ([]interface{}, func()) {
+	lockName := func() string { name, _ := params[0].(string); return name }
+	switch {
+	case strings.Contains(sql, "GET_LOCK"):
+		if holder, held := g.locks[lockName()]; held && holder != conn {
+			return []interface{}{map[string]interface{}{"acquired": 0}}, nil
+		}
+		g.locks[lockName()] = conn
+		return []interface{}{map[string]interface{}{"acquired": 1}}, nil
+	case strings.Contains(sql, "IS_USED_LOCK"):
+		return []interface{}{map[string]interface{}{"held": g.locks[lockName()] == conn}}, nil
+	case strings.Contains(sql, "RELEASE_LOCK"):
+		delete(g.locks, lockName())
+		return []interface{}{map[string]interface{}{"released": 1}}, nil
+	case strings.HasPrefix(sql, "DELETE FROM `schema_migrations`"):
+		return nil, func() { g.version = nil }
+	case strings.HasPrefix(sql, "INSERT INTO `schema_migrations`"):
+		return nil, func() { g.version = map[string]interface{}{"version": params[0], "dirty": params[1]} }
+	case sql == "SHOW TABLES":
+		var rows []interface{}
+		for _, table := range g.tables {
+			rows = append(rows, map[string]interface{}{"Tables_in_mydb": table})
+		}
+		return rows, nil
+	}
+	g.executed = append(g.executed, sql)
+	return nil, nil
+}
+
+func (g *gateway) statements() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]string(nil), g.executed...)
+}
+
+func (g *gateway) dsn() string {
+	return strings.Replace(g.URL, "http://", "workersql://", 1) + "/mydb?ssl=false&apiKey=key&x-lock-timeout=50"
+}
+
+var files = fstest.MapFS{
+	"1_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id INT PRIMARY KEY);\nCREATE INDEX users_id ON users (id);")},
+	"1_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+	"2_add_email.up.sql":      {Data: []byte("ALTER TABLE users ADD email TEXT;")},
+	"2_add_email.down.sql":    {Data: []byte("ALTER TABLE users DROP email;")},
+}
+
+func TestMigrateThroughDriver(t *testing.T) {
+	g := newGateway(t)
+	source, err := iofs.New(files, ".")
+	require.NoError(t, err)
+	m, err := migrate.NewWithSourceInstance("iofs", source, g.dsn())
+	require.NoError(t, err)
+	defer m.Close()
+
+	require.NoError(t, m.Up())
+	assert.Equal(t, []string{
+		"CREATE TABLE users (id INT PRIMARY KEY)",
+		"CREATE INDEX users_id ON users (id)",
+		"ALTER TABLE users ADD email TEXT",
+	}, g.statements())
+	version, dirty, err := m.Version()
+	require.NoError(t, err)
+	assert.Equal(t, uint(2), version)
+	assert.False(t, dirty)
+
+	require.NoError(t, m.Steps(-1))
+	assert.Equal(t, "ALTER TABLE users DROP email", g.statements()[3])
+	version, _, err = m.Version()
+	require.NoError(t, err)
+	assert.Equal(t, uint(1), version)
+	require.NoError(t, m.Up())
+}
+
+func TestDriverFailedMigrationIsDirty(t *testing.T) {
+	g := newGateway(t)
+	driver, err := (&golangmigrate.Driver{}).Open(g.dsn())
+	require.NoError(t, err)
+	defer driver.Close()
+
+	err = driver.Run(strings.NewReader("ALTER TABLE users ADD email TEXT;\nFAIL;"))
+	var dbErr database.Error
+	require.True(t, errors.As(err, &dbErr))
+	assert.Equal(t, "FAIL", string(dbErr.Query))
+
+	require.NoError(t, driver.SetVersion(3, true))
+	version, dirty, err := driver.Version()
+	require.NoError(t, err)
+	assert.Equal(t, 3, version)
+	assert.True(t, dirty)
+
+	require.NoError(t, driver.SetVersion(database.NilVersion, false))
+	version, _, err = driver.Version()
+	require.NoError(t, err)
+	assert.Equal(t, database.NilVersion, version)
+}
+
+func TestDriverLockExcludesOtherRuns(t *testing.T) {
+	g := newGateway(t)
+	first, err := (&golangmigrate.Driver{}).Open(g.dsn())
+	require.NoError(t, err)
+	defer first.Close()
+	second, err := (&golangmigrate.Driver{}).Open(g.dsn())
+	require.NoError(t, err)
+	defer second.Close()
+
+	require.NoError(t, first.Lock())
+	assert.ErrorIs(t, first.Lock(), database.ErrLocked)
+	start := time.Now()
+	assert.ErrorIs(t, second.Lock(), database.ErrLocked)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	require.NoError(t, first.Unlock())
+	assert.ErrorIs(t, first.Unlock(), database.ErrNotLocked)
+	require.NoError(t, second.Lock())
+	require.NoError(t, second.Unlock())
+}
+
+func TestDriverDrop(t *testing.T) {
+	g := newGateway(t)
+	client, err := workersql.NewClient(g.dsn()[:strings.Index(g.dsn(), "&x-")])
+	require.NoError(t, err)
+	defer client.Close()
+	driver, err := golangmigrate.WithInstance(client, &golangmigrate.Config{DatabaseName: "mydb"})
+	require.NoError(t, err)
+
+	require.NoError(t, driver.Drop())
+	assert.Equal(t, []string{
+		"SET SESSION foreign_key_checks = ?",
+		"DROP TABLE IF EXISTS `users`",
+		"DROP TABLE IF EXISTS `schema_migrations`",
+	}, g.statements())
+}
@@ -0,0 +1,289 @@
+package migrate_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/migrate"
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+)
+
+// gateway fakes the statements a Migrator sends: it keeps the version row,
+// records migration statements, fails those containing FAIL and holds the
+// lock row for the transaction that selected it FOR UPDATE
+type gateway struct {
+	lock chan struct{}
+
+	mu       sync.Mutex
+	version  []interface{}
+	executed []string
+	nextTx   int
+	staged   map[string][][]interface{}
+	holder   string
+}
+
+func newGateway(t *testing.T) (*gateway, *workersql.Client) {
+	t.Helper()
+	g := &gateway{lock: make(chan struct{}, 1), staged: make(map[string][][]interface{})}
+	srv := httptest.NewServer(g)
+	t.Cleanup(srv.Close)
+	client, err := workersql.NewClient(workersql.Config{
+		APIEndpoint:          srv.URL,
+		RetryAttempts:        1,
+		TransactionTransport: workersql.TransactionTransportHTTP,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+	return g, client
+}
+
+func (g *gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.URL.Path == "/transactions" {
+		g.mu.Lock()
+		g.nextTx++
+		id := fmt.Sprintf("tx%d", g.nextTx)
+		g.staged[id] = nil
+		g.mu.Unlock()
+		fmt.Fprintf(w, `{"transactionId":%q}`, id)
+		return
+	}
+
+	var statement struct {
+		SQL    string        `json:"sql"`
+		Params []interface{} `json:"params"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&statement)
+	if r.URL.Path == "/query" {
+		g.query(w, statement.SQL)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/transactions/"), "/")
+	id, action := parts[0], parts[1]
+	switch {
+	case action == "query" && strings.HasSuffix(statement.SQL, "FOR UPDATE"):
+		select {
+		case g.lock <- struct{}{}:
+		case <-r.Context().Done():
+			return
+		}
+		g.mu.Lock()
+		g.holder = id
+		g.mu.Unlock()
+		fmt.Fprint(w, `{"success":true,"data":[{"id":1}]}`)
+	case action == "query":
+		g.mu.Lock()
+		if strings.HasPrefix(statement.SQL, "INSERT") {
+			g.staged[id] = append(g.staged[id], statement.Params)
+		}
+		g.mu.Unlock()
+		fmt.Fprint(w, `{"success":true,"affectedRows":1}`)
+	default:
+		g.mu.Lock()
+		if action == "commit" {
+			g.version = nil
+			for _, params := range g.staged[id] {
+				g.version = params
+			}
+		}
+		delete(g.staged, id)
+		release := g.holder == id
+		if release {
+			g.holder = ""
+		}
+		g.mu.Unlock()
+		if release {
+			<-g.lock
+		}
+		fmt.Fprint(w, `{"success":true}`)
+	}
+}
+
+func (g *gateway) query(w http.ResponseWriter, sql string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	switch {
+	case strings.HasPrefix(sql, "CREATE TABLE IF NOT EXISTS schema_migrations"),
+		strings.HasPrefix(sql, "INSERT IGNORE INTO schema_migrations_lock"):
+		fmt.Fprint(w, `{"success":true}`)
+	case strings.HasPrefix(sql, "SELECT version, dirty FROM schema_migrations"):
+		var data []map[string]interface{}
+		if g.version != nil {
+			data = append(data, map[string]interface{}{"version": g.version[0], "dirty": g.version[1]})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": data})
+	case strings.Contains(sql, "FAIL"):
+		fmt.Fprint(w, `{"success":false,"error":{"code":"ER_PARSE_ERROR","message":"syntax error"}}`)
+	default:
+		g.executed = append(g.executed, sql)
+		fmt.Fprint(w, `{"success":true}`)
+	}
+}
+
+func (g *gateway) statements() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]string(nil), g.executed...)
+}
+
+var migrations = fstest.MapFS{
+	"1_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id INT PRIMARY KEY);\nCREATE INDEX users_id ON users (id);\n")},
+	"1_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+	"2_add_email.up.sql":      {Data: []byte("-- emails are optional\nALTER TABLE users ADD email TEXT DEFAULT 'a;b';")},
+	"2_add_email.down.sql":    {Data: []byte("ALTER TABLE users DROP email;")},
+	"README.md":               {Data: []byte("not a migration")},
+}
+
+func TestLoad(t *testing.T) {
+	loaded, err := migrate.Load(migrations)
+	require.NoError(t, err)
+	require.Len(t, loaded, 2)
+	assert.Equal(t, int64(1), loaded[0].Version)
+	assert.Equal(t, "create_users", loaded[0].Name)
+	assert.Equal(t, "DROP TABLE users;", loaded[0].Down)
+	assert.Equal(t, "add_email", loaded[1].Name)
+
+	_, err = migrate.Load(fstest.MapFS{"1_a.down.sql": {Data: []byte("DROP TABLE a;")}})
+	assert.ErrorContains(t, err, "no up statements")
+
+	_, err = migrate.Load(fstest.MapFS{
+		"1_a.up.sql":   {Data: []byte("CREATE TABLE a (id INT);")},
+		"1_b.down.sql": {Data: []byte("DROP TABLE a;")},
+	})
+	assert.ErrorContains(t, err, "named both")
+}
+
+func TestSplitStatements(t *testing.T) {
+	assert.Equal(t, []string{
+		"CREATE TABLE a (note TEXT DEFAULT 'x;y')",
+		"-- a comment; with a semicolon\n\t\tINSERT INTO a VALUES (\"it\\\";s\")",
+		"/* a; b */ UPDATE `odd;name` SET x = 1",
+	}, migrate.SplitStatements(`
+		CREATE TABLE a (note TEXT DEFAULT 'x;y');
+		-- a comment; with a semicolon
+		INSERT INTO a VALUES ("it\";s");
+		/* a; b */ UPDATE `+"`odd;name`"+` SET x = 1;
+		# trailing comment
+	`))
+}
+
+func TestUpDownStatus(t *testing.T) {
+	g, client := newGateway(t)
+	ctx := context.Background()
+	m, err := migrate.New(client, migrations, migrate.Options{})
+	require.NoError(t, err)
+
+	status, err := m.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, status, 2)
+	assert.False(t, status[0].Applied)
+
+	require.NoError(t, m.Up(ctx))
+	assert.Equal(t, []string{
+		"CREATE TABLE users (id INT PRIMARY KEY)",
+		"CREATE INDEX users_id ON users (id)",
+		"-- emails are optional\nALTER TABLE users ADD email TEXT DEFAULT 'a;b'",
+	}, g.statements())
+	version, dirty, err := m.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), version)
+	assert.False(t, dirty)
+
+	// Nothing is pending
+	require.NoError(t, m.Up(ctx))
+	assert.Len(t, g.statements(), 3)
+
+	require.NoError(t, m.Down(ctx))
+	assert.Equal(t, "ALTER TABLE users DROP email", g.statements()[3])
+	status, err = m.Status(ctx)
+	require.NoError(t, err)
+	assert.True(t, status[0].Applied)
+	assert.False(t, status[1].Applied)
+
+	require.NoError(t, m.Down(ctx))
+	version, _, err = m.Version(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, version)
+}
+
+func TestDirtyRecovery(t *testing.T) {
+	g, client := newGateway(t)
+	ctx := context.Background()
+	broken := fstest.MapFS{
+		"1_create_users.up.sql": migrations["1_create_users.up.sql"],
+		"2_add_email.up.sql":    {Data: []byte("ALTER TABLE users ADD email TEXT;\nFAIL;")},
+	}
+	m, err := migrate.New(client, broken, migrate.Options{})
+	require.NoError(t, err)
+
+	err = m.Up(ctx)
+	assert.ErrorContains(t, err, "applying 2_add_email")
+	version, dirty, err := m.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), version)
+	assert.True(t, dirty)
+
+	err = m.Up(ctx)
+	var dirtyErr *migrate.DirtyError
+	require.True(t, errors.As(err, &dirtyErr))
+	assert.Equal(t, int64(2), dirtyErr.Version)
+	assert.True(t, errors.Is(err, migrate.ErrDirty))
+	status, err := m.Status(ctx)
+	require.NoError(t, err)
+	assert.True(t, status[0].Applied)
+	assert.True(t, status[1].Dirty)
+	assert.False(t, status[1].Applied)
+
+	// The half-applied column was dropped by hand
+	require.NoError(t, m.Force(ctx, 1))
+	fixed, err := migrate.New(client, migrations, migrate.Options{})
+	require.NoError(t, err)
+	require.NoError(t, fixed.Up(ctx))
+	version, dirty, err = fixed.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), version)
+	assert.False(t, dirty)
+	assert.Equal(t, "-- emails are optional\nALTER TABLE users ADD email TEXT DEFAULT 'a;b'", g.statements()[3])
+}
+
+func TestConcurrentUpAppliesOnce(t *testing.T) {
+	g, client := newGateway(t)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := range errs {
+		m, err := migrate.New(client, migrations, migrate.Options{})
+		require.NoError(t, err)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = m.Up(ctx)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+	assert.Len(t, g.statements(), 3)
+}
+
+func TestInvalidMigrations(t *testing.T) {
+	_, client := newGateway(t)
+	_, err := migrate.NewWithMigrations(client, []migrate.Migration{{Version: 1, Up: "x"}, {Version: 1, Up: "y"}}, migrate.Options{})
+	assert.ErrorContains(t, err, "duplicate")
+	_, err = migrate.NewWithMigrations(client, nil, migrate.Options{Table: "bad name"})
+	assert.ErrorContains(t, err, "invalid table name")
+}
@@ -0,0 +1,76 @@
+package params_test
+
+import (
+	"testing"
+
+	"github.com/healthfees-org/workersql/sdk/go/internal/params"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpand(t *testing.T) {
+	t.Run("no list params", func(t *testing.T) {
+		sql, args, err := params.Expand("SELECT * FROM users WHERE id = ?", []interface{}{1})
+
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT * FROM users WHERE id = ?", sql)
+		assert.Equal(t, []interface{}{1}, args)
+	})
+
+	t.Run("int slice", func(t *testing.T) {
+		sql, args, err := params.Expand(
+			"SELECT * FROM users WHERE status = ? AND id IN (?) LIMIT ?",
+			[]interface{}{"active", []int{1, 2, 3}, 10},
+		)
+
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT * FROM users WHERE status = ? AND id IN (?, ?, ?) LIMIT ?", sql)
+		assert.Equal(t, []interface{}{"active", 1, 2, 3, 10}, args)
+	})
+
+	t.Run("explicit list", func(t *testing.T) {
+		sql, args, err := params.Expand("SELECT * FROM t WHERE a IN (?)", []interface{}{params.List{"x", 2}})
+
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT * FROM t WHERE a IN (?, ?)", sql)
+		assert.Equal(t, []interface{}{"x", 2}, args)
+	})
+
+	t.Run("empty slice", func(t *testing.T) {
+		sql, args, err := params.Expand("SELECT * FROM users WHERE id NOT IN (?) AND a = ?", []interface{}{[]string{}, 1})
+
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT * FROM users WHERE id NOT IN ("+params.EmptyList+") AND a = ?", sql)
+		assert.Equal(t, []interface{}{1}, args)
+	})
+
+	t.Run("byte slice is scalar", func(t *testing.T) {
+		blob := []byte{0x01, 0x02}
+		sql, args, err := params.Expand("INSERT INTO files (data, tags) VALUES (?, ?)", []interface{}{blob, "a"})
+
+		require.NoError(t, err)
+		assert.Equal(t, "INSERT INTO files (data, tags) VALUES (?, ?)", sql)
+		assert.Equal(t, []interface{}{blob, "a"}, args)
+	})
+
+	t.Run("placeholders in literals and comments are ignored", func(t *testing.T) {
+		sql, args, err := params.Expand(
+			"SELECT '?', \"it''s ?\", `?` FROM t -- ?\nWHERE /* ? */ id IN (?) # ?",
+			[]interface{}{[]int64{7, 8}},
+		)
+
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT '?', \"it''s ?\", `?` FROM t -- ?\nWHERE /* ? */ id IN (?, ?) # ?", sql)
+		assert.Equal(t, []interface{}{int64(7), int64(8)}, args)
+	})
+
+	t.Run("error on too few params", func(t *testing.T) {
+		_, _, err := params.Expand("SELECT * FROM t WHERE a IN (?) AND b = ?", []interface{}{[]int{1}})
+		assert.Error(t, err)
+	})
+
+	t.Run("error on too many params", func(t *testing.T) {
+		_, _, err := params.Expand("SELECT * FROM t WHERE a IN (?)", []interface{}{[]int{1}, 2})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,118 @@
+package pool_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/internal/pool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newExhaustedPool(t *testing.T, opts pool.Options) (*pool.Pool, *pool.Connection) {
+	opts.MinConnections = 1
+	opts.MaxConnections = 1
+	p := pool.NewPool(opts)
+	t.Cleanup(func() { _ = p.Close() })
+
+	conn, err := p.Acquire(context.Background())
+	require.NoError(t, err)
+	return p, conn
+}
+
+func TestAcquireWaitsForRelease(t *testing.T) {
+	p, held := newExhaustedPool(t, pool.Options{})
+
+	got := make(chan *pool.Connection, 1)
+	go func() {
+		conn, err := p.Acquire(context.Background())
+		assert.NoError(t, err)
+		got <- conn
+	}()
+
+	assert.Eventually(t, func() bool { return p.GetStats()["waiting"] == 1 }, time.Second, time.Millisecond)
+	p.Release(held)
+
+	conn := <-got
+	assert.Equal(t, held.ID, conn.ID)
+	assert.True(t, conn.InUse, "connection is handed over without becoming idle")
+
+	stats := p.GetStats()
+	assert.Equal(t, 0, stats["waiting"])
+	assert.Equal(t, int64(1), stats["waitCount"])
+	assert.Greater(t, stats["waitDuration"].(time.Duration), time.Duration(0))
+}
+
+func TestAcquireServesWaitersInOrder(t *testing.T) {
+	p, held := newExhaustedPool(t, pool.Options{})
+
+	var (
+		mu    sync.Mutex
+		order []int
+		wg    sync.WaitGroup
+	)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			conn, err := p.Acquire(context.Background())
+			if !assert.NoError(t, err) {
+				return
+			}
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+			p.Release(conn)
+		}(i)
+		// Queue the waiters one at a time so their order is known
+		assert.Eventually(t, func() bool { return p.GetStats()["waiting"] == i+1 }, time.Second, time.Millisecond)
+	}
+
+	p.Release(held)
+	wg.Wait()
+	assert.Equal(t, []int{0, 1, 2}, order)
+}
+
+func TestAcquireHonoursDeadlines(t *testing.T) {
+	p, held := newExhaustedPool(t, pool.Options{AcquireTimeout: 20 * time.Millisecond})
+
+	_, err := p.Acquire(context.Background())
+	assert.ErrorIs(t, err, pool.ErrAcquireTimeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = p.Acquire(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	stats := p.GetStats()
+	assert.Equal(t, int64(1), stats["acquireTimeouts"])
+	assert.Equal(t, 0, stats["waiting"])
+
+	// The connection still works for later callers
+	p.Release(held)
+	conn, err := p.Acquire(context.Background())
+	require.NoError(t, err)
+	p.Release(conn)
+}
+
+func TestCloseWakesWaiters(t *testing.T) {
+	p := pool.NewPool(pool.Options{MinConnections: 1, MaxConnections: 1})
+	_, err := p.Acquire(context.Background())
+	require.NoError(t, err)
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := p.Acquire(context.Background())
+		errCh <- err
+	}()
+	assert.Eventually(t, func() bool { return p.GetStats()["waiting"] == 1 }, time.Second, time.Millisecond)
+
+	require.NoError(t, p.Close())
+	assert.True(t, errors.Is(<-errCh, pool.ErrPoolClosed))
+
+	_, err = p.Acquire(context.Background())
+	assert.ErrorIs(t, err, pool.ErrPoolClosed)
+}
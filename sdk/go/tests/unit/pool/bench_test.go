@@ -0,0 +1,159 @@
+package pool_test
+
+import (
+	"context"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/internal/pool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// latencyBudget is the p99 target for an uncontended Acquire and Release
+const latencyBudget = time.Microsecond
+
+func newBenchPool(b testing.TB, max int) *pool.Pool {
+	p := pool.NewPool(pool.Options{MinConnections: max, MaxConnections: max})
+	b.Cleanup(func() { _ = p.Close() })
+	return p
+}
+
+// latencies collects acquire/release round trips from several goroutines
+type latencies struct {
+	mu      sync.Mutex
+	samples []time.Duration
+}
+
+func (l *latencies) add(samples []time.Duration) {
+	l.mu.Lock()
+	l.samples = append(l.samples, samples...)
+	l.mu.Unlock()
+}
+
+func (l *latencies) p99() time.Duration {
+	if len(l.samples) == 0 {
+		return 0
+	}
+	sort.Slice(l.samples, func(i, j int) bool { return l.samples[i] < l.samples[j] })
+	return l.samples[len(l.samples)*99/100]
+}
+
+func acquireRelease(tb testing.TB, p *pool.Pool, ctx context.Context) time.Duration {
+	start := time.Now()
+	conn, err := p.Acquire(ctx)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	p.Release(conn)
+	return time.Since(start)
+}
+
+func BenchmarkAcquireRelease(b *testing.B) {
+	p := newBenchPool(b, 1)
+	ctx := context.Background()
+	var l latencies
+	samples := make([]time.Duration, 0, b.N)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		samples = append(samples, acquireRelease(b, p, ctx))
+	}
+	b.StopTimer()
+	l.add(samples)
+	b.ReportMetric(float64(l.p99().Nanoseconds()), "p99-ns")
+}
+
+func benchmarkParallel(b *testing.B, max int) {
+	p := newBenchPool(b, max)
+	ctx := context.Background()
+	var l latencies
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var samples []time.Duration
+		for pb.Next() {
+			samples = append(samples, acquireRelease(b, p, ctx))
+		}
+		l.add(samples)
+	})
+	b.StopTimer()
+	b.ReportMetric(float64(l.p99().Nanoseconds()), "p99-ns")
+}
+
+// BenchmarkAcquireReleaseParallel has a connection for every goroutine
+func BenchmarkAcquireReleaseParallel(b *testing.B) {
+	benchmarkParallel(b, runtime.GOMAXPROCS(0))
+}
+
+// BenchmarkAcquireReleaseContended has goroutines queueing for connections
+func BenchmarkAcquireReleaseContended(b *testing.B) {
+	benchmarkParallel(b, 2)
+}
+
+// TestAcquireReleaseLatency guards the pool's fast path against regressions
+func TestAcquireReleaseLatency(t *testing.T) {
+	if testing.Short() || raceEnabled {
+		t.Skip("latency budget only holds for optimized, uninstrumented builds")
+	}
+	p := newBenchPool(t, 4)
+	ctx := context.Background()
+
+	// Take the best of a few runs so a noisy neighbour doesn't fail the test
+	best := time.Hour
+	for run := 0; run < 5 && best > latencyBudget; run++ {
+		var l latencies
+		samples := make([]time.Duration, 0, 100000)
+		for i := 0; i < cap(samples); i++ {
+			samples = append(samples, acquireRelease(t, p, ctx))
+		}
+		l.add(samples)
+		if p99 := l.p99(); p99 < best {
+			best = p99
+		}
+	}
+	assert.Less(t, best, latencyBudget, "p99 acquire/release latency")
+}
+
+func TestConcurrentAcquireNeverExceedsMax(t *testing.T) {
+	const max = 3
+	p := pool.NewPool(pool.Options{MinConnections: 1, MaxConnections: max, MaxUseCount: 5})
+	defer p.Close()
+
+	var active, peak int32
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				conn, err := p.Acquire(context.Background())
+				if !assert.NoError(t, err) {
+					return
+				}
+				n := atomic.AddInt32(&active, 1)
+				for {
+					old := atomic.LoadInt32(&peak)
+					if n <= old || atomic.CompareAndSwapInt32(&peak, old, n) {
+						break
+					}
+				}
+				atomic.AddInt32(&active, -1)
+				p.Release(conn)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, atomic.LoadInt32(&peak), int32(max))
+	stats := p.GetStats()
+	require.LessOrEqual(t, stats["total"].(int), max)
+	assert.Equal(t, 0, stats["active"])
+	assert.Greater(t, stats["recycled"].(int64), int64(0))
+}
@@ -0,0 +1,73 @@
+package pool_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/internal/pool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxUseCountRecyclesConnection(t *testing.T) {
+	p := pool.NewPool(pool.Options{MinConnections: 1, MaxConnections: 1, MaxUseCount: 2})
+	defer p.Close()
+	ctx := context.Background()
+
+	first, err := p.Acquire(ctx)
+	require.NoError(t, err)
+	p.Release(first)
+	second, err := p.Acquire(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, second.ID)
+	p.Release(second)
+
+	stats := p.GetStats()
+	assert.Equal(t, int64(1), stats["recycled"])
+	assert.Equal(t, 1, stats["total"], "replaced to keep MinConnections")
+
+	third, err := p.Acquire(ctx)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.ID, third.ID)
+	p.Release(third)
+}
+
+func TestMaxLifetimeRecyclesIdleConnection(t *testing.T) {
+	p := pool.NewPool(pool.Options{MinConnections: 2, MaxConnections: 2, MaxLifetime: 10 * time.Millisecond})
+	defer p.Close()
+
+	conn, err := p.Acquire(context.Background())
+	require.NoError(t, err)
+	time.Sleep(15 * time.Millisecond)
+
+	// The idle connection has expired too and is replaced on acquire
+	other, err := p.Acquire(context.Background())
+	require.NoError(t, err)
+	assert.Less(t, time.Since(other.CreatedAt), 10*time.Millisecond)
+
+	p.Release(conn)
+	stats := p.GetStats()
+	assert.Equal(t, int64(2), stats["recycled"])
+	assert.Equal(t, 2, stats["total"])
+	assert.Equal(t, 1, stats["active"])
+}
+
+func TestExpiredConnectionHandedToWaiterIsReplaced(t *testing.T) {
+	p, held := newExhaustedPool(t, pool.Options{MaxUseCount: 1})
+
+	got := make(chan *pool.Connection, 1)
+	go func() {
+		conn, err := p.Acquire(context.Background())
+		assert.NoError(t, err)
+		got <- conn
+	}()
+
+	assert.Eventually(t, func() bool { return p.GetStats()["waiting"] == 1 }, time.Second, time.Millisecond)
+	p.Release(held)
+
+	conn := <-got
+	assert.NotEqual(t, held.ID, conn.ID)
+	assert.True(t, conn.InUse)
+	assert.Equal(t, 1, p.GetStats()["total"])
+}
@@ -0,0 +1,101 @@
+package pool_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/internal/pool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcquirePingsIdleConnection(t *testing.T) {
+	var pings int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/health", r.URL.Path)
+		assert.Equal(t, "Bearer key", r.Header.Get("Authorization"))
+		atomic.AddInt32(&pings, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	p := pool.NewPool(pool.Options{
+		APIEndpoint: server.URL, APIKey: "key",
+		MinConnections: 1, MaxConnections: 1,
+		PingAfterIdle: time.Millisecond,
+	})
+	defer p.Close()
+	ctx := context.Background()
+
+	conn, err := p.Acquire(ctx)
+	require.NoError(t, err)
+	p.Release(conn)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&pings), "recent connections are not pinged")
+
+	time.Sleep(5 * time.Millisecond)
+	again, err := p.Acquire(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, conn.ID, again.ID, "an error status still proves the transport works")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&pings))
+	p.Release(again)
+
+	stats := p.GetStats()
+	assert.Equal(t, int64(1), stats["pings"])
+	assert.Equal(t, int64(0), stats["pingFailures"])
+}
+
+func TestAcquireReplacesBrokenConnection(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	endpoint := server.URL
+	server.Close()
+
+	p := pool.NewPool(pool.Options{
+		APIEndpoint:    endpoint,
+		MinConnections: 1, MaxConnections: 1,
+		PingAfterIdle: time.Millisecond,
+		PingTimeout:   time.Second,
+	})
+	defer p.Close()
+	ctx := context.Background()
+
+	conn, err := p.Acquire(ctx)
+	require.NoError(t, err)
+	p.Release(conn)
+	time.Sleep(5 * time.Millisecond)
+
+	replacement, err := p.Acquire(ctx)
+	require.NoError(t, err)
+	assert.NotEqual(t, conn.ID, replacement.ID)
+	assert.True(t, replacement.InUse)
+
+	stats := p.GetStats()
+	assert.Equal(t, int64(1), stats["pingFailures"])
+	assert.Equal(t, 1, stats["total"])
+}
+
+func TestHealthLoopPingsIdleConnections(t *testing.T) {
+	var pings int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&pings, 1)
+	}))
+	defer server.Close()
+
+	p := pool.NewPool(pool.Options{
+		APIEndpoint:    server.URL,
+		MinConnections: 1, MaxConnections: 2,
+		HealthCheckInterval: 5 * time.Millisecond,
+		PingAfterIdle:       time.Millisecond,
+	})
+	defer p.Close()
+
+	conn, err := p.Acquire(context.Background())
+	require.NoError(t, err)
+	p.Release(conn)
+
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&pings) >= 1 }, time.Second, time.Millisecond)
+	assert.Eventually(t, func() bool { return p.GetStats()["idle"] == 1 }, time.Second, time.Millisecond)
+}
@@ -0,0 +1,132 @@
+package qb_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql/qb"
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersqltest"
+)
+
+func assertSQL(t *testing.T, s qb.Statement, sql string, params ...interface{}) {
+	t.Helper()
+	got, gotParams, err := s.ToSQL()
+	require.NoError(t, err)
+	assert.Equal(t, sql, got)
+	assert.Equal(t, params, gotParams)
+}
+
+func TestSelect(t *testing.T) {
+	assertSQL(t, qb.Select("id", "name").From("users").Where(qb.Eq("status", "active")).Limit(10),
+		"SELECT `id`, `name` FROM `users` WHERE `status` = ? LIMIT 10", "active")
+
+	assertSQL(t, qb.Select().From("users"), "SELECT * FROM `users`")
+
+	assertSQL(t, qb.Select("u.name AS author", "o.*").
+		Distinct().
+		From("users u").
+		LeftJoin("orders o", qb.Eq("o.user_id", qb.Col("u.id"))).
+		Where(qb.Or(qb.Gt("o.total", 100), qb.IsNull("o.id")), qb.In("u.role", []string{"admin", "owner"})).
+		OrderBy("u.name", "o.created_at desc").
+		Limit(20).
+		Offset(40),
+		"SELECT DISTINCT `u`.`name` AS `author`, `o`.* FROM `users` AS `u` LEFT JOIN `orders` AS `o` ON `o`.`user_id` = `u`.`id`"+
+			" WHERE (`o`.`total` > ? OR `o`.`id` IS NULL) AND `u`.`role` IN (?, ?) ORDER BY `u`.`name`, `o`.`created_at` DESC LIMIT 20 OFFSET 40",
+		100, "admin", "owner")
+}
+
+func TestSelectAggregates(t *testing.T) {
+	assertSQL(t, qb.Select("status").
+		ColumnExpr(qb.Raw("COUNT(*)"), "n").
+		From("orders").
+		Where(qb.Between("created_at", "2024-01-01", "2024-12-31")).
+		GroupBy("status").
+		Having(qb.Raw("COUNT(*) > ?", 5)),
+		"SELECT `status`, COUNT(*) AS `n` FROM `orders` WHERE `created_at` BETWEEN ? AND ? GROUP BY `status` HAVING (COUNT(*) > ?)",
+		"2024-01-01", "2024-12-31", 5)
+}
+
+func TestSubqueries(t *testing.T) {
+	bigSpenders := qb.Select("user_id").From("orders").Where(qb.Gt("total", 1000))
+	assertSQL(t, qb.Select("id").From("users").Where(qb.In("id", bigSpenders), qb.Eq("active", true)),
+		"SELECT `id` FROM `users` WHERE `id` IN (SELECT `user_id` FROM `orders` WHERE `total` > ?) AND `active` = ?",
+		1000, true)
+
+	assertSQL(t, qb.Select("id").From("users u").Where(qb.NotExists(
+		qb.Select().From("bans b").Where(qb.Eq("b.user_id", qb.Col("u.id"))),
+	)), "SELECT `id` FROM `users` AS `u` WHERE NOT EXISTS (SELECT * FROM `bans` AS `b` WHERE `b`.`user_id` = `u`.`id`)")
+
+	assertSQL(t, qb.Select("t.n").FromSubquery(qb.Select("id AS n").From("users").Where(qb.Lt("id", 5)), "t"),
+		"SELECT `t`.`n` FROM (SELECT `id` AS `n` FROM `users` WHERE `id` < ?) AS `t`", 5)
+}
+
+func TestConditions(t *testing.T) {
+	assertSQL(t, qb.Delete("users").Where(qb.Eq("deleted_at", nil), qb.NotEq("email", nil)),
+		"DELETE FROM `users` WHERE `deleted_at` IS NULL AND `email` IS NOT NULL")
+	assertSQL(t, qb.Delete("users").Where(qb.In("id", []int{})), "DELETE FROM `users` WHERE 1 = 0")
+	assertSQL(t, qb.Delete("users").Where(qb.NotIn("id", []int{})), "DELETE FROM `users` WHERE 1 = 1")
+	assertSQL(t, qb.Delete("users").Where(qb.Not(qb.And(qb.Like("name", "a%"), qb.Gte("age", 18), qb.Lte("age", 65)))),
+		"DELETE FROM `users` WHERE NOT ((`name` LIKE ? AND `age` >= ? AND `age` <= ?))", "a%", 18, 65)
+	assertSQL(t, qb.Delete("users").Where(qb.Raw("a = ? OR b = ?", 1, 2), qb.Eq("c", 3)),
+		"DELETE FROM `users` WHERE (a = ? OR b = ?) AND `c` = ?", 1, 2, 3)
+}
+
+func TestIdentifiersAreQuoted(t *testing.T) {
+	assertSQL(t, qb.Select("na`me").From("users").Where(qb.Eq("id", "1 OR 1=1")),
+		"SELECT `na``me` FROM `users` WHERE `id` = ?", "1 OR 1=1")
+
+	for _, s := range []qb.Statement{
+		qb.Select("name`; DROP TABLE users; --").From("users"),
+		qb.Select("id").From("users").OrderBy("id; DROP TABLE users"),
+		qb.Select("id").From("users x y"),
+		qb.Select("").From("users"),
+		qb.Select("a..b").From("users"),
+		qb.Select("id").From("users").Offset(10),
+	} {
+		_, _, err := s.ToSQL()
+		assert.Error(t, err)
+	}
+}
+
+func TestInsert(t *testing.T) {
+	assertSQL(t, qb.Insert("users").Columns("name", "email").Values("ada", "ada@example.com").Values("grace", nil),
+		"INSERT INTO `users` (`name`, `email`) VALUES (?, ?), (?, ?)", "ada", "ada@example.com", "grace", nil)
+	assertSQL(t, qb.Insert("users").SetMap(map[string]interface{}{"name": "ada", "age": 36}),
+		"INSERT INTO `users` (`age`, `name`) VALUES (?, ?)", 36, "ada")
+	assertSQL(t, qb.Insert("archive").Columns("id").Select(qb.Select("id").From("users").Where(qb.Eq("active", false))),
+		"INSERT INTO `archive` (`id`) SELECT `id` FROM `users` WHERE `active` = ?", false)
+
+	_, _, err := qb.Insert("users").Columns("name", "email").Values("ada").ToSQL()
+	assert.Error(t, err)
+	_, _, err = qb.Insert("users").ToSQL()
+	assert.Error(t, err)
+}
+
+func TestUpdate(t *testing.T) {
+	assertSQL(t, qb.Update("products").Set("stock", qb.Raw("`stock` - ?", 1)).Set("updated_by", "ada").Where(qb.Eq("id", 7)),
+		"UPDATE `products` SET `stock` = `stock` - ?, `updated_by` = ? WHERE `id` = ?", 1, "ada", 7)
+	assertSQL(t, qb.Update("users").SetMap(map[string]interface{}{"name": "ada", "age": 36}).Where(qb.Eq("id", 1)),
+		"UPDATE `users` SET `age` = ?, `name` = ? WHERE `id` = ?", 36, "ada", 1)
+
+	_, _, err := qb.Update("users").Where(qb.Eq("id", 1)).ToSQL()
+	assert.Error(t, err)
+}
+
+func TestRunsOnQuerier(t *testing.T) {
+	fake := workersqltest.NewFakeClient()
+	fake.On("SELECT `name` FROM `users` WHERE `id` = ?").Return(map[string]interface{}{"name": "ada"})
+	fake.On("UPDATE `users` SET `name` = ? WHERE `id` = ?").ReturnExec(1, 0)
+	ctx := context.Background()
+
+	resp, err := qb.Select("name").From("users").Where(qb.Eq("id", 7)).Query(ctx, fake)
+	require.NoError(t, err)
+	assert.Equal(t, "ada", resp.Data[0]["name"])
+
+	res, err := qb.Update("users").Set("name", "grace").Where(qb.Eq("id", 7)).Exec(ctx, fake)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.AffectedRows)
+	assert.Equal(t, []interface{}{"grace", 7}, fake.Calls()[1].Params)
+}
@@ -0,0 +1,100 @@
+package shardmap_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/shardmap"
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	// Replace the file atomically so the router never reads it half written
+	require.NoError(t, os.WriteFile(path+".tmp", []byte(content), 0o644))
+	require.NoError(t, os.Rename(path+".tmp", path))
+}
+
+// newShardClient starts a server per shard answering with its name
+func newShardClient(t *testing.T, shards int) *workersql.Client {
+	endpoints := make(map[string]string)
+	for i := 0; i < shards; i++ {
+		name := fmt.Sprintf("shard_%d", i)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"success": true, "data": [{"shard": "` + name + `"}], "affectedRows": 1}`))
+		}))
+		t.Cleanup(srv.Close)
+		endpoints[name] = srv.URL
+	}
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: endpoints["shard_0"], RetryAttempts: 1, Shards: endpoints})
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestRouterRoutesByShardMap(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "routing-policy.yaml"), "version: 1\ntenants:\n  tenant_a: shard_1\nranges:\n  - prefix: vip_\n    shard: shard_3\n")
+	writeFile(t, filepath.Join(dir, "table-policies", "accounts.yaml"), "shard_by: account_id\nrouting:\n  strategy: custom\n")
+
+	router, err := shardmap.Load(newShardClient(t, 4), dir, shardmap.Options{Tenant: "tenant_b", ReloadInterval: -1})
+	require.NoError(t, err)
+	defer router.Close()
+	ctx := context.Background()
+
+	resp, err := router.Query(ctx, "SELECT * FROM accounts WHERE account_id = ?", "vip_7")
+	require.NoError(t, err)
+	assert.Equal(t, "shard_3", resp.Data[0]["shard"], "the key's range decides")
+
+	resp, err = router.Query(shardmap.WithTenant(ctx, "tenant_a"), "SELECT * FROM accounts WHERE account_id = ?", "vip_7")
+	require.NoError(t, err)
+	assert.Equal(t, "shard_1", resp.Data[0]["shard"], "tenant assignments win")
+
+	exec, err := router.Exec(ctx, "UPDATE accounts SET name = ? WHERE account_id = ?", "x", "vip_1")
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, exec.AffectedRows)
+
+	assert.Equal(t, "shard_1", router.Shard("tenant_a", "SELECT 1"))
+}
+
+func TestRouterHotReload(t *testing.T) {
+	dir := t.TempDir()
+	policy := filepath.Join(dir, "routing-policy.yaml")
+	writeFile(t, policy, "tenants:\n  tenant_a: shard_1\n")
+
+	var version int32 = 1
+	reloads := make(chan error, 10)
+	router, err := shardmap.Load(newShardClient(t, 4), dir, shardmap.Options{
+		Tenant:         "tenant_a",
+		ReloadInterval: 10 * time.Millisecond,
+		Version:        func(context.Context) (int, error) { return int(atomic.LoadInt32(&version)), nil },
+		OnReload:       func(_ *workersql.ShardingConfig, err error) { reloads <- err },
+	})
+	require.NoError(t, err)
+	defer router.Close()
+	assert.Equal(t, "shard_1", router.Shard("tenant_a", "SELECT 1"))
+
+	writeFile(t, policy, "tenants:\n  tenant_a: shard_2\n  tenant_b: shard_0\n")
+	require.NoError(t, <-reloads)
+	assert.Equal(t, "shard_2", router.Shard("tenant_a", "SELECT 1"), "file changes are picked up")
+
+	writeFile(t, policy, "ranges:\n  - prefix: x\n")
+	assert.Error(t, <-reloads)
+	assert.Equal(t, "shard_2", router.Shard("tenant_a", "SELECT 1"), "an invalid map is rejected")
+
+	writeFile(t, policy, "tenants:\n  tenant_a: shard_2\n  tenant_b: shard_0\n")
+	require.NoError(t, <-reloads)
+	atomic.StoreInt32(&version, 2)
+	require.NoError(t, <-reloads)
+	assert.Equal(t, 2, router.Version(), "routing version changes trigger a reload")
+}
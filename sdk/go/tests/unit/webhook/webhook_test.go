@@ -0,0 +1,146 @@
+package webhook_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/webhook"
+)
+
+var now = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+const backupEvent = `{
+	"id": "evt_1",
+	"type": "backup.completed",
+	"createdAt": "2024-05-01T11:59:58Z",
+	"tenantId": "acme",
+	"data": {"backupId": "bk_7", "status": "success", "shards": ["shard-0"], "sizeBytes": 4096, "location": "backups/bk_7.sql"}
+}`
+
+func newVerifier(t *testing.T, secrets ...string) *webhook.Verifier {
+	v, err := webhook.NewVerifier(webhook.Config{Secrets: secrets, Now: func() time.Time { return now }})
+	require.NoError(t, err)
+	return v
+}
+
+func TestVerify(t *testing.T) {
+	v := newVerifier(t, "old-secret", "new-secret")
+	payload := []byte(backupEvent)
+
+	assert.NoError(t, v.Verify(payload, webhook.Sign("new-secret", payload, now)))
+	assert.NoError(t, v.Verify(payload, webhook.Sign("old-secret", payload, now.Add(-time.Minute))))
+
+	// Both secrets listed by a sender rotating them
+	both := webhook.Sign("other", payload, now) + ",v1=" + strings.Split(webhook.Sign("new-secret", payload, now), "v1=")[1]
+	assert.NoError(t, v.Verify(payload, both))
+
+	assert.ErrorIs(t, v.Verify(payload, webhook.Sign("wrong", payload, now)), webhook.ErrInvalidSignature)
+	assert.ErrorIs(t, v.Verify([]byte(`{"id": "evt_2"}`), webhook.Sign("new-secret", payload, now)), webhook.ErrInvalidSignature)
+	assert.ErrorIs(t, v.Verify(payload, webhook.Sign("new-secret", payload, now.Add(-10*time.Minute))), webhook.ErrTimestampOutOfRange)
+	assert.ErrorIs(t, v.Verify(payload, webhook.Sign("new-secret", payload, now.Add(10*time.Minute))), webhook.ErrTimestampOutOfRange)
+	assert.ErrorIs(t, v.Verify(payload, ""), webhook.ErrMissingSignature)
+	assert.ErrorIs(t, v.Verify(payload, "v1=abcd"), webhook.ErrMissingSignature)
+
+	_, err := webhook.NewVerifier(webhook.Config{})
+	assert.Error(t, err)
+}
+
+func TestDecode(t *testing.T) {
+	event, err := webhook.Parse([]byte(backupEvent))
+	require.NoError(t, err)
+	assert.Equal(t, "evt_1", event.ID)
+	assert.Equal(t, "acme", event.TenantID)
+
+	data, err := event.Decode()
+	require.NoError(t, err)
+	backup, ok := data.(*webhook.BackupCompleted)
+	require.True(t, ok)
+	assert.Equal(t, "bk_7", backup.BackupID)
+	assert.True(t, backup.Succeeded())
+	assert.Equal(t, int64(4096), backup.SizeBytes)
+
+	event, err = webhook.Parse([]byte(`{"id": "evt_2", "type": "quota.warning", "data": {"resource": "storage_bytes", "used": 850, "limit": 1000, "threshold": 0.8}}`))
+	require.NoError(t, err)
+	data, err = event.Decode()
+	require.NoError(t, err)
+	assert.InDelta(t, 0.85, data.(*webhook.QuotaWarning).Fraction(), 1e-9)
+
+	event, err = webhook.Parse([]byte(`{"id": "evt_3", "type": "tenant.created", "data": {}}`))
+	require.NoError(t, err)
+	_, err = event.Decode()
+	assert.ErrorIs(t, err, webhook.ErrUnknownEventType)
+
+	_, err = webhook.Parse([]byte(`{"type": "quota.warning"}`))
+	assert.Error(t, err)
+}
+
+func deliver(h http.Handler, payload string, signature string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/hooks", strings.NewReader(payload))
+	if signature != "" {
+		req.Header.Set(webhook.SignatureHeader, signature)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandler(t *testing.T) {
+	var backups []*webhook.BackupCompleted
+	var others []string
+	var errs []error
+	failSchema := true
+	h := &webhook.Handler{
+		Verifier: newVerifier(t, "secret"),
+		OnBackupCompleted: func(_ context.Context, _ *webhook.Event, b *webhook.BackupCompleted) error {
+			backups = append(backups, b)
+			return nil
+		},
+		OnSchemaChanged: func(context.Context, *webhook.Event, *webhook.SchemaChanged) error {
+			if failSchema {
+				return errors.New("database down")
+			}
+			return nil
+		},
+		OnEvent: func(_ context.Context, e *webhook.Event) error {
+			others = append(others, e.Type)
+			return nil
+		},
+		OnError: func(_ *http.Request, err error) { errs = append(errs, err) },
+	}
+	sign := func(payload string) string { return webhook.Sign("secret", []byte(payload), now) }
+
+	rec := deliver(h, backupEvent, sign(backupEvent))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	require.Len(t, backups, 1)
+	assert.Equal(t, "bk_7", backups[0].BackupID)
+
+	assert.Equal(t, http.StatusUnauthorized, deliver(h, backupEvent, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, deliver(h, backupEvent, webhook.Sign("wrong", []byte(backupEvent), now)).Code)
+	assert.Len(t, backups, 1)
+
+	schema := `{"id": "evt_4", "type": "schema.changed", "data": {"table": "users", "operation": "ALTER TABLE", "version": 3}}`
+	assert.Equal(t, http.StatusInternalServerError, deliver(h, schema, sign(schema)).Code, "a failed callback asks for redelivery")
+	failSchema = false
+	assert.Equal(t, http.StatusNoContent, deliver(h, schema, sign(schema)).Code)
+
+	unknown := `{"id": "evt_5", "type": "tenant.created", "data": {}}`
+	assert.Equal(t, http.StatusNoContent, deliver(h, unknown, sign(unknown)).Code)
+	assert.Equal(t, []string{"tenant.created"}, others)
+
+	malformed := `{"id": "evt_6", "type": "quota.warning", "data": {"used": "lots"}}`
+	assert.Equal(t, http.StatusBadRequest, deliver(h, malformed, sign(malformed)).Code)
+
+	get := httptest.NewRecorder()
+	h.ServeHTTP(get, httptest.NewRequest(http.MethodGet, "/hooks", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, get.Code)
+
+	assert.Len(t, errs, 4)
+}
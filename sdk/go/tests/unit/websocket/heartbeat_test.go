@@ -0,0 +1,114 @@
+package websocket_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	gws "github.com/gorilla/websocket"
+	"github.com/healthfees-org/workersql/sdk/go/internal/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// frameRecorder is a transaction server that records the frame types it
+// receives
+type frameRecorder struct {
+	mu     sync.Mutex
+	frames []websocket.FrameType
+}
+
+func (r *frameRecorder) count(t websocket.FrameType) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, f := range r.frames {
+		if f == t {
+			n++
+		}
+	}
+	return n
+}
+
+func newRecordingServer(t *testing.T) (*httptest.Server, *frameRecorder) {
+	rec := &frameRecorder{}
+	upgrader := gws.Upgrader{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		for {
+			var msg websocket.Message
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			rec.mu.Lock()
+			rec.frames = append(rec.frames, msg.Type)
+			rec.mu.Unlock()
+
+			reply := websocket.Message{Type: websocket.FrameResponse, ID: msg.ID}
+			switch msg.Type {
+			case websocket.FrameBegin:
+				reply.Data = map[string]interface{}{"transactionId": "tx_1"}
+			case websocket.FramePing:
+				reply.Type = websocket.FramePong
+			}
+			if err := conn.WriteJSON(reply); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, rec
+}
+
+func TestHeartbeatPingsIdleTransaction(t *testing.T) {
+	ctx := context.Background()
+	srv, rec := newRecordingServer(t)
+
+	client := websocket.NewTransactionClient(srv.URL, "")
+	client.SetHeartbeat(websocket.HeartbeatOptions{Interval: 10 * time.Millisecond})
+	defer client.Close()
+
+	require.NoError(t, client.Connect(ctx))
+	require.NoError(t, client.Begin(ctx))
+
+	assert.Eventually(t, func() bool { return rec.count(websocket.FramePing) >= 2 }, time.Second, 5*time.Millisecond)
+
+	require.NoError(t, client.Commit(ctx))
+	pings := rec.count(websocket.FramePing)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, pings, rec.count(websocket.FramePing), "no pings after commit")
+}
+
+func TestMaxTransactionDurationForcesRollback(t *testing.T) {
+	ctx := context.Background()
+	srv, rec := newRecordingServer(t)
+
+	client := websocket.NewTransactionClient(srv.URL, "")
+	client.SetHeartbeat(websocket.HeartbeatOptions{MaxDuration: 20 * time.Millisecond})
+	defer client.Close()
+
+	require.NoError(t, client.Connect(ctx))
+	require.NoError(t, client.Begin(ctx))
+
+	assert.Eventually(t, func() bool {
+		_, err := client.Query(ctx, "SELECT 1", nil)
+		return errors.Is(err, websocket.ErrTransactionExpired)
+	}, time.Second, 5*time.Millisecond)
+
+	assert.Equal(t, 1, rec.count(websocket.FrameRollback))
+	assert.ErrorIs(t, client.Commit(ctx), websocket.ErrTransactionExpired)
+	assert.NoError(t, client.Rollback(ctx))
+
+	require.NoError(t, client.Begin(ctx), "session is reusable after expiry")
+}
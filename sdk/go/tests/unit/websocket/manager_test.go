@@ -0,0 +1,293 @@
+package websocket_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	gws "github.com/gorilla/websocket"
+	"github.com/healthfees-org/workersql/sdk/go/internal/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newServer starts a WebSocket endpoint that acknowledges every frame and
+// counts accepted connections.
+func newServer(t *testing.T) (*httptest.Server, *int32) {
+	var dials int32
+	upgrader := gws.Upgrader{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		atomic.AddInt32(&dials, 1)
+		defer conn.Close()
+
+		for {
+			var msg websocket.Message
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			reply := websocket.Message{Type: "response", ID: msg.ID}
+			if msg.Type == "begin" {
+				reply.Data = map[string]interface{}{"transactionId": "tx_" + msg.ID}
+			} else {
+				reply.Data = map[string]interface{}{"success": true}
+			}
+			if err := conn.WriteJSON(reply); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &dials
+}
+
+func runTransaction(t *testing.T, m *websocket.Manager) {
+	ctx := context.Background()
+
+	client, err := m.Acquire(ctx)
+	require.NoError(t, err)
+	require.NoError(t, client.Begin(ctx))
+	require.NoError(t, client.Commit(ctx))
+	m.Release(client)
+}
+
+func TestManagerReusesIdleSession(t *testing.T) {
+	srv, dials := newServer(t)
+	m := websocket.NewManager(srv.URL, "", websocket.ManagerOptions{IdleTimeout: time.Minute})
+	defer m.Close()
+
+	runTransaction(t, m)
+	runTransaction(t, m)
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(dials))
+	assert.Equal(t, 1, m.IdleCount())
+}
+
+func TestManagerTearsDownAfterInactivity(t *testing.T) {
+	srv, dials := newServer(t)
+	m := websocket.NewManager(srv.URL, "", websocket.ManagerOptions{IdleTimeout: 20 * time.Millisecond})
+	defer m.Close()
+
+	runTransaction(t, m)
+	assert.Eventually(t, func() bool { return m.IdleCount() == 0 }, time.Second, 5*time.Millisecond)
+
+	runTransaction(t, m)
+	assert.Equal(t, int32(2), atomic.LoadInt32(dials))
+}
+
+func TestManagerWithoutIdleTimeoutClosesSessions(t *testing.T) {
+	srv, dials := newServer(t)
+	m := websocket.NewManager(srv.URL, "", websocket.ManagerOptions{IdleTimeout: -1})
+	defer m.Close()
+
+	runTransaction(t, m)
+	assert.Equal(t, 0, m.IdleCount())
+
+	runTransaction(t, m)
+	assert.Equal(t, int32(2), atomic.LoadInt32(dials))
+}
+
+func TestConnReconnectsAfterClose(t *testing.T) {
+	srv, dials := newServer(t)
+	client := websocket.NewTransactionClient(srv.URL, "")
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, client.Connect(ctx))
+		require.NoError(t, client.Begin(ctx))
+		require.NoError(t, client.Commit(ctx), "responses are read after reconnecting")
+		require.NoError(t, client.Close())
+	}
+	assert.NotPanics(t, func() { _ = client.Close() }, "closing a closed connection again")
+	assert.Equal(t, int32(2), atomic.LoadInt32(dials))
+}
+
+// newRepeatingServer starts a WebSocket endpoint that acknowledges each
+// frame as many times as repeat returns for it, never when it returns 0
+func newRepeatingServer(t *testing.T, repeat func(frame websocket.Message) int) *httptest.Server {
+	upgrader := gws.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		for {
+			var msg websocket.Message
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			reply := websocket.Message{Type: websocket.FrameResponse, ID: msg.ID, Data: map[string]interface{}{"success": true}}
+			if msg.Type == websocket.FrameBegin {
+				reply.Data = map[string]interface{}{"transactionId": "tx_" + msg.ID}
+			}
+			for i := 0; i < repeat(msg); i++ {
+				if err := conn.WriteJSON(reply); err != nil {
+					return
+				}
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestConnCloseFailsPendingRequests(t *testing.T) {
+	srv := newRepeatingServer(t, func(websocket.Message) int { return 0 })
+	client := websocket.NewTransactionClient(srv.URL, "")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, client.Connect(ctx))
+
+	time.AfterFunc(20*time.Millisecond, func() { _ = client.Close() })
+	start := time.Now()
+	err := client.Begin(ctx)
+	assert.ErrorIs(t, err, websocket.ErrConnectionClosed)
+	assert.Less(t, time.Since(start), time.Second, "the request fails when the connection closes, not at its timeout")
+}
+
+func TestConnSkipsDuplicateResponses(t *testing.T) {
+	srv := newRepeatingServer(t, func(frame websocket.Message) int {
+		if frame.Type == websocket.FrameBegin {
+			return 3
+		}
+		return 1
+	})
+	client := websocket.NewTransactionClient(srv.URL, "")
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	require.NoError(t, client.Connect(ctx))
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, client.Begin(ctx))
+		require.NoError(t, client.Commit(ctx), "responses are still read after duplicates")
+	}
+}
+
+// newSlowServer starts a WebSocket endpoint that answers query frames
+// concurrently after delay, recording the most queries of one transaction
+// and of the connection it saw in flight at once
+func newSlowServer(t *testing.T, delay time.Duration) (srv *httptest.Server, perTx, perConn *int32) {
+	perTx, perConn = new(int32), new(int32)
+	upgrader := gws.Upgrader{}
+
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var mu sync.Mutex
+		inFlight := map[string]int32{}
+		var total int32
+		raise := func(max *int32, n int32) {
+			if n > *max {
+				*max = n
+			}
+		}
+		reply := func(msg websocket.Message) {
+			mu.Lock()
+			defer mu.Unlock()
+			_ = conn.WriteJSON(msg)
+		}
+
+		for {
+			var msg websocket.Message
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			switch msg.Type {
+			case websocket.FrameBegin:
+				reply(websocket.Message{Type: websocket.FrameResponse, ID: msg.ID, Data: map[string]interface{}{"transactionId": "tx_" + msg.ID}})
+			case websocket.FrameQuery:
+				mu.Lock()
+				inFlight[msg.TransactionID]++
+				total++
+				raise(perTx, inFlight[msg.TransactionID])
+				raise(perConn, total)
+				mu.Unlock()
+				go func(msg websocket.Message) {
+					time.Sleep(delay)
+					mu.Lock()
+					inFlight[msg.TransactionID]--
+					total--
+					mu.Unlock()
+					reply(websocket.Message{Type: websocket.FrameResponse, ID: msg.ID, Data: map[string]interface{}{"success": true}})
+				}(msg)
+			default:
+				reply(websocket.Message{Type: websocket.FrameResponse, ID: msg.ID, Data: map[string]interface{}{"success": true}})
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, perTx, perConn
+}
+
+func TestManagerMultiplexesTransactions(t *testing.T) {
+	srv, dials := newServer(t)
+	m := websocket.NewManager(srv.URL, "", websocket.ManagerOptions{IdleTimeout: time.Minute, TransactionsPerConnection: 2})
+	defer m.Close()
+	ctx := context.Background()
+
+	a, err := m.Acquire(ctx)
+	require.NoError(t, err)
+	b, err := m.Acquire(ctx)
+	require.NoError(t, err)
+	require.NoError(t, a.Begin(ctx))
+	require.NoError(t, b.Begin(ctx))
+	assert.Equal(t, int32(1), atomic.LoadInt32(dials), "both transactions share a connection")
+
+	c, err := m.Acquire(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(dials), "a full connection makes another one")
+
+	require.NoError(t, a.Commit(ctx))
+	m.Release(a)
+	require.NoError(t, b.Rollback(ctx))
+	m.Release(b)
+	m.Release(c)
+	assert.Equal(t, 2, m.ConnectionCount())
+	assert.Equal(t, 2, m.IdleCount())
+
+	runTransaction(t, m)
+	assert.Equal(t, int32(2), atomic.LoadInt32(dials), "idle connections are reused")
+}
+
+func TestManagerKeepsTransactionFramesInOrder(t *testing.T) {
+	srv, perTx, perConn := newSlowServer(t, 20*time.Millisecond)
+	m := websocket.NewManager(srv.URL, "", websocket.ManagerOptions{IdleTimeout: time.Minute, TransactionsPerConnection: 4})
+	defer m.Close()
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		tx, err := m.Acquire(ctx)
+		require.NoError(t, err)
+		require.NoError(t, tx.Begin(ctx))
+		for j := 0; j < 3; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := tx.Query(ctx, "SELECT 1", nil)
+				assert.NoError(t, err)
+			}()
+		}
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(perTx), "a transaction has one frame in flight at a time")
+	assert.Equal(t, int32(2), atomic.LoadInt32(perConn), "transactions share the connection concurrently")
+}
@@ -0,0 +1,132 @@
+package websocket_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	gws "github.com/gorilla/websocket"
+	"github.com/healthfees-org/workersql/sdk/go/internal/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newVersionedServer(t *testing.T, subprotocols []string) *httptest.Server {
+	upgrader := gws.Upgrader{Subprotocols: subprotocols}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		for {
+			var msg websocket.Message
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			reply := websocket.Message{Type: websocket.FrameResponse, ID: msg.ID}
+			if msg.Type == websocket.FrameBegin {
+				reply.Data = map[string]interface{}{"transactionId": "tx_1"}
+			}
+			if err := conn.WriteJSON(reply); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestProtocolNegotiation(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("server selects v1", func(t *testing.T) {
+		srv := newVersionedServer(t, []string{"workersql.v1"})
+		client := websocket.NewTransactionClient(srv.URL, "")
+		defer client.Close()
+
+		require.NoError(t, client.Connect(ctx))
+		assert.Equal(t, 1, client.ProtocolVersion())
+	})
+
+	t.Run("legacy server without subprotocol", func(t *testing.T) {
+		srv := newVersionedServer(t, nil)
+		client := websocket.NewTransactionClient(srv.URL, "")
+		defer client.Close()
+
+		require.NoError(t, client.Connect(ctx))
+		assert.Equal(t, 1, client.ProtocolVersion())
+	})
+}
+
+func TestProtocolStateMachine(t *testing.T) {
+	ctx := context.Background()
+	srv := newVersionedServer(t, []string{"workersql.v1"})
+	client := websocket.NewTransactionClient(srv.URL, "")
+	defer client.Close()
+	require.NoError(t, client.Connect(ctx))
+
+	_, err := client.Query(ctx, "SELECT 1", nil)
+	assert.Error(t, err, "query before begin")
+
+	require.NoError(t, client.Begin(ctx))
+	assert.Error(t, client.Begin(ctx), "nested begin")
+
+	_, err = client.Query(ctx, "", nil)
+	var protoErr *websocket.ProtocolError
+	assert.ErrorAs(t, err, &protoErr, "query without sql")
+
+	require.NoError(t, client.Commit(ctx))
+	require.NoError(t, client.Begin(ctx), "begin again after commit")
+	require.NoError(t, client.Rollback(ctx))
+}
+
+func TestMessageValidate(t *testing.T) {
+	testCases := []struct {
+		name  string
+		msg   websocket.Message
+		valid bool
+	}{
+		{"begin", websocket.Message{Type: websocket.FrameBegin, ID: "1"}, true},
+		{"query", websocket.Message{Type: websocket.FrameQuery, ID: "1", SQL: "SELECT 1", TransactionID: "tx"}, true},
+		{"query without transaction", websocket.Message{Type: websocket.FrameQuery, ID: "1", SQL: "SELECT 1"}, false},
+		{"pipeline", websocket.Message{Type: websocket.FramePipeline, ID: "1", TransactionID: "tx", Statements: []websocket.Statement{{SQL: "SELECT 1"}}}, true},
+		{"empty pipeline", websocket.Message{Type: websocket.FramePipeline, ID: "1", TransactionID: "tx"}, false},
+		{"pipeline statement without sql", websocket.Message{Type: websocket.FramePipeline, ID: "1", TransactionID: "tx", Statements: []websocket.Statement{{}}}, false},
+		{"commit without transaction", websocket.Message{Type: websocket.FrameCommit, ID: "1"}, false},
+		{"missing id", websocket.Message{Type: websocket.FrameBegin}, false},
+		{"server frame", websocket.Message{Type: websocket.FrameResponse, ID: "1"}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.msg.Validate(websocket.ProtocolVersion)
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestServerErrorClasses(t *testing.T) {
+	deadlock := fmt.Errorf("commit: %w", &websocket.ServerError{Code: "ER_LOCK_DEADLOCK", Message: "deadlock"})
+	assert.ErrorIs(t, deadlock, websocket.ErrDeadlock)
+	assert.NotErrorIs(t, deadlock, websocket.ErrConflict)
+
+	conflict := &websocket.ServerError{Code: "SERIALIZATION_FAILURE", Message: "retry"}
+	assert.ErrorIs(t, conflict, websocket.ErrConflict)
+
+	unique := &websocket.ServerError{Code: "CONFLICT_UNIQUE", Message: "duplicate"}
+	assert.NotErrorIs(t, unique, websocket.ErrConflict)
+
+	nowait := &websocket.ServerError{Code: "ER_LOCK_NOWAIT", Message: "locked"}
+	assert.ErrorIs(t, nowait, websocket.ErrLockNotAvailable)
+	assert.NotErrorIs(t, deadlock, websocket.ErrLockNotAvailable)
+}
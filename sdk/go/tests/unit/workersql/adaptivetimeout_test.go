@@ -0,0 +1,125 @@
+package workersql_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+)
+
+// delayServer answers after the delay set for the table a statement
+// mentions
+type delayServer struct {
+	mu     sync.Mutex
+	delays map[string]time.Duration
+}
+
+func (s *delayServer) set(table string, delay time.Duration) {
+	s.mu.Lock()
+	s.delays[table] = delay
+	s.mu.Unlock()
+}
+
+func (s *delayServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req map[string]interface{}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	sql, _ := req["sql"].(string)
+	s.mu.Lock()
+	var delay time.Duration
+	for table, d := range s.delays {
+		if strings.Contains(sql, table) {
+			delay = d
+		}
+	}
+	s.mu.Unlock()
+	select {
+	case <-time.After(delay):
+	case <-r.Context().Done():
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": []map[string]interface{}{}})
+}
+
+func newAdaptiveTimeoutClient(t *testing.T) (*workersql.Client, *delayServer) {
+	t.Helper()
+	s := &delayServer{delays: make(map[string]time.Duration)}
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	client, err := workersql.NewClient(workersql.Config{
+		APIEndpoint:   server.URL,
+		Timeout:       2 * time.Second,
+		RetryAttempts: 1,
+		AdaptiveTimeouts: &workersql.AdaptiveTimeoutConfig{
+			MinTimeout: 50 * time.Millisecond,
+		},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+	return client, s
+}
+
+func TestAdaptiveTimeoutPerFingerprint(t *testing.T) {
+	client, server := newAdaptiveTimeoutClient(t)
+	ctx := context.Background()
+	server.set("reports", 40*time.Millisecond)
+
+	for i := 0; i < 20; i++ {
+		_, err := client.Query(ctx, "SELECT * FROM users WHERE id = ?", i)
+		require.NoError(t, err)
+		_, err = client.Query(ctx, "SELECT SUM(total) FROM reports WHERE day = ?", i)
+		require.NoError(t, err)
+	}
+
+	fast, learned := client.AdaptiveTimeout("SELECT * FROM users WHERE id = 7")
+	require.True(t, learned)
+	assert.Equal(t, 50*time.Millisecond, fast)
+	slow, learned := client.AdaptiveTimeout("SELECT SUM(total) FROM reports WHERE day = 7")
+	require.True(t, learned)
+	assert.GreaterOrEqual(t, slow, 120*time.Millisecond)
+	assert.Less(t, slow, 2*time.Second)
+	_, learned = client.AdaptiveTimeout("SELECT * FROM orders")
+	assert.False(t, learned)
+
+	// A stuck fast query fails at its own timeout, not Config.Timeout
+	server.set("users", time.Second)
+	start := time.Now()
+	_, err := client.Query(ctx, "SELECT * FROM users WHERE id = ?", 1)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+
+	// The slow fingerprint keeps its longer timeout
+	_, err = client.Query(ctx, "SELECT SUM(total) FROM reports WHERE day = ?", 1)
+	require.NoError(t, err)
+}
+
+func TestAdaptiveTimeoutOverride(t *testing.T) {
+	client, server := newAdaptiveTimeoutClient(t)
+	ctx := context.Background()
+	for i := 0; i < 20; i++ {
+		_, err := client.Query(ctx, "SELECT * FROM users WHERE id = ?", i)
+		require.NoError(t, err)
+	}
+
+	server.set("users", 150*time.Millisecond)
+	_, err := client.QueryWithOptions(ctx, "SELECT * FROM users WHERE id = ?", []interface{}{1},
+		workersql.QueryOptions{Timeout: time.Second})
+	require.NoError(t, err)
+}
+
+func TestAdaptiveTimeoutDisabled(t *testing.T) {
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: "http://localhost:1", Timeout: 5 * time.Second})
+	require.NoError(t, err)
+	defer client.Close()
+	timeout, learned := client.AdaptiveTimeout("SELECT 1")
+	assert.Equal(t, 5*time.Second, timeout)
+	assert.False(t, learned)
+}
@@ -0,0 +1,238 @@
+package workersql_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersqltest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// adminRequest is a request to the admin API of an adminGateway
+type adminRequest struct {
+	// Route is the method and path, e.g. "GET /admin/backups"
+	Route string
+	Body  map[string]interface{}
+	Auth  string
+}
+
+// adminRoute answers an admin request with a status, 200 if zero, and a
+// JSON body
+type adminRoute func(req adminRequest) (int, string)
+
+// adminGateway is a mock gateway whose admin API answers from its routes,
+// accepting only its token. A route ending in a slash also matches the
+// paths below it.
+type adminGateway struct {
+	*workersqltest.MockServer
+	token string
+
+	mu       sync.Mutex
+	routes   map[string]adminRoute
+	requests []adminRequest
+}
+
+func newAdminGateway(t *testing.T, token string) *adminGateway {
+	g := &adminGateway{MockServer: workersqltest.NewMockServer(t), token: token, routes: map[string]adminRoute{}}
+	g.Handle("/admin/", http.HandlerFunc(g.serveAdmin))
+	return g
+}
+
+// route answers requests to route with fn
+func (g *adminGateway) route(route string, fn adminRoute) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.routes[route] = fn
+}
+
+// client returns an admin client of the gateway configured by config
+func (g *adminGateway) client(t *testing.T, config workersql.Config) *workersql.AdminClient {
+	config.APIEndpoint = g.URL
+	client, err := workersql.NewClient(config)
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client.Admin()
+}
+
+// received returns the admin requests received so far, in order
+func (g *adminGateway) received() []adminRequest {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]adminRequest(nil), g.requests...)
+}
+
+func (g *adminGateway) serveAdmin(w http.ResponseWriter, r *http.Request) {
+	req := adminRequest{Route: r.Method + " " + r.URL.Path, Auth: r.Header.Get("Authorization")}
+	_ = json.NewDecoder(r.Body).Decode(&req.Body)
+	g.mu.Lock()
+	g.requests = append(g.requests, req)
+	var fn adminRoute
+	matched := -1
+	for route, f := range g.routes {
+		if (route == req.Route || strings.HasSuffix(route, "/") && strings.HasPrefix(req.Route, route)) && len(route) > matched {
+			fn, matched = f, len(route)
+		}
+	}
+	g.mu.Unlock()
+
+	switch {
+	case req.Auth == "":
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"success": false, "error": "missing admin token"}`)
+	case req.Auth != "Bearer "+g.token:
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"success": false, "error": "Forbidden"}`)
+	case fn == nil:
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"success": false, "error": "not found"}`)
+	default:
+		status, body := fn(req)
+		if status != 0 {
+			w.WriteHeader(status)
+		}
+		fmt.Fprint(w, body)
+	}
+}
+
+// newBackupGateway returns an admin gateway serving backups, restores and
+// their operations. Operations advance by half each time they are checked;
+// those of database "broken" fail.
+func newBackupGateway(t *testing.T) (*adminGateway, func() int) {
+	g := newAdminGateway(t, "admin-key")
+	var mu sync.Mutex
+	operations := map[string]*workersql.Operation{}
+	start := func(kind, backupID, database string) (int, string) {
+		mu.Lock()
+		defer mu.Unlock()
+		op := &workersql.Operation{ID: fmt.Sprintf("op-%d", len(operations)+1), Type: kind, Status: workersql.OperationPending, BackupID: backupID, Database: database}
+		operations[op.ID] = op
+		body, _ := json.Marshal(map[string]interface{}{"success": true, "operation": op})
+		return http.StatusAccepted, string(body)
+	}
+	g.route("POST /admin/backups", func(req adminRequest) (int, string) {
+		return start("backup", "bk-new", req.Body["database"].(string))
+	})
+	g.route("GET /admin/backups", func(adminRequest) (int, string) {
+		return 0, `{"success": true, "backups": [
+			{"id": "bk-2", "database": "tenant_a", "status": "complete", "createdAt": "2024-05-02T00:00:00Z", "sizeBytes": 2048, "tables": ["orders"]},
+			{"id": "bk-1", "database": "tenant_a", "status": "complete", "createdAt": "2024-05-01T00:00:00Z", "sizeBytes": 1024}]}`
+	})
+	g.route("POST /admin/backups/", func(req adminRequest) (int, string) {
+		database, _ := req.Body["database"].(string)
+		return start("restore", strings.Split(req.Route, "/")[3], database)
+	})
+	g.route("GET /admin/operations/", func(req adminRequest) (int, string) {
+		mu.Lock()
+		defer mu.Unlock()
+		op, ok := operations[strings.TrimPrefix(req.Route, "GET /admin/operations/")]
+		if !ok {
+			return http.StatusNotFound, `{"success": false, "error": "no such operation"}`
+		}
+		op.Progress += 0.5
+		op.Status = workersql.OperationRunning
+		if op.Progress >= 1 {
+			op.Status = workersql.OperationSucceeded
+			if op.Database == "broken" {
+				op.Status, op.Error = workersql.OperationFailed, "disk quota exceeded"
+			}
+		}
+		body, _ := json.Marshal(map[string]interface{}{"success": true, "operation": op})
+		return 0, string(body)
+	})
+	return g, func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(operations)
+	}
+}
+
+func newAdminClient(t *testing.T, apiKey string) (*workersql.AdminClient, *adminGateway, func() int) {
+	g, operations := newBackupGateway(t)
+	return g.client(t, workersql.Config{APIKey: apiKey}), g, operations
+}
+
+func TestAdminBackupAndRestore(t *testing.T) {
+	admin, server, _ := newAdminClient(t, "admin-key")
+	ctx := context.Background()
+
+	op, err := admin.TriggerBackup(ctx, "tenant_a")
+	require.NoError(t, err)
+	assert.Equal(t, workersql.OperationPending, op.Status)
+	assert.False(t, op.Done())
+
+	var progress []float64
+	op, err = admin.Wait(ctx, op.ID, workersql.WaitOptions{
+		PollInterval: time.Millisecond,
+		OnProgress:   func(op *workersql.Operation) { progress = append(progress, op.Progress) },
+	})
+	require.NoError(t, err)
+	assert.Equal(t, workersql.OperationSucceeded, op.Status)
+	assert.Equal(t, "bk-new", op.BackupID)
+	assert.Equal(t, []float64{0.5, 1}, progress)
+
+	backups, err := admin.ListBackups(ctx)
+	require.NoError(t, err)
+	require.Len(t, backups, 2)
+	assert.Equal(t, "bk-2", backups[0].ID)
+	assert.Equal(t, int64(2048), backups[0].SizeBytes)
+	assert.Equal(t, []string{"orders"}, backups[0].Tables)
+	assert.True(t, backups[1].CreatedAt.Equal(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)))
+
+	pointInTime := time.Date(2024, 5, 1, 12, 30, 0, 0, time.FixedZone("EST", -5*3600))
+	op, err = admin.Restore(ctx, "bk-1", workersql.RestoreOptions{PointInTime: pointInTime, Database: "tenant_a_copy"})
+	require.NoError(t, err)
+	assert.Equal(t, "restore", op.Type)
+	_, err = admin.Wait(ctx, op.ID, workersql.WaitOptions{PollInterval: time.Millisecond})
+	require.NoError(t, err)
+
+	assert.Contains(t, server.received(), adminRequest{
+		Route: "POST /admin/backups/bk-1/restore",
+		Body:  map[string]interface{}{"pointInTime": "2024-05-01T17:30:00Z", "database": "tenant_a_copy"},
+		Auth:  "Bearer admin-key",
+	})
+}
+
+func TestAdminFailures(t *testing.T) {
+	admin, _, _ := newAdminClient(t, "admin-key")
+	ctx := context.Background()
+
+	op, err := admin.TriggerBackup(ctx, "broken")
+	require.NoError(t, err)
+	op, err = admin.Wait(ctx, op.ID, workersql.WaitOptions{PollInterval: time.Millisecond})
+	assert.ErrorIs(t, err, workersql.ErrOperationFailed)
+	assert.ErrorContains(t, err, "disk quota exceeded")
+	require.NotNil(t, op)
+	assert.Equal(t, workersql.OperationFailed, op.Status)
+
+	_, err = admin.Restore(ctx, "bk-1", workersql.RestoreOptions{PointInTime: time.Now().Add(time.Hour)})
+	assert.ErrorContains(t, err, "in the future")
+
+	_, err = admin.Operation(ctx, "op-missing")
+	assert.ErrorContains(t, err, "no such operation")
+
+	// A check failing until the deadline ends the wait with the context
+	waitCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	_, err = admin.Wait(waitCtx, "op-missing", workersql.WaitOptions{PollInterval: time.Millisecond})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestAdminRequiresAdminKey(t *testing.T) {
+	admin, _, operations := newAdminClient(t, "reader-key")
+
+	_, err := admin.TriggerBackup(context.Background(), "tenant_a")
+	assert.ErrorIs(t, err, workersql.ErrForbidden)
+	_, err = admin.ListBackups(context.Background())
+	assert.ErrorIs(t, err, workersql.ErrForbidden)
+	_, err = admin.Wait(context.Background(), "op-1", workersql.WaitOptions{PollInterval: time.Millisecond})
+	assert.ErrorIs(t, err, workersql.ErrForbidden)
+	assert.Zero(t, operations())
+}
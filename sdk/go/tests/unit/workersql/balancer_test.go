@@ -0,0 +1,157 @@
+package workersql_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// balancedServer counts the queries and health checks it serves, answering
+// 503 to both while down is set
+type balancedServer struct {
+	delay    time.Duration
+	down     int32
+	queries  int32
+	checks   int32
+	endpoint string
+}
+
+func (s *balancedServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/health" {
+		atomic.AddInt32(&s.checks, 1)
+	} else {
+		atomic.AddInt32(&s.queries, 1)
+	}
+	if atomic.LoadInt32(&s.down) == 1 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(`{"code": "UNAVAILABLE", "message": "down"}`))
+		return
+	}
+	time.Sleep(s.delay)
+	_, _ = w.Write([]byte(`{"success": true, "data": [], "status": "healthy"}`))
+}
+
+func newBalancedClient(t *testing.T, lb *workersql.LoadBalancerConfig, servers ...*balancedServer) *workersql.Client {
+	var endpoints []string
+	for _, server := range servers {
+		srv := httptest.NewServer(server)
+		t.Cleanup(srv.Close)
+		server.endpoint = srv.URL
+		endpoints = append(endpoints, srv.URL)
+	}
+	client, err := workersql.NewClient(workersql.Config{Endpoints: endpoints, RetryAttempts: 1, LoadBalancer: lb})
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestLoadBalancerRoundRobin(t *testing.T) {
+	servers := []*balancedServer{{}, {}, {}}
+	client := newBalancedClient(t, nil, servers...)
+
+	for i := 0; i < 9; i++ {
+		_, err := client.Query(context.Background(), "SELECT 1")
+		require.NoError(t, err)
+	}
+	for _, server := range servers {
+		assert.EqualValues(t, 3, atomic.LoadInt32(&server.queries))
+	}
+}
+
+func TestLoadBalancerFailsOverAndEjects(t *testing.T) {
+	servers := []*balancedServer{{down: 1}, {}}
+	client := newBalancedClient(t, &workersql.LoadBalancerConfig{Cooldown: 50 * time.Millisecond}, servers...)
+	ctx := context.Background()
+
+	for i := 0; i < 4; i++ {
+		_, err := client.Query(ctx, "SELECT 1")
+		require.NoError(t, err, "an unavailable endpoint fails over to the next")
+	}
+	assert.EqualValues(t, 1, atomic.LoadInt32(&servers[0].queries), "the failing endpoint is ejected")
+	assert.EqualValues(t, 4, atomic.LoadInt32(&servers[1].queries))
+	status := client.Endpoints()
+	assert.False(t, status[0].Healthy)
+	assert.True(t, status[1].Healthy)
+
+	atomic.StoreInt32(&servers[0].down, 0)
+	time.Sleep(60 * time.Millisecond)
+	for i := 0; i < 4; i++ {
+		_, err := client.Query(ctx, "SELECT 1")
+		require.NoError(t, err)
+	}
+	assert.Greater(t, atomic.LoadInt32(&servers[0].queries), int32(1), "the endpoint is reintroduced after its cooldown")
+	assert.True(t, client.Endpoints()[0].Healthy)
+}
+
+func TestLoadBalancerLowestLatency(t *testing.T) {
+	servers := []*balancedServer{{delay: 20 * time.Millisecond}, {}}
+	client := newBalancedClient(t, &workersql.LoadBalancerConfig{Strategy: workersql.LowestLatency()}, servers...)
+
+	for i := 0; i < 10; i++ {
+		_, err := client.Query(context.Background(), "SELECT 1")
+		require.NoError(t, err)
+	}
+	assert.EqualValues(t, 1, atomic.LoadInt32(&servers[0].queries), "the slow endpoint is only measured")
+	assert.EqualValues(t, 9, atomic.LoadInt32(&servers[1].queries))
+	status := client.Endpoints()
+	assert.Greater(t, status[0].Latency, status[1].Latency)
+}
+
+func TestLoadBalancerWeighted(t *testing.T) {
+	servers := []*balancedServer{{}, {}}
+	var endpoints []string
+	for _, server := range servers {
+		srv := httptest.NewServer(server)
+		defer srv.Close()
+		endpoints = append(endpoints, srv.URL)
+	}
+	client, err := workersql.NewClient(workersql.Config{Endpoints: endpoints, RetryAttempts: 1, LoadBalancer: &workersql.LoadBalancerConfig{
+		Strategy: workersql.Weighted(),
+		Weights:  map[string]int{endpoints[0]: 9, endpoints[1]: 1},
+	}})
+	require.NoError(t, err)
+	defer client.Close()
+
+	for i := 0; i < 200; i++ {
+		_, err := client.Query(context.Background(), "SELECT 1")
+		require.NoError(t, err)
+	}
+	assert.Greater(t, atomic.LoadInt32(&servers[0].queries), 3*atomic.LoadInt32(&servers[1].queries))
+}
+
+func TestLoadBalancerHealthChecks(t *testing.T) {
+	servers := []*balancedServer{{}, {}}
+	client := newBalancedClient(t, &workersql.LoadBalancerConfig{
+		HealthCheckInterval: 10 * time.Millisecond,
+		Cooldown:            30 * time.Millisecond,
+	}, servers...)
+
+	atomic.StoreInt32(&servers[1].down, 1)
+	require.Eventually(t, func() bool { return !client.Endpoints()[1].Healthy }, time.Second, 5*time.Millisecond,
+		"a failing health check ejects the endpoint without any query")
+	assert.Zero(t, atomic.LoadInt32(&servers[1].queries))
+
+	atomic.StoreInt32(&servers[1].down, 0)
+	require.Eventually(t, func() bool { return client.Endpoints()[1].Healthy }, time.Second, 5*time.Millisecond,
+		"a passing health check after the cooldown reintroduces it")
+}
+
+func TestMultiHostDSN(t *testing.T) {
+	client, err := workersql.NewClient("workersql://user@db-1.example.com,db-2.example.com:8787/app?loadBalancer=lowestLatency")
+	require.NoError(t, err)
+	defer client.Close()
+
+	var urls []string
+	for _, e := range client.Endpoints() {
+		urls = append(urls, e.URL)
+	}
+	assert.Equal(t, "https://db-1.example.com/v1,https://db-2.example.com:8787/v1", strings.Join(urls, ","))
+}
@@ -0,0 +1,148 @@
+package workersql_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type unregisteredEnum int
+
+func newBatchClient(t *testing.T, received *map[string]interface{}) *workersql.Client {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/batch", r.URL.Path)
+		_ = json.NewDecoder(r.Body).Decode(received)
+		_, _ = w.Write([]byte(`{"success": true, "results": [{"success": true, "data": [{"n": 1}]}, {"success": true, "affectedRows": 2}]}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL, RetryAttempts: 1})
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestBatchQuery(t *testing.T) {
+	var received map[string]interface{}
+	client := newBatchClient(t, &received)
+
+	resp, err := client.BatchQuery(context.Background(), []workersql.BatchStatement{
+		{SQL: "SELECT * FROM users WHERE id IN (?)", Params: []interface{}{[]int{1, 2}}},
+		{SQL: "DELETE FROM sessions"},
+	}, workersql.BatchOptions{})
+	require.NoError(t, err)
+	require.Len(t, resp.Results, 2)
+	assert.Equal(t, int64(2), resp.Results[1].AffectedRows)
+
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"sql": "SELECT * FROM users WHERE id IN (?, ?)", "params": []interface{}{float64(1), float64(2)}},
+		map[string]interface{}{"sql": "DELETE FROM sessions"},
+	}, received["queries"])
+	assert.NotContains(t, received, "transaction")
+	assert.NotContains(t, received, "stopOnError")
+}
+
+func TestBatchQueryOptions(t *testing.T) {
+	var received map[string]interface{}
+	client := newBatchClient(t, &received)
+
+	_, err := client.BatchQuery(context.Background(), []workersql.BatchStatement{
+		{SQL: "UPDATE accounts SET balance = balance - 1 WHERE id = 1"},
+		{SQL: "UPDATE accounts SET balance = balance + 1 WHERE id = 2"},
+	}, workersql.BatchOptions{Atomic: true, StopOnError: true})
+	require.NoError(t, err)
+
+	assert.Equal(t, true, received["transaction"])
+	assert.Equal(t, true, received["stopOnError"])
+}
+
+func TestBatchQueryParamError(t *testing.T) {
+	client := newBatchClient(t, new(map[string]interface{}))
+
+	_, err := client.BatchQuery(context.Background(), []workersql.BatchStatement{
+		{SQL: "SELECT 1"},
+		{SQL: "SELECT * FROM users WHERE tags = ?", Params: []interface{}{workersql.Set[unregisteredEnum]{1}}},
+	}, workersql.BatchOptions{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "statement 1")
+}
+
+func TestBatchExecsCombinesCalls(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		if r.URL.Path == "/query" {
+			_, _ = w.Write([]byte(`{"success": true, "affectedRows": 1}`))
+			return
+		}
+		var batch struct {
+			Queries []workersql.BatchStatement `json:"queries"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&batch))
+		results := make([]map[string]interface{}, len(batch.Queries))
+		for i, q := range batch.Queries {
+			if q.Params[0] == "bad" {
+				results[i] = map[string]interface{}{"success": false, "error": map[string]interface{}{"code": "INVALID_QUERY", "message": "bad event"}}
+			} else {
+				results[i] = map[string]interface{}{"success": true, "affectedRows": 1, "lastInsertId": i + 1}
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "results": results})
+	}))
+	t.Cleanup(srv.Close)
+	client, err := workersql.NewClient(workersql.Config{
+		APIEndpoint:   srv.URL,
+		RetryAttempts: 1,
+		BatchExecs:    &workersql.WriteBatchingConfig{Window: 20 * time.Millisecond, MaxSize: 3},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	ctx := context.Background()
+
+	events := []string{"click", "bad", "view"}
+	responses := make([]*workersql.ExecResponse, len(events))
+	var wg sync.WaitGroup
+	for i, event := range events {
+		wg.Add(1)
+		go func(i int, event string) {
+			defer wg.Done()
+			resp, err := client.Exec(ctx, "INSERT INTO events (name) VALUES (?)", event)
+			require.NoError(t, err)
+			responses[i] = resp
+		}(i, event)
+	}
+	wg.Wait()
+
+	assert.Equal(t, []string{"/batch"}, paths, "a full batch is sent at once")
+	failed := 0
+	for _, resp := range responses {
+		if !resp.Success {
+			failed++
+			assert.Equal(t, "INVALID_QUERY", resp.Error.Code)
+		} else {
+			assert.EqualValues(t, 1, resp.AffectedRows)
+		}
+	}
+	assert.Equal(t, 1, failed, "a failing statement doesn't fail the others")
+	assert.EqualValues(t, 3, client.Stats().BatchedExecs)
+
+	resp, err := client.Exec(ctx, "INSERT INTO events (name) VALUES (?)", "lonely")
+	require.NoError(t, err)
+	assert.True(t, resp.Success)
+	assert.Equal(t, []string{"/batch", "/query"}, paths, "a call alone in its window is sent as is")
+
+	_, err = client.QueryWithOptions(ctx, "INSERT INTO events (name) VALUES (?)", []interface{}{"hinted"}, workersql.QueryOptions{Priority: workersql.PriorityHigh})
+	require.NoError(t, err)
+	assert.Len(t, paths, 3)
+}
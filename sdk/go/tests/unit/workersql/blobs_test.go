@@ -0,0 +1,131 @@
+package workersql_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blobServer is a gateway stub presigning URLs into an in-memory bucket it
+// also serves. /query stores the first param of INSERTs as the "payload"
+// column of a single row that SELECTs return.
+type blobServer struct {
+	mu      sync.Mutex
+	url     string
+	objects map[string][]byte
+	stored  interface{}
+	uploads int
+}
+
+func newBlobClient(t *testing.T, threshold int) (*workersql.Client, *blobServer) {
+	server := &blobServer{objects: map[string][]byte{}}
+	srv := httptest.NewServer(server)
+	t.Cleanup(srv.Close)
+	server.url = srv.URL
+
+	client, err := workersql.NewClient(workersql.Config{
+		APIEndpoint:   srv.URL,
+		RetryAttempts: 1,
+		ExternalBlobs: &workersql.BlobConfig{Threshold: threshold},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client, server
+}
+
+func (s *blobServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case r.URL.Path == "/blobs/upload-url":
+		key := "blob-" + string(rune('a'+len(s.objects)))
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "key": key, "url": s.url + "/r2/" + key})
+	case r.URL.Path == "/blobs/download-url":
+		var req struct{ Key string }
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "url": s.url + "/r2/" + req.Key})
+	case strings.HasPrefix(r.URL.Path, "/r2/") && r.Method == "PUT":
+		data, _ := io.ReadAll(r.Body)
+		s.objects[strings.TrimPrefix(r.URL.Path, "/r2/")] = data
+		s.uploads++
+	case strings.HasPrefix(r.URL.Path, "/r2/"):
+		data, ok := s.objects[strings.TrimPrefix(r.URL.Path, "/r2/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(data)
+	case r.URL.Path == "/query":
+		var req struct {
+			SQL    string        `json:"sql"`
+			Params []interface{} `json:"params"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if strings.HasPrefix(req.SQL, "INSERT") {
+			s.stored = req.Params[0]
+			_, _ = w.Write([]byte(`{"success": true, "affectedRows": 1}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"columns": []map[string]string{{"name": "payload", "type": "LONGTEXT"}},
+			"data":    []map[string]interface{}{{"payload": s.stored}},
+		})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestExternalBlobsRoundTrip(t *testing.T) {
+	client, server := newBlobClient(t, 16)
+	ctx := context.Background()
+	content := bytes.Repeat([]byte("large binary content "), 10)
+
+	_, err := client.Exec(ctx, "INSERT INTO files (payload) VALUES (?)", content)
+	require.NoError(t, err)
+	assert.Equal(t, 1, server.uploads)
+
+	ref, ok := workersql.ParseBlobRef(server.stored)
+	require.True(t, ok, "the row stores a reference, got %v", server.stored)
+	assert.EqualValues(t, len(content), ref.Size)
+
+	row, err := client.QueryRow(ctx, "SELECT payload FROM files")
+	require.NoError(t, err)
+	assert.Equal(t, content, row["payload"])
+}
+
+func TestExternalBlobsKeepsSmallParamsInline(t *testing.T) {
+	client, server := newBlobClient(t, 1024)
+
+	_, err := client.Exec(context.Background(), "INSERT INTO files (payload) VALUES (?)", []byte("small"))
+	require.NoError(t, err)
+	assert.Equal(t, 0, server.uploads)
+	_, isRef := workersql.ParseBlobRef(server.stored)
+	assert.False(t, isRef)
+}
+
+func TestResolveBlobDetectsCorruption(t *testing.T) {
+	client, server := newBlobClient(t, 16)
+	ctx := context.Background()
+
+	ref, err := client.UploadBlob(ctx, []byte("original content"), "text/plain")
+	require.NoError(t, err)
+	server.mu.Lock()
+	server.objects[ref.Key] = []byte("tampered content")
+	server.mu.Unlock()
+
+	_, err = client.ResolveBlob(ctx, *ref)
+	assert.True(t, errors.Is(err, workersql.ErrBlobCorrupt))
+}
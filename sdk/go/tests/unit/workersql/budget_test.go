@@ -0,0 +1,79 @@
+package workersql_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newBudgetClient(t *testing.T, server *countingServer) *workersql.Client {
+	srv := httptest.NewServer(server)
+	t.Cleanup(srv.Close)
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL, RetryAttempts: 1})
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestQueryBudgetLimitsQueries(t *testing.T) {
+	server := &countingServer{}
+	client := newBudgetClient(t, server)
+	ctx := workersql.WithQueryBudget(context.Background(), workersql.QueryBudget{MaxQueries: 3})
+
+	for i := 0; i < 2; i++ {
+		_, err := client.Query(ctx, "SELECT * FROM products WHERE id = ?", i)
+		require.NoError(t, err)
+	}
+	_, err := client.BatchQuery(ctx, []workersql.BatchStatement{{SQL: "SELECT 1"}, {SQL: "SELECT 2"}}, workersql.BatchOptions{})
+	var exceeded *workersql.BudgetExceededError
+	require.ErrorAs(t, err, &exceeded)
+	assert.ErrorIs(t, err, workersql.ErrBudgetExceeded)
+	assert.Equal(t, 2, exceeded.Usage.Queries)
+
+	_, err = client.Exec(ctx, "UPDATE products SET views = views + 1")
+	require.NoError(t, err, "the last query of the budget is allowed")
+	_, err = client.Query(ctx, "SELECT 1")
+	assert.ErrorIs(t, err, workersql.ErrBudgetExceeded)
+	assert.Equal(t, 3, server.requests())
+
+	usage, ok := workersql.BudgetUsageFrom(ctx)
+	require.True(t, ok)
+	assert.Equal(t, 3, usage.Queries)
+	_, err = client.Query(context.Background(), "SELECT 1")
+	assert.NoError(t, err, "other contexts aren't limited")
+}
+
+func TestQueryBudgetLimitsDBTime(t *testing.T) {
+	server := &countingServer{delay: 30 * time.Millisecond}
+	client := newBudgetClient(t, server)
+	ctx := workersql.WithQueryBudget(context.Background(), workersql.QueryBudget{MaxDBTime: 20 * time.Millisecond})
+
+	_, err := client.Query(ctx, "SELECT 1")
+	require.NoError(t, err)
+	_, err = client.Query(ctx, "SELECT 2")
+	assert.ErrorIs(t, err, workersql.ErrBudgetExceeded)
+
+	usage, _ := workersql.BudgetUsageFrom(ctx)
+	assert.GreaterOrEqual(t, usage.DBTime, 30*time.Millisecond)
+}
+
+func TestQueryBudgetWarns(t *testing.T) {
+	client := newBudgetClient(t, &countingServer{})
+	var warnings []workersql.BudgetUsage
+	ctx := workersql.WithQueryBudget(context.Background(), workersql.QueryBudget{
+		MaxQueries: 1,
+		OnExceeded: func(u workersql.BudgetUsage) { warnings = append(warnings, u) },
+	})
+
+	for i := 0; i < 3; i++ {
+		_, err := client.Query(ctx, "SELECT 1")
+		require.NoError(t, err)
+	}
+	require.Len(t, warnings, 1, "the warning is given once")
+	assert.Equal(t, 2, warnings[0].Queries)
+}
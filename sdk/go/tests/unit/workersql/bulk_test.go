@@ -0,0 +1,169 @@
+package workersql_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type bulkServer struct {
+	mu         sync.Mutex
+	statements []string
+	params     [][]interface{}
+	inFlight   int32
+	maxFlight  int32
+	failOn     string
+}
+
+func (s *bulkServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n := atomic.AddInt32(&s.inFlight, 1)
+	defer atomic.AddInt32(&s.inFlight, -1)
+	for {
+		max := atomic.LoadInt32(&s.maxFlight)
+		if n <= max || atomic.CompareAndSwapInt32(&s.maxFlight, max, n) {
+			break
+		}
+	}
+
+	var body struct {
+		SQL    string        `json:"sql"`
+		Params []interface{} `json:"params"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+
+	s.mu.Lock()
+	s.statements = append(s.statements, body.SQL)
+	s.params = append(s.params, body.Params)
+	s.mu.Unlock()
+
+	if s.failOn != "" {
+		for _, p := range body.Params {
+			if p == s.failOn {
+				_, _ = w.Write([]byte(`{"success": false, "error": {"code": "DUPLICATE_KEY", "message": "duplicate"}}`))
+				return
+			}
+		}
+	}
+
+	rows := strings.Count(body.SQL, "(?") + strings.Count(body.SQL, "(DEFAULT")
+	fmt.Fprintf(w, `{"success": true, "affectedRows": %d}`, rows)
+}
+
+func newBulkClient(t *testing.T, server *bulkServer) *workersql.Client {
+	srv := httptest.NewServer(server)
+	t.Cleanup(srv.Close)
+
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL, RetryAttempts: 1})
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func userRows(n int) []map[string]interface{} {
+	rows := make([]map[string]interface{}, n)
+	for i := range rows {
+		rows[i] = map[string]interface{}{"id": i, "name": fmt.Sprintf("user-%d", i)}
+	}
+	return rows
+}
+
+func TestBulkInsertChunks(t *testing.T) {
+	server := &bulkServer{}
+	client := newBulkClient(t, server)
+
+	result, err := client.BulkInsert(context.Background(), "users", userRows(25), workersql.BulkOptions{
+		ChunkSize:   10,
+		Parallelism: 2,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 25, result.Rows)
+	assert.Equal(t, 3, result.Chunks)
+	assert.Equal(t, int64(25), result.AffectedRows)
+	assert.Empty(t, result.Errors)
+	assert.LessOrEqual(t, atomic.LoadInt32(&server.maxFlight), int32(2))
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	require.Len(t, server.statements, 3)
+	for _, sql := range server.statements {
+		assert.True(t, strings.HasPrefix(sql, "INSERT INTO `users` (`id`, `name`) VALUES (?, ?)"), sql)
+	}
+}
+
+func TestBulkInsertPayloadLimit(t *testing.T) {
+	server := &bulkServer{}
+	client := newBulkClient(t, server)
+
+	rows := userRows(4)
+	for _, row := range rows {
+		row["bio"] = strings.Repeat("x", 100)
+	}
+
+	result, err := client.BulkInsert(context.Background(), "users", rows, workersql.BulkOptions{MaxPayloadBytes: 300})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Chunks)
+}
+
+func TestBulkInsertConflictsAndDefaults(t *testing.T) {
+	server := &bulkServer{}
+	client := newBulkClient(t, server)
+
+	rows := []map[string]interface{}{
+		{"id": 1, "name": "a"},
+		{"id": 2},
+	}
+
+	_, err := client.BulkInsert(context.Background(), "app.users", rows, workersql.BulkOptions{OnConflict: workersql.ConflictIgnore})
+	require.NoError(t, err)
+	_, err = client.BulkInsert(context.Background(), "users", rows, workersql.BulkOptions{
+		OnConflict:    workersql.ConflictUpdate,
+		UpdateColumns: []string{"name"},
+	})
+	require.NoError(t, err)
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	assert.Equal(t, "INSERT IGNORE INTO `app`.`users` (`id`, `name`) VALUES (?, ?), (?, DEFAULT)", server.statements[0])
+	assert.Equal(t, []interface{}{float64(1), "a", float64(2)}, server.params[0])
+	assert.Equal(t, "INSERT INTO `users` (`id`, `name`) VALUES (?, ?), (?, DEFAULT) ON DUPLICATE KEY UPDATE `name` = VALUES(`name`)", server.statements[1])
+}
+
+func TestBulkInsertChunkErrors(t *testing.T) {
+	server := &bulkServer{failOn: "user-12"}
+	client := newBulkClient(t, server)
+
+	result, err := client.BulkInsert(context.Background(), "users", userRows(30), workersql.BulkOptions{ChunkSize: 10})
+	require.Error(t, err)
+
+	var bulkErr *workersql.BulkInsertError
+	require.True(t, errors.As(err, &bulkErr))
+	require.Len(t, bulkErr.Errors, 1)
+	assert.Equal(t, 1, bulkErr.Errors[0].Chunk)
+	assert.Equal(t, 10, bulkErr.Errors[0].FirstRow)
+	assert.Equal(t, 10, bulkErr.Errors[0].Rows)
+	assert.Contains(t, bulkErr.Error(), "DUPLICATE_KEY")
+	assert.Equal(t, int64(20), result.AffectedRows)
+}
+
+func TestBulkInsertValidation(t *testing.T) {
+	client := newBulkClient(t, &bulkServer{})
+
+	_, err := client.BulkInsert(context.Background(), "", userRows(1), workersql.BulkOptions{})
+	assert.Error(t, err)
+
+	result, err := client.BulkInsert(context.Background(), "users", nil, workersql.BulkOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Chunks)
+}
@@ -0,0 +1,93 @@
+package workersql_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cacheServer records the path, body and Cache-Control header of the last
+// request and replies with reply
+type cacheServer struct {
+	reply        string
+	path         string
+	body         map[string]interface{}
+	cacheControl string
+}
+
+func (s *cacheServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.path = r.URL.Path
+	s.cacheControl = r.Header.Get("Cache-Control")
+	s.body = nil
+	_ = json.NewDecoder(r.Body).Decode(&s.body)
+	_, _ = w.Write([]byte(s.reply))
+}
+
+func newCacheClient(t *testing.T, reply string) (*workersql.Client, *cacheServer) {
+	server := &cacheServer{reply: reply}
+	srv := httptest.NewServer(server)
+	t.Cleanup(srv.Close)
+
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL, RetryAttempts: 1})
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client, server
+}
+
+func TestWithCacheHintAppliesToHelpers(t *testing.T) {
+	client, server := newCacheClient(t, `{"success": true, "data": [{"id": 1}]}`)
+
+	ctx := workersql.WithCacheHint(context.Background(), workersql.CacheBypass())
+	_, err := client.QueryRow(ctx, "SELECT * FROM users WHERE id = ?", 1)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"bypass": true}, server.body["cache"])
+	assert.Equal(t, "no-cache", server.cacheControl)
+
+	ctx = workersql.WithCacheHint(context.Background(), workersql.CacheTTL(5*time.Minute))
+	_, err = client.Query(ctx, "SELECT * FROM users")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"ttlMs": float64(300000)}, server.body["cache"])
+	assert.Equal(t, "max-age=300", server.cacheControl)
+
+	_, err = client.QueryWithOptions(ctx, "SELECT * FROM users", nil, workersql.QueryOptions{Cache: workersql.CacheBypass()})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"bypass": true}, server.body["cache"], "explicit options win over the context")
+	assert.Equal(t, "no-cache", server.cacheControl)
+
+	_, err = client.Query(context.Background(), "SELECT * FROM users")
+	require.NoError(t, err)
+	assert.NotContains(t, server.body, "cache")
+	assert.Empty(t, server.cacheControl)
+}
+
+func TestInvalidateCache(t *testing.T) {
+	client, server := newCacheClient(t, `{"success": true, "invalidated": 3}`)
+
+	n, err := client.InvalidateCache(context.Background(), workersql.InvalidationSpec{
+		Tables: []string{"`Users`", "orders"},
+		Keys:   []string{"q:abc"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, "/cache/invalidate", server.path)
+	assert.Equal(t, []interface{}{"users", "orders"}, server.body["tables"])
+	assert.Equal(t, []interface{}{"q:abc"}, server.body["keys"])
+
+	_, err = client.InvalidateCache(context.Background(), workersql.InvalidationSpec{})
+	assert.Error(t, err)
+}
+
+func TestInvalidateCacheReportsGatewayError(t *testing.T) {
+	client, _ := newCacheClient(t, `{"success": false, "error": {"code": "FORBIDDEN", "message": "cache admin required"}}`)
+
+	_, err := client.InvalidateCache(context.Background(), workersql.InvalidationSpec{Tables: []string{"users"}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "FORBIDDEN")
+}
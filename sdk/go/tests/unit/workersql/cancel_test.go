@@ -0,0 +1,153 @@
+package workersql_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersqltest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cancelServer is a mock gateway running queries until they are
+// cancelled through /query/cancel, answering SELECT 1 at once
+type cancelServer struct {
+	*workersqltest.MockServer
+
+	mu        sync.Mutex
+	running   map[string]chan struct{}
+	started   []string
+	cancelled []string
+}
+
+func newCancelServer(t *testing.T) *cancelServer {
+	s := &cancelServer{MockServer: workersqltest.NewMockServer(t), running: map[string]chan struct{}{}}
+	s.OnMatch(func(workersqltest.Call) bool { return true }).Respond(s.run)
+	s.On("SELECT 1").Return(map[string]interface{}{"1": 1})
+	s.Handle("/query/cancel", http.HandlerFunc(s.cancel))
+	t.Cleanup(func() {
+		// Release queries left running
+		s.mu.Lock()
+		for id, stop := range s.running {
+			close(stop)
+			delete(s.running, id)
+		}
+		s.mu.Unlock()
+	})
+	return s
+}
+
+func (s *cancelServer) run(call workersqltest.Call) workersqltest.Result {
+	id := call.Header.Get(workersql.QueryIDHeader)
+	stop := make(chan struct{})
+	s.mu.Lock()
+	s.running[id] = stop
+	s.started = append(s.started, id)
+	s.mu.Unlock()
+	<-stop
+	return workersqltest.Result{
+		Status: http.StatusBadRequest,
+		Error:  &workersql.ErrorResponse{Code: "QUERY_CANCELLED", Message: "query cancelled"},
+	}
+}
+
+func (s *cancelServer) cancel(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+	id, _ := body["queryId"].(string)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stop, ok := s.running[id]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"code": "QUERY_NOT_FOUND", "message": "no such query"}`))
+		return
+	}
+	delete(s.running, id)
+	close(stop)
+	s.cancelled = append(s.cancelled, id)
+	_, _ = w.Write([]byte(`{"success": true}`))
+}
+
+func (s *cancelServer) snapshot() (started, cancelled []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.started...), append([]string(nil), s.cancelled...)
+}
+
+func newCancelClient(t *testing.T, config workersql.Config) (*workersql.Client, *cancelServer) {
+	server := newCancelServer(t)
+	config.APIEndpoint = server.URL
+	config.RetryAttempts = 1
+	client, err := workersql.NewClient(config)
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client, server
+}
+
+func TestAbandonedQueryIsCancelled(t *testing.T) {
+	client, server := newCancelClient(t, workersql.Config{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := client.Query(ctx, "SELECT * FROM big_table")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	require.Eventually(t, func() bool {
+		_, cancelled := server.snapshot()
+		return len(cancelled) == 1
+	}, 2*time.Second, 5*time.Millisecond)
+	started, cancelled := server.snapshot()
+	assert.Equal(t, started, cancelled)
+	assert.Equal(t, int64(1), client.Stats().CancelledQueries)
+}
+
+func TestCancelQuery(t *testing.T) {
+	client, server := newCancelClient(t, workersql.Config{})
+	id := workersql.NewQueryID()
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := client.Query(workersql.WithQueryID(context.Background(), id), "SELECT * FROM big_table")
+		errs <- err
+	}()
+	require.Eventually(t, func() bool {
+		started, _ := server.snapshot()
+		return len(started) == 1
+	}, 2*time.Second, 5*time.Millisecond)
+
+	require.NoError(t, client.CancelQuery(context.Background(), id))
+	assert.ErrorContains(t, <-errs, "QUERY_CANCELLED")
+	assert.ErrorIs(t, client.CancelQuery(context.Background(), id), workersql.ErrQueryNotRunning)
+}
+
+func TestQueryResponseCarriesQueryID(t *testing.T) {
+	client, _ := newCancelClient(t, workersql.Config{})
+
+	resp, err := client.Query(workersql.WithQueryID(context.Background(), "q-1"), "SELECT 1")
+	require.NoError(t, err)
+	assert.Equal(t, "q-1", resp.QueryID)
+
+	resp, err = client.Query(context.Background(), "SELECT 1")
+	require.NoError(t, err)
+	assert.Len(t, resp.QueryID, 32)
+}
+
+func TestDisableQueryCancel(t *testing.T) {
+	client, server := newCancelClient(t, workersql.Config{DisableQueryCancel: true})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := client.Query(ctx, "SELECT * FROM big_table")
+	require.Error(t, err)
+
+	time.Sleep(50 * time.Millisecond)
+	started, cancelled := server.snapshot()
+	assert.Len(t, started, 1)
+	assert.Empty(t, cancelled)
+}
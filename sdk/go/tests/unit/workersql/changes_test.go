@@ -0,0 +1,252 @@
+package workersql_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersqltest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// changeLog is a shard's change log, read honouring the offset and limit
+// of each query
+type changeLog struct {
+	mu      sync.Mutex
+	changes []loggedChange
+}
+
+// loggedChange is a change to table, a DDL change when ddl is set
+type loggedChange struct {
+	table, ddl string
+}
+
+func (l *changeLog) write(table string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.changes = append(l.changes, loggedChange{table: table})
+}
+
+// alter logs the DDL statement sql changing table
+func (l *changeLog) alter(table, sql string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.changes = append(l.changes, loggedChange{table: table, ddl: sql})
+}
+
+func (l *changeLog) read(call workersqltest.Call) workersqltest.Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(call.Params) == 0 {
+		// SELECT MAX(id)
+		return workersqltest.Result{Rows: []map[string]interface{}{{"id": len(l.changes)}}}
+	}
+	var result workersqltest.Result
+	after, limit := int(call.Params[0].(float64)), int(call.Params[1].(float64))
+	for id := after + 1; id <= len(l.changes) && len(result.Rows) < limit; id++ {
+		change := l.changes[id-1]
+		kind, payload := "mutation", map[string]interface{}{
+			"tenantId": "acme", "table": change.table, "sql": "INSERT INTO " + change.table + " (id) VALUES (?)", "params": []int{id},
+		}
+		if change.ddl != "" {
+			kind, payload = "ddl", map[string]interface{}{"tenantId": "acme", "table": change.table, "sql": change.ddl}
+		}
+		encoded, _ := json.Marshal(payload)
+		result.Rows = append(result.Rows, map[string]interface{}{"id": id, "ts": 1700000000000 + id, "type": kind, "payload": string(encoded)})
+	}
+	return result
+}
+
+// changeLogServer is a mock shard serving its change log
+type changeLogServer struct {
+	*workersqltest.MockServer
+	*changeLog
+}
+
+func newChangeLogServer(t *testing.T) *changeLogServer {
+	server := &changeLogServer{MockServer: workersqltest.NewMockServer(t), changeLog: &changeLog{}}
+	server.OnMatch(func(workersqltest.Call) bool { return true }).Respond(server.read)
+	return server
+}
+
+func newChangeLogClient(t *testing.T, config workersql.Config) (*workersql.Client, *changeLogServer) {
+	server := newChangeLogServer(t)
+	config.APIEndpoint = server.URL
+	config.RetryAttempts = 1
+	client, err := workersql.NewClient(config)
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client, server
+}
+
+func TestReadChanges(t *testing.T) {
+	client, server := newChangeLogClient(t, workersql.Config{ResultCache: &workersql.ResultCacheConfig{TTL: time.Minute}})
+	server.write("orders")
+	ctx := context.Background()
+
+	events, err := client.ReadChanges(ctx, "", 0, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, workersql.ChangeEvent{
+		ID:       1,
+		Time:     time.UnixMilli(1700000000001).UTC(),
+		Type:     "mutation",
+		TenantID: "acme",
+		Table:    "orders",
+		SQL:      "INSERT INTO orders (id) VALUES (?)",
+		Params:   []interface{}{float64(1)},
+	}, events[0])
+
+	// Reads bypass the result cache
+	server.write("users")
+	events, err = client.ReadChanges(ctx, "", 0, 10)
+	require.NoError(t, err)
+	assert.Len(t, events, 2)
+}
+
+func TestWatchChanges(t *testing.T) {
+	client, server := newChangeLogClient(t, workersql.Config{})
+	for _, table := range []string{"orders", "users", "orders", "orders", "users"} {
+		server.write(table)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var (
+		mu      sync.Mutex
+		ids     []int64
+		offsets workersql.ChangeOffsets
+		failed  bool
+		errs    []error
+	)
+	done := make(chan error)
+	go func() {
+		done <- client.WatchChanges(ctx, workersql.ChangeFeedOptions{
+			Tables:       []string{"orders"},
+			After:        workersql.ChangeOffsets{"": 1},
+			BatchSize:    2,
+			PollInterval: 5 * time.Millisecond,
+			OnError:      func(_ string, err error) { mu.Lock(); errs = append(errs, err); mu.Unlock() },
+			OnCommit:     func(o workersql.ChangeOffsets) { mu.Lock(); offsets = o; mu.Unlock() },
+		}, func(_ context.Context, events []workersql.ChangeEvent) error {
+			mu.Lock()
+			defer mu.Unlock()
+			// The first batch fails once and is handled again
+			if !failed {
+				failed = true
+				return errors.New("handler down")
+			}
+			for _, event := range events {
+				ids = append(ids, event.ID)
+			}
+			return nil
+		})
+	}()
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return offsets[""] == 5
+	}, 2*time.Second, 5*time.Millisecond)
+	server.write("orders")
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return offsets[""] == 6
+	}, 2*time.Second, 5*time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	assert.Equal(t, []int64{3, 4, 6}, ids)
+	require.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "handler down")
+}
+
+func TestWatchChangesInvalidatesCachesOnDDL(t *testing.T) {
+	client, server := newChangeLogClient(t, workersql.Config{ResultCache: &workersql.ResultCacheConfig{TTL: time.Minute}})
+	server.On("SELECT * FROM orders").Return(map[string]interface{}{"id": 1})
+	reads := func() int {
+		n := 0
+		for _, call := range server.Calls() {
+			if call.SQL == "SELECT * FROM orders" {
+				n++
+			}
+		}
+		return n
+	}
+	var changes []workersql.SchemaChange
+	client.OnSchemaChange(func(change workersql.SchemaChange) { changes = append(changes, change) })
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for i := 0; i < 2; i++ {
+		_, err := client.Query(ctx, "SELECT * FROM orders")
+		require.NoError(t, err)
+	}
+	require.Equal(t, 1, reads())
+
+	// Another client alters the table, and the feed reports it
+	server.write("orders")
+	server.alter("Orders", "ALTER TABLE Orders ADD COLUMN note TEXT")
+	committed := make(chan workersql.ChangeOffsets, 1)
+	go func() {
+		_ = client.WatchChanges(ctx, workersql.ChangeFeedOptions{
+			Tables:       []string{"users"},
+			PollInterval: 5 * time.Millisecond,
+			OnCommit:     func(o workersql.ChangeOffsets) { committed <- o },
+		}, func(context.Context, []workersql.ChangeEvent) error { return nil })
+	}()
+	select {
+	case offsets := <-committed:
+		require.Equal(t, int64(2), offsets[""])
+	case <-time.After(2 * time.Second):
+		t.Fatal("changes weren't read")
+	}
+	cancel()
+
+	require.Len(t, changes, 1, "mutations aren't schema changes")
+	assert.Equal(t, "ALTER TABLE Orders ADD COLUMN note TEXT", changes[0].SQL)
+	assert.Equal(t, []string{"orders"}, changes[0].Tables)
+	_, err := client.Query(context.Background(), "SELECT * FROM orders")
+	require.NoError(t, err)
+	assert.Equal(t, 2, reads(), "the DDL event evicted the cached results")
+}
+
+func TestWatchChangesReadsEveryShard(t *testing.T) {
+	shardA, shardB := newChangeLogServer(t), newChangeLogServer(t)
+	shardA.write("orders")
+	shardB.write("users")
+	shardB.write("users")
+
+	client, err := workersql.NewClient(workersql.Config{
+		APIEndpoint: shardA.URL,
+		Shards:      map[string]string{"a": shardA.URL, "b": shardB.URL},
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var mu sync.Mutex
+	seen := map[string][]int64{}
+	go func() {
+		_ = client.WatchChanges(ctx, workersql.ChangeFeedOptions{PollInterval: 5 * time.Millisecond}, func(_ context.Context, events []workersql.ChangeEvent) error {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, event := range events {
+				seen[event.Shard] = append(seen[event.Shard], event.ID)
+			}
+			return nil
+		})
+	}()
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(seen["a"]) == 1 && len(seen["b"]) == 2
+	}, 2*time.Second, 5*time.Millisecond)
+}
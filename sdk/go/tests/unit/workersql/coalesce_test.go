@@ -0,0 +1,138 @@
+package workersql_test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCoalescingClient(t *testing.T, delay time.Duration) (*workersql.Client, *countingServer) {
+	server := &countingServer{delay: delay}
+	srv := httptest.NewServer(server)
+	t.Cleanup(srv.Close)
+
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL, RetryAttempts: 1, CoalesceQueries: true})
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client, server
+}
+
+func TestCoalesceQueriesSharesOneRequest(t *testing.T) {
+	client, server := newCoalescingClient(t, 100*time.Millisecond)
+
+	const callers = 50
+	var wg sync.WaitGroup
+	rows := make([]map[string]interface{}, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			row, err := client.QueryRow(context.Background(), "SELECT COUNT(*) AS n FROM orders WHERE status = ?", "open")
+			assert.NoError(t, err)
+			rows[i] = row
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, server.requests())
+	assert.EqualValues(t, callers-1, client.Stats().Coalesced)
+	for _, row := range rows {
+		assert.EqualValues(t, 1, row["n"])
+	}
+	rows[0]["n"] = "modified"
+	assert.EqualValues(t, 1, rows[1]["n"], "callers get their own rows")
+}
+
+func TestCoalesceQueriesKeepsDistinctQueriesApart(t *testing.T) {
+	client, server := newCoalescingClient(t, 50*time.Millisecond)
+
+	var wg sync.WaitGroup
+	for _, status := range []string{"open", "closed"} {
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func(status string) {
+				defer wg.Done()
+				_, err := client.Query(context.Background(), "SELECT COUNT(*) AS n FROM orders WHERE status = ?", status)
+				assert.NoError(t, err)
+			}(status)
+		}
+	}
+	wg.Wait()
+	assert.Equal(t, 2, server.requests())
+
+	for i := 0; i < 2; i++ {
+		_, err := client.Exec(context.Background(), "UPDATE orders SET status = ?", "closed")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 4, server.requests(), "writes are never coalesced")
+}
+
+func TestCoalesceQueriesCallerCancellation(t *testing.T) {
+	client, server := newCoalescingClient(t, 200*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := client.Query(ctx, "SELECT * FROM reports")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	// The shared request keeps running for callers that joined it
+	_, err = client.Query(context.Background(), "SELECT * FROM reports")
+	require.NoError(t, err)
+	assert.Equal(t, 1, server.requests())
+}
+
+func TestCoalesceWritesWithinWindow(t *testing.T) {
+	server := &countingServer{delay: 20 * time.Millisecond}
+	srv := httptest.NewServer(server)
+	t.Cleanup(srv.Close)
+	client, err := workersql.NewClient(workersql.Config{
+		APIEndpoint: srv.URL,
+		CoalesceWrites: &workersql.WriteCoalescingConfig{
+			Window:  100 * time.Millisecond,
+			Queries: []string{"INSERT INTO heartbeats (id, seen) VALUES (?, ?) ON DUPLICATE KEY UPDATE seen = VALUES(seen)"},
+		},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	ctx := context.Background()
+	heartbeat := "INSERT INTO heartbeats (id, seen) VALUES (?, ?) ON DUPLICATE KEY UPDATE seen = VALUES(seen)"
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.Exec(ctx, heartbeat, 1, "noon")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, server.requests(), "writes in flight share one request")
+
+	_, err = client.Exec(ctx, heartbeat, 1, "noon")
+	require.NoError(t, err)
+	assert.Equal(t, 1, server.requests(), "a write within the window shares the result")
+
+	_, err = client.Exec(ctx, heartbeat, 2, "noon")
+	require.NoError(t, err)
+	assert.Equal(t, 2, server.requests(), "other params are another write")
+
+	_, err = client.Exec(ctx, "UPDATE counters SET n = n + 1 WHERE id = ?", 1)
+	require.NoError(t, err)
+	_, err = client.Exec(ctx, "UPDATE counters SET n = n + 1 WHERE id = ?", 1)
+	require.NoError(t, err)
+	assert.Equal(t, 4, server.requests(), "unlisted writes are always sent")
+
+	time.Sleep(120 * time.Millisecond)
+	_, err = client.Exec(ctx, heartbeat, 1, "noon")
+	require.NoError(t, err)
+	assert.Equal(t, 5, server.requests(), "the window is over")
+	assert.EqualValues(t, 5, client.Stats().CoalescedWrites)
+}
@@ -0,0 +1,119 @@
+package workersql_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryDecodesTypedColumns(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{
+			"success": true,
+			"columns": [
+				{"name": "id", "type": "BIGINT(20)", "nullable": false},
+				{"name": "score", "type": "DOUBLE", "nullable": true},
+				{"name": "active", "type": "BOOLEAN", "nullable": false},
+				{"name": "created_at", "type": "DATETIME", "nullable": false},
+				{"name": "avatar", "type": "BLOB", "nullable": true},
+				{"name": "name", "type": "VARCHAR", "nullable": false, "precision": 255}
+			],
+			"data": [
+				{"id": 7, "score": 9.5, "active": 1, "created_at": "2025-10-14 12:30:00", "avatar": "AQI=", "name": "Ada"},
+				{"id": "8", "score": null, "active": false, "created_at": "2025-10-15", "avatar": null, "name": "Bob"}
+			],
+			"rowCount": 2
+		}`))
+	}))
+	defer srv.Close()
+
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL})
+	require.NoError(t, err)
+	defer client.Close()
+
+	result, err := client.Query(context.Background(), "SELECT * FROM users")
+	require.NoError(t, err)
+	require.Len(t, result.Columns, 6)
+	assert.Equal(t, 255, result.Columns[5].Precision)
+
+	first := result.Data[0]
+	assert.Equal(t, int64(7), first["id"])
+	assert.Equal(t, 9.5, first["score"])
+	assert.Equal(t, true, first["active"])
+	assert.Equal(t, "2025-10-14 12:30:00", first["created_at"])
+	assert.Equal(t, []byte{0x01, 0x02}, first["avatar"])
+	assert.Equal(t, "Ada", first["name"])
+
+	second := result.Data[1]
+	assert.Equal(t, int64(8), second["id"])
+	assert.Nil(t, second["score"])
+	assert.Equal(t, false, second["active"])
+	assert.Equal(t, "2025-10-15", second["created_at"])
+	assert.Nil(t, second["avatar"])
+}
+
+func TestQueryParseTime(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{
+			"success": true,
+			"columns": [
+				{"name": "created_at", "type": "DATETIME"},
+				{"name": "updated_at", "type": "TIMESTAMP"},
+				{"name": "deleted_at", "type": "DATETIME", "nullable": true}
+			],
+			"data": [
+				{"created_at": "2025-10-14 12:30:00.250", "updated_at": "2025-10-14T10:00:00Z", "deleted_at": "0000-00-00 00:00:00"}
+			]
+		}`))
+	}))
+	defer srv.Close()
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	client, err := workersql.NewClient(workersql.Config{
+		APIEndpoint: srv.URL,
+		ParseTime:   true,
+		Location:    berlin,
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	result, err := client.Query(context.Background(), "SELECT created_at, updated_at, deleted_at FROM users")
+	require.NoError(t, err)
+
+	row := result.Data[0]
+	created := row["created_at"].(time.Time)
+	assert.Equal(t, time.Date(2025, 10, 14, 12, 30, 0, 250000000, berlin), created)
+	assert.Equal(t, berlin, created.Location())
+
+	updated := row["updated_at"].(time.Time)
+	assert.True(t, updated.Equal(time.Date(2025, 10, 14, 10, 0, 0, 0, time.UTC)))
+	assert.Equal(t, berlin, updated.Location())
+
+	assert.True(t, row["deleted_at"].(time.Time).IsZero())
+}
+
+func TestParseTimeFromDSN(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"success":true,"columns":[{"name":"d","type":"DATE"}],"data":[{"d":"2025-01-02"}]}`))
+	}))
+	defer srv.Close()
+
+	client, err := workersql.NewClient("workersql://localhost/db?parseTime=true&loc=America%2FNew_York&apiEndpoint=" + srv.URL)
+	require.NoError(t, err)
+	defer client.Close()
+
+	result, err := client.Query(context.Background(), "SELECT d FROM t")
+	require.NoError(t, err)
+
+	d := result.Data[0]["d"].(time.Time)
+	assert.Equal(t, "America/New_York", d.Location().String())
+	assert.Equal(t, 2, d.Day())
+}
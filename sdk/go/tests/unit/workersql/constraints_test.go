@@ -0,0 +1,109 @@
+package workersql_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func registerShopConstraints(client *workersql.Client) {
+	client.Constraints().AddUnique("users", "email")
+	client.Constraints().AddForeignKey(workersql.ForeignKey{
+		Table: "orders", Columns: []string{"user_id"}, RefTable: "users", RefColumns: []string{"id"},
+	})
+}
+
+func TestCheckInsertUnique(t *testing.T) {
+	client, server := newMapperClient(t, map[string]string{
+		"SELECT 1 AS found FROM `users`": `{"success": true, "data": [{"found": 1}]}`,
+	})
+	registerShopConstraints(client)
+	ctx := context.Background()
+
+	_, err := client.InsertChecked(ctx, "users", map[string]interface{}{"email": "ada@example.com", "name": "Ada"})
+	var violation *workersql.ConstraintError
+	require.True(t, errors.As(err, &violation))
+	assert.True(t, errors.Is(err, workersql.ErrConstraintViolation))
+	assert.Equal(t, "unique", violation.Kind)
+	assert.Equal(t, []interface{}{"ada@example.com"}, violation.Values)
+
+	// NULL values are not compared, as with a database UNIQUE index
+	require.NoError(t, client.CheckInsert(ctx, "users", map[string]interface{}{"email": nil}))
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	require.Len(t, server.received, 1, "the insert is not attempted")
+	assert.Equal(t, "SELECT 1 AS found FROM `users` WHERE `email` = ? LIMIT 1", server.received[0].SQL)
+}
+
+func TestCheckInsertForeignKey(t *testing.T) {
+	client, server := newMapperClient(t, map[string]string{
+		"SELECT 1 AS found FROM `users`": `{"success": true, "data": []}`,
+	})
+	registerShopConstraints(client)
+	ctx := context.Background()
+
+	err := client.CheckInsert(ctx, "orders", map[string]interface{}{"user_id": 7, "total": 10})
+	var violation *workersql.ConstraintError
+	require.True(t, errors.As(err, &violation))
+	assert.Equal(t, "foreign key", violation.Kind)
+	assert.Equal(t, "users", violation.RefTable)
+
+	server.mu.Lock()
+	server.responses["SELECT 1 AS found FROM `users`"] = `{"success": true, "data": [{"found": 1}]}`
+	server.mu.Unlock()
+	_, err = client.InsertChecked(ctx, "orders", map[string]interface{}{"user_id": 7, "total": 10})
+	require.NoError(t, err)
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	assert.Equal(t, "INSERT INTO `orders` (`total`, `user_id`) VALUES (?, ?)", server.received[len(server.received)-1].SQL)
+}
+
+func TestValidateConstraints(t *testing.T) {
+	client, server := newMapperClient(t, map[string]string{
+		"SELECT `email`, COUNT(*)": `{"success": true, "data": [{"email": "dup@example.com", "duplicate_count": 3}]}`,
+		"SELECT DISTINCT":          `{"success": true, "data": [{"user_id": 7}]}`,
+		"SELECT `id` FROM `users`": `{"success": true, "data": []}`,
+	})
+	registerShopConstraints(client)
+
+	report, err := client.ValidateConstraints(context.Background(), workersql.IntegrityOptions{})
+	require.NoError(t, err)
+	assert.False(t, report.Valid())
+	require.Len(t, report.Duplicates, 1)
+	assert.Equal(t, int64(3), report.Duplicates[0].Count)
+	assert.Equal(t, []interface{}{"dup@example.com"}, report.Duplicates[0].Values)
+	require.Len(t, report.Integrity.Violations, 1)
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	assert.Equal(t, "SELECT `email`, COUNT(*) AS duplicate_count FROM `users` GROUP BY `email` HAVING COUNT(*) > 1 ORDER BY `email` LIMIT 1000", server.received[0].SQL)
+}
+
+func TestStartConstraintValidator(t *testing.T) {
+	client, _ := newMapperClient(t, map[string]string{
+		"SELECT": `{"success": true, "data": []}`,
+	})
+	client.Constraints().AddUnique("users", "email")
+
+	var runs int32
+	stop := client.StartConstraintValidator(context.Background(), 5*time.Millisecond, workersql.IntegrityOptions{},
+		func(report *workersql.ConstraintReport, err error) {
+			assert.NoError(t, err)
+			assert.True(t, report.Valid())
+			atomic.AddInt32(&runs, 1)
+		})
+
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&runs) >= 2 }, time.Second, time.Millisecond)
+	stop()
+	n := atomic.LoadInt32(&runs)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, n, atomic.LoadInt32(&runs), "no runs after stop")
+}
@@ -0,0 +1,201 @@
+package workersql_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFlakyServer fails the first failures write requests with status, then
+// succeeds. keys returns the idempotency keys of the requests so far.
+func newFlakyServer(t *testing.T, failures int32, status int) (srv *httptest.Server, keys func() []string) {
+	var mu sync.Mutex
+	var received []string
+	var seen int32
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		received = append(received, r.Header.Get(workersql.IdempotencyKeyHeader))
+		mu.Unlock()
+		if atomic.AddInt32(&seen, 1) <= failures {
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(`{"success": false}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"success": true, "rowsAffected": 1}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), received...)
+	}
+}
+
+func TestDeadLetterRetriesWritesInBackground(t *testing.T) {
+	srv, keys := newFlakyServer(t, 2, http.StatusServiceUnavailable)
+	letters := make(chan workersql.DeadLetter, 1)
+	client, err := workersql.NewClient(workersql.Config{
+		APIEndpoint:   srv.URL,
+		RetryAttempts: 1,
+		DeadLetter: &workersql.DeadLetterConfig{
+			Handler:       func(l workersql.DeadLetter) { letters <- l },
+			RetryAttempts: 3,
+			RetryInterval: 10 * time.Millisecond,
+		},
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	_, err = client.Exec(context.Background(), "INSERT INTO events (name) VALUES (?)", "click")
+	require.ErrorIs(t, err, workersql.ErrWriteDeferred)
+
+	require.Eventually(t, func() bool { return len(keys()) == 3 }, time.Second, 5*time.Millisecond)
+	sent := keys()
+	assert.Equal(t, sent[0], sent[2], "retries keep the idempotency key")
+	assert.NotEmpty(t, sent[0])
+	client.Close()
+	assert.Empty(t, letters, "a write that went through isn't dead-lettered")
+	assert.Zero(t, client.Stats().DeadLetters)
+}
+
+func TestDeadLetterHandlerGetsWritesThatKeepFailing(t *testing.T) {
+	srv, keys := newFlakyServer(t, 100, http.StatusBadGateway)
+	letters := make(chan workersql.DeadLetter, 1)
+	client, err := workersql.NewClient(workersql.Config{
+		APIEndpoint:   srv.URL,
+		RetryAttempts: 1,
+		DeadLetter: &workersql.DeadLetterConfig{
+			Handler:       func(l workersql.DeadLetter) { letters <- l },
+			RetryAttempts: 2,
+			RetryInterval: 5 * time.Millisecond,
+		},
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx := workersql.WithWritePriority(context.Background(), 7)
+	_, err = client.Exec(ctx, "INSERT INTO events (name) VALUES (?)", "click")
+	require.ErrorIs(t, err, workersql.ErrWriteDeferred)
+
+	select {
+	case l := <-letters:
+		assert.Equal(t, "INSERT INTO events (name) VALUES (?)", l.SQL)
+		assert.Equal(t, []interface{}{"click"}, l.Params)
+		assert.Equal(t, keys()[0], l.IdempotencyKey)
+		assert.Equal(t, 7, l.Priority)
+		assert.Equal(t, 2, l.Retries)
+		assert.Error(t, l.Err)
+	case <-time.After(time.Second):
+		t.Fatal("write wasn't dead-lettered")
+	}
+	assert.Equal(t, int64(1), client.Stats().DeadLetters)
+
+	_, err = client.Query(context.Background(), "SELECT 1")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, workersql.ErrWriteDeferred, "reads are never dead-lettered")
+}
+
+func TestDeadLetterQueueEvictsLowestPriority(t *testing.T) {
+	srv, _ := newFlakyServer(t, 100, http.StatusServiceUnavailable)
+	var mu sync.Mutex
+	var dead []string
+	client, err := workersql.NewClient(workersql.Config{
+		APIEndpoint:   srv.URL,
+		RetryAttempts: 1,
+		DeadLetter: &workersql.DeadLetterConfig{
+			Handler: func(l workersql.DeadLetter) {
+				mu.Lock()
+				dead = append(dead, l.Params[0].(string))
+				mu.Unlock()
+			},
+			RetryAttempts: 5,
+			RetryInterval: time.Hour,
+			QueueSize:     1,
+		},
+	})
+	require.NoError(t, err)
+
+	write := func(name string, priority int) {
+		ctx := workersql.WithWritePriority(context.Background(), priority)
+		_, err := client.Exec(ctx, "INSERT INTO events (name) VALUES (?)", name)
+		require.ErrorIs(t, err, workersql.ErrWriteDeferred)
+	}
+	write("metric", 1)
+	write("debug", 0)
+	write("audit", 5)
+	mu.Lock()
+	assert.Equal(t, []string{"debug", "metric"}, dead)
+	mu.Unlock()
+
+	// Writes still queued are handed over on close
+	require.NoError(t, client.Close())
+	assert.Equal(t, []string{"debug", "metric", "audit"}, dead)
+}
+
+func TestDeadLetterSkipsRejectedWrites(t *testing.T) {
+	srv, _ := newFlakyServer(t, 100, http.StatusBadRequest)
+	called := false
+	client, err := workersql.NewClient(workersql.Config{
+		APIEndpoint:   srv.URL,
+		RetryAttempts: 1,
+		DeadLetter:    &workersql.DeadLetterConfig{Handler: func(workersql.DeadLetter) { called = true }},
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	_, err = client.Exec(context.Background(), "INSERT INTO events (name) VALUES (?)", "click")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, workersql.ErrWriteDeferred)
+	assert.False(t, called)
+}
+
+func TestDeadLetterSkipsCancelledWrites(t *testing.T) {
+	var writes int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/query") {
+			return
+		}
+		atomic.AddInt32(&writes, 1)
+		_, _ = io.Copy(io.Discard, r.Body)
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	called := make(chan struct{}, 1)
+	client, err := workersql.NewClient(workersql.Config{
+		APIEndpoint:   srv.URL,
+		RetryAttempts: 1,
+		DeadLetter: &workersql.DeadLetterConfig{
+			Handler:       func(workersql.DeadLetter) { called <- struct{}{} },
+			RetryAttempts: 3,
+			RetryInterval: 5 * time.Millisecond,
+		},
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = client.Exec(ctx, "INSERT INTO events (name) VALUES (?)", "click")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, workersql.ErrWriteDeferred, "a write the caller gave up on isn't deferred")
+
+	time.Sleep(100 * time.Millisecond)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&writes), "the cancelled write isn't replayed")
+	client.Close()
+	assert.Empty(t, called)
+	assert.Zero(t, client.Stats().DeadLetters)
+}
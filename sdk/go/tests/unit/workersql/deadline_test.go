@@ -0,0 +1,97 @@
+package workersql_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersqltest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lastBudget returns the deadline header of the last statement server
+// received, -1 for none
+func lastBudget(server *workersqltest.MockServer) int {
+	calls := server.Calls()
+	budget, err := strconv.Atoi(calls[len(calls)-1].Header.Get(workersql.DeadlineHeader))
+	if err != nil {
+		return -1
+	}
+	return budget
+}
+
+func newDeadlineClient(t *testing.T, config workersql.Config) (*workersql.Client, *workersqltest.MockServer) {
+	server := workersqltest.NewMockServer(t)
+	config.APIEndpoint = server.URL
+	client, err := workersql.NewClient(config)
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client, server
+}
+
+func TestDeadlinePropagation(t *testing.T) {
+	client, server := newDeadlineClient(t, workersql.Config{})
+
+	_, err := client.Query(context.Background(), "SELECT 1")
+	require.NoError(t, err)
+	assert.Equal(t, 30000-25, lastBudget(server), "Config.Timeout, 30s by default, bounds requests")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_, err = client.Query(ctx, "SELECT 1")
+	require.NoError(t, err)
+	budget := lastBudget(server)
+	assert.LessOrEqual(t, budget, 2000-25, "the margin is taken off")
+	assert.Greater(t, budget, 1500)
+}
+
+func TestDeadlineBoundedByTimeout(t *testing.T) {
+	client, server := newDeadlineClient(t, workersql.Config{
+		Timeout:   time.Second,
+		Deadlines: &workersql.DeadlineConfig{Margin: 100 * time.Millisecond},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	_, err := client.Query(ctx, "SELECT 1")
+	require.NoError(t, err)
+	assert.Equal(t, 900, lastBudget(server))
+}
+
+func TestServerBudgetOverride(t *testing.T) {
+	client, server := newDeadlineClient(t, workersql.Config{})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	_, err := client.Query(workersql.WithServerBudget(ctx, 500*time.Millisecond), "SELECT 1")
+	require.NoError(t, err)
+	assert.Equal(t, 475, lastBudget(server))
+
+	// The override can't extend the context's deadline
+	short, cancelShort := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancelShort()
+	_, err = client.Query(workersql.WithServerBudget(short, time.Hour), "SELECT 1")
+	require.NoError(t, err)
+	assert.Less(t, lastBudget(server), 300)
+
+	_, err = client.Query(workersql.WithServerBudget(ctx, -1), "SELECT 1")
+	require.NoError(t, err)
+	assert.Equal(t, -1, lastBudget(server))
+
+	_, err = client.QueryWithOptions(ctx, "SELECT 1", nil, workersql.QueryOptions{ServerBudget: 200 * time.Millisecond})
+	require.NoError(t, err)
+	assert.Equal(t, 175, lastBudget(server))
+}
+
+func TestDeadlinesDisabled(t *testing.T) {
+	client, server := newDeadlineClient(t, workersql.Config{Deadlines: &workersql.DeadlineConfig{Disabled: true}})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	_, err := client.Query(ctx, "SELECT 1")
+	require.NoError(t, err)
+	assert.Equal(t, -1, lastBudget(server))
+}
@@ -0,0 +1,115 @@
+package workersql_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersqltest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newDebugClient(t *testing.T) *workersql.Client {
+	server := workersqltest.NewMockServer(t)
+	server.OnMatch(func(workersqltest.Call) bool { return true }).Return(map[string]interface{}{"n": 1})
+	server.On("SELECT sleep(1)").Respond(func(workersqltest.Call) workersqltest.Result {
+		time.Sleep(30 * time.Millisecond)
+		return workersqltest.Result{Rows: []map[string]interface{}{{"n": 1}}}
+	})
+	server.On("SELECT * FROM missing").Fail("INVALID_QUERY", "no such table: missing")
+
+	client, err := workersql.NewClient(workersql.Config{
+		APIEndpoint:   server.URL,
+		APIKey:        "sk_live_secret",
+		Password:      "hunter2",
+		RetryAttempts: 1,
+		Shards:        map[string]string{"shard-0": "https://admin:pw@shard0.example.com/?token=abc"},
+		SlowQueries:   &workersql.SlowQueryConfig{Threshold: 20 * time.Millisecond, Handler: func(workersql.SlowQuery) {}},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func getDebug(t *testing.T, h http.Handler, path string, v interface{}) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	if v != nil {
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), v))
+	}
+	return rec
+}
+
+func TestDebugHandler(t *testing.T) {
+	client := newDebugClient(t)
+	ctx := context.Background()
+	_, err := client.Query(ctx, "SELECT 1")
+	require.NoError(t, err)
+	_, err = client.Query(ctx, "SELECT sleep(1)")
+	require.NoError(t, err)
+	failed, err := client.Query(ctx, "SELECT * FROM missing")
+	require.NoError(t, err)
+	require.False(t, failed.Success)
+
+	h := client.DebugHandler()
+
+	var recent []workersql.DebugQuery
+	getDebug(t, h, "/debug/workersql/queries", &recent)
+	require.Len(t, recent, 3)
+	assert.Equal(t, "SELECT * FROM missing", recent[0].SQL, "newest first")
+	assert.Contains(t, recent[0].Error, "no such table")
+	assert.Equal(t, "Query", recent[2].Op)
+	assert.NotEmpty(t, recent[2].QueryID)
+
+	var slow []workersql.DebugQuery
+	getDebug(t, h, "/debug/workersql/slow", &slow)
+	require.Len(t, slow, 1)
+	assert.Equal(t, "SELECT sleep(1)", slow[0].SQL)
+	assert.GreaterOrEqual(t, slow[0].DurationMs, 20.0)
+
+	var stats workersql.Stats
+	getDebug(t, h, "/debug/workersql/stats", &stats)
+	assert.Equal(t, int64(3), stats.Queries)
+	assert.Equal(t, int64(1), stats.SlowQueries)
+
+	rec := getDebug(t, h, "/debug/workersql/config", nil)
+	body := rec.Body.String()
+	for _, secret := range []string{"sk_live_secret", "hunter2", ":pw@", "token=abc"} {
+		assert.NotContains(t, body, secret)
+	}
+	var config map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &config))
+	assert.Equal(t, "[REDACTED]", config["APIKey"])
+	assert.Equal(t, "20ms", config["SlowQueries"].(map[string]interface{})["Threshold"])
+	assert.Contains(t, config["Shards"].(map[string]interface{})["shard-0"], "admin:")
+
+	var snapshot workersql.DebugSnapshot
+	getDebug(t, h, "/debug/workersql/json", &snapshot)
+	assert.Len(t, snapshot.RecentQueries, 3)
+	assert.Nil(t, snapshot.Standby)
+
+	page := getDebug(t, h, "/debug/workersql/", nil)
+	assert.Contains(t, page.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, page.Body.String(), "SELECT sleep(1)")
+	assert.Contains(t, page.Body.String(), `href="./stats"`)
+	assert.NotContains(t, page.Body.String(), "hunter2")
+
+	post := httptest.NewRecorder()
+	h.ServeHTTP(post, httptest.NewRequest(http.MethodPost, "/debug/workersql/json", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, post.Code)
+}
+
+func TestDebugRecentQueriesBounded(t *testing.T) {
+	client := newDebugClient(t)
+	for i := 0; i < workersql.DefaultDebugRecentQueries+10; i++ {
+		_, err := client.Query(context.Background(), "SELECT 1")
+		require.NoError(t, err)
+	}
+	assert.Len(t, client.DebugSnapshot().RecentQueries, workersql.DefaultDebugRecentQueries)
+}
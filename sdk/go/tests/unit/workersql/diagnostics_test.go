@@ -0,0 +1,91 @@
+package workersql_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSlowServer answers after delay, or when the test ends
+func newSlowServer(t *testing.T, delay time.Duration) *httptest.Server {
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(delay):
+		case <-done:
+		}
+		_, _ = w.Write([]byte(`{"success": true, "data": []}`))
+	}))
+	t.Cleanup(func() {
+		close(done)
+		srv.Close()
+	})
+	return srv
+}
+
+func TestTimeoutErrorAttributesServerTime(t *testing.T) {
+	srv := newSlowServer(t, time.Second)
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL, RetryAttempts: 1})
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = client.Query(ctx, "SELECT 1")
+
+	var timeout *workersql.TimeoutError
+	require.True(t, errors.As(err, &timeout), "got %v", err)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Equal(t, "/query", timeout.Op)
+	assert.Equal(t, 1, timeout.Attempts)
+	assert.Greater(t, timeout.Timings.Server, 30*time.Millisecond)
+	assert.Zero(t, timeout.Timings.PoolWait)
+	assert.Contains(t, err.Error(), "server")
+}
+
+func TestTimeoutErrorAttributesPoolWait(t *testing.T) {
+	srv := newSlowServer(t, 200*time.Millisecond)
+	client, err := workersql.NewClient(workersql.Config{
+		APIEndpoint:   srv.URL,
+		RetryAttempts: 1,
+		Pooling:       &workersql.PoolConfig{Enabled: true, MinConnections: 1, MaxConnections: 1},
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	// Hold the only connection with a slow query
+	go func() { _, _ = client.Query(context.Background(), "SELECT slow") }()
+	require.Eventually(t, func() bool { return client.GetPoolStats()["active"] == 1 }, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = client.Exec(ctx, "DELETE FROM sessions")
+
+	var timeout *workersql.TimeoutError
+	require.True(t, errors.As(err, &timeout), "got %v", err)
+	assert.Greater(t, timeout.Timings.PoolWait, 30*time.Millisecond)
+	assert.Zero(t, timeout.Timings.Server, "the request was never sent")
+	assert.Contains(t, err.Error(), "pool")
+}
+
+func TestNonTimeoutErrorsAreNotWrapped(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL, RetryAttempts: 1})
+	require.NoError(t, err)
+	defer client.Close()
+
+	_, err = client.Query(context.Background(), "SELECT 1")
+	require.Error(t, err)
+	var timeout *workersql.TimeoutError
+	assert.False(t, errors.As(err, &timeout))
+}
@@ -0,0 +1,106 @@
+package workersql_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type accountStatus int
+
+const (
+	statusActive accountStatus = iota
+	statusSuspended
+	statusClosed
+)
+
+type permission string
+
+const (
+	permRead  permission = "read"
+	permWrite permission = "write"
+)
+
+func init() {
+	workersql.RegisterEnum(map[accountStatus]string{
+		statusActive:    "active",
+		statusSuspended: "suspended",
+	})
+	workersql.RegisterEnum(map[permission]string{
+		permRead:  "read",
+		permWrite: "write",
+	})
+}
+
+func TestEnumParams(t *testing.T) {
+	var body map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(raw, &body)
+		_, _ = w.Write([]byte(`{"success": true}`))
+	}))
+	defer srv.Close()
+
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL, RetryAttempts: 1})
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx := context.Background()
+	_, err = client.Exec(ctx, "UPDATE accounts SET status = ?, perms = ? WHERE status IN (?) AND legacy = ?",
+		statusSuspended,
+		workersql.Set[permission]{permRead, permWrite},
+		[]accountStatus{statusActive, statusSuspended},
+		workersql.NewNull(statusActive))
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"suspended", "read,write", "active", "suspended", "active"}, body["params"])
+
+	body = nil
+	_, err = client.Exec(ctx, "UPDATE accounts SET status = ?", statusClosed)
+	assert.ErrorIs(t, err, workersql.ErrInvalidEnum)
+	assert.Nil(t, body, "invalid enum values must not reach the server")
+}
+
+func TestEnumScan(t *testing.T) {
+	var status accountStatus
+	require.NoError(t, workersql.ScanValue("suspended", &status))
+	assert.Equal(t, statusSuspended, status)
+
+	err := workersql.ScanValue("deleted", &status)
+	assert.ErrorIs(t, err, workersql.ErrInvalidEnum)
+
+	var perm permission
+	assert.ErrorIs(t, workersql.ScanValue("admin", &perm), workersql.ErrInvalidEnum)
+
+	var perms workersql.Set[permission]
+	require.NoError(t, workersql.ScanValue("read,write", &perms))
+	assert.Equal(t, workersql.Set[permission]{permRead, permWrite}, perms)
+	assert.True(t, perms.Contains(permWrite))
+
+	require.NoError(t, workersql.ScanValue("", &perms))
+	assert.Empty(t, perms)
+
+	type account struct {
+		Status accountStatus                 `db:"status"`
+		Prev   workersql.Null[accountStatus] `db:"prev"`
+		Perms  workersql.Set[permission]     `db:"perms"`
+	}
+	var a account
+	require.NoError(t, workersql.ScanStruct(map[string]interface{}{"status": "active", "prev": nil, "perms": "read"}, &a))
+	assert.Equal(t, statusActive, a.Status)
+	assert.False(t, a.Prev.Valid)
+	assert.Equal(t, workersql.Set[permission]{permRead}, a.Perms)
+}
+
+func TestRegisterEnumDuplicateValue(t *testing.T) {
+	type color int
+	assert.Panics(t, func() {
+		workersql.RegisterEnum(map[color]string{0: "red", 1: "red"})
+	})
+}
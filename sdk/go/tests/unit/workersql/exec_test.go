@@ -0,0 +1,56 @@
+package workersql_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExec(t *testing.T) {
+	var received map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		_, _ = w.Write([]byte(`{"success":true,"affectedRows":1,"lastInsertId":42,"executionTime":1.5}`))
+	}))
+	defer srv.Close()
+
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL})
+	require.NoError(t, err)
+	defer client.Close()
+
+	result, err := client.Exec(context.Background(), "INSERT INTO users (name) VALUES (?)", "Ada")
+	require.NoError(t, err)
+
+	assert.Equal(t, "exec", received["mode"])
+	assert.True(t, result.Success)
+	assert.Equal(t, int64(1), result.AffectedRows)
+	assert.Equal(t, int64(42), result.LastInsertID)
+
+	id, err := result.LastInsertId()
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), id)
+}
+
+func TestExecFallsBackToRowCount(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"success":true,"rowCount":3}`))
+	}))
+	defer srv.Close()
+
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL})
+	require.NoError(t, err)
+	defer client.Close()
+
+	result, err := client.Exec(context.Background(), "DELETE FROM sessions WHERE expired = 1")
+	require.NoError(t, err)
+
+	affected, err := result.RowsAffected()
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), affected)
+}
@@ -0,0 +1,114 @@
+package workersql_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersqltest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newPlanClient returns a client of a mock gateway answering EXPLAIN QUERY
+// PLAN with a SQLite plan and other statements with two rows
+func newPlanClient(t *testing.T, config workersql.Config) (*workersql.Client, *workersqltest.MockServer) {
+	server := workersqltest.NewMockServer(t)
+	server.OnMatch(func(workersqltest.Call) bool { return true }).Respond(func(workersqltest.Call) workersqltest.Result {
+		time.Sleep(5 * time.Millisecond)
+		return workersqltest.Result{Rows: []map[string]interface{}{{"id": 1}, {"id": 2}}, ExecutionTime: 4.5}
+	})
+	server.OnMatch(func(c workersqltest.Call) bool { return strings.HasPrefix(c.SQL, "EXPLAIN QUERY PLAN ") }).Respond(func(workersqltest.Call) workersqltest.Result {
+		return workersqltest.Result{Shard: "shard-3", Rows: []map[string]interface{}{
+			{"id": 3, "parent": 0, "notused": 0, "detail": "SCAN o"},
+			{"id": 5, "parent": 0, "notused": 0, "detail": "SEARCH users AS u USING INTEGER PRIMARY KEY (rowid=?)"},
+			{"id": 9, "parent": 0, "notused": 0, "detail": "CORRELATED SCALAR SUBQUERY 2"},
+			{"id": 12, "parent": 9, "notused": 0, "detail": "SEARCH items USING COVERING INDEX idx_items_order (order_id=?) (~10 rows)"},
+			{"id": 20, "parent": 0, "notused": 0, "detail": "USE TEMP B-TREE FOR ORDER BY"},
+		}}
+	})
+
+	config.APIEndpoint, config.RetryAttempts = server.URL, 1
+	client, err := workersql.NewClient(config)
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client, server
+}
+
+// statementSQL returns the SQL of the statements server received
+func statementSQL(server *workersqltest.MockServer) []string {
+	var sqls []string
+	for _, call := range server.Calls() {
+		sqls = append(sqls, call.SQL)
+	}
+	return sqls
+}
+
+func TestExplain(t *testing.T) {
+	client, server := newPlanClient(t, workersql.Config{})
+
+	plan, err := client.Explain(context.Background(), "SELECT * FROM orders o JOIN users u ON u.id = o.user_id WHERE o.id IN (?)", []int{1, 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"EXPLAIN QUERY PLAN SELECT * FROM orders o JOIN users u ON u.id = o.user_id WHERE o.id IN (?, ?)"}, statementSQL(server))
+	assert.Equal(t, "shard-3", plan.Shard)
+	assert.Nil(t, plan.Actual)
+
+	require.Len(t, plan.Nodes, 4)
+	scan := plan.Nodes[0]
+	assert.Equal(t, "SCAN", scan.Type)
+	assert.Equal(t, "o", scan.Table)
+	assert.True(t, scan.FullScan())
+
+	search := plan.Nodes[1]
+	assert.Equal(t, "SEARCH", search.Type)
+	assert.Equal(t, "users", search.Table)
+	assert.Equal(t, "u", search.Alias)
+	assert.Equal(t, "INTEGER PRIMARY KEY", search.Index)
+	assert.Equal(t, "rowid=?", search.Constraint)
+	assert.False(t, search.FullScan())
+
+	subquery := plan.Nodes[2]
+	assert.Equal(t, "CORRELATED SCALAR SUBQUERY", subquery.Type)
+	require.Len(t, subquery.Children, 1)
+	items := subquery.Children[0]
+	assert.Equal(t, "idx_items_order", items.Index)
+	assert.True(t, items.Covering)
+	assert.Equal(t, "order_id=?", items.Constraint)
+	assert.Equal(t, int64(10), items.EstimatedRows)
+
+	assert.Equal(t, "USE TEMP B-TREE FOR ORDER BY", plan.Nodes[3].Type)
+	assert.Equal(t, []*workersql.PlanNode{scan}, plan.FullScans())
+	assert.Equal(t, []string{"INTEGER PRIMARY KEY", "idx_items_order"}, plan.Indexes())
+	assert.Equal(t, "QUERY PLAN\n"+
+		"|--SCAN o\n"+
+		"|--SEARCH users AS u USING INTEGER PRIMARY KEY (rowid=?)\n"+
+		"|--CORRELATED SCALAR SUBQUERY 2\n"+
+		"|  `--SEARCH items USING COVERING INDEX idx_items_order (order_id=?) (~10 rows)\n"+
+		"`--USE TEMP B-TREE FOR ORDER BY\n", plan.String())
+}
+
+func TestExplainAnalyze(t *testing.T) {
+	client, server := newPlanClient(t, workersql.Config{})
+
+	plan, err := client.ExplainAnalyze(context.Background(), "SELECT id FROM orders")
+	require.NoError(t, err)
+	require.NotNil(t, plan.Actual)
+	assert.Equal(t, 2, plan.Actual.Rows)
+	assert.Equal(t, 4500*time.Microsecond, plan.Actual.ServerTime)
+	assert.GreaterOrEqual(t, plan.Actual.Duration, 5*time.Millisecond)
+	assert.Equal(t, []string{"EXPLAIN QUERY PLAN SELECT id FROM orders", "SELECT id FROM orders"}, statementSQL(server))
+	assert.Len(t, plan.Nodes, 4)
+}
+
+func TestExplainAnalyzeBypassesResultCache(t *testing.T) {
+	client, server := newPlanClient(t, workersql.Config{ResultCache: &workersql.ResultCacheConfig{TTL: time.Minute}})
+	ctx := context.Background()
+
+	_, err := client.Query(ctx, "SELECT id FROM orders")
+	require.NoError(t, err)
+	_, err = client.ExplainAnalyze(ctx, "SELECT id FROM orders")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"SELECT id FROM orders", "EXPLAIN QUERY PLAN SELECT id FROM orders", "SELECT id FROM orders"}, statementSQL(server))
+}
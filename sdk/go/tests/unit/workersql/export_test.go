@@ -0,0 +1,186 @@
+package workersql_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var limitPattern = regexp.MustCompile(`LIMIT (\d+)$`)
+
+// exportServer serves rows with ids 1..rows in pages, honouring the
+// keyset condition and limit of each query
+type exportServer struct {
+	mu      sync.Mutex
+	rows    int
+	failAt  int
+	queries []string
+}
+
+func (s *exportServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		SQL    string        `json:"sql"`
+		Params []interface{} `json:"params"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+
+	s.mu.Lock()
+	s.queries = append(s.queries, body.SQL)
+	failAt := s.failAt
+	s.mu.Unlock()
+
+	after := 0
+	if strings.Contains(body.SQL, "WHERE `id` > ?") {
+		after = int(body.Params[len(body.Params)-1].(float64))
+	}
+	limit, _ := strconv.Atoi(limitPattern.FindStringSubmatch(body.SQL)[1])
+
+	if failAt > 0 && after >= failAt {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"code": "INVALID_QUERY", "message": "boom"}`))
+		return
+	}
+
+	var rows []string
+	for id := after + 1; id <= s.rows && len(rows) < limit; id++ {
+		email := fmt.Sprintf("%q", fmt.Sprintf("u%d@example.com", id))
+		if id%2 == 0 {
+			email = "null"
+		}
+		rows = append(rows, fmt.Sprintf(`{"id": %d, "email": %s}`, id, email))
+	}
+	fmt.Fprintf(w, `{"success": true, "columns": [{"name": "id", "type": "INT"}, {"name": "email", "type": "VARCHAR"}], "data": [%s]}`,
+		strings.Join(rows, ","))
+}
+
+func newExportClient(t *testing.T, server *exportServer) *workersql.Client {
+	srv := httptest.NewServer(server)
+	t.Cleanup(srv.Close)
+
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL, RetryAttempts: 1})
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestExportCSV(t *testing.T) {
+	server := &exportServer{rows: 5}
+	client := newExportClient(t, server)
+
+	var buf bytes.Buffer
+	var checkpoints []workersql.ExportCheckpoint
+	checkpoint, err := client.Export(context.Background(), workersql.ExportSpec{
+		Table:        "users",
+		Writer:       &buf,
+		PageSize:     2,
+		OnCheckpoint: func(c workersql.ExportCheckpoint) { checkpoints = append(checkpoints, c) },
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "id,email\n1,u1@example.com\n2,\\N\n3,u3@example.com\n4,\\N\n5,u5@example.com\n", buf.String())
+	assert.Equal(t, int64(5), checkpoint.Rows)
+	assert.Equal(t, []interface{}{int64(5)}, checkpoint.LastKey)
+	assert.Len(t, checkpoints, 3)
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	assert.Equal(t, "SELECT * FROM `users` ORDER BY `id` LIMIT 2", server.queries[0])
+	assert.Equal(t, "SELECT * FROM `users` WHERE `id` > ? ORDER BY `id` LIMIT 2", server.queries[1])
+}
+
+func TestExportJSONLQuery(t *testing.T) {
+	server := &exportServer{rows: 3}
+	client := newExportClient(t, server)
+
+	var buf bytes.Buffer
+	_, err := client.Export(context.Background(), workersql.ExportSpec{
+		Query:  "SELECT id, email FROM users WHERE active = ?;",
+		Params: []interface{}{true},
+		Format: workersql.ExportJSONL,
+		Writer: &buf,
+	})
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.JSONEq(t, `{"id": 2, "email": null}`, lines[1])
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	assert.Equal(t, "SELECT * FROM (SELECT id, email FROM users WHERE active = ?) AS export_source ORDER BY `id` LIMIT 1000", server.queries[0])
+}
+
+func TestExportResume(t *testing.T) {
+	server := &exportServer{rows: 6, failAt: 4}
+	client := newExportClient(t, server)
+
+	var buf bytes.Buffer
+	spec := workersql.ExportSpec{Table: "users", Writer: &buf, PageSize: 2}
+	checkpoint, err := client.Export(context.Background(), spec)
+	require.Error(t, err)
+	assert.Equal(t, int64(4), checkpoint.Rows)
+
+	// Persist and restore the checkpoint as a real resumable job would
+	saved, err := json.Marshal(checkpoint)
+	require.NoError(t, err)
+	var restored workersql.ExportCheckpoint
+	require.NoError(t, json.Unmarshal(saved, &restored))
+
+	server.mu.Lock()
+	server.failAt = 0
+	server.mu.Unlock()
+
+	spec.Checkpoint = &restored
+	checkpoint, err = client.Export(context.Background(), spec)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), checkpoint.Rows)
+	assert.Equal(t, "id,email\n1,u1@example.com\n2,\\N\n3,u3@example.com\n4,\\N\n5,u5@example.com\n6,\\N\n", buf.String())
+}
+
+func TestExportValidation(t *testing.T) {
+	client := newExportClient(t, &exportServer{})
+
+	_, err := client.Export(context.Background(), workersql.ExportSpec{Writer: &bytes.Buffer{}})
+	assert.Error(t, err)
+	_, err = client.Export(context.Background(), workersql.ExportSpec{Table: "a", Query: "SELECT 1", Writer: &bytes.Buffer{}})
+	assert.Error(t, err)
+	_, err = client.Export(context.Background(), workersql.ExportSpec{Table: "a"})
+	assert.Error(t, err)
+}
+
+func TestExportCompositeKey(t *testing.T) {
+	client, server := newMapperClient(t, map[string]string{
+		"SELECT":                            `{"success": true, "data": [{"tenant_id": "acme", "user_id": 1}, {"tenant_id": "acme", "user_id": 2}]}`,
+		"SELECT * FROM `memberships` WHERE": `{"success": true, "data": []}`,
+	})
+
+	var buf bytes.Buffer
+	checkpoint, err := client.Export(context.Background(), workersql.ExportSpec{
+		Table:      "memberships",
+		KeyColumns: []string{"tenant_id", "user_id"},
+		Format:     workersql.ExportJSONL,
+		Writer:     &buf,
+		PageSize:   2,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"acme", float64(2)}, checkpoint.LastKey)
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	require.Len(t, server.received, 2)
+	assert.Equal(t, "SELECT * FROM `memberships` ORDER BY `tenant_id`, `user_id` LIMIT 2", server.received[0].SQL)
+	assert.Equal(t, "SELECT * FROM `memberships` WHERE (`tenant_id`, `user_id`) > (?, ?) ORDER BY `tenant_id`, `user_id` LIMIT 2", server.received[1].SQL)
+	assert.Equal(t, []interface{}{"acme", float64(2)}, server.received[1].Params)
+}
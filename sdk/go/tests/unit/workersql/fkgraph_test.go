@@ -0,0 +1,90 @@
+package workersql_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func shopGraph() *workersql.FKGraph {
+	return workersql.NewFKGraph([]string{"audit_log"}, []workersql.ForeignKey{
+		{Table: "orders", Columns: []string{"user_id"}, RefTable: "users", OnDelete: workersql.FKCascade},
+		{Table: "order_items", Columns: []string{"order_id"}, RefTable: "orders", OnDelete: workersql.FKCascade},
+		{Table: "order_items", Columns: []string{"product_id"}, RefTable: "products", OnDelete: workersql.FKRestrict},
+		{Table: "reviews", Columns: []string{"user_id"}, RefTable: "users", OnDelete: workersql.FKSetNull},
+		{Table: "invoices", Columns: []string{"order_id"}, RefTable: "orders", OnDelete: workersql.FKNoAction},
+		{Table: "users", Columns: []string{"referrer_id"}, RefTable: "users", OnDelete: workersql.FKSetNull},
+	})
+}
+
+func TestFKGraphOrder(t *testing.T) {
+	g := shopGraph()
+
+	assert.Equal(t, []string{"audit_log", "invoices", "order_items", "orders", "products", "reviews", "users"}, g.Tables())
+
+	order, err := g.TopologicalOrder()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"audit_log", "products", "users", "orders", "invoices", "order_items", "reviews"}, order)
+
+	deleteOrder, err := g.DeleteOrder()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"reviews", "order_items", "invoices", "orders", "users", "products", "audit_log"}, deleteOrder)
+}
+
+func TestFKGraphCycle(t *testing.T) {
+	g := workersql.NewFKGraph(nil, []workersql.ForeignKey{
+		{Table: "a", Columns: []string{"b_id"}, RefTable: "b"},
+		{Table: "b", Columns: []string{"a_id"}, RefTable: "a"},
+		{Table: "c", Columns: []string{"a_id"}, RefTable: "a"},
+	})
+
+	_, err := g.TopologicalOrder()
+	var cycle *workersql.FKCycleError
+	require.True(t, errors.As(err, &cycle))
+	assert.Equal(t, []string{"a", "b", "c"}, cycle.Tables)
+}
+
+func TestFKGraphDeleteImpact(t *testing.T) {
+	impact := shopGraph().DeleteImpact("users")
+
+	assert.Equal(t, []string{"orders", "order_items"}, impact.Cascades)
+	require.Len(t, impact.Nullified, 2)
+	assert.ElementsMatch(t, []string{"reviews", "users"}, []string{impact.Nullified[0].Table, impact.Nullified[1].Table})
+	require.Len(t, impact.Restricted, 1)
+	assert.Equal(t, "invoices", impact.Restricted[0].Table)
+}
+
+func TestClientFKGraph(t *testing.T) {
+	client, server := newMapperClient(t, map[string]string{
+		"SELECT m.name": `{"success": true, "data": [
+			{"table_name": "memberships", "fk_id": 0, "fk_seq": 0, "ref_table": "tenants", "from_column": "tenant_id", "to_column": "id", "on_delete": "CASCADE"},
+			{"table_name": "memberships", "fk_id": 1, "fk_seq": 0, "ref_table": "users", "from_column": "tenant_id", "to_column": "tenant_id", "on_delete": "NO ACTION"},
+			{"table_name": "memberships", "fk_id": 1, "fk_seq": 1, "ref_table": "users", "from_column": "user_id", "to_column": "user_id", "on_delete": "NO ACTION"},
+			{"table_name": "tenants", "fk_id": null, "fk_seq": null, "ref_table": null, "from_column": null, "to_column": null, "on_delete": null},
+			{"table_name": "users", "fk_id": 0, "fk_seq": 0, "ref_table": "tenants", "from_column": "tenant_id", "to_column": "id", "on_delete": "cascade"}
+		]}`,
+	})
+
+	g, err := client.FKGraph(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"memberships", "tenants", "users"}, g.Tables())
+	assert.Equal(t, []workersql.ForeignKey{
+		{Table: "memberships", Columns: []string{"tenant_id"}, RefTable: "tenants", RefColumns: []string{"id"}, OnDelete: workersql.FKCascade},
+		{Table: "memberships", Columns: []string{"tenant_id", "user_id"}, RefTable: "users", RefColumns: []string{"tenant_id", "user_id"}, OnDelete: workersql.FKNoAction},
+	}, g.ForeignKeys("memberships"))
+	assert.Equal(t, workersql.FKCascade, g.ForeignKeys("users")[0].OnDelete)
+	assert.Len(t, g.Referencing("tenants"), 2)
+
+	order, err := g.TopologicalOrder()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"tenants", "users", "memberships"}, order)
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	assert.Contains(t, server.received[0].SQL, "pragma_foreign_key_list")
+}
@@ -0,0 +1,140 @@
+package workersql_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gsiServer keeps lookup tables in memory and answers other statements with
+// the shard key they were routed by
+type gsiServer struct {
+	mu      sync.Mutex
+	entries map[string]map[string]bool // secondary key -> shard keys
+	routed  []string
+}
+
+func (s *gsiServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		SQL    string        `json:"sql"`
+		Params []interface{} `json:"params"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	p := req.Params
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var data []map[string]interface{}
+	switch {
+	case strings.Contains(req.SQL, "INTO `gsi_users_email`"):
+		key := p[0].(string)
+		if strings.Contains(req.SQL, "ON DUPLICATE KEY UPDATE") || s.entries[key] == nil {
+			s.entries[key] = map[string]bool{}
+		}
+		s.entries[key][p[1].(string)] = true
+	case strings.HasPrefix(req.SQL, "DELETE FROM `gsi_users_email`"):
+		delete(s.entries[p[0].(string)], p[1].(string))
+	case strings.HasPrefix(req.SQL, "SELECT `shard_key` FROM `gsi_users_email`"):
+		var keys []string
+		for k := range s.entries[p[0].(string)] {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			data = append(data, map[string]interface{}{"shard_key": k})
+		}
+	case strings.Contains(req.SQL, "fail"):
+		_, _ = w.Write([]byte(`{"success": false, "error": {"code": "CONSTRAINT_VIOLATION", "message": "duplicate"}}`))
+		return
+	default:
+		shardKey := r.Header.Get("X-WorkerSQL-Shard-Key")
+		s.routed = append(s.routed, shardKey)
+		data = append(data, map[string]interface{}{"tenant_id": shardKey})
+	}
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": data})
+}
+
+func (s *gsiServer) shardKeys(email string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for k := range s.entries[email] {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func newSecondaryIndex(t *testing.T, unique bool) (*workersql.SecondaryIndex, *gsiServer) {
+	server := &gsiServer{entries: map[string]map[string]bool{}}
+	srv := httptest.NewServer(server)
+	t.Cleanup(srv.Close)
+
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL, RetryAttempts: 1})
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client.SecondaryIndex(workersql.SecondaryIndexOptions{Table: "users", Column: "email", Unique: unique}), server
+}
+
+func TestSecondaryIndexWriteThroughAndLookup(t *testing.T) {
+	ix, server := newSecondaryIndex(t, true)
+	ctx := context.Background()
+
+	_, err := ix.Insert(ctx, "a@example.com", "tenant-1", "INSERT INTO users (tenant_id, email) VALUES (?, ?)", "tenant-1", "a@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"tenant-1"}, server.shardKeys("a@example.com"))
+
+	resp, err := ix.Query(ctx, "a@example.com", "SELECT * FROM users WHERE email = ?", "a@example.com")
+	require.NoError(t, err)
+	require.Len(t, resp.Data, 1)
+	assert.Equal(t, "tenant-1", resp.Data[0]["tenant_id"], "the read is routed by the looked-up shard key")
+
+	_, err = ix.Update(ctx, "a@example.com", "b@example.com", "tenant-1", "UPDATE users SET email = ? WHERE email = ?", "b@example.com", "a@example.com")
+	require.NoError(t, err)
+	assert.Empty(t, server.shardKeys("a@example.com"))
+	assert.Equal(t, []string{"tenant-1"}, server.shardKeys("b@example.com"))
+
+	_, err = ix.Delete(ctx, "b@example.com", "tenant-1", "DELETE FROM users WHERE email = ?", "b@example.com")
+	require.NoError(t, err)
+	_, err = ix.Lookup(ctx, "b@example.com")
+	assert.True(t, errors.Is(err, workersql.ErrNoRows))
+
+	resp, err = ix.Query(ctx, "b@example.com", "SELECT * FROM users WHERE email = ?", "b@example.com")
+	require.NoError(t, err)
+	assert.Empty(t, resp.Data, "unindexed keys don't query any shard")
+	assert.Equal(t, []string{"tenant-1", "tenant-1", "tenant-1", "tenant-1"}, server.routed)
+}
+
+func TestSecondaryIndexFailedWriteRemovesEntry(t *testing.T) {
+	ix, server := newSecondaryIndex(t, true)
+
+	_, err := ix.Insert(context.Background(), "a@example.com", "tenant-1", "INSERT INTO users fail")
+	require.Error(t, err)
+	assert.Empty(t, server.shardKeys("a@example.com"))
+}
+
+func TestSecondaryIndexNonUniqueKeys(t *testing.T) {
+	ix, server := newSecondaryIndex(t, false)
+	ctx := context.Background()
+
+	require.NoError(t, ix.Put(ctx, "shared@example.com", "tenant-1"))
+	require.NoError(t, ix.Put(ctx, "shared@example.com", "tenant-2"))
+	assert.Equal(t, []string{"tenant-1", "tenant-2"}, server.shardKeys("shared@example.com"))
+
+	resp, err := ix.Query(ctx, "shared@example.com", "SELECT * FROM users WHERE email = ?", "shared@example.com")
+	require.NoError(t, err)
+	assert.Len(t, resp.Data, 2, "rows are gathered from every shard key")
+
+	require.NoError(t, ix.Remove(ctx, "shared@example.com", "tenant-1"))
+	assert.Equal(t, []string{"tenant-2"}, server.shardKeys("shared@example.com"))
+}
@@ -0,0 +1,212 @@
+package workersql_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hedgedEndpoint answers queries after its delay, failing them with its
+// error code and status when set, and counts the requests it served and
+// the ones cancelled before it answered
+type hedgedEndpoint struct {
+	delay     int64
+	status    int32
+	code      atomic.Value
+	queries   int32
+	cancelled int32
+}
+
+func (e *hedgedEndpoint) setDelay(delay time.Duration) {
+	atomic.StoreInt64(&e.delay, int64(delay))
+}
+
+// fail makes the endpoint answer with an error of code and HTTP status
+func (e *hedgedEndpoint) fail(status int, code string) {
+	e.code.Store(code)
+	atomic.StoreInt32(&e.status, int32(status))
+}
+
+func (e *hedgedEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt32(&e.queries, 1)
+	// The server only notices the client going away once the body is read
+	_, _ = io.Copy(io.Discard, r.Body)
+	select {
+	case <-time.After(time.Duration(atomic.LoadInt64(&e.delay))):
+	case <-r.Context().Done():
+		atomic.AddInt32(&e.cancelled, 1)
+		return
+	}
+	if status := atomic.LoadInt32(&e.status); status != 0 {
+		w.WriteHeader(int(status))
+		fmt.Fprintf(w, `{"code": %q, "message": "query failed"}`, e.code.Load())
+		return
+	}
+	_, _ = w.Write([]byte(`{"success": true, "data": [{"id": 1}]}`))
+}
+
+// newHedgedClient returns a client hedging reads across primary and
+// secondary, always sending the first request to primary
+func newHedgedClient(t *testing.T, hedging workersql.HedgingConfig, primary, secondary *hedgedEndpoint) *workersql.Client {
+	var endpoints []string
+	for _, endpoint := range []*hedgedEndpoint{primary, secondary} {
+		srv := httptest.NewServer(endpoint)
+		t.Cleanup(srv.Close)
+		endpoints = append(endpoints, srv.URL)
+	}
+	client, err := workersql.NewClient(workersql.Config{
+		Endpoints:     endpoints,
+		RetryAttempts: 1,
+		LoadBalancer:  &workersql.LoadBalancerConfig{Strategy: workersql.BalancerFunc(func([]workersql.EndpointStatus) int { return 0 })},
+		Hedging:       &hedging,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestHedgingReadsTakeFirstResponse(t *testing.T) {
+	slow, fast := &balancedServer{delay: 300 * time.Millisecond}, &balancedServer{}
+	var endpoints []string
+	for _, server := range []*balancedServer{slow, fast} {
+		srv := httptest.NewServer(server)
+		defer srv.Close()
+		endpoints = append(endpoints, srv.URL)
+	}
+	client, err := workersql.NewClient(workersql.Config{
+		Endpoints:     endpoints,
+		RetryAttempts: 1,
+		// The slow endpoint comes first, so every read starts there
+		LoadBalancer: &workersql.LoadBalancerConfig{Strategy: workersql.BalancerFunc(func([]workersql.EndpointStatus) int { return 0 })},
+		Hedging:      &workersql.HedgingConfig{MaxDelay: 20 * time.Millisecond},
+	})
+	require.NoError(t, err)
+	defer client.Close()
+	ctx := context.Background()
+
+	start := time.Now()
+	_, err = client.Query(ctx, "SELECT * FROM users WHERE id = ?", 1)
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), 200*time.Millisecond, "the hedge to the other endpoint answers first")
+	assert.EqualValues(t, 1, atomic.LoadInt32(&fast.queries))
+	stats := client.Stats()
+	assert.EqualValues(t, 1, stats.Hedges)
+	assert.EqualValues(t, 1, stats.HedgeWins)
+
+	_, err = client.Exec(ctx, "UPDATE users SET name = ? WHERE id = ?", "x", 1)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&fast.queries), "writes are never hedged")
+	assert.EqualValues(t, 1, client.Stats().Hedges)
+}
+
+func TestHedgeDelayWarmsUpAndRecomputes(t *testing.T) {
+	primary, secondary := &hedgedEndpoint{}, &hedgedEndpoint{}
+	client := newHedgedClient(t, workersql.HedgingConfig{MinDelay: 5 * time.Millisecond, MaxDelay: 500 * time.Millisecond}, primary, secondary)
+	ctx := context.Background()
+	read := func() {
+		t.Helper()
+		_, err := client.Query(ctx, "SELECT * FROM users WHERE id = ?", 1)
+		require.NoError(t, err)
+	}
+
+	for i := 0; i < 19; i++ {
+		read()
+	}
+	primary.setDelay(100 * time.Millisecond)
+	read()
+	assert.EqualValues(t, 0, client.Stats().Hedges, "MaxDelay applies until 20 latencies are known")
+
+	// The 20th latency switched to the 95th percentile, clamped to MinDelay
+	read()
+	assert.EqualValues(t, 1, client.Stats().Hedges)
+	assert.EqualValues(t, 1, client.Stats().HedgeWins)
+
+	// The delay holds until 50 latencies were observed, however slow reads get
+	primary.setDelay(60 * time.Millisecond)
+	secondary.setDelay(60 * time.Millisecond)
+	for i := 22; i <= 50; i++ {
+		read()
+	}
+	assert.EqualValues(t, 30, client.Stats().Hedges)
+
+	// The 50th latency raised the delay above 60ms
+	primary.setDelay(10 * time.Millisecond)
+	read()
+	assert.EqualValues(t, 30, client.Stats().Hedges)
+}
+
+func TestHedgeCancelsLosingRequest(t *testing.T) {
+	primary, secondary := &hedgedEndpoint{delay: int64(2 * time.Second)}, &hedgedEndpoint{}
+	client := newHedgedClient(t, workersql.HedgingConfig{MaxDelay: 10 * time.Millisecond}, primary, secondary)
+
+	start := time.Now()
+	resp, err := client.Query(context.Background(), "SELECT * FROM users WHERE id = ?", 1)
+	require.NoError(t, err)
+	assert.True(t, resp.Success)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&primary.cancelled) == 1 }, time.Second, 5*time.Millisecond,
+		"the primary request is cancelled once the hedge wins")
+	assert.EqualValues(t, 1, client.Stats().HedgeWins)
+}
+
+func TestHedgeNotSentWhenPrimaryFailsFirst(t *testing.T) {
+	primary, secondary := &hedgedEndpoint{}, &hedgedEndpoint{}
+	primary.fail(http.StatusInternalServerError, "PRIMARY_FAILED")
+	client := newHedgedClient(t, workersql.HedgingConfig{MaxDelay: 200 * time.Millisecond}, primary, secondary)
+
+	start := time.Now()
+	_, err := client.Query(context.Background(), "SELECT * FROM users WHERE id = ?", 1)
+	assert.ErrorContains(t, err, "PRIMARY_FAILED")
+	assert.Less(t, time.Since(start), 200*time.Millisecond, "the failure returns without waiting for the hedge delay")
+	assert.EqualValues(t, 0, client.Stats().Hedges)
+	assert.EqualValues(t, 0, atomic.LoadInt32(&secondary.queries))
+}
+
+func TestHedgeBothFailingReturnsLastError(t *testing.T) {
+	primary, secondary := &hedgedEndpoint{}, &hedgedEndpoint{}
+	primary.fail(http.StatusInternalServerError, "PRIMARY_FAILED")
+	secondary.fail(http.StatusInternalServerError, "HEDGE_FAILED")
+	client := newHedgedClient(t, workersql.HedgingConfig{MaxDelay: 10 * time.Millisecond}, primary, secondary)
+	ctx := context.Background()
+
+	// The hedge fails first, so the primary's error is returned
+	primary.setDelay(100 * time.Millisecond)
+	_, err := client.Query(ctx, "SELECT * FROM users WHERE id = ?", 1)
+	assert.ErrorContains(t, err, "PRIMARY_FAILED")
+
+	// The primary fails first, while the hedge is still pending
+	primary.setDelay(30 * time.Millisecond)
+	secondary.setDelay(100 * time.Millisecond)
+	_, err = client.Query(ctx, "SELECT * FROM users WHERE id = ?", 1)
+	assert.ErrorContains(t, err, "HEDGE_FAILED")
+
+	stats := client.Stats()
+	assert.EqualValues(t, 2, stats.Hedges)
+	assert.EqualValues(t, 0, stats.HedgeWins)
+	assert.EqualValues(t, 0, atomic.LoadInt32(&primary.cancelled)+atomic.LoadInt32(&secondary.cancelled))
+}
+
+func TestHedgeSkipsLockingReads(t *testing.T) {
+	primary, secondary := &hedgedEndpoint{delay: int64(50 * time.Millisecond)}, &hedgedEndpoint{}
+	client := newHedgedClient(t, workersql.HedgingConfig{MaxDelay: 5 * time.Millisecond}, primary, secondary)
+
+	for _, sql := range []string{
+		"SELECT * FROM accounts WHERE id = 1 FOR SHARE",
+		"SELECT * FROM accounts WHERE id = 1 FOR UPDATE",
+		"SELECT * FROM accounts WHERE id = 1 LOCK IN SHARE MODE",
+	} {
+		_, err := client.Query(context.Background(), sql)
+		require.NoError(t, err, sql)
+	}
+	assert.EqualValues(t, 0, client.Stats().Hedges, "locking reads take locks, so are never sent twice")
+	assert.EqualValues(t, 0, atomic.LoadInt32(&secondary.queries))
+}
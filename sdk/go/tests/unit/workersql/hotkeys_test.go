@@ -0,0 +1,60 @@
+package workersql_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHotKeyDetection(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"success": true, "data": []}`))
+	}))
+	defer srv.Close()
+
+	sharding, err := workersql.LoadShardingConfig(configDir + "woocommerce")
+	require.NoError(t, err)
+	var alerts []workersql.HotKey
+	client, err := workersql.NewClient(workersql.Config{
+		APIEndpoint:   srv.URL,
+		RetryAttempts: 1,
+		Sharding:      sharding,
+		HotKeys: &workersql.HotKeyConfig{
+			Threshold: 5,
+			Window:    time.Minute,
+			OnHotKey:  func(k workersql.HotKey) { alerts = append(alerts, k) },
+		},
+	})
+	require.NoError(t, err)
+	defer client.Close()
+	ctx := context.Background()
+
+	// 5 requests per second over a minute is 300 requests
+	for i := 0; i < 400; i++ {
+		_, err := client.Query(ctx, "SELECT * FROM wc_orders WHERE customer_id = ?", "celebrity")
+		require.NoError(t, err)
+	}
+	for i := 0; i < 50; i++ {
+		_, err := client.Query(workersql.WithShardKey(ctx, "regular"), "SELECT * FROM wc_orders")
+		require.NoError(t, err)
+		_, err = client.Query(ctx, "SELECT * FROM wc_orders")
+		require.NoError(t, err)
+	}
+
+	require.Len(t, alerts, 1, "a hot key is reported once per window")
+	assert.Equal(t, "celebrity", alerts[0].Key)
+	assert.Equal(t, "wc_orders", alerts[0].Table)
+	assert.Greater(t, alerts[0].Rate, 5.0)
+	assert.EqualValues(t, 1, client.Stats().HotKeys)
+
+	hot := client.HotKeys()
+	require.Len(t, hot, 1)
+	assert.Equal(t, "celebrity", hot[0].Key)
+	assert.InDelta(t, 400.0/60, hot[0].Rate, 0.01)
+}
@@ -0,0 +1,57 @@
+package workersql_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"sync"
+	"testing"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigClientTrace(t *testing.T) {
+	server := &mapperServer{responses: map[string]string{"SELECT": `{"success": true, "data": []}`}}
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	type event struct{ path, hook string }
+	var (
+		mu     sync.Mutex
+		events []event
+	)
+	record := func(path, hook string) {
+		mu.Lock()
+		events = append(events, event{path, hook})
+		mu.Unlock()
+	}
+
+	type traceKey struct{}
+	client, err := workersql.NewClient(workersql.Config{
+		APIEndpoint:   srv.URL,
+		RetryAttempts: 1,
+		ClientTrace: func(ctx context.Context, method, path string) *httptrace.ClientTrace {
+			assert.Equal(t, "request-1", ctx.Value(traceKey{}), "the caller's context is passed through")
+			if path == "/health" {
+				return nil
+			}
+			return &httptrace.ClientTrace{
+				GotConn:              func(httptrace.GotConnInfo) { record(path, "GotConn") },
+				GotFirstResponseByte: func() { record(path, "GotFirstResponseByte") },
+			}
+		},
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx := context.WithValue(context.Background(), traceKey{}, "request-1")
+	_, err = client.Query(ctx, "SELECT 1")
+	require.NoError(t, err)
+	_, _ = client.Health(ctx)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []event{{"/query", "GotConn"}, {"/query", "GotFirstResponseByte"}}, events)
+}
@@ -0,0 +1,78 @@
+package workersql_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotencyKeys(t *testing.T) {
+	var mu sync.Mutex
+	var keys []string
+	failNext := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		keys = append(keys, r.Header.Get(workersql.IdempotencyKeyHeader))
+		fail := failNext
+		failNext = false
+		mu.Unlock()
+		if fail {
+			w.WriteHeader(http.StatusGatewayTimeout)
+			_, _ = w.Write([]byte(`{"code": "TIMEOUT_ERROR", "message": "shard timed out"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"success": true, "data": [], "results": []}`))
+	}))
+	defer srv.Close()
+
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL, RetryAttempts: 2, RetryDelay: time.Millisecond})
+	require.NoError(t, err)
+	defer client.Close()
+	ctx := context.Background()
+	sent := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		out := keys
+		keys = nil
+		return out
+	}
+
+	failNext = true
+	_, err = client.Exec(ctx, "INSERT INTO orders (id) VALUES (?)", 1)
+	require.NoError(t, err)
+	retried := sent()
+	require.Len(t, retried, 2)
+	assert.NotEmpty(t, retried[0])
+	assert.Equal(t, retried[0], retried[1], "retries send the same key")
+
+	_, err = client.Exec(ctx, "INSERT INTO orders (id) VALUES (?)", 1)
+	require.NoError(t, err)
+	assert.NotEqual(t, retried[0], sent()[0], "each call gets its own key")
+
+	_, err = client.Query(ctx, "SELECT * FROM orders")
+	require.NoError(t, err)
+	assert.Equal(t, []string{""}, sent(), "reads carry no key")
+
+	_, err = client.QueryWithOptions(ctx, "UPDATE orders SET paid = 1", nil, workersql.QueryOptions{IdempotencyKey: "pay-42"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"pay-42"}, sent())
+
+	_, err = client.Exec(workersql.WithIdempotencyKey(ctx, "job-7"), "DELETE FROM orders WHERE id = ?", 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"job-7"}, sent())
+
+	_, err = client.BatchQuery(ctx, []workersql.BatchStatement{{SQL: "INSERT INTO orders (id) VALUES (1)"}}, workersql.BatchOptions{IdempotencyKey: "batch-1"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"batch-1"}, sent())
+
+	_, err = client.BatchQuery(ctx, []workersql.BatchStatement{{SQL: "INSERT INTO orders (id) VALUES (2)"}}, workersql.BatchOptions{})
+	require.NoError(t, err)
+	assert.NotEmpty(t, sent()[0], "batches with writes get a generated key")
+}
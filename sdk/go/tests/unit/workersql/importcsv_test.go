@@ -0,0 +1,102 @@
+package workersql_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const usersCSV = `id,name,email,internal
+1,Ada,ada@example.com,x
+2,Bob,\N,x
+3,Cy,cy@example.com,x
+4,Di,di@example.com,x
+5,Ed,ed@example.com,x
+`
+
+func TestImportCSV(t *testing.T) {
+	server := &bulkServer{}
+	client := newBulkClient(t, server)
+
+	var updates []workersql.ImportProgress
+	progress, err := client.ImportCSV(context.Background(), "users", strings.NewReader(usersCSV), workersql.ImportOptions{
+		HasHeader:     true,
+		BatchSize:     2,
+		NullValue:     `\N`,
+		ColumnMapping: map[string]string{"id": "id", "name": "full_name", "email": "email"},
+		OnProgress:    func(p workersql.ImportProgress) { updates = append(updates, p) },
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(5), progress.RowsRead)
+	assert.Equal(t, int64(5), progress.RowsImported)
+	assert.Equal(t, int64(5), progress.AffectedRows)
+	assert.Equal(t, 3, progress.Batches)
+	require.Len(t, updates, 3)
+	assert.Equal(t, int64(4), updates[1].RowsImported)
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	require.Len(t, server.statements, 3)
+	assert.Equal(t, "INSERT INTO `users` (`id`, `full_name`, `email`) VALUES (?, ?, ?), (?, ?, ?)", server.statements[0])
+	assert.Equal(t, []interface{}{"1", "Ada", "ada@example.com", "2", "Bob", nil}, server.params[0])
+}
+
+func TestImportCSVResume(t *testing.T) {
+	server := &bulkServer{failOn: "Cy"}
+	client := newBulkClient(t, server)
+
+	opts := workersql.ImportOptions{HasHeader: true, BatchSize: 2}
+	progress, err := client.ImportCSV(context.Background(), "users", strings.NewReader(usersCSV), opts)
+	require.Error(t, err)
+
+	var importErr *workersql.ImportError
+	require.True(t, errors.As(err, &importErr))
+	assert.Equal(t, int64(2), importErr.ResumeRow)
+	assert.Equal(t, int64(2), progress.RowsImported)
+
+	server.mu.Lock()
+	server.failOn = ""
+	server.statements = nil
+	server.params = nil
+	server.mu.Unlock()
+
+	opts.SkipRows = importErr.ResumeRow
+	progress, err = client.ImportCSV(context.Background(), "users", strings.NewReader(usersCSV), opts)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), progress.RowsImported)
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	require.Len(t, server.statements, 2)
+	assert.Equal(t, "3", server.params[0][0])
+}
+
+func TestImportCSVWithoutHeader(t *testing.T) {
+	server := &bulkServer{}
+	client := newBulkClient(t, server)
+
+	input := "1;Ada\n2;Bob\n"
+	_, err := client.ImportCSV(context.Background(), "users", strings.NewReader(input), workersql.ImportOptions{Delimiter: ';'})
+	assert.Error(t, err, "column names are required without a header")
+
+	progress, err := client.ImportCSV(context.Background(), "users", strings.NewReader(input), workersql.ImportOptions{
+		Delimiter: ';',
+		Columns:   []string{"id", "name"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), progress.RowsImported)
+
+	_, err = client.ImportCSV(context.Background(), "users", strings.NewReader("1;Ada\n2\n"), workersql.ImportOptions{
+		Delimiter: ';',
+		Columns:   []string{"id", "name"},
+	})
+	var importErr *workersql.ImportError
+	require.True(t, errors.As(err, &importErr))
+	assert.Equal(t, int64(0), importErr.ResumeRow)
+}
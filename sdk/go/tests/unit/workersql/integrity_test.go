@@ -0,0 +1,88 @@
+package workersql_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckIntegrity(t *testing.T) {
+	client, server := newMapperClient(t, map[string]string{
+		"SELECT DISTINCT `user_id` FROM `orders` WHERE `user_id` IS NOT NULL ORDER": `{"success": true, "data": [{"user_id": 1}, {"user_id": 2}]}`,
+		"SELECT DISTINCT `user_id` FROM `orders` WHERE `user_id` IS NOT NULL AND":   `{"success": true, "data": [{"user_id": 3}]}`,
+		"SELECT `id` FROM `users`":                                  `{"success": true, "data": [{"id": 1}, {"id": 3}]}`,
+		"SELECT DISTINCT `tenant_id`, `user_id` FROM `memberships`": `{"success": true, "data": [{"tenant_id": "acme", "user_id": 1}, {"tenant_id": "acme", "user_id": 9}]}`,
+		"SELECT DISTINCT `tenant_id`, `user_id` FROM `memberships` WHERE `tenant_id` IS NOT NULL AND `user_id` IS NOT NULL AND": `{"success": true, "data": []}`,
+		"SELECT `tenant_id`, `id` FROM `accounts`": `{"success": true, "data": [{"tenant_id": "acme", "id": 1}]}`,
+	})
+
+	graph := workersql.NewFKGraph(nil, []workersql.ForeignKey{
+		{Table: "orders", Columns: []string{"user_id"}, RefTable: "users", RefColumns: []string{"id"}},
+	})
+	report, err := client.CheckIntegrity(context.Background(), workersql.IntegrityOptions{
+		Graph: graph,
+		Keys: []workersql.ForeignKey{
+			// A logical key between tables that may live on different shards
+			{Table: "memberships", Columns: []string{"tenant_id", "user_id"}, RefTable: "accounts", RefColumns: []string{"tenant_id", "id"}},
+		},
+		BatchSize: 2,
+	})
+	require.NoError(t, err)
+
+	assert.Len(t, report.Checked, 2)
+	assert.Equal(t, int64(5), report.KeysScanned)
+	assert.False(t, report.Truncated)
+	require.Len(t, report.Violations, 2)
+	assert.Equal(t, "orders", report.Violations[0].ForeignKey.Table)
+	assert.Equal(t, []interface{}{float64(2)}, report.Violations[0].Key)
+	assert.Equal(t, []interface{}{"acme", float64(9)}, report.Violations[1].Key)
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	var sqls []string
+	for _, stmt := range server.received {
+		sqls = append(sqls, stmt.SQL)
+	}
+	assert.Contains(t, sqls, "SELECT `id` FROM `users` WHERE `id` IN (?, ?)")
+	assert.Contains(t, sqls, "SELECT DISTINCT `user_id` FROM `orders` WHERE `user_id` IS NOT NULL AND `user_id` > ? ORDER BY `user_id` LIMIT 2")
+	assert.Contains(t, sqls, "SELECT `tenant_id`, `id` FROM `accounts` WHERE (`tenant_id` = ? AND `id` = ?) OR (`tenant_id` = ? AND `id` = ?)")
+}
+
+func TestCheckIntegrityLimits(t *testing.T) {
+	client, _ := newMapperClient(t, map[string]string{
+		"SELECT DISTINCT": `{"success": true, "data": [{"user_id": 1}, {"user_id": 2}, {"user_id": 3}]}`,
+		"SELECT `id`":     `{"success": true, "data": []}`,
+	})
+	ctx := context.Background()
+	keys := []workersql.ForeignKey{
+		{Table: "orders", Columns: []string{"user_id"}, RefTable: "users", RefColumns: []string{"id"}},
+		{Table: "reviews", Columns: []string{"user_id"}, RefTable: "users", RefColumns: []string{"id"}},
+	}
+
+	report, err := client.CheckIntegrity(ctx, workersql.IntegrityOptions{
+		Graph:         workersql.NewFKGraph(nil, nil),
+		Keys:          keys,
+		MaxViolations: 2,
+	})
+	require.NoError(t, err)
+	assert.True(t, report.Truncated)
+	assert.Len(t, report.Violations, 2)
+	assert.Len(t, report.Checked, 1)
+
+	report, err = client.CheckIntegrity(ctx, workersql.IntegrityOptions{
+		Graph:  workersql.NewFKGraph(nil, nil),
+		Keys:   keys,
+		Tables: []string{"reviews"},
+	})
+	require.NoError(t, err)
+	require.Len(t, report.Checked, 1)
+	assert.Equal(t, "reviews", report.Checked[0].Table)
+
+	_, err = client.CheckIntegrity(ctx, workersql.IntegrityOptions{
+		Graph: workersql.NewFKGraph(nil, []workersql.ForeignKey{{Table: "orders", Columns: []string{"user_id"}, RefTable: "users"}}),
+	})
+	assert.ErrorContains(t, err, "does not name the referenced columns")
+}
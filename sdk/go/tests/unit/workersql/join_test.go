@@ -0,0 +1,181 @@
+package workersql_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rowsSource emits rows in order
+func rowsSource(rows ...map[string]interface{}) workersql.RowSource {
+	return func(ctx context.Context, emit func(row map[string]interface{}) error) error {
+		for _, row := range rows {
+			if err := emit(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func collectJoin(t *testing.T, spec workersql.JoinSpec) ([]map[string]interface{}, *workersql.JoinResult) {
+	t.Helper()
+	var rows []map[string]interface{}
+	result, err := workersql.HashJoin(context.Background(), spec, func(row map[string]interface{}) error {
+		rows = append(rows, row)
+		return nil
+	})
+	require.NoError(t, err)
+	return rows, result
+}
+
+func TestHashJoin(t *testing.T) {
+	orders := rowsSource(
+		map[string]interface{}{"id": int64(1), "customer_id": int64(10), "total": 5.0},
+		map[string]interface{}{"id": int64(2), "customer_id": json.Number("20"), "total": 7.5},
+		map[string]interface{}{"id": int64(3), "customer_id": float64(99), "total": 1.0},
+		map[string]interface{}{"id": int64(4), "customer_id": nil, "total": 2.0},
+	)
+	customers := rowsSource(
+		map[string]interface{}{"id": int64(10), "name": "Ada"},
+		map[string]interface{}{"id": json.Number("20.0"), "name": "Grace"},
+		map[string]interface{}{"id": int64(20), "name": "Grace (dup)"},
+		map[string]interface{}{"id": nil, "name": "nobody"},
+	)
+
+	rows, result := collectJoin(t, workersql.JoinSpec{
+		Left: orders, Right: customers,
+		LeftKeys: []string{"customer_id"}, RightKeys: []string{"id"},
+	})
+	require.Len(t, rows, 3, "numbers match by value and NULLs never match")
+	assert.Equal(t, map[string]interface{}{"id": int64(1), "customer_id": int64(10), "total": 5.0, "name": "Ada"}, rows[0])
+	assert.Equal(t, "Grace", rows[1]["name"])
+	assert.Equal(t, "Grace (dup)", rows[2]["name"])
+	assert.Equal(t, int64(2), rows[1]["id"], "left columns win")
+	assert.Equal(t, &workersql.JoinResult{LeftRows: 4, RightRows: 4, Rows: 3}, result)
+
+	rows, _ = collectJoin(t, workersql.JoinSpec{
+		Left: orders, Right: customers,
+		LeftKeys: []string{"customer_id"}, RightKeys: []string{"id"},
+		Type: workersql.JoinLeft, RightPrefix: "customer_",
+	})
+	require.Len(t, rows, 5)
+	assert.Equal(t, int64(10), rows[0]["customer_id"], "left columns win over prefixed ones too")
+	assert.Equal(t, "Ada", rows[0]["customer_name"])
+	assert.Equal(t, map[string]interface{}{"id": int64(3), "customer_id": float64(99), "total": 1.0, "customer_name": nil}, rows[3])
+	assert.Contains(t, rows[4], "customer_name")
+	assert.Nil(t, rows[4]["customer_name"])
+}
+
+func TestHashJoinCompositeKeys(t *testing.T) {
+	day := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	rows, _ := collectJoin(t, workersql.JoinSpec{
+		Left: rowsSource(
+			map[string]interface{}{"tenant": "a", "day": day, "visits": int64(3)},
+			map[string]interface{}{"tenant": "b", "day": day, "visits": int64(4)},
+		),
+		Right: rowsSource(
+			map[string]interface{}{"t": "a", "d": day.In(time.FixedZone("X", 3600)), "revenue": 9.5},
+			map[string]interface{}{"t": "a", "d": day.Add(24 * time.Hour), "revenue": 1.0},
+		),
+		LeftKeys: []string{"tenant", "day"}, RightKeys: []string{"t", "d"},
+	})
+	require.Len(t, rows, 1, "times match by instant")
+	assert.Equal(t, 9.5, rows[0]["revenue"])
+}
+
+func TestHashJoinMemoryLimit(t *testing.T) {
+	var right []map[string]interface{}
+	for i := 0; i < 1000; i++ {
+		right = append(right, map[string]interface{}{"id": int64(i), "payload": fmt.Sprintf("%0100d", i)})
+	}
+	var left []map[string]interface{}
+	for i := 0; i < 1500; i++ {
+		left = append(left, map[string]interface{}{"ref": int64(i % 1200), "n": int64(i)})
+	}
+	spec := workersql.JoinSpec{
+		Left: rowsSource(left...), Right: rowsSource(right...),
+		LeftKeys: []string{"ref"}, RightKeys: []string{"id"},
+		Type:        workersql.JoinLeft,
+		MemoryLimit: 32 << 10,
+	}
+
+	_, err := workersql.HashJoin(context.Background(), spec, func(map[string]interface{}) error { return nil })
+	assert.ErrorIs(t, err, workersql.ErrJoinMemoryLimit)
+
+	dir := t.TempDir()
+	spec.SpillDir = dir
+	spilled, result := collectJoin(t, spec)
+	assert.True(t, result.Spilled)
+	assert.Greater(t, result.SpilledBytes, int64(0))
+	assert.Equal(t, int64(1500), result.Rows)
+
+	spec.SpillDir, spec.MemoryLimit = "", 0
+	inMemory, result := collectJoin(t, spec)
+	assert.False(t, result.Spilled)
+
+	key := func(rows []map[string]interface{}) []string {
+		var keys []string
+		for _, row := range rows {
+			keys = append(keys, fmt.Sprintf("%v|%v|%v", row["n"], row["ref"], row["payload"]))
+		}
+		sort.Strings(keys)
+		return keys
+	}
+	assert.Equal(t, key(inMemory), key(spilled), "a spilled join returns the same rows")
+	for _, row := range spilled {
+		assert.IsType(t, int64(0), row["n"], "spilled values keep their types")
+	}
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "spill files are removed")
+
+	spec.SpillDir, spec.MemoryLimit, spec.Partitions = dir, 32<<10, 1
+	_, err = workersql.HashJoin(context.Background(), spec, func(map[string]interface{}) error { return nil })
+	assert.ErrorIs(t, err, workersql.ErrJoinMemoryLimit, "a partition must fit in memory")
+}
+
+func TestHashJoinErrors(t *testing.T) {
+	emit := func(map[string]interface{}) error { return nil }
+	ctx := context.Background()
+	one := rowsSource(map[string]interface{}{"id": int64(1)})
+
+	_, err := workersql.HashJoin(ctx, workersql.JoinSpec{Left: one, Right: one}, emit)
+	assert.ErrorContains(t, err, "join keys are required")
+	_, err = workersql.HashJoin(ctx, workersql.JoinSpec{Left: one, Right: one, LeftKeys: []string{"id"}, RightKeys: []string{"id", "x"}}, emit)
+	assert.ErrorContains(t, err, "1 left keys but 2 right keys")
+	_, err = workersql.HashJoin(ctx, workersql.JoinSpec{Left: one, Right: one, LeftKeys: []string{"id"}, RightKeys: []string{"id"}, Type: "FULL"}, emit)
+	assert.ErrorContains(t, err, `unsupported join type "FULL"`)
+
+	failing := func(ctx context.Context, emit func(map[string]interface{}) error) error {
+		return errors.New("shard down")
+	}
+	_, err = workersql.HashJoin(ctx, workersql.JoinSpec{Left: one, Right: failing, LeftKeys: []string{"id"}, RightKeys: []string{"id"}}, emit)
+	assert.EqualError(t, err, "hash join: right side: shard down")
+
+	_, err = workersql.HashJoin(ctx, workersql.JoinSpec{Left: one, Right: one, LeftKeys: []string{"id"}, RightKeys: []string{"id"}},
+		func(map[string]interface{}) error { return errors.New("stop") })
+	assert.ErrorContains(t, err, "stop")
+}
+
+func TestJoinSourceInPipeline(t *testing.T) {
+	sink := &collectSink{}
+	result, err := workersql.NewRowPipeline(workersql.JoinSource(workersql.JoinSpec{
+		Left:     rowsSource(map[string]interface{}{"id": 1, "x": "a"}, map[string]interface{}{"id": 2, "x": "b"}),
+		Right:    rowsSource(map[string]interface{}{"id": 2, "y": "c"}),
+		LeftKeys: []string{"id"}, RightKeys: []string{"id"},
+	})).Run(context.Background(), sink)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), result.Written)
+	assert.Equal(t, []int{2}, sink.ids())
+}
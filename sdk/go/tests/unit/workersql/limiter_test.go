@@ -0,0 +1,95 @@
+package workersql_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersqltest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newPeakServer returns a mock server answering after delay and the peak
+// number of statements it had in flight
+func newPeakServer(t *testing.T, delay time.Duration) (*workersqltest.MockServer, func() int32) {
+	var inFlight, peak int32
+	server := workersqltest.NewMockServer(t)
+	server.OnMatch(func(workersqltest.Call) bool { return true }).Respond(func(workersqltest.Call) workersqltest.Result {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(delay)
+		return workersqltest.Result{}
+	})
+	return server, func() int32 { return atomic.LoadInt32(&peak) }
+}
+
+func TestLimiterCapsRequestsAcrossClients(t *testing.T) {
+	server, peak := newPeakServer(t, 10*time.Millisecond)
+	limiter := workersql.NewLimiter(workersql.LimiterConfig{MaxInFlight: 2, MaxConnsPerHost: 2})
+	defer limiter.CloseIdleConnections()
+
+	var clients []*workersql.Client
+	for i := 0; i < 3; i++ {
+		config := server.Config()
+		config.Limiter = limiter
+		client, err := workersql.NewClient(config)
+		require.NoError(t, err)
+		defer client.Close()
+		clients = append(clients, client)
+	}
+
+	var wg sync.WaitGroup
+	for _, client := range clients {
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(client *workersql.Client) {
+				defer wg.Done()
+				_, err := client.Query(context.Background(), "SELECT 1")
+				assert.NoError(t, err)
+			}(client)
+		}
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, peak(), int32(2))
+	stats := limiter.Stats()
+	assert.Zero(t, stats.InFlight)
+	assert.Zero(t, stats.Waiting)
+	assert.Positive(t, stats.Waits)
+	assert.Positive(t, stats.WaitDuration)
+	assert.Equal(t, 2, stats.MaxInFlight)
+
+	// Closing one client leaves the others working
+	require.NoError(t, clients[0].Close())
+	_, err := clients[1].Query(context.Background(), "SELECT 1")
+	assert.NoError(t, err)
+}
+
+func TestLimiterWaitEndsWithContext(t *testing.T) {
+	server, _ := newPeakServer(t, 100*time.Millisecond)
+	limiter := workersql.NewLimiter(workersql.LimiterConfig{MaxInFlight: 1})
+	config := server.Config()
+	config.Limiter = limiter
+	client, err := workersql.NewClient(config)
+	require.NoError(t, err)
+	defer client.Close()
+
+	go func() { _, _ = client.Query(context.Background(), "SELECT 1") }()
+	require.Eventually(t, func() bool { return limiter.Stats().InFlight == 1 }, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = client.Query(ctx, "SELECT 2")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, int64(1), limiter.Stats().Abandoned)
+}
@@ -0,0 +1,116 @@
+package workersql_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersqltest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const localHelperEnv = "WORKERSQL_LOCAL_HELPER"
+
+// newLocalGateway returns a mock gateway answering like one under wrangler
+// dev
+func newLocalGateway(t *testing.T) *workersqltest.MockServer {
+	server := workersqltest.NewMockServer(t)
+	server.On("SELECT 1 AS n").Return(map[string]interface{}{"n": 1})
+	return server
+}
+
+// TestLocalGatewayHelper is the process launched by the Start test, not a
+// test of its own
+func TestLocalGatewayHelper(t *testing.T) {
+	if os.Getenv(localHelperEnv) == "" {
+		t.Skip("helper process")
+	}
+	var port string
+	for i, arg := range os.Args {
+		if arg == "--port" && i+1 < len(os.Args) {
+			port = os.Args[i+1]
+		}
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:"+port)
+	if err != nil {
+		os.Exit(2)
+	}
+	go func() { _ = http.Serve(listener, newLocalGateway(t).Server.Config.Handler) }()
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM)
+	<-stop
+	os.Exit(0)
+}
+
+func writeWranglerConfig(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestNewLocalClientDiscoversGateway(t *testing.T) {
+	port := newLocalGateway(t).Listener.Addr().(*net.TCPAddr).Port
+
+	configs := map[string]string{
+		"wrangler.toml":  fmt.Sprintf("name = \"gateway\"\n\n[dev]\nip = \"127.0.0.1\" # loopback\nport = %d\n\n[vars]\nport = 1\n", port),
+		"wrangler.jsonc": fmt.Sprintf("{\n  // local settings\n  \"name\": \"gate//way\",\n  /* dev server */ \"dev\": {\"ip\": \"127.0.0.1\", \"port\": %d}\n}\n", port),
+	}
+	for name, content := range configs {
+		t.Run(name, func(t *testing.T) {
+			client, err := workersql.NewLocalClient(context.Background(), workersql.LocalOptions{
+				ConfigPath: writeWranglerConfig(t, name, content),
+				Config:     workersql.Config{RetryAttempts: 1},
+			})
+			require.NoError(t, err)
+			defer client.Close()
+
+			resp, err := client.Query(context.Background(), "SELECT 1 AS n")
+			require.NoError(t, err)
+			assert.EqualValues(t, 1, resp.Data[0]["n"])
+		})
+	}
+}
+
+// unusedPort returns a port nothing listens on
+func unusedPort(t *testing.T) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestNewLocalClientWithoutGateway(t *testing.T) {
+	_, err := workersql.NewLocalClient(context.Background(), workersql.LocalOptions{Host: "127.0.0.1", Port: unusedPort(t)})
+	assert.ErrorIs(t, err, workersql.ErrNoLocalGateway)
+}
+
+func TestNewLocalClientStartsGateway(t *testing.T) {
+	t.Setenv(localHelperEnv, "1")
+	port := unusedPort(t)
+	client, err := workersql.NewLocalClient(context.Background(), workersql.LocalOptions{
+		ConfigPath:   writeWranglerConfig(t, "wrangler.toml", "[dev]\nip = \"127.0.0.1\"\n"),
+		Port:         port,
+		Start:        true,
+		Command:      []string{os.Args[0], "-test.run=^TestLocalGatewayHelper$", "--"},
+		StartTimeout: 10 * time.Second,
+		Config:       workersql.Config{RetryAttempts: 1},
+	})
+	require.NoError(t, err)
+
+	resp, err := client.Query(context.Background(), "SELECT 1 AS n")
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, resp.Data[0]["n"])
+
+	require.NoError(t, client.Close())
+	_, err = http.Get(fmt.Sprintf("http://127.0.0.1:%d/v1/health", port))
+	assert.Error(t, err, "closing the client stops the launched gateway")
+}
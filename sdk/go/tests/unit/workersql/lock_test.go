@@ -0,0 +1,158 @@
+package workersql_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gws "github.com/gorilla/websocket"
+	"github.com/healthfees-org/workersql/sdk/go/internal/websocket"
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lockServer is a gateway stub emulating MySQL advisory locks, held by
+// WebSocket connection and released when it closes
+type lockServer struct {
+	*httptest.Server
+
+	mu    sync.Mutex
+	locks map[string]*gws.Conn
+	conns []*gws.Conn
+}
+
+func newLockServer(t *testing.T) *lockServer {
+	s := &lockServer{locks: make(map[string]*gws.Conn)}
+	upgrader := gws.Upgrader{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns = append(s.conns, conn)
+		s.mu.Unlock()
+		defer func() {
+			conn.Close()
+			s.mu.Lock()
+			for name, holder := range s.locks {
+				if holder == conn {
+					delete(s.locks, name)
+				}
+			}
+			s.mu.Unlock()
+		}()
+
+		for {
+			var msg websocket.Message
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			reply := websocket.Message{Type: websocket.FrameResponse, ID: msg.ID, Data: map[string]interface{}{"success": true}}
+			switch {
+			case msg.Type == websocket.FrameBegin:
+				reply.Data = map[string]interface{}{"transactionId": "tx"}
+			case msg.Type == websocket.FrameQuery:
+				name, _ := msg.Params[0].(string)
+				column, value := s.run(conn, msg.SQL, name)
+				reply.Data = map[string]interface{}{"success": true, "data": []interface{}{map[string]interface{}{column: value}}}
+			}
+			if err := conn.WriteJSON(reply); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *lockServer) run(conn *gws.Conn, sql, name string) (string, interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	holder, held := s.locks[name]
+	switch {
+	case strings.Contains(sql, "GET_LOCK"):
+		if held && holder != conn {
+			return "acquired", 0
+		}
+		s.locks[name] = conn
+		return "acquired", 1
+	case strings.Contains(sql, "IS_USED_LOCK"):
+		if !held {
+			return "held", nil
+		}
+		return "held", holder == conn
+	case strings.Contains(sql, "RELEASE_LOCK"):
+		if !held {
+			return "released", nil
+		}
+		if holder != conn {
+			return "released", 0
+		}
+		delete(s.locks, name)
+		return "released", 1
+	}
+	return "", nil
+}
+
+// drop closes every connection from the server side
+func (s *lockServer) drop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		_ = conn.Close()
+	}
+}
+
+func TestAdvisoryLockExcludesOtherSessions(t *testing.T) {
+	srv := newLockServer(t)
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL})
+	require.NoError(t, err)
+	defer client.Close()
+	ctx := context.Background()
+
+	lock, err := client.AcquireLock(ctx, "nightly-report", time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "nightly-report", lock.Name())
+
+	_, err = client.AcquireLock(ctx, "nightly-report", 0)
+	require.ErrorIs(t, err, workersql.ErrLockTimeout)
+
+	require.NoError(t, lock.Release(ctx))
+	again, err := client.AcquireLock(ctx, "nightly-report", 0)
+	require.NoError(t, err)
+	require.NoError(t, again.Release(ctx))
+}
+
+func TestAdvisoryLockHeartbeatDetectsLoss(t *testing.T) {
+	srv := newLockServer(t)
+	client, err := workersql.NewClient(workersql.Config{
+		APIEndpoint:           srv.URL,
+		LockHeartbeatInterval: 20 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	defer client.Close()
+	ctx := context.Background()
+
+	lock, err := client.AcquireLock(ctx, "migrations", 0)
+	require.NoError(t, err)
+
+	select {
+	case <-lock.Lost():
+		t.Fatal("lock lost while its session was up")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	srv.drop()
+	select {
+	case <-lock.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("lost lock wasn't detected")
+	}
+	assert.ErrorIs(t, lock.Release(ctx), workersql.ErrLockLost)
+}
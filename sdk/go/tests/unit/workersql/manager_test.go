@@ -0,0 +1,146 @@
+package workersql_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersqltest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTenantManager returns a manager whose tenants all use server, and the
+// number of times a tenant was resolved
+func newTenantManager(t *testing.T, server *workersqltest.MockServer, config workersql.ClientManagerConfig) (*workersql.ClientManager, *int32) {
+	var resolved int32
+	config.Resolve = func(ctx context.Context, tenant string) (workersql.Config, error) {
+		atomic.AddInt32(&resolved, 1)
+		if tenant == "unknown" {
+			return workersql.Config{}, errors.New("no such tenant")
+		}
+		cfg := server.Config()
+		cfg.Database = tenant
+		return cfg, nil
+	}
+	manager := workersql.NewClientManager(config)
+	t.Cleanup(func() { _ = manager.Close() })
+	return manager, &resolved
+}
+
+func TestClientManagerCachesClients(t *testing.T) {
+	manager, resolved := newTenantManager(t, workersqltest.NewMockServer(t), workersql.ClientManagerConfig{})
+	ctx := context.Background()
+
+	clients := make([]*workersql.Client, 10)
+	var wg sync.WaitGroup
+	for i := range clients {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			client, err := manager.Get(ctx, "acme")
+			require.NoError(t, err)
+			clients[i] = client
+		}(i)
+	}
+	wg.Wait()
+	for _, client := range clients {
+		assert.Same(t, clients[0], client)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(resolved), "concurrent calls share the creation")
+
+	other, err := manager.Get(ctx, "globex")
+	require.NoError(t, err)
+	assert.NotSame(t, clients[0], other)
+	assert.Equal(t, 2, manager.Len())
+
+	_, err = other.Query(ctx, "SELECT 1")
+	require.NoError(t, err)
+
+	// Failures aren't cached
+	_, err = manager.Get(ctx, "unknown")
+	assert.ErrorContains(t, err, "no such tenant")
+	_, err = manager.Get(ctx, "unknown")
+	assert.Error(t, err)
+	assert.Equal(t, int32(4), atomic.LoadInt32(resolved))
+	assert.Equal(t, 2, manager.Len())
+}
+
+func TestClientManagerEvictsLeastRecentlyUsed(t *testing.T) {
+	manager, _ := newTenantManager(t, workersqltest.NewMockServer(t), workersql.ClientManagerConfig{MaxClients: 2})
+	ctx := context.Background()
+
+	a, err := manager.Get(ctx, "a")
+	require.NoError(t, err)
+	b, err := manager.Get(ctx, "b")
+	require.NoError(t, err)
+	_, err = manager.Get(ctx, "a")
+	require.NoError(t, err)
+	_, err = manager.Get(ctx, "c")
+	require.NoError(t, err)
+	assert.Equal(t, 2, manager.Len())
+
+	// b was used least recently, so it is shut down
+	assert.Eventually(t, func() bool {
+		_, err := b.Query(ctx, "SELECT 1")
+		return errors.Is(err, workersql.ErrClientClosed)
+	}, time.Second, 5*time.Millisecond)
+	_, err = a.Query(ctx, "SELECT 1")
+	assert.NoError(t, err)
+
+	again, err := manager.Get(ctx, "b")
+	require.NoError(t, err)
+	assert.NotSame(t, b, again)
+
+	// Getting b back evicted a
+	manager.Evict("c")
+	assert.Equal(t, 1, manager.Len())
+}
+
+func TestClientManagerEvictsIdleClients(t *testing.T) {
+	manager, _ := newTenantManager(t, workersqltest.NewMockServer(t), workersql.ClientManagerConfig{IdleTimeout: 20 * time.Millisecond})
+
+	_, err := manager.Get(context.Background(), "acme")
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool { return manager.Len() == 0 }, time.Second, 5*time.Millisecond)
+}
+
+func TestClientManagerMaxConnections(t *testing.T) {
+	server, peak := newPeakServer(t, 10*time.Millisecond)
+	manager, _ := newTenantManager(t, server, workersql.ClientManagerConfig{MaxConnections: 2})
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for _, tenant := range []string{"a", "b", "c", "d"} {
+		client, err := manager.Get(ctx, tenant)
+		require.NoError(t, err)
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := client.Query(ctx, "SELECT 1")
+				assert.NoError(t, err)
+			}()
+		}
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, peak(), int32(2))
+}
+
+func TestClientManagerShutdown(t *testing.T) {
+	manager, _ := newTenantManager(t, workersqltest.NewMockServer(t), workersql.ClientManagerConfig{})
+	ctx := context.Background()
+
+	client, err := manager.Get(ctx, "acme")
+	require.NoError(t, err)
+	require.NoError(t, manager.Shutdown(ctx))
+
+	_, err = client.Query(ctx, "SELECT 1")
+	assert.ErrorIs(t, err, workersql.ErrClientClosed)
+	_, err = manager.Get(ctx, "acme")
+	assert.ErrorIs(t, err, workersql.ErrClientClosed)
+}
@@ -0,0 +1,198 @@
+package workersql_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordedStatement struct {
+	SQL    string        `json:"sql"`
+	Params []interface{} `json:"params"`
+}
+
+// mapperServer records statements and answers each one with the response
+// registered for the longest matching SQL prefix
+type mapperServer struct {
+	mu        sync.Mutex
+	responses map[string]string
+	received  []recordedStatement
+}
+
+func (s *mapperServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var stmt recordedStatement
+	_ = json.NewDecoder(r.Body).Decode(&stmt)
+
+	s.mu.Lock()
+	s.received = append(s.received, stmt)
+	s.mu.Unlock()
+
+	best := ""
+	for prefix := range s.responses {
+		if strings.HasPrefix(stmt.SQL, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		_, _ = w.Write([]byte(`{"success": true}`))
+		return
+	}
+	_, _ = w.Write([]byte(s.responses[best]))
+}
+
+func newMapperClient(t *testing.T, responses map[string]string) (*workersql.Client, *mapperServer) {
+	server := &mapperServer{responses: responses}
+	srv := httptest.NewServer(server)
+	t.Cleanup(srv.Close)
+
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL, RetryAttempts: 1, ParseTime: true})
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client, server
+}
+
+type auditFields struct {
+	CreatedAt time.Time `db:"created_at,default"`
+}
+
+type article struct {
+	ID       int64  `db:"id,pk,auto"`
+	Title    string `db:"title"`
+	Status   string `db:"status,default"`
+	Slug     string `db:"slug,generated"`
+	Internal string `db:"-"`
+	auditFields
+}
+
+func TestInsertStructReadsBackDatabaseColumns(t *testing.T) {
+	client, server := newMapperClient(t, map[string]string{
+		"INSERT": `{"success": true, "affectedRows": 1, "lastInsertId": 42}`,
+		"SELECT": `{"success": true,
+			"columns": [{"name": "slug", "type": "VARCHAR"}, {"name": "status", "type": "VARCHAR"}, {"name": "created_at", "type": "DATETIME"}],
+			"data": [{"slug": "hello-world", "status": "draft", "created_at": "2025-10-14 12:00:00"}]}`,
+	})
+
+	a := &article{Title: "Hello World"}
+	resp, err := client.InsertStruct(context.Background(), "articles", a)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), resp.AffectedRows)
+
+	assert.Equal(t, int64(42), a.ID)
+	assert.Equal(t, "hello-world", a.Slug)
+	assert.Equal(t, "draft", a.Status)
+	assert.Equal(t, time.Date(2025, 10, 14, 12, 0, 0, 0, time.UTC), a.CreatedAt)
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	require.Len(t, server.received, 2)
+	assert.Equal(t, "INSERT INTO `articles` (`title`) VALUES (?)", server.received[0].SQL)
+	assert.Equal(t, []interface{}{"Hello World"}, server.received[0].Params)
+	assert.Equal(t, "SELECT `status`, `slug`, `created_at` FROM `articles` WHERE `id` = ?", server.received[1].SQL)
+	assert.Equal(t, []interface{}{float64(42)}, server.received[1].Params)
+}
+
+func TestInsertStructWritesExplicitValues(t *testing.T) {
+	client, server := newMapperClient(t, map[string]string{
+		"SELECT": `{"success": true, "data": [{"slug": "x"}]}`,
+	})
+
+	a := &article{ID: 7, Title: "T", Status: "published"}
+	_, err := client.InsertStruct(context.Background(), "articles", a)
+	require.NoError(t, err)
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	assert.Equal(t, "INSERT INTO `articles` (`id`, `title`, `status`) VALUES (?, ?, ?)", server.received[0].SQL)
+	assert.Equal(t, int64(7), a.ID)
+}
+
+func TestGetUpdateDeleteByPK(t *testing.T) {
+	client, server := newMapperClient(t, map[string]string{
+		"SELECT `id`":   `{"success": true, "data": [{"id": 3, "title": "T", "status": "draft", "slug": "t", "created_at": "2025-10-14 12:00:00"}]}`,
+		"SELECT `slug`": `{"success": true, "data": [{"slug": "t2"}]}`,
+		"UPDATE":        `{"success": true, "affectedRows": 1}`,
+		"DELETE":        `{"success": true, "affectedRows": 1}`,
+	})
+	ctx := context.Background()
+
+	var a article
+	require.NoError(t, client.GetByPK(ctx, "articles", &a, 3))
+	assert.Equal(t, int64(3), a.ID)
+	assert.Equal(t, "t", a.Slug)
+
+	a.Title = "T2"
+	_, err := client.UpdateStruct(ctx, "articles", &a)
+	require.NoError(t, err)
+	assert.Equal(t, "t2", a.Slug)
+
+	resp, err := client.DeleteByPK(ctx, "articles", a)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), resp.AffectedRows)
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	require.Len(t, server.received, 4)
+	assert.Equal(t, "SELECT `id`, `title`, `status`, `slug`, `created_at` FROM `articles` WHERE `id` = ? LIMIT 1", server.received[0].SQL)
+	assert.Equal(t, "UPDATE `articles` SET `title` = ?, `status` = ?, `created_at` = ? WHERE `id` = ?", server.received[1].SQL)
+	assert.Equal(t, "DELETE FROM `articles` WHERE `id` = ?", server.received[3].SQL)
+	assert.Equal(t, []interface{}{float64(3)}, server.received[3].Params)
+}
+
+func TestGetByPKNoRows(t *testing.T) {
+	client, _ := newMapperClient(t, map[string]string{"SELECT": `{"success": true, "data": []}`})
+
+	var a article
+	err := client.GetByPK(context.Background(), "articles", &a, 99)
+	assert.True(t, errors.Is(err, workersql.ErrNoRows))
+
+	type noKey struct{ Name string }
+	err = client.GetByPK(context.Background(), "things", &noKey{}, 1)
+	assert.Error(t, err)
+}
+
+type membership struct {
+	TenantID string `db:"tenant_id,pk"`
+	UserID   int64  `db:"user_id,pk"`
+	Role     string `db:"role"`
+}
+
+func TestCompositePrimaryKey(t *testing.T) {
+	client, server := newMapperClient(t, map[string]string{
+		"SELECT": `{"success": true, "data": [{"tenant_id": "acme", "user_id": 7, "role": "admin"}]}`,
+		"UPDATE": `{"success": true, "affectedRows": 1}`,
+		"DELETE": `{"success": true, "affectedRows": 1}`,
+	})
+	ctx := context.Background()
+
+	var m membership
+	require.NoError(t, client.GetByPK(ctx, "memberships", &m, "acme", 7))
+	assert.Equal(t, membership{TenantID: "acme", UserID: 7, Role: "admin"}, m)
+
+	m.Role = "owner"
+	_, err := client.UpdateStruct(ctx, "memberships", &m)
+	require.NoError(t, err)
+
+	_, err = client.DeleteByPK(ctx, "memberships", membership{}, "acme", 7)
+	require.NoError(t, err)
+
+	err = client.GetByPK(ctx, "memberships", &m, "acme")
+	assert.ErrorContains(t, err, "expected 2 primary key values (tenant_id, user_id)")
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	require.Len(t, server.received, 3)
+	assert.Equal(t, "SELECT `tenant_id`, `user_id`, `role` FROM `memberships` WHERE `tenant_id` = ? AND `user_id` = ? LIMIT 1", server.received[0].SQL)
+	assert.Equal(t, "UPDATE `memberships` SET `role` = ? WHERE `tenant_id` = ? AND `user_id` = ?", server.received[1].SQL)
+	assert.Equal(t, []interface{}{"owner", "acme", float64(7)}, server.received[1].Params)
+	assert.Equal(t, "DELETE FROM `memberships` WHERE `tenant_id` = ? AND `user_id` = ?", server.received[2].SQL)
+}
@@ -0,0 +1,115 @@
+package workersql_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func shardResult(rows ...map[string]interface{}) *workersql.QueryResponse {
+	return &workersql.QueryResponse{Success: true, Data: rows}
+}
+
+func column(rows []map[string]interface{}, name string) []interface{} {
+	values := make([]interface{}, len(rows))
+	for i, row := range rows {
+		values[i] = row[name]
+	}
+	return values
+}
+
+func TestMergeResultsOrderByMergesSortedShards(t *testing.T) {
+	results := []*workersql.QueryResponse{
+		shardResult(
+			map[string]interface{}{"id": int64(1), "score": 90.0},
+			map[string]interface{}{"id": int64(4), "score": 70.0},
+			map[string]interface{}{"id": int64(6), "score": nil},
+		),
+		shardResult(
+			map[string]interface{}{"id": int64(2), "score": json.Number("95")},
+			map[string]interface{}{"id": int64(3), "score": json.Number("70")},
+		),
+		shardResult(),
+	}
+
+	merged, err := workersql.MergeResults(results, workersql.MergeOptions{
+		OrderBy: []workersql.SortKey{{Column: "score", Descending: true}, {Column: "id"}},
+		Limit:   3,
+		Offset:  1,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{int64(1), int64(3), int64(4)}, column(merged.Data, "id"))
+	assert.Equal(t, 3, merged.RowCount)
+}
+
+func TestMergeResultsReaggregatesGroups(t *testing.T) {
+	results := []*workersql.QueryResponse{
+		shardResult(
+			map[string]interface{}{"region": "eu", "orders": int64(3), "revenue": json.Number("10.50"), "first": "2025-01-02", "last": "2025-03-01"},
+			map[string]interface{}{"region": "us", "orders": int64(1), "revenue": json.Number("4.25"), "first": "2025-02-01", "last": "2025-02-01"},
+		),
+		shardResult(
+			map[string]interface{}{"region": "eu", "orders": int64(2), "revenue": json.Number("1.5"), "first": "2025-01-01", "last": "2025-02-01"},
+			map[string]interface{}{"region": "apac", "orders": int64(7), "revenue": nil, "first": nil, "last": nil},
+		),
+	}
+
+	merged, err := workersql.MergeResults(results, workersql.MergeOptions{
+		GroupBy: []string{"region"},
+		Aggregates: []workersql.Aggregate{
+			{Column: "orders", Func: workersql.AggregateCount},
+			{Column: "revenue", Func: workersql.AggregateSum},
+			{Column: "first", Func: workersql.AggregateMin},
+			{Column: "last", Func: workersql.AggregateMax},
+		},
+		OrderBy: []workersql.SortKey{{Column: "orders", Descending: true}},
+	})
+	require.NoError(t, err)
+	require.Len(t, merged.Data, 3)
+
+	assert.Equal(t, []interface{}{"apac", "eu", "us"}, column(merged.Data, "region"))
+	eu := merged.Data[1]
+	assert.Equal(t, int64(5), eu["orders"])
+	assert.Equal(t, json.Number("12.00"), eu["revenue"])
+	assert.Equal(t, "2025-01-01", eu["first"])
+	assert.Equal(t, "2025-03-01", eu["last"])
+}
+
+func TestMergeResultsDistinct(t *testing.T) {
+	results := []*workersql.QueryResponse{
+		shardResult(map[string]interface{}{"code": "US", "id": int64(1)}, map[string]interface{}{"code": "DE", "id": int64(2)}),
+		shardResult(map[string]interface{}{"code": "US", "id": 1.0}, map[string]interface{}{"code": "FR", "id": int64(3)}),
+	}
+
+	merged, err := workersql.MergeResults(results, workersql.MergeOptions{Distinct: true})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"US", "DE", "FR"}, column(merged.Data, "code"))
+}
+
+func TestMergeResultsRejectsFailuresAndAvg(t *testing.T) {
+	_, err := workersql.MergeResults([]*workersql.QueryResponse{
+		shardResult(),
+		{Success: false, Error: &workersql.ErrorResponse{Code: "SHARD_DOWN", Message: "unavailable"}},
+	}, workersql.MergeOptions{})
+	assert.ErrorContains(t, err, "SHARD_DOWN")
+
+	_, err = workersql.MergeResults([]*workersql.QueryResponse{shardResult()}, workersql.MergeOptions{
+		GroupBy:    []string{"region"},
+		Aggregates: []workersql.Aggregate{{Column: "avg_price", Func: "AVG"}},
+	})
+	assert.Error(t, err)
+}
+
+func TestPushDownLimit(t *testing.T) {
+	opts := workersql.MergeOptions{Limit: 10, Offset: 20}
+	assert.Equal(t, "SELECT * FROM t ORDER BY id LIMIT 30", workersql.PushDownLimit("SELECT * FROM t ORDER BY id LIMIT 10 OFFSET 20", opts))
+	assert.Equal(t, "SELECT * FROM t ORDER BY id LIMIT 30", workersql.PushDownLimit("SELECT * FROM t ORDER BY id LIMIT 20, 10;", opts))
+	assert.Equal(t, "SELECT * FROM t ORDER BY id LIMIT 30", workersql.PushDownLimit("SELECT * FROM t ORDER BY id", opts))
+
+	grouped := workersql.MergeOptions{Limit: 10, GroupBy: []string{"region"}}
+	assert.Equal(t, "SELECT region, COUNT(*) n FROM t GROUP BY region LIMIT 10",
+		workersql.PushDownLimit("SELECT region, COUNT(*) n FROM t GROUP BY region LIMIT 10", grouped))
+}
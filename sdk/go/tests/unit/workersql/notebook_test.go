@@ -0,0 +1,108 @@
+package workersql_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const usageNotebook = `
+name: tenant-usage
+description: Orders per tenant created since a date
+variables:
+  since: "2024-01-01"
+  plan: ~
+steps:
+  - name: tenants
+    sql: SELECT id, name FROM tenants WHERE created_at >= ? AND plan = ?
+    params: ["${since}", "${plan}"]
+    capture: {first_tenant: name}
+    capture_all: {tenant_ids: id}
+  - name: orders
+    sql: SELECT tenant_id, COUNT(*) AS n FROM orders WHERE tenant_id IN (?) AND note LIKE ? GROUP BY tenant_id
+    params: ["${tenant_ids}", "%${first_tenant}%"]
+  - name: audit
+    sql: INSERT INTO report_runs (name, tenants) VALUES (?, ?)
+    params: ["tenant-usage", 2]
+`
+
+func TestRunNotebook(t *testing.T) {
+	client, server := newMapperClient(t, map[string]string{
+		"SELECT id":        `{"success": true, "columns": [{"name": "id"}, {"name": "name"}], "data": [{"id": 1, "name": "acme"}, {"id": 2, "name": "globex"}]}`,
+		"SELECT tenant_id": `{"success": true, "data": [{"tenant_id": 1, "n": 3}]}`,
+		"INSERT":           `{"success": true, "affectedRows": 1, "lastInsertId": 9}`,
+	})
+	notebook, err := workersql.ParseNotebook([]byte(usageNotebook))
+	require.NoError(t, err)
+
+	result, err := client.RunNotebook(context.Background(), notebook, map[string]interface{}{"plan": "pro"})
+	require.NoError(t, err)
+	require.Len(t, result.Steps, 3)
+	assert.Equal(t, "tenant-usage", result.Notebook)
+	assert.Equal(t, []string{"id", "name"}, result.Steps[0].Columns)
+	assert.Equal(t, "acme", result.Variables["first_tenant"])
+	assert.Len(t, result.Variables["tenant_ids"], 2)
+	assert.Len(t, result.Step("orders").Rows, 1)
+	assert.Equal(t, int64(9), result.Step("audit").LastInsertID)
+	assert.Nil(t, result.Step("missing"))
+
+	require.Len(t, server.received, 3)
+	assert.Equal(t, []interface{}{"2024-01-01", "pro"}, server.received[0].Params)
+	assert.Contains(t, server.received[1].SQL, "IN (?, ?)", "a captured list expands into an IN list")
+	assert.Equal(t, []interface{}{float64(1), float64(2), "%acme%"}, server.received[1].Params)
+
+	_, err = json.Marshal(result)
+	assert.NoError(t, err)
+}
+
+func TestRunNotebookStopsAtFailedStep(t *testing.T) {
+	client, server := newMapperClient(t, map[string]string{
+		"SELECT broken": `{"success": false, "error": {"code": "INVALID_QUERY", "message": "no such column"}}`,
+		"SELECT empty":  `{"success": true, "data": []}`,
+	})
+	notebook := &workersql.Notebook{Name: "runbook", Steps: []workersql.NotebookStep{
+		{Name: "optional", SQL: "SELECT broken", ContinueOnError: true},
+		{Name: "lookup", SQL: "SELECT empty", Capture: map[string]string{"id": "id"}},
+		{Name: "never", SQL: "DELETE FROM t WHERE id = ?", Params: []interface{}{"${id}"}},
+	}}
+
+	result, err := client.RunNotebook(context.Background(), notebook, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "step lookup")
+	require.Len(t, result.Steps, 2)
+	assert.Contains(t, result.Steps[0].Error, "no such column")
+	assert.Contains(t, result.Steps[1].Error, "no rows")
+	assert.Len(t, server.received, 2)
+}
+
+func TestNotebookValidation(t *testing.T) {
+	_, err := workersql.ParseNotebook([]byte(`{"name": "n", "steps": [{"name": "a", "sql": "SELECT ?", "params": ["${nope}"]}]}`))
+	assert.ErrorContains(t, err, "undefined variable nope")
+
+	_, err = workersql.ParseNotebook([]byte(`{"name": "n", "steps": [{"name": "a", "sql": "SELECT 1"}, {"name": "a", "sql": "SELECT 2"}]}`))
+	assert.ErrorContains(t, err, "duplicate step a")
+
+	_, err = workersql.ParseNotebook([]byte(`name: n
+steps:
+  - name: a
+    sql: " "`))
+	assert.ErrorContains(t, err, "no sql")
+
+	// A variable captured by a later step isn't available yet
+	_, err = workersql.ParseNotebook([]byte(`{"name": "n", "steps": [
+		{"name": "a", "sql": "SELECT ?", "params": ["${id}"]},
+		{"name": "b", "sql": "SELECT id FROM t", "capture": {"id": "id"}}]}`))
+	assert.ErrorContains(t, err, "undefined variable id")
+
+	path := filepath.Join(t.TempDir(), "usage.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(usageNotebook), 0o600))
+	notebook, err := workersql.LoadNotebook(path)
+	require.NoError(t, err)
+	assert.Len(t, notebook.Steps, 3)
+}
@@ -0,0 +1,83 @@
+package workersql_test
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const numericResponse = `{
+	"success": true,
+	"columns": [
+		{"name": "id", "type": "BIGINT"},
+		{"name": "counter", "type": "BIGINT UNSIGNED"},
+		{"name": "price", "type": "DECIMAL(30,10)"},
+		{"name": "total", "type": "DECIMAL(20,2)"}
+	],
+	"data": [
+		{"id": 9007199254740993, "counter": 18446744073709551615, "price": 12345678901234567890.0123456789, "total": "19.99", "extra": 0.1}
+	]
+}`
+
+func newNumericClient(t *testing.T, useNumber bool) *workersql.Client {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(numericResponse))
+	}))
+	t.Cleanup(srv.Close)
+
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL, UseNumber: useNumber})
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestBigIntegerFidelity(t *testing.T) {
+	client := newNumericClient(t, false)
+
+	result, err := client.Query(context.Background(), "SELECT * FROM accounts")
+	require.NoError(t, err)
+
+	row := result.Data[0]
+	assert.Equal(t, int64(9007199254740993), row["id"], "BIGINT is exact without UseNumber")
+	assert.Equal(t, uint64(18446744073709551615), row["counter"])
+	assert.IsType(t, float64(0), row["price"])
+	assert.Equal(t, 0.1, row["extra"])
+}
+
+func TestUseNumberKeepsDecimals(t *testing.T) {
+	client := newNumericClient(t, true)
+
+	result, err := client.Query(context.Background(), "SELECT * FROM accounts")
+	require.NoError(t, err)
+
+	row := result.Data[0]
+	assert.Equal(t, json.Number("12345678901234567890.0123456789"), row["price"])
+	assert.Equal(t, json.Number("19.99"), row["total"])
+	assert.Equal(t, json.Number("0.1"), row["extra"])
+
+	var price big.Rat
+	require.NoError(t, workersql.ScanNumber(row["price"], &price))
+	assert.Equal(t, "12345678901234567890.0123456789", price.FloatString(10))
+
+	var counter big.Int
+	require.NoError(t, workersql.ScanNumber(row["counter"], &counter))
+	assert.Equal(t, "18446744073709551615", counter.String())
+
+	var u uint64
+	require.NoError(t, workersql.ScanNumber(row["counter"], &u))
+	assert.Equal(t, uint64(18446744073709551615), u)
+}
+
+func TestScanNumberErrors(t *testing.T) {
+	var n int64
+	assert.Error(t, workersql.ScanNumber(nil, &n))
+	assert.Error(t, workersql.ScanNumber(json.Number("1.5"), &n))
+	assert.Error(t, workersql.ScanNumber(json.Number("1"), &struct{}{}))
+}
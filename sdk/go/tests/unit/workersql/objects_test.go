@@ -0,0 +1,153 @@
+package workersql_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// objectServer keeps the object store tables in memory
+type objectServer struct {
+	mu        sync.Mutex
+	manifests map[string]map[string]interface{}
+	chunks    map[string]string // key/version/seq -> data
+	failPart  int               // fail inserting this part number, -1 for none
+}
+
+func (s *objectServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		SQL    string        `json:"sql"`
+		Params []interface{} `json:"params"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	p := req.Params
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var data []map[string]interface{}
+	switch {
+	case strings.HasPrefix(req.SQL, "INSERT INTO `workersql_objects_chunks`"):
+		if int(p[2].(float64)) == s.failPart {
+			_, _ = w.Write([]byte(`{"success": false, "error": {"code": "RESOURCE_LIMIT", "message": "disk full"}}`))
+			return
+		}
+		s.chunks[fmt.Sprintf("%v/%v/%v", p[0], p[1], p[2])] = p[3].(string)
+	case strings.HasPrefix(req.SQL, "INSERT INTO `workersql_objects`"):
+		s.manifests[p[0].(string)] = map[string]interface{}{
+			"version": p[1], "size": p[2], "chunks": p[3], "chunk_size": p[4], "sha256": p[5], "updated_at": p[6],
+		}
+	case strings.HasPrefix(req.SQL, "SELECT `version`"):
+		if m, ok := s.manifests[p[0].(string)]; ok {
+			data = append(data, m)
+		}
+	case strings.HasPrefix(req.SQL, "SELECT `data`"):
+		if d, ok := s.chunks[fmt.Sprintf("%v/%v/%v", p[0], p[1], p[2])]; ok {
+			data = append(data, map[string]interface{}{"data": d})
+		}
+	case strings.HasPrefix(req.SQL, "DELETE FROM `workersql_objects_chunks`"):
+		prefix := fmt.Sprintf("%v/", p[0])
+		if len(p) > 1 {
+			prefix += fmt.Sprintf("%v/", p[1])
+		}
+		for k := range s.chunks {
+			if strings.HasPrefix(k, prefix) {
+				delete(s.chunks, k)
+			}
+		}
+	case strings.HasPrefix(req.SQL, "DELETE FROM `workersql_objects`"):
+		delete(s.manifests, p[0].(string))
+	}
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": data})
+}
+
+func newObjectStore(t *testing.T, chunkSize int) (*workersql.ObjectStore, *objectServer) {
+	server := &objectServer{manifests: map[string]map[string]interface{}{}, chunks: map[string]string{}, failPart: -1}
+	srv := httptest.NewServer(server)
+	t.Cleanup(srv.Close)
+
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL, RetryAttempts: 1})
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client.Objects(workersql.ObjectStoreOptions{ChunkSize: chunkSize}), server
+}
+
+func TestObjectStoreRoundTrip(t *testing.T) {
+	store, server := newObjectStore(t, 1000)
+	ctx := context.Background()
+	require.NoError(t, store.EnsureSchema(ctx))
+
+	content := make([]byte, 2500)
+	_, _ = rand.Read(content)
+
+	info, err := store.PutObject(ctx, "artifacts/build.tar", bytes.NewReader(content))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2500), info.Size)
+	assert.Equal(t, 3, info.Chunks)
+	assert.Len(t, server.chunks, 3)
+
+	var out bytes.Buffer
+	got, err := store.GetObject(ctx, "artifacts/build.tar", &out)
+	require.NoError(t, err)
+	assert.Equal(t, content, out.Bytes())
+	assert.Equal(t, info.SHA256, got.SHA256)
+
+	// Replacing the object removes the previous version's parts
+	_, err = store.PutObject(ctx, "artifacts/build.tar", strings.NewReader("small"))
+	require.NoError(t, err)
+	assert.Len(t, server.chunks, 1)
+	out.Reset()
+	_, err = store.GetObject(ctx, "artifacts/build.tar", &out)
+	require.NoError(t, err)
+	assert.Equal(t, "small", out.String())
+
+	require.NoError(t, store.DeleteObject(ctx, "artifacts/build.tar"))
+	assert.Empty(t, server.chunks)
+	_, err = store.Stat(ctx, "artifacts/build.tar")
+	assert.True(t, errors.Is(err, workersql.ErrNoRows))
+}
+
+func TestObjectStoreFailedPutKeepsPreviousVersion(t *testing.T) {
+	store, server := newObjectStore(t, 4)
+	ctx := context.Background()
+
+	_, err := store.PutObject(ctx, "k", strings.NewReader("original"))
+	require.NoError(t, err)
+
+	server.failPart = 1
+	_, err = store.PutObject(ctx, "k", strings.NewReader("replacement"))
+	require.Error(t, err)
+	assert.Len(t, server.chunks, 2, "parts of the failed upload are removed")
+
+	var out bytes.Buffer
+	_, err = store.GetObject(ctx, "k", &out)
+	require.NoError(t, err)
+	assert.Equal(t, "original", out.String())
+}
+
+func TestObjectStoreDetectsCorruption(t *testing.T) {
+	store, server := newObjectStore(t, 4)
+	ctx := context.Background()
+
+	_, err := store.PutObject(ctx, "k", strings.NewReader("abcdefgh"))
+	require.NoError(t, err)
+	for k := range server.chunks {
+		if strings.HasSuffix(k, "/1") {
+			server.chunks[k] = "WFhYWA==" // "XXXX"
+		}
+	}
+
+	_, err = store.GetObject(ctx, "k", &bytes.Buffer{})
+	assert.True(t, errors.Is(err, workersql.ErrObjectCorrupt))
+}
@@ -0,0 +1,228 @@
+package workersql_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// offlineDriver is a database/sql driver standing in for SQLite: queries
+// return the users table, other statements are recorded. While locked is
+// positive, statements fail as on a locked database file, each failure
+// counting it down.
+type offlineDriver struct {
+	mu     sync.Mutex
+	execs  []string
+	locked int
+}
+
+var testOfflineDriver = &offlineDriver{}
+
+func init() {
+	sql.Register("workersql-offline-test", testOfflineDriver)
+}
+
+func (d *offlineDriver) Open(string) (driver.Conn, error) { return offlineConn{d}, nil }
+
+func (d *offlineDriver) lock(failures int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.locked = failures
+}
+
+func (d *offlineDriver) executed() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.execs...)
+}
+
+type offlineConn struct{ d *offlineDriver }
+
+func (c offlineConn) Prepare(query string) (driver.Stmt, error) {
+	return offlineStmt{d: c.d, query: query}, nil
+}
+func (c offlineConn) Close() error              { return nil }
+func (c offlineConn) Begin() (driver.Tx, error) { return nil, errors.New("no transactions") }
+
+type offlineStmt struct {
+	d     *offlineDriver
+	query string
+}
+
+func (s offlineStmt) Close() error  { return nil }
+func (s offlineStmt) NumInput() int { return -1 }
+
+func (s offlineStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if s.query == "INSERT INTO missing VALUES (?)" {
+		return nil, errors.New("no such table: missing")
+	}
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	if s.d.locked > 0 {
+		s.d.locked--
+		return nil, errors.New("database is locked")
+	}
+	s.d.execs = append(s.d.execs, s.query)
+	return driver.RowsAffected(1), nil
+}
+
+func (s offlineStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &offlineRows{rows: [][]driver.Value{{int64(1), []byte("ada")}, {int64(2), []byte("grace")}}}, nil
+}
+
+type offlineRows struct {
+	rows [][]driver.Value
+}
+
+func (r *offlineRows) Columns() []string { return []string{"id", "name"} }
+func (r *offlineRows) Close() error      { return nil }
+func (r *offlineRows) ColumnTypeDatabaseTypeName(i int) string {
+	return []string{"INTEGER", "TEXT"}[i]
+}
+
+func (r *offlineRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// unreachableEndpoint returns an endpoint nothing listens on
+func unreachableEndpoint(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	return "http://" + listener.Addr().String()
+}
+
+func TestOfflineFallbackServesReads(t *testing.T) {
+	db, err := sql.Open("workersql-offline-test", "")
+	require.NoError(t, err)
+	defer db.Close()
+
+	var outages []error
+	client, err := workersql.NewClient(workersql.Config{
+		APIEndpoint:   unreachableEndpoint(t),
+		RetryAttempts: 1,
+		OfflineFallback: &workersql.OfflineConfig{
+			DB:        db,
+			Schema:    []string{"CREATE TABLE IF NOT EXISTS users (id INTEGER PRIMARY KEY, name TEXT)"},
+			OnOffline: func(err error) { outages = append(outages, err) },
+		},
+	})
+	require.NoError(t, err)
+	defer client.Close()
+	ctx := context.Background()
+
+	resp, err := client.Query(ctx, "SELECT id, name FROM users")
+	require.NoError(t, err)
+	assert.True(t, resp.Offline)
+	assert.True(t, resp.Success)
+	require.Len(t, resp.Data, 2)
+	assert.Equal(t, int64(1), resp.Data[0]["id"])
+	assert.Equal(t, "ada", resp.Data[0]["name"])
+	assert.Equal(t, "TEXT", resp.Columns[1].DatabaseType)
+
+	_, err = client.Query(ctx, "SELECT id, name FROM users")
+	require.NoError(t, err)
+	assert.Len(t, outages, 1, "OnOffline is called once per outage")
+	assert.Equal(t, []string{"CREATE TABLE IF NOT EXISTS users (id INTEGER PRIMARY KEY, name TEXT)"}, testOfflineDriver.executed()[:1])
+
+	// Writes aren't run offline unless allowed
+	_, err = client.Exec(ctx, "UPDATE users SET name = ? WHERE id = ?", "ada", 1)
+	assert.Error(t, err)
+}
+
+func TestOfflineFallbackRetriesFailedSchema(t *testing.T) {
+	db, err := sql.Open("workersql-offline-test", "")
+	require.NoError(t, err)
+	defer db.Close()
+
+	schema := "CREATE TABLE IF NOT EXISTS orders (id INTEGER PRIMARY KEY)"
+	client, err := workersql.NewClient(workersql.Config{
+		APIEndpoint:     unreachableEndpoint(t),
+		RetryAttempts:   1,
+		OfflineFallback: &workersql.OfflineConfig{DB: db, Schema: []string{schema}},
+	})
+	require.NoError(t, err)
+	defer client.Close()
+	ctx := context.Background()
+
+	testOfflineDriver.lock(1)
+	resp, err := client.Query(ctx, "SELECT id, name FROM users")
+	require.NoError(t, err)
+	assert.False(t, resp.Success)
+	assert.Contains(t, resp.Error.Message, "database is locked")
+	assert.NotContains(t, testOfflineDriver.executed(), schema)
+
+	// The schema runs again on the next statement, and only until it succeeds
+	for i := 0; i < 2; i++ {
+		resp, err = client.Query(ctx, "SELECT id, name FROM users")
+		require.NoError(t, err)
+		assert.True(t, resp.Success)
+	}
+	executed := 0
+	for _, stmt := range testOfflineDriver.executed() {
+		if stmt == schema {
+			executed++
+		}
+	}
+	assert.Equal(t, 1, executed)
+}
+
+func TestOfflineFallbackWrites(t *testing.T) {
+	db, err := sql.Open("workersql-offline-test", "")
+	require.NoError(t, err)
+	defer db.Close()
+
+	client, err := workersql.NewClient(workersql.Config{
+		APIEndpoint:     unreachableEndpoint(t),
+		RetryAttempts:   1,
+		OfflineFallback: &workersql.OfflineConfig{DB: db, AllowWrites: true},
+	})
+	require.NoError(t, err)
+	defer client.Close()
+	ctx := context.Background()
+
+	res, err := client.Exec(ctx, "UPDATE users SET name = ? WHERE id = ?", "lovelace", 1)
+	require.NoError(t, err)
+	assert.True(t, res.Offline)
+	assert.Equal(t, int64(1), res.AffectedRows)
+	assert.Contains(t, testOfflineDriver.executed(), "UPDATE users SET name = ? WHERE id = ?")
+
+	// Failing statements are unsuccessful responses, like the gateway's
+	res, err = client.Exec(ctx, "INSERT INTO missing VALUES (?)", 1)
+	require.NoError(t, err)
+	assert.False(t, res.Success)
+	assert.Equal(t, "OFFLINE_ERROR", res.Error.Code)
+}
+
+func TestOfflineFallbackIgnoresGatewayErrors(t *testing.T) {
+	db, err := sql.Open("workersql-offline-test", "")
+	require.NoError(t, err)
+	defer db.Close()
+
+	srv, _ := newFlakyServer(t, 100, 500)
+	client, err := workersql.NewClient(workersql.Config{
+		APIEndpoint:     srv.URL,
+		RetryAttempts:   1,
+		OfflineFallback: &workersql.OfflineConfig{DB: db},
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	// The gateway answered, so its error stands
+	_, err = client.Query(context.Background(), "SELECT id, name FROM users")
+	assert.Error(t, err)
+}
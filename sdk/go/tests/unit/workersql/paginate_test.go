@@ -0,0 +1,93 @@
+package workersql_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func pageIDs(page *workersql.Page) []int64 {
+	ids := make([]int64, len(page.Data))
+	for i, row := range page.Data {
+		ids[i] = row["id"].(int64)
+	}
+	return ids
+}
+
+func TestPaginate(t *testing.T) {
+	server := &exportServer{rows: 5}
+	client := newExportClient(t, server)
+	ctx := context.Background()
+
+	p := client.Paginate("SELECT id, email FROM users;", workersql.PageOptions{Size: 2})
+
+	var pages [][]int64
+	var cursors []string
+	for p.More() {
+		page, err := p.Next(ctx)
+		require.NoError(t, err)
+		pages = append(pages, pageIDs(page))
+		cursors = append(cursors, page.Cursor)
+	}
+	assert.Equal(t, [][]int64{{1, 2}, {3, 4}, {5}}, pages)
+	assert.NotEmpty(t, cursors[0])
+	assert.Empty(t, cursors[2])
+
+	_, err := p.Next(ctx)
+	assert.ErrorIs(t, err, workersql.ErrNoMorePages)
+
+	server.mu.Lock()
+	assert.Equal(t, "SELECT * FROM (SELECT id, email FROM users) AS page_source ORDER BY `id` LIMIT 3", server.queries[0])
+	assert.Equal(t, "SELECT * FROM (SELECT id, email FROM users) AS page_source WHERE `id` > ? ORDER BY `id` LIMIT 3", server.queries[1])
+	server.mu.Unlock()
+
+	// A cursor carried through a URL resumes with a fresh paginator
+	resumed := client.Paginate("SELECT id, email FROM users", workersql.PageOptions{Size: 2, Cursor: cursors[0]})
+	page, err := resumed.Next(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{3, 4}, pageIDs(page))
+	assert.Equal(t, cursors[1], page.Cursor)
+}
+
+func TestPaginateDescendingCompositeKey(t *testing.T) {
+	client, server := newMapperClient(t, map[string]string{
+		"SELECT": `{"success": true, "data": [{"tenant_id": "b", "user_id": 2}, {"tenant_id": "b", "user_id": 1}, {"tenant_id": "a", "user_id": 9}]}`,
+	})
+	ctx := context.Background()
+	opts := workersql.PageOptions{Size: 2, OrderBy: []string{"tenant_id", "user_id"}, Descending: true, Params: []interface{}{"x"}}
+
+	page, err := client.Paginate("SELECT * FROM memberships WHERE role = ?", opts).Next(ctx)
+	require.NoError(t, err)
+	assert.Len(t, page.Data, 2)
+	require.NotEmpty(t, page.Cursor)
+
+	opts.Cursor = page.Cursor
+	_, err = client.Paginate("SELECT * FROM memberships WHERE role = ?", opts).Next(ctx)
+	require.NoError(t, err)
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	require.Len(t, server.received, 2)
+	assert.Equal(t, "SELECT * FROM (SELECT * FROM memberships WHERE role = ?) AS page_source ORDER BY `tenant_id` DESC, `user_id` DESC LIMIT 3", server.received[0].SQL)
+	assert.Equal(t, "SELECT * FROM (SELECT * FROM memberships WHERE role = ?) AS page_source WHERE (`tenant_id`, `user_id`) < (?, ?) ORDER BY `tenant_id` DESC, `user_id` DESC LIMIT 3", server.received[1].SQL)
+	assert.Equal(t, []interface{}{"x", "b", float64(1)}, server.received[1].Params)
+}
+
+func TestPaginateInvalidCursor(t *testing.T) {
+	client := newExportClient(t, &exportServer{rows: 5})
+	ctx := context.Background()
+
+	_, err := client.Paginate("SELECT * FROM users", workersql.PageOptions{Cursor: "not a cursor"}).Next(ctx)
+	assert.True(t, errors.Is(err, workersql.ErrInvalidCursor))
+
+	page, err := client.Paginate("SELECT * FROM users", workersql.PageOptions{Size: 2}).Next(ctx)
+	require.NoError(t, err)
+
+	// Cursors are bound to the ordering they were issued for
+	_, err = client.Paginate("SELECT * FROM users", workersql.PageOptions{Size: 2, Descending: true, Cursor: page.Cursor}).Next(ctx)
+	assert.ErrorIs(t, err, workersql.ErrInvalidCursor)
+}
@@ -0,0 +1,139 @@
+package workersql_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	gws "github.com/gorilla/websocket"
+	"github.com/healthfees-org/workersql/sdk/go/internal/websocket"
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pipelineServer answers pipeline frames with one result per statement,
+// stopping at the first statement containing "FAIL"
+type pipelineServer struct {
+	mu     sync.Mutex
+	frames []websocket.Message
+}
+
+func (s *pipelineServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := (&gws.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	for {
+		var msg websocket.Message
+		if err := conn.ReadJSON(&msg); err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.frames = append(s.frames, msg)
+		s.mu.Unlock()
+
+		reply := websocket.Message{Type: websocket.FrameResponse, ID: msg.ID}
+		switch msg.Type {
+		case websocket.FrameBegin:
+			reply.Data = map[string]interface{}{"transactionId": "tx_1"}
+		case websocket.FramePipeline:
+			var results []map[string]interface{}
+			for i, stmt := range msg.Statements {
+				if strings.Contains(stmt.SQL, "FAIL") {
+					results = append(results, map[string]interface{}{
+						"success": false,
+						"error":   map[string]interface{}{"code": "INVALID_QUERY", "message": "no such table"},
+					})
+					break
+				}
+				if stmt.Mode == "exec" {
+					results = append(results, map[string]interface{}{"success": true, "affectedRows": 1, "lastInsertId": 10 + i})
+				} else {
+					results = append(results, map[string]interface{}{"success": true, "data": []interface{}{map[string]interface{}{"n": i}}})
+				}
+			}
+			reply.Data = map[string]interface{}{"results": results}
+		default:
+			reply.Data = map[string]interface{}{"success": true}
+		}
+		if err := conn.WriteJSON(reply); err != nil {
+			return
+		}
+	}
+}
+
+func newPipelineTx(t *testing.T) (*workersql.TransactionClient, *pipelineServer) {
+	server := &pipelineServer{}
+	srv := httptest.NewServer(server)
+	t.Cleanup(srv.Close)
+
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL})
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+
+	tx, err := client.BeginTx(context.Background())
+	require.NoError(t, err)
+	return tx, server
+}
+
+func TestPipelineFlush(t *testing.T) {
+	ctx := context.Background()
+	tx, server := newPipelineTx(t)
+
+	p := tx.Pipeline()
+	insert := p.Exec("INSERT INTO users (name) VALUES (?)", "ada")
+	p.Exec("UPDATE counters SET n = n + 1 WHERE id IN (?)", []int{1, 2})
+	query := p.Query("SELECT COUNT(*) AS n FROM users")
+	assert.Equal(t, 3, p.Len())
+
+	results, err := p.Flush(ctx)
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	assert.Equal(t, int64(10), results[insert].LastInsertID)
+	assert.Len(t, results[query].Data, 1)
+	assert.Equal(t, 0, p.Len(), "flush empties the pipeline")
+	require.NoError(t, tx.Commit(ctx))
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	var pipelines []websocket.Message
+	for _, f := range server.frames {
+		if f.Type == websocket.FramePipeline {
+			pipelines = append(pipelines, f)
+		}
+	}
+	require.Len(t, pipelines, 1, "all statements travel in one frame")
+	assert.Equal(t, "tx_1", pipelines[0].TransactionID)
+	assert.Equal(t, "UPDATE counters SET n = n + 1 WHERE id IN (?, ?)", pipelines[0].Statements[1].SQL)
+	assert.Equal(t, "exec", pipelines[0].Statements[0].Mode)
+	assert.Empty(t, pipelines[0].Statements[2].Mode)
+}
+
+func TestPipelineStatementFailure(t *testing.T) {
+	ctx := context.Background()
+	tx, _ := newPipelineTx(t)
+
+	p := tx.Pipeline()
+	p.Exec("INSERT INTO users (name) VALUES ('ada')")
+	p.Exec("INSERT INTO FAIL VALUES (1)")
+	p.Exec("INSERT INTO users (name) VALUES ('bob')")
+
+	results, err := p.Flush(ctx)
+	var pipeErr *workersql.PipelineError
+	require.True(t, errors.As(err, &pipeErr))
+	assert.Equal(t, 1, pipeErr.Index)
+	assert.Contains(t, err.Error(), "no such table")
+	require.Len(t, results, 2)
+	assert.False(t, results[1].Success)
+
+	require.NoError(t, tx.Rollback(ctx))
+	_, err = tx.Pipeline().Flush(ctx)
+	assert.ErrorIs(t, err, workersql.ErrTxDone)
+}
@@ -0,0 +1,116 @@
+package workersql_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+)
+
+// probeGateway answers /health while healthy is set and fails queries
+// while failing is set
+type probeGateway struct {
+	healthy      int32
+	failing      int32
+	healthChecks int32
+}
+
+func (g *probeGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/health" {
+		atomic.AddInt32(&g.healthChecks, 1)
+		if atomic.LoadInt32(&g.healthy) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"status": "healthy"})
+		return
+	}
+	success := atomic.LoadInt32(&g.failing) == 0
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"success": success, "data": []interface{}{}})
+}
+
+func probe(t *testing.T, handler http.Handler) (int, workersql.ProbeResult) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	var result workersql.ProbeResult
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&result))
+	return rec.Code, result
+}
+
+func newProbeClient(t *testing.T, config *workersql.ProbeConfig) (*workersql.Client, *probeGateway) {
+	t.Helper()
+	g := &probeGateway{healthy: 1}
+	server := httptest.NewServer(g)
+	t.Cleanup(server.Close)
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: server.URL, RetryAttempts: 1, Probes: config})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+	return client, g
+}
+
+func TestReadinessHandler(t *testing.T) {
+	client, g := newProbeClient(t, &workersql.ProbeConfig{HealthCheckMaxAge: time.Hour})
+	ready := client.ReadinessHandler()
+
+	code, result := probe(t, ready)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok", result.Status)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&g.healthChecks))
+
+	// A recent successful check isn't repeated
+	code, _ = probe(t, ready)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&g.healthChecks))
+
+	// Too many failed statements
+	atomic.StoreInt32(&g.failing, 1)
+	for i := 0; i < 10; i++ {
+		_, _ = client.Query(context.Background(), "SELECT 1")
+	}
+	code, result = probe(t, ready)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "unavailable", result.Status)
+	assert.False(t, result.Checks["errors"].OK)
+	assert.Equal(t, "10 of 10 statements failed", result.Checks["errors"].Message)
+	assert.True(t, result.Checks["health"].OK)
+
+	code, result = probe(t, client.LivenessHandler())
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, result.Checks["client"].OK)
+}
+
+func TestReadinessHealthCheck(t *testing.T) {
+	client, g := newProbeClient(t, &workersql.ProbeConfig{HealthCheckMaxAge: time.Millisecond})
+	ready := client.ReadinessHandler()
+
+	atomic.StoreInt32(&g.healthy, 0)
+	code, result := probe(t, ready)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.False(t, result.Checks["health"].OK)
+
+	atomic.StoreInt32(&g.healthy, 1)
+	code, _ = probe(t, ready)
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestProbesAfterShutdown(t *testing.T) {
+	client, _ := newProbeClient(t, nil)
+	require.NoError(t, client.Shutdown(context.Background()))
+
+	code, result := probe(t, client.ReadinessHandler())
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "shutting down", result.Checks["lifecycle"].Message)
+
+	code, result = probe(t, client.LivenessHandler())
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "client closed", result.Checks["client"].Message)
+}
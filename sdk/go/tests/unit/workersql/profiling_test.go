@@ -0,0 +1,75 @@
+package workersql_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"runtime/pprof"
+	"runtime/trace"
+	"testing"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFingerprint(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want string
+	}{
+		{"SELECT * FROM users WHERE id = 42", "SELECT * FROM users WHERE id = ?"},
+		{"SELECT *\n  FROM users\tWHERE name = 'O''Brien'", "SELECT * FROM users WHERE name = ?"},
+		{"SELECT * FROM t1 WHERE id IN (?, ?, ?)", "SELECT * FROM t1 WHERE id IN (?+)"},
+		{"SELECT * FROM t1 WHERE id IN (1, 2)", "SELECT * FROM t1 WHERE id IN (?+)"},
+		{"UPDATE accounts SET balance = 1.5e3 WHERE id = ?", "UPDATE accounts SET balance = ? WHERE id = ?"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, workersql.Fingerprint(tt.sql), tt.sql)
+	}
+}
+
+func TestQueryEmitsTraceRegion(t *testing.T) {
+	client, _ := newMapperClient(t, map[string]string{"SELECT": `{"success": true, "data": [{"id": 1}]}`})
+
+	var buf bytes.Buffer
+	require.NoError(t, trace.Start(&buf))
+	_, err := client.Query(context.Background(), "SELECT * FROM users WHERE id = ?", 1)
+	trace.Stop()
+	require.NoError(t, err)
+
+	assert.Contains(t, buf.String(), "workersql.Query")
+	assert.Contains(t, buf.String(), "SELECT * FROM users WHERE id = ?")
+}
+
+func TestProfilingLabels(t *testing.T) {
+	entered, unblock := make(chan struct{}), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-unblock
+		_, _ = w.Write([]byte(`{"success": true, "data": [{"id": 1}]}`))
+	}))
+	defer srv.Close()
+
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL, RetryAttempts: 1, ProfilingLabels: true})
+	require.NoError(t, err)
+	defer client.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.Query(context.Background(), "SELECT * FROM `users` WHERE id = 7")
+		done <- err
+	}()
+
+	// The goroutine blocked in the request carries the labels
+	<-entered
+	var profile bytes.Buffer
+	require.NoError(t, pprof.Lookup("goroutine").WriteTo(&profile, 1))
+	close(unblock)
+	require.NoError(t, <-done)
+
+	assert.Contains(t, profile.String(), `"workersql.op":"Query"`)
+	assert.Contains(t, profile.String(), `"workersql.table":"users"`)
+	assert.Contains(t, profile.String(), "\"workersql.query\":\"SELECT * FROM `users` WHERE id = ?\"")
+}
@@ -0,0 +1,96 @@
+package workersql_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryWithOptionsSerializesOverrides(t *testing.T) {
+	var (
+		body    map[string]interface{}
+		headers http.Header
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header.Clone()
+		body = nil
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		_, _ = w.Write([]byte(`{"success": true, "data": [{"id": 1}]}`))
+	}))
+	defer srv.Close()
+
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL, RetryAttempts: 1})
+	require.NoError(t, err)
+	defer client.Close()
+
+	resp, err := client.QueryWithOptions(context.Background(), "SELECT * FROM users WHERE id = ?", []interface{}{1},
+		workersql.QueryOptions{
+			Timeout:     2 * time.Second,
+			Priority:    workersql.PriorityHigh,
+			Consistency: workersql.ConsistencyStrong,
+			Cache:       workersql.CacheHint{TTL: 30 * time.Second},
+		})
+	require.NoError(t, err)
+	assert.Len(t, resp.Data, 1)
+
+	assert.Equal(t, "SELECT * FROM users WHERE id = ?", body["sql"])
+	assert.Equal(t, map[string]interface{}{"consistency": "strong"}, body["hints"])
+	assert.EqualValues(t, 2000, body["timeoutMs"])
+	assert.Equal(t, "high", body["priority"])
+	assert.Equal(t, map[string]interface{}{"ttlMs": float64(30000)}, body["cache"])
+	assert.Equal(t, "max-age=30", headers.Get("Cache-Control"))
+	assert.Equal(t, "high", headers.Get("X-WorkerSQL-Priority"))
+
+	_, err = client.QueryWithOptions(context.Background(), "SELECT 1", nil,
+		workersql.QueryOptions{Cache: workersql.CacheHint{Bypass: true}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"bypass": true}, body["cache"])
+	assert.NotContains(t, body, "hints")
+	assert.NotContains(t, body, "priority")
+	assert.Equal(t, "no-cache", headers.Get("Cache-Control"))
+	assert.Empty(t, headers.Get("X-WorkerSQL-Priority"))
+
+	_, err = client.Query(context.Background(), "SELECT 1")
+	require.NoError(t, err)
+	assert.NotContains(t, body, "cache", "plain queries keep the client defaults")
+	assert.Empty(t, headers.Get("Cache-Control"))
+}
+
+func TestQueryWithOptionsTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+		_, _ = w.Write([]byte(`{"success": true}`))
+	}))
+	defer srv.Close()
+
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL, RetryAttempts: 1})
+	require.NoError(t, err)
+	defer client.Close()
+
+	start := time.Now()
+	_, err = client.QueryWithOptions(context.Background(), "SELECT 1", nil, workersql.QueryOptions{Timeout: 50 * time.Millisecond})
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestQueryWithOptionsRejectsInvalidOptions(t *testing.T) {
+	client, server := newMapperClient(t, nil)
+
+	_, err := client.QueryWithOptions(context.Background(), "SELECT 1", nil, workersql.QueryOptions{Consistency: "eventual"})
+	assert.Error(t, err)
+	_, err = client.QueryWithOptions(context.Background(), "SELECT 1", nil, workersql.QueryOptions{Priority: "urgent"})
+	assert.Error(t, err)
+	assert.Empty(t, server.received, "invalid options are rejected before sending")
+}
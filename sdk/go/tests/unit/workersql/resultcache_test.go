@@ -0,0 +1,318 @@
+package workersql_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingServer answers every /query with a row holding the number of
+// requests served so far, and cacheControl as its Cache-Control header
+type countingServer struct {
+	mu           sync.Mutex
+	count        int
+	delay        time.Duration
+	cacheControl string
+}
+
+func (s *countingServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	delay := s.delay
+	s.mu.Unlock()
+	time.Sleep(delay)
+
+	s.mu.Lock()
+	s.count++
+	n := s.count
+	if s.cacheControl != "" {
+		w.Header().Set("Cache-Control", s.cacheControl)
+	}
+	s.mu.Unlock()
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": []map[string]interface{}{{"n": n}}})
+}
+
+func (s *countingServer) requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count
+}
+
+func newResultCacheClient(t *testing.T, config workersql.ResultCacheConfig) (*workersql.Client, *countingServer) {
+	server := &countingServer{}
+	srv := httptest.NewServer(server)
+	t.Cleanup(srv.Close)
+
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL, RetryAttempts: 1, ResultCache: &config})
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client, server
+}
+
+func queryN(t *testing.T, client *workersql.Client, ctx context.Context, sql string, params ...interface{}) string {
+	t.Helper()
+	row, err := client.QueryRow(ctx, sql, params...)
+	require.NoError(t, err)
+	return fmt.Sprint(row["n"])
+}
+
+func TestResultCacheServesRepeatedQueries(t *testing.T) {
+	client, server := newResultCacheClient(t, workersql.ResultCacheConfig{TTL: time.Minute})
+	ctx := context.Background()
+
+	assert.Equal(t, "1", queryN(t, client, ctx, "SELECT * FROM users WHERE id = ?", 1))
+	assert.Equal(t, "1", queryN(t, client, ctx, "SELECT *\n  FROM users   WHERE id = ?", 1), "whitespace is normalized")
+	assert.Equal(t, "2", queryN(t, client, ctx, "SELECT * FROM users WHERE id = ?", 2), "params are part of the key")
+	assert.Equal(t, 2, server.requests())
+
+	bypass := workersql.WithCacheHint(ctx, workersql.CacheBypass())
+	assert.Equal(t, "3", queryN(t, client, bypass, "SELECT * FROM users WHERE id = ?", 1))
+
+	stats := client.ResultCacheStats()
+	assert.EqualValues(t, 1, stats.Hits)
+	assert.EqualValues(t, 2, stats.Misses)
+	assert.Equal(t, 2, stats.Entries)
+}
+
+func TestResultCacheInvalidatesOnWrites(t *testing.T) {
+	client, server := newResultCacheClient(t, workersql.ResultCacheConfig{TTL: time.Minute})
+	ctx := context.Background()
+
+	queryN(t, client, ctx, "SELECT * FROM users")
+	queryN(t, client, ctx, "SELECT * FROM orders")
+
+	_, err := client.Exec(ctx, "UPDATE users SET name = ? WHERE id = ?", "x", 1)
+	require.NoError(t, err)
+	assert.Equal(t, 3, server.requests())
+
+	assert.Equal(t, "4", queryN(t, client, ctx, "SELECT * FROM users"), "results of written tables are dropped")
+	assert.Equal(t, "2", queryN(t, client, ctx, "SELECT * FROM orders"), "other tables stay cached")
+
+	client.InvalidateSchema("orders")
+	assert.Equal(t, "5", queryN(t, client, ctx, "SELECT * FROM orders"))
+}
+
+func TestResultCacheSkipsLockingReadsAndWrites(t *testing.T) {
+	client, server := newResultCacheClient(t, workersql.ResultCacheConfig{TTL: time.Minute})
+	ctx := context.Background()
+
+	for _, sql := range []string{
+		"SELECT * FROM users WHERE id = 1 for\n  update",
+		"SELECT * FROM accounts WHERE id = 1 FOR SHARE",
+		"SELECT * FROM accounts WHERE id = 1 LOCK IN SHARE MODE",
+		"WITH old AS (SELECT id FROM users WHERE active = 0) DELETE FROM users WHERE id IN (SELECT id FROM old)",
+		"WITH RECURSIVE t(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM t WHERE n < 3) UPDATE counters SET n = (SELECT MAX(n) FROM t)",
+	} {
+		before := server.requests()
+		queryN(t, client, ctx, sql)
+		queryN(t, client, ctx, sql)
+		assert.Equal(t, before+2, server.requests(), sql)
+	}
+
+	cte := "WITH recent AS (SELECT * FROM orders WHERE note = 'delete me') SELECT * FROM recent"
+	before := server.requests()
+	queryN(t, client, ctx, cte)
+	queryN(t, client, ctx, cte)
+	assert.Equal(t, before+1, server.requests(), "a WITH ... SELECT is cached")
+}
+
+func TestResultCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	client, server := newResultCacheClient(t, workersql.ResultCacheConfig{TTL: time.Minute, MaxEntries: 2})
+	ctx := context.Background()
+
+	queryN(t, client, ctx, "SELECT 1 FROM a")
+	queryN(t, client, ctx, "SELECT 1 FROM b")
+	queryN(t, client, ctx, "SELECT 1 FROM a")
+	queryN(t, client, ctx, "SELECT 1 FROM c")
+	assert.Equal(t, 3, server.requests())
+
+	queryN(t, client, ctx, "SELECT 1 FROM a")
+	assert.Equal(t, 3, server.requests(), "a was used recently and stays cached")
+	queryN(t, client, ctx, "SELECT 1 FROM b")
+	assert.Equal(t, 4, server.requests(), "b was evicted")
+	assert.EqualValues(t, 2, client.ResultCacheStats().Evictions)
+}
+
+func TestResultCacheStaleWhileRevalidate(t *testing.T) {
+	client, server := newResultCacheClient(t, workersql.ResultCacheConfig{
+		TTL:                  100 * time.Millisecond,
+		StaleWhileRevalidate: time.Minute,
+	})
+	ctx := context.Background()
+
+	assert.Equal(t, "1", queryN(t, client, ctx, "SELECT * FROM stats"))
+	time.Sleep(120 * time.Millisecond)
+
+	server.mu.Lock()
+	server.delay = 50 * time.Millisecond
+	server.mu.Unlock()
+	assert.Equal(t, "1", queryN(t, client, ctx, "SELECT * FROM stats"), "the stale result is served at once")
+	assert.Equal(t, "1", queryN(t, client, ctx, "SELECT * FROM stats"))
+
+	require.Eventually(t, func() bool {
+		return queryN(t, client, ctx, "SELECT * FROM stats") == "2"
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 2, server.requests(), "a single background refresh ran")
+	assert.GreaterOrEqual(t, client.ResultCacheStats().StaleHits, int64(2))
+}
+
+func TestStaleWhileRevalidateReadMode(t *testing.T) {
+	client, server := newResultCacheClient(t, workersql.ResultCacheConfig{TTL: 50 * time.Millisecond})
+	ctx := context.Background()
+
+	assert.Equal(t, "1", queryN(t, client, ctx, "SELECT * FROM stats"))
+	time.Sleep(80 * time.Millisecond)
+
+	server.mu.Lock()
+	server.delay = 50 * time.Millisecond
+	server.mu.Unlock()
+	fresh := make(chan *workersql.QueryResponse, 2)
+	swr := workersql.WithStaleWhileRevalidate(ctx, func(resp *workersql.QueryResponse, err error) {
+		assert.NoError(t, err)
+		fresh <- resp
+	})
+	for i := 0; i < 2; i++ {
+		resp, err := client.Query(swr, "SELECT * FROM stats")
+		require.NoError(t, err)
+		assert.True(t, resp.Stale, "the expired result is served at once")
+		assert.Equal(t, "1", fmt.Sprint(resp.Data[0]["n"]))
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case resp := <-fresh:
+			assert.Equal(t, "2", fmt.Sprint(resp.Data[0]["n"]))
+			assert.False(t, resp.Stale)
+		case <-time.After(2 * time.Second):
+			t.Fatal("onFresh was not called")
+		}
+	}
+	assert.Equal(t, 2, server.requests(), "a single background refresh ran")
+
+	resp, err := client.Query(ctx, "SELECT * FROM stats")
+	require.NoError(t, err)
+	assert.False(t, resp.Stale)
+	assert.Equal(t, "2", fmt.Sprint(resp.Data[0]["n"]))
+}
+
+func TestResultCacheReturnsCopies(t *testing.T) {
+	client, _ := newResultCacheClient(t, workersql.ResultCacheConfig{})
+	ctx := context.Background()
+
+	row, err := client.QueryRow(ctx, "SELECT * FROM users")
+	require.NoError(t, err)
+	row["n"] = "modified"
+
+	assert.Equal(t, "1", queryN(t, client, ctx, "SELECT * FROM users"))
+}
+
+func TestResultCacheAdaptiveTTLFollowsReadWriteRatio(t *testing.T) {
+	client, server := newResultCacheClient(t, workersql.ResultCacheConfig{
+		TTL:      5 * time.Millisecond,
+		Adaptive: &workersql.AdaptiveCacheConfig{MinTTL: 5 * time.Millisecond, MaxTTL: time.Hour},
+	})
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		queryN(t, client, ctx, "SELECT * FROM users WHERE id = ?", 1)
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, 10, server.requests(), "the static TTL applies until enough samples are seen")
+	queryN(t, client, ctx, "SELECT * FROM users WHERE id = ?", 1)
+	assert.Equal(t, 10, server.requests(), "a read-only query shape is cached up to MaxTTL")
+
+	first := queryN(t, client, ctx, "SELECT * FROM audit")
+	for i := 0; i < 20; i++ {
+		_, err := client.Exec(ctx, "INSERT INTO audit (event) VALUES (?)", i)
+		require.NoError(t, err)
+	}
+	second := queryN(t, client, ctx, "SELECT * FROM audit")
+	assert.NotEqual(t, first, second)
+	time.Sleep(50 * time.Millisecond)
+	assert.NotEqual(t, second, queryN(t, client, ctx, "SELECT * FROM audit"), "a write-heavy query shape gets a short TTL")
+}
+
+func TestResultCacheAdaptiveTTLUsesServerHints(t *testing.T) {
+	client, server := newResultCacheClient(t, workersql.ResultCacheConfig{
+		TTL:      time.Millisecond,
+		Adaptive: &workersql.AdaptiveCacheConfig{MinTTL: time.Millisecond, MaxTTL: time.Minute},
+	})
+	ctx := context.Background()
+
+	server.mu.Lock()
+	server.cacheControl = "public, max-age=3600"
+	server.mu.Unlock()
+	first := queryN(t, client, ctx, "SELECT * FROM plans")
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, first, queryN(t, client, ctx, "SELECT * FROM plans"), "max-age is used, clamped to MaxTTL")
+
+	server.mu.Lock()
+	server.cacheControl = "no-store"
+	server.mu.Unlock()
+	first = queryN(t, client, ctx, "SELECT * FROM prices")
+	assert.NotEqual(t, first, queryN(t, client, ctx, "SELECT * FROM prices"), "no-store results aren't cached")
+}
+
+func TestNegativeCacheServesEmptyResults(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		var body struct {
+			Params []interface{} `json:"params"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if len(body.Params) > 0 && body.Params[0] == "found" {
+			_, _ = w.Write([]byte(`{"success": true, "data": [{"id": "found"}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"success": true, "data": []}`))
+	}))
+	defer srv.Close()
+
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL, RetryAttempts: 1, NegativeCache: &workersql.NegativeCacheConfig{
+		TTL:     50 * time.Millisecond,
+		Queries: []string{"SELECT * FROM users WHERE id = ?"},
+	}})
+	require.NoError(t, err)
+	defer client.Close()
+	ctx := context.Background()
+	query := func(sql string, params ...interface{}) {
+		t.Helper()
+		_, err := client.Query(ctx, sql, params...)
+		require.NoError(t, err)
+	}
+
+	query("SELECT * FROM users WHERE id = ?", "missing")
+	query("SELECT *  FROM users WHERE id = ?", "missing")
+	assert.EqualValues(t, 1, atomic.LoadInt32(&requests), "empty results of a configured shape are cached")
+
+	query("SELECT * FROM users WHERE id = ?", "found")
+	query("SELECT * FROM users WHERE id = ?", "found")
+	assert.EqualValues(t, 3, atomic.LoadInt32(&requests), "results with rows are not cached without ResultCache")
+
+	query("SELECT * FROM orders WHERE id = ?", "missing")
+	query("SELECT * FROM orders WHERE id = ?", "missing")
+	assert.EqualValues(t, 5, atomic.LoadInt32(&requests), "other shapes are not cached")
+
+	_, err = client.Exec(ctx, "INSERT INTO users (id) VALUES (?)", "missing")
+	require.NoError(t, err)
+	query("SELECT * FROM users WHERE id = ?", "missing")
+	assert.EqualValues(t, 7, atomic.LoadInt32(&requests), "writes to the table drop empty results at once")
+
+	time.Sleep(60 * time.Millisecond)
+	query("SELECT * FROM users WHERE id = ?", "missing")
+	assert.EqualValues(t, 8, atomic.LoadInt32(&requests), "empty results expire after the short TTL")
+
+	stats := client.ResultCacheStats()
+	assert.EqualValues(t, 1, stats.NegativeHits)
+	assert.EqualValues(t, 1, stats.Hits)
+}
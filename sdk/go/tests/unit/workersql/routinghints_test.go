@@ -0,0 +1,54 @@
+package workersql_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoutingHintsPerRequest(t *testing.T) {
+	var (
+		body    map[string]interface{}
+		headers http.Header
+		region  string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header.Clone()
+		body = nil
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("CF-Ray", "8a1b2c3d4e5f6a7b-LHR")
+		if region != "" {
+			w.Header().Set("X-WorkerSQL-Region", region)
+		}
+		_, _ = w.Write([]byte(`{"success": true, "data": []}`))
+	}))
+	defer srv.Close()
+
+	sharding, err := workersql.LoadShardingConfig(configDir + "woocommerce")
+	require.NoError(t, err)
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL, RetryAttempts: 1, Sharding: sharding})
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx := workersql.WithShardKey(workersql.WithRegion(context.Background(), "weur"), "c-1")
+	resp, err := client.Query(ctx, "SELECT * FROM wc_orders WHERE customer_id = ?", "c-2")
+	require.NoError(t, err)
+	assert.Equal(t, "weur", headers.Get("X-WorkerSQL-Region"))
+	assert.Equal(t, "c-1", headers.Get("X-WorkerSQL-Shard-Key"))
+	assert.Equal(t, map[string]interface{}{"shardKey": "c-1"}, body["hints"], "the context key wins over the extracted one")
+	assert.Equal(t, "LHR", resp.Region, "the colo is taken from CF-Ray")
+
+	region = "weur"
+	resp, err = client.Query(context.Background(), "SELECT 1")
+	require.NoError(t, err)
+	assert.Empty(t, headers.Get("X-WorkerSQL-Region"))
+	assert.Empty(t, headers.Get("X-WorkerSQL-Shard-Key"))
+	assert.NotContains(t, body, "hints")
+	assert.Equal(t, "weur", resp.Region, "the gateway's region header wins")
+}
@@ -0,0 +1,61 @@
+package workersql_test
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoutingKeyStatementShapes(t *testing.T) {
+	config, err := workersql.LoadShardingConfigFS(fstest.MapFS{
+		"routing-policy.yaml": {Data: []byte("version: 1\n")},
+		"orders.yaml":         {Data: []byte("shard_by: customer_id\n")},
+		"users.yaml":          {Data: []byte("primary_key: id\n")},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		sql    string
+		params []interface{}
+		key    string
+	}{
+		{"select placeholder", "SELECT * FROM orders WHERE status = ? AND customer_id = ?", []interface{}{"open", 42}, "42"},
+		{"select string", "SELECT * FROM `orders` WHERE `customer_id` = 'c''7'", nil, "c'7"},
+		{"select number", "select id from shop.orders where customer_id=-12 limit 5", nil, "-12"},
+		{"reversed", "SELECT * FROM orders WHERE ? = customer_id", []interface{}{"c-1"}, "c-1"},
+		{"alias", "SELECT o.id FROM orders AS o JOIN users u ON u.id = o.user_id WHERE o.customer_id = ?", []interface{}{7}, "7"},
+		{"single IN", "SELECT * FROM orders WHERE customer_id IN (?)", []interface{}{"c-9"}, "c-9"},
+		{"nested OR", "SELECT * FROM orders WHERE customer_id = ? AND (status = 'a' OR status = 'b') ORDER BY id", []interface{}{5}, "5"},
+		{"placeholders in strings", "SELECT * FROM orders WHERE note = 'why?' AND customer_id = ?", []interface{}{"c-2"}, "c-2"},
+		{"update", "UPDATE orders SET status = ? WHERE customer_id = ? AND id = ?", []interface{}{"paid", "c-3", 1}, "c-3"},
+		{"delete", "DELETE FROM orders WHERE customer_id = 'c-4'", nil, "c-4"},
+		{"insert", "INSERT INTO orders (id, customer_id, total) VALUES (?, ?, ?)", []interface{}{1, "c-5", 10}, "c-5"},
+		{"insert rows sharing the key", "INSERT INTO orders (customer_id, id) VALUES ('c-6', 1), ('c-6', 2)", nil, "c-6"},
+
+		{"top-level OR", "SELECT * FROM orders WHERE customer_id = ? OR status = ?", []interface{}{1, "open"}, ""},
+		{"range", "SELECT * FROM orders WHERE customer_id > ?", []interface{}{1}, ""},
+		{"IN list", "SELECT * FROM orders WHERE customer_id IN (?, ?)", []interface{}{1, 2}, ""},
+		{"other table's column", "SELECT * FROM orders o JOIN users u ON u.id = o.user_id WHERE u.customer_id = ?", []interface{}{1}, ""},
+		{"function of the key", "SELECT * FROM orders WHERE LOWER(customer_id) = ?", []interface{}{"c"}, ""},
+		{"conflicting values", "SELECT * FROM orders WHERE customer_id = 1 AND customer_id = 2", nil, ""},
+		{"NULL param", "SELECT * FROM orders WHERE customer_id = ?", []interface{}{nil}, ""},
+		{"insert rows with different keys", "INSERT INTO orders (customer_id, id) VALUES ('c-6', 1), ('c-7', 2)", nil, ""},
+		{"insert computed key", "INSERT INTO orders (customer_id) VALUES (CONCAT('c', ?))", []interface{}{1}, ""},
+		{"subquery table", "SELECT * FROM users WHERE id IN (SELECT user_id FROM orders WHERE customer_id = 1)", nil, ""},
+		{"unsharded table", "SELECT * FROM users WHERE id = 1", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, key, ok := config.RoutingKey(tt.sql, tt.params...)
+			assert.Equal(t, tt.key != "", ok)
+			assert.Equal(t, tt.key, key)
+		})
+	}
+
+	table, _, _ := config.RoutingKey("UPDATE `Orders` SET status = 'x'")
+	assert.Equal(t, "orders", table)
+}
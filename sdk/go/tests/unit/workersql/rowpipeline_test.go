@@ -0,0 +1,177 @@
+package workersql_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingSource emits n rows {"id": 1..n}, recording how far it got
+func countingSource(n int, emitted *int64) workersql.RowSource {
+	return func(ctx context.Context, emit func(row map[string]interface{}) error) error {
+		for i := 1; i <= n; i++ {
+			if err := emit(map[string]interface{}{"id": i}); err != nil {
+				return err
+			}
+			if emitted != nil {
+				atomic.AddInt64(emitted, 1)
+			}
+		}
+		return nil
+	}
+}
+
+// collectSink records the batches it receives
+type collectSink struct {
+	mu      sync.Mutex
+	batches [][]map[string]interface{}
+}
+
+func (s *collectSink) WriteRows(_ context.Context, rows []map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches = append(s.batches, rows)
+	return nil
+}
+
+func (s *collectSink) ids() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ids []int
+	for _, batch := range s.batches {
+		for _, row := range batch {
+			ids = append(ids, row["id"].(int))
+		}
+	}
+	return ids
+}
+
+func TestRowPipelineStages(t *testing.T) {
+	var inFlight, maxInFlight int64
+	sink := &collectSink{}
+	result, err := workersql.NewRowPipeline(countingSource(20, nil)).
+		Filter(func(row map[string]interface{}) bool { return row["id"].(int)%5 != 0 }).
+		Map(4, func(_ context.Context, row map[string]interface{}) (map[string]interface{}, error) {
+			n := atomic.AddInt64(&inFlight, 1)
+			defer atomic.AddInt64(&inFlight, -1)
+			for {
+				max := atomic.LoadInt64(&maxInFlight)
+				if n <= max || atomic.CompareAndSwapInt64(&maxInFlight, max, n) {
+					break
+				}
+			}
+			id := row["id"].(int)
+			// Later rows finish first; the output keeps the input order
+			time.Sleep(time.Duration(20-id) * time.Millisecond / 4)
+			if id == 7 {
+				return nil, nil
+			}
+			return map[string]interface{}{"id": id * 10}, nil
+		}).
+		Batch(3, func(_ context.Context, rows []map[string]interface{}) ([]map[string]interface{}, error) {
+			return rows, nil
+		}).
+		SinkBatchSize(4).
+		Run(context.Background(), sink)
+	require.NoError(t, err)
+
+	assert.Equal(t, []int{10, 20, 30, 40, 60, 80, 90, 110, 120, 130, 140, 160, 170, 180, 190}, sink.ids())
+	assert.Equal(t, &workersql.RowPipelineResult{Read: 20, Dropped: 5, Written: 15}, result)
+	assert.LessOrEqual(t, maxInFlight, int64(4))
+	assert.Greater(t, maxInFlight, int64(1))
+	require.Len(t, sink.batches, 4)
+	assert.Len(t, sink.batches[3], 3)
+}
+
+func TestRowPipelineBackpressure(t *testing.T) {
+	var emitted int64
+	release := make(chan struct{})
+	sink := workersql.RowSinkFunc(func(ctx context.Context, rows []map[string]interface{}) error {
+		<-release
+		return nil
+	})
+	done := make(chan error)
+	go func() {
+		_, err := workersql.NewRowPipeline(countingSource(10000, &emitted)).
+			Map(2, func(_ context.Context, row map[string]interface{}) (map[string]interface{}, error) { return row, nil }).
+			SinkBatchSize(10).
+			Run(context.Background(), sink)
+		done <- err
+	}()
+
+	// With the sink stuck on its first batch, the source is held back
+	time.Sleep(50 * time.Millisecond)
+	assert.Less(t, atomic.LoadInt64(&emitted), int64(30))
+	close(release)
+	require.NoError(t, <-done)
+	assert.Equal(t, int64(10000), atomic.LoadInt64(&emitted))
+}
+
+func TestRowPipelineStopsOnError(t *testing.T) {
+	var emitted int64
+	sink := &collectSink{}
+	result, err := workersql.NewRowPipeline(countingSource(100000, &emitted)).
+		Map(3, func(_ context.Context, row map[string]interface{}) (map[string]interface{}, error) {
+			if row["id"].(int) == 50 {
+				return nil, errors.New("bad row")
+			}
+			return row, nil
+		}).
+		SinkBatchSize(10).
+		Run(context.Background(), sink)
+	require.EqualError(t, err, "bad row")
+	assert.Less(t, atomic.LoadInt64(&emitted), int64(1000), "the source stops")
+	assert.LessOrEqual(t, result.Written, int64(49))
+	for _, id := range sink.ids() {
+		assert.Less(t, id, 50)
+	}
+
+	failing := workersql.RowSinkFunc(func(context.Context, []map[string]interface{}) error { return errors.New("disk full") })
+	_, err = workersql.NewRowPipeline(countingSource(10, nil)).Run(context.Background(), failing)
+	assert.ErrorContains(t, err, "disk full")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = workersql.NewRowPipeline(countingSource(10, nil)).Run(ctx, sink)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestRowPipelineSinks(t *testing.T) {
+	client, server := newMapperClient(t, map[string]string{
+		"SELECT": `{"success": true, "columns": [{"name": "id"}, {"name": "email"}], "data": [{"id": 1, "email": "A@X.COM"}, {"id": 2, "email": null}]}`,
+		"INSERT": `{"success": true, "affectedRows": 2}`,
+	})
+	ctx := context.Background()
+	lower := func(_ context.Context, row map[string]interface{}) (map[string]interface{}, error) {
+		if email, ok := row["email"].(string); ok {
+			row["email"] = strings.ToLower(email)
+		}
+		return row, nil
+	}
+
+	var out bytes.Buffer
+	result, err := workersql.NewRowPipeline(workersql.QuerySource(client, "SELECT id, email FROM users")).
+		Map(1, lower).
+		Run(ctx, workersql.ExportSink(workersql.ExportSpec{Writer: &out, Columns: []string{"id", "email"}}))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), result.Written)
+	assert.Equal(t, "id,email\n1,a@x.com\n2,\\N\n", out.String())
+
+	_, err = workersql.NewRowPipeline(workersql.QuerySource(client, "SELECT id, email FROM users")).
+		Map(1, lower).
+		Run(ctx, workersql.BulkInsertSink(client, "users_copy", workersql.BulkOptions{}))
+	require.NoError(t, err)
+	last := server.received[len(server.received)-1]
+	assert.True(t, strings.HasPrefix(last.SQL, "INSERT INTO"), last.SQL)
+	assert.Contains(t, fmt.Sprint(last.Params), "a@x.com")
+}
@@ -0,0 +1,161 @@
+package workersql_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const shopRules = `
+rules:
+  - name: email-per-tenant
+    kind: unique
+    table: users
+    columns: [email]
+    scope: [tenant_id]
+  - kind: reference
+    table: orders
+    columns: [user_id]
+    ref_table: users
+    ref_columns: [id]
+  - kind: range
+    table: orders
+    columns: [total]
+    min: 0
+    max: 10000
+    not_null: true
+  - name: order-status
+    kind: range
+    table: orders
+    columns: [status]
+    in: [pending, paid, shipped]
+  - name: placed-after-launch
+    kind: range
+    table: orders
+    columns: [placed_at]
+    min: "2024-01-01T00:00:00Z"
+`
+
+func loadShopRules(t *testing.T) *workersql.RuleSet {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(shopRules), 0o644))
+	rules, err := workersql.LoadRules(path)
+	require.NoError(t, err)
+	require.Len(t, rules.Rules, 5)
+	return rules
+}
+
+func TestParseRulesValidates(t *testing.T) {
+	_, err := workersql.ParseRules([]byte(`{"rules": [{"kind": "range", "table": "orders", "columns": ["total"]}]}`))
+	assert.ErrorContains(t, err, "rule 1 (range orders[total]): a range rule needs min, max, in or not_null")
+	_, err = workersql.ParseRules([]byte(`{"rules": [{"kind": "reference", "table": "orders", "columns": ["user_id"], "ref_table": "users"}]}`))
+	assert.ErrorContains(t, err, "ref_columns")
+	_, err = workersql.ParseRules([]byte(`{"rules": [{"kind": "check", "table": "orders", "columns": ["a"]}]}`))
+	assert.ErrorContains(t, err, `unknown kind "check"`)
+	_, err = workersql.ParseRules([]byte(`{"rules": [{"kind": "unique", "columns": ["a"]}]}`))
+	assert.ErrorContains(t, err, "no table")
+}
+
+func TestCheckRules(t *testing.T) {
+	client, server := newMapperClient(t, map[string]string{
+		"SELECT 1 AS found FROM `users` WHERE `tenant_id`": `{"success": true, "data": [{"found": 1}]}`,
+		"SELECT 1 AS found FROM `users` WHERE `id`":        `{"success": true, "data": []}`,
+	})
+	rules := loadShopRules(t)
+	ctx := context.Background()
+
+	err := client.CheckRules(ctx, rules, "users", map[string]interface{}{"tenant_id": 3, "email": "ada@example.com"})
+	var validation *workersql.ValidationError
+	require.True(t, errors.As(err, &validation))
+	assert.True(t, errors.Is(err, workersql.ErrConstraintViolation))
+	require.Len(t, validation.Violations, 1)
+	assert.Equal(t, "email-per-tenant", validation.Violations[0].Rule)
+	assert.Equal(t, map[string]interface{}{"tenant_id": 3, "email": "ada@example.com"}, validation.Violations[0].Values)
+
+	// NULL values are not compared, as with a database UNIQUE index
+	require.NoError(t, client.CheckRules(ctx, rules, "users", map[string]interface{}{"tenant_id": 3, "email": nil}))
+
+	err = client.CheckRules(ctx, rules, "orders", map[string]interface{}{
+		"user_id": 7, "total": -5, "status": "lost", "placed_at": time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC),
+	})
+	require.True(t, errors.As(err, &validation))
+	var messages []string
+	for _, v := range validation.Violations {
+		messages = append(messages, v.Message)
+	}
+	assert.Equal(t, []string{
+		"reference orders[user_id]: [user_id] = [7] has no matching row in users",
+		"range orders[total]: total = -5 is below 0",
+		"order-status: status = lost is not one of [pending paid shipped]",
+		"placed-after-launch: placed_at = 2023-06-01 00:00:00 +0000 UTC is below 2024-01-01T00:00:00Z",
+	}, messages)
+
+	err = client.CheckRules(ctx, rules, "orders", map[string]interface{}{"total": nil})
+	assert.ErrorContains(t, err, "total is NULL")
+	require.NoError(t, client.CheckRules(ctx, rules, "orders", map[string]interface{}{
+		"total": 10000.0, "status": "paid", "placed_at": time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+	}), "bounds are inclusive and missing columns are skipped")
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	assert.Equal(t, "SELECT 1 AS found FROM `users` WHERE `tenant_id` = ? AND `email` = ? LIMIT 1", server.received[0].SQL)
+}
+
+func TestAuditRules(t *testing.T) {
+	client, server := newMapperClient(t, map[string]string{
+		"SELECT `tenant_id`, `email`, COUNT(*)": `{"success": true, "data": [{"tenant_id": 3, "email": "dup@example.com", "duplicate_count": 2}]}`,
+		"SELECT DISTINCT":                       `{"success": true, "data": [{"user_id": 7}, {"user_id": 8}]}`,
+		"SELECT `id` FROM `users`":              `{"success": true, "data": [{"id": 8}]}`,
+		"SELECT * FROM `orders` WHERE `total`":  `{"success": true, "data": [{"id": 1, "total": -1}, {"id": 2, "total": null}, {"id": 3, "total": 20000}]}`,
+	})
+	rules := loadShopRules(t)
+
+	report, err := client.AuditRules(context.Background(), rules, workersql.IntegrityOptions{MaxViolations: 2})
+	require.NoError(t, err)
+	assert.False(t, report.Valid())
+	assert.True(t, report.Truncated, "the range rule had more than two violations")
+	assert.Len(t, report.Rules, 5)
+
+	require.Len(t, report.Violations, 4)
+	assert.Equal(t, int64(2), report.Violations[0].Count)
+	assert.Equal(t, "email-per-tenant: [tenant_id email] = [3 dup@example.com] is shared by 2 rows", report.Violations[0].Message)
+	assert.Equal(t, "reference orders[user_id]: [user_id] = [7] has no matching row in users", report.Violations[1].Message)
+	assert.Equal(t, "range orders[total]: total = -1 is below 0", report.Violations[2].Message)
+	assert.Equal(t, "range orders[total]: total is NULL", report.Violations[3].Message)
+	assert.Equal(t, workersql.RuleRange, report.Violations[3].Kind)
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	var sqls []string
+	for _, stmt := range server.received {
+		sqls = append(sqls, stmt.SQL)
+	}
+	assert.Contains(t, sqls, "SELECT `tenant_id`, `email`, COUNT(*) AS duplicate_count FROM `users` WHERE `tenant_id` IS NOT NULL AND `email` IS NOT NULL GROUP BY `tenant_id`, `email` HAVING COUNT(*) > 1 ORDER BY `tenant_id`, `email` LIMIT 3")
+	assert.Contains(t, sqls, "SELECT * FROM `orders` WHERE `total` IS NULL OR `total` < ? OR `total` > ? LIMIT 3")
+	assert.Contains(t, sqls, "SELECT * FROM `orders` WHERE `status` NOT IN (?, ?, ?) LIMIT 3")
+}
+
+func TestStartRuleAudit(t *testing.T) {
+	client, _ := newMapperClient(t, map[string]string{
+		"SELECT": `{"success": true, "data": []}`,
+	})
+	rules := loadShopRules(t)
+
+	reports := make(chan *workersql.ValidationReport, 10)
+	stop := client.StartRuleAudit(context.Background(), 10*time.Millisecond, rules, workersql.IntegrityOptions{Tables: []string{"users"}},
+		func(report *workersql.ValidationReport, err error) {
+			assert.NoError(t, err)
+			reports <- report
+		})
+	report := <-reports
+	stop()
+	assert.True(t, report.Valid())
+	assert.Equal(t, []string{"email-per-tenant"}, report.Rules)
+}
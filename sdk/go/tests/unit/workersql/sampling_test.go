@@ -0,0 +1,101 @@
+package workersql_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+)
+
+func newSamplingClient(t *testing.T, config workersql.ResultSamplingConfig) (*workersql.Client, func() []workersql.QualityViolation) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"data": []map[string]interface{}{
+				{"id": 1, "email": "a@example.com", "age": 31},
+				{"id": 2, "email": nil, "age": -4},
+				{"id": 3, "email": "not-an-address", "age": 150},
+			},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	var mu sync.Mutex
+	var violations []workersql.QualityViolation
+	config.OnViolation = func(v workersql.QualityViolation) {
+		mu.Lock()
+		violations = append(violations, v)
+		mu.Unlock()
+	}
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: server.URL, ResultSampling: &config})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+	return client, func() []workersql.QualityViolation {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]workersql.QualityViolation(nil), violations...)
+	}
+}
+
+func TestResultSamplingReportsViolations(t *testing.T) {
+	minAge, maxAge := 0.0, 120.0
+	client, violations := newSamplingClient(t, workersql.ResultSamplingConfig{
+		Rate: 1,
+		Rules: []workersql.ColumnRule{
+			{Table: "Users", Column: "email", NotNull: true, Check: func(v interface{}) error {
+				if !strings.Contains(v.(string), "@") {
+					return errors.New("invalid email")
+				}
+				return nil
+			}},
+			{Name: "plausible age", Table: "users", Column: "age", Min: &minAge, Max: &maxAge},
+			{Table: "orders", Column: "id", NotNull: true},
+		},
+	})
+
+	_, err := client.Query(context.Background(), "SELECT id, email, age FROM users WHERE id > ?", 0)
+	require.NoError(t, err)
+
+	got := violations()
+	require.Len(t, got, 4)
+	assert.Equal(t, "email", got[0].Rule)
+	assert.Equal(t, 1, got[0].Row)
+	assert.EqualError(t, got[0].Err, "email is NULL")
+	assert.Equal(t, 2, got[1].Row)
+	assert.EqualError(t, got[1].Err, "invalid email")
+	assert.Equal(t, "plausible age", got[2].Rule)
+	assert.EqualError(t, got[2].Err, "age is -4, below 0")
+	assert.EqualError(t, got[3].Err, "age is 150, above 120")
+	assert.Equal(t, "SELECT id, email, age FROM users WHERE id > ?", got[3].Fingerprint)
+
+	stats := client.Stats()
+	assert.Equal(t, int64(1), stats.ResultsSampled)
+	assert.Equal(t, int64(4), stats.QualityViolations)
+}
+
+func TestResultSamplingRate(t *testing.T) {
+	client, violations := newSamplingClient(t, workersql.ResultSamplingConfig{
+		Rate:    0.2,
+		MaxRows: 2,
+		Rules:   []workersql.ColumnRule{{Column: "email", NotNull: true}},
+	})
+	for i := 0; i < 500; i++ {
+		_, err := client.Query(context.Background(), "SELECT * FROM users")
+		require.NoError(t, err)
+	}
+
+	sampled := client.Stats().ResultsSampled
+	assert.InDelta(t, 100, sampled, 50)
+	// Only the first two rows are checked, so the bad address is missed
+	assert.Len(t, violations(), int(sampled))
+}
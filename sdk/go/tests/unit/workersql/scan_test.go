@@ -0,0 +1,158 @@
+package workersql_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const nullableResponse = `{
+	"success": true,
+	"columns": [
+		{"name": "id", "type": "BIGINT"},
+		{"name": "nickname", "type": "VARCHAR", "nullable": true},
+		{"name": "age", "type": "INT", "nullable": true},
+		{"name": "last_login", "type": "DATETIME", "nullable": true}
+	],
+	"data": [
+		{"id": 1, "nickname": "ada", "age": 36, "last_login": "2025-10-14 12:30:00"},
+		{"id": 2, "nickname": null, "age": null, "last_login": null}
+	]
+}`
+
+func newNullableClient(t *testing.T) *workersql.Client {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(nullableResponse))
+	}))
+	t.Cleanup(srv.Close)
+
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL})
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestScanRowNullTypes(t *testing.T) {
+	client := newNullableClient(t)
+	result, err := client.Query(context.Background(), "SELECT * FROM users")
+	require.NoError(t, err)
+
+	var (
+		id        int64
+		nickname  sql.NullString
+		age       sql.NullInt64
+		lastLogin sql.NullTime
+	)
+
+	require.NoError(t, result.ScanRow(0, &id, &nickname, &age, &lastLogin))
+	assert.Equal(t, int64(1), id)
+	assert.Equal(t, sql.NullString{String: "ada", Valid: true}, nickname)
+	assert.Equal(t, sql.NullInt64{Int64: 36, Valid: true}, age)
+	assert.True(t, lastLogin.Valid)
+	assert.Equal(t, time.Date(2025, 10, 14, 12, 30, 0, 0, time.UTC), lastLogin.Time)
+
+	require.NoError(t, result.ScanRow(1, &id, &nickname, &age, &lastLogin))
+	assert.Equal(t, int64(2), id)
+	assert.False(t, nickname.Valid)
+	assert.False(t, age.Valid)
+	assert.False(t, lastLogin.Valid)
+
+	assert.Error(t, result.ScanRow(0, &id))
+	assert.Error(t, result.ScanRow(5, &id, &nickname, &age, &lastLogin))
+}
+
+func TestScanAllStructs(t *testing.T) {
+	type user struct {
+		ID        int64                     `db:"id"`
+		Nickname  *string                   `db:"nickname"`
+		Age       workersql.Null[int]       `db:"age"`
+		LastLogin workersql.Null[time.Time] `db:"last_login"`
+		Ignored   string                    `db:"-"`
+	}
+
+	client := newNullableClient(t)
+	result, err := client.Query(context.Background(), "SELECT * FROM users")
+	require.NoError(t, err)
+
+	var users []user
+	require.NoError(t, result.ScanAll(&users))
+	require.Len(t, users, 2)
+
+	require.NotNil(t, users[0].Nickname)
+	assert.Equal(t, "ada", *users[0].Nickname)
+	assert.Equal(t, workersql.NewNull(36), users[0].Age)
+	assert.True(t, users[0].LastLogin.Valid)
+	assert.Equal(t, 2025, users[0].LastLogin.V.Year())
+
+	assert.Nil(t, users[1].Nickname)
+	assert.False(t, users[1].Age.Valid)
+	assert.False(t, users[1].LastLogin.Valid)
+
+	var ptrs []*user
+	require.NoError(t, result.ScanAll(&ptrs))
+	assert.Len(t, ptrs, 2)
+}
+
+func TestScanValueNullIntoPlainType(t *testing.T) {
+	var s string
+	err := workersql.ScanValue(nil, &s)
+	assert.Error(t, err)
+
+	var p *string
+	require.NoError(t, workersql.ScanValue(nil, &p))
+	assert.Nil(t, p)
+
+	require.NoError(t, workersql.ScanValue("x", &p))
+	require.NotNil(t, p)
+	assert.Equal(t, "x", *p)
+
+	var n int32
+	require.NoError(t, workersql.ScanValue(int64(42), &n))
+	assert.Equal(t, int32(42), n)
+
+	assert.Error(t, workersql.ScanValue(int64(1), n))
+}
+
+func TestNullParamsSentAsNull(t *testing.T) {
+	var body map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(raw, &body)
+		_, _ = w.Write([]byte(`{"success": true, "affectedRows": 1}`))
+	}))
+	defer srv.Close()
+
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL})
+	require.NoError(t, err)
+	defer client.Close()
+
+	_, err = client.Exec(context.Background(), "UPDATE users SET nickname = ?, age = ?, score = ? WHERE id = ?",
+		sql.NullString{}, workersql.NewNull(40), workersql.Null[float64]{}, 1)
+	require.NoError(t, err)
+
+	assert.Equal(t, []interface{}{nil, float64(40), nil, float64(1)}, body["params"])
+}
+
+func TestNullJSON(t *testing.T) {
+	data, err := json.Marshal(struct {
+		A workersql.Null[string]
+		B workersql.Null[string]
+	}{A: workersql.NewNull("a")})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"A": "a", "B": null}`, string(data))
+
+	var n workersql.Null[int]
+	require.NoError(t, json.Unmarshal([]byte("5"), &n))
+	assert.Equal(t, workersql.NewNull(5), n)
+	require.NoError(t, json.Unmarshal([]byte("null"), &n))
+	assert.False(t, n.Valid)
+}
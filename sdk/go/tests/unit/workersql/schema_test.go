@@ -0,0 +1,79 @@
+package workersql_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaChangeOnDDL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"success": true}`))
+	}))
+	defer srv.Close()
+
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL})
+	require.NoError(t, err)
+	defer client.Close()
+
+	var (
+		mu      sync.Mutex
+		changes []workersql.SchemaChange
+	)
+	unregister := client.OnSchemaChange(func(change workersql.SchemaChange) {
+		mu.Lock()
+		changes = append(changes, change)
+		mu.Unlock()
+	})
+
+	ctx := context.Background()
+	statements := []struct {
+		sql    string
+		tables []string
+	}{
+		{"ALTER TABLE `Users` ADD COLUMN age INT", []string{"users"}},
+		{"CREATE TABLE IF NOT EXISTS orders (id INT)", []string{"orders"}},
+		{"DROP TABLE IF EXISTS a, `b`", []string{"a", "b"}},
+		{"CREATE UNIQUE INDEX idx_email ON users (email)", []string{"users"}},
+		{"/* cleanup */ TRUNCATE TABLE sessions", []string{"sessions"}},
+		{"RENAME TABLE old_users TO users_archive", []string{"old_users", "users_archive"}},
+		{"DROP DATABASE scratch", nil},
+	}
+	for _, stmt := range statements {
+		_, err := client.Exec(ctx, stmt.sql)
+		require.NoError(t, err)
+	}
+
+	_, err = client.Query(ctx, "SELECT * FROM users")
+	require.NoError(t, err)
+	_, err = client.Exec(ctx, "UPDATE users SET age = 1")
+	require.NoError(t, err)
+
+	client.InvalidateSchema("`Inventory`")
+
+	mu.Lock()
+	require.Len(t, changes, len(statements)+1)
+	for i, stmt := range statements {
+		assert.Equal(t, stmt.sql, changes[i].SQL)
+		assert.Equal(t, stmt.tables, changes[i].Tables, stmt.sql)
+	}
+	last := changes[len(changes)-1]
+	mu.Unlock()
+
+	assert.True(t, last.Affects("inventory"))
+	assert.False(t, last.Affects("users"))
+	assert.True(t, workersql.SchemaChange{}.Affects("anything"))
+
+	unregister()
+	_, err = client.Exec(ctx, "DROP TABLE users")
+	require.NoError(t, err)
+	mu.Lock()
+	assert.Len(t, changes, len(statements)+1)
+	mu.Unlock()
+}
@@ -0,0 +1,148 @@
+package workersql_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	gws "github.com/gorilla/websocket"
+	"github.com/healthfees-org/workersql/sdk/go/internal/websocket"
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sessionServer is a gateway stub keeping the session variables set on
+// each WebSocket connection, answering "SELECT @@time_zone" from them
+type sessionServer struct {
+	*httptest.Server
+
+	mu    sync.Mutex
+	conns []*gws.Conn
+}
+
+func newSessionServer(t *testing.T) *sessionServer {
+	s := &sessionServer{}
+	upgrader := gws.Upgrader{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		s.mu.Lock()
+		s.conns = append(s.conns, conn)
+		n := len(s.conns)
+		s.mu.Unlock()
+
+		vars := map[string]interface{}{}
+		set := func(sql string, params []interface{}) {
+			var name string
+			if _, err := fmt.Sscanf(sql, "SET SESSION %s = ?", &name); err == nil {
+				vars[name] = params[0]
+			}
+		}
+		for {
+			var msg websocket.Message
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			reply := websocket.Message{Type: websocket.FrameResponse, ID: msg.ID}
+			switch msg.Type {
+			case websocket.FrameBegin:
+				reply.Data = map[string]interface{}{"transactionId": fmt.Sprintf("tx_%d", n)}
+			case websocket.FramePipeline:
+				var results []interface{}
+				for _, stmt := range msg.Statements {
+					set(stmt.SQL, stmt.Params)
+					results = append(results, map[string]interface{}{"success": true})
+				}
+				reply.Data = map[string]interface{}{"results": results}
+			case websocket.FrameQuery:
+				set(msg.SQL, msg.Params)
+				reply.Data = map[string]interface{}{"success": true, "data": []interface{}{
+					map[string]interface{}{"tz": vars["time_zone"]},
+				}}
+			default:
+				reply.Data = map[string]interface{}{"success": true}
+			}
+			if err := conn.WriteJSON(reply); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// drop closes the server side of every connection
+func (s *sessionServer) drop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		_ = conn.Close()
+	}
+}
+
+func (s *sessionServer) dials() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
+func TestSessionRestoresVariablesAfterReconnect(t *testing.T) {
+	srv := newSessionServer(t)
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL})
+	require.NoError(t, err)
+	defer client.Close()
+	ctx := context.Background()
+
+	session, err := client.Session(ctx)
+	require.NoError(t, err)
+	defer session.Close()
+
+	require.NoError(t, session.Set(ctx, "time_zone", "+00:00"))
+	resp, err := session.Query(ctx, "SELECT @@time_zone AS tz")
+	require.NoError(t, err)
+	assert.Equal(t, "+00:00", resp.Data[0]["tz"])
+	assert.Equal(t, map[string]interface{}{"time_zone": "+00:00"}, session.Vars())
+
+	srv.drop()
+	require.Eventually(t, func() bool {
+		resp, err = session.Query(ctx, "SELECT @@time_zone AS tz")
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "+00:00", resp.Data[0]["tz"], "variables are restored on the new connection")
+	assert.Equal(t, 2, srv.dials())
+}
+
+func TestTransactionSetDoesNotLeakIntoPooledSessions(t *testing.T) {
+	srv := newSessionServer(t)
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL})
+	require.NoError(t, err)
+	defer client.Close()
+	ctx := context.Background()
+
+	err = client.Transaction(ctx, func(ctx context.Context, tx *workersql.TransactionClient) error {
+		return tx.Set(ctx, "time_zone", "+09:00")
+	})
+	require.NoError(t, err)
+
+	err = client.Transaction(ctx, func(ctx context.Context, tx *workersql.TransactionClient) error {
+		resp, err := tx.Query(ctx, "SELECT @@time_zone AS tz")
+		require.NoError(t, err)
+		assert.Nil(t, resp.Data[0]["tz"])
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, srv.dials(), "the connection with the variable isn't reused")
+
+	err = client.Transaction(ctx, func(ctx context.Context, tx *workersql.TransactionClient) error {
+		return tx.Set(ctx, "time_zone; DROP TABLE users", "x")
+	})
+	assert.ErrorContains(t, err, "invalid session variable name")
+}
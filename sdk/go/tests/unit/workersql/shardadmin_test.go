@@ -0,0 +1,143 @@
+package workersql_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newShardAdminClient returns an admin client configured with adminToken
+// of a gateway serving the shard and tenant admin API, accepting only the
+// token "admin-token"
+func newShardAdminClient(t *testing.T, apiKey, adminToken string) (*workersql.AdminClient, *adminGateway) {
+	g := newAdminGateway(t, "admin-token")
+	reply := func(body string) adminRoute {
+		return func(adminRequest) (int, string) { return 0, body }
+	}
+	g.route("GET /admin/shards", reply(`{"success": true, "shards": [
+		{"id": "shard-0", "status": "healthy", "sizeBytes": 1048576, "rowCount": 5000, "tenants": ["acme", "globex"], "p99LatencyMs": 12.5, "lastCheckedAt": "2026-10-01T00:00:00Z"},
+		{"id": "shard-1", "status": "unavailable", "error": "storage limit reached"}]}`))
+	g.route("GET /admin/shards/shard-1", reply(`{"success": true, "shard": {"id": "shard-1", "status": "migrating"}}`))
+	operation := func(adminRequest) (int, string) {
+		return http.StatusAccepted, `{"success": true, "operation": {"id": "op-7", "type": "split", "status": "pending"}}`
+	}
+	g.route("POST /admin/shards/shard-0/split", operation)
+	g.route("POST /admin/shards/shard-1/merge", operation)
+	g.route("GET /admin/tenants", reply(`{"success": true, "tenants": [{"name": "acme", "shard": "shard-0", "sizeBytes": 4096}]}`))
+	g.route("POST /admin/tenants", func(req adminRequest) (int, string) {
+		if req.Body["name"] == "acme" {
+			return http.StatusConflict, `{"success": false, "error": {"code": "TENANT_EXISTS", "message": "tenant acme already exists"}}`
+		}
+		return 0, fmt.Sprintf(`{"success": true, "tenant": {"name": %q, "shard": "shard-1", "createdAt": "2026-10-16T00:00:00Z"}}`, req.Body["name"])
+	})
+	g.route("DELETE /admin/tenants/globex", reply(`{"success": true}`))
+	g.route("POST /admin/tenants/acme/keys/rotate", reply(`{"success": true, "key": {"id": "key-2", "key": "wsk_secret", "createdAt": "2026-10-16T00:00:00Z", "previousExpiresAt": "2026-10-17T00:00:00Z"}}`))
+	return g.client(t, workersql.Config{APIKey: apiKey, AdminToken: adminToken}), g
+}
+
+// lastBody returns the body of the last request to route
+func lastBody(g *adminGateway, route string) map[string]interface{} {
+	var body map[string]interface{}
+	for _, req := range g.received() {
+		if req.Route == route {
+			body = req.Body
+		}
+	}
+	return body
+}
+
+func TestAdminShards(t *testing.T) {
+	admin, server := newShardAdminClient(t, "query-key", "admin-token")
+	ctx := context.Background()
+
+	shards, err := admin.ListShards(ctx)
+	require.NoError(t, err)
+	require.Len(t, shards, 2)
+	assert.Equal(t, workersql.ShardHealthy, shards[0].Status)
+	assert.Equal(t, int64(1048576), shards[0].SizeBytes)
+	assert.Equal(t, []string{"acme", "globex"}, shards[0].Tenants)
+	assert.Equal(t, 12.5, shards[0].P99LatencyMs)
+	assert.Equal(t, workersql.ShardUnavailable, shards[1].Status)
+	assert.Equal(t, "storage limit reached", shards[1].Error)
+
+	shard, err := admin.Shard(ctx, "shard-1")
+	require.NoError(t, err)
+	assert.Equal(t, workersql.ShardMigrating, shard.Status)
+
+	op, err := admin.SplitShard(ctx, "shard-0", workersql.SplitOptions{NewShard: "shard-2", Tenants: []string{"globex"}})
+	require.NoError(t, err)
+	assert.Equal(t, "op-7", op.ID)
+	_, err = admin.MergeShards(ctx, "shard-1", "shard-0")
+	require.NoError(t, err)
+	_, err = admin.MergeShards(ctx, "shard-0", "shard-0")
+	assert.ErrorContains(t, err, "into itself")
+
+	assert.Equal(t, map[string]interface{}{"newShard": "shard-2", "tenants": []interface{}{"globex"}}, lastBody(server, "POST /admin/shards/shard-0/split"))
+	assert.Equal(t, map[string]interface{}{"into": "shard-0"}, lastBody(server, "POST /admin/shards/shard-1/merge"))
+	for _, req := range server.received() {
+		assert.Equal(t, "Bearer admin-token", req.Auth, "admin calls use the admin token")
+	}
+}
+
+func TestAdminTenants(t *testing.T) {
+	admin, server := newShardAdminClient(t, "query-key", "admin-token")
+	ctx := context.Background()
+
+	tenants, err := admin.ListTenants(ctx)
+	require.NoError(t, err)
+	require.Len(t, tenants, 1)
+	assert.Equal(t, workersql.Tenant{Name: "acme", Shard: "shard-0", SizeBytes: 4096}, tenants[0])
+
+	tenant, err := admin.CreateTenant(ctx, "initech", workersql.TenantOptions{Shard: "shard-1"})
+	require.NoError(t, err)
+	assert.Equal(t, "shard-1", tenant.Shard)
+	assert.True(t, tenant.CreatedAt.Equal(time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)))
+	assert.Equal(t, map[string]interface{}{"name": "initech", "shard": "shard-1"}, lastBody(server, "POST /admin/tenants"))
+
+	_, err = admin.CreateTenant(ctx, "acme", workersql.TenantOptions{})
+	assert.ErrorContains(t, err, "tenant acme already exists")
+
+	require.NoError(t, admin.DropTenant(ctx, "globex"))
+	assert.ErrorContains(t, admin.DropTenant(ctx, "missing"), "not found")
+
+	key, err := admin.RotateTenantKey(ctx, "acme", workersql.RotateKeyOptions{GracePeriod: 24 * time.Hour})
+	require.NoError(t, err)
+	assert.Equal(t, "wsk_secret", key.Key)
+	assert.True(t, key.PreviousExpiresAt.After(key.CreatedAt))
+	_, err = admin.RotateTenantKey(ctx, "acme", workersql.RotateKeyOptions{GracePeriod: -time.Second})
+	assert.ErrorContains(t, err, "negative grace period")
+
+	assert.Equal(t, map[string]interface{}{"gracePeriodSeconds": float64(86400)}, lastBody(server, "POST /admin/tenants/acme/keys/rotate"))
+}
+
+func TestAdminTokenRequired(t *testing.T) {
+	admin, server := newShardAdminClient(t, "query-key", "")
+	ctx := context.Background()
+
+	_, err := admin.ListShards(ctx)
+	assert.ErrorIs(t, err, workersql.ErrForbidden)
+	_, err = admin.CreateTenant(ctx, "initech", workersql.TenantOptions{})
+	assert.ErrorIs(t, err, workersql.ErrForbidden)
+
+	var auth []string
+	creates := 0
+	for _, req := range server.received() {
+		auth = append(auth, req.Auth)
+		if req.Route == "POST /admin/tenants" {
+			creates++
+		}
+	}
+	assert.Contains(t, auth, "Bearer query-key", "without an admin token the API key is sent")
+	assert.Equal(t, 1, creates, "creating a tenant is not retried")
+
+	// Without any key the gateway answers 401
+	admin, _ = newShardAdminClient(t, "", "")
+	_, err = admin.ListTenants(ctx)
+	assert.ErrorIs(t, err, workersql.ErrForbidden)
+}
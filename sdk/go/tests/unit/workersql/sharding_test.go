@@ -0,0 +1,111 @@
+package workersql_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// configDir is the platform's example configuration at the repository root
+const configDir = "../../../../../config/"
+
+func TestLoadShardingConfigExamples(t *testing.T) {
+	simple, err := workersql.LoadShardingConfig(configDir + "simple")
+	require.NoError(t, err)
+	assert.Equal(t, 1, simple.Routing.Version)
+	assert.Equal(t, "shard_1", simple.Routing.Tenants["tenant_globex"])
+	assert.Equal(t, workersql.RangeRule{Prefix: "acme", Shard: "shard_0"}, simple.Routing.Ranges[0])
+	assert.Equal(t, workersql.RoutingDefaults{ShardCount: 4, Strategy: "tenant_hash"}, simple.Routing.Defaults)
+
+	orders, ok := simple.Table("orders")
+	require.True(t, ok, "table policies are read from table-policies/")
+	assert.Equal(t, "order_id", orders.PrimaryKey)
+	assert.Equal(t, workersql.ConsistencyStrong, orders.Cache.Mode)
+	assert.EqualValues(t, 60000, orders.Cache.TTLMs)
+	assert.Equal(t, "table_hash", orders.Routing.Strategy)
+	assert.Equal(t, "user_id", simple.ShardKeyColumn("ORDERS"))
+
+	shop, err := workersql.LoadShardingConfig(configDir + "woocommerce")
+	require.NoError(t, err)
+	assert.Equal(t, 10, shop.Routing.Defaults.ShardCount)
+	assert.Equal(t, "customer_id", shop.ShardKeyColumn("wc_orders"), "table policies are read next to the routing policy")
+
+	for _, dir := range []string{"n8n", "wordpress"} {
+		_, err := workersql.LoadShardingConfig(configDir + dir)
+		assert.NoError(t, err, dir)
+	}
+}
+
+func TestParseTablePolicyDefaults(t *testing.T) {
+	policy, err := workersql.ParseTablePolicy([]byte("shard_by: tenant_id\ncache:\n  ttl_ms: 0\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "id", policy.PrimaryKey)
+	assert.Equal(t, workersql.ConsistencyBounded, policy.Cache.Mode)
+	assert.EqualValues(t, 0, policy.Cache.TTLMs, "an explicit zero is kept")
+	assert.EqualValues(t, 300000, policy.Cache.SWRMs)
+
+	_, err = workersql.ParseTablePolicy([]byte("cache:\n  mode: eventual\n"))
+	assert.Error(t, err)
+	_, err = workersql.ParseTablePolicy([]byte("routing:\n  strategy: random\n"))
+	assert.Error(t, err)
+	_, err = workersql.ParseRoutingPolicy([]byte("ranges:\n  - prefix: acme\n"))
+	assert.Error(t, err, "ranges need a shard")
+}
+
+func TestShardingConfigShardFor(t *testing.T) {
+	config, err := workersql.LoadShardingConfigFS(fstest.MapFS{
+		"routing-policy.yaml": {Data: []byte("tenants:\n  tenant_acme: shard_3\nranges:\n  - prefix: vip_\n    shard: shard_0\ndefaults:\n  shard_count: 4\n")},
+		"orders.yaml":         {Data: []byte("shard_by: customer_id\nrouting:\n  strategy: table_hash\n")},
+		"events.yml":          {Data: []byte("routing:\n  strategy: custom\n  shard_key: device_id\n")},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "shard_3", config.ShardFor("tenant_acme", "orders", "vip_1"), "tenant assignments win")
+	assert.Equal(t, "shard_0", config.ShardFor("tenant_zeta", "orders", "vip_1"))
+	// Hashes match the gateway's routing for the same inputs
+	assert.Equal(t, "shard_1", config.ShardFor("tenant_zeta", "users", ""))
+	assert.Equal(t, "shard_2", config.ShardFor("tenant_zeta", "orders", "customer_42"))
+	assert.Equal(t, "shard_1", config.ShardFor("tenant_zeta", "events", "customer_42"))
+	assert.Equal(t, "device_id", config.ShardKeyColumn("events"))
+}
+
+func TestShardingConfigAddsRoutingHint(t *testing.T) {
+	var body map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body = nil
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		_, _ = w.Write([]byte(`{"success": true, "data": []}`))
+	}))
+	defer srv.Close()
+
+	sharding, err := workersql.LoadShardingConfig(configDir + "woocommerce")
+	require.NoError(t, err)
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL, RetryAttempts: 1, Sharding: sharding})
+	require.NoError(t, err)
+	defer client.Close()
+	ctx := context.Background()
+
+	_, err = client.Query(ctx, "SELECT * FROM wc_orders WHERE status = ? AND customer_id = ?", "open", 42)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"shardKey": "42"}, body["hints"])
+
+	_, err = client.Exec(ctx, "UPDATE wc_orders SET status = 'paid' WHERE wc_orders.customer_id = 'c-7'")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"shardKey": "c-7"}, body["hints"])
+
+	_, err = client.QueryWithOptions(ctx, "SELECT * FROM wc_orders WHERE customer_id = 9", nil,
+		workersql.QueryOptions{Consistency: workersql.ConsistencyStrong})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"consistency": "strong", "shardKey": "9"}, body["hints"])
+
+	_, err = client.Query(ctx, "SELECT * FROM wc_orders WHERE status = ?", "open")
+	require.NoError(t, err)
+	assert.NotContains(t, body, "hints", "no hint without a shard key filter")
+}
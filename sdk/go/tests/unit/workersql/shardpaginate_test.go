@@ -0,0 +1,115 @@
+package workersql_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// keysetShard serves the rows with the given ids, honouring the keyset
+// condition and limit of each query
+type keysetShard struct {
+	ids      []int
+	down     int32
+	requests int32
+}
+
+func (s *keysetShard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt32(&s.requests, 1)
+	if atomic.LoadInt32(&s.down) == 1 {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"code": "INVALID_QUERY", "message": "boom"}`))
+		return
+	}
+	var body struct {
+		SQL    string        `json:"sql"`
+		Params []interface{} `json:"params"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+
+	after := 0
+	if strings.Contains(body.SQL, "WHERE `id` > ?") {
+		after = int(body.Params[len(body.Params)-1].(float64))
+	}
+	limit, _ := strconv.Atoi(limitPattern.FindStringSubmatch(body.SQL)[1])
+	var rows []string
+	for _, id := range s.ids {
+		if id > after && len(rows) < limit {
+			rows = append(rows, fmt.Sprintf(`{"id": %d}`, id))
+		}
+	}
+	fmt.Fprintf(w, `{"success": true, "columns": [{"name": "id", "type": "INT"}], "data": [%s]}`, strings.Join(rows, ","))
+}
+
+func newKeysetShards(t *testing.T, shards map[string]*keysetShard) *workersql.Client {
+	endpoints := make(map[string]string)
+	for name, shard := range shards {
+		srv := httptest.NewServer(shard)
+		t.Cleanup(srv.Close)
+		endpoints[name] = srv.URL
+	}
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: endpoints["shard-a"], RetryAttempts: 1, Shards: endpoints})
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestPaginateShardsMergesPages(t *testing.T) {
+	shards := map[string]*keysetShard{
+		"shard-a": {ids: []int{1, 4, 5, 9}},
+		"shard-b": {ids: []int{2, 3}},
+		"shard-c": {ids: []int{6, 7, 8, 10, 11}},
+	}
+	client := newKeysetShards(t, shards)
+	ctx := context.Background()
+	names := []string{"shard-a", "shard-b", "shard-c"}
+
+	p := client.PaginateShards(names, "SELECT id FROM events", workersql.PageOptions{Size: 3})
+	var pages [][]int64
+	var cursors []string
+	for p.More() {
+		page, err := p.Next(ctx)
+		require.NoError(t, err)
+		pages = append(pages, pageIDs(page))
+		cursors = append(cursors, page.Cursor)
+	}
+	assert.Equal(t, [][]int64{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}, {10, 11}}, pages)
+	assert.Empty(t, cursors[3])
+	_, err := p.Next(ctx)
+	assert.True(t, errors.Is(err, workersql.ErrNoMorePages))
+
+	// shard-b ran out on the first page and isn't queried again
+	assert.EqualValues(t, 1, atomic.LoadInt32(&shards["shard-b"].requests))
+
+	resumed := client.PaginateShards(names, "SELECT id FROM events", workersql.PageOptions{Size: 3, Cursor: cursors[1]})
+	page, err := resumed.Next(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{7, 8, 9}, pageIDs(page))
+
+	bad := client.PaginateShards(names[:2], "SELECT id FROM events", workersql.PageOptions{Size: 3, Cursor: cursors[1]})
+	_, err = bad.Next(ctx)
+	assert.True(t, errors.Is(err, workersql.ErrInvalidCursor), "cursors are tied to their shards")
+}
+
+func TestPaginateShardsFailsOnShardError(t *testing.T) {
+	shards := map[string]*keysetShard{
+		"shard-a": {ids: []int{1, 3}},
+		"shard-b": {ids: []int{2, 4}, down: 1},
+	}
+	client := newKeysetShards(t, shards)
+
+	p := client.PaginateShards([]string{"shard-a", "shard-b"}, "SELECT id FROM events", workersql.PageOptions{Size: 2})
+	_, err := p.Next(context.Background())
+	assert.Error(t, err, "an incomplete page is never returned")
+}
@@ -0,0 +1,152 @@
+package workersql_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// shardServer answers queries with a row naming the shard, or with 503
+// while down is set
+type shardServer struct {
+	name     string
+	down     int32
+	requests int32
+}
+
+func (s *shardServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt32(&s.requests, 1)
+	if atomic.LoadInt32(&s.down) == 1 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(`{"code": "SHARD_UNAVAILABLE", "message": "shard is down"}`))
+		return
+	}
+	_, _ = w.Write([]byte(`{"success": true, "data": [{"shard": "` + s.name + `"}]}`))
+}
+
+func newShardedClient(t *testing.T, names ...string) (*workersql.Client, map[string]*shardServer) {
+	servers := make(map[string]*shardServer)
+	endpoints := make(map[string]string)
+	for _, name := range names {
+		server := &shardServer{name: name}
+		srv := httptest.NewServer(server)
+		t.Cleanup(srv.Close)
+		servers[name] = server
+		endpoints[name] = srv.URL
+	}
+
+	client, err := workersql.NewClient(workersql.Config{
+		APIEndpoint:   endpoints[names[0]],
+		RetryAttempts: 1,
+		Shards:        endpoints,
+		ShardBreaker:  &workersql.ShardBreakerConfig{FailureThreshold: 2, Cooldown: 50 * time.Millisecond},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client, servers
+}
+
+func TestQueryShardRoutesToShardEndpoint(t *testing.T) {
+	client, _ := newShardedClient(t, "shard-a", "shard-b")
+
+	resp, err := client.QueryShard(context.Background(), "shard-b", "SELECT 1")
+	require.NoError(t, err)
+	assert.Equal(t, "shard-b", resp.Data[0]["shard"])
+
+	_, err = client.QueryShard(context.Background(), "shard-z", "SELECT 1")
+	assert.True(t, errors.Is(err, workersql.ErrUnknownShard))
+}
+
+func TestQueryShardCircuitBreaker(t *testing.T) {
+	client, servers := newShardedClient(t, "shard-a", "shard-b")
+	ctx := context.Background()
+	atomic.StoreInt32(&servers["shard-b"].down, 1)
+
+	for i := 0; i < 2; i++ {
+		_, err := client.QueryShard(ctx, "shard-b", "SELECT 1")
+		require.Error(t, err)
+	}
+	assert.Equal(t, "open", client.ShardCircuitState("shard-b"))
+
+	_, err := client.QueryShard(ctx, "shard-b", "SELECT 1")
+	assert.True(t, errors.Is(err, workersql.ErrShardUnavailable))
+	assert.EqualValues(t, 2, atomic.LoadInt32(&servers["shard-b"].requests), "an open circuit fails fast")
+	assert.Equal(t, "closed", client.ShardCircuitState("shard-a"))
+
+	atomic.StoreInt32(&servers["shard-b"].down, 0)
+	time.Sleep(60 * time.Millisecond)
+	_, err = client.QueryShard(ctx, "shard-b", "SELECT 1")
+	require.NoError(t, err)
+	assert.Equal(t, "closed", client.ShardCircuitState("shard-b"), "a successful trial closes the circuit")
+}
+
+func TestQueryShardsPartialResults(t *testing.T) {
+	client, servers := newShardedClient(t, "shard-a", "shard-b", "shard-c")
+	ctx := context.Background()
+	atomic.StoreInt32(&servers["shard-c"].down, 1)
+	shards := []string{"shard-a", "shard-b", "shard-c"}
+
+	_, err := client.QueryShards(ctx, shards, "SELECT 1", nil, workersql.ShardQueryOptions{})
+	var failure *workersql.PartialFailure
+	require.True(t, errors.As(err, &failure), "without AllowPartial the call fails")
+	assert.Contains(t, failure.Failed, "shard-c")
+
+	result, err := client.QueryShards(ctx, shards, "SELECT 1", nil, workersql.ShardQueryOptions{AllowPartial: true})
+	require.NoError(t, err)
+	require.NotNil(t, result.Partial)
+	assert.Len(t, result.Partial.Failed, 1)
+	assert.Equal(t, 3, result.Partial.Total)
+	assert.Len(t, result.Responses(), 2)
+	assert.Equal(t, "shard-a", result.Results[0].Shard)
+	assert.Error(t, result.Results[2].Err)
+
+	// The breaker is open now, so the failing shard is skipped at once
+	result, err = client.QueryShards(ctx, shards, "SELECT 1", nil, workersql.ShardQueryOptions{AllowPartial: true})
+	require.NoError(t, err)
+	assert.True(t, errors.Is(result.Partial, workersql.ErrShardUnavailable))
+
+	for _, s := range servers {
+		atomic.StoreInt32(&s.down, 1)
+	}
+	_, err = client.QueryShards(ctx, shards, "SELECT 1", nil, workersql.ShardQueryOptions{AllowPartial: true})
+	assert.Error(t, err, "the call fails when no shard answers")
+}
+
+func TestQueryAllShardsMergesEveryShard(t *testing.T) {
+	shards := map[string]*keysetShard{
+		"shard-a": {ids: []int{1, 4, 5, 9}},
+		"shard-b": {ids: []int{2, 3}},
+		"shard-c": {ids: []int{6, 7, 8}},
+	}
+	client := newKeysetShards(t, shards)
+
+	result, err := client.QueryAllShards(context.Background(), "SELECT id FROM events ORDER BY id", nil,
+		workersql.MergeOptions{OrderBy: []workersql.SortKey{{Column: "id"}}, Limit: 4})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2, 3, 4}, pageIDs(&workersql.Page{QueryResponse: result.QueryResponse}))
+	assert.Equal(t, 4, result.RowCount)
+
+	require.Len(t, result.Shards, 3)
+	for i, name := range []string{"shard-a", "shard-b", "shard-c"} {
+		assert.Equal(t, name, result.Shards[i].Shard)
+		assert.NoError(t, result.Shards[i].Err)
+		assert.Positive(t, result.Shards[i].Duration)
+	}
+	assert.Len(t, result.Shards[0].Response.Data, 4, "the limit is pushed down to each shard")
+
+	atomic.StoreInt32(&shards["shard-b"].down, 1)
+	_, err = client.QueryAllShards(context.Background(), "SELECT id FROM events ORDER BY id", nil,
+		workersql.MergeOptions{OrderBy: []workersql.SortKey{{Column: "id"}}, Limit: 4})
+	var partial *workersql.PartialFailure
+	require.ErrorAs(t, err, &partial)
+	assert.Contains(t, partial.Failed, "shard-b")
+	assert.Equal(t, 3, partial.Total)
+}
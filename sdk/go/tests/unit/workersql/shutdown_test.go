@@ -0,0 +1,231 @@
+package workersql_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShutdownWaitsForInFlightRequests(t *testing.T) {
+	entered, unblock := make(chan struct{}), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/query" {
+			close(entered)
+			<-unblock
+		}
+		_, _ = w.Write([]byte(`{"success": true, "data": [{"id": 1}]}`))
+	}))
+	defer srv.Close()
+
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL, RetryAttempts: 1})
+	require.NoError(t, err)
+
+	queryErr := make(chan error, 1)
+	go func() {
+		_, err := client.Query(context.Background(), "SELECT 1")
+		queryErr <- err
+	}()
+	<-entered
+
+	shutdownErr := make(chan error, 1)
+	go func() { shutdownErr <- client.Shutdown(context.Background()) }()
+
+	// New work is rejected while the query drains
+	assert.Eventually(t, func() bool {
+		_, err := client.Health(context.Background())
+		return errors.Is(err, workersql.ErrClientClosed)
+	}, time.Second, time.Millisecond)
+	_, err = client.BeginTx(context.Background())
+	assert.ErrorIs(t, err, workersql.ErrClientClosed)
+
+	select {
+	case <-shutdownErr:
+		t.Fatal("Shutdown returned before the query finished")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(unblock)
+	require.NoError(t, <-queryErr)
+	require.NoError(t, <-shutdownErr)
+}
+
+func TestShutdownDeadlineAbandonsWork(t *testing.T) {
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL, RetryAttempts: 1})
+	require.NoError(t, err)
+
+	go func() { _, _ = client.Query(context.Background(), "SELECT 1") }()
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = client.Shutdown(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, err.Error(), "abandoning 1 requests")
+
+	// Close after Shutdown is a no-op
+	assert.NoError(t, client.Close())
+}
+
+func TestShutdownIdleClient(t *testing.T) {
+	client, _ := newMapperClient(t, map[string]string{})
+	require.NoError(t, client.Shutdown(context.Background()))
+
+	_, err := client.Query(context.Background(), "SELECT 1")
+	assert.ErrorIs(t, err, workersql.ErrClientClosed)
+}
+
+func TestShutdownWaitsForOpenTransactions(t *testing.T) {
+	srv := newTxServer(t, nil)
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL})
+	require.NoError(t, err)
+	testShutdownWaitsForTransaction(t, client)
+}
+
+func TestShutdownWaitsForOpenHTTPTransactions(t *testing.T) {
+	srv, _ := newHTTPTxServer(t, "")
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL, TransactionTransport: workersql.TransactionTransportHTTP})
+	require.NoError(t, err)
+	testShutdownWaitsForTransaction(t, client)
+}
+
+func testShutdownWaitsForTransaction(t *testing.T, client *workersql.Client) {
+	ctx := context.Background()
+
+	tx, err := client.BeginTx(ctx)
+	require.NoError(t, err)
+
+	shutdownErr := make(chan error, 1)
+	go func() { shutdownErr <- client.Shutdown(ctx) }()
+
+	// The open transaction keeps working until it commits
+	time.Sleep(10 * time.Millisecond)
+	_, err = tx.Exec(ctx, "UPDATE accounts SET balance = 0")
+	require.NoError(t, err)
+	select {
+	case <-shutdownErr:
+		t.Fatal("Shutdown returned before the transaction finished")
+	default:
+	}
+
+	require.NoError(t, tx.Commit(ctx))
+	require.NoError(t, <-shutdownErr)
+}
+
+func TestShutdownSendsBatchedWrites(t *testing.T) {
+	var sent int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&sent, 1)
+		_, _ = w.Write([]byte(`{"success": true, "affectedRows": 1}`))
+	}))
+	defer srv.Close()
+	client, err := workersql.NewClient(workersql.Config{
+		APIEndpoint:   srv.URL,
+		RetryAttempts: 1,
+		BatchExecs:    &workersql.WriteBatchingConfig{Window: time.Hour},
+	})
+	require.NoError(t, err)
+
+	execErr := make(chan error, 1)
+	go func() {
+		_, err := client.Exec(context.Background(), "INSERT INTO events (name) VALUES (?)", "click")
+		execErr <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// The write goes out without waiting for the window
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, client.Shutdown(ctx))
+	require.NoError(t, <-execErr)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&sent))
+}
+
+func TestShutdownRetriesDeadLetters(t *testing.T) {
+	srv, keys := newFlakyServer(t, 1, http.StatusServiceUnavailable)
+	letters := make(chan workersql.DeadLetter, 1)
+	client, err := workersql.NewClient(workersql.Config{
+		APIEndpoint:   srv.URL,
+		RetryAttempts: 1,
+		DeadLetter: &workersql.DeadLetterConfig{
+			Handler:       func(l workersql.DeadLetter) { letters <- l },
+			RetryAttempts: 3,
+			RetryInterval: time.Hour,
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = client.Exec(context.Background(), "INSERT INTO events (name) VALUES (?)", "click")
+	require.ErrorIs(t, err, workersql.ErrWriteDeferred)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, client.Shutdown(ctx))
+	assert.Len(t, keys(), 2, "the queued write is retried before closing")
+	assert.Empty(t, letters)
+}
+
+func TestShutdownOnSignal(t *testing.T) {
+	entered, unblock := make(chan struct{}), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-unblock
+		_, _ = w.Write([]byte(`{"success": true, "data": []}`))
+	}))
+	defer srv.Close()
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL, RetryAttempts: 1})
+	require.NoError(t, err)
+
+	progress := make(chan workersql.DrainProgress, 100)
+	shutdownErr := make(chan error, 1)
+	stop := client.ShutdownOnSignal(workersql.SignalShutdownConfig{
+		Signals:          []os.Signal{syscall.SIGUSR1},
+		ProgressInterval: 5 * time.Millisecond,
+		OnProgress:       func(p workersql.DrainProgress) { progress <- p },
+		OnShutdown:       func(err error) { shutdownErr <- err },
+	})
+	defer stop()
+
+	queryErr := make(chan error, 1)
+	go func() {
+		_, err := client.Query(context.Background(), "SELECT 1")
+		queryErr <- err
+	}()
+	<-entered
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+
+	select {
+	case p := <-progress:
+		assert.Equal(t, 1, p.Requests)
+		assert.False(t, p.Done())
+	case <-time.After(time.Second):
+		t.Fatal("no drain progress reported")
+	}
+	_, err = client.Query(context.Background(), "SELECT 2")
+	assert.ErrorIs(t, err, workersql.ErrClientClosed)
+
+	close(unblock)
+	require.NoError(t, <-queryErr)
+	select {
+	case err := <-shutdownErr:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("shutdown didn't finish")
+	}
+}
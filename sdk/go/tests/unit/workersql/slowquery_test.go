@@ -0,0 +1,159 @@
+package workersql_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+)
+
+// explainServer delays statements mentioning "slow" and answers EXPLAINs
+// with a plan, recording them
+type explainServer struct {
+	mu       sync.Mutex
+	explains []map[string]interface{}
+	headers  []http.Header
+}
+
+func (s *explainServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req map[string]interface{}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	sql, _ := req["sql"].(string)
+	if strings.HasPrefix(sql, "EXPLAIN ") {
+		s.mu.Lock()
+		s.explains = append(s.explains, req)
+		s.headers = append(s.headers, r.Header.Clone())
+		s.mu.Unlock()
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"data":    []map[string]interface{}{{"id": 1, "table": "t", "type": "ALL"}},
+		})
+		return
+	}
+	if strings.Contains(sql, "slow") {
+		time.Sleep(30 * time.Millisecond)
+	}
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": []map[string]interface{}{}})
+}
+
+func (s *explainServer) explained() []map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]map[string]interface{}(nil), s.explains...)
+}
+
+func newSlowQueryClient(t *testing.T, config workersql.SlowQueryConfig) (*workersql.Client, *explainServer, <-chan workersql.SlowQuery) {
+	t.Helper()
+	s := &explainServer{}
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+
+	slow := make(chan workersql.SlowQuery, 10)
+	config.Threshold = 20 * time.Millisecond
+	config.Handler = func(q workersql.SlowQuery) { slow <- q }
+	client, err := workersql.NewClient(workersql.Config{
+		APIEndpoint:   server.URL,
+		RetryAttempts: 1,
+		SlowQueries:   &config,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+	return client, s, slow
+}
+
+func nextSlowQuery(t *testing.T, slow <-chan workersql.SlowQuery) workersql.SlowQuery {
+	t.Helper()
+	select {
+	case q := <-slow:
+		return q
+	case <-time.After(2 * time.Second):
+		t.Fatal("slow query not reported")
+		return workersql.SlowQuery{}
+	}
+}
+
+func TestSlowQueryReportsPlan(t *testing.T) {
+	client, server, slow := newSlowQueryClient(t, workersql.SlowQueryConfig{Explain: true})
+	ctx := context.Background()
+
+	_, err := client.Query(ctx, "SELECT * FROM t WHERE id = ?", 1)
+	require.NoError(t, err)
+	_, err = client.Query(ctx, "SELECT * FROM t WHERE slow = ?", 1)
+	require.NoError(t, err)
+
+	q := nextSlowQuery(t, slow)
+	assert.Equal(t, "Query", q.Op)
+	assert.Equal(t, "SELECT * FROM t WHERE slow = ?", q.SQL)
+	assert.Equal(t, "SELECT * FROM t WHERE slow = ?", q.Fingerprint)
+	assert.GreaterOrEqual(t, q.Duration, 20*time.Millisecond)
+	require.NoError(t, q.ExplainErr)
+	require.Len(t, q.Plan, 1)
+	assert.Equal(t, "ALL", q.Plan[0]["type"])
+
+	explains := server.explained()
+	require.Len(t, explains, 1)
+	assert.Equal(t, "EXPLAIN SELECT * FROM t WHERE slow = ?", explains[0]["sql"])
+	assert.Equal(t, []interface{}{float64(1)}, explains[0]["params"])
+	assert.Len(t, slow, 0)
+	assert.Equal(t, int64(1), client.Stats().SlowQueries)
+}
+
+func TestSlowQueryExplainDeduplicatedAndRateLimited(t *testing.T) {
+	client, server, slow := newSlowQueryClient(t, workersql.SlowQueryConfig{
+		Explain:              true,
+		MaxExplainsPerMinute: 2,
+	})
+	ctx := context.Background()
+
+	statements := []string{
+		"SELECT * FROM t WHERE slow = 1",
+		"SELECT * FROM t WHERE slow = 2", // same fingerprint: no plan
+		"SELECT * FROM u WHERE slow = 1",
+		"SELECT * FROM v WHERE slow = 1", // over the rate limit: no plan
+	}
+	var planned []bool
+	for _, sql := range statements {
+		_, err := client.Query(ctx, sql)
+		require.NoError(t, err)
+		q := nextSlowQuery(t, slow)
+		assert.Equal(t, sql, q.SQL)
+		planned = append(planned, q.Plan != nil)
+	}
+	assert.Equal(t, []bool{true, false, true, false}, planned)
+	assert.Len(t, server.explained(), 2)
+}
+
+func TestSlowQueryExplainOfWrite(t *testing.T) {
+	client, server, slow := newSlowQueryClient(t, workersql.SlowQueryConfig{Explain: true})
+
+	_, err := client.Exec(context.Background(), "UPDATE t SET slow = ? WHERE id = ?", 1, 2)
+	require.NoError(t, err)
+	q := nextSlowQuery(t, slow)
+	assert.Equal(t, "Exec", q.Op)
+	require.NotNil(t, q.Plan)
+
+	// The EXPLAIN runs as a read, outside the write's idempotency key
+	explains := server.explained()
+	require.Len(t, explains, 1)
+	assert.Nil(t, explains[0]["mode"])
+	assert.Empty(t, server.headers[0].Get(workersql.IdempotencyKeyHeader))
+}
+
+func TestSlowQueryWithoutExplain(t *testing.T) {
+	client, server, slow := newSlowQueryClient(t, workersql.SlowQueryConfig{})
+
+	_, err := client.Query(context.Background(), "SELECT * FROM t WHERE slow = 1")
+	require.NoError(t, err)
+	q := nextSlowQuery(t, slow)
+	assert.Nil(t, q.Plan)
+	assert.Empty(t, server.explained())
+}
@@ -0,0 +1,231 @@
+package workersql_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type snapshotServer struct {
+	mu       sync.Mutex
+	queries  []map[string]interface{}
+	begun    []map[string]interface{}
+	released []string
+	expires  time.Time
+}
+
+func (s *snapshotServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/snapshot":
+		s.begun = append(s.begun, body)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":   true,
+			"token":     "snap-1",
+			"expiresAt": s.expires,
+		})
+	case "/snapshot/release":
+		s.released = append(s.released, body["token"].(string))
+		_, _ = w.Write([]byte(`{"success": true}`))
+	case "/query":
+		s.queries = append(s.queries, body)
+		_, _ = w.Write([]byte(`{"success": true, "data": [{"n": 1}]}`))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newSnapshotClient(t *testing.T, expires time.Time) (*workersql.Client, *snapshotServer) {
+	handler := &snapshotServer{expires: expires}
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL})
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client, handler
+}
+
+func TestSnapshotQueriesCarryToken(t *testing.T) {
+	client, server := newSnapshotClient(t, time.Now().Add(time.Minute))
+
+	err := client.ReadOnly(context.Background(), func(ctx context.Context, snap *workersql.Snapshot) error {
+		assert.Equal(t, "snap-1", snap.Token())
+		if _, err := snap.Query(ctx, "SELECT COUNT(*) AS n FROM orders"); err != nil {
+			return err
+		}
+		_, err := snap.QueryRow(ctx, "/* totals */ select sum(total) FROM orders WHERE id IN (?)", []int{1, 2})
+		return err
+	})
+	require.NoError(t, err)
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	require.Len(t, server.queries, 2)
+	for _, q := range server.queries {
+		assert.Equal(t, "snap-1", q["snapshot"])
+		assert.Equal(t, map[string]interface{}{"consistency": "strong"}, q["hints"])
+	}
+	assert.Equal(t, []interface{}{float64(1), float64(2)}, server.queries[1]["params"])
+	assert.Equal(t, []string{"snap-1"}, server.released)
+}
+
+func TestExportSnapshot(t *testing.T) {
+	client, server := newSnapshotClient(t, time.Now().Add(time.Minute))
+
+	var orders, items bytes.Buffer
+	checkpoints, err := client.ExportSnapshot(context.Background(),
+		workersql.ExportSpec{Table: "orders", KeyColumns: []string{"n"}, Writer: &orders},
+		workersql.ExportSpec{Table: "order_items", KeyColumns: []string{"n"}, Format: workersql.ExportJSONL, Writer: &items},
+	)
+	require.NoError(t, err)
+	require.Len(t, checkpoints, 2)
+	assert.Equal(t, int64(1), checkpoints[1].Rows)
+	assert.Equal(t, "n\n1\n", orders.String())
+	assert.Equal(t, "{\"n\":1}\n", items.String())
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	require.Len(t, server.queries, 2)
+	assert.Contains(t, server.queries[0]["sql"], "FROM `orders`")
+	assert.Contains(t, server.queries[1]["sql"], "FROM `order_items`")
+	for _, q := range server.queries {
+		assert.Equal(t, "snap-1", q["snapshot"], "every table is read from the one snapshot")
+	}
+	assert.Equal(t, []string{"snap-1"}, server.released)
+}
+
+func TestExportSnapshotRejectsCheckpoints(t *testing.T) {
+	client, server := newSnapshotClient(t, time.Now().Add(time.Minute))
+
+	_, err := client.ExportSnapshot(context.Background(), workersql.ExportSpec{
+		Table:      "orders",
+		Writer:     &bytes.Buffer{},
+		Checkpoint: &workersql.ExportCheckpoint{LastKey: []interface{}{10}},
+	})
+	assert.Error(t, err)
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	assert.Empty(t, server.queries)
+}
+
+func TestSnapshotRejectsWrites(t *testing.T) {
+	client, server := newSnapshotClient(t, time.Time{})
+
+	snap, err := client.BeginSnapshot(context.Background())
+	require.NoError(t, err)
+	defer snap.Release(context.Background())
+
+	for _, sql := range []string{
+		"UPDATE orders SET total = 0",
+		"  -- comment\n DELETE FROM orders",
+		"INSERT INTO orders VALUES (1)",
+		"WITH stale AS (SELECT id FROM orders WHERE total = 0) DELETE FROM orders WHERE id IN (SELECT id FROM stale)",
+		"SELECT * FROM orders WHERE id = 1 FOR UPDATE",
+	} {
+		_, err := snap.Query(context.Background(), sql)
+		assert.True(t, errors.Is(err, workersql.ErrReadOnly), sql)
+	}
+
+	server.mu.Lock()
+	assert.Empty(t, server.queries)
+	server.mu.Unlock()
+}
+
+func TestSnapshotExpiry(t *testing.T) {
+	client, _ := newSnapshotClient(t, time.Now().Add(-time.Second))
+
+	snap, err := client.BeginSnapshot(context.Background())
+	require.NoError(t, err)
+
+	_, err = snap.Query(context.Background(), "SELECT 1")
+	assert.ErrorIs(t, err, workersql.ErrSnapshotExpired)
+
+	client, _ = newSnapshotClient(t, time.Time{})
+	snap, err = client.BeginSnapshot(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, snap.Release(context.Background()))
+	_, err = snap.Query(context.Background(), "SELECT 1")
+	assert.ErrorIs(t, err, workersql.ErrSnapshotExpired)
+}
+
+func TestQueryAsOf(t *testing.T) {
+	client, server := newSnapshotClient(t, time.Time{})
+	ctx := context.Background()
+	asOf := time.Date(2024, 5, 1, 12, 30, 0, 0, time.FixedZone("CEST", 2*3600))
+
+	_, err := client.QueryWithOptions(ctx, "SELECT * FROM orders WHERE id = ?", []interface{}{7}, workersql.QueryOptions{AsOf: asOf})
+	require.NoError(t, err)
+	for _, sql := range []string{
+		"DELETE FROM orders",
+		"WITH stale AS (SELECT id FROM orders WHERE total = 0) DELETE FROM orders WHERE id IN (SELECT id FROM stale)",
+		"SELECT * FROM orders WHERE id = 1 FOR UPDATE",
+	} {
+		_, err = client.QueryWithOptions(ctx, sql, nil, workersql.QueryOptions{AsOf: asOf})
+		assert.ErrorIs(t, err, workersql.ErrReadOnly, sql)
+	}
+	_, err = client.QueryWithOptions(ctx, "SELECT 1", nil, workersql.QueryOptions{AsOf: time.Now().Add(time.Hour)})
+	assert.Error(t, err)
+	_, err = client.QueryWithOptions(ctx, "SELECT 1", nil, workersql.QueryOptions{AsOf: asOf, Snapshot: "snap-1"})
+	assert.Error(t, err)
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	require.Len(t, server.queries, 1)
+	assert.Equal(t, "2024-05-01T10:30:00Z", server.queries[0]["asOf"])
+}
+
+func TestSnapshotToken(t *testing.T) {
+	client, server := newSnapshotClient(t, time.Time{})
+	ctx := context.Background()
+
+	token, err := client.Snapshot(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "snap-1", token)
+	for i := 0; i < 2; i++ {
+		_, err = client.QueryWithOptions(ctx, "SELECT COUNT(*) AS n FROM orders", nil, workersql.QueryOptions{Snapshot: token})
+		require.NoError(t, err)
+	}
+	for _, sql := range []string{
+		"UPDATE orders SET total = 0",
+		"WITH paid AS (SELECT id FROM orders) UPDATE orders SET total = 0 WHERE id IN (SELECT id FROM paid)",
+		"SELECT * FROM orders WHERE id = 1 FOR SHARE",
+	} {
+		_, err = client.QueryWithOptions(ctx, sql, nil, workersql.QueryOptions{Snapshot: token})
+		assert.ErrorIs(t, err, workersql.ErrReadOnly, sql)
+	}
+	require.NoError(t, client.ReleaseSnapshot(ctx, token))
+
+	snap, err := client.BeginSnapshotAt(ctx, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), snap.AsOf())
+	_, err = client.BeginSnapshotAt(ctx, time.Now().Add(time.Minute))
+	assert.Error(t, err)
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	require.Len(t, server.queries, 2)
+	for _, q := range server.queries {
+		assert.Equal(t, "snap-1", q["snapshot"])
+		assert.Equal(t, map[string]interface{}{"consistency": "strong"}, q["hints"])
+	}
+	assert.Equal(t, []string{"snap-1"}, server.released)
+	require.Len(t, server.begun, 2)
+	assert.Nil(t, server.begun[0]["asOf"])
+	assert.Equal(t, "2024-05-01T00:00:00Z", server.begun[1]["asOf"])
+}
@@ -0,0 +1,138 @@
+package workersql_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersqltest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newStandbyClient(t *testing.T, primary, standby *workersqltest.MockServer, config workersql.StandbyConfig) *workersql.Client {
+	config.APIEndpoint = standby.URL
+	if config.CheckInterval == 0 {
+		config.CheckInterval = time.Hour
+	}
+	primaryConfig := primary.Config()
+	primaryConfig.Standby = &config
+	client, err := workersql.NewClient(primaryConfig)
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	// Wait for the first health checks, run when the client starts, and
+	// for their outcomes to be recorded
+	require.Eventually(t, func() bool {
+		return primary.HealthChecks() > 0 && standby.HealthChecks() > 0
+	}, 2*time.Second, time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	return client
+}
+
+func TestStandbyPromotesForReads(t *testing.T) {
+	primary, standby := workersqltest.NewMockServer(t), workersqltest.NewMockServer(t)
+	var promotions int32
+	client := newStandbyClient(t, primary, standby, workersql.StandbyConfig{
+		FailureThreshold: 2,
+		OnPromote:        func(error) { atomic.AddInt32(&promotions, 1) },
+	})
+	ctx := context.Background()
+
+	_, err := client.Query(ctx, "SELECT 1")
+	require.NoError(t, err)
+	assert.False(t, client.Standby().Promoted)
+
+	primary.SetAvailable(false)
+	for i := 0; i < 2; i++ {
+		_, err = client.Query(ctx, "SELECT 1")
+		assert.Error(t, err)
+	}
+	status := client.Standby()
+	assert.True(t, status.Promoted)
+	assert.Equal(t, 2, status.PrimaryFailures)
+	assert.Contains(t, status.LastError, "503")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&promotions))
+
+	queries := len(standby.Calls())
+	_, err = client.Query(ctx, "SELECT 1")
+	require.NoError(t, err)
+	assert.Len(t, standby.Calls(), queries+1)
+
+	// Writes don't fail over unless PromoteWrites is set
+	_, err = client.Exec(ctx, "UPDATE users SET name = ?", "ada")
+	assert.True(t, errors.Is(err, workersql.ErrStandbyWriteRefused))
+	assert.Len(t, standby.Calls(), queries+1)
+}
+
+func TestStandbyDemotesOnRecovery(t *testing.T) {
+	primary, standby := workersqltest.NewMockServer(t), workersqltest.NewMockServer(t)
+	demoted := make(chan time.Duration, 1)
+	primary.SetAvailable(false)
+	client := newStandbyClient(t, primary, standby, workersql.StandbyConfig{
+		CheckInterval:     10 * time.Millisecond,
+		FailureThreshold:  2,
+		RecoveryThreshold: 2,
+		OnDemote:          func(d time.Duration) { demoted <- d },
+	})
+
+	// Health checks alone promote the standby
+	require.Eventually(t, func() bool { return client.Standby().Promoted }, 2*time.Second, 5*time.Millisecond)
+	assert.True(t, client.Standby().StandbyHealthy)
+
+	primary.SetAvailable(true)
+	select {
+	case d := <-demoted:
+		assert.Greater(t, d, time.Duration(0))
+	case <-time.After(2 * time.Second):
+		t.Fatal("standby not demoted")
+	}
+	assert.False(t, client.Standby().Promoted)
+}
+
+func TestStandbyNotPromotedWhenUnhealthy(t *testing.T) {
+	primary, standby := workersqltest.NewMockServer(t), workersqltest.NewMockServer(t)
+	primary.SetAvailable(false)
+	standby.SetAvailable(false)
+	client := newStandbyClient(t, primary, standby, workersql.StandbyConfig{
+		CheckInterval:    10 * time.Millisecond,
+		FailureThreshold: 2,
+	})
+
+	require.Eventually(t, func() bool { return standby.HealthChecks() >= 3 }, 2*time.Second, 5*time.Millisecond)
+	status := client.Standby()
+	assert.False(t, status.StandbyHealthy)
+	assert.False(t, status.Promoted)
+}
+
+func TestStandbyWriteGuard(t *testing.T) {
+	primary, standby := workersqltest.NewMockServer(t), workersqltest.NewMockServer(t)
+	var allow int32
+	client := newStandbyClient(t, primary, standby, workersql.StandbyConfig{
+		FailureThreshold: 1,
+		PromoteWrites:    true,
+		WriteGuard: func(ctx context.Context, status workersql.StandbyStatus) error {
+			if atomic.LoadInt32(&allow) == 0 {
+				return errors.New("primary not fenced yet")
+			}
+			return nil
+		},
+	})
+	ctx := context.Background()
+
+	primary.SetAvailable(false)
+	_, err := client.Query(ctx, "SELECT 1")
+	require.Error(t, err)
+	require.True(t, client.Standby().Promoted)
+
+	_, err = client.Exec(ctx, "UPDATE users SET name = ?", "ada")
+	assert.True(t, errors.Is(err, workersql.ErrStandbyWriteRefused))
+	assert.Contains(t, err.Error(), "primary not fenced yet")
+
+	atomic.StoreInt32(&allow, 1)
+	_, err = client.Exec(ctx, "UPDATE users SET name = ?", "ada")
+	require.NoError(t, err)
+	assert.Len(t, standby.Calls(), 1)
+}
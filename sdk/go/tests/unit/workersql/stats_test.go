@@ -0,0 +1,149 @@
+package workersql_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientStats(t *testing.T) {
+	client, _ := newMapperClient(t, map[string]string{
+		"SELECT cached": `{"success": true, "cached": true, "data": []}`,
+		"SELECT bad":    `{"success": false, "error": {"code": "INVALID_QUERY", "message": "bad"}}`,
+		"SELECT":        `{"success": true, "data": []}`,
+	})
+	ctx := context.Background()
+
+	_, _ = client.Query(ctx, "SELECT 1")
+	_, _ = client.Query(ctx, "SELECT cached")
+	_, _ = client.Query(ctx, "SELECT bad")
+	_, _ = client.Exec(ctx, "DELETE FROM sessions")
+
+	stats := client.Stats()
+	assert.Equal(t, int64(4), stats.Queries)
+	assert.Equal(t, int64(1), stats.Errors)
+	assert.Equal(t, int64(1), stats.CacheHits)
+	assert.Equal(t, int64(4), stats.Latency.Count)
+	assert.Len(t, stats.Latency.Counts, len(workersql.DefaultLatencyBuckets)+1)
+	assert.Nil(t, stats.Pool)
+
+	later := client.Stats()
+	assert.Equal(t, int64(0), later.Sub(stats).Queries)
+}
+
+func TestLatencyHistogramQuantile(t *testing.T) {
+	h := workersql.LatencyHistogram{
+		Bounds: []time.Duration{time.Millisecond, 10 * time.Millisecond, 100 * time.Millisecond},
+		Counts: []int64{90, 9, 0, 1},
+		Count:  100,
+		Sum:    500 * time.Millisecond,
+	}
+	assert.Equal(t, time.Millisecond, h.Quantile(0.5))
+	assert.Equal(t, 10*time.Millisecond, h.Quantile(0.99))
+	assert.Equal(t, 100*time.Millisecond, h.Quantile(1), "overflow reports the largest bound")
+	assert.Equal(t, 5*time.Millisecond, h.Mean())
+}
+
+func TestStatsReporter(t *testing.T) {
+	client, _ := newMapperClient(t, map[string]string{"SELECT": `{"success": true, "data": []}`})
+	ctx := context.Background()
+
+	var (
+		mu      sync.Mutex
+		reports []workersql.StatsReport
+	)
+	stop, err := client.StartStatsReporter(workersql.StatsReporterOptions{
+		Interval: time.Hour,
+		Sink: workersql.StatsSinkFunc(func(r workersql.StatsReport) error {
+			mu.Lock()
+			reports = append(reports, r)
+			mu.Unlock()
+			return nil
+		}),
+	})
+	require.NoError(t, err)
+
+	_, _ = client.Query(ctx, "SELECT 1")
+	_, _ = client.Query(ctx, "SELECT 2")
+	stop()
+	stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, reports, 1, "stop flushes the partial interval once")
+	assert.Equal(t, int64(2), reports[0].Stats.Queries)
+	assert.Greater(t, reports[0].Interval, time.Duration(0))
+
+	_, err = client.StartStatsReporter(workersql.StatsReporterOptions{})
+	assert.Error(t, err)
+}
+
+func TestStatsDSink(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	sink, err := workersql.NewStatsDSink(listener.LocalAddr().String(), "app.sql")
+	require.NoError(t, err)
+	defer sink.Close()
+
+	err = sink.Report(workersql.StatsReport{Stats: workersql.Stats{
+		Queries: 5,
+		Errors:  1,
+		Latency: workersql.LatencyHistogram{
+			Bounds: []time.Duration{10 * time.Millisecond},
+			Counts: []int64{4, 1},
+			Count:  5,
+			Sum:    50 * time.Millisecond,
+		},
+		Pool: map[string]interface{}{"active": 2, "idle": 3},
+	}})
+	require.NoError(t, err)
+
+	buf := make([]byte, 2048)
+	require.NoError(t, listener.SetReadDeadline(time.Now().Add(time.Second)))
+	n, _, err := listener.ReadFrom(buf)
+	require.NoError(t, err)
+	lines := strings.Split(string(buf[:n]), "\n")
+
+	assert.Contains(t, lines, "app.sql.queries:5|c")
+	assert.Contains(t, lines, "app.sql.errors:1|c")
+	assert.Contains(t, lines, "app.sql.latency.mean:10|ms")
+	assert.Contains(t, lines, "app.sql.latency.le_10ms:4|c")
+	assert.Contains(t, lines, "app.sql.latency.le_inf:1|c")
+	assert.Contains(t, lines, "app.sql.pool.active:2|g")
+}
+
+func TestStatsCountRetries(t *testing.T) {
+	var seen int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&seen, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"code": "RESOURCE_LIMIT", "message": "busy"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"success": true, "data": []}`))
+	}))
+	defer srv.Close()
+	client, err := workersql.NewClient(workersql.Config{
+		APIEndpoint:   srv.URL,
+		RetryAttempts: 3,
+		RetryDelay:    time.Millisecond,
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	_, err = client.Query(context.Background(), "SELECT 1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), client.Stats().Retries)
+}
@@ -0,0 +1,130 @@
+package workersql_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// changeRecorder collects the IDs of the changes delivered to a handler
+type changeRecorder struct {
+	mu   sync.Mutex
+	ids  []int64
+	fail map[int64]bool
+}
+
+func (r *changeRecorder) handle(_ context.Context, change workersql.ChangeEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fail[change.ID] {
+		delete(r.fail, change.ID)
+		return errors.New("handler down")
+	}
+	r.ids = append(r.ids, change.ID)
+	return nil
+}
+
+func (r *changeRecorder) delivered() []int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]int64(nil), r.ids...)
+}
+
+func TestSubscribe(t *testing.T) {
+	client, server := newChangeLogClient(t, workersql.Config{})
+	server.write("orders") // before subscribing: not delivered
+
+	recorder := &changeRecorder{}
+	sub, err := client.SubscribeWithOptions(context.Background(), "orders", recorder.handle, workersql.SubscriptionOptions{PollInterval: 5 * time.Millisecond})
+	require.NoError(t, err)
+	defer sub.Close()
+	assert.Equal(t, "orders", sub.Table())
+
+	server.write("orders")
+	server.write("users")
+	server.write("ORDERS")
+	require.Eventually(t, func() bool { return len(recorder.delivered()) == 2 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []int64{2, 4}, recorder.delivered())
+	require.Eventually(t, func() bool { return sub.Offsets()[""] == 4 }, time.Second, 5*time.Millisecond)
+
+	sub.Close()
+	select {
+	case <-sub.Done():
+	default:
+		t.Fatal("Done isn't closed after Close")
+	}
+}
+
+func TestSubscribeResumesAfterReconnect(t *testing.T) {
+	client, server := newChangeLogClient(t, workersql.Config{})
+	recorder := &changeRecorder{}
+	var mu sync.Mutex
+	var errs []error
+	sub, err := client.SubscribeWithOptions(context.Background(), "orders", recorder.handle, workersql.SubscriptionOptions{
+		PollInterval: 5 * time.Millisecond,
+		OnError:      func(err error) { mu.Lock(); errs = append(errs, err); mu.Unlock() },
+	})
+	require.NoError(t, err)
+	defer sub.Close()
+
+	server.write("orders")
+	require.Eventually(t, func() bool { return len(recorder.delivered()) == 1 }, time.Second, 5*time.Millisecond)
+
+	// Changes made while the gateway is unreachable are delivered once it
+	// is back
+	server.SetAvailable(false)
+	server.write("orders")
+	server.write("orders")
+	require.Eventually(t, func() bool { mu.Lock(); defer mu.Unlock(); return len(errs) > 0 }, time.Second, 5*time.Millisecond)
+	server.SetAvailable(true)
+	require.Eventually(t, func() bool { return len(recorder.delivered()) == 3 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []int64{1, 2, 3}, recorder.delivered())
+}
+
+func TestSubscribeRedeliversFailedBatch(t *testing.T) {
+	client, server := newChangeLogClient(t, workersql.Config{})
+	recorder := &changeRecorder{fail: map[int64]bool{2: true}}
+	sub, err := client.SubscribeWithOptions(context.Background(), "orders", recorder.handle, workersql.SubscriptionOptions{PollInterval: 5 * time.Millisecond})
+	require.NoError(t, err)
+	defer sub.Close()
+
+	server.write("orders")
+	server.write("orders")
+	require.Eventually(t, func() bool { return len(recorder.delivered()) >= 3 }, time.Second, 5*time.Millisecond)
+	// At least once: change 1, handled before 2 failed, is delivered again
+	assert.Equal(t, []int64{1, 1, 2}, recorder.delivered())
+}
+
+func TestSubscribeFromOffsets(t *testing.T) {
+	client, server := newChangeLogClient(t, workersql.Config{})
+	for i := 0; i < 3; i++ {
+		server.write("orders")
+	}
+	recorder := &changeRecorder{}
+	sub, err := client.SubscribeWithOptions(context.Background(), "orders", recorder.handle, workersql.SubscriptionOptions{
+		After:        workersql.ChangeOffsets{"": 1},
+		PollInterval: 5 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	defer sub.Close()
+	require.Eventually(t, func() bool { return len(recorder.delivered()) == 2 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []int64{2, 3}, recorder.delivered())
+}
+
+func TestSubscriptionStopsWithClient(t *testing.T) {
+	client, _ := newChangeLogClient(t, workersql.Config{})
+	sub, err := client.SubscribeWithOptions(context.Background(), "orders", (&changeRecorder{}).handle, workersql.SubscriptionOptions{PollInterval: 5 * time.Millisecond})
+	require.NoError(t, err)
+	require.NoError(t, client.Close())
+	select {
+	case <-sub.Done():
+	case <-time.After(time.Second):
+		t.Fatal("the subscription outlived its client")
+	}
+}
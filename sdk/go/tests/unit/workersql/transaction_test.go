@@ -0,0 +1,381 @@
+package workersql_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	gws "github.com/gorilla/websocket"
+	"github.com/healthfees-org/workersql/sdk/go/internal/websocket"
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTxServer starts a gateway stub whose WebSocket endpoint answers every
+// frame. reject, if set, decides whether a begin frame is refused with
+// TOO_MANY_TRANSACTIONS.
+func newTxServer(t *testing.T, reject func() bool) *httptest.Server {
+	upgrader := gws.Upgrader{}
+	var txCounter int64
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		for {
+			var msg websocket.Message
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			reply := websocket.Message{Type: websocket.FrameResponse, ID: msg.ID}
+			switch msg.Type {
+			case websocket.FrameBegin:
+				if reject != nil && reject() {
+					reply.Type = websocket.FrameError
+					reply.Error = map[string]interface{}{"code": "TOO_MANY_TRANSACTIONS", "message": "shard busy"}
+					break
+				}
+				n := atomic.AddInt64(&txCounter, 1)
+				reply.Data = map[string]interface{}{"transactionId": fmt.Sprintf("tx_%d", n)}
+			default:
+				reply.Data = map[string]interface{}{"success": true}
+			}
+			if err := conn.WriteJSON(reply); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestBeginTxQueuesAtClientLimit(t *testing.T) {
+	srv := newTxServer(t, nil)
+	client, err := workersql.NewClient(workersql.Config{
+		APIEndpoint:               srv.URL,
+		MaxConcurrentTransactions: 1,
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx := context.Background()
+	first, err := client.BeginTx(ctx)
+	require.NoError(t, err)
+
+	started := make(chan error, 1)
+	go func() {
+		tx, err := client.BeginTx(ctx)
+		if err == nil {
+			err = tx.Commit(ctx)
+		}
+		started <- err
+	}()
+
+	assert.Eventually(t, func() bool { return client.TransactionQueueDepth() == 1 }, time.Second, time.Millisecond)
+
+	require.NoError(t, first.Commit(ctx))
+	require.NoError(t, <-started)
+	assert.Equal(t, 0, client.TransactionQueueDepth())
+}
+
+func TestBeginTxRespectsDeadlineWhileQueued(t *testing.T) {
+	srv := newTxServer(t, nil)
+	client, err := workersql.NewClient(workersql.Config{
+		APIEndpoint:               srv.URL,
+		MaxConcurrentTransactions: 1,
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	tx, err := client.BeginTx(context.Background())
+	require.NoError(t, err)
+	defer tx.Rollback(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err = client.BeginTx(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 0, client.TransactionQueueDepth())
+}
+
+func TestBeginTxWaitsForServerLimit(t *testing.T) {
+	var rejections int32 = 2
+	srv := newTxServer(t, func() bool {
+		return atomic.AddInt32(&rejections, -1) >= 0
+	})
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL})
+	require.NoError(t, err)
+	defer client.Close()
+
+	tx, err := client.BeginTx(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit(context.Background()))
+
+	assert.ErrorIs(t, tx.Commit(context.Background()), workersql.ErrTxDone)
+	_, err = tx.Query(context.Background(), "SELECT 1")
+	assert.ErrorIs(t, err, workersql.ErrTxDone)
+}
+
+// newConflictTxServer starts a gateway stub that fails the commit of the
+// first conflicts transactions with code, counting the begin frames
+func newConflictTxServer(t *testing.T, code string, conflicts int32, begins *int32) *httptest.Server {
+	upgrader := gws.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		for {
+			var msg websocket.Message
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			reply := websocket.Message{Type: websocket.FrameResponse, ID: msg.ID}
+			switch msg.Type {
+			case websocket.FrameBegin:
+				n := atomic.AddInt32(begins, 1)
+				reply.Data = map[string]interface{}{"transactionId": fmt.Sprintf("tx_%d", n)}
+			case websocket.FrameCommit:
+				if atomic.AddInt32(&conflicts, -1) >= 0 {
+					reply.Type = websocket.FrameError
+					reply.Error = map[string]interface{}{"code": code, "message": "aborted"}
+					break
+				}
+				reply.Data = map[string]interface{}{"success": true}
+			default:
+				reply.Data = map[string]interface{}{"success": true}
+			}
+			if err := conn.WriteJSON(reply); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestTransactionWithRetryReplaysOnConflict(t *testing.T) {
+	var begins int32
+	srv := newConflictTxServer(t, "DEADLOCK", 2, &begins)
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL})
+	require.NoError(t, err)
+	defer client.Close()
+
+	calls := 0
+	err = client.TransactionWithRetry(context.Background(), func(ctx context.Context, tx *workersql.TransactionClient) error {
+		calls++
+		_, err := tx.Exec(ctx, "UPDATE accounts SET balance = balance - 1 WHERE id = ?", 1)
+		return err
+	}, workersql.TxRetryOptions{Backoff: time.Millisecond})
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls)
+	assert.EqualValues(t, 3, atomic.LoadInt32(&begins))
+}
+
+func TestTransactionWithRetryGivesUp(t *testing.T) {
+	var begins int32
+	srv := newConflictTxServer(t, "SERIALIZATION_FAILURE", 5, &begins)
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL})
+	require.NoError(t, err)
+	defer client.Close()
+
+	noop := func(ctx context.Context, tx *workersql.TransactionClient) error { return nil }
+	err = client.TransactionWithRetry(context.Background(), noop, workersql.TxRetryOptions{MaxAttempts: 2, Backoff: time.Millisecond})
+	assert.ErrorIs(t, err, workersql.ErrConflict)
+	assert.EqualValues(t, 2, atomic.LoadInt32(&begins))
+
+	atomic.StoreInt32(&begins, 0)
+	err = client.TransactionWithRetry(context.Background(), noop, workersql.TxRetryOptions{RetryOn: []workersql.ErrorCode{workersql.ErrorCodeDeadlock}})
+	assert.ErrorIs(t, err, workersql.ErrConflict)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&begins), "conflicts aren't retried when only deadlocks are")
+}
+
+// newHTTPTxServer starts a gateway stub without WebSockets that serves
+// transactions over HTTP, recording the paths it is sent. commitCode, if
+// set, fails every commit with that error code.
+func newHTTPTxServer(t *testing.T, commitCode string) (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/transactions":
+			fmt.Fprint(w, `{"transactionId":"tx 1"}`)
+		case "/transactions/tx%201/query", "/transactions/tx 1/query":
+			var statement websocket.Statement
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&statement))
+			if statement.Mode == "exec" {
+				fmt.Fprint(w, `{"success":true,"affectedRows":1}`)
+			} else {
+				fmt.Fprint(w, `{"success":true,"data":[{"id":1}],"rowCount":1}`)
+			}
+		case "/transactions/tx%201/commit", "/transactions/tx 1/commit":
+			if commitCode != "" {
+				w.WriteHeader(http.StatusConflict)
+				fmt.Fprintf(w, `{"code":%q,"message":"aborted"}`, commitCode)
+				return
+			}
+			fmt.Fprint(w, `{"success":true}`)
+		case "/transactions/tx%201/rollback", "/transactions/tx 1/rollback":
+			fmt.Fprint(w, `{"success":true}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), paths...)
+	}
+}
+
+func TestHTTPTransactionTransport(t *testing.T) {
+	srv, paths := newHTTPTxServer(t, "")
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL, TransactionTransport: workersql.TransactionTransportHTTP})
+	require.NoError(t, err)
+	defer client.Close()
+
+	err = client.Transaction(context.Background(), func(ctx context.Context, tx *workersql.TransactionClient) error {
+		exec, err := tx.Exec(ctx, "UPDATE accounts SET balance = 0 WHERE id = ?", 1)
+		require.NoError(t, err)
+		assert.EqualValues(t, 1, exec.AffectedRows)
+		resp, err := tx.Query(ctx, "SELECT id FROM accounts")
+		require.NoError(t, err)
+		assert.Len(t, resp.Data, 1)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"POST /transactions",
+		"POST /transactions/tx 1/query",
+		"POST /transactions/tx 1/query",
+		"POST /transactions/tx 1/commit",
+	}, paths())
+}
+
+func TestTransactionTransportFallsBackToHTTP(t *testing.T) {
+	srv, paths := newHTTPTxServer(t, "")
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL})
+	require.NoError(t, err)
+	defer client.Close()
+
+	for i := 0; i < 2; i++ {
+		tx, err := client.BeginTx(context.Background())
+		require.NoError(t, err, "the failed WebSocket dial falls back to HTTP")
+		require.NoError(t, tx.Rollback(context.Background()))
+	}
+	dials := 0
+	for _, path := range paths() {
+		if strings.HasPrefix(path, "GET ") {
+			dials++
+		}
+	}
+	assert.Equal(t, 1, dials, "only the first transaction tried a WebSocket")
+
+	wsOnly, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL, TransactionTransport: workersql.TransactionTransportWebSocket})
+	require.NoError(t, err)
+	defer wsOnly.Close()
+	_, err = wsOnly.BeginTx(context.Background())
+	assert.Error(t, err)
+
+	_, err = workersql.NewClient(workersql.Config{APIEndpoint: srv.URL, TransactionTransport: "carrier-pigeon"})
+	assert.Error(t, err)
+}
+
+func TestHTTPTransactionTypedErrors(t *testing.T) {
+	srv, paths := newHTTPTxServer(t, "DEADLOCK")
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL, TransactionTransport: workersql.TransactionTransportHTTP})
+	require.NoError(t, err)
+	defer client.Close()
+
+	noop := func(ctx context.Context, tx *workersql.TransactionClient) error { return nil }
+	err = client.TransactionWithRetry(context.Background(), noop, workersql.TxRetryOptions{MaxAttempts: 2, Backoff: time.Millisecond})
+	assert.ErrorIs(t, err, workersql.ErrDeadlock)
+	assert.Len(t, paths(), 4, "the transaction ran twice")
+}
+
+// newLockingTxServer answers locking reads with NOWAIT as if their rows
+// were locked by another transaction
+func newLockingTxServer(t *testing.T) *httptest.Server {
+	upgrader := gws.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		for {
+			var msg websocket.Message
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			reply := websocket.Message{Type: websocket.FrameResponse, ID: msg.ID, Data: map[string]interface{}{"success": true}}
+			switch {
+			case msg.Type == websocket.FrameBegin:
+				reply.Data = map[string]interface{}{"transactionId": "tx_1"}
+			case strings.HasSuffix(msg.SQL, "NOWAIT"):
+				reply.Type = websocket.FrameError
+				reply.Error = map[string]interface{}{"code": "ER_LOCK_NOWAIT", "message": "lock not available"}
+			}
+			if err := conn.WriteJSON(reply); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestQueryLocked(t *testing.T) {
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: newLockingTxServer(t).URL})
+	require.NoError(t, err)
+	defer client.Close()
+	var sent []string
+	defer client.OnQuery(func(e workersql.QueryEvent) { sent = append(sent, e.SQL) })()
+
+	err = client.Transaction(context.Background(), func(ctx context.Context, tx *workersql.TransactionClient) error {
+		_, err := tx.QueryForUpdate(ctx, "SELECT stock FROM inventory WHERE sku = ?;", "A1")
+		require.NoError(t, err)
+		_, err = tx.QueryLocked(ctx, workersql.LockForShare|workersql.LockSkipLocked, "SELECT id FROM jobs LIMIT 10")
+		require.NoError(t, err)
+
+		_, err = tx.QueryLocked(ctx, workersql.LockForUpdate|workersql.LockNoWait, "SELECT stock FROM inventory WHERE sku = ?", "A1")
+		assert.ErrorIs(t, err, workersql.ErrLockNotAvailable)
+
+		_, err = tx.QueryLocked(ctx, workersql.LockNoWait|workersql.LockSkipLocked, "SELECT 1")
+		assert.Error(t, err)
+		_, err = tx.QueryForUpdate(ctx, "UPDATE inventory SET stock = 0")
+		assert.Error(t, err)
+		_, err = tx.QueryForUpdate(ctx, "SELECT * FROM t FOR SHARE")
+		assert.Error(t, err)
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"SELECT stock FROM inventory WHERE sku = ? FOR UPDATE",
+		"SELECT id FROM jobs LIMIT 10 FOR SHARE SKIP LOCKED",
+		"SELECT stock FROM inventory WHERE sku = ? FOR UPDATE NOWAIT",
+	}, sent)
+}
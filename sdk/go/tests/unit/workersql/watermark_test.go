@@ -0,0 +1,144 @@
+package workersql_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersqltest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type changedRow struct {
+	ID        int
+	UpdatedAt string
+}
+
+// changedTable holds rows served in (updated_at, id) order, honouring the
+// keyset condition of each query
+type changedTable struct {
+	mu   sync.Mutex
+	rows []changedRow
+}
+
+func (tbl *changedTable) set(id int, updatedAt string) {
+	tbl.mu.Lock()
+	defer tbl.mu.Unlock()
+	for i := range tbl.rows {
+		if tbl.rows[i].ID == id {
+			tbl.rows[i].UpdatedAt = updatedAt
+			return
+		}
+	}
+	tbl.rows = append(tbl.rows, changedRow{id, updatedAt})
+}
+
+func (tbl *changedTable) query(call workersqltest.Call) workersqltest.Result {
+	tbl.mu.Lock()
+	defer tbl.mu.Unlock()
+	rows := append([]changedRow(nil), tbl.rows...)
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].UpdatedAt != rows[j].UpdatedAt {
+			return rows[i].UpdatedAt < rows[j].UpdatedAt
+		}
+		return rows[i].ID < rows[j].ID
+	})
+	var result workersqltest.Result
+	for _, row := range rows {
+		if strings.Contains(call.SQL, "WHERE (`updated_at`, `id`) > (?, ?)") {
+			after, afterID := call.Params[0].(string), int(call.Params[1].(float64))
+			if row.UpdatedAt < after || (row.UpdatedAt == after && row.ID <= afterID) {
+				continue
+			}
+		}
+		result.Rows = append(result.Rows, map[string]interface{}{"id": row.ID, "updated_at": row.UpdatedAt})
+	}
+	return result
+}
+
+func TestExportIncremental(t *testing.T) {
+	table := &changedTable{}
+	table.set(1, "2024-01-01")
+	table.set(2, "2024-01-02")
+	table.set(3, "2024-01-02")
+	server := workersqltest.NewMockServer(t)
+	all := func(workersqltest.Call) bool { return true }
+	server.OnMatch(all).Respond(table.query)
+	client := server.NewClient(t)
+
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "watermarks.json")
+	store := workersql.NewFileWatermarkStore(path)
+	run := func() (*workersql.Watermark, string, error) {
+		var out bytes.Buffer
+		watermark, err := client.ExportIncremental(ctx, workersql.IncrementalExportSpec{
+			ExportSpec:      workersql.ExportSpec{Table: "users", Writer: &out},
+			WatermarkColumn: "updated_at",
+			Store:           store,
+		})
+		return watermark, out.String(), err
+	}
+
+	watermark, out, err := run()
+	require.NoError(t, err)
+	assert.Equal(t, "id,updated_at\n1,2024-01-01\n2,2024-01-02\n3,2024-01-02\n", out)
+	assert.Equal(t, int64(3), watermark.Rows)
+	assert.Equal(t, "SELECT * FROM `users` ORDER BY `updated_at`, `id` LIMIT 1000", server.Calls()[0].SQL)
+
+	table.set(1, "2024-01-03")
+	table.set(4, "2024-01-02")
+	watermark, out, err = run()
+	require.NoError(t, err)
+	assert.Equal(t, "id,updated_at\n4,2024-01-02\n1,2024-01-03\n", out)
+	assert.Equal(t, int64(2), watermark.Rows)
+
+	// A failed run leaves the watermark where it was
+	table.set(5, "2024-01-04")
+	server.OnMatch(all).Fail("INVALID_QUERY", "boom").Times(1)
+	_, _, err = run()
+	require.Error(t, err)
+	_, out, err = run()
+	require.NoError(t, err)
+	assert.Equal(t, "id,updated_at\n5,2024-01-04\n", out)
+
+	// Nothing changed: no rows, and the watermark stays put
+	watermark, out, err = run()
+	require.NoError(t, err)
+	assert.Equal(t, "", out)
+	assert.Equal(t, int64(0), watermark.Rows)
+	assert.Equal(t, "2024-01-04", watermark.Position[0])
+
+	saved, err := workersql.NewFileWatermarkStore(path).LoadWatermark(ctx, "users")
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"2024-01-04", json.Number("5")}, saved.Position)
+}
+
+func TestExportIncrementalRejectsOtherColumn(t *testing.T) {
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: "http://127.0.0.1:1"})
+	require.NoError(t, err)
+	defer client.Close()
+	ctx := context.Background()
+	store := workersql.NewFileWatermarkStore(filepath.Join(t.TempDir(), "watermarks.json"))
+	require.NoError(t, store.SaveWatermark(ctx, "users", &workersql.Watermark{Column: "updated_at", Position: []interface{}{"2024-01-01", 1}}))
+
+	_, err = client.ExportIncremental(ctx, workersql.IncrementalExportSpec{
+		ExportSpec:      workersql.ExportSpec{Table: "users", Writer: &bytes.Buffer{}},
+		WatermarkColumn: "version",
+		Store:           store,
+	})
+	assert.ErrorContains(t, err, `on column "updated_at"`)
+
+	_, err = client.ExportIncremental(ctx, workersql.IncrementalExportSpec{
+		ExportSpec:      workersql.ExportSpec{Query: "SELECT * FROM users", Writer: &bytes.Buffer{}},
+		WatermarkColumn: "updated_at",
+		Store:           store,
+	})
+	assert.ErrorContains(t, err, "Name is required")
+}
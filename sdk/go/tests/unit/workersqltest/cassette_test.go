@@ -0,0 +1,79 @@
+package workersqltest_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersqltest"
+)
+
+func TestCassetteRecordsAndReplays(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassettes", "users.json")
+	ctx := context.Background()
+	exercise := func(t *testing.T, client *workersql.Client) {
+		row, err := client.QueryRow(ctx, "SELECT id, name FROM users WHERE token = ?", "s3cret-token")
+		require.NoError(t, err)
+		assert.Equal(t, "ada", row["name"])
+
+		err = client.Transaction(ctx, func(ctx context.Context, tx *workersql.TransactionClient) error {
+			_, err := tx.Exec(ctx, "UPDATE users SET name = ? WHERE id = ?", "grace", 1)
+			return err
+		})
+		require.NoError(t, err)
+	}
+
+	t.Run("record", func(t *testing.T) {
+		server := workersqltest.NewMockServer(t)
+		server.On("SELECT id, name FROM users WHERE token = ?").Return(map[string]interface{}{"id": 1, "name": "ada"})
+		mode := workersqltest.CassetteRecord
+		cassette := workersqltest.NewCassette(t, path, workersqltest.CassetteOptions{
+			Mode:    &mode,
+			Secrets: []string{"s3cret-token"},
+		})
+		assert.True(t, cassette.Recording())
+		config := server.Config()
+		config.APIKey = "api-key"
+		exercise(t, cassette.NewClient(t, config))
+	})
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), "s3cret-token")
+	assert.NotContains(t, string(content), "api-key")
+	assert.Contains(t, string(content), workersqltest.Redacted)
+	assert.Contains(t, string(content), `"path": "/transactions"`)
+
+	t.Run("replay", func(t *testing.T) {
+		cassette := workersqltest.NewCassette(t, path, workersqltest.CassetteOptions{Secrets: []string{"s3cret-token"}})
+		assert.False(t, cassette.Recording())
+		// Nothing listens here; every answer comes from the cassette
+		exercise(t, cassette.NewClient(t, workersql.Config{APIEndpoint: "http://127.0.0.1:1", RetryAttempts: 1}))
+	})
+}
+
+func TestCassetteFailsOnUnrecordedRequests(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"interactions": []}`), 0o644))
+
+	f := &failures{TB: t}
+	cassette := workersqltest.NewCassette(f, path, workersqltest.CassetteOptions{})
+	client := cassette.NewClient(t, workersql.Config{APIEndpoint: "http://127.0.0.1:1", RetryAttempts: 1})
+
+	_, err := client.Query(context.Background(), "SELECT 1")
+	require.Error(t, err)
+	require.Len(t, f.messages, 1)
+	assert.Contains(t, f.messages[0], "has no POST /query")
+}
+
+func TestCassetteMissingFile(t *testing.T) {
+	f := &failures{TB: t}
+	workersqltest.NewCassette(f, filepath.Join(t.TempDir(), "missing.json"), workersqltest.CassetteOptions{})
+	require.NotEmpty(t, f.messages)
+	assert.Contains(t, f.messages[0], "WORKERSQL_RECORD=1")
+}
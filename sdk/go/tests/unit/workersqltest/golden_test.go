@@ -0,0 +1,98 @@
+package workersqltest_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersqltest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failures captures the failures reported to it instead of failing the
+// test
+type failures struct {
+	testing.TB
+	messages []string
+}
+
+func (f *failures) Errorf(format string, args ...interface{}) {
+	f.messages = append(f.messages, fmt.Sprintf(format, args...))
+}
+
+func (f *failures) Fatalf(format string, args ...interface{}) {
+	f.messages = append(f.messages, fmt.Sprintf(format, args...))
+}
+
+func newHTTPClient(t *testing.T) *workersql.Client {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"success": true, "data": []}`))
+	}))
+	t.Cleanup(srv.Close)
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL, RetryAttempts: 1})
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// loadOrders is the code path under test, loading the items of orders one
+// by one when perOrder is set
+func loadOrders(client *workersql.Client, ids []int, perOrder bool) {
+	ctx := context.Background()
+	_, _ = client.Query(ctx, "SELECT * FROM orders WHERE customer_id = ?", 7)
+	if !perOrder {
+		_, _ = client.Query(ctx, "SELECT * FROM order_items WHERE order_id IN (?)", ids)
+		return
+	}
+	for _, id := range ids {
+		_, _ = client.Query(ctx, "SELECT * FROM order_items WHERE order_id = ?", id)
+	}
+}
+
+func TestAssertGolden(t *testing.T) {
+	client := newHTTPClient(t)
+	path := filepath.Join(t.TempDir(), "testdata", "orders.golden")
+
+	rec := workersqltest.RecordQueries(t, client)
+	_, _ = client.Exec(context.Background(), "DELETE FROM carts") // fixture setup
+	rec.Reset()
+	loadOrders(client, []int{1, 2}, false)
+
+	t.Setenv(workersqltest.UpdateGoldenEnv, "1")
+	workersqltest.AssertGolden(t, rec, path)
+	golden, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "Query SELECT * FROM orders WHERE customer_id = ?\nQuery SELECT * FROM order_items WHERE order_id IN (?+)\n", string(golden))
+
+	t.Setenv(workersqltest.UpdateGoldenEnv, "")
+	rec.Reset()
+	loadOrders(client, []int{3, 4, 5}, false)
+	workersqltest.AssertGolden(t, rec, path)
+
+	rec.Reset()
+	loadOrders(client, []int{3, 4}, true)
+	f := &failures{TB: t}
+	workersqltest.AssertGolden(f, rec, path)
+	require.Len(t, f.messages, 1)
+	assert.Contains(t, f.messages[0], "  Query SELECT * FROM orders WHERE customer_id = ?\n"+
+		"+ Query SELECT * FROM order_items WHERE order_id = ?\n"+
+		"+ Query SELECT * FROM order_items WHERE order_id = ?\n"+
+		"- Query SELECT * FROM order_items WHERE order_id IN (?+)\n")
+}
+
+func TestAssertGoldenMissingFile(t *testing.T) {
+	client := newHTTPClient(t)
+	rec := workersqltest.RecordQueries(t, client)
+	_, _ = client.Query(context.Background(), "SELECT 1")
+
+	f := &failures{TB: t}
+	workersqltest.AssertGolden(f, rec, filepath.Join(t.TempDir(), "missing.golden"))
+	require.NotEmpty(t, f.messages)
+	assert.Contains(t, f.messages[0], workersqltest.UpdateGoldenEnv+"=1")
+}
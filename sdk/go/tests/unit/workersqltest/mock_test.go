@@ -0,0 +1,187 @@
+package workersqltest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersqltest"
+)
+
+func TestMockServerQueries(t *testing.T) {
+	server := workersqltest.NewMockServer(t)
+	server.On("SELECT id, name FROM users WHERE id = ?").Return(map[string]interface{}{"id": 1, "name": "ada"})
+	server.On("INSERT INTO users (name) VALUES (?)").ReturnExec(1, 42)
+	server.On("DELETE FROM users").Fail("ER_ACCESS_DENIED", "denied")
+	client := server.NewClient(t)
+	ctx := context.Background()
+
+	row, err := client.QueryRow(ctx, "SELECT id, name FROM users WHERE id = ?", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "ada", row["name"])
+
+	res, err := client.Exec(ctx, "INSERT INTO users (name) VALUES (?)", "grace")
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), res.LastInsertID)
+
+	del, err := client.Exec(ctx, "DELETE FROM users")
+	require.NoError(t, err)
+	assert.False(t, del.Success)
+	assert.Equal(t, "ER_ACCESS_DENIED", del.Error.Code)
+
+	batch, err := client.BatchQuery(ctx, []workersql.BatchStatement{
+		{SQL: "SELECT id, name FROM users WHERE id = ?", Params: []interface{}{2}},
+		{SQL: "SELECT 1"},
+	}, workersql.BatchOptions{})
+	require.NoError(t, err)
+	require.Len(t, batch.Results, 2)
+	assert.Equal(t, "ada", batch.Results[0].Data[0]["name"])
+
+	health, err := client.Health(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "healthy", health.Status)
+	server.SetHealthy(false)
+	_, err = client.Health(ctx)
+	assert.Error(t, err)
+
+	calls := server.Calls()
+	require.Len(t, calls, 5)
+	assert.Equal(t, workersqltest.OpQuery, calls[0].Op)
+	assert.Equal(t, "SELECT id, name FROM users WHERE id = ?", calls[0].SQL)
+	assert.Equal(t, []interface{}{1.0}, calls[0].Params)
+	assert.Len(t, calls[0].Header.Get(workersql.QueryIDHeader), 32, "request headers are recorded")
+	assert.Equal(t, workersqltest.OpExec, calls[1].Op)
+	assert.Equal(t, workersqltest.OpBatch, calls[3].Op)
+}
+
+func TestMockServerRulePrecedence(t *testing.T) {
+	server := workersqltest.NewMockServer(t)
+	server.On("SELECT name FROM users WHERE id IN (?)").Return(map[string]interface{}{"name": "default"})
+	server.On("SELECT name FROM users WHERE id IN (?)").Return(map[string]interface{}{"name": "once"}).Times(1)
+	client := server.NewClient(t)
+	ctx := context.Background()
+
+	// IN lists of any length share the fingerprint
+	resp, err := client.Query(ctx, "SELECT name FROM users WHERE id IN (?)", []int{1, 2, 3})
+	require.NoError(t, err)
+	assert.Equal(t, "once", resp.Data[0]["name"])
+	resp, err = client.Query(ctx, "SELECT name FROM users WHERE id IN (?)", []int{4})
+	require.NoError(t, err)
+	assert.Equal(t, "default", resp.Data[0]["name"])
+
+	// Unscripted statements succeed without rows
+	resp, err = client.Query(ctx, "SELECT * FROM orders")
+	require.NoError(t, err)
+	assert.True(t, resp.Success)
+	assert.Empty(t, resp.Data)
+}
+
+func TestMockServerUnavailable(t *testing.T) {
+	server := workersqltest.NewMockServer(t)
+	client := server.NewClient(t)
+	ctx := context.Background()
+
+	server.SetAvailable(false)
+	_, err := client.Query(ctx, "SELECT 1")
+	assert.ErrorContains(t, err, "503")
+	_, err = client.Health(ctx)
+	assert.Error(t, err)
+	assert.Empty(t, server.Calls(), "statements sent while down aren't recorded")
+
+	server.SetAvailable(true)
+	_, err = client.Query(ctx, "SELECT 1")
+	require.NoError(t, err)
+	assert.Len(t, server.Calls(), 1)
+	assert.Equal(t, 1, server.HealthChecks())
+}
+
+func TestMockServerRoutesAndStatus(t *testing.T) {
+	server := workersqltest.NewMockServer(t)
+	server.On("SELECT * FROM big_table").Respond(func(workersqltest.Call) workersqltest.Result {
+		return workersqltest.Result{Status: http.StatusBadRequest, Error: &workersql.ErrorResponse{Code: "QUERY_CANCELLED", Message: "query cancelled"}}
+	})
+	var cancels int32
+	server.Handle("/query/cancel", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&cancels, 1)
+		_, _ = w.Write([]byte(`{"success": true}`))
+	}))
+	client := server.NewClient(t)
+	ctx := context.Background()
+
+	_, err := client.Query(ctx, "SELECT * FROM big_table")
+	assert.ErrorContains(t, err, "QUERY_CANCELLED: query cancelled", "an error status fails the request")
+	require.NoError(t, client.CancelQuery(ctx, "q-1"))
+	assert.EqualValues(t, 1, atomic.LoadInt32(&cancels))
+	assert.Len(t, server.Calls(), 1, "requests to added routes aren't statements")
+}
+
+func TestMockServerTransactions(t *testing.T) {
+	for _, transport := range []workersql.TransactionTransport{workersql.TransactionTransportWebSocket, workersql.TransactionTransportHTTP} {
+		t.Run(string(transport), func(t *testing.T) {
+			server := workersqltest.NewMockServer(t)
+			server.On("SELECT balance FROM accounts WHERE id = ?").Return(map[string]interface{}{"balance": 100})
+			config := server.Config()
+			config.TransactionTransport = transport
+			client, err := workersql.NewClient(config)
+			require.NoError(t, err)
+			defer client.Close()
+			ctx := context.Background()
+
+			err = client.Transaction(ctx, func(ctx context.Context, tx *workersql.TransactionClient) error {
+				resp, err := tx.Query(ctx, "SELECT balance FROM accounts WHERE id = ?", 1)
+				if err != nil {
+					return err
+				}
+				assert.EqualValues(t, 100, resp.Data[0]["balance"])
+				_, err = tx.Exec(ctx, "UPDATE accounts SET balance = ? WHERE id = ?", 50, 1)
+				return err
+			})
+			require.NoError(t, err)
+
+			err = client.Transaction(ctx, func(ctx context.Context, tx *workersql.TransactionClient) error {
+				_, _ = tx.Exec(ctx, "DELETE FROM accounts")
+				return errors.New("changed my mind")
+			})
+			require.Error(t, err)
+
+			txs := server.Transactions()
+			require.Len(t, txs, 2)
+			assert.True(t, txs[0].Committed)
+			require.Len(t, txs[0].Statements, 2)
+			assert.Equal(t, workersqltest.OpExec, txs[0].Statements[1].Op)
+			assert.Equal(t, txs[0].ID, txs[0].Statements[1].TransactionID)
+			assert.True(t, txs[1].RolledBack)
+		})
+	}
+}
+
+func TestFakeClient(t *testing.T) {
+	fake := workersqltest.NewFakeClient()
+	fake.On("SELECT name FROM users WHERE id = ?").Respond(func(c workersqltest.Call) workersqltest.Result {
+		return workersqltest.Result{Rows: []map[string]interface{}{{"name": "user", "id": c.Params[0]}}}
+	})
+	fake.On("UPDATE users SET name = ? WHERE id = ?").ReturnExec(1, 0)
+	ctx := context.Background()
+
+	var q workersql.Querier = fake
+	resp, err := q.Query(ctx, "SELECT name FROM users WHERE id = ?", 7)
+	require.NoError(t, err)
+	assert.Equal(t, 7, resp.Data[0]["id"])
+
+	res, err := q.Exec(ctx, "UPDATE users SET name = ? WHERE id = ?", "ada", 7)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.AffectedRows)
+	assert.Equal(t, []interface{}{"ada", 7}, fake.Calls()[1].Params)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = q.Exec(cancelled, "DELETE FROM users")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Len(t, fake.Calls(), 2)
+}
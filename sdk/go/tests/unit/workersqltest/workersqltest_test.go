@@ -0,0 +1,82 @@
+package workersqltest_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	gws "github.com/gorilla/websocket"
+	"github.com/healthfees-org/workersql/sdk/go/internal/websocket"
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersql"
+	"github.com/healthfees-org/workersql/sdk/go/pkg/workersqltest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newClient returns a client of a gateway stub recording the frames it
+// receives
+func newClient(t *testing.T) (*workersql.Client, func() []string) {
+	var mu sync.Mutex
+	var frames []string
+	upgrader := gws.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			var msg websocket.Message
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			mu.Lock()
+			frames = append(frames, fmt.Sprintf("%s %s", msg.Type, msg.SQL))
+			mu.Unlock()
+			reply := websocket.Message{Type: websocket.FrameResponse, ID: msg.ID, Data: map[string]interface{}{"success": true}}
+			if msg.Type == websocket.FrameBegin {
+				reply.Data = map[string]interface{}{"transactionId": "tx_1"}
+			}
+			if err := conn.WriteJSON(reply); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	client, err := workersql.NewClient(workersql.Config{APIEndpoint: srv.URL})
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), frames...)
+	}
+}
+
+func TestRunInRollbackTx(t *testing.T) {
+	client, frames := newClient(t)
+
+	workersqltest.RunInRollbackTx(t, client, func(tx workersql.Querier) {
+		_, err := tx.Exec(context.Background(), "INSERT INTO users (name) VALUES (?)", "ada")
+		require.NoError(t, err)
+		_, isTx := tx.(*workersql.TransactionClient)
+		assert.False(t, isTx, "the transaction can't be committed")
+	})
+
+	assert.Equal(t, []string{"begin ", "query INSERT INTO users (name) VALUES (?)", "rollback "}, frames())
+}
+
+func TestRunInRollbackTxRollsBackOnPanic(t *testing.T) {
+	client, frames := newClient(t)
+
+	assert.Panics(t, func() {
+		workersqltest.RunInRollbackTx(t, client, func(tx workersql.Querier) {
+			panic("boom")
+		})
+	})
+	assert.Equal(t, []string{"begin ", "rollback "}, frames())
+}